@@ -0,0 +1,273 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ChangeKind is the kind of change of Diff.
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// Change of a node of Diff.
+type Change struct {
+	Kind ChangeKind
+	// Path of fields from the root to the node, like Left.Arguments[1],
+	// in the second tree, or in the first tree for removed nodes.
+	Path string
+	// From is the node of the first tree, or nil for added nodes, and To is
+	// the node of the second tree, or nil for removed nodes. Spans of nodes
+	// in sources are returned by parser.Spans.
+	From, To Node
+}
+
+func (c Change) String() string {
+	path := c.Path
+	if path == "" {
+		path = "root"
+	}
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("added %v: %v", path, describe(c.To))
+	case Removed:
+		return fmt.Sprintf("removed %v: %v", path, describe(c.From))
+	}
+	return fmt.Sprintf("changed %v: %v -> %v", path, describe(c.From), describe(c.To))
+}
+
+// describe returns the kind of the node with its fields, which are not
+// nodes, like Binary(+) or Identifier(a).
+func describe(node Node) string {
+	name := strings.TrimSuffix(reflect.TypeOf(node).Elem().Name(), "Node")
+	if s := scalars(node); s != "" {
+		return name + "(" + s + ")"
+	}
+	return name
+}
+
+// Diff returns changes of nodes, which turn tree a into tree b. Nodes of
+// different kinds, like a call replacing an identifier, are changed as a
+// whole. Nodes of the same kind with different fields, like operators of
+// binary nodes, are changed, and their children are compared. Elements of
+// arrays, arguments of calls and pairs of maps, which are equal, are
+// matched in order, and the rest are added, removed or changed.
+func Diff(a, b Node) []Change {
+	var changes []Change
+	diff(&changes, "", a, b)
+	return changes
+}
+
+func diff(changes *[]Change, path string, a, b Node) {
+	switch {
+	case isNil(a) && isNil(b):
+		return
+	case isNil(a):
+		*changes = append(*changes, Change{Kind: Added, Path: path, To: b})
+		return
+	case isNil(b):
+		*changes = append(*changes, Change{Kind: Removed, Path: path, From: a})
+		return
+	case reflect.TypeOf(a) != reflect.TypeOf(b):
+		*changes = append(*changes, Change{Kind: Changed, Path: path, From: a, To: b})
+		return
+	case canonical(a) == canonical(b):
+		return
+	}
+	if scalars(a) != scalars(b) {
+		*changes = append(*changes, Change{Kind: Changed, Path: path, From: a, To: b})
+	}
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		f := va.Type().Field(i)
+		switch {
+		case f.Type == nodeType:
+			diff(changes, join(path, f.Name), child(va.Field(i)), child(vb.Field(i)))
+		case f.Type == nodesType:
+			diffList(changes, join(path, f.Name), va.Field(i).Interface().([]Node), vb.Field(i).Interface().([]Node))
+		}
+	}
+}
+
+// diffList matches equal nodes of lists by their longest common
+// subsequence, and pairs the rest between matches in order.
+func diffList(changes *[]Change, path string, a, b []Node) {
+	keysA, keysB := make([]string, len(a)), make([]string, len(b))
+	for i, n := range a {
+		keysA[i] = canonical(n)
+	}
+	for j, n := range b {
+		keysB[j] = canonical(n)
+	}
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if keysA[i] == keysB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var removed, added []int
+	flush := func() {
+		for k := 0; k < len(removed) || k < len(added); k++ {
+			switch {
+			case k < len(removed) && k < len(added):
+				diff(changes, index(path, added[k]), a[removed[k]], b[added[k]])
+			case k < len(removed):
+				diff(changes, index(path, removed[k]), a[removed[k]], nil)
+			default:
+				diff(changes, index(path, added[k]), nil, b[added[k]])
+			}
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && keysA[i] == keysB[j]:
+			flush()
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func index(path string, i int) string {
+	return fmt.Sprintf("%v[%v]", path, i)
+}
+
+// Equivalent reports whether trees are equal in normal form of Normalize,
+// like a == b and b == a, or a && b and b and a.
+func Equivalent(a, b Node) bool {
+	return canonical(Normalize(a)) == canonical(Normalize(b))
+}
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	nodesType = reflect.TypeOf([]Node{})
+)
+
+// checked are fields set by the checker, which are not compared.
+var checked = map[string]bool{
+	"Deref":       true,
+	"FieldIndex":  true,
+	"Method":      true,
+	"MethodIndex": true,
+	"Typed":       true,
+	"Fast":        true,
+	"Func":        true,
+	"Context":     true,
+	"Regexp":      true,
+}
+
+func isNil(node Node) bool {
+	return node == nil || reflect.ValueOf(node).IsNil()
+}
+
+func child(v reflect.Value) Node {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Interface().(Node)
+}
+
+// field reports whether the field of the node is syntax, and is compared.
+func field(node Node, f reflect.StructField) bool {
+	if f.PkgPath != "" || checked[f.Name] {
+		return false
+	}
+	// Names of members are set by the checker.
+	_, member := node.(*MemberNode)
+	return !member || f.Name != "Name"
+}
+
+// scalars returns fields of the node, which are not nodes.
+func scalars(node Node) string {
+	var b strings.Builder
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !field(node, f) || f.Type == nodeType || f.Type == nodesType {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		switch x := v.Field(i).Interface().(type) {
+		case string:
+			b.WriteString(x)
+		default:
+			fmt.Fprintf(&b, "%v", x)
+		}
+	}
+	return b.String()
+}
+
+// canonical returns the key of the tree, which is equal for equal trees.
+func canonical(node Node) string {
+	var b strings.Builder
+	writeCanonical(&b, node)
+	return b.String()
+}
+
+func writeCanonical(b *strings.Builder, node Node) {
+	if isNil(node) {
+		b.WriteString("nil")
+		return
+	}
+	v := reflect.ValueOf(node).Elem()
+	b.WriteString(v.Type().Name())
+	b.WriteString("{")
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !field(node, f) {
+			continue
+		}
+		b.WriteString(f.Name)
+		b.WriteString(": ")
+		switch f.Type {
+		case nodeType:
+			writeCanonical(b, child(v.Field(i)))
+		case nodesType:
+			b.WriteString("[")
+			for j, n := range v.Field(i).Interface().([]Node) {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				writeCanonical(b, n)
+			}
+			b.WriteString("]")
+		default:
+			fmt.Fprintf(b, "%#v", v.Field(i).Interface())
+		}
+		b.WriteString("; ")
+	}
+	b.WriteString("}")
+}
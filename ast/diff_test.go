@@ -0,0 +1,116 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, input string) ast.Node {
+	tree, err := parser.Parse(input)
+	require.NoError(t, err)
+	return tree.Node
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []string
+	}{
+		{`a + b`, `a + b`, nil},
+		{`a + b`, `a - b`, []string{`changed root: Binary(+) -> Binary(-)`}},
+		{`a + b`, `a + c`, []string{`changed Right: Identifier(b) -> Identifier(c)`}},
+		{`a > 1 and b`, `a > 2 and b`, []string{`changed Left.Right: Integer(1) -> Integer(2)`}},
+		{`a`, `f(a)`, []string{`changed root: Identifier(a) -> Call`}},
+		{`f(a, b)`, `f(a, x, b)`, []string{`added Arguments[1]: Identifier(x)`}},
+		{`f(a, x, b)`, `f(a, b)`, []string{`removed Arguments[1]: Identifier(x)`}},
+		{`[1, 2, 3]`, `[1, 5, 3, 4]`, []string{`changed Nodes[1]: Integer(2) -> Integer(5)`, `added Nodes[3]: Integer(4)`}},
+		{`{a: 1}`, `{a: 1, b: 2}`, []string{`added Pairs[1]: Pair`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" -> "+tt.b, func(t *testing.T) {
+			var got []string
+			for _, c := range ast.Diff(parse(t, tt.a), parse(t, tt.b)) {
+				got = append(got, c.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDiff_nodes(t *testing.T) {
+	a, b := parse(t, `a > 1 and b`), parse(t, `a > 2 and b`)
+	changes := ast.Diff(a, b)
+	require.Len(t, changes, 1)
+	assert.Same(t, a.(*ast.BinaryNode).Left.(*ast.BinaryNode).Right, changes[0].From)
+	assert.Same(t, b.(*ast.BinaryNode).Left.(*ast.BinaryNode).Right, changes[0].To)
+}
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{`a == b`, `b == a`, true},
+		{`a != 1`, `1 != a`, true},
+		{`a and b`, `b and a`, true},
+		{`a && b`, `b and a`, true},
+		{`(a and b) and c`, `a and (c and b)`, true},
+		{`a or b and c`, `c and b or a`, true},
+		{`a < b`, `b > a`, true},
+		{`a >= 1`, `1 <= a`, true},
+		{`2 * a * b`, `b * (a * 2)`, true},
+		{`1 + 2`, `2 + 1`, true},
+		{`a ^ 2`, `a ** 2`, true},
+		{`a + b`, `b + a`, false},
+		{`a - b`, `b - a`, false},
+		{`a < b`, `a > b`, false},
+		{`a and b or c`, `a and (b or c)`, false},
+		{`f(a, b)`, `f(b, a)`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" ~ "+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.want, ast.Equivalent(parse(t, tt.a), parse(t, tt.b)))
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{`b == a`, `a == b`},
+		{`c and (b and a)`, `a and b and c`},
+		{`c || b && a`, `(a and b) or c`},
+		{`not not a`, `a`},
+		{`!!!a`, `not a`},
+		{`not true`, `false`},
+		{`b > a`, `a < b`},
+		{`a ^ 2`, `a ** 2`},
+		{`3 * x * 2`, `x * 2 * 3`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node := parse(t, tt.input)
+			dump := ast.Dump(node)
+			assert.Equal(t, ast.Dump(parse(t, tt.want)), ast.Dump(ast.Normalize(node)))
+			assert.Equal(t, ast.Hash(parse(t, tt.want)), ast.Hash(node))
+			assert.Equal(t, dump, ast.Dump(node), "input is changed")
+		})
+	}
+}
+
+func TestNormalize_literals(t *testing.T) {
+	assert.Equal(t, ast.Dump(&ast.IntegerNode{Value: -1}), ast.Dump(ast.Normalize(parse(t, `-(1)`))))
+	assert.Equal(t, ast.Dump(&ast.FloatNode{Value: 1.5}), ast.Dump(ast.Normalize(parse(t, `+1.5`))))
+	assert.Equal(t, ast.Dump(&ast.BoolNode{Value: false}), ast.Dump(ast.Normalize(parse(t, `!true`))))
+}
+
+func TestHash(t *testing.T) {
+	assert.Equal(t, ast.Hash(parse(t, `a.b > 1 && c`)), ast.Hash(parse(t, `c and 1 < a.b`)))
+	assert.NotEqual(t, ast.Hash(parse(t, `a - b`)), ast.Hash(parse(t, `b - a`)))
+	assert.NotEqual(t, ast.Hash(parse(t, `a + b`)), ast.Hash(parse(t, `b + a`)))
+}
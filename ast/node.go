@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"regexp"
 
+	"github.com/antonmedv/expr/builtin"
 	"github.com/antonmedv/expr/file"
 )
 
@@ -124,6 +125,10 @@ type CallNode struct {
 	Arguments []Node
 	Typed     int
 	Fast      bool
+	Func      *builtin.Function
+	// Context is true, if the first parameter of the function is
+	// context.Context, which is passed by the VM.
+	Context bool
 }
 
 type BuiltinNode struct {
@@ -137,8 +142,12 @@ type ClosureNode struct {
 	Node Node
 }
 
+// PointerNode is the element of the closure of a builtin, like #, or its
+// index, like #index, or the accumulator of reduce, like #acc.
 type PointerNode struct {
 	base
+	Name  string // "index", "acc" or empty for the element
+	Deref bool   // elements are converted by runtime.ValueConverter, or nullable
 }
 
 type ConditionalNode struct {
@@ -163,3 +172,68 @@ type PairNode struct {
 	Key   Node
 	Value Node
 }
+
+// VariableNode is a variable declared by let of fold, like total in
+// fold(items, let total = 0, {total = total + #}).
+type VariableNode struct {
+	base
+	Name string
+}
+
+// LetNode declares variable of fold with its initial value.
+type LetNode struct {
+	base
+	Name  string
+	Value Node
+}
+
+// AssignNode updates variable of fold, and is allowed only in the closure
+// of fold.
+type AssignNode struct {
+	base
+	Name  string
+	Value Node
+}
+
+// BlockNode is a list of assignments of the closure of fold.
+type BlockNode struct {
+	base
+	Nodes []Node
+}
+
+// TupleNode is a tuple of values, like (a, b).
+type TupleNode struct {
+	base
+	Nodes []Node
+}
+
+// BindNode binds variables to the value for the body, like let x = a * 2;
+// x + 1, or to elements of the tuple, if Tuple is set, like
+// let (q, r) = divmod(a, b); q + r.
+type BindNode struct {
+	base
+	Names []string
+	Tuple bool
+	Value Node
+	Body  Node
+}
+
+// ComprehensionNode builds an array of values of Node, or a map of pairs,
+// if Node is a PairNode, for items of Items, which match optional Cond,
+// like [x * 2 for x in items if x > 0]. Name is the variable of items.
+type ComprehensionNode struct {
+	base
+	Node  Node
+	Name  string
+	Items Node
+	Cond  Node
+}
+
+// SharedNode is a subexpression used in many places of the tree, which is
+// evaluated once per run of the program. Shared nodes are not parsed, but
+// built by compilers of decision tables.
+type SharedNode struct {
+	base
+	Name string
+	Node Node
+}
@@ -0,0 +1,200 @@
+package ast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"sort"
+)
+
+// Normalize returns a copy of the tree in normal form, where trees of
+// expressions, which differ only in ways below, are equal:
+//
+//	aliases of operators            a && b, a || b, !a, a ^ b and a and b, a or b, not a, a ** b
+//	order of commutative operands   a == b and b == a, a and b and b and a, a * b and b * a
+//	grouping of associative ones    (a and b) and c and a and (b and c)
+//	mirrored comparisons            a < b and b > a
+//	double negation                 not not a and a
+//	signs and negation of literals  -(1), +1, not true and -1, 1, false
+//
+// Operands of + are commutative only if types of both are known numbers, as
+// strings are concatenated, so trees of the checker normalize further than
+// parsed ones. Errors and calls of functions of operands of and and or may
+// differ, as their evaluation is short-circuited.
+func Normalize(node Node) Node {
+	if isNil(node) {
+		return node
+	}
+	return normalize(clone(node))
+}
+
+// Hash returns the hash of the tree in normal form of Normalize, as hex of
+// SHA-256, which is equal for trees of equal normal forms.
+func Hash(node Node) string {
+	sum := sha256.Sum256([]byte(canonical(Normalize(node))))
+	return hex.EncodeToString(sum[:])
+}
+
+// aliases of operators.
+var aliases = map[string]string{
+	"&&": "and",
+	"||": "or",
+	"!":  "not",
+	"^":  "**",
+}
+
+// mirrors of comparisons.
+var mirrors = map[string]string{
+	"<":  ">",
+	">":  "<",
+	"<=": ">=",
+	">=": "<=",
+}
+
+// clone returns a deep copy of the tree.
+func clone(node Node) Node {
+	v := reflect.ValueOf(node).Elem()
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	for i := 0; i < v.NumField(); i++ {
+		f := c.Elem().Field(i)
+		switch v.Type().Field(i).Type {
+		case nodeType:
+			if n := child(f); n != nil {
+				f.Set(reflect.ValueOf(clone(n)))
+			}
+		case nodesType:
+			nodes := f.Interface().([]Node)
+			if nodes == nil {
+				continue
+			}
+			copied := make([]Node, len(nodes))
+			for j, n := range nodes {
+				if !isNil(n) {
+					n = clone(n)
+				}
+				copied[j] = n
+			}
+			f.Set(reflect.ValueOf(copied))
+		}
+	}
+	return c.Interface().(Node)
+}
+
+// normalize normalizes children of the node, and returns the node in normal
+// form, which may be another node.
+func normalize(node Node) Node {
+	for _, n := range Children(node) {
+		*n = normalize(*n)
+	}
+	switch n := node.(type) {
+	case *UnaryNode:
+		return normalizeUnary(n)
+	case *BinaryNode:
+		return normalizeBinary(n)
+	}
+	return node
+}
+
+func normalizeUnary(n *UnaryNode) Node {
+	if alias, ok := aliases[n.Operator]; ok {
+		n.Operator = alias
+	}
+	var literal Node
+	switch x := n.Node.(type) {
+	case *UnaryNode:
+		if n.Operator == "not" && x.Operator == "not" {
+			return x.Node
+		}
+	case *BoolNode:
+		if n.Operator == "not" {
+			literal = &BoolNode{Value: !x.Value}
+		}
+	case *IntegerNode:
+		switch n.Operator {
+		case "-":
+			literal = &IntegerNode{Value: -x.Value}
+		case "+":
+			literal = &IntegerNode{Value: x.Value}
+		}
+	case *FloatNode:
+		switch n.Operator {
+		case "-":
+			literal = &FloatNode{Value: -x.Value}
+		case "+":
+			literal = &FloatNode{Value: x.Value}
+		}
+	}
+	if literal == nil {
+		return n
+	}
+	var node Node = n
+	Patch(&node, literal)
+	return node
+}
+
+func normalizeBinary(n *BinaryNode) Node {
+	if alias, ok := aliases[n.Operator]; ok {
+		n.Operator = alias
+	}
+	switch op := n.Operator; {
+	case op == "and" || op == "or" || op == "*" || op == "+" && isNumber(n.Left) && isNumber(n.Right):
+		operands := sortNodes(flatten(n, op))
+		// Operands are grouped from the left, like a and b and c.
+		left := operands[0]
+		for _, right := range operands[1 : len(operands)-1] {
+			b := &BinaryNode{Operator: op, Left: left, Right: right}
+			b.SetLocation(n.Location())
+			b.SetType(n.Type())
+			left = b
+		}
+		n.Left, n.Right = left, operands[len(operands)-1]
+	case op == "==" || op == "!=":
+		operands := sortNodes([]Node{n.Left, n.Right})
+		n.Left, n.Right = operands[0], operands[1]
+	default:
+		if mirror, ok := mirrors[op]; ok && canonical(n.Left) > canonical(n.Right) {
+			n.Operator, n.Left, n.Right = mirror, n.Right, n.Left
+		}
+	}
+	return n
+}
+
+// sortNodes sorts nodes by their keys.
+func sortNodes(nodes []Node) []Node {
+	keys := make(map[Node]string, len(nodes))
+	for _, n := range nodes {
+		keys[n] = canonical(n)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return keys[nodes[i]] < keys[nodes[j]]
+	})
+	return nodes
+}
+
+// flatten returns operands of chains of the associative operator, like a,
+// b and c of (a and b) and c.
+func flatten(node Node, op string) []Node {
+	if n, ok := node.(*BinaryNode); ok && n.Operator == op && (op != "+" || isNumber(n.Left) && isNumber(n.Right)) {
+		return append(flatten(n.Left, op), flatten(n.Right, op)...)
+	}
+	return []Node{node}
+}
+
+func isNumber(node Node) bool {
+	t := node.Type()
+	if t == nil {
+		switch node.(type) {
+		case *IntegerNode, *FloatNode:
+			return true
+		}
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package ast
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
 type Visitor interface {
 	Visit(node *Node)
@@ -60,9 +63,108 @@ func Walk(node *Node, v Visitor) {
 	case *PairNode:
 		Walk(&n.Key, v)
 		Walk(&n.Value, v)
+	case *VariableNode:
+	case *LetNode:
+		Walk(&n.Value, v)
+	case *AssignNode:
+		Walk(&n.Value, v)
+	case *BlockNode:
+		for i := range n.Nodes {
+			Walk(&n.Nodes[i], v)
+		}
+	case *TupleNode:
+		for i := range n.Nodes {
+			Walk(&n.Nodes[i], v)
+		}
+	case *BindNode:
+		Walk(&n.Value, v)
+		Walk(&n.Body, v)
+	case *ComprehensionNode:
+		Walk(&n.Items, v)
+		if n.Cond != nil {
+			Walk(&n.Cond, v)
+		}
+		Walk(&n.Node, v)
+	case *SharedNode:
+		Walk(&n.Node, v)
 	default:
 		panic(fmt.Sprintf("undefined node type (%T)", node))
 	}
 
 	v.Visit(node)
 }
+
+// Children returns pointers to children of the node, in order of Walk.
+// Optional children, which are nil, are skipped.
+func Children(node Node) []*Node {
+	var nodes []*Node
+	add := func(n *Node) {
+		if *n != nil && !reflect.ValueOf(*n).IsNil() {
+			nodes = append(nodes, n)
+		}
+	}
+	switch n := node.(type) {
+	case *UnaryNode:
+		add(&n.Node)
+	case *BinaryNode:
+		add(&n.Left)
+		add(&n.Right)
+	case *ChainNode:
+		add(&n.Node)
+	case *MemberNode:
+		add(&n.Node)
+		add(&n.Property)
+	case *SliceNode:
+		add(&n.Node)
+		add(&n.From)
+		add(&n.To)
+	case *CallNode:
+		add(&n.Callee)
+		for i := range n.Arguments {
+			add(&n.Arguments[i])
+		}
+	case *BuiltinNode:
+		for i := range n.Arguments {
+			add(&n.Arguments[i])
+		}
+	case *ClosureNode:
+		add(&n.Node)
+	case *ConditionalNode:
+		add(&n.Cond)
+		add(&n.Exp1)
+		add(&n.Exp2)
+	case *ArrayNode:
+		for i := range n.Nodes {
+			add(&n.Nodes[i])
+		}
+	case *MapNode:
+		for i := range n.Pairs {
+			add(&n.Pairs[i])
+		}
+	case *PairNode:
+		add(&n.Key)
+		add(&n.Value)
+	case *LetNode:
+		add(&n.Value)
+	case *AssignNode:
+		add(&n.Value)
+	case *BlockNode:
+		for i := range n.Nodes {
+			add(&n.Nodes[i])
+		}
+	case *TupleNode:
+		for i := range n.Nodes {
+			add(&n.Nodes[i])
+		}
+	case *BindNode:
+		add(&n.Value)
+		add(&n.Body)
+	case *ComprehensionNode:
+		add(&n.Items)
+		add(&n.Cond)
+		add(&n.Node)
+	case *SharedNode:
+		add(&n.Node)
+	}
+	return nodes
+}
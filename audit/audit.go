@@ -0,0 +1,106 @@
+// Package audit records runs of programs: inputs read by expressions,
+// results and durations, so decisions made by expressions are reproducible.
+//
+//	program, err := expr.Compile(`user.Age >= 18`, expr.Env(env),
+//		expr.Audit("adult", audit.Func(func(r *audit.Record) {
+//			log.Printf("%v: %v %v", r.ID, r.Inputs, r.Result)
+//		})),
+//		expr.AuditPolicy("user.SSN", audit.Redact))
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Record of a run of a program.
+type Record struct {
+	// ID of the expression, given by expr.Audit.
+	ID string
+	// Time of start of the run.
+	Time time.Time
+	// Duration of the run.
+	Duration time.Duration
+	// Inputs are values of fields and variables, which the expression
+	// references, by paths, like "user.Age". Values are replaced or omitted
+	// by policies of fields. Values of lazy environments are recorded only if
+	// the run fetched them.
+	Inputs map[string]interface{}
+	// Result of the run, or nil if the run failed.
+	Result interface{}
+	// Err of the run, if any.
+	Err error
+	// Tainted is true, if the result is derived from sensitive fields,
+	// given by expr.Sensitive.
+	Tainted bool
+}
+
+// Auditor receives records of runs. Programs may be run by many goroutines,
+// so auditors must be safe for concurrent use.
+type Auditor interface {
+	Audit(record *Record)
+}
+
+// Func is an Auditor calling the function.
+type Func func(record *Record)
+
+// Audit calls the function with the record.
+func (f Func) Audit(record *Record) {
+	f(record)
+}
+
+// Policy of values of inputs in records.
+type Policy int
+
+const (
+	// Keep keeps values.
+	Keep Policy = iota
+	// Redact replaces values with names of their types, like "string".
+	Redact
+	// Hash replaces values with hex SHA-256 hashes of their formatting by
+	// %v, so equal inputs of records are comparable.
+	Hash
+	// Omit removes values from records.
+	Omit
+)
+
+// Config of auditing of a program.
+type Config struct {
+	ID      string
+	Auditor Auditor
+	// Policies of inputs by paths. Policies of paths apply to their
+	// members too, so the policy of "user" applies to "user.SSN".
+	Policies map[string]Policy
+}
+
+// Apply returns the value of the input of the path by its policy, or false,
+// if it is omitted.
+func (c *Config) Apply(path string, value interface{}) (interface{}, bool) {
+	switch c.policy(path) {
+	case Redact:
+		return fmt.Sprintf("%T", value), true
+	case Hash:
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%v", value)))
+		return hex.EncodeToString(sum[:]), true
+	case Omit:
+		return nil, false
+	}
+	return value, true
+}
+
+// policy returns the policy of the path, or of its nearest parent.
+func (c *Config) policy(path string) Policy {
+	for {
+		if policy, ok := c.Policies[path]; ok {
+			return policy
+		}
+		i := strings.LastIndexByte(path, '.')
+		if i < 0 {
+			return Keep
+		}
+		path = path[:i]
+	}
+}
@@ -98,6 +98,31 @@ func Benchmark_filter(b *testing.B) {
 	}
 }
 
+func Benchmark_concat(b *testing.B) {
+	env := map[string]interface{}{
+		"Name":    "Anna",
+		"City":    "Berlin",
+		"Country": "Germany",
+	}
+
+	program, err := expr.Compile(`"Dear " + Name + ", welcome to " + City + ", " + Country + "! " + Name + ", enjoy " + City + "."`, expr.Env(env))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var out interface{}
+	for n := 0; n < b.N; n++ {
+		out, err = vm.Run(program, env)
+	}
+
+	if err != nil {
+		b.Fatal(err)
+	}
+	if out.(string) != "Dear Anna, welcome to Berlin, Germany! Anna, enjoy Berlin." {
+		b.Fail()
+	}
+}
+
 func Benchmark_access(b *testing.B) {
 	type Price struct {
 		Value int
@@ -0,0 +1,596 @@
+package builtin
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// Function describes a function available in expressions without being
+// defined in the environment.
+type Function struct {
+	// Name of the function, may be qualified with namespace, like "strings.trim".
+	Name string
+	// Doc is a short description of the function, shown by editors.
+	Doc  string
+	Func func(args ...interface{}) (interface{}, error)
+	// Types holds func types of accepted signatures. Checker picks the first
+	// signature matching arguments and uses its return type. If Types is empty,
+	// any arguments are accepted and result type is interface{}.
+	Types []reflect.Type
+	// Validate is used instead of Types to check arguments and compute
+	// result type, if more precise checks are required.
+	Validate func(args []reflect.Type) (reflect.Type, error)
+	// ValidateConst is called during compilation for every argument given
+	// as a literal, with index and value of the argument.
+	ValidateConst func(i int, value interface{}) error
+	// Defaults holds values of optional trailing parameters of Types. If
+	// arguments are omitted, defaults are passed to Func instead.
+	Defaults []interface{}
+	// Overloads are implementations of the function for different signatures,
+	// each given by a single func type in Types. Checker selects overload by
+	// types of arguments, or at runtime if types are unknown.
+	Overloads []*Function
+	// NonDeterministic functions may return different results for the same
+	// arguments, so their calls are never evaluated during compilation.
+	NonDeterministic bool
+	// NoFold functions are deterministic, but their calls are never
+	// evaluated during compilation either, like functions of the user, which
+	// may have side effects.
+	NoFold bool
+	// Cost returns the cost of the call with the arguments, charged to the
+	// memory budget of the VM before the call, for functions which work
+	// grows faster than sizes of their arguments.
+	Cost func(args []interface{}) int
+	// Random is called by the VM instead of Func with the source of random
+	// numbers of the run, if the source is injected into the VM.
+	Random func(r Rand, args ...interface{}) (interface{}, error)
+}
+
+var (
+	anyType   = reflect.TypeOf(new(interface{})).Elem()
+	arrayType = reflect.TypeOf([]interface{}{})
+)
+
+var (
+	// MaxOutputSize limits size in bytes of strings produced by builtins.
+	MaxOutputSize int = 1e6
+)
+
+var Builtins = []*Function{
+	{
+		Name:  "json.encode",
+		Doc:   "Encodes value as JSON string.",
+		Func:  toJSON,
+		Types: types(new(func(interface{}) string)),
+	},
+	{
+		Name:  "json.decode",
+		Doc:   "Decodes JSON string.",
+		Func:  fromJSON,
+		Types: types(new(func(string) interface{})),
+	},
+	{
+		Name:  "base64.encode",
+		Doc:   "Encodes string with standard base64.",
+		Func:  b64encode,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "base64.decode",
+		Doc:   "Decodes string of standard base64.",
+		Func:  b64decode,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "url.encode",
+		Doc:   "Escapes string for URL query.",
+		Func:  urlEncode,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "url.decode",
+		Doc:   "Unescapes string of URL query.",
+		Func:  urlDecode,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "hex.encode",
+		Doc:   "Encodes string as hexadecimal.",
+		Func:  hexEncode,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "hex.decode",
+		Doc:   "Decodes hexadecimal string.",
+		Func:  hexDecode,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "hash.sha256",
+		Doc:   "Returns hex encoded SHA-256 digest of string.",
+		Func:  sha256Hash,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "hash.md5",
+		Doc:   "Returns hex encoded MD5 digest of string.",
+		Func:  md5Hash,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "hash.crc32",
+		Doc:   "Returns IEEE CRC-32 checksum of string as integer.",
+		Func:  crc32Hash,
+		Types: types(new(func(string) int)),
+	},
+	{
+		Name:  "hash.hmac",
+		Doc:   "Returns hex encoded HMAC-SHA256 of data with key.",
+		Func:  hmacHash,
+		Types: types(new(func(string, string) string)),
+	},
+	{
+		Name: "rollout.percentage",
+		Doc:  "Reports, whether the key is in the percentage of keys, consistently for rollouts, like rollout.percentage(user.ID, 10).",
+		Func: percentage,
+		Types: types(
+			new(func(interface{}, int, string) bool),
+			new(func(interface{}, float64, string) bool),
+		),
+		Defaults: []interface{}{""},
+	},
+	{
+		Name:     "rollout.bucket",
+		Doc:      "Returns the bucket of the key from 0 to n-1, consistently for the same key and salt.",
+		Func:     bucket,
+		Types:    types(new(func(interface{}, int, string) int)),
+		Defaults: []interface{}{""},
+	},
+	{
+		Name:  "strings.iequals",
+		Doc:   "Reports whether strings are equal under simple Unicode case folding.",
+		Func:  iequals,
+		Types: types(new(func(string, string) bool)),
+	},
+	{
+		Name:  "strings.icontains",
+		Doc:   "Reports whether string contains substring under simple Unicode case folding.",
+		Func:  icontains,
+		Types: types(new(func(string, string) bool)),
+	},
+	{
+		Name:          "strings.glob",
+		Doc:           "Reports whether string matches shell pattern of *, ? and [...] wildcards.",
+		Func:          glob,
+		Types:         types(new(func(string, string) bool)),
+		ValidateConst: validateGlobConst,
+	},
+	{
+		Name:  "strings.levenshtein",
+		Doc:   "Returns the edit distance of strings in runes.",
+		Func:  levenshtein,
+		Types: types(new(func(string, string) int)),
+		Cost:  editDistanceCost,
+	},
+	{
+		Name:  "strings.similarity",
+		Doc:   "Returns the similarity of strings from 0 to 1, by their edit distance.",
+		Func:  similarity,
+		Types: types(new(func(string, string) float64)),
+		Cost:  editDistanceCost,
+	},
+	{
+		Name:  "strings.soundex",
+		Doc:   "Returns the American Soundex code of the string.",
+		Func:  soundex,
+		Types: types(new(func(string) string)),
+		Cost:  stringCost,
+	},
+	{
+		Name:     "geo.point",
+		Doc:      "Returns the point of the latitude and the longitude in degrees.",
+		Func:     geoPoint,
+		Validate: validateGeoPoint,
+	},
+	{
+		Name:     "geo.distance",
+		Doc:      "Returns the great-circle distance in meters between points, like geo.distance(lat1, lon1, lat2, lon2).",
+		Func:     geoDistance,
+		Validate: validateGeoDistance,
+	},
+	{
+		Name:     "geo.within",
+		Doc:      "Reports, whether the point is inside the polygon.",
+		Func:     geoWithin,
+		Validate: validateGeoWithin,
+	},
+	{
+		Name:             "rand.uuid",
+		Doc:              "Returns random UUID version 4.",
+		Func:             uuid,
+		Types:            types(new(func() string)),
+		NonDeterministic: true,
+	},
+	{
+		Name:             "rand.float",
+		Doc:              "Returns random float in [0, 1).",
+		Func:             random(randFloat),
+		Random:           randFloat,
+		Types:            types(new(func() float64)),
+		NonDeterministic: true,
+	},
+	{
+		Name:             "rand.sample",
+		Doc:              "Returns true with probability p, from 0 to 1.",
+		Func:             random(sample),
+		Random:           sample,
+		Validate:         validateNumbers("rand.sample", 1, 1, false),
+		ValidateConst:    validateSampleConst,
+		NonDeterministic: true,
+	},
+	{
+		Name:  "types.of",
+		Doc:   "Returns type of value: nil, bool, int, float, string, array, map, func or struct.",
+		Func:  typeOf,
+		Types: types(new(func(interface{}) string)),
+	},
+	{
+		Name:  "types.isNil",
+		Doc:   "Reports whether value is nil.",
+		Func:  isNil,
+		Types: types(new(func(interface{}) bool)),
+	},
+	{
+		Name:  "types.isString",
+		Doc:   "Reports whether value is string.",
+		Func:  isString,
+		Types: types(new(func(interface{}) bool)),
+	},
+	{
+		Name:  "types.isList",
+		Doc:   "Reports whether value is array.",
+		Func:  isList,
+		Types: types(new(func(interface{}) bool)),
+	},
+	{
+		Name:  "types.isMap",
+		Doc:   "Reports whether value is map.",
+		Func:  isMap,
+		Types: types(new(func(interface{}) bool)),
+	},
+	{
+		Name: "maps.keys",
+		Doc:  "Returns sorted keys of map.",
+		Func: keys,
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			return validateMap("maps.keys", args, anyType, func(t reflect.Type) reflect.Type {
+				return reflect.SliceOf(t.Key())
+			})
+		},
+	},
+	{
+		Name: "maps.values",
+		Doc:  "Returns values of map, ordered by keys.",
+		Func: values,
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			return validateMap("maps.values", args, anyType, func(t reflect.Type) reflect.Type {
+				return reflect.SliceOf(t.Elem())
+			})
+		},
+	},
+	{
+		Name: "maps.entries",
+		Doc:  "Returns array of {key, value} maps, ordered by keys.",
+		Func: entries,
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			return validateMap("maps.entries", args, arrayType, func(reflect.Type) reflect.Type {
+				return arrayType
+			})
+		},
+	},
+	{
+		Name:     "convert.int",
+		Doc:      "Converts value to int, or returns default or nil if it can not be converted.",
+		Func:     toInt,
+		Validate: validateConvert("convert.int", intType),
+	},
+	{
+		Name:     "convert.float",
+		Doc:      "Converts value to float, or returns default or nil if it can not be converted.",
+		Func:     toFloat,
+		Validate: validateConvert("convert.float", floatType),
+	},
+	{
+		Name:     "convert.bool",
+		Doc:      "Converts value to bool, or returns default or nil if it can not be converted.",
+		Func:     toBool,
+		Validate: validateConvert("convert.bool", boolType),
+	},
+	{
+		Name:     "convert.string",
+		Doc:      "Converts value to string, or returns default or nil if it can not be converted.",
+		Func:     toStr,
+		Validate: validateConvert("convert.string", stringType),
+	},
+	{
+		Name: "net.cidrContains",
+		Doc:  "Reports whether network of CIDR contains IP address.",
+		Func: cidrContains,
+		Types: types(
+			new(func(string, string) bool),
+			new(func(string, net.IP) bool),
+		),
+		ValidateConst: validateCIDR,
+	},
+	{
+		Name: "net.ipVersion",
+		Doc:  "Returns version of IP address: 4, 6, or 0 for invalid address.",
+		Func: ipVersion,
+		Types: types(
+			new(func(string) int),
+			new(func(net.IP) int),
+		),
+	},
+	{
+		Name: "net.parseIP",
+		Doc:  "Returns canonical form of IP address, or nil for invalid address.",
+		Func: parseIP,
+		Types: types(
+			new(func(string) interface{}),
+			new(func(net.IP) interface{}),
+		),
+	},
+	{
+		Name: "semver.parse",
+		Doc:  "Parses semantic version.",
+		Func: semver,
+		Types: types(
+			new(func(string) runtime.Version),
+			new(func(runtime.Version) runtime.Version),
+		),
+		ValidateConst: validateSemver,
+	},
+	{
+		Name: "semver.matches",
+		Doc:  "Reports whether version satisfies the constraint, like \">=1.2.0, <2.0.0\".",
+		Func: semverMatches,
+		Types: types(
+			new(func(string, string) bool),
+			new(func(runtime.Version, string) bool),
+		),
+		ValidateConst: validateSemver,
+	},
+	{
+		Name: "strings.trim",
+		Doc:  "Trims whitespace, or characters of cutset.",
+		Func: trim,
+		Types: types(
+			new(func(string) string),
+			new(func(string, string) string),
+		),
+	},
+	{
+		Name:  "strings.trimPrefix",
+		Doc:   "Removes prefix of string.",
+		Func:  trimPrefix,
+		Types: types(new(func(string, string) string)),
+	},
+	{
+		Name:  "strings.trimSuffix",
+		Doc:   "Removes suffix of string.",
+		Func:  trimSuffix,
+		Types: types(new(func(string, string) string)),
+	},
+	{
+		Name:  "strings.upper",
+		Doc:   "Converts string to upper case.",
+		Func:  upper,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "strings.lower",
+		Doc:   "Converts string to lower case.",
+		Func:  lower,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name:  "strings.split",
+		Doc:   "Splits string by separator.",
+		Func:  split,
+		Types: types(new(func(string, string) []string)),
+	},
+	{
+		Name: "strings.join",
+		Doc:  "Joins elements of array with separator.",
+		Func: join,
+		Types: types(
+			new(func([]string, string) string),
+			new(func([]interface{}, string) string),
+		),
+	},
+	{
+		Name:  "strings.replace",
+		Doc:   "Replaces all occurrences of old with new.",
+		Func:  replace,
+		Types: types(new(func(string, string, string) string)),
+	},
+	{
+		Name:  "strings.repeat",
+		Doc:   "Repeats string n times.",
+		Func:  repeat,
+		Types: types(new(func(string, int) string)),
+	},
+	{
+		Name:  "strings.indexOf",
+		Doc:   "Returns index of substring, or -1 if not found.",
+		Func:  indexOf,
+		Types: types(new(func(string, string) int)),
+	},
+	{
+		Name:     "math.abs",
+		Doc:      "Returns absolute value of number.",
+		Func:     abs,
+		Validate: validateNumbers("math.abs", 1, 1, true),
+	},
+	{
+		Name:     "math.ceil",
+		Doc:      "Rounds number up.",
+		Func:     float("math.ceil", math.Ceil),
+		Validate: validateNumbers("math.ceil", 1, 1, false),
+	},
+	{
+		Name:     "math.floor",
+		Doc:      "Rounds number down.",
+		Func:     float("math.floor", math.Floor),
+		Validate: validateNumbers("math.floor", 1, 1, false),
+	},
+	{
+		Name:     "math.round",
+		Doc:      "Rounds number to the nearest integer, half away from zero.",
+		Func:     float("math.round", math.Round),
+		Validate: validateNumbers("math.round", 1, 1, false),
+	},
+	{
+		Name:     "math.sqrt",
+		Doc:      "Returns square root of number.",
+		Func:     float("math.sqrt", math.Sqrt),
+		Validate: validateNumbers("math.sqrt", 1, 1, false),
+	},
+	{
+		Name:     "math.pow",
+		Doc:      "Returns x to the power of y.",
+		Func:     pow,
+		Validate: validateNumbers("math.pow", 2, 2, false),
+	},
+	{
+		Name:     "math.min",
+		Doc:      "Returns the smallest of numbers.",
+		Func:     extremum("math.min", true),
+		Validate: validateNumbers("math.min", 1, -1, true),
+	},
+	{
+		Name:     "math.max",
+		Doc:      "Returns the largest of numbers.",
+		Func:     extremum("math.max", false),
+		Validate: validateNumbers("math.max", 1, -1, true),
+	},
+	{
+		Name:     "stats.variance",
+		Doc:      "Returns the population variance of numbers.",
+		Func:     variance,
+		Validate: validateStats("stats.variance", 1, 0),
+	},
+	{
+		Name:     "stats.stddev",
+		Doc:      "Returns the population standard deviation of numbers.",
+		Func:     stddev,
+		Validate: validateStats("stats.stddev", 1, 0),
+	},
+	{
+		Name:          "stats.percentile",
+		Doc:           "Returns the p-th percentile of numbers, from 0 to 100, interpolated between closest ranks.",
+		Func:          percentile,
+		Validate:      validateStats("stats.percentile", 1, 1),
+		ValidateConst: validatePercentileConst,
+	},
+	{
+		Name:     "stats.correlation",
+		Doc:      "Returns the Pearson correlation coefficient of numbers of the same length.",
+		Func:     correlation,
+		Validate: validateStats("stats.correlation", 2, 0),
+	},
+	{
+		Name:          "log.print",
+		Doc:           "Logs the message with the level and pairs of keys and values, and returns true.",
+		Func:          logEntry,
+		Validate:      validateLog,
+		ValidateConst: validateLogConst,
+		// Calls are never removed by compilation.
+		NonDeterministic: true,
+	},
+}
+
+// Aliases holds names of builtins of namespaces by their names without
+// namespaces, like "json.encode" of "toJSON". Both names are available by
+// default. Functions of the locale namespace are added by the exprlocale
+// module.
+var Aliases = map[string]string{
+	"toJSON":         "json.encode",
+	"fromJSON":       "json.decode",
+	"b64encode":      "base64.encode",
+	"b64decode":      "base64.decode",
+	"urlEncode":      "url.encode",
+	"urlDecode":      "url.decode",
+	"hexEncode":      "hex.encode",
+	"hexDecode":      "hex.decode",
+	"sha256":         "hash.sha256",
+	"md5":            "hash.md5",
+	"crc32":          "hash.crc32",
+	"hmac":           "hash.hmac",
+	"percentage":     "rollout.percentage",
+	"bucket":         "rollout.bucket",
+	"iequals":        "strings.iequals",
+	"icontains":      "strings.icontains",
+	"glob":           "strings.glob",
+	"levenshtein":    "strings.levenshtein",
+	"similarity":     "strings.similarity",
+	"soundex":        "strings.soundex",
+	"geoPoint":       "geo.point",
+	"geoDistance":    "geo.distance",
+	"geoWithin":      "geo.within",
+	"uuid":           "rand.uuid",
+	"randFloat":      "rand.float",
+	"sample":         "rand.sample",
+	"type":           "types.of",
+	"isNil":          "types.isNil",
+	"isString":       "types.isString",
+	"isList":         "types.isList",
+	"isMap":          "types.isMap",
+	"keys":           "maps.keys",
+	"values":         "maps.values",
+	"entries":        "maps.entries",
+	"toInt":          "convert.int",
+	"toFloat":        "convert.float",
+	"toBool":         "convert.bool",
+	"toString":       "convert.string",
+	"cidrContains":   "net.cidrContains",
+	"ipVersion":      "net.ipVersion",
+	"parseIP":        "net.parseIP",
+	"semver":         "semver.parse",
+	"semverMatches":  "semver.matches",
+	"variance":       "stats.variance",
+	"stddev":         "stats.stddev",
+	"percentile":     "stats.percentile",
+	"correlation":    "stats.correlation",
+	"formatNumber":   "locale.formatNumber",
+	"formatCurrency": "locale.formatCurrency",
+	"formatDate":     "locale.formatDate",
+	"log":            "log.print",
+}
+
+func types(fns ...interface{}) []reflect.Type {
+	ts := make([]reflect.Type, len(fns))
+	for i, fn := range fns {
+		ts[i] = reflect.TypeOf(fn).Elem()
+	}
+	return ts
+}
+
+func checkOutputSize(name string, size int) error {
+	if size > MaxOutputSize {
+		return fmt.Errorf("%v: output size limit exceeded (%v > %v)", name, size, MaxOutputSize)
+	}
+	return nil
+}
+
+func toString(name string, arg interface{}) (string, error) {
+	s, ok := arg.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+	}
+	return s, nil
+}
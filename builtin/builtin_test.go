@@ -0,0 +1,462 @@
+package builtin_test
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltin(t *testing.T) {
+	env := map[string]interface{}{
+		"payload": map[string]interface{}{"id": 1, "tags": []string{"a", "b"}},
+		"raw":     `{"user": {"name": "John"}}`,
+		"ip":      net.ParseIP("127.0.0.1"),
+		"version": "2.4.1",
+		"numbers": map[int]string{10: "ten", -1: "minus one", 2: "two"},
+		"mixed":   map[interface{}]int{"b": 1, 2.5: 2, "a": 3, 1: 4},
+		"zone":    builtin.Polygon{{52.3, 13.1}, {52.3, 13.8}, {52.7, 13.8}, {52.7, 13.1}},
+	}
+
+	var tests = []struct {
+		input string
+		want  interface{}
+	}{
+		{`json.encode(payload)`, `{"id":1,"tags":["a","b"]}`},
+		{`json.encode("hello")`, `"hello"`},
+		{`json.decode(raw).user.name`, "John"},
+		{`json.decode("[1, 2, 3]")[1] == 2`, true},
+		{`json.decode(json.encode(payload)).tags[1]`, "b"},
+		{`base64.encode("hello world")`, "aGVsbG8gd29ybGQ="},
+		{`base64.decode("aGVsbG8gd29ybGQ=")`, "hello world"},
+		{`url.encode("a b&c=d")`, "a+b%26c%3Dd"},
+		{`url.decode("a+b%26c%3Dd")`, "a b&c=d"},
+		{`hex.encode("hi")`, "6869"},
+		{`hex.decode("6869")`, "hi"},
+		{`hash.sha256("abc")`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`hash.md5("abc")`, "900150983cd24fb0d6963f7d28e17f72"},
+		{`hash.crc32("abc")`, 891568578},
+		{`hash.crc32(raw) % 10 < 10`, true},
+		{`hash.hmac("key", "The quick brown fox jumps over the lazy dog")`, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{`len(rand.uuid())`, 36},
+		{`rand.uuid() != rand.uuid()`, true},
+		{`types.of(nil)`, "nil"},
+		{`types.of(true)`, "bool"},
+		{`types.of(42)`, "int"},
+		{`types.of(4.2)`, "float"},
+		{`types.of("str")`, "string"},
+		{`types.of(payload.tags)`, "array"},
+		{`types.of(payload)`, "map"},
+		{`types.isNil(payload.missing)`, true},
+		{`types.isNil(payload)`, false},
+		{`types.isString(raw)`, true},
+		{`types.isString(payload.id)`, false},
+		{`types.isList(payload.tags)`, true},
+		{`types.isMap(payload)`, true},
+		{`types.isMap(payload.tags)`, false},
+		{`len(maps.keys(payload))`, 2},
+		{`"tags" in maps.keys(payload)`, true},
+		{`1 in maps.values(payload)`, true},
+		{`len(maps.entries(payload))`, 2},
+		{`all(maps.entries(payload), {.key in payload})`, true},
+		{`maps.keys({c: 1, a: 2, b: 3})`, []string{"a", "b", "c"}},
+		{`maps.values({c: 1, a: 2, b: 3})`, []interface{}{2, 3, 1}},
+		{`map(maps.entries({b: 1, a: 2}), {.key})`, []interface{}{"a", "b"}},
+		{`maps.keys(numbers)`, []int{-1, 2, 10}},
+		{`maps.keys(mixed)`, []interface{}{1, 2.5, "a", "b"}},
+		{`types.isString(payload.id) && len(payload.id) > 0`, false},
+		{`types.isList(payload.tags) ? payload.tags[0] : "none"`, "a"},
+		{`types.of(payload) == "map" && payload.id == 1`, true},
+		{`convert.int("42")`, 42},
+		{`convert.int(" 42 ")`, 42},
+		{`convert.int(4.7)`, 4},
+		{`convert.int("4.7")`, nil},
+		{`convert.int("abc", -1)`, -1},
+		{`convert.int(payload.missing, 0) + 1`, 1},
+		{`convert.float("2.5")`, 2.5},
+		{`convert.float(payload.id)`, 1.0},
+		{`convert.float("abc", 0)`, 0.0},
+		{`convert.bool("true")`, true},
+		{`convert.bool("yes")`, nil},
+		{`convert.bool(1, false)`, false},
+		{`convert.string(42)`, "42"},
+		{`convert.string(2.5)`, "2.5"},
+		{`convert.string(true)`, "true"},
+		{`convert.string(payload.tags, "")`, ""},
+		{`convert.string(nil)`, nil},
+		{`net.cidrContains("10.0.0.0/8", "10.1.2.3")`, true},
+		{`net.cidrContains("10.0.0.0/8", "192.168.0.1")`, false},
+		{`net.cidrContains("2001:db8::/32", "2001:db8::1")`, true},
+		{`net.cidrContains("10.0.0.0/8", "invalid")`, false},
+		{`net.cidrContains("127.0.0.0/8", ip)`, true},
+		{`net.ipVersion("10.0.0.1")`, 4},
+		{`net.ipVersion("::1")`, 6},
+		{`net.ipVersion("invalid")`, 0},
+		{`net.ipVersion(ip)`, 4},
+		{`net.parseIP("::ffff:10.0.0.1")`, "10.0.0.1"},
+		{`net.parseIP("invalid")`, nil},
+		{`semver.parse(version) >= semver.parse("2.3.0")`, true},
+		{`semver.parse(version) < semver.parse("2.10.0")`, true},
+		{`semver.parse("1.0.0-alpha") < semver.parse("1.0.0")`, true},
+		{`semver.parse("1.0.0-alpha.2") < semver.parse("1.0.0-alpha.10")`, true},
+		{`semver.parse("1.0.0-alpha.beta") > semver.parse("1.0.0-alpha.1")`, true},
+		{`semver.parse("v1.2.3+build") == semver.parse("1.2.3")`, true},
+		{`semver.parse("1.2") == semver.parse("1.2.0")`, true},
+		{`semver.parse(version).Major`, 2},
+		{`semver.matches(version, ">=2.0.0, <3.0.0")`, true},
+		{`semver.matches(version, ">= 2.5")`, false},
+		{`semver.matches(version, "~2.4")`, true},
+		{`semver.matches(version, "~2.3.0")`, false},
+		{`semver.matches(version, "^2.0.0")`, true},
+		{`semver.matches("0.3.1", "^0.2.0")`, false},
+		{`semver.matches("1.5.0", "<1.0.0 || >=1.4.0 !=1.4.2")`, true},
+		{`semver.matches(semver.parse(version), "2.4.1")`, true},
+		{`strings.trim("  a ")`, "a"},
+		{`strings.trim("xxaxx", "x")`, "a"},
+		{`strings.trimPrefix("foobar", "foo")`, "bar"},
+		{`strings.trimSuffix("foobar", "bar")`, "foo"},
+		{`strings.upper("abc")`, "ABC"},
+		{`strings.lower("ABC")`, "abc"},
+		{`strings.split("a,b,c", ",")[1]`, "b"},
+		{`strings.join(strings.split("a,b,c", ","), "-")`, "a-b-c"},
+		{`strings.join(payload.tags, "+")`, "a+b"},
+		{`strings.join(["x", "y"], "")`, "xy"},
+		{`strings.replace("aaa", "a", "b")`, "bbb"},
+		{`strings.repeat("ab", 3)`, "ababab"},
+		{`strings.indexOf("chicken", "ken")`, 4},
+		{`math.abs(-3)`, 3},
+		{`math.abs(-2.5)`, 2.5},
+		{`math.abs(payload.id)`, 1},
+		{`math.ceil(1.2)`, 2.0},
+		{`math.floor(1.8)`, 1.0},
+		{`math.round(2.5)`, 3.0},
+		{`math.sqrt(16)`, 4.0},
+		{`math.pow(2, 10)`, 1024.0},
+		{`math.min(3, 1, 2)`, 1},
+		{`math.max(3, 1.5, 2)`, 3.0},
+		{`math.max(1, 2) + 1`, 3},
+		{`stats.variance([2, 4, 4, 4, 5, 5, 7, 9])`, 4.0},
+		{`stats.stddev([2, 4, 4, 4, 5, 5, 7, 9])`, 2.0},
+		{`stats.variance([1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16])`, 22.5},
+		{`stats.stddev([5])`, 0.0},
+		{`stats.percentile([4, 1, 3, 2], 50)`, 2.5},
+		{`stats.percentile([4, 1, 3, 2], 0)`, 1.0},
+		{`stats.percentile([4, 1, 3, 2], 100)`, 4.0},
+		{`stats.percentile([15, 20, 35, 40, 50], 40)`, 29.0},
+		{`stats.correlation([1, 2, 3], [2, 4, 6])`, 1.0},
+		{`stats.correlation([1, 2, 3], [3, 2, 1])`, -1.0},
+		{`stats.correlation([1, 2, 3, 4], [1, 3, 2, 4])`, 0.8},
+		{`rollout.bucket(payload.id, 10)`, 3},
+		{`rollout.bucket(42, 1000)`, 637},
+		{`rollout.bucket(42, 10) == rollout.bucket("42", 10)`, true},
+		{`rollout.bucket(42, 10, "checkout")`, 2},
+		{`rollout.percentage(42, 50)`, true},
+		{`rollout.percentage(42, 10)`, false},
+		{`rollout.percentage(42, 12.5, "checkout")`, false},
+		{`rollout.percentage(42, 0) || !rollout.percentage(42, 100)`, false},
+		{`geo.point(52.52, 13.405).Lat`, 52.52},
+		{`math.round(geo.distance(52.52, 13.405, 48.8566, 2.3522) / 1000)`, 877.0},
+		{`geo.distance(geo.point(52.52, 13.405), [48.8566, 2.3522]) == geo.distance(52.52, 13.405, 48.8566, 2.3522)`, true},
+		{`geo.distance(1, 2, 1, 2)`, 0.0},
+		{`geo.within(geo.point(52.52, 13.405), zone)`, true},
+		{`geo.within([48.8566, 2.3522], zone)`, false},
+		{`geo.within([1, 1], [[0, 0], [0, 2], [2, 2], [2, 0]])`, true},
+		{`geo.within([1, 3], [[0, 0], [0, 2], [2, 2], [2, 0]])`, false},
+		{`geo.within([3, 2], [[0, 0], [0, 4], [4, 4], [2, 2], [4, 0]])`, false},
+		{`geo.within([3, 0.5], [[0, 0], [0, 4], [4, 4], [2, 2], [4, 0]])`, true},
+		{`strings.iequals("Straße", "STRAßE")`, true},
+		{`strings.iequals("Σίσυφος", "ΣΊΣΥΦΟΣ")`, true},
+		{`strings.iequals("a", "b")`, false},
+		{`strings.icontains("Hello World", "WORLD")`, true},
+		{`strings.icontains("K", "k")`, true},
+		{`strings.icontains("Hello", "x")`, false},
+		{`strings.iequals("ß", "SS")`, false},
+		{`strings.icontains("ﬁle", "FI")`, false},
+		{`strings.glob("report-2023.csv", "report-*.csv")`, true},
+		{`strings.glob("a/b/c", "a*c")`, true},
+		{`strings.glob("file1", "file?")`, true},
+		{`strings.glob("file10", "file?")`, false},
+		{`strings.glob("b", "[abc]") && strings.glob("x", "[!abc]") && strings.glob("5", "[0-9]")`, true},
+		{`strings.glob("*", "\\*") && !strings.glob("a", "\\*")`, true},
+		{`strings.glob(version, strings.repeat("?", 5))`, true},
+		{`strings.levenshtein("kitten", "sitting")`, 3},
+		{`strings.levenshtein("", "abc")`, 3},
+		{`strings.levenshtein("straße", "strasse")`, 2},
+		{`strings.similarity("abcd", "abcf")`, 0.75},
+		{`strings.similarity("", "")`, 1.0},
+		{`strings.soundex("Robert") == strings.soundex("Rupert")`, true},
+		{`strings.soundex("Ashcraft")`, "A261"},
+		{`strings.soundex("Tymczak")`, "T522"},
+		{`strings.soundex("Lee")`, "L000"},
+		{`strings.soundex("123")`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			program, err := expr.Compile(test.input, expr.Env(env))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, out)
+
+			out, err = expr.Eval(test.input, env)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, out)
+		})
+	}
+}
+
+func TestBuiltin_uuid(t *testing.T) {
+	out, err := expr.Eval(`rand.uuid()`, nil)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, out)
+}
+
+func TestBuiltin_sample(t *testing.T) {
+	program, err := expr.Compile(`[rand.sample(0.5), rand.sample(0), rand.sample(1), rand.float()]`)
+	require.NoError(t, err)
+
+	first, err := expr.RunRand(program, nil, rand.New(rand.NewSource(42)))
+	require.NoError(t, err)
+	second, err := expr.RunRand(program, nil, rand.New(rand.NewSource(42)))
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	out := first.([]interface{})
+	assert.Equal(t, false, out[1])
+	assert.Equal(t, true, out[2])
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		out, err := expr.Run(program, nil)
+		require.NoError(t, err)
+		if out.([]interface{})[0] == true {
+			sampled++
+		}
+		assert.True(t, out.([]interface{})[3].(float64) < 1)
+	}
+	assert.InDelta(t, 500, sampled, 100)
+
+	_, err = expr.Compile(`rand.sample(1.5)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid probability for rand.sample (1.5)")
+
+	_, err = expr.Compile(`rand.sample(0.1)`, expr.Deterministic())
+	require.Error(t, err)
+}
+
+func TestBuiltin_percentage(t *testing.T) {
+	program, err := expr.Compile(`[rollout.percentage(key, 10), rollout.percentage(key, 20), rollout.bucket(key, 4)]`,
+		expr.Env(map[string]interface{}{"key": 0}))
+	require.NoError(t, err)
+
+	in10, in20 := 0, 0
+	buckets := make([]int, 4)
+	for key := 0; key < 10000; key++ {
+		out, err := expr.Run(program, map[string]interface{}{"key": key})
+		require.NoError(t, err)
+		results := out.([]interface{})
+		if results[0].(bool) {
+			in10++
+			require.True(t, results[1].(bool), "keys in 10% must be in 20%")
+		}
+		if results[1].(bool) {
+			in20++
+		}
+		buckets[results[2].(int)]++
+	}
+	assert.InDelta(t, 1000, in10, 150)
+	assert.InDelta(t, 2000, in20, 200)
+	for _, n := range buckets {
+		assert.InDelta(t, 2500, n, 250)
+	}
+}
+
+func TestBuiltin_errors(t *testing.T) {
+	var errorTests = []struct {
+		input string
+		err   string
+	}{
+		{`json.decode("{")`, "unexpected end of JSON input"},
+		{`base64.decode("!")`, "illegal base64 data"},
+		{`hex.decode("zz")`, "invalid byte"},
+		{`url.decode("%")`, "invalid URL escape"},
+		{`strings.glob("a", "[a")`, "invalid pattern for strings.glob (unterminated class at 0)"},
+		{`strings.glob("a", "[z-a]")`, "invalid pattern for strings.glob (error parsing regexp: invalid character class range: `z-a`)"},
+		{`stats.variance([])`, "invalid argument for stats.variance (empty array)"},
+		{`stats.stddev(["a"])`, "invalid argument for stats.stddev (type string)"},
+		{`stats.percentile([1], 101)`, "invalid percentile for stats.percentile (101)"},
+		{`stats.correlation([1, 2], [1])`, "mismatched lengths of arrays for stats.correlation (2 and 1)"},
+		{`rollout.bucket(1, 0)`, "invalid number of buckets for rollout.bucket (0)"},
+		{`rollout.percentage(nil, 10)`, "invalid argument for rollout.percentage (type <nil>)"},
+		{`geo.distance(1, 2, 3)`, "invalid number of arguments for geo.distance (expected 2 or 4, got 3)"},
+		{`geo.distance("a", 2, 3, 4)`, "invalid argument for geo.distance (type string)"},
+		{`geo.within([1], [[0, 0], [0, 2], [2, 2]])`, "invalid point for geo.within (type []interface {})"},
+		{`geo.within([1, 1], 2)`, "invalid polygon for geo.within (type int)"},
+		{`geo.point(91, 0)`, "invalid latitude for geo.point (91)"},
+		{`geo.point(0, -180.5)`, "invalid longitude for geo.point (-180.5)"},
+		{`geo.distance(13.405, 52.52, 100, 2.3522)`, "invalid latitude for geo.distance (100)"},
+		{`geo.distance([0, 0], [0, 181])`, "invalid longitude for geo.distance (181)"},
+		{`geo.within([0, 0], [[0, 0], [0, 200], [2, 2]])`, "invalid longitude for geo.within (200)"},
+	}
+
+	for _, test := range errorTests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := expr.Eval(test.input, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestBuiltin_geo_points(t *testing.T) {
+	env := map[string]interface{}{
+		"store": builtin.Point{Lat: 13.405, Lon: 52.52},
+		"zone":  builtin.Polygon{{52.3, 13.1}, {52.3, 213.8}, {52.7, 13.8}},
+	}
+
+	_, err := expr.Eval(`geo.distance(store, [48.8566, 2.3522])`, env)
+	require.NoError(t, err)
+
+	env["store"] = &builtin.Point{Lat: -91, Lon: 0}
+	_, err = expr.Eval(`geo.distance(store, [48.8566, 2.3522])`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid latitude for geo.distance (-91)")
+
+	_, err = expr.Eval(`geo.within([52.5, 13.4], zone)`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid longitude for geo.within (213.8)")
+}
+
+func TestBuiltin_types(t *testing.T) {
+	_, err := expr.Compile(`base64.encode(42)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use (int) as arguments to call base64.encode")
+
+	_, err = expr.Compile(`json.encode(1, 2)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too many arguments to call json.encode")
+
+	_, err = expr.Compile(`len(json.encode(nil)) > 0`, expr.AsBool())
+	require.NoError(t, err)
+
+	_, err = expr.Compile(`convert.int("1", "2")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid default for convert.int (expected int, got string)")
+
+	_, err = expr.Compile(`convert.string(1, 2, 3)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid number of arguments for convert.string (expected 1 or 2, got 3)")
+
+	_, err = expr.Compile(`net.cidrContains("10.0.0.0/33", ip)`, expr.Env(map[string]interface{}{"ip": ""}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid CIDR address: 10.0.0.0/33 (1:18)")
+
+	_, err = expr.Compile(`semver.parse("1.x") > semver.parse(v)`, expr.Env(map[string]interface{}{"v": ""}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid semantic version: "1.x"`)
+
+	_, err = expr.Compile(`semver.matches(v, ">> 1.0")`, expr.Env(map[string]interface{}{"v": ""}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid semver constraint: ">> 1.0"`)
+
+	_, err = expr.Compile(`math.abs("1")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid argument for math.abs (type string)")
+
+	_, err = expr.Compile(`math.min()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid number of arguments for math.min (got 0)")
+
+	_, err = expr.Compile(`convert.int("1", 0) + 1`, expr.AsInt())
+	require.NoError(t, err)
+
+	_, err = expr.Compile(`convert.float("1", 0) * 2.5`, expr.AsFloat64())
+	require.NoError(t, err)
+}
+
+func TestBuiltin_type_narrowing(t *testing.T) {
+	env := map[string]interface{}{
+		"obj": map[string]interface{}{"x": nil},
+	}
+
+	var errorTests = []struct {
+		input string
+		err   string
+	}{
+		{`types.isString(obj.x) && obj.x.foo`, "type string[string] is undefined"},
+		{`types.of(obj.x) == "int" && obj.x[1:]`, "cannot slice int"},
+		{`types.isNil(obj.x) ? obj.x.foo : 0`, "cannot fetch from nil"},
+		{`maps.keys(42)`, "invalid argument for maps.keys (type int)"},
+	}
+
+	for _, test := range errorTests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := expr.Compile(test.input, expr.Env(env))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+
+	_, err := expr.Compile(`types.isList(obj.x) && obj.x[0] == 1`, expr.Env(env))
+	require.NoError(t, err)
+
+	_, err = expr.Compile(`types.isMap(obj.x) && obj.x.foo == 1`, expr.Env(env))
+	require.NoError(t, err)
+}
+
+func TestBuiltin_shadowed_by_env(t *testing.T) {
+	env := map[string]interface{}{
+		"json": map[string]interface{}{"encode": func(v interface{}) string { return "custom" }},
+	}
+
+	program, err := expr.Compile(`json.encode(1)`, expr.Env(env))
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, "custom", out)
+}
+
+func TestBuiltin_cost(t *testing.T) {
+	env := map[string]interface{}{
+		"s": strings.Repeat("a", 2000),
+	}
+
+	_, err := expr.Eval(`strings.levenshtein(s, s)`, env)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, vm.ErrMemoryBudget))
+
+	out, err := expr.Eval(`strings.similarity(s[:100], s[:50])`, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, out)
+}
+
+func TestBuiltin_max_output_size(t *testing.T) {
+	defer func(size int) { builtin.MaxOutputSize = size }(builtin.MaxOutputSize)
+	builtin.MaxOutputSize = 10
+
+	env := map[string]interface{}{
+		"s": strings.Repeat("a", 10),
+	}
+
+	_, err := expr.Eval(`base64.encode(s)`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "output size limit exceeded")
+
+	_, err = expr.Eval(`json.encode(s)`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "output size limit exceeded")
+
+	_, err = expr.Eval(`strings.repeat(s, 2)`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "output size limit exceeded")
+}
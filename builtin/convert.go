@@ -0,0 +1,180 @@
+package builtin
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	intType    = reflect.TypeOf(0)
+	floatType  = reflect.TypeOf(float64(0))
+	boolType   = reflect.TypeOf(true)
+	stringType = reflect.TypeOf("")
+)
+
+// validateConvert returns validator for conversion builtins. Conversion
+// returns nil on failure, unless default value of target type is given.
+func validateConvert(name string, target reflect.Type) func(args []reflect.Type) (reflect.Type, error) {
+	return func(args []reflect.Type) (reflect.Type, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return anyType, fmt.Errorf("invalid number of arguments for %v (expected 1 or 2, got %d)", name, len(args))
+		}
+		if len(args) == 1 {
+			return anyType, nil
+		}
+		def := args[1]
+		if def == nil || def.Kind() == reflect.Interface {
+			return anyType, nil
+		}
+		if def.Kind() == target.Kind() || (target == floatType && isIntegerKind(def.Kind())) {
+			return target, nil
+		}
+		return anyType, fmt.Errorf("invalid default for %v (expected %v, got %v)", name, target, def)
+	}
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// convert applies conversion to first argument, falls back to converted
+// default value, or to default as is if it can not be converted as well.
+func convert(fn func(v reflect.Value) (interface{}, bool), args []interface{}) interface{} {
+	if out, ok := fn(reflect.ValueOf(args[0])); ok {
+		return out
+	}
+	if len(args) < 2 {
+		return nil
+	}
+	if out, ok := fn(reflect.ValueOf(args[1])); ok {
+		return out
+	}
+	return args[1]
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func toIntValue(v reflect.Value) (interface{}, bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if int64(int(i)) != i {
+			return nil, false
+		}
+		return int(i), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		if int(u) < 0 || uint64(int(u)) != u {
+			return nil, false
+		}
+		return int(u), true
+	case reflect.Float32, reflect.Float64:
+		f := math.Trunc(v.Float())
+		if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 || float64(int(f)) != f {
+			return nil, false
+		}
+		return int(f), true
+	case reflect.String:
+		i, err := strconv.ParseInt(strings.TrimSpace(v.String()), 10, 0)
+		if err != nil {
+			return nil, false
+		}
+		return int(i), true
+	}
+	return nil, false
+}
+
+func toFloatValue(v reflect.Value) (interface{}, bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+		if err != nil {
+			return nil, false
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+func toBoolValue(v reflect.Value) (interface{}, bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.String:
+		b, err := strconv.ParseBool(strings.TrimSpace(v.String()))
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	}
+	return nil, false
+}
+
+func toStringValue(v reflect.Value) (interface{}, bool) {
+	if v.IsValid() && v.CanInterface() {
+		if s, ok := v.Interface().(fmt.Stringer); ok && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+			return s.String(), true
+		}
+	}
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), true
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true
+		}
+	}
+	return nil, false
+}
+
+func toInt(args ...interface{}) (interface{}, error) {
+	return convert(toIntValue, args), nil
+}
+
+func toFloat(args ...interface{}) (interface{}, error) {
+	return convert(toFloatValue, args), nil
+}
+
+func toBool(args ...interface{}) (interface{}, error) {
+	return convert(toBoolValue, args), nil
+}
+
+func toStr(args ...interface{}) (interface{}, error) {
+	return convert(toStringValue, args), nil
+}
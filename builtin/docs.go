@@ -0,0 +1,32 @@
+package builtin
+
+// Docs holds descriptions of builtins of the parser, like len or all, and of
+// operators and literals, which are not functions.
+var Docs = map[string]string{
+	"len":      "Returns length of array, map or string.",
+	"all":      "Reports whether all elements satisfy the predicate.",
+	"none":     "Reports whether no element satisfies the predicate.",
+	"any":      "Reports whether any element satisfies the predicate.",
+	"one":      "Reports whether exactly one element satisfies the predicate.",
+	"filter":   "Returns elements satisfying the predicate.",
+	"map":      "Returns results of the closure for every element.",
+	"count":    "Returns number of elements satisfying the predicate.",
+	"try":      "Returns the first argument, or the fallback if its evaluation fails.",
+	"fallback": "Returns the first argument, or the fallback if a call of a function with context fails or times out.",
+	"fold":     "Assigns variables declared by let for every element, and returns the first variable.",
+	"reduce":   "Returns the accumulator #acc, which is the result of the closure for the previous element.",
+
+	"true":       "Boolean true.",
+	"false":      "Boolean false.",
+	"nil":        "Absence of value.",
+	"not":        "Negates boolean, like not a, or operator, like a not in b.",
+	"in":         "Reports whether element is in array, key is in map, or field is in struct.",
+	"and":        "Reports whether both operands are true.",
+	"or":         "Reports whether any operand is true.",
+	"??":         "Returns the left operand, or the right operand if the left one is nil.",
+	"matches":    "Reports whether string matches regular expression.",
+	"like":       "Reports whether string matches SQL pattern of % and _ wildcards.",
+	"contains":   "Reports whether string contains substring.",
+	"startsWith": "Reports whether string starts with prefix.",
+	"endsWith":   "Reports whether string ends with suffix.",
+}
@@ -0,0 +1,101 @@
+package builtin
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+)
+
+func toJSON(args ...interface{}) (interface{}, error) {
+	b, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOutputSize("json.encode", len(b)); err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func fromJSON(args ...interface{}) (interface{}, error) {
+	s, err := toString("json.decode", args[0])
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func b64encode(args ...interface{}) (interface{}, error) {
+	s, err := toString("base64.encode", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOutputSize("base64.encode", base64.StdEncoding.EncodedLen(len(s))); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s)), nil
+}
+
+func b64decode(args ...interface{}) (interface{}, error) {
+	s, err := toString("base64.decode", args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func urlEncode(args ...interface{}) (interface{}, error) {
+	s, err := toString("url.encode", args[0])
+	if err != nil {
+		return nil, err
+	}
+	out := url.QueryEscape(s)
+	if err := checkOutputSize("url.encode", len(out)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func urlDecode(args ...interface{}) (interface{}, error) {
+	s, err := toString("url.decode", args[0])
+	if err != nil {
+		return nil, err
+	}
+	out, err := url.QueryUnescape(s)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func hexEncode(args ...interface{}) (interface{}, error) {
+	s, err := toString("hex.encode", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOutputSize("hex.encode", hex.EncodedLen(len(s))); err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString([]byte(s)), nil
+}
+
+func hexDecode(args ...interface{}) (interface{}, error) {
+	s, err := toString("hex.decode", args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,104 @@
+package builtin
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/antonmedv/expr/internal/edit"
+)
+
+// levenshtein returns the Levenshtein distance of strings, where swapped
+// letters are two edits, unlike in suggestions of the checker.
+func levenshtein(args ...interface{}) (interface{}, error) {
+	a, err := toString("strings.levenshtein", args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := toString("strings.levenshtein", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return edit.Distance([]rune(a), []rune(b), false), nil
+}
+
+// similarity returns 1 minus the edit distance divided by the length of the
+// longer string, so equal strings are 1 and completely different ones are 0.
+func similarity(args ...interface{}) (interface{}, error) {
+	a, err := toString("strings.similarity", args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := toString("strings.similarity", args[1])
+	if err != nil {
+		return nil, err
+	}
+	x, y := []rune(a), []rune(b)
+	n := len(x)
+	if len(y) > n {
+		n = len(y)
+	}
+	if n == 0 {
+		return 1.0, nil
+	}
+	return 1 - float64(edit.Distance(x, y, false))/float64(n), nil
+}
+
+// editDistanceCost is the cost of levenshtein and similarity, proportional
+// to the size of the matrix of the edit distance.
+func editDistanceCost(args []interface{}) int {
+	a, _ := args[0].(string)
+	b, _ := args[1].(string)
+	return utf8.RuneCountInString(a) * utf8.RuneCountInString(b)
+}
+
+// soundexCodes are digits of consonants of American Soundex, indexed by
+// letters. Vowels, and h, w and y are zeros.
+const soundexCodes = "01230120022455012623010202"
+
+// soundex returns the American Soundex code of the string, like "R163" for
+// "Robert". Non-letters are ignored, and empty string is returned for strings
+// without Latin letters.
+func soundex(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.soundex", args[0])
+	if err != nil {
+		return nil, err
+	}
+	var code strings.Builder
+	var last byte
+	for _, r := range s {
+		r = unicode.ToUpper(r)
+		if r < 'A' || r > 'Z' {
+			continue
+		}
+		digit := soundexCodes[r-'A']
+		if code.Len() == 0 {
+			code.WriteRune(r)
+			last = digit
+			continue
+		}
+		// H and W do not separate consonants of the same code, vowels do.
+		if r == 'H' || r == 'W' {
+			continue
+		}
+		if digit != '0' && digit != last {
+			code.WriteByte(digit)
+			if code.Len() == 4 {
+				break
+			}
+		}
+		last = digit
+	}
+	if code.Len() == 0 {
+		return "", nil
+	}
+	for code.Len() < 4 {
+		code.WriteByte('0')
+	}
+	return code.String(), nil
+}
+
+func stringCost(args []interface{}) int {
+	s, _ := args[0].(string)
+	return len(s)
+}
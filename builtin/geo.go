@@ -0,0 +1,206 @@
+package builtin
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Point is a location by latitude and longitude in degrees.
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Polygon is an area bounded by points. The last point is connected with the
+// first one, so it is not repeated.
+type Polygon []Point
+
+var pointType = reflect.TypeOf(Point{})
+
+// earthRadius is the mean radius of the Earth in meters.
+const earthRadius = 6371008.8
+
+func geoPoint(args ...interface{}) (interface{}, error) {
+	return newPoint("geo.point", args[0], args[1])
+}
+
+func newPoint(name string, lat, lon interface{}) (Point, error) {
+	x, _, _, err := number(name, lat)
+	if err != nil {
+		return Point{}, err
+	}
+	y, _, _, err := number(name, lon)
+	if err != nil {
+		return Point{}, err
+	}
+	return checkPoint(name, Point{Lat: x, Lon: y})
+}
+
+// checkPoint returns error for latitudes out of [-90, 90] and longitudes out
+// of [-180, 180] degrees, like of points with swapped coordinates.
+func checkPoint(name string, p Point) (Point, error) {
+	if !(p.Lat >= -90 && p.Lat <= 90) {
+		return Point{}, fmt.Errorf("invalid latitude for %v (%v)", name, p.Lat)
+	}
+	if !(p.Lon >= -180 && p.Lon <= 180) {
+		return Point{}, fmt.Errorf("invalid longitude for %v (%v)", name, p.Lon)
+	}
+	return p, nil
+}
+
+// geoDistance returns the great-circle distance between points in meters,
+// by the haversine formula.
+func geoDistance(args ...interface{}) (interface{}, error) {
+	var a, b Point
+	var err error
+	if len(args) == 4 {
+		if a, err = newPoint("geo.distance", args[0], args[1]); err != nil {
+			return nil, err
+		}
+		if b, err = newPoint("geo.distance", args[2], args[3]); err != nil {
+			return nil, err
+		}
+	} else {
+		if a, err = toPoint("geo.distance", args[0]); err != nil {
+			return nil, err
+		}
+		if b, err = toPoint("geo.distance", args[1]); err != nil {
+			return nil, err
+		}
+	}
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat, dLon := lat2-lat1, radians(b.Lon-a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h))), nil
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// geoWithin reports, whether the point is inside the polygon, by crossings
+// of edges of the polygon with the ray from the point. Coordinates are
+// treated as planar, which is precise enough for polygons of cities and
+// countries, which do not cross the antimeridian.
+func geoWithin(args ...interface{}) (interface{}, error) {
+	p, err := toPoint("geo.within", args[0])
+	if err != nil {
+		return nil, err
+	}
+	polygon, err := toPolygon("geo.within", args[1])
+	if err != nil {
+		return nil, err
+	}
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside, nil
+}
+
+// toPoint converts points, pointers to points, and arrays of latitudes and
+// longitudes, like [52.52, 13.40], to points.
+func toPoint(name string, arg interface{}) (Point, error) {
+	switch p := arg.(type) {
+	case Point:
+		return checkPoint(name, p)
+	case *Point:
+		if p != nil {
+			return checkPoint(name, *p)
+		}
+	default:
+		v := reflect.ValueOf(arg)
+		if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Len() == 2 {
+			lat, _, _, err := number(name, v.Index(0).Interface())
+			lon, _, _, err2 := number(name, v.Index(1).Interface())
+			if err == nil && err2 == nil {
+				return checkPoint(name, Point{Lat: lat, Lon: lon})
+			}
+		}
+	}
+	return Point{}, fmt.Errorf("invalid point for %v (type %T)", name, arg)
+}
+
+// toPolygon converts polygons, and arrays of values converted by toPoint, to
+// polygons.
+func toPolygon(name string, arg interface{}) (Polygon, error) {
+	switch p := arg.(type) {
+	case Polygon:
+		return p, checkPolygon(name, p)
+	case []Point:
+		return p, checkPolygon(name, p)
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("invalid polygon for %v (type %T)", name, arg)
+	}
+	polygon := make(Polygon, v.Len())
+	for i := range polygon {
+		p, err := toPoint(name, v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		polygon[i] = p
+	}
+	return polygon, nil
+}
+
+func checkPolygon(name string, polygon Polygon) error {
+	for _, p := range polygon {
+		if _, err := checkPoint(name, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateGeoPoint(args []reflect.Type) (reflect.Type, error) {
+	if _, err := validateNumbers("geo.point", 2, 2, false)(args); err != nil {
+		return pointType, err
+	}
+	return pointType, nil
+}
+
+func validateGeoDistance(args []reflect.Type) (reflect.Type, error) {
+	switch len(args) {
+	case 4:
+		return validateNumbers("geo.distance", 4, 4, false)(args)
+	case 2:
+		for _, t := range args {
+			if !isPointType(t) {
+				return floatType, fmt.Errorf("invalid point for geo.distance (type %v)", t)
+			}
+		}
+		return floatType, nil
+	}
+	return floatType, fmt.Errorf("invalid number of arguments for geo.distance (expected 2 or 4, got %d)", len(args))
+}
+
+func validateGeoWithin(args []reflect.Type) (reflect.Type, error) {
+	if len(args) != 2 {
+		return boolType, fmt.Errorf("invalid number of arguments for geo.within (expected 2, got %d)", len(args))
+	}
+	if !isPointType(args[0]) {
+		return boolType, fmt.Errorf("invalid point for geo.within (type %v)", args[0])
+	}
+	if t := args[1]; t == nil || !isListKind(t.Kind()) && t.Kind() != reflect.Interface {
+		return boolType, fmt.Errorf("invalid polygon for geo.within (type %v)", t)
+	}
+	return boolType, nil
+}
+
+func isPointType(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	return t == pointType || t == reflect.PtrTo(pointType) || t.Kind() == reflect.Interface || isListKind(t.Kind())
+}
+
+func isListKind(kind reflect.Kind) bool {
+	return kind == reflect.Slice || kind == reflect.Array
+}
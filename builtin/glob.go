@@ -0,0 +1,113 @@
+package builtin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// globs holds compiled constant patterns of glob calls. Patterns are compiled
+// once during compilation of programs, instead of on every call. Dynamic
+// patterns are compiled on every call, and are not kept.
+var globs sync.Map
+
+func glob(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.glob", args[0])
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := toString("strings.glob", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := globs.Load(pattern); ok {
+		return r.(*regexp.Regexp).MatchString(s), nil
+	}
+	r, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return r.MatchString(s), nil
+}
+
+func validateGlobConst(i int, value interface{}) error {
+	pattern, ok := value.(string)
+	if i != 1 || !ok {
+		return nil
+	}
+	r, err := globRegexp(pattern)
+	if err != nil {
+		return err
+	}
+	globs.Store(pattern, r)
+	return nil
+}
+
+// globRegexp returns the regular expression of the shell pattern, where *
+// matches any sequence of characters, ? matches any single character,
+// [abc] and [a-z] match characters of the class, [!abc] matches characters
+// not in the class, and \ escapes the next character. Unlike path.Match,
+// wildcards match separators too.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			end := i + 1
+			if end < len(runes) && runes[end] == '!' {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("invalid pattern for strings.glob (unterminated class at %v)", i)
+			}
+			b.WriteString(globClass(runes[i+1 : end]))
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString(`$`)
+	r, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern for strings.glob (%v)", err)
+	}
+	return r, nil
+}
+
+// globClass returns the regular expression of characters of the class,
+// escaping everything but ranges.
+func globClass(class []rune) string {
+	var b strings.Builder
+	b.WriteString(`[`)
+	if len(class) > 0 && class[0] == '!' {
+		b.WriteString(`^`)
+		class = class[1:]
+	}
+	for _, r := range class {
+		if r == '-' {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(string(r)))
+	}
+	b.WriteString(`]`)
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package builtin
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+)
+
+func sha256Hash(args ...interface{}) (interface{}, error) {
+	s, err := toString("hash.sha256", args[0])
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func md5Hash(args ...interface{}) (interface{}, error) {
+	s, err := toString("hash.md5", args[0])
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func crc32Hash(args ...interface{}) (interface{}, error) {
+	s, err := toString("hash.crc32", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return int(crc32.ChecksumIEEE([]byte(s))), nil
+}
+
+// hmacHash computes HMAC-SHA256 of data with key.
+func hmacHash(args ...interface{}) (interface{}, error) {
+	key, err := toString("hash.hmac", args[0])
+	if err != nil {
+		return nil, err
+	}
+	data, err := toString("hash.hmac", args[1])
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// uuid generates random (version 4) UUID.
+func uuid(...interface{}) (interface{}, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// rolloutHash returns the hash of the key with the salt: the first 8 bytes of
+// SHA-256 of the salt and the key, like "flag:42", as big-endian integer.
+// Keys, which are not strings, are formatted like convert.string.
+func rolloutHash(name string, key, salt interface{}) (uint64, error) {
+	s, ok := toStringValue(reflect.ValueOf(key))
+	if !ok || key == nil {
+		return 0, fmt.Errorf("invalid argument for %v (type %T)", name, key)
+	}
+	prefix, err := toString(name, salt)
+	if err != nil {
+		return 0, err
+	}
+	if prefix != "" {
+		prefix += ":"
+	}
+	sum := sha256.Sum256([]byte(prefix + s.(string)))
+	return binary.BigEndian.Uint64(sum[:8]), nil
+}
+
+// bucket returns the bucket of the key from 0 to n-1.
+func bucket(args ...interface{}) (interface{}, error) {
+	n, ok := args[1].(int)
+	if !ok || n <= 0 {
+		return nil, fmt.Errorf("invalid number of buckets for rollout.bucket (%v)", args[1])
+	}
+	h, err := rolloutHash("rollout.bucket", args[0], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return int(h % uint64(n)), nil
+}
+
+// percentage reports, whether the key is in the percentage of keys, with
+// precision of hundredths of percent. Keys in a percentage are in greater
+// percentages too, so rollouts are gradual.
+func percentage(args ...interface{}) (interface{}, error) {
+	var pct float64
+	switch p := args[1].(type) {
+	case int:
+		pct = float64(p)
+	case float64:
+		pct = p
+	default:
+		return nil, fmt.Errorf("invalid argument for rollout.percentage (type %T)", args[1])
+	}
+	h, err := rolloutHash("rollout.percentage", args[0], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return float64(h%10000) < pct*100, nil
+}
@@ -0,0 +1,82 @@
+package builtin
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// LogLevels are levels of entries of the log.print builtin.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// LogArgs returns the level, the message and values of arguments of the
+// log.print builtin, like log.print("warn", "high risk", "score", score).
+// Values are pairs of keys and values.
+func LogArgs(args []interface{}) (level, message string, values []interface{}, err error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return "", "", nil, fmt.Errorf("invalid number of arguments for log.print (expected level, message and pairs of keys and values, got %d)", len(args))
+	}
+	if level, err = toString("log.print", args[0]); err != nil {
+		return "", "", nil, err
+	}
+	if err = validateLogLevel(level); err != nil {
+		return "", "", nil, err
+	}
+	if message, err = toString("log.print", args[1]); err != nil {
+		return "", "", nil, err
+	}
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := args[i].(string); !ok {
+			return "", "", nil, fmt.Errorf("invalid key of value for log.print (type %T)", args[i])
+		}
+	}
+	return level, message, args[2:], nil
+}
+
+func validateLogLevel(level string) error {
+	for _, l := range LogLevels {
+		if level == l {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid level of log %q", level)
+}
+
+// logEntry checks arguments of log. Entries are discarded, unless a logger
+// is given by expr.Logger.
+func logEntry(args ...interface{}) (interface{}, error) {
+	if _, _, _, err := LogArgs(args); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func validateLog(args []reflect.Type) (reflect.Type, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return boolType, fmt.Errorf("invalid number of arguments for log.print (expected level, message and pairs of keys and values, got %d)", len(args))
+	}
+	for i, t := range args {
+		if i != 1 && i%2 == 1 {
+			continue
+		}
+		if t == nil || t.Kind() != reflect.String && t.Kind() != reflect.Interface {
+			return boolType, fmt.Errorf("invalid argument for log.print (type %v)", t)
+		}
+	}
+	return boolType, nil
+}
+
+func validateLogConst(i int, value interface{}) error {
+	switch {
+	case i == 0:
+		level, err := toString("log.print", value)
+		if err != nil {
+			return err
+		}
+		return validateLogLevel(level)
+	case i > 1 && i%2 == 0:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("invalid key of value for log.print (type %T)", value)
+		}
+	}
+	return nil
+}
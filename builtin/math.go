@@ -0,0 +1,121 @@
+package builtin
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// validateNumbers returns validator for functions accepting from min to max
+// numbers (max < 0 means no limit). If intResult is true, result type is int
+// when all arguments are integers, otherwise result type is float64.
+func validateNumbers(name string, min, max int, intResult bool) func(args []reflect.Type) (reflect.Type, error) {
+	return func(args []reflect.Type) (reflect.Type, error) {
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			return anyType, fmt.Errorf("invalid number of arguments for %v (got %d)", name, len(args))
+		}
+		result := intType
+		for _, t := range args {
+			if t == nil {
+				return anyType, fmt.Errorf("invalid argument for %v (type nil)", name)
+			}
+			switch {
+			case t.Kind() == reflect.Interface:
+				if result == intType {
+					result = anyType
+				}
+			case isIntegerKind(t.Kind()):
+			case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+				result = floatType
+			default:
+				return anyType, fmt.Errorf("invalid argument for %v (type %v)", name, t)
+			}
+		}
+		if !intResult {
+			return floatType, nil
+		}
+		return result, nil
+	}
+}
+
+// number returns argument as float64, and as int if argument is an integer.
+func number(name string, arg interface{}) (float64, int, bool, error) {
+	v := reflect.ValueOf(arg)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), int(v.Int()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), int(v.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), 0, false, nil
+	}
+	return 0, 0, false, fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+}
+
+func float(name string, fn func(float64) float64) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		f, _, _, err := number(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(f), nil
+	}
+}
+
+func abs(args ...interface{}) (interface{}, error) {
+	f, i, isInt, err := number("math.abs", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if isInt {
+		if i < 0 {
+			return -i, nil
+		}
+		return i, nil
+	}
+	return math.Abs(f), nil
+}
+
+func pow(args ...interface{}) (interface{}, error) {
+	x, _, _, err := number("math.pow", args[0])
+	if err != nil {
+		return nil, err
+	}
+	y, _, _, err := number("math.pow", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return math.Pow(x, y), nil
+}
+
+func extremum(name string, less bool) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		var (
+			best    float64
+			bestInt int
+			allInts = true
+			nan     bool
+		)
+		for i, arg := range args {
+			f, n, isInt, err := number(name, arg)
+			if err != nil {
+				return nil, err
+			}
+			allInts = allInts && isInt
+			if i == 0 || (less && f < best) || (!less && f > best) {
+				best, bestInt = f, n
+			}
+			if math.IsNaN(f) {
+				nan = true
+			}
+		}
+		if nan {
+			// NaN propagates regardless of its position, as in math.Min.
+			return math.NaN(), nil
+		}
+		if allInts {
+			return bestInt, nil
+		}
+		return best, nil
+	}
+}
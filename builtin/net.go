@@ -0,0 +1,75 @@
+package builtin
+
+import (
+	"fmt"
+	"net"
+)
+
+func ipArg(name string, arg interface{}) (net.IP, error) {
+	switch ip := arg.(type) {
+	case string:
+		return net.ParseIP(ip), nil
+	case net.IP:
+		return ip, nil
+	}
+	return nil, fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+}
+
+func parseCIDR(s string) (*net.IPNet, error) {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR address: %v", s)
+	}
+	return n, nil
+}
+
+func validateCIDR(i int, value interface{}) error {
+	if s, ok := value.(string); ok && i == 0 {
+		_, err := parseCIDR(s)
+		return err
+	}
+	return nil
+}
+
+func cidrContains(args ...interface{}) (interface{}, error) {
+	s, err := toString("net.cidrContains", args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, err := parseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := ipArg("net.cidrContains", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return ip != nil && n.Contains(ip), nil
+}
+
+func ipVersion(args ...interface{}) (interface{}, error) {
+	ip, err := ipArg("net.ipVersion", args[0])
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ip == nil:
+		return 0, nil
+	case ip.To4() != nil:
+		return 4, nil
+	case len(ip) == net.IPv6len:
+		return 6, nil
+	}
+	return 0, nil
+}
+
+func parseIP(args ...interface{}) (interface{}, error) {
+	ip, err := ipArg("net.parseIP", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if ip == nil || (ip.To4() == nil && len(ip) != net.IPv6len) {
+		return nil, nil
+	}
+	return ip.String(), nil
+}
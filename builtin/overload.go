@@ -0,0 +1,64 @@
+package builtin
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Dispatch returns function what calls the first of overloads accepting
+// arguments at runtime.
+func Dispatch(name string, overloads []*Function) *Function {
+	nonDeterministic, noFold := false, false
+	for _, o := range overloads {
+		nonDeterministic = nonDeterministic || o.NonDeterministic
+		noFold = noFold || o.NoFold
+	}
+	return &Function{
+		Name: name,
+		Func: func(args ...interface{}) (interface{}, error) {
+			for _, o := range overloads {
+				if accepts(o.Types[0], args) {
+					return o.Func(args...)
+				}
+			}
+			types := make([]string, len(args))
+			for i, arg := range args {
+				types[i] = fmt.Sprintf("%T", arg)
+			}
+			return nil, fmt.Errorf("no overload of %v accepts arguments of types %v", name, types)
+		},
+		NonDeterministic: nonDeterministic,
+		NoFold:           noFold,
+	}
+}
+
+// accepts reports whether args can be passed to a function of type fn.
+func accepts(fn reflect.Type, args []interface{}) bool {
+	numIn := fn.NumIn()
+	if fn.IsVariadic() {
+		if len(args) < numIn-1 {
+			return false
+		}
+	} else if len(args) != numIn {
+		return false
+	}
+	for i, arg := range args {
+		var in reflect.Type
+		if fn.IsVariadic() && i >= numIn-1 {
+			in = fn.In(numIn - 1).Elem()
+		} else {
+			in = fn.In(i)
+		}
+		if arg == nil {
+			switch in.Kind() {
+			case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+				continue
+			}
+			return false
+		}
+		if !reflect.TypeOf(arg).AssignableTo(in) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package builtin
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// Rand is a source of random floats in [0, 1) of functions like sample and
+// randFloat, like *rand.Rand of math/rand. Sources injected into runs make
+// results of such functions reproducible.
+type Rand interface {
+	Float64() float64
+}
+
+// defaultRand is the source of runs without injected source, seeded from
+// crypto/rand.
+var defaultRand = &lockedRand{r: rand.New(rand.NewSource(cryptoSeed()))}
+
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+func cryptoSeed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
+
+func randFloat(r Rand, _ ...interface{}) (interface{}, error) {
+	return r.Float64(), nil
+}
+
+// sample reports true with probability p, from 0 to 1.
+func sample(r Rand, args ...interface{}) (interface{}, error) {
+	p, _, _, err := number("rand.sample", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProbability(p); err != nil {
+		return nil, err
+	}
+	return r.Float64() < p, nil
+}
+
+func checkProbability(p float64) error {
+	if !(p >= 0 && p <= 1) {
+		return fmt.Errorf("invalid probability for rand.sample (%v)", p)
+	}
+	return nil
+}
+
+func validateSampleConst(_ int, value interface{}) error {
+	p, _, _, err := number("rand.sample", value)
+	if err != nil {
+		return nil
+	}
+	return checkProbability(p)
+}
+
+// random returns Func of the function of random numbers, using the default
+// source.
+func random(fn func(r Rand, args ...interface{}) (interface{}, error)) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		return fn(defaultRand, args...)
+	}
+}
@@ -0,0 +1,160 @@
+package builtin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+type comparator struct {
+	op      string
+	version runtime.Version
+}
+
+func (c comparator) match(v runtime.Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=", "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// constraint is a list of alternatives, each of them is a list of
+// comparators what all must match.
+type constraint [][]comparator
+
+func (c constraint) match(v runtime.Version) bool {
+	for _, all := range c {
+		ok := true
+		for _, cmp := range all {
+			if !cmp.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConstraint parses constraints like ">= 1.2.0, < 2.0.0 || ^3.1".
+// Comparators are separated by commas or spaces, alternatives by "||".
+func parseConstraint(s string) (constraint, error) {
+	var c constraint
+	for _, alt := range strings.Split(s, "||") {
+		var all []comparator
+		fields := strings.FieldsFunc(alt, func(r rune) bool { return r == ',' || r == ' ' })
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			str := strings.TrimLeft(field, "=!<>~^")
+			op := field[:len(field)-len(str)]
+			if str == "" && i+1 < len(fields) {
+				// Operator separated from version by space.
+				i++
+				str = fields[i]
+			}
+			v, err := runtime.ParseVersion(str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid semver constraint: %q", s)
+			}
+			switch op {
+			case "", "=", "==", "!=", ">", ">=", "<", "<=":
+				if op == "" {
+					op = "="
+				}
+				all = append(all, comparator{op, v})
+			case "~":
+				upper := runtime.Version{Major: v.Major + 1}
+				if versionParts(str) > 1 {
+					upper = runtime.Version{Major: v.Major, Minor: v.Minor + 1}
+				}
+				all = append(all, comparator{">=", v}, comparator{"<", upper})
+			case "^":
+				var upper runtime.Version
+				switch {
+				case v.Major > 0 || versionParts(str) == 1:
+					upper = runtime.Version{Major: v.Major + 1}
+				case v.Minor > 0 || versionParts(str) == 2:
+					upper = runtime.Version{Minor: v.Minor + 1}
+				default:
+					upper = runtime.Version{Patch: v.Patch + 1}
+				}
+				all = append(all, comparator{">=", v}, comparator{"<", upper})
+			default:
+				return nil, fmt.Errorf("invalid semver constraint: %q", s)
+			}
+		}
+		if len(all) == 0 {
+			return nil, fmt.Errorf("invalid semver constraint: %q", s)
+		}
+		c = append(c, all)
+	}
+	return c, nil
+}
+
+// versionParts returns number of numeric parts given in version.
+func versionParts(s string) int {
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Count(s, ".") + 1
+}
+
+func versionArg(name string, arg interface{}) (runtime.Version, error) {
+	switch v := arg.(type) {
+	case runtime.Version:
+		return v, nil
+	case string:
+		return runtime.ParseVersion(v)
+	}
+	return runtime.Version{}, fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+}
+
+func validateSemver(i int, value interface{}) error {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	var err error
+	switch i {
+	case 0:
+		_, err = runtime.ParseVersion(s)
+	case 1:
+		_, err = parseConstraint(s)
+	}
+	return err
+}
+
+func semver(args ...interface{}) (interface{}, error) {
+	return versionArg("semver.parse", args[0])
+}
+
+func semverMatches(args ...interface{}) (interface{}, error) {
+	v, err := versionArg("semver.matches", args[0])
+	if err != nil {
+		return nil, err
+	}
+	s, err := toString("semver.matches", args[1])
+	if err != nil {
+		return nil, err
+	}
+	c, err := parseConstraint(s)
+	if err != nil {
+		return nil, err
+	}
+	return c.match(v), nil
+}
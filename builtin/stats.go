@@ -0,0 +1,169 @@
+package builtin
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+func variance(args ...interface{}) (interface{}, error) {
+	xs, err := numbers("stats.variance", args[0])
+	if err != nil {
+		return nil, err
+	}
+	_, m2 := welford(xs)
+	return m2 / float64(len(xs)), nil
+}
+
+func stddev(args ...interface{}) (interface{}, error) {
+	xs, err := numbers("stats.stddev", args[0])
+	if err != nil {
+		return nil, err
+	}
+	_, m2 := welford(xs)
+	return math.Sqrt(m2 / float64(len(xs))), nil
+}
+
+// welford returns the mean and the sum of squared differences from the mean
+// of numbers, updated one number at a time, which does not lose precision
+// of numbers far from zero, unlike the difference of sums of squares.
+func welford(xs []float64) (mean, m2 float64) {
+	for i, x := range xs {
+		d := x - mean
+		mean += d / float64(i+1)
+		m2 += d * (x - mean)
+	}
+	return mean, m2
+}
+
+// percentile returns the p-th percentile of numbers, interpolating linearly
+// between the closest ranks, so the 50th percentile of [1, 2, 3, 4] is 2.5.
+// Percentiles of numbers with NaN are NaN, like variance and stddev.
+func percentile(args ...interface{}) (interface{}, error) {
+	xs, err := numbers("stats.percentile", args[0])
+	if err != nil {
+		return nil, err
+	}
+	p, _, _, err := number("stats.percentile", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPercentile(p); err != nil {
+		return nil, err
+	}
+	for _, x := range xs {
+		if math.IsNaN(x) {
+			// NaN propagates regardless of its position, as in extremum.
+			return math.NaN(), nil
+		}
+	}
+	sorted := make([]float64, len(xs))
+	copy(sorted, xs)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	if lo == len(sorted)-1 {
+		return sorted[lo], nil
+	}
+	return sorted[lo] + (rank-float64(lo))*(sorted[lo+1]-sorted[lo]), nil
+}
+
+func checkPercentile(p float64) error {
+	if !(p >= 0 && p <= 100) {
+		return fmt.Errorf("invalid percentile for stats.percentile (%v)", p)
+	}
+	return nil
+}
+
+func validatePercentileConst(i int, value interface{}) error {
+	if i != 1 {
+		return nil
+	}
+	p, _, _, err := number("stats.percentile", value)
+	if err != nil {
+		return nil
+	}
+	return checkPercentile(p)
+}
+
+// correlation returns the Pearson correlation coefficient of numbers of the
+// same length, from co-moments updated one pair at a time, or NaN if any of
+// them is constant.
+func correlation(args ...interface{}) (interface{}, error) {
+	xs, err := numbers("stats.correlation", args[0])
+	if err != nil {
+		return nil, err
+	}
+	ys, err := numbers("stats.correlation", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(xs) != len(ys) {
+		return nil, fmt.Errorf("mismatched lengths of arrays for stats.correlation (%v and %v)", len(xs), len(ys))
+	}
+	var meanX, meanY, m2X, m2Y, c float64
+	for i := range xs {
+		n := float64(i + 1)
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		meanX += dx / n
+		meanY += dy / n
+		c += dx * (ys[i] - meanY)
+		m2X += dx * (xs[i] - meanX)
+		m2Y += dy * (ys[i] - meanY)
+	}
+	return c / math.Sqrt(m2X*m2Y), nil
+}
+
+// numbers returns elements of the non-empty array as floats.
+func numbers(name string, arg interface{}) ([]float64, error) {
+	if xs, ok := arg.([]float64); ok && len(xs) > 0 {
+		return xs, nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+	}
+	if v.Len() == 0 {
+		return nil, fmt.Errorf("invalid argument for %v (empty array)", name)
+	}
+	xs := make([]float64, v.Len())
+	for i := range xs {
+		x, _, _, err := number(name, v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		xs[i] = x
+	}
+	return xs, nil
+}
+
+// validateStats returns validator of functions of arrays of numbers, followed
+// by numbers.
+func validateStats(name string, arrays, nums int) func(args []reflect.Type) (reflect.Type, error) {
+	return func(args []reflect.Type) (reflect.Type, error) {
+		if len(args) != arrays+nums {
+			return floatType, fmt.Errorf("invalid number of arguments for %v (expected %d, got %d)", name, arrays+nums, len(args))
+		}
+		for i, t := range args {
+			if t == nil {
+				return floatType, fmt.Errorf("invalid argument for %v (type nil)", name)
+			}
+			if t.Kind() == reflect.Interface {
+				continue
+			}
+			if i < arrays && isListKind(t.Kind()) {
+				t = t.Elem()
+				if t.Kind() == reflect.Interface {
+					continue
+				}
+			} else if i < arrays {
+				return floatType, fmt.Errorf("invalid argument for %v (type %v)", name, t)
+			}
+			if !isIntegerKind(t.Kind()) && t.Kind() != reflect.Float32 && t.Kind() != reflect.Float64 {
+				return floatType, fmt.Errorf("invalid argument for %v (type %v)", name, args[i])
+			}
+		}
+		return floatType, nil
+	}
+}
@@ -0,0 +1,190 @@
+package builtin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+func trim(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.trim", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		cutset, err := toString("strings.trim", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return strings.Trim(s, cutset), nil
+	}
+	return strings.TrimSpace(s), nil
+}
+
+func trimPrefix(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.trimPrefix", args[0])
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := toString("strings.trimPrefix", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.TrimPrefix(s, prefix), nil
+}
+
+func trimSuffix(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.trimSuffix", args[0])
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := toString("strings.trimSuffix", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.TrimSuffix(s, suffix), nil
+}
+
+func upper(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.upper", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(s), nil
+}
+
+func lower(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.lower", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(s), nil
+}
+
+func split(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.split", args[0])
+	if err != nil {
+		return nil, err
+	}
+	sep, err := toString("strings.split", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(s, sep), nil
+}
+
+func join(args ...interface{}) (interface{}, error) {
+	v := reflect.ValueOf(args[0])
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("invalid argument for strings.join (type %T)", args[0])
+	}
+	sep, err := toString("strings.join", args[1])
+	if err != nil {
+		return nil, err
+	}
+	elems := make([]string, v.Len())
+	size := 0
+	for i := range elems {
+		elems[i], err = toString("strings.join", v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		size += len(elems[i]) + len(sep)
+	}
+	if err := checkOutputSize("strings.join", size); err != nil {
+		return nil, err
+	}
+	return strings.Join(elems, sep), nil
+}
+
+func replace(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.replace", args[0])
+	if err != nil {
+		return nil, err
+	}
+	old, err := toString("strings.replace", args[1])
+	if err != nil {
+		return nil, err
+	}
+	new, err := toString("strings.replace", args[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(new) > len(old) {
+		n := strings.Count(s, old)
+		if old == "" {
+			n = len(s) + 1
+		}
+		if err := checkOutputSize("strings.replace", len(s)+n*(len(new)-len(old))); err != nil {
+			return nil, err
+		}
+	}
+	return strings.Replace(s, old, new, -1), nil
+}
+
+func repeat(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.repeat", args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, ok := args[1].(int)
+	if !ok || n < 0 {
+		return nil, fmt.Errorf("invalid argument for strings.repeat (%v)", args[1])
+	}
+	if len(s) > 0 && n > MaxOutputSize/len(s) {
+		return nil, fmt.Errorf("strings.repeat: output size limit exceeded (%v)", MaxOutputSize)
+	}
+	return strings.Repeat(s, n), nil
+}
+
+func indexOf(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.indexOf", args[0])
+	if err != nil {
+		return nil, err
+	}
+	substr, err := toString("strings.indexOf", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.Index(s, substr), nil
+}
+
+func iequals(args ...interface{}) (interface{}, error) {
+	a, err := toString("strings.iequals", args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := toString("strings.iequals", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.EqualFold(a, b), nil
+}
+
+func icontains(args ...interface{}) (interface{}, error) {
+	s, err := toString("strings.icontains", args[0])
+	if err != nil {
+		return nil, err
+	}
+	substr, err := toString("strings.icontains", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.Contains(foldCase(s), foldCase(substr)), nil
+}
+
+// foldCase maps every rune to the smallest rune of its orbit of simple Unicode
+// case folding, so strings equal under strings.EqualFold become equal, like
+// "K", "k" and the Kelvin sign.
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, s)
+}
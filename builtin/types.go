@@ -0,0 +1,184 @@
+package builtin
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// TypeName returns name of type of v as reported by types.of() builtin.
+func TypeName(v interface{}) string {
+	if runtime.IsNil(v) {
+		return "nil"
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "string"
+	case reflect.Array, reflect.Slice:
+		return "array"
+	case reflect.Map:
+		return "map"
+	case reflect.Func:
+		return "func"
+	case reflect.Struct:
+		return "struct"
+	}
+	return t.String()
+}
+
+func typeOf(args ...interface{}) (interface{}, error) {
+	return TypeName(args[0]), nil
+}
+
+func isNil(args ...interface{}) (interface{}, error) {
+	return runtime.IsNil(args[0]), nil
+}
+
+func isString(args ...interface{}) (interface{}, error) {
+	return TypeName(args[0]) == "string", nil
+}
+
+func isList(args ...interface{}) (interface{}, error) {
+	return TypeName(args[0]) == "array", nil
+}
+
+func isMap(args ...interface{}) (interface{}, error) {
+	return TypeName(args[0]) == "map", nil
+}
+
+// validateMap checks what single argument is a map. Result type is unknown
+// if map type is unknown, or computed from map type.
+func validateMap(name string, args []reflect.Type, unknown reflect.Type, result func(reflect.Type) reflect.Type) (reflect.Type, error) {
+	if len(args) != 1 {
+		return anyType, fmt.Errorf("invalid number of arguments for %v (expected 1, got %d)", name, len(args))
+	}
+	t := args[0]
+	if t == nil {
+		return anyType, fmt.Errorf("invalid argument for %v (type nil)", name)
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return unknown, nil
+	case reflect.Map:
+		return result(t), nil
+	}
+	return anyType, fmt.Errorf("invalid argument for %v (type %v)", name, args[0])
+}
+
+func mapValue(name string, arg interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Map {
+		return v, fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+	}
+	return v, nil
+}
+
+func keys(args ...interface{}) (interface{}, error) {
+	v, err := mapValue("maps.keys", args[0])
+	if err != nil {
+		return nil, err
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(v.Type().Key()), 0, v.Len())
+	for _, key := range sortedKeys(v) {
+		out = reflect.Append(out, key)
+	}
+	return out.Interface(), nil
+}
+
+func values(args ...interface{}) (interface{}, error) {
+	v, err := mapValue("maps.values", args[0])
+	if err != nil {
+		return nil, err
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, v.Len())
+	for _, key := range sortedKeys(v) {
+		out = reflect.Append(out, v.MapIndex(key))
+	}
+	return out.Interface(), nil
+}
+
+func entries(args ...interface{}) (interface{}, error) {
+	v, err := mapValue("maps.entries", args[0])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, v.Len())
+	for _, key := range sortedKeys(v) {
+		out = append(out, map[string]interface{}{
+			"key":   key.Interface(),
+			"value": v.MapIndex(key).Interface(),
+		})
+	}
+	return out, nil
+}
+
+// sortedKeys returns keys of the map in sorted order, so results of
+// maps.keys(), maps.values() and maps.entries() do not depend on the random
+// iteration order of maps.
+// Numbers are ordered by value, strings lexicographically, and keys of
+// different kinds by kind.
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		return lessKey(keys[i], keys[j])
+	})
+	return keys
+}
+
+func lessKey(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+	ka, kb := keyKind(a), keyKind(b)
+	if ka != kb {
+		return ka < kb
+	}
+	switch ka {
+	case reflect.Int:
+		return a.Int() < b.Int()
+	case reflect.Uint:
+		return a.Uint() < b.Uint()
+	case reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.String:
+		return a.String() < b.String()
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// keyKind groups kinds of keys, which are compared with each other.
+func keyKind(v reflect.Value) reflect.Kind {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return v.Kind()
+}
@@ -0,0 +1,172 @@
+// Package bundle signs compiled programs, so only approved programs run on
+// nodes, which load them. Bundles hold sources of expressions, hashes of
+// their compiled programs and signatures of environments of compilation:
+//
+//	b := bundle.New(program)
+//	err := b.Sign(bundle.Ed25519(privateKey))
+//	data, err := json.Marshal(b)
+//
+// Nodes recompile sources with the same options, and load programs only if
+// signatures are valid and recompiled programs are identical:
+//
+//	program, err := bundle.Load(data, bundle.Ed25519Public(publicKey), expr.Env(env))
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/vm"
+)
+
+// Bundle of a program.
+type Bundle struct {
+	// Source of the expression.
+	Source string `json:"source"`
+	// Hash is hex encoded SHA-256 of the disassembly of the program.
+	Hash string `json:"hash"`
+	// Env is the signature of the environment of compilation, if any.
+	Env *conf.Signature `json:"env,omitempty"`
+	// Sig is the signature of the source, the hash and the environment.
+	Sig []byte `json:"sig,omitempty"`
+}
+
+// Key signs and verifies bundles.
+type Key interface {
+	Sign(payload []byte) ([]byte, error)
+	Verify(payload, sig []byte) bool
+}
+
+// New returns the unsigned bundle of the program.
+func New(program *vm.Program) *Bundle {
+	return &Bundle{
+		Source: program.Source.Content(),
+		Hash:   hash(program),
+		Env:    program.Signature,
+	}
+}
+
+func hash(program *vm.Program) string {
+	sum := sha256.Sum256([]byte(program.Disassemble()))
+	return hex.EncodeToString(sum[:])
+}
+
+// payload returns signed bytes of the bundle.
+func (b *Bundle) payload() []byte {
+	unsigned := *b
+	unsigned.Sig = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// Sign signs the bundle with the key.
+func (b *Bundle) Sign(key Key) error {
+	sig, err := key.Sign(b.payload())
+	if err != nil {
+		return err
+	}
+	b.Sig = sig
+	return nil
+}
+
+// Verify returns an error, if the bundle is not signed by the key.
+func (b *Bundle) Verify(key Key) error {
+	if len(b.Sig) == 0 {
+		return fmt.Errorf("bundle is not signed")
+	}
+	if !key.Verify(b.payload(), b.Sig) {
+		return fmt.Errorf("invalid signature of bundle")
+	}
+	return nil
+}
+
+// Program verifies the bundle, and returns its program compiled with the
+// options. Options must compile the same program, as options of the signed
+// program, and environments must have the same signature.
+func (b *Bundle) Program(key Key, ops ...expr.Option) (*vm.Program, error) {
+	if err := b.Verify(key); err != nil {
+		return nil, err
+	}
+	program, err := expr.Compile(b.Source, ops...)
+	if err != nil {
+		return nil, err
+	}
+	if b.Env != nil {
+		signature := program.Signature
+		if signature == nil {
+			return nil, fmt.Errorf("program of bundle requires environment")
+		}
+		if signature.Hash != b.Env.Hash {
+			return nil, &conf.SignatureError{Diff: b.Env.Diff(signature)}
+		}
+	}
+	if hash(program) != b.Hash {
+		return nil, fmt.Errorf("program differs from program of bundle")
+	}
+	return program, nil
+}
+
+// Load decodes the JSON of the bundle, and returns its program, like
+// Bundle.Program.
+func Load(data []byte, key Key, ops ...expr.Option) (*vm.Program, error) {
+	b := &Bundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+	return b.Program(key, ops...)
+}
+
+type ed25519Key struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// Ed25519 returns the key signing bundles with the private key.
+func Ed25519(private ed25519.PrivateKey) Key {
+	return &ed25519Key{private: private, public: private.Public().(ed25519.PublicKey)}
+}
+
+// Ed25519Public returns the key verifying bundles signed by the private
+// key of the public key.
+func Ed25519Public(public ed25519.PublicKey) Key {
+	return &ed25519Key{public: public}
+}
+
+func (k *ed25519Key) Sign(payload []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, fmt.Errorf("public key can not sign bundles")
+	}
+	return ed25519.Sign(k.private, payload), nil
+}
+
+func (k *ed25519Key) Verify(payload, sig []byte) bool {
+	return len(k.public) == ed25519.PublicKeySize && ed25519.Verify(k.public, payload, sig)
+}
+
+type hmacKey []byte
+
+// HMAC returns the key signing and verifying bundles with HMAC-SHA256 of
+// the shared secret.
+func HMAC(secret []byte) Key {
+	return hmacKey(secret)
+}
+
+func (k hmacKey) Sign(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
+
+func (k hmacKey) Verify(payload, sig []byte) bool {
+	expected, _ := k.Sign(payload)
+	return hmac.Equal(expected, sig)
+}
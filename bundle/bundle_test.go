@@ -0,0 +1,87 @@
+package bundle_test
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/bundle"
+	"github.com/antonmedv/expr/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Env struct {
+	Age   int
+	Limit int
+}
+
+func TestBundle(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	program, err := expr.Compile(`Age >= Limit`, expr.Env(Env{}))
+	require.NoError(t, err)
+
+	b := bundle.New(program)
+	require.NoError(t, b.Sign(bundle.Ed25519(private)))
+	data, err := json.Marshal(b)
+	require.NoError(t, err)
+
+	loaded, err := bundle.Load(data, bundle.Ed25519Public(public), expr.Env(Env{}))
+	require.NoError(t, err)
+	out, err := expr.Run(loaded, Env{Age: 20, Limit: 18})
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	other, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, err = bundle.Load(data, bundle.Ed25519Public(other), expr.Env(Env{}))
+	assert.EqualError(t, err, "invalid signature of bundle")
+
+	_, err = bundle.Load(data, bundle.Ed25519Public(public), expr.Env(map[string]interface{}{"Age": 1.5, "Limit": 1}))
+	require.Error(t, err)
+	assert.IsType(t, &conf.SignatureError{}, err)
+
+	err = b.Sign(bundle.Ed25519Public(public))
+	assert.EqualError(t, err, "public key can not sign bundles")
+}
+
+func TestBundle_tampered(t *testing.T) {
+	key := bundle.HMAC([]byte("secret"))
+
+	program, err := expr.Compile(`Age >= Limit`, expr.Env(Env{}))
+	require.NoError(t, err)
+	b := bundle.New(program)
+	require.NoError(t, b.Sign(key))
+
+	_, err = b.Program(key, expr.Env(Env{}))
+	require.NoError(t, err)
+
+	b.Source = `Age >= 0`
+	_, err = b.Program(key, expr.Env(Env{}))
+	assert.EqualError(t, err, "invalid signature of bundle")
+
+	b.Sig = nil
+	_, err = b.Program(key, expr.Env(Env{}))
+	assert.EqualError(t, err, "bundle is not signed")
+
+	_, err = bundle.Load([]byte(`{`), key)
+	assert.EqualError(t, err, "invalid bundle: unexpected end of JSON input")
+}
+
+func TestBundle_options(t *testing.T) {
+	key := bundle.HMAC([]byte("secret"))
+
+	program, err := expr.Compile(`Age / Limit`, expr.Env(Env{}), expr.ZeroDivisionNil())
+	require.NoError(t, err)
+	b := bundle.New(program)
+	require.NoError(t, b.Sign(key))
+
+	_, err = b.Program(key, expr.Env(Env{}))
+	assert.EqualError(t, err, "program differs from program of bundle")
+
+	_, err = b.Program(key, expr.Env(Env{}), expr.ZeroDivisionNil())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,275 @@
+package checker
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// checkAccess checks, that expressions use only allowed members of the
+// environment, given by Config.AllowFields and Config.DenyFields. Members
+// are checked by paths, like "user.Name", where elements of arrays have
+// paths of arrays, so the path of # in map(users, #.Name) is "users".
+//
+// Only whole values are checked: user.Name uses user.Name, but not user.
+// Values, which are used otherwise, like user in json.encode(user), or which
+// members are not known during compilation, like user[key], are denied if
+// any of their members is denied.
+func checkAccess(tree *parser.Tree, config *conf.Config) *file.Error {
+	ac := &accessChecker{config: config}
+	ac.use(tree.Node)
+	return ac.err
+}
+
+type accessChecker struct {
+	config *conf.Config
+	// scopes are paths of variables of binds and comprehensions. Variables
+	// of unknown values have empty paths.
+	scopes []map[string]string
+	// pointers are paths of elements of collections of closures.
+	pointers []string
+	err      *file.Error
+}
+
+// use checks the value of the node, if it is a member of the environment.
+func (ac *accessChecker) use(node ast.Node) {
+	if node == nil || ac.err != nil {
+		return
+	}
+	if path := ac.path(node); path != "" {
+		ac.check(node, path)
+	}
+}
+
+func (ac *accessChecker) check(node ast.Node, path string) {
+	if ac.err == nil && !ac.allowed(path, hasMembers(node.Type())) {
+		ac.err = &file.Error{
+			Location: node.Location(),
+			Message:  fmt.Sprintf("access to %v is not allowed", path),
+		}
+	}
+}
+
+// allowed reports, whether the path may be used. Paths are denied, if deny
+// patterns match them, their parents or, if values have members, their
+// members. If allow patterns are given, they must match paths or their
+// parents.
+func (ac *accessChecker) allowed(path string, members bool) bool {
+	segments := strings.Split(path, ".")
+	for _, pattern := range ac.config.DenyFields {
+		if matchPattern(strings.Split(pattern, "."), segments, members) {
+			return false
+		}
+	}
+	if len(ac.config.AllowFields) == 0 {
+		return true
+	}
+	for _, pattern := range ac.config.AllowFields {
+		if matchPattern(strings.Split(pattern, "."), segments, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports, whether the pattern, like "order.*", matches the
+// path or its parent. The * segment matches any segment, and the trailing *
+// matches all members and the parent itself. If members is true, patterns
+// of members of the path also match.
+func matchPattern(pattern, path []string, members bool) bool {
+	for i, segment := range pattern {
+		if segment == "*" && i == len(pattern)-1 {
+			return true
+		}
+		if i == len(path) {
+			return members
+		}
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// path returns the path of the value of the node, or an empty string, if
+// the value is not a member of the environment. Other nodes of the value
+// are checked.
+func (ac *accessChecker) path(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		for i := len(ac.scopes) - 1; i >= 0; i-- {
+			if path, ok := ac.scopes[i][n.Value]; ok {
+				return path
+			}
+		}
+		return n.Value
+
+	case *ast.VariableNode:
+		for i := len(ac.scopes) - 1; i >= 0; i-- {
+			if path, ok := ac.scopes[i][n.Name]; ok {
+				return path
+			}
+		}
+
+	case *ast.PointerNode:
+		if n.Name == "" && len(ac.pointers) > 0 {
+			return ac.pointers[len(ac.pointers)-1]
+		}
+
+	case *ast.ChainNode:
+		return ac.path(n.Node)
+
+	case *ast.MemberNode:
+		base := ac.path(n.Node)
+		if name, ok := n.Property.(*ast.StringNode); ok {
+			if base != "" {
+				return base + "." + name.Value
+			}
+			return ""
+		}
+		ac.use(n.Property)
+		if base == "" {
+			return ""
+		}
+		// Elements of arrays, and values of maps by numbers, have paths
+		// of collections, while other members are not known.
+		if t := n.Property.Type(); isArray(n.Node.Type()) || t != nil && !isString(t) && !isAny(t) {
+			return base
+		}
+		ac.check(n.Node, base)
+
+	case *ast.SliceNode:
+		ac.use(n.From)
+		ac.use(n.To)
+		return ac.path(n.Node)
+
+	case *ast.UnaryNode:
+		ac.use(n.Node)
+
+	case *ast.BinaryNode:
+		ac.use(n.Left)
+		ac.use(n.Right)
+
+	case *ast.ConditionalNode:
+		ac.use(n.Cond)
+		ac.use(n.Exp1)
+		ac.use(n.Exp2)
+
+	case *ast.CallNode:
+		if n.Func == nil {
+			ac.use(n.Callee)
+		}
+		for _, arg := range n.Arguments {
+			ac.use(arg)
+		}
+
+	case *ast.BuiltinNode:
+		ac.builtin(n)
+
+	case *ast.ClosureNode:
+		ac.use(n.Node)
+
+	case *ast.ArrayNode:
+		for _, element := range n.Nodes {
+			ac.use(element)
+		}
+
+	case *ast.TupleNode:
+		for _, element := range n.Nodes {
+			ac.use(element)
+		}
+
+	case *ast.BlockNode:
+		for _, element := range n.Nodes {
+			ac.use(element)
+		}
+
+	case *ast.MapNode:
+		for _, pair := range n.Pairs {
+			ac.use(pair)
+		}
+
+	case *ast.PairNode:
+		ac.use(n.Key)
+		ac.use(n.Value)
+
+	case *ast.LetNode:
+		ac.use(n.Value)
+
+	case *ast.AssignNode:
+		ac.use(n.Value)
+
+	case *ast.SharedNode:
+		ac.use(n.Node)
+
+	case *ast.BindNode:
+		scope := make(map[string]string, len(n.Names))
+		if n.Tuple {
+			ac.use(n.Value)
+			for _, name := range n.Names {
+				scope[name] = ""
+			}
+		} else {
+			scope[n.Names[0]] = ac.path(n.Value)
+		}
+		ac.scopes = append(ac.scopes, scope)
+		ac.use(n.Body)
+		ac.scopes = ac.scopes[:len(ac.scopes)-1]
+
+	case *ast.ComprehensionNode:
+		ac.scopes = append(ac.scopes, map[string]string{n.Name: ac.path(n.Items)})
+		ac.use(n.Cond)
+		ac.use(n.Node)
+		ac.scopes = ac.scopes[:len(ac.scopes)-1]
+	}
+	return ""
+}
+
+// builtin checks arguments of builtins. Collections of builtins, which
+// results are made by closures, are used only by elements in closures.
+func (ac *accessChecker) builtin(node *ast.BuiltinNode) {
+	var collection string
+	for i, arg := range node.Arguments {
+		switch {
+		case i == 0:
+			collection = ac.path(arg)
+			switch node.Name {
+			case "all", "none", "any", "one", "count", "map", "reduce", "fold":
+			default:
+				if collection != "" {
+					ac.check(arg, collection)
+				}
+			}
+		case isClosure(arg):
+			ac.pointers = append(ac.pointers, collection)
+			ac.use(arg)
+			ac.pointers = ac.pointers[:len(ac.pointers)-1]
+		default:
+			ac.use(arg)
+		}
+	}
+}
+
+// hasMembers reports, whether values of the type may have members, like
+// structs and maps, or if the type is not known.
+func hasMembers(t reflect.Type) bool {
+	t = dereferenceValue(t)
+	if t == nil {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Interface, reflect.Func:
+		return true
+	}
+	return false
+}
+
+func isClosure(node ast.Node) bool {
+	_, ok := node.(*ast.ClosureNode)
+	return ok
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
 	"github.com/antonmedv/expr/conf"
 	"github.com/antonmedv/expr/file"
 	"github.com/antonmedv/expr/parser"
 	"github.com/antonmedv/expr/vm"
+	"github.com/antonmedv/expr/vm/runtime"
 )
 
 func Check(tree *parser.Tree, config *conf.Config) (t reflect.Type, err error) {
@@ -26,9 +29,31 @@ func Check(tree *parser.Tree, config *conf.Config) (t reflect.Type, err error) {
 	t, _ = v.visit(tree.Node)
 
 	if v.err != nil {
+		if config.Translator != nil {
+			v.err.Translate(config.Translator)
+		}
+		for _, h := range v.hints {
+			v.err.Message += h.message(config.Translator)
+		}
 		return t, v.err.Bind(tree.Source)
 	}
 
+	if len(config.AllowFields) > 0 || len(config.DenyFields) > 0 {
+		if err := checkAccess(tree, config); err != nil {
+			if config.Translator != nil {
+				err.Translate(config.Translator)
+			}
+			return t, err.Bind(tree.Source)
+		}
+	}
+
+	if err := checkUnits(tree, config); err != nil {
+		if config.Translator != nil {
+			err.Translate(config.Translator)
+		}
+		return t, err.Bind(tree.Source)
+	}
+
 	if v.config.Expect != reflect.Invalid {
 		switch v.config.Expect {
 		case reflect.Int, reflect.Int64, reflect.Float64:
@@ -46,10 +71,29 @@ func Check(tree *parser.Tree, config *conf.Config) (t reflect.Type, err error) {
 }
 
 type visitor struct {
-	config      *conf.Config
-	collections []reflect.Type
-	parents     []ast.Node
-	err         *file.Error
+	config       *conf.Config
+	collections  []reflect.Type
+	parents      []ast.Node
+	narrowing    []narrowing
+	variables    []map[string]reflect.Type // variables of folds
+	accumulators []accumulator
+	err          *file.Error
+	hints        []hint // details appended to the message of err
+}
+
+// accumulator is the type of #acc of the closure of reduce, which is the
+// closure of collections with the index.
+type accumulator struct {
+	closure int
+	t       reflect.Type
+}
+
+// narrowing holds type of a variable (or a field path) proven by type tests,
+// like types.isMap(foo) or types.of(foo) == "string". It is used to validate
+// member access of otherwise unknown types.
+type narrowing struct {
+	path string
+	t    reflect.Type
 }
 
 type info struct {
@@ -101,6 +145,22 @@ func (v *visitor) visit(node ast.Node) (reflect.Type, info) {
 		t, i = v.MapNode(n)
 	case *ast.PairNode:
 		t, i = v.PairNode(n)
+	case *ast.VariableNode:
+		t, i = v.VariableNode(n)
+	case *ast.LetNode:
+		t, i = v.visit(n.Value)
+	case *ast.AssignNode:
+		t, i = v.AssignNode(n)
+	case *ast.BlockNode:
+		t, i = v.BlockNode(n)
+	case *ast.TupleNode:
+		t, i = v.TupleNode(n)
+	case *ast.BindNode:
+		t, i = v.BindNode(n)
+	case *ast.ComprehensionNode:
+		t, i = v.ComprehensionNode(n)
+	case *ast.SharedNode:
+		t, i = v.visit(n.Node)
 	default:
 		panic(fmt.Sprintf("undefined node type (%T)", node))
 	}
@@ -109,12 +169,35 @@ func (v *visitor) visit(node ast.Node) (reflect.Type, info) {
 	return t, i
 }
 
+// visitNarrowed visits node with additional narrowing of types.
+func (v *visitor) visitNarrowed(node ast.Node, narrowing []narrowing) (reflect.Type, info) {
+	n := len(v.narrowing)
+	v.narrowing = append(v.narrowing, narrowing...)
+	t, i := v.visit(node)
+	v.narrowing = v.narrowing[:n]
+	return t, i
+}
+
+// narrowed returns narrowed type of node if it is known, otherwise t.
+func (v *visitor) narrowed(node ast.Node, t reflect.Type) reflect.Type {
+	if !isAny(t) {
+		return t
+	}
+	path, ok := nodePath(node)
+	if !ok {
+		return t
+	}
+	for i := len(v.narrowing) - 1; i >= 0; i-- {
+		if v.narrowing[i].path == path {
+			return v.narrowing[i].t
+		}
+	}
+	return t
+}
+
 func (v *visitor) error(node ast.Node, format string, args ...interface{}) (reflect.Type, info) {
 	if v.err == nil { // show first error
-		v.err = &file.Error{
-			Location: node.Location(),
-			Message:  fmt.Sprintf(format, args...),
-		}
+		v.err = file.Errorf(node.Location(), format, typeStrings(args)...)
 	}
 	return anyType, info{} // interface represent undefined type
 }
@@ -132,7 +215,7 @@ func (v *visitor) IdentifierNode(node *ast.IdentifierNode) (reflect.Type, info)
 		if t.Ambiguous {
 			return v.error(node, "ambiguous identifier %v", node.Value)
 		}
-		d, c := deref(t.Type)
+		d, c := v.deref(t.Type)
 		node.Deref = c
 		node.Method = t.Method
 		node.MethodIndex = t.MethodIndex
@@ -145,7 +228,7 @@ func (v *visitor) IdentifierNode(node *ast.IdentifierNode) (reflect.Type, info)
 		}
 		return anyType, info{}
 	}
-	return v.error(node, "unknown name %v", node.Value)
+	return v.errorHint(node, suggestion(node.Value, v.names()), "unknown name %v", node.Value)
 }
 
 func (v *visitor) IntegerNode(*ast.IntegerNode) (reflect.Type, info) {
@@ -193,12 +276,18 @@ func (v *visitor) UnaryNode(node *ast.UnaryNode) (reflect.Type, info) {
 		return v.error(node, "unknown operator (%v)", node.Operator)
 	}
 
-	return v.error(node, `invalid operation: %v (mismatched type %v)`, node.Operator, t)
+	return v.errorHint(node, origins([]ast.Node{node.Node}, []reflect.Type{t}), `invalid operation: %v (mismatched type %v)`, node.Operator, t)
 }
 
 func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 	l, _ := v.visit(node.Left)
-	r, _ := v.visit(node.Right)
+	var r reflect.Type
+	switch node.Operator {
+	case "and", "&&":
+		r, _ = v.visitNarrowed(node.Right, typeTests(node.Left))
+	default:
+		r, _ = v.visit(node.Right)
+	}
 
 	// check operator overloading
 	if fns, ok := v.config.Operators[node.Operator]; ok {
@@ -208,6 +297,10 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 		}
 	}
 
+	if v.config.Broadcast && broadcast(node.Operator, l, r) {
+		return arrayType, info{}
+	}
+
 	switch node.Operator {
 	case "==", "!=":
 		if isNumber(l) && isNumber(r) {
@@ -223,6 +316,15 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 			return boolType, info{}
 		}
 
+	case "??":
+		switch {
+		case l == nil:
+			return r, info{}
+		case r == nil || l == r:
+			return l, info{}
+		}
+		return anyType, info{}
+
 	case "or", "||", "and", "&&":
 		if isBool(l) && isBool(r) {
 			return boolType, info{}
@@ -241,7 +343,10 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 		if isTime(l) && isTime(r) {
 			return boolType, info{}
 		}
-		if or(l, r, isNumber, isString, isTime) {
+		if isVersion(l) && isVersion(r) {
+			return boolType, info{}
+		}
+		if or(l, r, isNumber, isString, isTime, isVersion) {
 			return boolType, info{}
 		}
 
@@ -249,7 +354,7 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 		if isNumber(l) && isNumber(r) {
 			return combined(l, r), info{}
 		}
-		if isTime(l) && isTime(r) {
+		if l == timeType && r == timeType {
 			return durationType, info{}
 		}
 		if or(l, r, isNumber, isTime) {
@@ -257,6 +362,9 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 		}
 
 	case "/", "*":
+		if node.Operator == "/" && v.zeroDivisionType(false) {
+			return anyType, info{}
+		}
 		if isNumber(l) && isNumber(r) {
 			return combined(l, r), info{}
 		}
@@ -273,6 +381,9 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 		}
 
 	case "%":
+		if v.zeroDivisionType(true) && (isInteger(l) || isAny(l)) && (isInteger(r) || isAny(r)) {
+			return anyType, info{}
+		}
 		if isInteger(l) && isInteger(r) {
 			return combined(l, r), info{}
 		}
@@ -310,7 +421,9 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 		if isAny(l) && anyOf(r, isString, isArray, isMap) {
 			return boolType, info{}
 		}
-		if isAny(l) && isAny(r) {
+		// Arrays, maps and structs of unknown types, like variables of
+		// expr.Eval, are checked at runtime.
+		if isAny(r) {
 			return boolType, info{}
 		}
 
@@ -329,6 +442,17 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 			return boolType, info{}
 		}
 
+	case "like":
+		if s, ok := node.Right.(*ast.StringNode); ok {
+			node.Regexp = runtime.LikeRegexp(s.Value)
+		}
+		if isString(l) && isString(r) {
+			return boolType, info{}
+		}
+		if or(l, r, isString) {
+			return boolType, info{}
+		}
+
 	case "contains", "startsWith", "endsWith":
 		if isString(l) && isString(r) {
 			return boolType, info{}
@@ -351,7 +475,7 @@ func (v *visitor) BinaryNode(node *ast.BinaryNode) (reflect.Type, info) {
 
 	}
 
-	return v.error(node, `invalid operation: %v (mismatched types %v and %v)`, node.Operator, l, r)
+	return v.errorHint(node, origins([]ast.Node{node.Left, node.Right}, []reflect.Type{l, r}), `invalid operation: %v (mismatched types %v and %v)`, node.Operator, l, r)
 }
 
 func (v *visitor) ChainNode(node *ast.ChainNode) (reflect.Type, info) {
@@ -361,6 +485,12 @@ func (v *visitor) ChainNode(node *ast.ChainNode) (reflect.Type, info) {
 func (v *visitor) MemberNode(node *ast.MemberNode) (reflect.Type, info) {
 	base, _ := v.visit(node.Node)
 	prop, _ := v.visit(node.Property)
+	if n := v.narrowed(node.Node, base); n != base {
+		if n == nil {
+			return v.error(node, "cannot fetch from nil")
+		}
+		base = n
+	}
 
 	if name, ok := node.Property.(*ast.StringNode); ok {
 		if base == nil {
@@ -373,6 +503,9 @@ func (v *visitor) MemberNode(node *ast.MemberNode) (reflect.Type, info) {
 			node.MethodIndex = m.Index
 			node.Name = name.Value
 			if base.Kind() == reflect.Interface {
+				// Index of method in interface differs from index of method
+				// in concrete type, so method will be looked up by name.
+				node.MethodIndex = -1
 				// In case of interface type method will not have a receiver,
 				// and to prevent checker decreasing numbers of in arguments
 				// return method type as not method (second argument is false).
@@ -389,14 +522,26 @@ func (v *visitor) MemberNode(node *ast.MemberNode) (reflect.Type, info) {
 
 	switch base.Kind() {
 	case reflect.Interface:
+		// Fields of interface values are resolved at runtime, but methods of
+		// non-empty interfaces are known.
+		if name, ok := node.Property.(*ast.StringNode); ok && base.NumMethod() > 0 && len(v.parents) > 1 {
+			if call, ok := v.parents[len(v.parents)-2].(*ast.CallNode); ok && call.Callee == ast.Node(node) {
+				return v.errorHint(node, suggestion(name.Value, members(base)), "type %v has no method %v", base, name.Value)
+			}
+		}
 		node.Deref = true
 		return anyType, info{}
 
 	case reflect.Map:
-		if !prop.AssignableTo(base.Key()) {
+		if !isMapKey(prop, base.Key()) {
 			return v.error(node.Property, "cannot use %v to get an element from %v", prop, base)
 		}
-		t, c := deref(base.Elem())
+		if value, ok := constValue(node.Property); ok {
+			if _, ok := runtime.MapKey(value, base.Key()); !ok {
+				return v.error(node.Property, "cannot use %v as key of %v", value, base)
+			}
+		}
+		t, c := v.deref(base.Elem())
 		node.Deref = c
 		return t, info{}
 
@@ -404,26 +549,30 @@ func (v *visitor) MemberNode(node *ast.MemberNode) (reflect.Type, info) {
 		if !isInteger(prop) && !isAny(prop) {
 			return v.error(node.Property, "array elements can only be selected using an integer (got %v)", prop)
 		}
-		t, c := deref(base.Elem())
+		t, c := v.deref(base.Elem())
 		node.Deref = c
 		return t, info{}
 
 	case reflect.Struct:
 		if name, ok := node.Property.(*ast.StringNode); ok {
 			propertyName := name.Value
-			if field, ok := fetchField(base, propertyName); ok {
-				t, c := deref(field.Type)
+			field, ok, ambiguous := fetchField(base, propertyName)
+			if ok {
+				t, c := v.deref(field.Type)
 				node.Deref = c
 				node.FieldIndex = field.Index
 				node.Name = propertyName
 				return t, info{}
 			}
+			if ambiguous {
+				return v.error(node, "ambiguous selector %v of type %v", propertyName, base)
+			}
 			if len(v.parents) > 1 {
 				if _, ok := v.parents[len(v.parents)-2].(*ast.CallNode); ok {
-					return v.error(node, "type %v has no method %v", base, propertyName)
+					return v.errorHint(node, suggestion(propertyName, members(base)), "type %v has no method %v", base, propertyName)
 				}
 			}
-			return v.error(node, "type %v has no field %v", base, propertyName)
+			return v.errorHint(node, suggestion(propertyName, members(base)), "type %v has no field %v", base, propertyName)
 		}
 	}
 
@@ -432,6 +581,11 @@ func (v *visitor) MemberNode(node *ast.MemberNode) (reflect.Type, info) {
 
 func (v *visitor) SliceNode(node *ast.SliceNode) (reflect.Type, info) {
 	t, _ := v.visit(node.Node)
+	if n := v.narrowed(node.Node, t); n != t {
+		if n == nil || !anyOf(n, isString, isArray) {
+			return v.error(node, "cannot slice %v", n)
+		}
+	}
 
 	switch t.Kind() {
 	case reflect.Interface:
@@ -458,6 +612,21 @@ func (v *visitor) SliceNode(node *ast.SliceNode) (reflect.Type, info) {
 }
 
 func (v *visitor) CallNode(node *ast.CallNode) (reflect.Type, info) {
+	if node.Func != nil {
+		// Function may be already resolved by patchers.
+		return v.checkBuiltinFunc(node.Func, node)
+	}
+	if f, ok := v.builtinFunction(node.Callee); ok {
+		if v.config.Deterministic && f.NonDeterministic {
+			return v.error(node, "%v is not deterministic", f.Name)
+		}
+		node.Func = f
+		return v.checkBuiltinFunc(f, node)
+	}
+	if name, ok := v.unknownBuiltin(node.Callee); ok {
+		return v.errorHint(node, suggestion(name, v.builtinNames()), "unknown function %v", name)
+	}
+
 	fn, fnInfo := v.visit(node.Callee)
 
 	fnName := "function"
@@ -507,17 +676,21 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node *ast.CallNode, na
 	if fn.NumOut() == 0 {
 		return v.error(node, "func %v doesn't return value", name)
 	}
-	if numOut := fn.NumOut(); numOut > 2 {
-		return v.error(node, "func %v returns more then two values", name)
-	}
 
 	numIn := fn.NumIn()
 
 	// If func is method on an env, first argument should be a receiver,
 	// and actual arguments less than numIn by one.
+	offset := 0
 	if method {
-		numIn--
+		offset = 1
+	}
+	// Context of functions performing I/O is passed by the VM.
+	if fn.NumIn() > offset && fn.In(offset) == contextType {
+		node.Context = true
+		offset++
 	}
+	numIn -= offset
 
 	if fn.IsVariadic() {
 		if len(arguments) < numIn-1 {
@@ -532,13 +705,6 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node *ast.CallNode, na
 		}
 	}
 
-	offset := 0
-
-	// Skip first argument in case of the receiver.
-	if method {
-		offset = 1
-	}
-
 	for i, arg := range arguments {
 		t, _ := v.visit(arg)
 
@@ -551,7 +717,7 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node *ast.CallNode, na
 			in = fn.In(i + offset)
 		}
 
-		if isIntegerOrArithmeticOperation(arg) {
+		if isIntegerOrArithmeticOperation(arg) && (isNumber(in) || isAny(in)) {
 			t = in
 			setTypeForIntegers(arg, t)
 		}
@@ -560,12 +726,13 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node *ast.CallNode, na
 			continue
 		}
 
-		if !t.AssignableTo(in) && t.Kind() != reflect.Interface {
-			return v.error(arg, "cannot use %v as argument (type %v) to call %v ", t, in, name)
+		if !t.AssignableTo(in) && t.Kind() != reflect.Interface && !runtime.IsParser(in) {
+			hints := append(origins([]ast.Node{arg}, []reflect.Type{t}), signatureHint(name, method, fn))
+			return v.errorHint(arg, hints, "cannot use %v as argument (type %v) to call %v", t, in, name)
 		}
 	}
 
-	if !fn.IsVariadic() {
+	if !fn.IsVariadic() && !node.Context {
 	funcTypes:
 		for i := range vm.FuncTypes {
 			if i == 0 {
@@ -587,7 +754,7 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node *ast.CallNode, na
 				continue
 			}
 			for j, arg := range arguments {
-				if typed.In(j) != arg.Type() {
+				if typed.In(j) != arg.Type() || typed.In(j) != fn.In(j+offset) {
 					continue funcTypes
 				}
 			}
@@ -595,14 +762,244 @@ func (v *visitor) checkFunc(fn reflect.Type, method bool, node *ast.CallNode, na
 		}
 	}
 
+	if results := resultTypes(fn); len(results) > 1 {
+		return tupleType, info{}
+	}
 	return fn.Out(0), info{}
 }
 
+// resultTypes returns types of results of the function, except for the
+// last error of functions returning many values.
+func resultTypes(fn reflect.Type) []reflect.Type {
+	n := fn.NumOut()
+	if n > 1 && fn.Out(n-1) == errorType {
+		n--
+	}
+	types := make([]reflect.Type, n)
+	for i := range types {
+		types[i] = fn.Out(i)
+	}
+	return types
+}
+
+// elementTypes returns types of elements of the tuple, if they are known
+// from the tuple or the called function.
+func elementTypes(node ast.Node) []reflect.Type {
+	switch n := node.(type) {
+	case *ast.TupleNode:
+		types := make([]reflect.Type, len(n.Nodes))
+		for i, element := range n.Nodes {
+			types[i] = element.Type()
+		}
+		return types
+	case *ast.CallNode:
+		fn := n.Callee.Type()
+		if fn != nil && fn.Kind() == reflect.Func && n.Func == nil {
+			return resultTypes(fn)
+		}
+	}
+	return nil
+}
+
+// builtinFunction returns builtin function called by callee, like "json.encode"
+// or "strings.trim". Identifiers defined in the environment take precedence
+// over builtins and namespaces of builtins.
+func (v *visitor) builtinFunction(callee ast.Node) (*builtin.Function, bool) {
+	name, ok := nodePath(callee)
+	if !ok {
+		return nil, false
+	}
+	root := name
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		root = name[:i]
+	}
+	if _, ok := v.config.Types[root]; ok {
+		return nil, false
+	}
+	f, ok := v.config.Functions[name]
+	return f, ok
+}
+
+// unknownBuiltin returns name of a called function, if it is in a namespace of
+// builtins, like "strings.trimm", but is not defined.
+func (v *visitor) unknownBuiltin(callee ast.Node) (string, bool) {
+	if !v.config.Strict {
+		return "", false
+	}
+	name, ok := nodePath(callee)
+	if !ok {
+		return "", false
+	}
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return "", false
+	}
+	if _, ok := v.config.Types[name[:i]]; ok {
+		return "", false
+	}
+	for fn := range v.config.Functions {
+		if strings.HasPrefix(fn, name[:i+1]) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (v *visitor) checkBuiltinFunc(f *builtin.Function, node *ast.CallNode) (reflect.Type, info) {
+	args := make([]reflect.Type, len(node.Arguments))
+	for i, arg := range node.Arguments {
+		args[i], _ = v.visit(arg)
+	}
+
+	if len(f.Overloads) > 0 {
+		return v.checkOverloads(f, node, args)
+	}
+	return v.checkBuiltinArgs(f, node, args)
+}
+
+// checkOverloads selects overload of the function by types of arguments.
+func (v *visitor) checkOverloads(f *builtin.Function, node *ast.CallNode, args []reflect.Type) (reflect.Type, info) {
+	var fits []*builtin.Function
+	for _, o := range f.Overloads {
+		if fitsExactly(o.Types[0], args) {
+			fits = append(fits, o)
+		}
+	}
+
+	if len(fits) > 1 {
+		for _, t := range args {
+			if t == nil || isAny(t) {
+				// Overload will be selected by types of arguments at runtime.
+				node.Func = builtin.Dispatch(f.Name, fits)
+				out := fits[0].Types[0].Out(0)
+				for _, o := range fits[1:] {
+					if o.Types[0].Out(0) != out {
+						out = anyType
+					}
+				}
+				return out, info{}
+			}
+		}
+	}
+
+	if len(fits) == 0 {
+		// Maybe some of overloads accept arguments after conversion
+		// of integer literals or with defaults.
+		fits = f.Overloads
+	}
+	for _, o := range fits {
+		arguments, types := withDefaults(o, o.Types[0], node.Arguments, args)
+		if matchArguments(o.Types[0], arguments, types) {
+			node.Func = o
+			return v.checkBuiltinArgs(o, node, args)
+		}
+	}
+	return v.errorHint(node, builtinHints(f, node.Arguments, args), "cannot use %v as arguments to call %v", typesString(args), f.Name)
+}
+
+func (v *visitor) checkBuiltinArgs(f *builtin.Function, node *ast.CallNode, args []reflect.Type) (reflect.Type, info) {
+	if f.ValidateConst != nil {
+		for i, arg := range node.Arguments {
+			if value, ok := constValue(arg); ok {
+				if err := f.ValidateConst(i, value); err != nil {
+					return v.error(arg, "%v", err)
+				}
+			}
+		}
+	}
+
+	if f.Validate != nil {
+		t, err := f.Validate(args)
+		if err != nil {
+			return v.error(node, "%v", err)
+		}
+		return t, info{}
+	}
+
+	if len(f.Types) == 0 {
+		return anyType, info{}
+	}
+
+	for _, fn := range f.Types {
+		arguments, types := withDefaults(f, fn, node.Arguments, args)
+		if matchArguments(fn, arguments, types) {
+			node.Arguments = arguments
+			return fn.Out(0), info{}
+		}
+	}
+
+	if len(f.Types) == 1 {
+		fn := f.Types[0]
+		numIn := fn.NumIn()
+		if fn.IsVariadic() {
+			numIn--
+		} else if len(args) > numIn {
+			return v.error(node, "too many arguments to call %v", f.Name)
+		}
+		if len(args) < numIn-len(f.Defaults) {
+			return v.error(node, "not enough arguments to call %v", f.Name)
+		}
+	}
+	return v.errorHint(node, builtinHints(f, node.Arguments, args), "cannot use %v as arguments to call %v", typesString(args), f.Name)
+}
+
+// broadcast reports whether the operation is element-wise arithmetic of an
+// array of numbers with a number or with another array of numbers.
+func broadcast(operator string, l, r reflect.Type) bool {
+	switch operator {
+	case "+", "-", "*", "/", "%", "**", "^":
+	default:
+		return false
+	}
+	if !isList(l) && !isList(r) {
+		return false
+	}
+	return isNumbers(l) && isNumbers(r)
+}
+
+func isList(t reflect.Type) bool {
+	return t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array)
+}
+
+// isNumbers reports whether values of the type may be numbers, or arrays of
+// numbers.
+func isNumbers(t reflect.Type) bool {
+	if isList(t) {
+		t = t.Elem()
+	}
+	return isNumber(t) || isAny(t)
+}
+
+// zeroDivisionType reports whether result of division (or modulo) by zero
+// replaced by configured policy may differ from type of the operation.
+func (v *visitor) zeroDivisionType(modulo bool) bool {
+	zd := v.config.ZeroDivision
+	if zd == nil || zd.Error {
+		return false
+	}
+	if zd.IEEE {
+		return modulo
+	}
+	if _, ok := zd.Value.(float64); ok {
+		return modulo
+	}
+	return true
+}
+
 func (v *visitor) BuiltinNode(node *ast.BuiltinNode) (reflect.Type, info) {
 	switch node.Name {
 
+	case "try", "fallback":
+		t, _ := v.visit(node.Arguments[0])
+		fallback, _ := v.visit(node.Arguments[1])
+		if t == fallback {
+			return t, info{}
+		}
+		return anyType, info{}
+
 	case "len":
 		param, _ := v.visit(node.Arguments[0])
+		param = v.narrowed(node.Arguments[0], param)
 		if isArray(param) || isMap(param) || isString(param) {
 			return integerType, info{}
 		}
@@ -626,7 +1023,7 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) (reflect.Type, info) {
 			closure.NumIn() == 1 && isAny(closure.In(0)) {
 
 			if !isBool(closure.Out(0)) && !isAny(closure.Out(0)) {
-				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0).String())
+				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0))
 			}
 			return boolType, info{}
 		}
@@ -647,7 +1044,7 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) (reflect.Type, info) {
 			closure.NumIn() == 1 && isAny(closure.In(0)) {
 
 			if !isBool(closure.Out(0)) && !isAny(closure.Out(0)) {
-				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0).String())
+				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0))
 			}
 			if isAny(collection) {
 				return arrayType, info{}
@@ -688,18 +1085,205 @@ func (v *visitor) BuiltinNode(node *ast.BuiltinNode) (reflect.Type, info) {
 			closure.NumOut() == 1 &&
 			closure.NumIn() == 1 && isAny(closure.In(0)) {
 			if !isBool(closure.Out(0)) && !isAny(closure.Out(0)) {
-				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0).String())
+				return v.error(node.Arguments[1], "closure should return boolean (got %v)", closure.Out(0))
 			}
 
 			return integerType, info{}
 		}
 		return v.error(node.Arguments[1], "closure should has one input and one output param")
 
+	case "reduce":
+		collection, _ := v.visit(node.Arguments[0])
+		if !isArray(collection) && !isAny(collection) {
+			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+		}
+
+		acc := anyType
+		if isArray(collection) {
+			acc = collection.Elem()
+		}
+		if len(node.Arguments) == 3 {
+			acc, _ = v.visit(node.Arguments[2])
+			if acc == nil {
+				acc = anyType
+			}
+		}
+
+		v.collections = append(v.collections, collection)
+		v.accumulators = append(v.accumulators, accumulator{closure: len(v.collections), t: acc})
+		closure, _ := v.visit(node.Arguments[1])
+		v.accumulators = v.accumulators[:len(v.accumulators)-1]
+		v.collections = v.collections[:len(v.collections)-1]
+
+		if isFunc(closure) &&
+			closure.NumOut() == 1 &&
+			closure.NumIn() == 1 && isAny(closure.In(0)) {
+			out := closure.Out(0)
+			if !isAny(acc) && !isAny(out) && out != acc {
+				return v.error(node.Arguments[1], "closure of reduce should return %v (got %v)", acc, out)
+			}
+			return acc, info{}
+		}
+		return v.error(node.Arguments[1], "closure should has one input and one output param")
+
+	case "fold":
+		collection, _ := v.visit(node.Arguments[0])
+		if !isArray(collection) && !isAny(collection) {
+			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+		}
+
+		last := len(node.Arguments) - 1
+		variables := make(map[string]reflect.Type, last-1)
+		for _, arg := range node.Arguments[1:last] {
+			let := arg.(*ast.LetNode)
+			t, _ := v.visit(let)
+			if t == nil {
+				t = anyType
+			}
+			variables[let.Name] = t
+		}
+
+		v.collections = append(v.collections, collection)
+		v.variables = append(v.variables, variables)
+		v.visit(node.Arguments[last])
+		v.variables = v.variables[:len(v.variables)-1]
+		v.collections = v.collections[:len(v.collections)-1]
+
+		// Result of fold is the first variable.
+		return variables[node.Arguments[1].(*ast.LetNode).Name], info{}
+
 	default:
 		return v.error(node, "unknown builtin %v", node.Name)
 	}
 }
 
+func (v *visitor) VariableNode(node *ast.VariableNode) (reflect.Type, info) {
+	for i := len(v.variables) - 1; i >= 0; i-- {
+		if t, ok := v.variables[i][node.Name]; ok {
+			return t, info{}
+		}
+	}
+	return v.error(node, "unknown variable %v", node.Name)
+}
+
+func (v *visitor) TupleNode(node *ast.TupleNode) (reflect.Type, info) {
+	for _, element := range node.Nodes {
+		v.visit(element)
+	}
+	return tupleType, info{}
+}
+
+// BindNode checks the body with types of variables. Variables of tuples get
+// types of elements, if they are known, like results of a called function.
+func (v *visitor) BindNode(node *ast.BindNode) (reflect.Type, info) {
+	t, _ := v.visit(node.Value)
+	if t == nil {
+		t = anyType
+	}
+	variables := make(map[string]reflect.Type, len(node.Names))
+	if node.Tuple {
+		types := elementTypes(node.Value)
+		if types == nil {
+			if !isArray(t) && !isAny(t) {
+				return v.error(node.Value, "cannot unpack %v into %v variables", t, len(node.Names))
+			}
+			element := anyType
+			if isArray(t) && t != tupleType {
+				element = t.Elem()
+			}
+			types = make([]reflect.Type, len(node.Names))
+			for i := range types {
+				types[i] = element
+			}
+		}
+		if len(types) != len(node.Names) {
+			return v.error(node.Value, "cannot unpack %v values into %v variables", len(types), len(node.Names))
+		}
+		for i, name := range node.Names {
+			if types[i] == nil {
+				types[i] = anyType
+			}
+			variables[name] = types[i]
+		}
+	} else {
+		variables[node.Names[0]] = t
+	}
+
+	v.variables = append(v.variables, variables)
+	defer func() {
+		v.variables = v.variables[:len(v.variables)-1]
+	}()
+	return v.visit(node.Body)
+}
+
+// ComprehensionNode checks, that items are an array, condition is boolean
+// and keys of maps are strings.
+func (v *visitor) ComprehensionNode(node *ast.ComprehensionNode) (reflect.Type, info) {
+	collection, _ := v.visit(node.Items)
+	if !isArray(collection) && !isAny(collection) {
+		return v.error(node.Items, "comprehension takes only array (got %v)", collection)
+	}
+	item := anyType
+	if isArray(collection) {
+		item = collection.Elem()
+	}
+
+	v.variables = append(v.variables, map[string]reflect.Type{node.Name: item})
+	defer func() {
+		v.variables = v.variables[:len(v.variables)-1]
+	}()
+
+	if node.Cond != nil {
+		t, _ := v.visit(node.Cond)
+		if !isBool(t) && !isAny(t) {
+			return v.error(node.Cond, "condition of comprehension should be boolean (got %v)", t)
+		}
+	}
+
+	if pair, ok := node.Node.(*ast.PairNode); ok {
+		key, _ := v.visit(pair.Key)
+		if !isString(key) && !isAny(key) {
+			return v.error(pair.Key, "map key should be string (got %v)", key)
+		}
+		v.visit(pair.Value)
+		return mapType, info{}
+	}
+	t, _ := v.visit(node.Node)
+	if t == nil {
+		return arrayType, info{}
+	}
+	return reflect.SliceOf(t), info{}
+}
+
+// AssignNode checks, that only variables of the fold are assigned, and
+// values have types of variables.
+func (v *visitor) AssignNode(node *ast.AssignNode) (reflect.Type, info) {
+	if len(v.variables) == 0 {
+		return v.error(node, "cannot assign %v outside of fold", node.Name)
+	}
+	variable, ok := v.variables[len(v.variables)-1][node.Name]
+	if !ok {
+		for i := len(v.variables) - 2; i >= 0; i-- {
+			if _, ok := v.variables[i][node.Name]; ok {
+				return v.error(node, "cannot assign %v outside of its fold", node.Name)
+			}
+		}
+		return v.error(node, "cannot assign %v, only variables declared by let may be assigned", node.Name)
+	}
+	t, _ := v.visit(node.Value)
+	if t != nil && !isAny(variable) && !isAny(t) && !t.AssignableTo(variable) {
+		return v.error(node.Value, "cannot assign %v to %v (type %v)", t, node.Name, variable)
+	}
+	return variable, info{}
+}
+
+func (v *visitor) BlockNode(node *ast.BlockNode) (reflect.Type, info) {
+	for _, n := range node.Nodes {
+		v.visit(n)
+	}
+	return anyType, info{}
+}
+
 func (v *visitor) ClosureNode(node *ast.ClosureNode) (reflect.Type, info) {
 	t, _ := v.visit(node.Node)
 	return reflect.FuncOf([]reflect.Type{anyType}, []reflect.Type{t}, false), info{}
@@ -709,12 +1293,26 @@ func (v *visitor) PointerNode(node *ast.PointerNode) (reflect.Type, info) {
 	if len(v.collections) == 0 {
 		return v.error(node, "cannot use pointer accessor outside closure")
 	}
+	switch node.Name {
+	case "index":
+		return integerType, info{}
+	case "acc":
+		last := len(v.accumulators) - 1
+		if last < 0 || v.accumulators[last].closure != len(v.collections) {
+			return v.error(node, "#acc can be used only in the closure of reduce")
+		}
+		return v.accumulators[last].t, info{}
+	}
 
 	collection := v.collections[len(v.collections)-1]
 	switch collection.Kind() {
 	case reflect.Interface:
 		return anyType, info{}
 	case reflect.Array, reflect.Slice:
+		if t, ok := v.deref(collection.Elem()); ok && v.isConverted(collection.Elem()) {
+			node.Deref = true
+			return t, info{}
+		}
 		return collection.Elem(), info{}
 	}
 	return v.error(node, "cannot use %v as array", collection)
@@ -726,7 +1324,7 @@ func (v *visitor) ConditionalNode(node *ast.ConditionalNode) (reflect.Type, info
 		return v.error(node.Cond, "non-bool expression (type %v) used as condition", c)
 	}
 
-	t1, _ := v.visit(node.Exp1)
+	t1, _ := v.visitNarrowed(node.Exp1, typeTests(node.Cond))
 	t2, _ := v.visit(node.Exp2)
 
 	if t1 == nil && t2 != nil {
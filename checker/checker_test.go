@@ -2,6 +2,7 @@ package checker_test
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
 	"regexp"
 	"strings"
@@ -18,10 +19,24 @@ import (
 )
 
 var successTests = []string{
+	"fold(ArrayOfInt, let n = 0, {n = n + #}) > 0",
+	"fold(ArrayOfFoo, let n = 0, let s = \"\", {s = s + #.Bar.Baz; n = n + len(s)}) == 0",
+	"let (a, b) = FuncTooManyReturns(); a + b > 0",
+	"let (a, b) = (Int, String); b + convert.string(a) == \"\"",
+	"let x = Int * 2; x + Int > 0",
+	"FuncTooManyReturns()[0] == 1",
+	"reduce(ArrayOfInt, {#acc + #}) > 0",
+	"reduce(ArrayOfFoo, {#acc + len(#.Bar.Baz)}, 0) > 0",
+	"all(ArrayOfInt, {#index >= 3 || # > 0})",
+	"[x * 2 for x in ArrayOfInt if x > Int][0] > 0",
+	"{(x.Bar.Baz): x for x in ArrayOfFoo}.foo.Bar.Baz == \"\"",
 	"nil == nil",
 	"nil == IntPtr",
 	"nil == nil",
 	"nil in ArrayOfFoo",
+	"Int in Any",
+	"'foo' in Any",
+	"Any in Any",
 	"!Bool",
 	"!BoolPtr == Bool",
 	"'a' == 'b' + 'c'",
@@ -121,6 +136,13 @@ var successTests = []string{
 	"Duration + Any == Time",
 	"Any + Duration == Time",
 	"Any.A?.B == nil",
+	"types.isList(Any) && Any[0] == 1",
+	"types.isMap(Any) && Any.Foo == 1",
+	"types.of(Any) == 'string' && Any[1:] == ''",
+	"(types.isString(Any) ? len(Any) : 0) > 1",
+	"len(maps.keys(MapOfAny)) > 0",
+	"Any + (Any - Any) > 1",
+	"Time - Time == Duration",
 }
 
 func TestCheck(t *testing.T) {
@@ -144,7 +166,7 @@ type mock.Bar has no field Not (1:9)
  | ........^
 
 Noo
-unknown name Noo (1:1)
+unknown name Noo, did you mean Foo? (1:1)
  | Noo
  | ^
 
@@ -154,7 +176,7 @@ mock.Foo is not callable (1:1)
  | ^
 
 Foo['bar']
-type mock.Foo has no field bar (1:4)
+type mock.Foo has no field bar, did you mean Bar? (1:4)
  | Foo['bar']
  | ...^
 
@@ -179,17 +201,17 @@ type mock.Foo has no field Not (1:15)
  | ..............^
 
 ArrayOfFoo[Not]
-unknown name Not (1:12)
+unknown name Not, did you mean net? (1:12)
  | ArrayOfFoo[Not]
  | ...........^
 
 Not[0]
-unknown name Not (1:1)
+unknown name Not, did you mean net? (1:1)
  | Not[0]
  | ^
 
 Not.Bar
-unknown name Not (1:1)
+unknown name Not, did you mean net? (1:1)
  | Not.Bar
  | ^
 
@@ -209,7 +231,7 @@ type mock.Foo has no field Not (1:17)
  | ................^
 
 Bool && IntPtr
-invalid operation: && (mismatched types bool and int) (1:6)
+invalid operation: && (mismatched types bool and int), where Bool is bool, IntPtr is int (1:6)
  | Bool && IntPtr
  | .....^
 
@@ -234,42 +256,42 @@ non-bool expression (type map[string]interface {}) used as condition (1:1)
  | ^
 
 String matches Int
-invalid operation: matches (mismatched types string and int) (1:8)
+invalid operation: matches (mismatched types string and int), where String is string, Int is int (1:8)
  | String matches Int
  | .......^
 
 Int matches String
-invalid operation: matches (mismatched types int and string) (1:5)
+invalid operation: matches (mismatched types int and string), where Int is int, String is string (1:5)
  | Int matches String
  | ....^
 
 String contains Int
-invalid operation: contains (mismatched types string and int) (1:8)
+invalid operation: contains (mismatched types string and int), where String is string, Int is int (1:8)
  | String contains Int
  | .......^
 
 Int contains String
-invalid operation: contains (mismatched types int and string) (1:5)
+invalid operation: contains (mismatched types int and string), where Int is int, String is string (1:5)
  | Int contains String
  | ....^
 
 !Not
-unknown name Not (1:2)
+unknown name Not, did you mean net? (1:2)
  | !Not
  | .^
 
 Not == Any
-unknown name Not (1:1)
+unknown name Not, did you mean net? (1:1)
  | Not == Any
  | ^
 
 [Not]
-unknown name Not (1:2)
+unknown name Not, did you mean net? (1:2)
  | [Not]
  | .^
 
 {id: Not}
-unknown name Not (1:6)
+unknown name Not, did you mean net? (1:6)
  | {id: Not}
  | .....^
 
@@ -294,72 +316,72 @@ invalid operation: or (mismatched types bool and int) (1:6)
  | .....^
 
 not IntPtr
-invalid operation: not (mismatched type int) (1:1)
+invalid operation: not (mismatched type int), where IntPtr is int (1:1)
  | not IntPtr
  | ^
 
 len(Not)
-unknown name Not (1:5)
+unknown name Not, did you mean net? (1:5)
  | len(Not)
  | ....^
 
 Int < Bool
-invalid operation: < (mismatched types int and bool) (1:5)
+invalid operation: < (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int < Bool
  | ....^
 
 Int > Bool
-invalid operation: > (mismatched types int and bool) (1:5)
+invalid operation: > (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int > Bool
  | ....^
 
 Int >= Bool
-invalid operation: >= (mismatched types int and bool) (1:5)
+invalid operation: >= (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int >= Bool
  | ....^
 
 Int <= Bool
-invalid operation: <= (mismatched types int and bool) (1:5)
+invalid operation: <= (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int <= Bool
  | ....^
 
 Int + Bool
-invalid operation: + (mismatched types int and bool) (1:5)
+invalid operation: + (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int + Bool
  | ....^
 
 Int - Bool
-invalid operation: - (mismatched types int and bool) (1:5)
+invalid operation: - (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int - Bool
  | ....^
 
 Int * Bool
-invalid operation: * (mismatched types int and bool) (1:5)
+invalid operation: * (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int * Bool
  | ....^
 
 Int / Bool
-invalid operation: / (mismatched types int and bool) (1:5)
+invalid operation: / (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int / Bool
  | ....^
 
 Int % Bool
-invalid operation: % (mismatched types int and bool) (1:5)
+invalid operation: % (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int % Bool
  | ....^
 
 Int ** Bool
-invalid operation: ** (mismatched types int and bool) (1:5)
+invalid operation: ** (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int ** Bool
  | ....^
 
 Int .. Bool
-invalid operation: .. (mismatched types int and bool) (1:5)
+invalid operation: .. (mismatched types int and bool), where Int is int, Bool is bool (1:5)
  | Int .. Bool
  | ....^
 
 Any > Foo
-invalid operation: > (mismatched types interface {} and mock.Foo) (1:5)
+invalid operation: > (mismatched types interface {} and mock.Foo), where Any is interface {}, Foo is mock.Foo (1:5)
  | Any > Foo
  | ....^
 
@@ -369,12 +391,12 @@ func NilFn doesn't return value (1:1)
  | ^
 
 'str' in String
-invalid operation: in (mismatched types string and string) (1:7)
+invalid operation: in (mismatched types string and string), where String is string (1:7)
  | 'str' in String
  | ......^
 
 1 in Foo
-invalid operation: in (mismatched types int and mock.Foo) (1:3)
+invalid operation: in (mismatched types int and mock.Foo), where Foo is mock.Foo (1:3)
  | 1 in Foo
  | ..^
 
@@ -399,7 +421,7 @@ not enough arguments to call Variadic (1:1)
  | ^
 
 Variadic(0, '')
-cannot use string as argument (type int) to call Variadic  (1:13)
+cannot use string as argument (type int) to call Variadic; Variadic is func(int, ...int) bool (1:13)
  | Variadic(0, '')
  | ............^
 
@@ -453,10 +475,20 @@ cannot slice bool (1:5)
  | Bool[:]
  | ....^
 
-FuncTooManyReturns()
-func FuncTooManyReturns returns more then two values (1:1)
- | FuncTooManyReturns()
- | ^
+let (a, b) = FuncTooManyReturns(); a + String
+invalid operation: + (mismatched types int and string), where String is string (1:38)
+ | let (a, b) = FuncTooManyReturns(); a + String
+ | .....................................^
+
+let (a, b, c) = FuncTooManyReturns(); a
+cannot unpack 2 values into 3 variables (1:17)
+ | let (a, b, c) = FuncTooManyReturns(); a
+ | ................^
+
+let (a, b) = Int; a
+cannot unpack int into 2 variables (1:14)
+ | let (a, b) = Int; a
+ | .............^
 
 len(42)
 invalid argument for len (type int) (1:1)
@@ -477,6 +509,96 @@ MapOfAny[0]
 cannot use int to get an element from map[string]interface {} (1:10)
  | MapOfAny[0]
  | .........^
+
+types.isNil(Any) && Any.Foo
+cannot fetch from nil (1:25)
+ | types.isNil(Any) && Any.Foo
+ | ........................^
+
+types.of(Any) == "bool" && Any[:]
+cannot slice bool (1:31)
+ | types.of(Any) == "bool" && Any[:]
+ | ..............................^
+
+Foo.Methd()
+type mock.Foo has no method Methd, did you mean Method? (1:5)
+ | Foo.Methd()
+ | ....^
+
+strings.trimm(" a ")
+unknown function strings.trimm, did you mean strings.trim? (1:9)
+ | strings.trimm(" a ")
+ | ........^
+
+lenn(ArrayOfAny)
+unknown name lenn, did you mean len? (1:1)
+ | lenn(ArrayOfAny)
+ | ^
+
+NoSuchVariable
+unknown name NoSuchVariable (1:1)
+ | NoSuchVariable
+ | ^
+
+Foo.Bar.Baz + 1
+invalid operation: + (mismatched types string and int), where Foo.Bar.Baz is string (1:13)
+ | Foo.Bar.Baz + 1
+ | ............^
+
+strings.repeat(String, String)
+cannot use (string, string) as arguments to call strings.repeat, where String is string, String is string; strings.repeat accepts func(string, int) string (1:9)
+ | strings.repeat(String, String)
+ | ........^
+
+fold(Int, let n = 0, {n = n + 1})
+builtin fold takes only array (got int) (1:6)
+ | fold(Int, let n = 0, {n = n + 1})
+ | .....^
+
+fold(ArrayOfInt, let n = 0, {n = n + Float})
+cannot assign float64 to n (type int) (1:36)
+ | fold(ArrayOfInt, let n = 0, {n = n + Float})
+ | ...................................^
+
+fold(ArrayOfInt, let n = 0, {Int = 1})
+cannot assign Int, only variables declared by let may be assigned (1:30)
+ | fold(ArrayOfInt, let n = 0, {Int = 1})
+ | .............................^
+
+fold(ArrayOfInt, let n = 0, {n = fold(ArrayOfInt, let m = 0, {n = m})})
+cannot assign n outside of its fold (1:63)
+ | fold(ArrayOfInt, let n = 0, {n = fold(ArrayOfInt, let m = 0, {n = m})})
+ | ..............................................................^
+
+map(ArrayOfInt, {#acc})
+#acc can be used only in the closure of reduce (1:18)
+ | map(ArrayOfInt, {#acc})
+ | .................^
+
+reduce(ArrayOfInt, {map(ArrayOfInt, {#acc})})
+#acc can be used only in the closure of reduce (1:38)
+ | reduce(ArrayOfInt, {map(ArrayOfInt, {#acc})})
+ | .....................................^
+
+reduce(ArrayOfInt, {#acc + 0.5})
+closure of reduce should return int (got float64) (1:20)
+ | reduce(ArrayOfInt, {#acc + 0.5})
+ | ...................^
+
+[x for x in Int]
+comprehension takes only array (got int) (1:13)
+ | [x for x in Int]
+ | ............^
+
+[x for x in ArrayOfInt if x]
+condition of comprehension should be boolean (got int) (1:27)
+ | [x for x in ArrayOfInt if x]
+ | ..........................^
+
+{x: x for x in ArrayOfInt}
+map key should be string (got int) (1:1)
+ | {x: x for x in ArrayOfInt}
+ | ^
 `
 
 func TestCheck_error(t *testing.T) {
@@ -596,6 +718,127 @@ func TestCheck_Ambiguous(t *testing.T) {
 	assert.Contains(t, err.Error(), "ambiguous identifier Ambiguous")
 }
 
+type promotedBase struct {
+	ID   int
+	Name string
+}
+
+type promotedMiddle struct {
+	*promotedBase
+	Name bool
+}
+
+type promotedOther struct {
+	ID string
+}
+
+type promotedNode struct {
+	*promotedNode
+	Value int
+}
+
+func TestCheck_promotedFields(t *testing.T) {
+	type Env struct {
+		promotedMiddle
+		*promotedOther
+		Node promotedNode
+		Deep struct{ promotedMiddle }
+	}
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{code: `Name == true`},
+		{code: `Deep.Name == true`},
+		{code: `Deep.ID + 1 > 0`},
+		{code: `Node.Value + Node.promotedNode.Value > 0`},
+		{code: `ID == "shallower"`},
+		{code: `ID == 1`, err: "mismatched types string and int"},
+		{code: `Missing`, err: "unknown name Missing"},
+		{code: `Deep.Missing`, err: "has no field Missing"},
+	}
+	for _, test := range tests {
+		tree, err := parser.Parse(test.code)
+		require.NoError(t, err)
+
+		_, err = checker.Check(tree, conf.New(Env{}))
+		if test.err == "" {
+			assert.NoError(t, err, test.code)
+		} else {
+			require.Error(t, err, test.code)
+			assert.Contains(t, err.Error(), test.err, test.code)
+		}
+	}
+
+	type Ambiguous struct {
+		promotedBase
+		promotedOther
+	}
+	env := map[string]interface{}{"a": Ambiguous{}}
+	_, err := expr.Compile(`a.ID`, expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous selector ID of type checker_test.Ambiguous")
+
+	env["deep"] = struct{ promotedMiddle }{promotedMiddle{promotedBase: &promotedBase{ID: 42}}}
+	out, err := expr.Eval(`deep.ID`, env)
+	require.NoError(t, err)
+	assert.Equal(t, 42, out)
+
+	program, err := expr.Compile(`deep.ID`, expr.Env(env))
+	require.NoError(t, err)
+	out, err = expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, 42, out)
+
+	_, err = expr.Run(program, map[string]interface{}{"deep": struct{ promotedMiddle }{}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot get ID from nil embedded *checker_test.promotedBase")
+}
+
+// TestCheck_promotedFields_corpus compares resolution of fields of generated
+// structs, embedding structs and pointers to structs at many levels, with
+// FieldByName of reflect, which follows rules of Go.
+func TestCheck_promotedFields_corpus(t *testing.T) {
+	names := []string{"A", "B", "C"}
+	rnd := rand.New(rand.NewSource(1))
+	var generate func(depth int) reflect.Type
+	generate = func(depth int) reflect.Type {
+		var fields []reflect.StructField
+		for i, name := range names {
+			if rnd.Intn(3) == 0 {
+				fields = append(fields, reflect.StructField{Name: name, Type: reflect.TypeOf(i)})
+			}
+		}
+		for i := 0; depth > 0 && i < rnd.Intn(3); i++ {
+			embedded := generate(depth - 1)
+			if rnd.Intn(2) == 0 {
+				embedded = reflect.PtrTo(embedded)
+			}
+			fields = append(fields, reflect.StructField{Name: fmt.Sprintf("E%v", i), Type: embedded, Anonymous: true})
+		}
+		return reflect.StructOf(fields)
+	}
+
+	for i := 0; i < 500; i++ {
+		env := reflect.New(generate(3)).Elem().Interface()
+		for _, name := range names {
+			want, ok := reflect.TypeOf(env).FieldByName(name)
+
+			tree, err := parser.Parse(name)
+			require.NoError(t, err)
+			typ, err := checker.Check(tree, conf.New(env))
+			if !ok {
+				assert.Error(t, err, "%v of %v", name, reflect.TypeOf(env))
+				continue
+			}
+			require.NoError(t, err, "%v of %v", name, reflect.TypeOf(env))
+			assert.Equal(t, want.Type, typ)
+			assert.Equal(t, want.Index, tree.Node.(*ast.IdentifierNode).FieldIndex, "%v of %v", name, reflect.TypeOf(env))
+		}
+	}
+}
+
 func TestCheck_NoConfig(t *testing.T) {
 	tree, err := parser.Parse(`any`)
 	require.NoError(t, err)
@@ -703,3 +946,154 @@ func TestCheck_TypeWeights(t *testing.T) {
 		}
 	}
 }
+
+func TestCheck_units(t *testing.T) {
+	type Trip struct {
+		Distance float64 `unit:"m"`
+		Duration float64 `unit:"s"`
+		Legs     []struct {
+			Distance float64 `unit:"m"`
+		}
+	}
+	type Env struct {
+		Trip
+		Mass  float64 `unit:"kg"`
+		Force float64 `unit:"kg*m/s^2"`
+		Area  float64 `unit:"m^2"`
+		Count int
+		Bad   float64 `unit:"m/"`
+	}
+	config := func() *conf.Config {
+		c := conf.New(Env{})
+		expr.Unit("Count", "1/s")(c)
+		return c
+	}
+
+	valid := []string{
+		`Distance + Legs[0].Distance > 0`,
+		`Distance / Duration * 2 > 1`,
+		`Mass * Distance / Duration ** 2 == Force`,
+		`Mass * Distance / (Duration * Duration) <= Force`,
+		`math.sqrt(Area) + Distance`,
+		`Distance / Distance + 1`,
+		`Count * Duration + 1`,
+		`math.max(Distance, 1) - Distance`,
+		`Duration > 0 ? Distance : 0`,
+		`let d = 5; d + Duration`,
+		`[x + 1 for x in [Distance]]`,
+	}
+	for _, code := range valid {
+		tree, err := parser.Parse(code)
+		require.NoError(t, err, code)
+		_, err = checker.Check(tree, config())
+		assert.NoError(t, err, code)
+	}
+
+	invalid := []struct {
+		code string
+		err  string
+	}{
+		{`Distance + Duration`, "invalid operation: + (mismatched units m and s)"},
+		{`Distance > Duration`, "invalid operation: > (mismatched units m and s)"},
+		{`Mass * Distance / Duration == Force`, "invalid operation: == (mismatched units kg*m/s and kg*m/s^2)"},
+		{`Count + Duration`, "invalid operation: + (mismatched units 1/s and s)"},
+		{`Duration > 0 ? Distance : Duration`, "invalid operation: ?: (mismatched units m and s)"},
+		{`math.min(Distance, 1, Duration)`, "invalid operation: math.min (mismatched units m and s)"},
+		{`math.sqrt(Distance)`, "invalid argument for math.sqrt (unit m)"},
+		{`Distance ** Duration`, "invalid operation: ** (exponent has unit s)"},
+		{`Distance ** Mass`, "invalid operation: ** (exponent has unit kg)"},
+		{`Bad`, `invalid unit "m/" of Bad`},
+	}
+	for _, test := range invalid {
+		tree, err := parser.Parse(test.code)
+		require.NoError(t, err, test.code)
+		_, err = checker.Check(tree, config())
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+}
+
+type accessUser struct {
+	Name     string
+	Email    string
+	Password string
+	Friends  []accessUser
+}
+
+func (u accessUser) Greeting() string { return "Hello, " + u.Name }
+
+func TestCheck_access(t *testing.T) {
+	type Env struct {
+		User   accessUser
+		Users  []accessUser
+		Order  struct{ ID, Total int }
+		Secret string
+		Key    string
+		Attrs  map[string]string
+	}
+	allow := func() *conf.Config {
+		c := conf.New(Env{})
+		expr.AllowFields("User.Name", "User.Greeting", "Users.Name", "Order.*", "Key")(c)
+		return c
+	}
+	deny := func() *conf.Config {
+		c := conf.New(Env{})
+		expr.DenyFields("Secret", "*.Password", "Users.*.Password", "Attrs.token")(c)
+		return c
+	}
+
+	valid := []struct {
+		config func() *conf.Config
+		code   string
+	}{
+		{allow, `User.Name + User.Greeting()`},
+		{allow, `Order.ID > 0 && Order.Total > 0 && Order != nil`},
+		{allow, `map(Users, {.Name})`},
+		{allow, `all(Users, {#.Name != ""}) && Users[0].Name != ""`},
+		{allow, `let u = User; u.Name`},
+		{allow, `[u.Name for u in Users]`},
+		{allow, `len(User.Name) > 0`},
+		{deny, `User.Name + User.Email`},
+		{deny, `map(Users, {.Friends[0].Name})`},
+		{deny, `User["Name"]`},
+		{deny, `Attrs.color + Attrs["size"]`},
+	}
+	for _, test := range valid {
+		tree, err := parser.Parse(test.code)
+		require.NoError(t, err, test.code)
+		_, err = checker.Check(tree, test.config())
+		assert.NoError(t, err, test.code)
+	}
+
+	invalid := []struct {
+		config func() *conf.Config
+		code   string
+		err    string
+	}{
+		{allow, `User.Email`, "access to User.Email is not allowed"},
+		{allow, `User`, "access to User is not allowed"},
+		{allow, `Secret`, "access to Secret is not allowed"},
+		{allow, `filter(Users, {.Name == ""})`, "access to Users is not allowed"},
+		{allow, `map(Users, {.Email})`, "access to Users.Email is not allowed"},
+		{allow, `let u = User; u.Email`, "access to User.Email is not allowed"},
+		{allow, `[u.Email for u in Users]`, "access to Users.Email is not allowed"},
+		{allow, `Attrs[Key]`, "access to Attrs is not allowed"},
+		{deny, `Secret`, "access to Secret is not allowed"},
+		{deny, `User.Password`, "access to User.Password is not allowed"},
+		{deny, `User?.Password`, "access to User.Password is not allowed (1:7)"},
+		{deny, `(User?.Password)`, "access to User.Password is not allowed (1:8)"},
+		{deny, `User`, "access to User is not allowed"},
+		{deny, `Attrs[Key]`, "access to Attrs is not allowed"},
+		{deny, `Attrs.token`, "access to Attrs.token is not allowed"},
+		{deny, `User["Password"]`, "access to User.Password is not allowed"},
+		{deny, `map(Users, {.Password})`, "access to Users.Password is not allowed"},
+		{deny, `map(Users, {.Friends[0].Password})`, "access to Users.Friends.Password is not allowed"},
+	}
+	for _, test := range invalid {
+		tree, err := parser.Parse(test.code)
+		require.NoError(t, err, test.code)
+		_, err = checker.Check(tree, test.config())
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+}
@@ -0,0 +1,121 @@
+//go:build go1.18
+// +build go1.18
+
+package checker_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/docgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type genericOrder struct {
+	ID    int
+	Total float64
+}
+
+type List[T any] []T
+
+func (l List[T]) First() T { return l[0] }
+
+type Option[T any] struct {
+	Value T
+	Valid bool
+}
+
+func (o Option[T]) OrElse(v T) T {
+	if o.Valid {
+		return o.Value
+	}
+	return v
+}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+type Box[T any] struct {
+	Option[T]
+	Items List[T]
+	Index map[string]T
+}
+
+type genericEnv struct {
+	Orders List[genericOrder]
+	Max    Option[float64]
+	Best   *Option[*genericOrder]
+	Pairs  []Pair[string, genericOrder]
+	Box    Box[genericOrder]
+}
+
+func TestCheck_generics(t *testing.T) {
+	order := genericOrder{ID: 1, Total: 10}
+	env := genericEnv{
+		Orders: List[genericOrder]{order, {ID: 2, Total: 20}},
+		Max:    Option[float64]{Value: 5, Valid: true},
+		Best:   &Option[*genericOrder]{Value: &order, Valid: true},
+		Pairs:  []Pair[string, genericOrder]{{Key: "a", Val: order}},
+		Box:    Box[genericOrder]{Option: Option[genericOrder]{Value: order}, Items: List[genericOrder]{order}, Index: map[string]genericOrder{"a": order}},
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`Orders[0].Total`, 10.0},
+		{`Orders.First().ID`, 1},
+		{`Orders[1:].First().ID`, 2},
+		{`filter(Orders, {.Total > 10})[0].ID`, 2},
+		{`map(Orders, {.Total})[1] / 2`, 10.0},
+		{`count(Orders, {.ID > 0})`, 2},
+		{`Max.OrElse(2) * 2`, 10.0},
+		{`Best.Value.Total`, 10.0},
+		{`Best.OrElse(Best.Value).ID`, 1},
+		{`Pairs[0].Key + "b"`, "ab"},
+		{`Pairs[0].Val.Total`, 10.0},
+		{`Box.Value.ID + Box.OrElse(Box.Items[0]).ID`, 2},
+		{`Box.Items.First().Total`, 10.0},
+		{`Box.Index.a.ID`, 1},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(genericEnv{}))
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	errors := []struct {
+		code string
+		err  string
+	}{
+		{`Box.Nope`, "type checker_test.Box[checker_test.genericOrder] has no field Nope"},
+		{`Best.Nope`, "type checker_test.Option[*checker_test.genericOrder] has no field Nope"},
+		{`Orders.First().Nope`, "type checker_test.genericOrder has no field Nope"},
+		{`Max.OrElse("x")`, "cannot use string as argument (type float64) to call OrElse"},
+		{`Orders + 1`, "mismatched types checker_test.List[checker_test.genericOrder] and int"},
+		{`Pairs[0].Val.ID + ""`, "mismatched types int and string"},
+	}
+	for _, test := range errors {
+		_, err := expr.Compile(test.code, expr.Env(genericEnv{}))
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+}
+
+func TestTypeString_generics(t *testing.T) {
+	assert.Equal(t, "checker_test.Pair[string,checker_test.genericOrder]", conf.TypeString(reflect.TypeOf(Pair[string, genericOrder]{})))
+	assert.Equal(t, "map[string]checker_test.List[*checker_test.genericOrder]", conf.TypeString(reflect.TypeOf(map[string]List[*genericOrder]{})))
+	assert.Equal(t, "Option[checker_test.genericOrder]", conf.TypeName(reflect.TypeOf(Option[genericOrder]{})))
+
+	doc := docgen.CreateDoc(genericEnv{})
+	assert.Equal(t, docgen.TypeName("Box[checker_test.genericOrder]"), doc.Variables["Box"].Name)
+	assert.Contains(t, doc.Types, docgen.TypeName("Box[checker_test.genericOrder]"))
+}
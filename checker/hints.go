@@ -0,0 +1,125 @@
+package checker
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+)
+
+// hint is a detail of an error, like a suggestion of a name or a type of an
+// operand. Hints are translated separately from the message of the error.
+type hint struct {
+	format string
+	args   []interface{}
+}
+
+func (h hint) message(t file.Translator) string {
+	if t != nil {
+		return t(h.format, typeStrings(h.args)...)
+	}
+	return fmt.Sprintf(h.format, typeStrings(h.args)...)
+}
+
+// typeStrings replaces types among arguments of messages with their strings,
+// which name type arguments of generic types by package names, as in source.
+func typeStrings(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(reflect.Type); ok {
+			arg = conf.TypeString(t)
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// errorHint reports an error with hints appended to the message.
+func (v *visitor) errorHint(node ast.Node, hints []hint, format string, args ...interface{}) (reflect.Type, info) {
+	if v.err == nil {
+		v.hints = hints
+	}
+	return v.error(node, format, args...)
+}
+
+// suggestion returns a hint with the candidate nearest to name.
+func suggestion(name string, candidates []string) []hint {
+	if s := suggest(name, candidates); s != "" {
+		return []hint{{", did you mean %v?", []interface{}{s}}}
+	}
+	return nil
+}
+
+// origins returns hints with types of operands, which are variables or
+// fields of the environment, like "where User.Age is int".
+func origins(nodes []ast.Node, types []reflect.Type) []hint {
+	var hints []hint
+	for i, node := range nodes {
+		path, ok := nodePath(node)
+		if !ok || types[i] == nil {
+			continue
+		}
+		format := ", %v is %v"
+		if len(hints) == 0 {
+			format = ", where %v is %v"
+		}
+		hints = append(hints, hint{format, []interface{}{path, types[i]}})
+	}
+	return hints
+}
+
+// signatureHint returns a hint with the signature of a called function.
+func signatureHint(name string, method bool, fn reflect.Type) hint {
+	skip := 0
+	if method {
+		skip = 1 // receiver
+	}
+	return hint{"; %v is %v", []interface{}{name, signature(fn, skip)}}
+}
+
+// builtinHints returns hints for a call of builtin function with arguments
+// of wrong types: types of arguments and accepted signatures.
+func builtinHints(f *builtin.Function, arguments []ast.Node, args []reflect.Type) []hint {
+	hints := origins(arguments, args)
+	types := f.Types
+	for _, o := range f.Overloads {
+		types = append(types[:len(types):len(types)], o.Types...)
+	}
+	if len(types) == 0 {
+		return hints
+	}
+	signatures := make([]string, len(types))
+	for i, fn := range types {
+		signatures[i] = signature(fn, 0)
+	}
+	return append(hints, hint{"; %v accepts %v", []interface{}{f.Name, strings.Join(signatures, " or ")}})
+}
+
+// signature returns type of a function without first skip parameters.
+func signature(fn reflect.Type, skip int) string {
+	in := make([]string, 0, fn.NumIn())
+	for i := skip; i < fn.NumIn(); i++ {
+		t := fn.In(i)
+		if fn.IsVariadic() && i == fn.NumIn()-1 {
+			in = append(in, "..."+conf.TypeString(t.Elem()))
+		} else {
+			in = append(in, conf.TypeString(t))
+		}
+	}
+	out := make([]string, fn.NumOut())
+	for i := range out {
+		out[i] = conf.TypeString(fn.Out(i))
+	}
+	s := "func(" + strings.Join(in, ", ") + ")"
+	switch len(out) {
+	case 0:
+		return s
+	case 1:
+		return s + " " + out[0]
+	}
+	return s + " (" + strings.Join(out, ", ") + ")"
+}
@@ -0,0 +1,73 @@
+package checker
+
+import (
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Rules runs custom rules of the config on the checked tree, and returns
+// warnings of rules, and the first error of rules, if any. Diagnostics
+// span sources of their nodes.
+func Rules(tree *parser.Tree, config *conf.Config) ([]*file.Error, error) {
+	if config == nil || len(config.Rules) == 0 {
+		return nil, nil
+	}
+	report := &conf.Report{Config: config, Span: spans(tree)}
+	for _, rule := range config.Rules {
+		ast.Walk(&tree.Node, &ruleVisitor{rule: rule, report: report})
+	}
+	for _, e := range append(report.Errors, report.Warnings...) {
+		if config.Translator != nil {
+			e.Translate(config.Translator)
+		}
+		e.Bind(tree.Source)
+	}
+	if len(report.Errors) > 0 {
+		return report.Warnings, report.Errors[0]
+	}
+	return report.Warnings, nil
+}
+
+type ruleVisitor struct {
+	rule   conf.Rule
+	report *conf.Report
+}
+
+func (v *ruleVisitor) Visit(node *ast.Node) {
+	v.rule.Check(v.report, *node)
+}
+
+// spans returns the function of spans of nodes of the tree, which measures
+// spans on first use.
+func spans(tree *parser.Tree) func(node ast.Node) (file.Location, file.Location, bool) {
+	var measured map[ast.Node]parser.Span
+	var lines []int
+	location := func(offset int) file.Location {
+		line := len(lines) - 1
+		for line > 0 && lines[line] > offset {
+			line--
+		}
+		return file.Location{Line: line + 1, Column: offset - lines[line]}
+	}
+	return func(node ast.Node) (file.Location, file.Location, bool) {
+		if measured == nil {
+			var err error
+			if measured, err = parser.Spans(tree); err != nil {
+				measured = map[ast.Node]parser.Span{}
+			}
+			lines = []int{0}
+			for i, r := range []rune(tree.Source.Content()) {
+				if r == '\n' {
+					lines = append(lines, i+1)
+				}
+			}
+		}
+		span, ok := measured[node]
+		if !ok {
+			return file.Location{}, file.Location{}, false
+		}
+		return location(span.Start), location(span.End), true
+	}
+}
@@ -0,0 +1,74 @@
+package checker
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/internal/edit"
+	"github.com/antonmedv/expr/parser"
+)
+
+// suggest returns the candidate nearest to name, or an empty string if no
+// candidate is close enough.
+func suggest(name string, candidates []string) string {
+	sort.Strings(candidates)
+	best, bestDistance := "", 0
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		// Swapped letters are typos of one edit.
+		d := edit.Distance([]rune(strings.ToLower(name)), []rune(strings.ToLower(c)), true)
+		if best == "" || d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	// Allow one edit for every three characters of the name.
+	if best == "" || bestDistance > (len(name)+2)/3 {
+		return ""
+	}
+	return best
+}
+
+// names returns identifiers available in the environment and builtins.
+func (v *visitor) names() []string {
+	names := parser.Builtins()
+	for name, t := range v.config.Types {
+		if !t.Ambiguous {
+			names = append(names, name)
+		}
+	}
+	for name := range v.config.Functions {
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// builtinNames returns names of builtin functions, including namespaces.
+func (v *visitor) builtinNames() []string {
+	names := make([]string, 0, len(v.config.Functions))
+	for name := range v.config.Functions {
+		names = append(names, name)
+	}
+	return names
+}
+
+// members returns names of fields and methods of a type.
+func members(t reflect.Type) []string {
+	var names []string
+	if t.Kind() == reflect.Struct {
+		for name := range conf.FieldsFromStruct(t) {
+			names = append(names, name)
+		}
+		t = reflect.PtrTo(t)
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		names = append(names, t.Method(i).Name)
+	}
+	return names
+}
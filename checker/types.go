@@ -1,25 +1,34 @@
 package checker
 
 import (
+	"context"
+	"encoding/json"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
 	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/vm/runtime"
 )
 
 var (
-	nilType      = reflect.TypeOf(nil)
-	boolType     = reflect.TypeOf(true)
-	integerType  = reflect.TypeOf(0)
-	floatType    = reflect.TypeOf(float64(0))
-	stringType   = reflect.TypeOf("")
-	arrayType    = reflect.TypeOf([]interface{}{})
-	mapType      = reflect.TypeOf(map[string]interface{}{})
-	anyType      = reflect.TypeOf(new(interface{})).Elem()
-	timeType     = reflect.TypeOf(time.Time{})
-	durationType = reflect.TypeOf(time.Duration(0))
-	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	nilType        = reflect.TypeOf(nil)
+	boolType       = reflect.TypeOf(true)
+	integerType    = reflect.TypeOf(0)
+	floatType      = reflect.TypeOf(float64(0))
+	stringType     = reflect.TypeOf("")
+	arrayType      = reflect.TypeOf([]interface{}{})
+	mapType        = reflect.TypeOf(map[string]interface{}{})
+	anyType        = reflect.TypeOf(new(interface{})).Elem()
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	versionType    = reflect.TypeOf(runtime.Version{})
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+	tupleType      = reflect.TypeOf(runtime.Tuple{})
+	contextType    = reflect.TypeOf((*context.Context)(nil)).Elem()
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
 )
 
 func combined(a, b reflect.Type) reflect.Type {
@@ -100,6 +109,16 @@ func isTime(t reflect.Type) bool {
 	return isAny(t)
 }
 
+func isVersion(t reflect.Type) bool {
+	if t != nil {
+		switch t {
+		case versionType:
+			return true
+		}
+	}
+	return isAny(t)
+}
+
 func isDuration(t reflect.Type) bool {
 	if t != nil {
 		switch t {
@@ -178,32 +197,64 @@ func isFunc(t reflect.Type) bool {
 	return false
 }
 
-func fetchField(t reflect.Type, name string) (reflect.StructField, bool) {
-	if t != nil {
-		// First check all structs fields.
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			// Search all fields, even embedded structs.
-			if conf.FieldName(field) == name {
-				return field, true
-			}
-		}
+// fetchField returns the field of the struct by name, promoted from embedded
+// structs by rules of Go, and reports whether the name is ambiguous.
+func fetchField(t reflect.Type, name string) (field reflect.StructField, ok, ambiguous bool) {
+	if t == nil {
+		return reflect.StructField{}, false, false
+	}
+	tag, ok := conf.FieldsFromStruct(t)[name]
+	if !ok || tag.Ambiguous {
+		return reflect.StructField{}, false, ok
+	}
+	return reflect.StructField{Name: name, Type: tag.Type, Index: tag.FieldIndex}, true, false
+}
 
-		// Second check fields of embedded structs.
-		for i := 0; i < t.NumField(); i++ {
-			anon := t.Field(i)
-			if anon.Anonymous {
-				if field, ok := fetchField(anon.Type, name); ok {
-					field.Index = append(anon.Index, field.Index...)
-					return field, true
-				}
-			}
-		}
+// isMapKey reports whether values of the type may be keys of maps of keys of
+// the type key. Numbers and strings are converted to the type of keys, if
+// they are representable in it.
+func isMapKey(t, key reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch {
+	case t.AssignableTo(key), isAny(t):
+		return true
+	case isNumber(t) && isNumber(key):
+		return true
+	case t.Kind() == reflect.String && key.Kind() == reflect.String:
+		return true
 	}
-	return reflect.StructField{}, false
+	return false
+}
+
+// deref returns type of values of the type on access, which are converted
+// by converters of the config, and dereferenced.
+func (v *visitor) deref(t reflect.Type) (reflect.Type, bool) {
+	if fn, ok := v.config.Converters[t]; ok {
+		d, _ := deref(fn.Type().Out(0))
+		return d, true
+	}
+	return deref(t)
+}
+
+// isConverted reports whether values of the type are converted on access,
+// unlike pointers, which elements of arrays keep.
+func (v *visitor) isConverted(t reflect.Type) bool {
+	if _, ok := v.config.Converters[t]; ok {
+		return true
+	}
+	_, null := runtime.NullType(t)
+	return null || runtime.IsConverter(t) || t == rawMessageType
 }
 
 func deref(t reflect.Type) (reflect.Type, bool) {
+	if runtime.IsConverter(t) || t == rawMessageType {
+		return anyType, true
+	}
+	if n, ok := runtime.NullType(t); ok {
+		return n, true
+	}
 	if t.Kind() == reflect.Interface {
 		return t, true
 	}
@@ -256,3 +307,183 @@ func setTypeForIntegers(node ast.Node, t reflect.Type) {
 		}
 	}
 }
+
+// matchArguments reports whether arguments of given types can be passed to fn.
+func matchArguments(fn reflect.Type, arguments []ast.Node, args []reflect.Type) bool {
+	numIn := fn.NumIn()
+	if fn.IsVariadic() {
+		if len(args) < numIn-1 {
+			return false
+		}
+	} else if len(args) != numIn {
+		return false
+	}
+	for i, t := range args {
+		var in reflect.Type
+		if fn.IsVariadic() && i >= numIn-1 {
+			in = fn.In(numIn - 1).Elem()
+		} else {
+			in = fn.In(i)
+		}
+		if isIntegerOrArithmeticOperation(arguments[i]) && isNumber(in) {
+			setTypeForIntegers(arguments[i], in)
+			continue
+		}
+		if t == nil || isAny(t) || isAny(in) {
+			continue
+		}
+		if !t.AssignableTo(in) {
+			return false
+		}
+	}
+	return true
+}
+
+// fitsExactly reports whether arguments of given types can be passed to
+// function of type fn without conversions. Arguments of unknown types fit
+// parameters of any type.
+func fitsExactly(fn reflect.Type, args []reflect.Type) bool {
+	numIn := fn.NumIn()
+	if fn.IsVariadic() {
+		if len(args) < numIn-1 {
+			return false
+		}
+	} else if len(args) != numIn {
+		return false
+	}
+	for i, t := range args {
+		var in reflect.Type
+		if fn.IsVariadic() && i >= numIn-1 {
+			in = fn.In(numIn - 1).Elem()
+		} else {
+			in = fn.In(i)
+		}
+		if t == nil || isAny(t) {
+			continue
+		}
+		if !t.AssignableTo(in) {
+			return false
+		}
+	}
+	return true
+}
+
+// withDefaults appends default values of omitted optional parameters of fn
+// to arguments and their types.
+func withDefaults(f *builtin.Function, fn reflect.Type, arguments []ast.Node, args []reflect.Type) ([]ast.Node, []reflect.Type) {
+	numIn := fn.NumIn()
+	if fn.IsVariadic() {
+		numIn--
+	}
+	missing := numIn - len(args)
+	if missing <= 0 || missing > len(f.Defaults) {
+		return arguments, args
+	}
+	arguments = arguments[:len(arguments):len(arguments)]
+	args = args[:len(args):len(args)]
+	for _, d := range f.Defaults[len(f.Defaults)-missing:] {
+		t := reflect.TypeOf(d)
+		c := &ast.ConstantNode{Value: d}
+		c.SetType(t)
+		arguments = append(arguments, c)
+		args = append(args, t)
+	}
+	return arguments, args
+}
+
+func typesString(types []reflect.Type) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = conf.TypeString(t)
+	}
+	return "(" + strings.Join(s, ", ") + ")"
+}
+
+// constValue returns value of literal node.
+func constValue(node ast.Node) (interface{}, bool) {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return nil, true
+	case *ast.IntegerNode:
+		return n.Value, true
+	case *ast.FloatNode:
+		return n.Value, true
+	case *ast.BoolNode:
+		return n.Value, true
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.ConstantNode:
+		return n.Value, true
+	}
+	return nil, false
+}
+
+// nodePath returns path of identifier or member access chain, like "foo.bar".
+func nodePath(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return n.Value, true
+	case *ast.ChainNode:
+		return nodePath(n.Node)
+	case *ast.MemberNode:
+		if name, ok := n.Property.(*ast.StringNode); ok {
+			if base, ok := nodePath(n.Node); ok {
+				return base + "." + name.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+var typeTestFuncs = map[string]reflect.Type{
+	"types.isNil":    nilType,
+	"types.isString": stringType,
+	"types.isList":   arrayType,
+	"types.isMap":    mapType,
+}
+
+var typeNames = map[string]reflect.Type{
+	"nil":    nilType,
+	"bool":   boolType,
+	"int":    integerType,
+	"float":  floatType,
+	"string": stringType,
+	"array":  arrayType,
+	"map":    mapType,
+}
+
+// typeTests returns narrowing proven by a condition if it is true.
+func typeTests(cond ast.Node) []narrowing {
+	switch n := cond.(type) {
+	case *ast.CallNode:
+		if n.Func == nil || len(n.Arguments) != 1 {
+			return nil
+		}
+		if t, ok := typeTestFuncs[n.Func.Name]; ok {
+			if path, ok := nodePath(n.Arguments[0]); ok {
+				return []narrowing{{path: path, t: t}}
+			}
+		}
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "and", "&&":
+			return append(typeTests(n.Left), typeTests(n.Right)...)
+		case "==":
+			call, ok := n.Left.(*ast.CallNode)
+			name, ok2 := n.Right.(*ast.StringNode)
+			if !ok || !ok2 {
+				call, ok = n.Right.(*ast.CallNode)
+				name, ok2 = n.Left.(*ast.StringNode)
+			}
+			if !ok || !ok2 || call.Func == nil || call.Func.Name != "types.of" || len(call.Arguments) != 1 {
+				return nil
+			}
+			if t, ok := typeNames[name.Value]; ok {
+				if path, ok := nodePath(call.Arguments[0]); ok {
+					return []narrowing{{path: path, t: t}}
+				}
+			}
+		}
+	}
+	return nil
+}
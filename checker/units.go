@@ -0,0 +1,300 @@
+package checker
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// unit is a unit of measure, like m/s^2, given by exponents of base units.
+// Values without units, like literals, are nil units, which adapt to units
+// of other operands.
+type unit map[string]int
+
+// parseUnit parses units, like "m", "m/s", "kg*m/s^2" or "1/s". All terms
+// after the first slash are denominators.
+func parseUnit(s string) (unit, error) {
+	u := make(unit)
+	for i, part := range strings.Split(s, "/") {
+		sign := 1
+		if i > 0 {
+			sign = -1
+		}
+		terms := strings.FieldsFunc(part, func(r rune) bool { return r == '*' || r == ' ' })
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid unit %q", s)
+		}
+		for _, term := range terms {
+			if term == "1" {
+				continue
+			}
+			name, exp := term, 1
+			if j := strings.IndexByte(term, '^'); j >= 0 {
+				n, err := strconv.Atoi(term[j+1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid unit %q", s)
+				}
+				name, exp = term[:j], n
+			}
+			if name == "" || strings.ContainsAny(name, "^()") {
+				return nil, fmt.Errorf("invalid unit %q", s)
+			}
+			u[name] += sign * exp
+		}
+	}
+	return u.normalized(), nil
+}
+
+func (u unit) normalized() unit {
+	for name, exp := range u {
+		if exp == 0 {
+			delete(u, name)
+		}
+	}
+	return u
+}
+
+func (u unit) String() string {
+	var num, den []string
+	for name, exp := range u {
+		switch {
+		case exp == 1:
+			num = append(num, name)
+		case exp > 1:
+			num = append(num, fmt.Sprintf("%v^%v", name, exp))
+		case exp == -1:
+			den = append(den, name)
+		default:
+			den = append(den, fmt.Sprintf("%v^%v", name, -exp))
+		}
+	}
+	sort.Strings(num)
+	sort.Strings(den)
+	s := strings.Join(num, "*")
+	if s == "" {
+		s = "1"
+	}
+	if len(den) > 0 {
+		s += "/" + strings.Join(den, "*")
+	}
+	return s
+}
+
+func (u unit) equal(other unit) bool {
+	if len(u) != len(other) {
+		return false
+	}
+	for name, exp := range u {
+		if other[name] != exp {
+			return false
+		}
+	}
+	return true
+}
+
+// mul returns the product of units raised to powers a and b.
+func mul(x unit, a int, y unit, b int) unit {
+	if x == nil && y == nil {
+		return nil
+	}
+	u := make(unit)
+	for name, exp := range x {
+		u[name] += a * exp
+	}
+	for name, exp := range y {
+		u[name] += b * exp
+	}
+	return u.normalized()
+}
+
+// checkUnits checks units of measure of numbers of the checked tree. Units
+// of fields are given by struct tags, like `unit:"m/s"`, or by paths of
+// fields in Config.Units. Operands of +, - and comparisons must have equal
+// units, and * and / derive units of results.
+func checkUnits(tree *parser.Tree, config *conf.Config) *file.Error {
+	uc := &unitChecker{
+		config: config,
+		units:  make(map[ast.Node]unit),
+		bound:  make(map[string]bool),
+	}
+	ast.Walk(&tree.Node, binds(uc.bound))
+	ast.Walk(&tree.Node, uc)
+	return uc.err
+}
+
+// binds collects names of variables, which shadow fields of the
+// environment.
+type binds map[string]bool
+
+func (b binds) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.BindNode:
+		for _, name := range n.Names {
+			b[name] = true
+		}
+	case *ast.ComprehensionNode:
+		b[n.Name] = true
+	}
+}
+
+type unitChecker struct {
+	config *conf.Config
+	units  map[ast.Node]unit
+	bound  map[string]bool
+	err    *file.Error
+}
+
+func (uc *unitChecker) error(node ast.Node, format string, args ...interface{}) {
+	if uc.err == nil {
+		uc.err = &file.Error{
+			Location: node.Location(),
+			Message:  fmt.Sprintf(format, args...),
+		}
+	}
+}
+
+func (uc *unitChecker) Visit(node *ast.Node) {
+	if uc.err != nil {
+		return
+	}
+	var u unit
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if !uc.bound[n.Value] {
+			u = uc.fieldUnit(n, n.Value, reflect.TypeOf(uc.config.Env), uc.config.Types[n.Value].FieldIndex)
+		}
+
+	case *ast.MemberNode:
+		if name, ok := n.Property.(*ast.StringNode); ok {
+			path, _ := nodePath(n)
+			base := dereferenceValue(n.Node.Type())
+			var index []int
+			if base != nil && base.Kind() == reflect.Struct {
+				index = conf.FieldsFromStruct(base)[name.Value].FieldIndex
+			}
+			u = uc.fieldUnit(n, path, base, index)
+		}
+
+	case *ast.ChainNode:
+		u = uc.units[n.Node]
+
+	case *ast.SharedNode:
+		u = uc.units[n.Node]
+
+	case *ast.UnaryNode:
+		u = uc.units[n.Node]
+
+	case *ast.ConditionalNode:
+		u = uc.same(n, "?:", uc.units[n.Exp1], uc.units[n.Exp2])
+
+	case *ast.BinaryNode:
+		l, r := uc.units[n.Left], uc.units[n.Right]
+		switch n.Operator {
+		case "+", "-", "%":
+			u = uc.same(n, n.Operator, l, r)
+		case "==", "!=", "<", ">", "<=", ">=":
+			uc.same(n, n.Operator, l, r)
+		case "*":
+			u = mul(l, 1, r, 1)
+		case "/":
+			u = mul(l, 1, r, -1)
+		case "**", "^":
+			if r != nil {
+				uc.error(n, "invalid operation: %v (exponent has unit %v)", n.Operator, r)
+			} else if l != nil {
+				exp, ok := n.Right.(*ast.IntegerNode)
+				if !ok {
+					uc.error(n, "invalid operation: %v (unit %v raised to non-integer power)", n.Operator, l)
+					return
+				}
+				u = mul(l, exp.Value, nil, 0)
+			}
+		}
+
+	case *ast.CallNode:
+		u = uc.call(n)
+	}
+	if u != nil {
+		uc.units[*node] = u
+	}
+}
+
+// fieldUnit returns the unit of the field of the path, given by options, or
+// by the struct tag of the field of struct t at the index.
+func (uc *unitChecker) fieldUnit(node ast.Node, path string, t reflect.Type, index []int) unit {
+	s, ok := uc.config.Units[path]
+	if !ok {
+		if t = dereferenceValue(t); t == nil || t.Kind() != reflect.Struct || len(index) == 0 {
+			return nil
+		}
+		s = t.FieldByIndex(index).Tag.Get("unit")
+	}
+	if s == "" {
+		return nil
+	}
+	u, err := parseUnit(s)
+	if err != nil {
+		uc.error(node, "%v of %v", err, path)
+		return nil
+	}
+	return u
+}
+
+// same returns the unit of operands, which must be equal, if both are
+// known.
+func (uc *unitChecker) same(node ast.Node, operator string, l, r unit) unit {
+	if l != nil && r != nil && !l.equal(r) {
+		uc.error(node, "invalid operation: %v (mismatched units %v and %v)", operator, l, r)
+		return nil
+	}
+	if l != nil {
+		return l
+	}
+	return r
+}
+
+// call returns units of results of math builtins, which keep units of
+// arguments.
+func (uc *unitChecker) call(node *ast.CallNode) unit {
+	if node.Func == nil || len(node.Arguments) == 0 {
+		return nil
+	}
+	u := uc.units[node.Arguments[0]]
+	switch node.Func.Name {
+	case "math.abs", "math.ceil", "math.floor", "math.round":
+		return u
+	case "math.min", "math.max":
+		for _, arg := range node.Arguments[1:] {
+			u = uc.same(node, node.Func.Name, u, uc.units[arg])
+		}
+		return u
+	case "math.sqrt":
+		if u == nil {
+			return nil
+		}
+		root := make(unit)
+		for name, exp := range u {
+			if exp%2 != 0 {
+				uc.error(node, "invalid argument for math.sqrt (unit %v)", u)
+				return nil
+			}
+			root[name] = exp / 2
+		}
+		return root
+	}
+	return nil
+}
+
+func dereferenceValue(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,200 @@
+package checker
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// Warnings returns non-fatal diagnostics of a checked tree: comparisons which
+// are always true or false, integers implicitly converted to floats, closures
+// which do not use their argument, variables of let which are not used, and
+// identifiers shadowing builtins.
+func Warnings(tree *parser.Tree, config *conf.Config) []*file.Error {
+	if config == nil {
+		config = conf.New(nil)
+	}
+	l := &linter{config: config}
+	ast.Walk(&tree.Node, l)
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		a, b := l.warnings[i].Location, l.warnings[j].Location
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	for _, w := range l.warnings {
+		if config.Translator != nil {
+			w.Translate(config.Translator)
+		}
+		w.Bind(tree.Source)
+	}
+	return l.warnings
+}
+
+type linter struct {
+	config   *conf.Config
+	warnings []*file.Error
+}
+
+func (l *linter) warn(node ast.Node, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, file.Errorf(node.Location(), format, args...))
+}
+
+func (l *linter) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if _, ok := l.config.Types[n.Value]; ok && l.isBuiltin(n.Value) {
+			l.warn(n, "%v shadows builtin", n.Value)
+		}
+
+	case *ast.IntegerNode:
+		if t := n.Type(); t != nil && isFloat(t) {
+			l.warn(n, "integer %v is implicitly converted to %v", n.Value, t)
+		}
+
+	case *ast.ClosureNode:
+		if !usesPointer(n) {
+			l.warn(n, "closure does not use its argument #")
+		}
+
+	case *ast.BinaryNode:
+		if result, ok := comparison(n); ok {
+			l.warn(n, "comparison is always %v", result)
+		}
+
+	case *ast.BindNode:
+		for _, name := range n.Names {
+			if name != "_" && !usesVariable(n.Body, name) {
+				l.warn(n, "variable %v is unused", name)
+			}
+		}
+	}
+}
+
+// usesVariable reports whether the node uses the variable of the name, which
+// is not shadowed by variables of the same name of nested bindings.
+func usesVariable(node ast.Node, name string) bool {
+	switch n := node.(type) {
+	case *ast.VariableNode:
+		return n.Name == name
+	case *ast.BindNode:
+		if usesVariable(n.Value, name) {
+			return true
+		}
+		for _, b := range n.Names {
+			if b == name {
+				return false
+			}
+		}
+		return usesVariable(n.Body, name)
+	case *ast.ComprehensionNode:
+		if usesVariable(n.Items, name) {
+			return true
+		}
+		if n.Name == name {
+			return false
+		}
+	}
+	for _, child := range ast.Children(node) {
+		if usesVariable(*child, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBuiltin reports whether name is a builtin function or a namespace of
+// builtin functions.
+func (l *linter) isBuiltin(name string) bool {
+	if _, ok := l.config.Functions[name]; ok {
+		return true
+	}
+	for fn := range l.config.Functions {
+		if strings.HasPrefix(fn, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// comparison returns result of a comparison, if it does not depend on
+// values of the environment.
+func comparison(n *ast.BinaryNode) (bool, bool) {
+	switch n.Operator {
+	case "==", "!=", "<", ">", "<=", ">=":
+	default:
+		return false, false
+	}
+	negate := n.Operator == "!=" || n.Operator == "<" || n.Operator == ">"
+
+	left, leftOk := constValue(n.Left)
+	right, rightOk := constValue(n.Right)
+	if leftOk && rightOk {
+		if n.Operator != "==" && n.Operator != "!=" {
+			return false, false
+		}
+		return runtime.Equal(left, right) != negate, true
+	}
+
+	// Floats are excluded, as NaN is not equal to itself, and so are values
+	// of unknown types.
+	if t := n.Left.Type(); t == nil || isFloat(t) || isAny(t) {
+		return false, false
+	}
+	if hasCalls(n.Left) || ast.Dump(n.Left) != ast.Dump(n.Right) {
+		return false, false
+	}
+	return !negate, true
+}
+
+func hasCalls(node ast.Node) bool {
+	c := &calls{}
+	ast.Walk(&node, c)
+	return c.found
+}
+
+type calls struct {
+	found bool
+}
+
+func (c *calls) Visit(node *ast.Node) {
+	switch (*node).(type) {
+	case *ast.CallNode, *ast.BuiltinNode:
+		c.found = true
+	}
+}
+
+// usesPointer reports whether body of the closure uses # of the closure,
+// not of closures nested in it.
+func usesPointer(closure *ast.ClosureNode) bool {
+	all := &pointers{nodes: map[*ast.PointerNode]bool{}}
+	ast.Walk(&closure.Node, all)
+	for _, nested := range all.closures {
+		inner := &pointers{nodes: map[*ast.PointerNode]bool{}}
+		ast.Walk(&nested.Node, inner)
+		for p := range inner.nodes {
+			delete(all.nodes, p)
+		}
+	}
+	return len(all.nodes) > 0
+}
+
+type pointers struct {
+	nodes    map[*ast.PointerNode]bool
+	closures []*ast.ClosureNode
+}
+
+func (p *pointers) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.PointerNode:
+		p.nodes[n] = true
+	case *ast.ClosureNode:
+		p.closures = append(p.closures, n)
+	}
+}
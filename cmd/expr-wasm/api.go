@@ -0,0 +1,176 @@
+// Command expr-wasm exposes parse, check, format and complete of expressions
+// to JavaScript, when built with GOOS=js GOARCH=wasm:
+//
+//	GOOS=js GOARCH=wasm go build -o expr.wasm ./cmd/expr-wasm
+//
+// Functions are set on globalThis.__expr and return JSON, which is parsed by
+// the wrapper in expr.js. Environments are given as schemas, the JSON of
+// docgen.Context.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/completion"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/docgen"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Error of expression. From and To are offsets in UTF-16 code units, like
+// indexes of strings of JavaScript.
+type Error struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+}
+
+// Result of parse, check and format.
+type Result struct {
+	Type     string  `json:"type,omitempty"`
+	Source   string  `json:"source,omitempty"`
+	Error    *Error  `json:"error"`
+	Warnings []Error `json:"warnings,omitempty"`
+}
+
+// Completion is completion.Result with offsets in UTF-16 code units.
+type Completion struct {
+	From       int                    `json:"from"`
+	To         int                    `json:"to"`
+	Candidates []completion.Candidate `json:"candidates"`
+	Error      *Error                 `json:"error"`
+}
+
+func parse(source string) Result {
+	_, err := parser.Parse(source)
+	return Result{Error: errorOf(source, err)}
+}
+
+func check(source, schema string) Result {
+	config, err := configOf(schema)
+	if err != nil {
+		return Result{Error: errorOf(source, err)}
+	}
+	tree, err := parser.ParseWithOptions(source, config.ParserOptions())
+	if err != nil {
+		return Result{Error: errorOf(source, err)}
+	}
+	t, err := checker.Check(tree, config)
+	if err != nil {
+		return Result{Error: errorOf(source, err)}
+	}
+	result := Result{Type: "interface {}"}
+	if t != nil {
+		result.Type = t.String()
+	}
+	for _, w := range checker.Warnings(tree, config) {
+		result.Warnings = append(result.Warnings, *errorOf(source, w))
+	}
+	return result
+}
+
+func format(source string) Result {
+	tree, err := parser.Parse(source)
+	if err != nil {
+		return Result{Error: errorOf(source, err)}
+	}
+	return Result{Source: parser.Format(tree.Node)}
+}
+
+func complete(source string, offset int, schema string) Completion {
+	config, err := configOf(schema)
+	if err != nil {
+		return Completion{Candidates: []completion.Candidate{}, Error: errorOf(source, err)}
+	}
+	result := completion.CompleteWithConfig(source, byteOffset(source, offset), config)
+	candidates := result.Candidates
+	if candidates == nil {
+		candidates = []completion.Candidate{}
+	}
+	return Completion{
+		From:       utf16Offset(source, result.From),
+		To:         utf16Offset(source, result.To),
+		Candidates: candidates,
+	}
+}
+
+// configOf returns config with environment of schema, which is JSON of
+// docgen.Context. Empty schema has no environment.
+func configOf(schema string) (*conf.Config, error) {
+	config := conf.CreateNew()
+	if strings.TrimSpace(schema) == "" {
+		return config, nil
+	}
+	var context docgen.Context
+	if err := json.Unmarshal([]byte(schema), &context); err != nil {
+		return nil, errors.New("invalid schema: " + err.Error())
+	}
+	expr.Env(context.Env())(config)
+	return config, nil
+}
+
+// errorOf returns error with range of the token at location of err, if any.
+func errorOf(source string, err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var fileError *file.Error
+	if !errors.As(err, &fileError) {
+		return &Error{Message: err.Error()}
+	}
+	e := &Error{
+		Message: fileError.Message,
+		Line:    fileError.Location.Line,
+		Column:  fileError.Location.Column,
+	}
+	lines := strings.SplitAfter(source, "\n")
+	line := fileError.Location.Line - 1
+	if line < 0 || line >= len(lines) {
+		return e
+	}
+	start := len(strings.Join(lines[:line], ""))
+	text := strings.TrimSuffix(lines[line], "\n")
+	runes := []rune(text)
+	from, to := file.Span(text, fileError.Location.Column)
+	if from > len(runes) {
+		from = len(runes)
+	}
+	if to > len(runes) {
+		to = len(runes)
+	}
+	e.From = utf16Offset(source, start+len(string(runes[:from])))
+	e.To = utf16Offset(source, start+len(string(runes[:to])))
+	return e
+}
+
+// utf16Offset converts offset in bytes to offset in UTF-16 code units.
+func utf16Offset(source string, offset int) int {
+	units := 0
+	for i, r := range source {
+		if i >= offset {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return units
+}
+
+// byteOffset converts offset in UTF-16 code units to offset in bytes.
+func byteOffset(source string, offset int) int {
+	units := 0
+	for i, r := range source {
+		if units >= offset {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(source)
+}
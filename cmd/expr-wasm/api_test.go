@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/antonmedv/expr/docgen"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+type env struct {
+	User  user
+	Limit int
+}
+
+func schema(t *testing.T) string {
+	b, err := json.Marshal(docgen.CreateDoc(env{}))
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestParse(t *testing.T) {
+	require.Nil(t, parse(`a + b`).Error)
+	require.Equal(t, &Error{Message: "unexpected token EOF", Line: 1, Column: 2, From: 2, To: 3}, parse(`a +`).Error)
+}
+
+func TestCheck(t *testing.T) {
+	require.Equal(t, Result{Type: "bool"}, check(`User.Age > Limit`, schema(t)))
+	require.Equal(t, Result{Type: "interface {}"}, check(`foo`, ""))
+
+	result := check(`"ö" + User.Nme`, schema(t))
+	require.Equal(t, &Error{Message: "type struct { Age int; Name string } has no field Nme, did you mean Name?", Line: 1, Column: 11, From: 11, To: 14}, result.Error)
+
+	result = check(`foo`, schema(t))
+	require.Contains(t, result.Error.Message, "unknown name foo")
+
+	result = check(`User`, `{`)
+	require.Contains(t, result.Error.Message, "invalid schema")
+}
+
+func TestFormat(t *testing.T) {
+	require.Equal(t, Result{Source: "(a + b) * c"}, format(`(a+b)*c`))
+	require.NotNil(t, format(`(a`).Error)
+}
+
+func TestComplete(t *testing.T) {
+	// Offsets are in UTF-16 code units, ö and 😀 take one and two.
+	result := complete(`"ö😀" + User.Na`, 15, schema(t))
+	require.Nil(t, result.Error)
+	require.Equal(t, 13, result.From)
+	require.Equal(t, 15, result.To)
+	require.Equal(t, "Name", result.Candidates[0].Label)
+
+	result = complete(`12`, 2, "")
+	require.Equal(t, 0, len(result.Candidates))
+	require.NotNil(t, result.Candidates)
+}
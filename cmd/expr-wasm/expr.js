@@ -0,0 +1,48 @@
+// Thin wrapper of expr.wasm for browsers and Node.js. It requires
+// wasm_exec.js of Go, which defines global Go class:
+//
+//   cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Schemas are environments documented by docgen.CreateDoc, as objects or
+// JSON strings. Offsets are indexes of JavaScript strings.
+
+/**
+ * Loads expr.wasm from url, or from bytes of the module.
+ *
+ * @param {string|URL|BufferSource} source
+ * @returns {Promise<{
+ *   parse(source: string): Result,
+ *   check(source: string, schema?: object|string): Result,
+ *   format(source: string): Result,
+ *   complete(source: string, offset: number, schema?: object|string): Completion,
+ * }>}
+ */
+export async function load(source = new URL('expr.wasm', import.meta.url)) {
+  const go = new Go()
+  const {instance} = typeof source === 'string' || source instanceof URL
+    ? await WebAssembly.instantiateStreaming(fetch(source), go.importObject)
+    : await WebAssembly.instantiate(source, go.importObject)
+  go.run(instance)
+
+  const api = globalThis.__expr
+  delete globalThis.__expr
+  const json = schema => schema == null ? '' : typeof schema === 'string' ? schema : JSON.stringify(schema)
+
+  return {
+    // Reports syntax error of source, if any.
+    parse: source => JSON.parse(api.parse(source)),
+    // Reports type of result, error and warnings of source.
+    check: (source, schema) => JSON.parse(api.check(source, json(schema))),
+    // Returns source in canonical form.
+    format: source => JSON.parse(api.format(source)),
+    // Returns candidates for the word at offset.
+    complete: (source, offset, schema) => JSON.parse(api.complete(source, offset, json(schema))),
+  }
+}
+
+/**
+ * @typedef {{message: string, line?: number, column?: number, from: number, to: number}} Error
+ * @typedef {{type?: string, source?: string, error: Error|null, warnings?: Error[]}} Result
+ * @typedef {{label: string, kind: string, type?: string, doc?: string}} Candidate
+ * @typedef {{from: number, to: number, candidates: Candidate[], error: Error|null}} Completion
+ */
@@ -0,0 +1,39 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+)
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("parse", function(func(args []js.Value) interface{} {
+		return parse(args[0].String())
+	}))
+	api.Set("check", function(func(args []js.Value) interface{} {
+		return check(args[0].String(), args[1].String())
+	}))
+	api.Set("format", function(func(args []js.Value) interface{} {
+		return format(args[0].String())
+	}))
+	api.Set("complete", function(func(args []js.Value) interface{} {
+		return complete(args[0].String(), args[1].Int(), args[2].String())
+	}))
+	js.Global().Set("__expr", api)
+	select {}
+}
+
+// function returns JavaScript function, which returns JSON of results of fn.
+// Missing arguments are undefined.
+func function(fn func(args []js.Value) interface{}) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		for len(args) < 3 {
+			args = append(args, js.Undefined())
+		}
+		b, _ := json.Marshal(fn(args))
+		return string(b)
+	})
+}
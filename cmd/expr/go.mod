@@ -0,0 +1,16 @@
+module github.com/antonmedv/expr/cmd/expr
+
+go 1.13
+
+require (
+	github.com/antonmedv/expr v1.10.0
+	github.com/antonmedv/expr/exprtest v1.10.0
+	github.com/antonmedv/expr/repl v1.10.0
+	github.com/stretchr/testify v1.8.0
+)
+
+replace (
+	github.com/antonmedv/expr => ../../
+	github.com/antonmedv/expr/exprtest => ../../exprtest
+	github.com/antonmedv/expr/repl => ../../repl
+)
@@ -0,0 +1,426 @@
+// Command expr checks, evaluates, formats and disassembles expressions.
+//
+// Usage:
+//
+//	expr <command> [flags] [expression]
+//
+// Commands:
+//
+//	check    type-check expression and print type of result
+//	run      evaluate expression with environment read from standard input
+//	ast      print tree of expression
+//	asm      print bytecode of compiled expression
+//	fmt      print expression in canonical form
+//	repl     evaluate expressions interactively
+//	lsp      serve Language Server Protocol on standard input and output
+//	grammar  print TextMate or Monarch grammar of highlighting
+//	cover    report branches of expression files not reached by environments
+//	mutate   report mutants of expressions surviving their exprtest suites
+//	compat   report differences of results from a corpus of recorded results
+//
+// Expression is given as arguments, with -file, or on standard input, except
+// for run, which reads the environment from standard input. Environments are
+// JSON or YAML files. Whole numbers of JSON files are decoded as integers.
+//
+// The repl command evaluates lines of standard input with the environment of
+// -env. On terminal, lines are edited with history and completion by Tab, and
+// history is kept in the file of -history. The lsp command checks documents
+// of editors with the environment of -env. The grammar command prints grammar
+// of -format textmate or monarch, generated from tables of the lexer. The
+// cover command evaluates expression files given as arguments with every
+// environment of -input, one JSON object per line, and fails if a branch of an
+// expression is not reached. The mutate command runs exprtest suites given as
+// arguments with mutants of their expressions, like >= replaced by >, and
+// fails if a mutant passes all cases of its suite. The compat command
+// evaluates expressions of the corpus of -input, one JSON object per line
+// with an expression, an environment and the result recorded with an earlier
+// release, and fails if results differ. With -record, it prints the corpus
+// with results of the current build instead.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/coverage"
+	"github.com/antonmedv/expr/exprtest"
+	"github.com/antonmedv/expr/highlight"
+	"github.com/antonmedv/expr/lsp"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/repl"
+)
+
+const usage = `usage: expr <command> [flags] [expression]
+
+commands:
+  check    type-check expression and print type of result
+  run      evaluate expression with environment read from standard input
+  ast      print tree of expression
+  asm      print bytecode of compiled expression
+  fmt      print expression in canonical form
+  repl     evaluate expressions interactively
+  lsp      serve Language Server Protocol on standard input and output
+  grammar  print TextMate or Monarch grammar of highlighting
+  cover    report branches of expression files not reached by environments
+  mutate   report mutants of expressions surviving their exprtest suites
+  compat   report differences of results from a corpus of recorded results
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// errUsage is returned on invalid arguments.
+var errUsage = errors.New("invalid usage")
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("expr "+command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	envFile := flags.String("env", "", "JSON or YAML file with environment, used to check types")
+	codeFile := flags.String("file", "", "file with expression")
+	inputFile := flags.String("input", "", "JSON or YAML file with environment of run, instead of standard input")
+	optimize := flags.Bool("optimize", true, "optimize compiled program")
+	historyFile := flags.String("history", "", "file to keep history of repl")
+	format := flags.String("format", "textmate", "format of grammar: textmate or monarch")
+	record := flags.Bool("record", false, "print corpus of compat with results of the current build")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr, optimize: *optimize}
+	var err error
+	switch command {
+	case "check", "run", "ast", "asm", "fmt":
+		err = c.exec(command, flags.Args(), *envFile, *codeFile, *inputFile)
+	case "repl":
+		err = c.repl(*envFile, *historyFile)
+	case "lsp":
+		err = c.lsp(*envFile)
+	case "grammar":
+		err = c.grammar(*format)
+	case "cover":
+		err = c.cover(flags.Args(), *envFile, *inputFile)
+	case "mutate":
+		err = c.mutate(flags.Args(), *envFile)
+	case "compat":
+		err = c.compat(*inputFile, *record)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %v\n%v", command, usage)
+		return 2
+	}
+	if err == errUsage {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%+v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	optimize       bool
+}
+
+func (c *cli) exec(command string, args []string, envFile, codeFile, inputFile string) error {
+	var env interface{}
+	if envFile != "" {
+		var err error
+		if env, err = repl.LoadEnv(envFile); err != nil {
+			return err
+		}
+	}
+
+	code, err := c.code(args, codeFile, command != "run" || inputFile != "")
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "fmt":
+		tree, err := parser.Parse(code)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stdout, parser.Format(tree.Node))
+
+	case "ast":
+		tree, err := parser.Parse(code)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stdout, ast.Dump(tree.Node))
+
+	case "check":
+		config := conf.CreateNew()
+		for _, op := range c.options(env) {
+			op(config)
+		}
+		tree, err := parser.ParseWithOptions(code, config.ParserOptions())
+		if err != nil {
+			return err
+		}
+		t, err := checker.Check(tree, config)
+		if err != nil {
+			return err
+		}
+		for _, w := range checker.Warnings(tree, config) {
+			fmt.Fprintf(c.stderr, "warning: %v\n", w)
+		}
+		if t == nil {
+			fmt.Fprintln(c.stdout, "interface {}")
+		} else {
+			fmt.Fprintln(c.stdout, t)
+		}
+
+	case "asm":
+		program, err := expr.Compile(code, c.options(env)...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(c.stdout, program.Disassemble())
+
+	case "run":
+		var input map[string]interface{}
+		if inputFile != "" {
+			input, err = repl.LoadEnv(inputFile)
+		} else {
+			input, err = repl.ReadEnv(c.stdin)
+		}
+		if err != nil {
+			return err
+		}
+		if env == nil {
+			env = input
+		}
+		program, err := expr.Compile(code, c.options(env)...)
+		if err != nil {
+			return err
+		}
+		out, err := expr.Run(program, input)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(out)
+		if err != nil {
+			fmt.Fprintln(c.stdout, out)
+		} else {
+			fmt.Fprintln(c.stdout, string(b))
+		}
+	}
+	return nil
+}
+
+func (c *cli) repl(envFile, historyFile string) error {
+	r := repl.New(nil, expr.Optimize(c.optimize))
+	r.HistoryFile = historyFile
+	if envFile != "" {
+		env, err := repl.LoadEnv(envFile)
+		if err != nil {
+			return err
+		}
+		r.Env = env
+	}
+	terminal := false
+	if f, ok := c.stdin.(*os.File); ok {
+		if restore, err := makeRaw(f); err == nil {
+			defer restore()
+			terminal = true
+		}
+	}
+	return r.Run(c.stdin, c.stdout, terminal)
+}
+
+func (c *cli) lsp(envFile string) error {
+	var env interface{}
+	if envFile != "" {
+		var err error
+		if env, err = repl.LoadEnv(envFile); err != nil {
+			return err
+		}
+	}
+	return lsp.NewServer(env).Serve(c.stdin, c.stdout)
+}
+
+func (c *cli) grammar(format string) error {
+	switch format {
+	case "textmate":
+		_, err := c.stdout.Write(highlight.TextMate())
+		return err
+	case "monarch":
+		_, err := c.stdout.Write(highlight.Monarch())
+		return err
+	}
+	return fmt.Errorf("unknown format of grammar %v", format)
+}
+
+func (c *cli) cover(files []string, envFile, inputFile string) error {
+	if len(files) == 0 || inputFile == "" {
+		return errUsage
+	}
+	var env interface{}
+	if envFile != "" {
+		var err error
+		if env, err = repl.LoadEnv(envFile); err != nil {
+			return err
+		}
+	}
+	report := coverage.NewReport()
+	for _, file := range files {
+		code, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		program, err := expr.Compile(string(code), c.options(env)...)
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		report.Add(file, program)
+	}
+
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		input, err := repl.ReadEnv(strings.NewReader(scanner.Text()))
+		if err != nil {
+			return fmt.Errorf("%v:%v: %v", inputFile, line, err)
+		}
+		for _, file := range files {
+			// Errors of evaluation are part of the corpus, branches before
+			// them are reached.
+			_, _ = report.Run(file, input)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.stdout, report)
+	if names, _ := report.Uncovered(); len(names) > 0 {
+		return fmt.Errorf("branches of %v are not covered", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func (c *cli) mutate(files []string, envFile string) error {
+	if len(files) == 0 {
+		return errUsage
+	}
+	var env interface{}
+	if envFile != "" {
+		var err error
+		if env, err = repl.LoadEnv(envFile); err != nil {
+			return err
+		}
+	}
+	var survived []string
+	for _, file := range files {
+		suite, err := exprtest.Load(file)
+		if err != nil {
+			return err
+		}
+		suite.Options = c.options(env)
+		mutants, err := suite.Mutate()
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		killed := 0
+		for _, m := range mutants {
+			if m.Killed() {
+				killed++
+			}
+		}
+		fmt.Fprintf(c.stdout, "%v: %v of %v mutants killed\n", file, killed, len(mutants))
+		for _, m := range mutants {
+			if !m.Killed() {
+				fmt.Fprintf(c.stdout, "  survived %v\n", m)
+			}
+		}
+		if killed < len(mutants) {
+			survived = append(survived, file)
+		}
+	}
+	if len(survived) > 0 {
+		return fmt.Errorf("mutants of %v survived", strings.Join(survived, ", "))
+	}
+	return nil
+}
+
+func (c *cli) compat(inputFile string, record bool) error {
+	if inputFile == "" {
+		return errUsage
+	}
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entries, err := exprtest.ReadCorpus(f)
+	if err != nil {
+		return fmt.Errorf("%v: %v", inputFile, err)
+	}
+	if record {
+		return exprtest.WriteCorpus(c.stdout, exprtest.Record(entries, expr.Optimize(c.optimize)))
+	}
+	report := exprtest.Replay(entries, expr.Optimize(c.optimize))
+	fmt.Fprint(c.stdout, report)
+	if len(report.Diffs) > 0 {
+		return fmt.Errorf("%v of %v entries of %v differ", len(report.Diffs), report.Entries, inputFile)
+	}
+	return nil
+}
+
+func (c *cli) options(env interface{}) []expr.Option {
+	ops := []expr.Option{expr.Optimize(c.optimize)}
+	if env != nil {
+		ops = append(ops, expr.Env(env))
+	}
+	return ops
+}
+
+// code returns expression from arguments, from the file, or from standard
+// input, if it may be read.
+func (c *cli) code(args []string, file string, stdin bool) (string, error) {
+	switch {
+	case file != "":
+		b, err := ioutil.ReadFile(file)
+		return string(b), err
+	case len(args) > 0:
+		return strings.Join(args, " "), nil
+	case stdin:
+		b, err := ioutil.ReadAll(c.stdin)
+		return string(b), err
+	}
+	return "", errUsage
+}
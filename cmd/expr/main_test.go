@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func exec(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_run(t *testing.T) {
+	code, out, errOut := exec(t, `{"user": {"name": "bob", "age": 30}, "tags": ["a", "b"]}`,
+		"run", `{name: user.name, adult: user.age >= 18, tag: tags[user.age % 2]}`)
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, `{"adult":true,"name":"bob","tag":"a"}`+"\n", out)
+}
+
+func TestRun_run_error(t *testing.T) {
+	code, _, errOut := exec(t, `{"n": 0}`, "run", `1 % n`)
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "integer divide by zero")
+}
+
+func TestRun_check(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	env := filepath.Join(dir, "env.yaml")
+	require.NoError(t, ioutil.WriteFile(env, []byte("name: bob\nage: 30\n"), 0644))
+
+	code, out, errOut := exec(t, "", "check", "-env", env, `age + 1`)
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "int\n", out)
+
+	code, _, errOut = exec(t, "", "check", "-env", env, `name + 1`)
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "error: invalid operation: + (mismatched types string and int)")
+	require.Contains(t, errOut, "1 | name + 1")
+
+	code, out, errOut = exec(t, "1 == 1.0", "check")
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "bool\n", out)
+	require.Contains(t, errOut, "warning: comparison is always true")
+}
+
+func TestRun_fmt(t *testing.T) {
+	code, out, errOut := exec(t, "", "fmt", `(a+b)*c`, `&&`, `not(d in e)`)
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "(a + b) * c && d not in e\n", out)
+
+	code, _, errOut = exec(t, "", "fmt", `a +`)
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "unexpected token EOF")
+}
+
+func TestRun_ast(t *testing.T) {
+	code, out, errOut := exec(t, "-x", "ast")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, `Operator: "-"`)
+	require.Contains(t, out, `IdentifierNode{`)
+}
+
+func TestRun_asm(t *testing.T) {
+	code, out, errOut := exec(t, "", "asm", "-optimize=false", `1 + 2`)
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, "OpAdd")
+
+	code, out, errOut = exec(t, "", "asm", `1 + 2`)
+	require.Equal(t, 0, code, errOut)
+	require.NotContains(t, out, "OpAdd")
+}
+
+func TestRun_usage(t *testing.T) {
+	code, _, errOut := exec(t, "")
+	require.Equal(t, 2, code)
+	require.Contains(t, errOut, "usage: expr")
+
+	code, _, errOut = exec(t, "", "eval", "1")
+	require.Equal(t, 2, code)
+	require.Contains(t, errOut, "unknown command eval")
+
+	code, _, _ = exec(t, "{}", "run")
+	require.Equal(t, 2, code)
+}
+
+func TestRun_repl(t *testing.T) {
+	code, out, errOut := exec(t, "1 + 2\nfoo\n", "repl")
+	require.Equal(t, 0, code, errOut)
+	require.True(t, strings.HasPrefix(out, "> 3\n> "), out)
+	require.Contains(t, out, "cannot fetch foo")
+}
+
+func TestRun_lsp(t *testing.T) {
+	body := `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`
+	stdin := "Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+	code, out, errOut := exec(t, stdin, "lsp")
+	require.Equal(t, 0, code, errOut)
+	require.True(t, strings.HasPrefix(out, "Content-Length: "), out)
+	require.Contains(t, out, `"hoverProvider":true`)
+}
+
+func TestRun_grammar(t *testing.T) {
+	code, out, errOut := exec(t, "", "grammar")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, `"scopeName": "source.expr"`)
+
+	code, out, errOut = exec(t, "", "grammar", "-format", "monarch")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, `"tokenPostfix": ".expr"`)
+
+	code, _, errOut = exec(t, "", "grammar", "-format", "vim")
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "unknown format of grammar vim")
+}
+
+func TestRun_cover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rule := filepath.Join(dir, "rule.expr")
+	require.NoError(t, ioutil.WriteFile(rule, []byte(`age >= 18 ? "adult" : "minor"`), 0644))
+	input := filepath.Join(dir, "corpus.jsonl")
+	require.NoError(t, ioutil.WriteFile(input, []byte("{\"age\": 30}\n\n{\"age\": 40}\n"), 0644))
+
+	code, out, errOut := exec(t, "", "cover", "-input", input, rule)
+	require.Equal(t, 1, code)
+	require.Equal(t, rule+": 50.0% of 2 branches\n  missed 1:23 else \"minor\"\n", out)
+	require.Contains(t, errOut, "branches of "+rule+" are not covered")
+
+	require.NoError(t, ioutil.WriteFile(input, []byte("{\"age\": 30}\n{\"age\": 10}\n"), 0644))
+	code, out, errOut = exec(t, "", "cover", "-input", input, rule)
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, rule+": 100.0% of 2 branches\n", out)
+
+	code, _, _ = exec(t, "", "cover", rule)
+	require.Equal(t, 2, code)
+}
+
+func TestRun_mutate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	suite := filepath.Join(dir, "rule.yaml")
+	require.NoError(t, ioutil.WriteFile(suite, []byte(`
+expression: age >= 18
+cases:
+  - {name: adult, env: {age: 30}, want: true}
+  - {name: minor, env: {age: 10}, want: false}
+`), 0644))
+	code, out, errOut := exec(t, "", "mutate", suite)
+	require.Equal(t, 1, code)
+	require.Equal(t, suite+": 1 of 4 mutants killed\n"+
+		"  survived 1:5 >= -> >: age > 18\n"+
+		"  survived 1:8 18 -> 19: age >= 19\n"+
+		"  survived 1:8 18 -> 17: age >= 17\n", out)
+	require.Contains(t, errOut, "mutants of "+suite+" survived")
+}
+
+func TestRun_compat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "corpus.jsonl")
+	require.NoError(t, ioutil.WriteFile(input, []byte(`{"id": "adult", "expression": "age >= 18", "env": {"age": 30}}
+{"id": "half", "expression": "age / 2", "env": {"age": 30}}
+`), 0644))
+
+	code, out, errOut := exec(t, "", "compat", "-record", "-input", input)
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, `{"id":"adult","expression":"age >= 18","env":{"age":30},"want":true,"type":"bool"}
+{"id":"half","expression":"age / 2","env":{"age":30},"want":15,"type":"float64"}
+`, out)
+
+	require.NoError(t, ioutil.WriteFile(input, []byte(out), 0644))
+	code, out, errOut = exec(t, "", "compat", "-input", input)
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "0 of 2 entries differ\n", out)
+
+	require.NoError(t, ioutil.WriteFile(input, []byte(`{"id": "half", "expression": "age / 2", "env": {"age": 30}, "want": 15, "type": "int"}`), 0644))
+	code, out, errOut = exec(t, "", "compat", "-input", input)
+	require.Equal(t, 1, code)
+	require.Equal(t, "1 of 1 entries differ: 1 type\n  half: type: want 15 (int), got 15 (float64)\n", out)
+	require.Contains(t, errOut, "1 of 1 entries of "+input+" differ")
+
+	code, _, _ = exec(t, "", "compat")
+	require.Equal(t, 2, code)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is supported on Linux only. Elsewhere repl reads plain lines.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw mode of terminal is not supported")
+}
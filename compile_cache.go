@@ -0,0 +1,115 @@
+package expr
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/vm"
+)
+
+// CompileCache is LRU cache of programs compiled with the same options,
+// keyed by sources and signatures of environments, like programs of filters
+// received with requests. It is safe for concurrent use.
+type CompileCache struct {
+	ops   []Option
+	mu    sync.Mutex
+	size  int
+	items map[compileKey]*list.Element
+	order *list.List
+	stats CompileCacheStats
+}
+
+// CompileCacheStats are counters of a CompileCache.
+type CompileCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Len is number of cached programs.
+	Len int
+}
+
+type compileKey struct {
+	source string
+	env    string
+}
+
+type compileEntry struct {
+	key     compileKey
+	program *vm.Program
+}
+
+// NewCompileCache creates cache holding up to size programs compiled with the
+// options.
+func NewCompileCache(size int, ops ...Option) *CompileCache {
+	return &CompileCache{
+		ops:   ops,
+		size:  size,
+		items: make(map[compileKey]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Compile returns the cached program of the source and the environment, or
+// compiles the source with options of the cache and expr.Env(env), if env is
+// not nil. Environments with the same signature, like maps with values of the
+// same types, share programs. Errors are not cached.
+func (c *CompileCache) Compile(source string, env interface{}) (*vm.Program, error) {
+	key := compileKey{source: source}
+	if env != nil {
+		key.env = conf.EnvSignature(env).Hash
+	}
+
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		c.stats.Hits++
+		c.mu.Unlock()
+		return e.Value.(*compileEntry).program, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// Sources are compiled without the lock, so concurrent misses of the
+	// same key may compile it twice.
+	ops := c.ops
+	if env != nil {
+		ops = append(ops[:len(ops):len(ops)], Env(env))
+	}
+	program, err := Compile(source, ops...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*compileEntry).program, nil
+	}
+	c.items[key] = c.order.PushFront(&compileEntry{key, program})
+	if c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*compileEntry).key)
+		c.stats.Evictions++
+	}
+	return program, nil
+}
+
+// Stats returns counters of the cache.
+func (c *CompileCache) Stats() CompileCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Len = c.order.Len()
+	return stats
+}
+
+// Purge removes all programs from the cache.
+func (c *CompileCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[compileKey]*list.Element)
+	c.order.Init()
+}
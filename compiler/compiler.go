@@ -1,13 +1,19 @@
 package compiler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
 	"github.com/antonmedv/expr/conf"
 	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/logging"
 	"github.com/antonmedv/expr/parser"
 	. "github.com/antonmedv/expr/vm"
 	"github.com/antonmedv/expr/vm/runtime"
@@ -31,10 +37,26 @@ func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err erro
 
 	if config != nil {
 		c.mapEnv = config.MapEnv
+		c.env = reflect.TypeOf(config.Env)
 		c.cast = config.Expect
+		c.memoized = config.Memoized
+		c.zeroDivision = config.ZeroDivision
+		c.floatEqual = config.FloatEqual
+		c.nonFinite = config.NonFinite
+		c.broadcast = config.Broadcast
+		c.sensitive = config.Sensitive
+		c.timeouts = config.Timeouts
+		if config.Logging != nil && config.Logging.Logger != nil {
+			c.logging = config.Logging
+		}
 	}
 
 	c.compile(tree.Node)
+	if c.nonFinite != nil && !c.nonFinite.Error && mayBeNonFinite(tree.Node) {
+		// NaN and infinities are replaced with nil only in results, so
+		// arithmetic and comparisons of them are well-defined.
+		c.emit(OpCheckFinite, c.addConstant(c.nonFinite))
+	}
 
 	switch c.cast {
 	case reflect.Int:
@@ -52,20 +74,84 @@ func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err erro
 		Constants: c.constants,
 		Bytecode:  c.bytecode,
 		Arguments: c.arguments,
+		Sensitive: c.tainted,
+	}
+	program.MaxStack = maxStack(program)
+	if config != nil {
+		if err := checkLimits(program, config.Limits); err != nil {
+			return nil, err
+		}
+	}
+	if config != nil && config.CacheSize > 0 && c.deterministic() {
+		program.Cache = NewCache(config.CacheSize)
+	}
+	if config != nil {
+		program.Translator = config.Translator
+		program.Converters = config.Converters
+		if config.Audit != nil && config.Audit.Auditor != nil {
+			program.Audit = config.Audit
+		}
+		if config.Metrics != nil && config.Metrics.Metrics != nil {
+			program.Metrics = config.Metrics
+		}
+		if config.Tracing != nil && config.Tracing.Tracer != nil {
+			// Programs of sets share configs, so every program has its own
+			// copy with the hash of its source.
+			t := *config.Tracing
+			sum := sha256.Sum256([]byte(tree.Source.Content()))
+			t.Hash = hex.EncodeToString(sum[:])
+			program.Tracing = &t
+		}
 	}
+	// References are collected now, so programs may be shared between
+	// goroutines.
+	program.References()
 	return
 }
 
+// deterministic reports whether result of the program depends only on values
+// of the environment. Functions and methods of the environment may have side
+// effects, so programs calling them are not deterministic.
+func (c *compiler) deterministic() bool {
+	for _, op := range c.bytecode {
+		switch op {
+		case OpCall, OpCallFast, OpCallTyped, OpCallContext, OpCallMethod:
+			return false
+		}
+	}
+	for _, constant := range c.constants {
+		if fn, ok := constant.(*builtin.Function); ok && (fn.NonDeterministic || fn.NoFold) {
+			return false
+		}
+	}
+	return true
+}
+
 type compiler struct {
 	locations []file.Location
 	constants []interface{}
 	bytecode  []Opcode
 	index     map[interface{}]int
 	mapEnv    bool
+	env       reflect.Type
 	cast      reflect.Kind
 	nodes     []ast.Node
 	chains    [][]int
 	arguments []int
+	memoized  map[string]bool
+	variables []map[string]int // slots of variables of folds
+	slots     int
+	shared    map[*ast.SharedNode]*runtime.Memo
+
+	zeroDivision *runtime.ZeroDivision
+	floatEqual   *runtime.FloatEqual
+	nonFinite    *runtime.NonFinite
+	broadcast    bool
+	sensitive    []string
+	timeouts     map[string]time.Duration
+	logging      *logging.Config
+	log          *builtin.Function // log builtin of the program, if logged
+	tainted      bool              // OpTaint is emitted
 }
 
 func (c *compiler) emitLocation(loc file.Location, op Opcode, arg int) int {
@@ -185,9 +271,65 @@ func (c *compiler) compile(node ast.Node) {
 		c.MapNode(n)
 	case *ast.PairNode:
 		c.PairNode(n)
+	case *ast.VariableNode:
+		c.VariableNode(n)
+	case *ast.BlockNode:
+		c.BlockNode(n)
+	case *ast.TupleNode:
+		c.TupleNode(n)
+	case *ast.BindNode:
+		c.BindNode(n)
+	case *ast.ComprehensionNode:
+		c.ComprehensionNode(n)
+	case *ast.SharedNode:
+		c.SharedNode(n)
 	default:
 		panic(fmt.Sprintf("undefined node type (%T)", node))
 	}
+	if len(c.sensitive) > 0 && c.isSensitive(node) {
+		c.emit(OpTaint)
+		c.tainted = true
+	}
+}
+
+// isSensitive reports, whether the node is a sensitive field, or its
+// member. Values containing sensitive fields, like user of user.SSN, are
+// sensitive too, unless only their members are used.
+func (c *compiler) isSensitive(node ast.Node) bool {
+	path, ok := fieldPath(node)
+	if !ok {
+		return false
+	}
+	base := false
+	if len(c.nodes) > 1 {
+		member, ok := c.nodes[len(c.nodes)-2].(*ast.MemberNode)
+		base = ok && member.Property != node
+	}
+	for _, sensitive := range c.sensitive {
+		if path == sensitive || strings.HasPrefix(path, sensitive+".") {
+			return true
+		}
+		if !base && strings.HasPrefix(sensitive, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldPath returns the path of fields of the environment, like
+// "user.Name".
+func fieldPath(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return n.Value, true
+	case *ast.MemberNode:
+		if name, ok := n.Property.(*ast.StringNode); ok {
+			if base, ok := fieldPath(n.Node); ok {
+				return base + "." + name.Value, true
+			}
+		}
+	}
+	return "", false
 }
 
 func (c *compiler) NilNode(_ *ast.NilNode) {
@@ -198,10 +340,9 @@ func (c *compiler) IdentifierNode(node *ast.IdentifierNode) {
 	if c.mapEnv {
 		c.emit(OpLoadFast, c.addConstant(node.Value))
 	} else if len(node.FieldIndex) > 0 {
-		c.emit(OpLoadField, c.addConstant(&runtime.Field{
-			Index: node.FieldIndex,
-			Path:  []string{node.Value},
-		}))
+		c.emit(OpLoadField, c.addConstant(
+			runtime.NewField(c.env, node.FieldIndex, []string{node.Value}),
+		))
 	} else if node.Method {
 		c.emit(OpLoadMethod, c.addConstant(&runtime.Method{
 			Name:  node.Value,
@@ -296,23 +437,23 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 	l := kind(node.Left)
 	r := kind(node.Right)
 
+	if c.isBroadcast(node) {
+		b := &runtime.Broadcast{}
+		c.compileBroadcast(node, b)
+		c.emit(OpBroadcast, c.addConstant(b))
+		return
+	}
+
 	switch node.Operator {
 	case "==":
-		c.compile(node.Left)
-		c.compile(node.Right)
-
-		if l == r && l == reflect.Int {
-			c.emit(OpEqualInt)
-		} else if l == r && l == reflect.String {
-			c.emit(OpEqualString)
-		} else {
-			c.emit(OpEqual)
-		}
+		c.compileCompared(node.Left)
+		c.compileCompared(node.Right)
+		c.emitEqual(node)
 
 	case "!=":
-		c.compile(node.Left)
-		c.compile(node.Right)
-		c.emit(OpEqual)
+		c.compileCompared(node.Left)
+		c.compileCompared(node.Right)
+		c.emitEqual(node)
 		c.emit(OpNot)
 
 	case "or", "||":
@@ -329,58 +470,84 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 		c.compile(node.Right)
 		c.patchJump(end)
 
-	case "<":
+	case "??":
 		c.compile(node.Left)
+		end := c.emit(OpJumpIfNotNil, placeholder)
+		c.emit(OpPop)
 		c.compile(node.Right)
-		c.emit(OpLess)
+		c.patchJump(end)
+
+	case "<":
+		c.compileCompared(node.Left)
+		c.compileCompared(node.Right)
+		c.emitTyped(node, OpLess)
 
 	case ">":
-		c.compile(node.Left)
-		c.compile(node.Right)
-		c.emit(OpMore)
+		c.compileCompared(node.Left)
+		c.compileCompared(node.Right)
+		c.emitTyped(node, OpMore)
 
 	case "<=":
-		c.compile(node.Left)
-		c.compile(node.Right)
-		c.emit(OpLessOrEqual)
+		c.compileCompared(node.Left)
+		c.compileCompared(node.Right)
+		c.emitTyped(node, OpLessOrEqual)
 
 	case ">=":
-		c.compile(node.Left)
-		c.compile(node.Right)
-		c.emit(OpMoreOrEqual)
+		c.compileCompared(node.Left)
+		c.compileCompared(node.Right)
+		c.emitTyped(node, OpMoreOrEqual)
 
 	case "+":
+		if l == reflect.String && r == reflect.String {
+			// Chains of concatenations, like a + b + c, are concatenated at
+			// once, without intermediate strings.
+			if operands := concatOperands(node); len(operands) > 2 {
+				for _, operand := range operands {
+					c.compile(operand)
+				}
+				c.emit(OpConcat, len(operands))
+				return
+			}
+		}
 		c.compile(node.Left)
 		c.compile(node.Right)
-		c.emit(OpAdd)
+		c.emitTyped(node, OpAdd)
+		c.emitFinite(node)
 
 	case "-":
 		c.compile(node.Left)
 		c.compile(node.Right)
-		c.emit(OpSubtract)
+		c.emitTyped(node, OpSubtract)
+		c.emitFinite(node)
 
 	case "*":
 		c.compile(node.Left)
 		c.compile(node.Right)
-		c.emit(OpMultiply)
+		c.emitTyped(node, OpMultiply)
+		c.emitFinite(node)
 
 	case "/":
 		c.compile(node.Left)
 		c.compile(node.Right)
+		c.emitZeroDivision()
 		c.emit(OpDivide)
+		c.emitFinite(node)
 
 	case "%":
 		c.compile(node.Left)
 		c.compile(node.Right)
+		c.emitZeroDivision()
 		c.emit(OpModulo)
+		c.emitFinite(node)
 
 	case "**", "^":
 		c.compile(node.Left)
 		c.compile(node.Right)
 		c.emit(OpExponent)
+		c.emitFinite(node)
 
 	case "in":
-		c.compile(node.Left)
+		c.compileKey(node.Right.Type(), node.Left)
 		c.compile(node.Right)
 		c.emit(OpIn)
 
@@ -394,6 +561,15 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 			c.emit(OpMatches)
 		}
 
+	case "like":
+		c.compile(node.Left)
+		if node.Regexp != nil {
+			c.emit(OpMatchesConst, c.addConstant(node.Regexp))
+		} else {
+			c.compile(node.Right)
+			c.emit(OpLike)
+		}
+
 	case "contains":
 		c.compile(node.Left)
 		c.compile(node.Right)
@@ -448,22 +624,18 @@ func (c *compiler) MemberNode(node *ast.MemberNode) {
 		op = OpFetchField
 		for !node.Optional {
 			ident, ok := base.(*ast.IdentifierNode)
-			if ok && len(ident.FieldIndex) > 0 {
-				if ident.Deref {
-					panic("IdentifierNode should not be dereferenced")
-				}
+			// Fields of converted values are fetched from results of
+			// converters.
+			if ok && len(ident.FieldIndex) > 0 && !ident.Deref {
 				index = append(ident.FieldIndex, index...)
 				path = append([]string{ident.Value}, path...)
 				c.emitLocation(ident.Location(), OpLoadField, c.addConstant(
-					&runtime.Field{Index: index, Path: path},
+					runtime.NewField(c.env, index, path),
 				))
 				goto deref
 			}
 			member, ok := base.(*ast.MemberNode)
-			if ok && len(member.FieldIndex) > 0 {
-				if member.Deref {
-					panic("MemberNode should not be dereferenced")
-				}
+			if ok && len(member.FieldIndex) > 0 && !member.Deref {
 				index = append(member.FieldIndex, index...)
 				path = append([]string{member.Name}, path...)
 				node = member
@@ -481,11 +653,11 @@ func (c *compiler) MemberNode(node *ast.MemberNode) {
 	}
 
 	if op == OpFetch {
-		c.compile(node.Property)
+		c.compileKey(base.Type(), node.Property)
 		c.emit(OpFetch)
 	} else {
 		c.emitLocation(node.Location(), op, c.addConstant(
-			&runtime.Field{Index: index, Path: path},
+			runtime.NewField(base.Type(), index, path),
 		))
 	}
 
@@ -516,6 +688,155 @@ func (c *compiler) CallNode(node *ast.CallNode) {
 	for _, arg := range node.Arguments {
 		c.compile(arg)
 	}
+	if name, ok := c.memoizedName(node); ok {
+		memo := &runtime.Memo{Name: name, Args: len(node.Arguments)}
+		c.emit(OpMemo, c.addConstant(memo))
+		start := len(c.bytecode)
+		c.call(node)
+		c.emit(OpMemoStore)
+		memo.Skip = len(c.bytecode) - start
+	} else {
+		c.call(node)
+	}
+	c.emitFinite(node)
+}
+
+func (c *compiler) TupleNode(node *ast.TupleNode) {
+	for _, element := range node.Nodes {
+		c.compile(element)
+	}
+	c.emit(OpTuple, len(node.Nodes))
+}
+
+// BindNode stores the value, or elements of the tuple, in slots of
+// variables of the body.
+func (c *compiler) BindNode(node *ast.BindNode) {
+	c.compile(node.Value)
+	variables := make(map[string]int, len(node.Names))
+	for _, name := range node.Names {
+		variables[name] = c.slots
+		c.slots++
+	}
+	if node.Tuple {
+		c.emit(OpUnpack, len(node.Names))
+	}
+	for i := len(node.Names) - 1; i >= 0; i-- {
+		c.emit(OpStoreVar, variables[node.Names[i]])
+	}
+	c.variables = append(c.variables, variables)
+	c.compile(node.Body)
+	c.variables = c.variables[:len(c.variables)-1]
+}
+
+// ComprehensionNode selects and maps items in a single loop, so no
+// intermediate arrays are allocated, unlike map(filter(items, ...), ...).
+func (c *compiler) ComprehensionNode(node *ast.ComprehensionNode) {
+	c.compile(node.Items)
+	c.emit(OpBegin)
+	slot := c.slots
+	c.slots++
+	c.variables = append(c.variables, map[string]int{node.Name: slot})
+	c.emitLoop(func() {
+		c.emit(OpPointer)
+		c.emit(OpStoreVar, slot)
+		value := func() {
+			c.emit(OpIncrementCount)
+			c.compile(node.Node)
+		}
+		if node.Cond != nil {
+			c.compile(node.Cond)
+			c.emitCond(value)
+		} else {
+			value()
+		}
+	})
+	c.variables = c.variables[:len(c.variables)-1]
+	c.emit(OpGetCount)
+	c.emit(OpEnd)
+	if _, ok := node.Node.(*ast.PairNode); ok {
+		c.emit(OpMap)
+	} else {
+		c.emit(OpArray)
+	}
+}
+
+// SharedNode caches result of the node, like result of a memoized call
+// without arguments, so the node is evaluated once per run.
+func (c *compiler) SharedNode(node *ast.SharedNode) {
+	// All uses of the node share the memo, which is the key of the result.
+	memo, ok := c.shared[node]
+	if !ok {
+		memo = &runtime.Memo{Name: node.Name, Shared: true}
+		if c.shared == nil {
+			c.shared = make(map[*ast.SharedNode]*runtime.Memo)
+		}
+		c.shared[node] = memo
+	}
+	c.emit(OpMemo, c.addConstant(memo))
+	start := len(c.bytecode)
+	c.compile(node.Node)
+	c.emit(OpMemoStore)
+	memo.Skip = len(c.bytecode) - start
+}
+
+// logFunction returns the log.print builtin of the program, which routes entries
+// to the logger with the limit of the rate of the program.
+func (c *compiler) logFunction() *builtin.Function {
+	if c.log == nil {
+		c.log = &builtin.Function{
+			Name:             "log.print",
+			Func:             c.logging.Func(),
+			NonDeterministic: true,
+		}
+	}
+	return c.log
+}
+
+// memoizedName returns name of called function, if its results are cached.
+// Only functions called by name are memoized.
+func (c *compiler) memoizedName(node *ast.CallNode) (string, bool) {
+	name := ""
+	if node.Func != nil {
+		name = node.Func.Name
+	} else if identifier, ok := node.Callee.(*ast.IdentifierNode); ok {
+		name = identifier.Value
+	}
+	return name, name != "" && c.memoized[name]
+}
+
+func (c *compiler) call(node *ast.CallNode) {
+	if node.Func != nil {
+		fn := node.Func
+		if fn.Name == "log.print" && c.logging != nil {
+			fn = c.logFunction()
+		}
+		c.emitPush(len(node.Arguments))
+		c.emit(OpCallBuiltin, c.addConstant(fn))
+		return
+	}
+	if node.Context {
+		name, _ := fieldPath(node.Callee)
+		timeout, ok := c.timeouts[name]
+		if !ok {
+			timeout = c.timeouts[""]
+		}
+		c.compile(node.Callee)
+		c.emit(OpCallContext, c.addConstant(&runtime.ContextCall{
+			Name:    name,
+			Args:    len(node.Arguments),
+			Timeout: timeout,
+		}))
+		return
+	}
+	if call := c.methodCall(node); call != nil {
+		if call.Env {
+			c.emit(OpLoadEnv)
+		} else {
+			c.compile(node.Callee.(*ast.MemberNode).Node)
+		}
+		c.emit(OpCallMethod, c.addConstant(call))
+		return
+	}
 	c.compile(node.Callee)
 	if node.Typed > 0 {
 		c.emit(OpCallTyped, node.Typed)
@@ -527,8 +848,129 @@ func (c *compiler) CallNode(node *ast.CallNode) {
 	}
 }
 
+// methodCall returns the call of the method, which accessor is registered
+// for the type of the receiver, or nil. Functions of fast and typed calls
+// need no reflection already.
+func (c *compiler) methodCall(node *ast.CallNode) *runtime.MethodCall {
+	if node.Fast || node.Typed > 0 {
+		return nil
+	}
+	switch callee := node.Callee.(type) {
+	case *ast.IdentifierNode:
+		if callee.Method && !c.mapEnv {
+			method := runtime.Method{Name: callee.Value, Index: callee.MethodIndex}
+			call := runtime.NewMethodCall(c.env, method, len(node.Arguments))
+			if call != nil {
+				call.Env = true
+			}
+			return call
+		}
+	case *ast.MemberNode:
+		if callee.Method {
+			method := runtime.Method{Name: callee.Name, Index: callee.MethodIndex}
+			return runtime.NewMethodCall(callee.Node.Type(), method, len(node.Arguments))
+		}
+	}
+	return nil
+}
+
+// emitEqual emits comparison of operands, which are compared approximately,
+// if comparison of floats is configured and operands may be floats.
+func (c *compiler) emitEqual(node *ast.BinaryNode) {
+	if c.floatEqual != nil && mayBeFloat(node.Left) && mayBeFloat(node.Right) {
+		c.emit(OpEqualApprox, c.addConstant(c.floatEqual))
+		return
+	}
+	c.emitTyped(node, OpEqual)
+}
+
+// mayBeFloat reports whether values of the node may be numbers, floats
+// or not.
+func mayBeFloat(node ast.Node) bool {
+	t := valueType(node)
+	if t == nil {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// emitFinite emits check of the result of the node, if NaN and infinities
+// are errors and the node may produce them.
+func (c *compiler) emitFinite(node ast.Node) {
+	if c.nonFinite != nil && c.nonFinite.Error && producesNonFinite(node) {
+		c.emit(OpCheckFinite, c.addConstant(c.nonFinite))
+	}
+}
+
+// compileCompared compiles the operand of a comparison, which is checked
+// like results of arithmetic, if NaN and infinities are errors, as it may
+// come from the environment.
+func (c *compiler) compileCompared(node ast.Node) {
+	c.compile(node)
+	if c.nonFinite != nil && c.nonFinite.Error && mayBeNonFinite(node) && !producesNonFinite(node) {
+		c.emit(OpCheckFinite, c.addConstant(c.nonFinite))
+	}
+}
+
+// producesNonFinite reports whether the node, an arithmetic operation or a
+// call of a function, may produce NaN or infinities. Results of division
+// and modulo by zero may be replaced by any value.
+func producesNonFinite(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "/", "%":
+			return true
+		case "+", "-", "*", "**", "^":
+			return mayBeNonFinite(n)
+		}
+	case *ast.CallNode:
+		return n.Func != nil && mayBeNonFinite(n)
+	}
+	return false
+}
+
+// mayBeNonFinite reports whether values of the node may be floats.
+func mayBeNonFinite(node ast.Node) bool {
+	t := node.Type()
+	if t == nil {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// emitZeroDivision emits check of divisor, if result of division by zero
+// is configured.
+func (c *compiler) emitZeroDivision() {
+	if c.zeroDivision != nil {
+		c.emit(OpCheckZero, c.addConstant(c.zeroDivision))
+	}
+}
+
 func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	switch node.Name {
+	case "try", "fallback":
+		op := OpTry
+		if node.Name == "fallback" {
+			op = OpFallback
+		}
+		catch := c.emit(op, placeholder)
+		c.compile(node.Arguments[0])
+		end := c.emit(OpEndTry, placeholder)
+		c.patchJump(catch)
+		c.compile(node.Arguments[1])
+		c.patchJump(end)
+
 	case "len":
 		c.compile(node.Arguments[0])
 		c.emit(OpLen)
@@ -625,11 +1067,76 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emit(OpGetCount)
 		c.emit(OpEnd)
 
+	case "reduce":
+		c.compile(node.Arguments[0])
+		c.emit(OpBegin)
+		var empty int
+		if len(node.Arguments) == 3 {
+			c.compile(node.Arguments[2])
+			c.emit(OpSetAcc)
+		} else {
+			// The first element is the initial value, and result of an
+			// empty array is nil.
+			empty = c.emit(OpJumpIfEnd, placeholder)
+			c.emit(OpPointer)
+			c.emit(OpSetAcc)
+			c.emit(OpIncrementIt)
+		}
+		c.emitLoop(func() {
+			c.compile(node.Arguments[1])
+			c.emit(OpSetAcc)
+		})
+		if len(node.Arguments) != 3 {
+			c.patchJump(empty)
+		}
+		c.emit(OpGetAcc)
+		c.emit(OpEnd)
+
+	case "fold":
+		// Every variable has its own slot, as folds cannot be recursive.
+		last := len(node.Arguments) - 1
+		variables := make(map[string]int, last-1)
+		for _, arg := range node.Arguments[1:last] {
+			let := arg.(*ast.LetNode)
+			c.compile(let.Value)
+			variables[let.Name] = c.slots
+			c.emit(OpStoreVar, c.slots)
+			c.slots++
+		}
+		c.compile(node.Arguments[0])
+		c.emit(OpBegin)
+		c.variables = append(c.variables, variables)
+		c.emitLoop(func() {
+			c.compile(node.Arguments[last])
+		})
+		c.variables = c.variables[:len(c.variables)-1]
+		c.emit(OpEnd)
+		c.emit(OpLoadVar, variables[node.Arguments[1].(*ast.LetNode).Name])
+
 	default:
 		panic(fmt.Sprintf("unknown builtin %v", node.Name))
 	}
 }
 
+func (c *compiler) VariableNode(node *ast.VariableNode) {
+	for i := len(c.variables) - 1; i >= 0; i-- {
+		if slot, ok := c.variables[i][node.Name]; ok {
+			c.emit(OpLoadVar, slot)
+			return
+		}
+	}
+	panic(fmt.Sprintf("unknown variable %v", node.Name))
+}
+
+func (c *compiler) BlockNode(node *ast.BlockNode) {
+	variables := c.variables[len(c.variables)-1]
+	for _, n := range node.Nodes {
+		assign := n.(*ast.AssignNode)
+		c.compile(assign.Value)
+		c.emit(OpStoreVar, variables[assign.Name])
+	}
+}
+
 func (c *compiler) emitCond(body func()) {
 	noop := c.emit(OpJumpIfFalse, placeholder)
 	c.emit(OpPop)
@@ -658,7 +1165,17 @@ func (c *compiler) ClosureNode(node *ast.ClosureNode) {
 }
 
 func (c *compiler) PointerNode(node *ast.PointerNode) {
-	c.emit(OpPointer)
+	switch node.Name {
+	case "index":
+		c.emit(OpGetIndex)
+	case "acc":
+		c.emit(OpGetAcc)
+	default:
+		c.emit(OpPointer)
+		if node.Deref {
+			c.emit(OpDeref)
+		}
+	}
 }
 
 func (c *compiler) ConditionalNode(node *ast.ConditionalNode) {
@@ -699,6 +1216,120 @@ func (c *compiler) PairNode(node *ast.PairNode) {
 	c.compile(node.Value)
 }
 
+// concatOperands returns operands of the chain of concatenations of
+// strings, like a, b and c of a + (b + c).
+func concatOperands(node ast.Node) []ast.Node {
+	if b, ok := node.(*ast.BinaryNode); ok && b.Operator == "+" && kind(b.Left) == reflect.String && kind(b.Right) == reflect.String {
+		return append(concatOperands(b.Left), concatOperands(b.Right)...)
+	}
+	return []ast.Node{node}
+}
+
+var (
+	integerType = reflect.TypeOf(0)
+	floatType   = reflect.TypeOf(float64(0))
+	stringType  = reflect.TypeOf("")
+)
+
+// typedOpcodes are opcodes of operators for operands of the same type.
+var typedOpcodes = map[string]map[reflect.Type]Opcode{
+	"==": {integerType: OpEqualInt, floatType: OpEqualFloat, stringType: OpEqualString},
+	"!=": {integerType: OpEqualInt, floatType: OpEqualFloat, stringType: OpEqualString},
+	"<":  {integerType: OpLessInt, floatType: OpLessFloat, stringType: OpLessString},
+	">":  {integerType: OpMoreInt, floatType: OpMoreFloat, stringType: OpMoreString},
+	"<=": {integerType: OpLessOrEqualInt, floatType: OpLessOrEqualFloat, stringType: OpLessOrEqualString},
+	">=": {integerType: OpMoreOrEqualInt, floatType: OpMoreOrEqualFloat, stringType: OpMoreOrEqualString},
+	"+":  {integerType: OpAddInt, floatType: OpAddFloat, stringType: OpAddString},
+	"-":  {integerType: OpSubtractInt, floatType: OpSubtractFloat},
+	"*":  {integerType: OpMultiplyInt, floatType: OpMultiplyFloat},
+}
+
+// emitTyped emits the opcode of the operator for types of operands, which
+// skips type switches of runtime helpers, or the generic opcode, if types of
+// operands differ or are unknown.
+func (c *compiler) emitTyped(node *ast.BinaryNode, generic Opcode) {
+	l := valueType(node.Left)
+	if l != nil && l == valueType(node.Right) {
+		if op, ok := typedOpcodes[node.Operator][l]; ok {
+			c.emit(op)
+			return
+		}
+	}
+	c.emit(generic)
+}
+
+// valueType returns the type of values of the node known by the checker.
+// Division of integers is typed as int, but results in float64.
+func valueType(node ast.Node) reflect.Type {
+	if b, ok := node.(*ast.BinaryNode); ok && b.Operator == "/" {
+		if t := node.Type(); t == integerType || t == floatType {
+			return floatType
+		}
+		return nil
+	}
+	return node.Type()
+}
+
+// compileKey compiles the key of the map of the type, converting literals to
+// the type of keys of the map during compilation, like 1 to int64, instead of
+// on every fetch.
+func (c *compiler) compileKey(t reflect.Type, key ast.Node) {
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Map {
+		var value interface{}
+		switch n := key.(type) {
+		case *ast.IntegerNode:
+			value = n.Value
+		case *ast.FloatNode:
+			value = n.Value
+		case *ast.StringNode:
+			value = n.Value
+		}
+		if value != nil {
+			if k, ok := runtime.MapKey(value, t.Key()); ok && k.Type() != reflect.TypeOf(value) {
+				c.emitPush(k.Interface())
+				return
+			}
+		}
+	}
+	c.compile(key)
+}
+
+// isBroadcast reports whether the node is element-wise arithmetic of arrays,
+// allowed by the checker with the Broadcast option.
+func (c *compiler) isBroadcast(node ast.Node) bool {
+	n, ok := node.(*ast.BinaryNode)
+	if !c.broadcast || !ok || !isList(kind(n)) {
+		return false
+	}
+	switch n.Operator {
+	case "+", "-", "*", "/", "%", "**", "^":
+		return isList(kind(n.Left)) || isList(kind(n.Right))
+	}
+	return false
+}
+
+// compileBroadcast compiles operands of the element-wise arithmetic, and
+// appends steps of the operation to the fused loop. Operands, which are
+// element-wise arithmetic too, become steps of the same loop.
+func (c *compiler) compileBroadcast(node ast.Node, b *runtime.Broadcast) {
+	if n, ok := node.(*ast.BinaryNode); ok && c.isBroadcast(n) {
+		c.compileBroadcast(n.Left, b)
+		c.compileBroadcast(n.Right, b)
+		b.Code = append(b.Code, runtime.BroadcastStep{Operator: n.Operator})
+		return
+	}
+	c.compile(node)
+	b.Code = append(b.Code, runtime.BroadcastStep{Operand: b.Operands})
+	b.Operands++
+}
+
+func isList(k reflect.Kind) bool {
+	return k == reflect.Slice || k == reflect.Array
+}
+
 func kind(node ast.Node) reflect.Kind {
 	t := node.Type()
 	if t == nil {
@@ -2,6 +2,7 @@ package compiler_test
 
 import (
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/antonmedv/expr"
@@ -238,3 +239,127 @@ func TestCompile(t *testing.T) {
 		assert.Equal(t, test.program.Disassemble(), program.Disassemble(), test.input)
 	}
 }
+
+func TestCompile_concat(t *testing.T) {
+	env := map[string]interface{}{"a": "", "b": "", "n": 0}
+
+	program, err := expr.Compile(`a + "-" + (b + a) + "!"`, expr.Env(env))
+	require.NoError(t, err)
+	assert.Equal(t, []vm.Opcode{
+		vm.OpLoadFast, vm.OpPush, vm.OpLoadFast, vm.OpLoadFast, vm.OpPush, vm.OpConcat,
+	}, program.Bytecode)
+	assert.Equal(t, 5, program.Arguments[5])
+
+	out, err := expr.Run(program, map[string]interface{}{"a": "x", "b": "y"})
+	require.NoError(t, err)
+	assert.Equal(t, "x-yx!", out)
+
+	// Only operands known to be strings are concatenated at once.
+	program, err = expr.Compile(`a + b + convert.string(n)`, expr.Env(env))
+	require.NoError(t, err)
+	assert.NotContains(t, program.Disassemble(), "OpConcat")
+	program, err = expr.Compile(`a + b`, expr.Env(env))
+	require.NoError(t, err)
+	assert.NotContains(t, program.Disassemble(), "OpConcat")
+
+	// Types of ternaries with values of any type are approximated, so
+	// operands, which are not strings, are added by runtime.Add.
+	env = map[string]interface{}{"s": "a", "obj": map[string]interface{}{"n": 1}}
+	program, err = expr.Compile(`(false ? s : obj.n) + s + s`, expr.Env(env))
+	require.NoError(t, err)
+	assert.Contains(t, program.Disassemble(), "OpConcat")
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: int + string")
+	out, err = expr.Run(program, map[string]interface{}{"s": "a", "obj": map[string]interface{}{"n": "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, "baa", out)
+}
+
+func TestCompile_typed(t *testing.T) {
+	type age int
+	env := map[string]interface{}{"i": 0, "f": 0.0, "s": "", "a": age(0), "x": nil}
+
+	var tests = []struct {
+		input  string
+		opcode vm.Opcode
+	}{
+		{`i + i`, vm.OpAddInt},
+		{`f - f`, vm.OpSubtractFloat},
+		{`i * 2`, vm.OpMultiplyInt},
+		{`s + s`, vm.OpAddString},
+		{`f < 1.5`, vm.OpLessFloat},
+		{`s >= "b"`, vm.OpMoreOrEqualString},
+		{`i != 1`, vm.OpEqualInt},
+		{`i / i > 1.5`, vm.OpMoreFloat},
+		{`i + f`, vm.OpAdd},
+		{`a + a`, vm.OpAdd},
+		{`x + 1`, vm.OpAdd},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.input, expr.Env(env))
+		require.NoError(t, err, test.input)
+		assert.Contains(t, program.Bytecode, test.opcode, test.input)
+	}
+
+	// Values of other types at runtime are passed to generic helpers, like
+	// results of division typed as int.
+	program, err := expr.Compile(`let q = i / 2; q + i`, expr.Env(env))
+	require.NoError(t, err)
+	assert.Contains(t, program.Bytecode, vm.OpAddInt)
+
+	out, err := expr.Run(program, map[string]interface{}{"i": 3})
+	require.NoError(t, err)
+	assert.Equal(t, 4.5, out)
+}
+
+func TestCompile_maxStack(t *testing.T) {
+	env := map[string]interface{}{
+		"a":     1,
+		"s":     "x",
+		"items": []int{1, 2, 3},
+		"fn":    func(a, b, c int) int { return a + b + c },
+		"m":     map[string]interface{}{"k": 1},
+	}
+	var tests = []struct {
+		input    string
+		maxStack int
+	}{
+		{`1`, 1},
+		{`a + 1`, 2},
+		{`a + (a * (a - 1))`, 4},
+		{`fn(1, 2, 3)`, 4},
+		{`[1, 2, [3, a]]`, 5},
+		{`{a: 1, b: [a]}`, 5},
+		{`a > 0 ? s + "y" : "z"`, 2},
+		{`len(items) + a`, 2},
+		{`try(fn(a, a, a), 0)`, 4},
+		{`s + s + s + s`, 4},
+		{`let (x, y) = (1, 2); x + y`, 2},
+		{`m.k + a`, 2},
+		{`all(items, {# > a})`, 2},
+		{`map(items, {# + a})`, 2},
+		{`reduce(items, {#acc + #}, 0)`, 2},
+		{`[x * 2 for x in items if x > a]`, 2},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.input, expr.Env(env))
+		require.NoError(t, err, test.input)
+		assert.Equal(t, test.maxStack, program.MaxStack, test.input)
+
+		// Depths of stacks of runs do not exceed MaxStack, except for
+		// elements of arrays built by loops.
+		depth := 0
+		var machine *vm.VM
+		machine = vm.Trace(func(ip int) {
+			if len(machine.Stack()) > depth {
+				depth = len(machine.Stack())
+			}
+		})
+		_, err = machine.Run(program, env)
+		require.NoError(t, err, test.input)
+		if !strings.Contains(test.input, "map(") && !strings.Contains(test.input, " for ") {
+			assert.LessOrEqual(t, depth, program.MaxStack, test.input)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/antonmedv/expr/conf"
+	. "github.com/antonmedv/expr/vm"
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// maxStack returns the maximum depth of the stack of operands of the
+// program. Elements of arrays and maps built by loops, like results of map
+// and comprehensions, are not counted, as their number depends on lengths of
+// arrays: back jumps of loops are not followed.
+func maxStack(program *Program) int {
+	bytecode := program.Bytecode
+	depths := make([]int, len(bytecode)+1)
+	for i := range depths {
+		depths[i] = -1
+	}
+	var work []int
+	visit := func(ip, depth int) {
+		if ip >= 0 && ip < len(depths) && depths[ip] < 0 {
+			depths[ip] = depth
+			work = append(work, ip)
+		}
+	}
+
+	max := 0
+	visit(0, 0)
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		if ip == len(bytecode) {
+			continue
+		}
+		op, arg := bytecode[ip], program.Arguments[ip]
+		pop, push := stackEffect(program, ip)
+		depth := depths[ip] - pop + push
+		if depth > max {
+			max = depth
+		}
+		switch op {
+		case OpJump, OpEndTry:
+			visit(ip+1+arg, depth)
+		case OpJumpIfTrue, OpJumpIfFalse, OpJumpIfNil, OpJumpIfNotNil, OpJumpIfEnd:
+			visit(ip+1, depth)
+			visit(ip+1+arg, depth)
+		case OpTry, OpFallback:
+			// Stack is restored to its depth at OpTry on errors.
+			visit(ip+1, depth)
+			visit(ip+1+arg, depth)
+		case OpMemo:
+			// Arguments are replaced with the memoized result.
+			memo := program.Constants[arg].(*runtime.Memo)
+			visit(ip+1, depth)
+			visit(ip+1+memo.Skip, depth-memo.Args+1)
+		case OpJumpBackward:
+		default:
+			visit(ip+1, depth)
+		}
+	}
+	return max
+}
+
+// stackEffect returns numbers of values popped and pushed by the operation
+// at ip.
+func stackEffect(program *Program, ip int) (pop, push int) {
+	arg := program.Arguments[ip]
+	switch program.Bytecode[ip] {
+	case OpPush, OpPushInt, OpLoadConst, OpLoadField, OpLoadFast, OpLoadMethod,
+		OpTrue, OpFalse, OpNil, OpLen, OpGetCount, OpGetLen, OpPointer, OpLoadVar,
+		OpGetIndex, OpGetAcc, OpLoadEnv:
+		return 0, 1
+
+	case OpFetchField, OpMethod, OpNegate, OpNot, OpMatchesConst, OpCast, OpDeref:
+		return 1, 1
+
+	case OpPop, OpBegin, OpStoreVar, OpSetAcc:
+		return 1, 0
+
+	case OpRot:
+		return 2, 2
+
+	case OpSlice:
+		return 3, 1
+
+	case OpCall, OpCallFast:
+		return arg + 1, 1
+
+	case OpCallTyped:
+		return reflect.TypeOf(FuncTypes[arg]).Elem().NumIn() + 1, 1
+
+	case OpCallMethod:
+		return program.Constants[arg].(*runtime.MethodCall).Args + 1, 1
+
+	case OpCallBuiltin:
+		return pushed(program, ip) + 1, 1
+
+	case OpCallContext:
+		return program.Constants[arg].(*runtime.ContextCall).Args + 1, 1
+
+	case OpBroadcast:
+		return program.Constants[arg].(*runtime.Broadcast).Operands, 1
+
+	case OpArray:
+		return pushed(program, ip) + 1, 1
+
+	case OpMap:
+		return 2*pushed(program, ip) + 1, 1
+
+	case OpTuple, OpConcat:
+		return arg, 1
+
+	case OpUnpack:
+		return 1, arg
+
+	case OpFetch, OpEqual, OpEqualInt, OpEqualString, OpEqualFloat, OpEqualApprox, OpIn,
+		OpLess, OpLessInt, OpLessFloat, OpLessString,
+		OpMore, OpMoreInt, OpMoreFloat, OpMoreString,
+		OpLessOrEqual, OpLessOrEqualInt, OpLessOrEqualFloat, OpLessOrEqualString,
+		OpMoreOrEqual, OpMoreOrEqualInt, OpMoreOrEqualFloat, OpMoreOrEqualString,
+		OpAdd, OpAddInt, OpAddFloat, OpAddString,
+		OpSubtract, OpSubtractInt, OpSubtractFloat,
+		OpMultiply, OpMultiplyInt, OpMultiplyFloat,
+		OpDivide, OpModulo, OpExponent, OpRange, OpMatches, OpContains,
+		OpStartsWith, OpEndsWith, OpLike:
+		return 2, 1
+	}
+	return 0, 0
+}
+
+// pushed returns the number of elements pushed before the operation at ip,
+// if the number is a constant pushed by the previous operation, or 0 for
+// elements pushed by loops.
+func pushed(program *Program, ip int) int {
+	if ip > 0 && program.Bytecode[ip-1] == OpPush {
+		if n, ok := program.Constants[program.Arguments[ip-1]].(int); ok {
+			return n
+		}
+	}
+	return 0
+}
+
+// checkLimits returns an error, if sizes of the program exceed limits.
+func checkLimits(program *Program, limits conf.Limits) error {
+	if limits.Bytecode > 0 && len(program.Bytecode) > limits.Bytecode {
+		return &conf.LimitError{Limit: "bytecode", Message: fmt.Sprintf("program has %v instructions, which exceeds limit of %v", len(program.Bytecode), limits.Bytecode)}
+	}
+	if limits.Constants > 0 && len(program.Constants) > limits.Constants {
+		return &conf.LimitError{Limit: "constants", Message: fmt.Sprintf("program has %v constants, which exceeds limit of %v", len(program.Constants), limits.Constants)}
+	}
+	if limits.Stack > 0 && program.MaxStack > limits.Stack {
+		return &conf.LimitError{Limit: "stack", Message: fmt.Sprintf("program needs stack of depth %v, which exceeds limit of %v", program.MaxStack, limits.Stack)}
+	}
+	return nil
+}
@@ -0,0 +1,456 @@
+// Package completion suggests names to complete at a position of expression:
+// variables, functions and keywords, or fields, methods and keys of the value
+// before the dot. It works with unfinished expressions, and is used by editors
+// of expressions, like Monaco or CodeMirror, and by the language server.
+package completion
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Kind is a kind of candidate.
+type Kind string
+
+const (
+	Variable  Kind = "variable"
+	Field     Kind = "field"
+	Key       Kind = "key"
+	Method    Kind = "method"
+	Function  Kind = "function"
+	Namespace Kind = "namespace"
+	Keyword   Kind = "keyword"
+)
+
+// Candidate is a name, which may replace the word at the position.
+type Candidate struct {
+	Label string `json:"label"`
+	Kind  Kind   `json:"kind"`
+	// Type of variable, field or key, or signatures of function, one per line.
+	Type string `json:"type,omitempty"`
+	// Doc of builtin function or keyword, or doc tag of field of struct.
+	Doc string `json:"doc,omitempty"`
+}
+
+// Result holds candidates, ranked from the best, and the range of source in
+// bytes, which they replace.
+type Result struct {
+	From       int         `json:"from"`
+	To         int         `json:"to"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// Complete returns candidates for the word at offset in bytes of source. The
+// environment is used for types of variables, and for keys of its maps.
+func Complete(source string, offset int, env interface{}, ops ...expr.Option) *Result {
+	config := conf.CreateNew()
+	if env != nil {
+		expr.Env(env)(config)
+	}
+	for _, op := range ops {
+		op(config)
+	}
+	return CompleteWithConfig(source, offset, config)
+}
+
+// CompleteWithConfig returns candidates for the word at offset in bytes of
+// source, like Complete, with names and types of the config.
+func CompleteWithConfig(source string, offset int, config *conf.Config) *Result {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(source) {
+		offset = len(source)
+	}
+	from, to := offset, offset
+	for from > 0 {
+		r, size := utf8.DecodeLastRuneInString(source[:from])
+		if !isWord(r) {
+			break
+		}
+		from -= size
+	}
+	for to < len(source) {
+		r, size := utf8.DecodeRuneInString(source[to:])
+		if !isWord(r) {
+			break
+		}
+		to += size
+	}
+	prefix := source[from:offset]
+	if prefix != "" && unicode.IsDigit(rune(prefix[0])) {
+		return &Result{From: from, To: to, Candidates: []Candidate{}}
+	}
+
+	var candidates []Candidate
+	if from > 0 && source[from-1] == '.' {
+		if isNumber(source[:from-1]) {
+			return &Result{From: from, To: to, Candidates: []Candidate{}}
+		}
+		end := from - 1
+		if end > 0 && source[end-1] == '?' {
+			end-- // optional chaining, like "user?.Name"
+		}
+		candidates = members(config, source[:end], source[pathStart(source[:end]):end])
+	} else {
+		candidates = names(config)
+	}
+	return &Result{From: from, To: to, Candidates: rank(candidates, prefix)}
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isNumber reports whether source ends with a number, like "1" of "1.".
+func isNumber(source string) bool {
+	start := pathStart(source)
+	path := source[start:]
+	return path != "" && unicode.IsDigit(rune(path[0]))
+}
+
+// pathStart returns start of path at the end of source, like "users[0].Name"
+// or "#.Name", skipping indexes.
+func pathStart(source string) int {
+	start := len(source)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(source[:start])
+		switch {
+		case r == ']':
+			open := matching(source[:start-1], '[', ']')
+			if open < 0 {
+				return start
+			}
+			start = open
+		case r == '?' && start < len(source) && source[start] == '.':
+			start -= size
+		case isWord(r), r == '.', r == '#':
+			start -= size
+		default:
+			return start
+		}
+	}
+	return start
+}
+
+// matching returns position of unclosed bracket open at the end of source,
+// or -1 if it is not found.
+func matching(source string, open, close byte) int {
+	depth := 0
+	for i := len(source) - 1; i >= 0; i-- {
+		switch source[i] {
+		case close:
+			depth++
+		case open:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+var kinds = map[Kind]int{
+	Field:     0,
+	Key:       0,
+	Variable:  0,
+	Method:    1,
+	Function:  2,
+	Namespace: 3,
+	Keyword:   4,
+}
+
+// rank returns candidates starting with the prefix, exact matches of case
+// first, then by kind: fields and variables, methods, functions, namespaces
+// and keywords, and then by label.
+func rank(candidates []Candidate, prefix string) []Candidate {
+	type ranked struct {
+		Candidate
+		score int
+	}
+	seen := make(map[string]bool)
+	var list []ranked
+	for _, c := range candidates {
+		if seen[c.Label] {
+			continue
+		}
+		score := kinds[c.Kind]
+		switch {
+		case strings.HasPrefix(c.Label, prefix):
+		case strings.HasPrefix(strings.ToLower(c.Label), strings.ToLower(prefix)):
+			score += len(kinds)
+		default:
+			continue
+		}
+		seen[c.Label] = true
+		list = append(list, ranked{c, score})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].score != list[j].score {
+			return list[i].score < list[j].score
+		}
+		return list[i].Label < list[j].Label
+	})
+	result := make([]Candidate, len(list))
+	for i, r := range list {
+		result[i] = r.Candidate
+	}
+	return result
+}
+
+func names(config *conf.Config) []Candidate {
+	var candidates []Candidate
+	for name, tag := range config.Types {
+		if tag.Ambiguous {
+			continue
+		}
+		t := tag.Type
+		if tag.Method {
+			t = conf.MethodType(t)
+		}
+		if t != nil && t.Kind() == reflect.Func {
+			candidates = append(candidates, Candidate{Label: name, Kind: Function, Type: Signatures(name, []reflect.Type{t})})
+			continue
+		}
+		candidates = append(candidates, Candidate{Label: name, Kind: Variable, Type: typeName(t)})
+	}
+	for name, f := range config.Functions {
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			candidates = append(candidates, Candidate{Label: name[:i], Kind: Namespace})
+			continue
+		}
+		candidates = append(candidates, Candidate{Label: name, Kind: Function, Type: Signatures(name, f.Types), Doc: f.Doc})
+	}
+	for _, name := range parser.Builtins() {
+		candidates = append(candidates, Candidate{Label: name, Kind: Function, Type: builtinSignatures[name], Doc: builtin.Docs[name]})
+	}
+	for _, name := range keywords {
+		candidates = append(candidates, Candidate{Label: name, Kind: Keyword, Doc: builtin.Docs[name]})
+	}
+	return candidates
+}
+
+// members returns functions of namespace, or fields, methods and keys of
+// value of the path. Source before the path is used to find type of element
+// of closure, if path starts with . or #.
+func members(config *conf.Config, source, path string) []Candidate {
+	var candidates []Candidate
+	for name, f := range config.Functions {
+		if strings.HasPrefix(name, path+".") {
+			name = name[len(path)+1:]
+			candidates = append(candidates, Candidate{Label: name, Kind: Function, Type: Signatures(name, f.Types), Doc: f.Doc})
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates
+	}
+
+	var t reflect.Type
+	if path == "" || strings.HasPrefix(path, "#") {
+		before := source[:len(source)-len(path)]
+		if r, _ := utf8.DecodeLastRuneInString(before); path == "" && strings.ContainsRune(")]\"'`", r) {
+			return nil // member of call or literal, like "f()."
+		}
+		element := elementType(config, before)
+		if element == nil {
+			return nil
+		}
+		// Type of path relative to element, like "#.Address".
+		t = pathType(config, element, strings.TrimPrefix(strings.TrimPrefix(path, "#"), "."))
+	} else {
+		t = pathType(config, nil, path)
+	}
+	if t == nil {
+		return nil
+	}
+	candidates = append(candidates, fields(t)...)
+	if len(candidates) == 0 && path != "" && !strings.HasPrefix(path, "#") {
+		candidates = append(candidates, keys(config, path)...)
+	}
+	return candidates
+}
+
+// pathType returns type of the path, or of the path of element, if element
+// is not nil.
+func pathType(config *conf.Config, element reflect.Type, path string) reflect.Type {
+	if element != nil {
+		if path == "" {
+			return element
+		}
+		path = "map([], {#." + path + "})"
+	}
+	tree, err := parser.ParseWithOptions(path, config.ParserOptions())
+	if err != nil {
+		return nil
+	}
+	if element != nil {
+		// Replace array of the closure with array of elements of the type.
+		b := tree.Node.(*ast.BuiltinNode)
+		b.Arguments[0] = &ast.ConstantNode{Value: reflect.MakeSlice(reflect.SliceOf(element), 0, 0).Interface()}
+	}
+	t, err := checker.Check(tree, config)
+	if err != nil || t == nil {
+		return nil
+	}
+	if element != nil {
+		return t.Elem()
+	}
+	return t
+}
+
+// elementType returns type of element of the innermost closure, which is not
+// closed at the end of source, like User of "all(Users, {".
+func elementType(config *conf.Config, source string) reflect.Type {
+	brace := matching(source, '{', '}')
+	if brace < 0 {
+		return nil
+	}
+	comma := strings.TrimRightFunc(source[:brace], unicode.IsSpace)
+	if !strings.HasSuffix(comma, ",") {
+		return nil
+	}
+	args := comma[:len(comma)-1]
+	paren := matching(args, '(', ')')
+	if paren < 0 {
+		return nil
+	}
+	var array reflect.Type
+	if path := strings.TrimSpace(args[paren+1:]); strings.HasPrefix(path, ".") || strings.HasPrefix(path, "#") {
+		element := elementOf(config, source[:paren])
+		if element == nil {
+			return nil
+		}
+		array = pathType(config, element, strings.TrimPrefix(strings.TrimPrefix(path, "#"), "."))
+	} else {
+		array = pathType(config, nil, path)
+	}
+	if array == nil {
+		return nil
+	}
+	for array.Kind() == reflect.Ptr {
+		array = array.Elem()
+	}
+	if array.Kind() != reflect.Slice && array.Kind() != reflect.Array {
+		return nil
+	}
+	return array.Elem()
+}
+
+// elementOf returns type of element of enclosing closure, which is used for
+// arrays given relative to the element, like .Friends of "all(Users, {any(.Friends, {".
+func elementOf(config *conf.Config, source string) reflect.Type {
+	if matching(source, '{', '}') < 0 {
+		return nil
+	}
+	return elementType(config, source)
+}
+
+// fields returns fields and methods of struct.
+func fields(t reflect.Type) []Candidate {
+	var candidates []Candidate
+	for t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		for name, tag := range conf.FieldsFromStruct(t) {
+			if tag.Ambiguous {
+				continue
+			}
+			f := t.FieldByIndex(tag.FieldIndex)
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+			candidates = append(candidates, Candidate{Label: name, Kind: Field, Type: typeName(f.Type), Doc: f.Tag.Get("doc")})
+		}
+	}
+	types := []reflect.Type{t}
+	if t.Kind() != reflect.Interface {
+		types = append(types, reflect.PtrTo(t))
+	}
+	for _, t := range types {
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			if t.Kind() != reflect.Interface {
+				m.Type = conf.MethodType(m.Type)
+			}
+			candidates = append(candidates, Candidate{Label: m.Name, Kind: Method, Type: Signatures(m.Name, []reflect.Type{m.Type})})
+		}
+	}
+	return candidates
+}
+
+// keys returns keys of map, which is the value of path in the environment.
+// Only paths without calls are evaluated.
+func keys(config *conf.Config, path string) []Candidate {
+	if config.Env == nil {
+		return nil
+	}
+	tree, err := parser.Parse(path)
+	if err != nil {
+		return nil
+	}
+	calls := false
+	ast.Walk(&tree.Node, visitor(func(node ast.Node) {
+		switch node.(type) {
+		case *ast.CallNode, *ast.BuiltinNode, *ast.ClosureNode:
+			calls = true
+		}
+	}))
+	if calls {
+		return nil
+	}
+	program, err := expr.Compile(path, expr.Env(config.Env))
+	if err != nil {
+		return nil
+	}
+	value, err := expr.Run(program, config.Env)
+	if err != nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	var candidates []Candidate
+	for _, key := range v.MapKeys() {
+		candidates = append(candidates, Candidate{Label: key.String(), Kind: Key, Type: typeName(reflect.TypeOf(v.MapIndex(key).Interface()))})
+	}
+	return candidates
+}
+
+type visitor func(node ast.Node)
+
+func (v visitor) Visit(node *ast.Node) {
+	v(*node)
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "interface {}"
+	}
+	return t.String()
+}
+
+// Signatures returns declarations of the function of the types, one per
+// line, like "upper(string) string", or "" if types are unknown.
+func Signatures(name string, types []reflect.Type) string {
+	if len(types) == 0 {
+		return ""
+	}
+	lines := make([]string, len(types))
+	for i, t := range types {
+		lines[i] = name + strings.TrimPrefix(t.String(), "func")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,150 @@
+package completion_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/completion"
+	"github.com/antonmedv/expr/conf"
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	City    string `doc:"Name of the city."`
+	country string
+}
+
+type user struct {
+	Name    string
+	Age     int
+	Address *address
+	Friends []user
+	Tags    map[string]string
+}
+
+func (u user) Greet(greeting string) string { return greeting + ", " + u.Name }
+
+type env struct {
+	User     user
+	Users    []user
+	Settings map[string]interface{}
+	Limit    int
+}
+
+func (env) Lookup(id int) user { return user{} }
+
+func newEnv() env {
+	return env{Settings: map[string]interface{}{"theme": "dark", "timeout": 30}}
+}
+
+// complete returns labels of candidates at | of the source.
+func complete(t *testing.T, source string, ops ...expr.Option) []string {
+	offset := strings.Index(source, "|")
+	require.True(t, offset >= 0, "no cursor in %v", source)
+	source = source[:offset] + source[offset+1:]
+	result := completion.Complete(source, offset, newEnv(), ops...)
+	labels := []string{}
+	for _, c := range result.Candidates {
+		labels = append(labels, c.Label)
+	}
+	return labels
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{`Us|`, []string{"User", "Users"}},
+		{`Li|`, []string{"Limit", "like"}},
+		{`Lo|`, []string{"Lookup", "log"}},
+		{`1 + co|`, []string{"correlation", "count", "convert", "contains"}},
+		{`st|`, []string{"stddev", "stats", "strings", "startsWith"}},
+		{`stats.s|`, []string{"stddev"}},
+		{`User.|`, []string{"Address", "Age", "Friends", "Name", "Tags", "Greet"}},
+		{`User.a|`, []string{"Address", "Age"}},
+		{`User.Address.|`, []string{"City"}},
+		{`User?.Address?.C|`, []string{"City"}},
+		{`Users[0].Friends[len(Users) - 1].N|`, []string{"Name"}},
+		{`Lookup(1).N|`, []string{}},
+		{`Settings.t|`, []string{"theme", "timeout"}},
+		{`strings.tr|`, []string{"trim", "trimPrefix", "trimSuffix"}},
+		{`math.|.abs`, []string{"abs", "ceil", "floor", "max", "min", "pow", "round", "sqrt"}},
+		{`all(Users, {.|`, []string{"Address", "Age", "Friends", "Name", "Tags", "Greet"}},
+		{`all(Users, {#.Address.|`, []string{"City"}},
+		{`all(Users, { any(.Friends, {.N|`, []string{"Name"}},
+		{`map(filter(Users, {.Age > Limit}), {.|`, []string{"Address", "Age", "Friends", "Name", "Tags", "Greet"}},
+		{`all(Users, {.Age > 0}) && .|`, []string{}},
+		{`"str".|`, []string{}},
+		{`1.|`, []string{}},
+		{`12|`, []string{}},
+		{`Unknown.|`, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			require.Equal(t, tt.want, complete(t, tt.source))
+		})
+	}
+}
+
+func TestComplete_range(t *testing.T) {
+	source := `User.Na + "ö" + Us`
+	result := completion.Complete(source, 6, newEnv())
+	require.Equal(t, 5, result.From)
+	require.Equal(t, 7, result.To)
+	require.Equal(t, "Name", result.Candidates[0].Label)
+
+	result = completion.Complete(source, len(source), newEnv())
+	require.Equal(t, len(source)-2, result.From)
+	require.Equal(t, len(source), result.To)
+}
+
+func TestComplete_candidates(t *testing.T) {
+	result := completion.Complete(`User.Address.C`, 14, newEnv())
+	require.Equal(t, []completion.Candidate{
+		{Label: "City", Kind: completion.Field, Type: "string", Doc: "Name of the city."},
+	}, result.Candidates)
+
+	result = completion.Complete(`User.Gr`, 7, newEnv())
+	require.Equal(t, []completion.Candidate{
+		{Label: "Greet", Kind: completion.Method, Type: "Greet(string) string"},
+	}, result.Candidates)
+
+	result = completion.Complete(`hash.sha`, 8, nil)
+	require.Equal(t, []completion.Candidate{
+		{Label: "sha256", Kind: completion.Function, Type: "sha256(string) string", Doc: "Returns hex encoded SHA-256 digest of string."},
+	}, result.Candidates)
+
+	result = completion.Complete(`Settings.ti`, 11, newEnv())
+	require.Equal(t, []completion.Candidate{
+		{Label: "timeout", Kind: completion.Key, Type: "int"},
+	}, result.Candidates)
+}
+
+func TestComplete_ranking(t *testing.T) {
+	// Exact case first, then variables before functions and keywords.
+	require.Equal(t, []string{"Limit", "Lookup", "len", "levenshtein", "log", "like"}, complete(t, `L|`))
+	require.Equal(t, []string{"len", "levenshtein", "log", "like", "Limit", "Lookup"}, complete(t, `l|`))
+	require.Equal(t, []string{"none", "net", "nil", "not"}, complete(t, `User.Age > 0 && n|`))
+}
+
+func TestComplete_options(t *testing.T) {
+	require.Equal(t, []string{}, complete(t, `strings.|`, expr.DisableBuiltins("strings")))
+	require.Equal(t, []string{"values"}, complete(t, `maps.va|`, expr.Builtins("maps.values")))
+	require.Equal(t, []string{"values", "variance"}, complete(t, `va|`))
+}
+
+func TestSignatures(t *testing.T) {
+	types := []reflect.Type{
+		reflect.TypeOf(func(string) string { return "" }),
+		reflect.TypeOf(func(...int) int { return 0 }),
+	}
+	require.Equal(t, "f(string) string\nf(...int) int", completion.Signatures("f", types))
+	require.Equal(t, "", completion.Signatures("f", nil))
+
+	method, ok := reflect.TypeOf(user{}).MethodByName("Greet")
+	require.True(t, ok)
+	require.Equal(t, "Greet(string) string", completion.Signatures("Greet", []reflect.Type{conf.MethodType(method.Type)}))
+}
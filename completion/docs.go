@@ -0,0 +1,22 @@
+package completion
+
+var keywords = []string{
+	"true", "false", "nil", "not", "in", "and", "or",
+	"matches", "like", "contains", "startsWith", "endsWith",
+}
+
+// Builtins of the parser have no types of functions.
+var builtinSignatures = map[string]string{
+	"len":      "len(v) int",
+	"all":      "all(array, {predicate}) bool",
+	"none":     "none(array, {predicate}) bool",
+	"any":      "any(array, {predicate}) bool",
+	"one":      "one(array, {predicate}) bool",
+	"filter":   "filter(array, {predicate}) array",
+	"map":      "map(array, {closure}) array",
+	"count":    "count(array, {predicate}) int",
+	"try":      "try(v, fallback)",
+	"fallback": "fallback(v, default)",
+	"fold":     "fold(array, let name = init, ..., {name = value; ...})",
+	"reduce":   "reduce(array, {#acc ...}[, initial])",
+}
@@ -3,11 +3,23 @@ package conf
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/audit"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/logging"
+	"github.com/antonmedv/expr/metrics"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/tracing"
 	"github.com/antonmedv/expr/vm/runtime"
 )
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
 type Config struct {
 	Env         interface{}
 	Types       TypesTable
@@ -19,14 +31,119 @@ type Config struct {
 	Strict      bool
 	ConstFns    map[string]reflect.Value
 	Visitors    []ast.Visitor
+	Functions   map[string]*builtin.Function
+	OperatorFns OperatorFuncsTable
+	Infix       map[string]int
+	Memoized    map[string]bool
+	CacheSize   int
+	// ZeroDivision overrides result of division and modulo by zero.
+	ZeroDivision *runtime.ZeroDivision
+	// FloatEqual makes == and != compare floats approximately.
+	FloatEqual *runtime.FloatEqual
+	// NonFinite overrides propagation of NaN and infinities.
+	NonFinite *runtime.NonFinite
+	// Translator translates messages of errors and warnings.
+	Translator file.Translator
+	// Deterministic rejects calls of non-deterministic builtins.
+	Deterministic bool
+	// Broadcast allows element-wise arithmetic of arrays and numbers.
+	Broadcast bool
+	// Definitions are sources of named sub-expressions, which replace
+	// identifiers with their names.
+	Definitions map[string]string
+	// Units of measure of fields by paths, like "trip.distance", which
+	// override struct tags, like `unit:"m"`.
+	Units map[string]string
+	// Limits of sizes of compiled programs.
+	Limits Limits
+	// AllowFields are patterns of paths of members of the environment,
+	// like "user.Name" or "order.*", which expressions may use. If empty,
+	// all members are allowed.
+	AllowFields []string
+	// DenyFields are patterns of paths of members of the environment,
+	// which expressions may not use.
+	DenyFields []string
+	// Sensitive are paths of fields of the environment, like "user.SSN",
+	// which taints are tracked by the VM.
+	Sensitive []string
+	// Audit receives records of runs of the program, if not nil.
+	Audit *audit.Config
+	// Timeouts of calls of functions, which first parameter is
+	// context.Context, by paths of functions, like "db.Lookup". The
+	// timeout of the empty path applies to other functions.
+	Timeouts map[string]time.Duration
+	// Metrics receives measurements of compilations and runs, if not nil.
+	Metrics *metrics.Config
+	// Tracing starts spans of runs and calls, if not nil.
+	Tracing *tracing.Config
+	// Logging routes entries of the log builtin to the logger, if not nil.
+	Logging *logging.Config
+	// ImplicitReceiver is the variable of the environment, which fields
+	// are used as variables, like Amount of order.Amount.
+	ImplicitReceiver string
+	// Rules are custom semantic checks, which run after type checking.
+	Rules []Rule
+	// Converters convert values of types of the environment on access.
+	Converters runtime.Converters
+	// LangVersion of the language of expressions, or zero for
+	// LatestLangVersion. Syntax and semantics introduced by later versions
+	// are not available.
+	LangVersion int
 }
 
-func New(env interface{}) *Config {
+// LatestLangVersion is the version of the language of expressions compiled
+// without LangVersion. Version 1 is the language of expr 1.9. Version 2 adds
+// operators like and ??, let bindings, tuples, comprehensions, #index and
+// #acc in closures, and builtins try, fallback, fold and reduce, which names
+// are identifiers of the environment in version 1.
+const LatestLangVersion = parser.LatestVersion
+
+// Limits of sizes of compiled programs, like numbers of instructions and
+// constants, and the maximum depth of the stack. Programs exceeding limits
+// are rejected by compilation. Zero values are no limits.
+type Limits struct {
+	Bytecode  int
+	Constants int
+	Stack     int
+}
+
+// LimitError is returned for programs exceeding Limits.
+type LimitError struct {
+	// Limit is the exceeded limit: "bytecode", "constants" or "stack".
+	Limit   string
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+// CreateNew creates new config with default values.
+func CreateNew() *Config {
 	c := &Config{
-		Operators: make(map[string][]string),
-		ConstFns:  make(map[string]reflect.Value),
-		Optimize:  true,
+		Operators:   make(map[string][]string),
+		ConstFns:    make(map[string]reflect.Value),
+		Functions:   make(map[string]*builtin.Function),
+		OperatorFns: make(OperatorFuncsTable),
+		Infix:       make(map[string]int),
+		Memoized:    make(map[string]bool),
+		Definitions: make(map[string]string),
+		Optimize:    true,
+	}
+	for _, f := range builtin.Builtins {
+		c.Functions[f.Name] = f
 	}
+	for alias, name := range builtin.Aliases {
+		if f, ok := c.Functions[name]; ok {
+			c.Functions[alias] = f
+		}
+	}
+	return c
+}
+
+// New creates new config with environment.
+func New(env interface{}) *Config {
+	c := CreateNew()
 	c.WithEnv(env)
 	return c
 }
@@ -66,6 +183,127 @@ func (c *Config) Operator(operator string, fns ...string) {
 	}
 }
 
+// OperatorFunc overloads a binary operator with Go functions accepting two
+// arguments and returning a value (and optionally an error).
+func (c *Config) OperatorFunc(operator string, fns ...interface{}) {
+	for _, fn := range fns {
+		v := reflect.ValueOf(fn)
+		t := v.Type()
+		if t.Kind() != reflect.Func {
+			panic(fmt.Errorf("operator function for %s operator must be a function (got %v)", operator, t))
+		}
+		if t.NumIn() != 2 || t.IsVariadic() || t.NumOut() < 1 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+			panic(fmt.Errorf("operator function %v for %s operator does not have a correct signature", t, operator))
+		}
+		c.OperatorFns[operator] = append(c.OperatorFns[operator], &builtin.Function{
+			Name:  operator,
+			Func:  callFunc(v),
+			Types: []reflect.Type{t},
+			// Do not evaluate user functions during compilation.
+			NoFold: true,
+		})
+	}
+}
+
+// Overload registers Go functions as overloads of function with given name.
+// Overload is selected by types of arguments.
+func (c *Config) Overload(name string, fns ...interface{}) {
+	overloads := make([]*builtin.Function, len(fns))
+	for i, fn := range fns {
+		v := reflect.ValueOf(fn)
+		t := v.Type()
+		if t.Kind() != reflect.Func {
+			panic(fmt.Errorf("overload of %v must be a function (got %v)", name, t))
+		}
+		if t.NumOut() < 1 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+			panic(fmt.Errorf("overload %v of %v does not have a correct signature", t, name))
+		}
+		overloads[i] = &builtin.Function{
+			Name:  name,
+			Func:  callFunc(v),
+			Types: []reflect.Type{t},
+			// Do not evaluate user functions during compilation.
+			NoFold: true,
+		}
+	}
+	c.Builtin(&builtin.Function{
+		Name:      name,
+		Overloads: overloads,
+	})
+}
+
+// Converter registers functions of one parameter and one result, which
+// convert values of types of their parameters on access, like timestamps of
+// protobuf to time.Time.
+func (c *Config) Converter(fns ...interface{}) {
+	for _, fn := range fns {
+		v := reflect.ValueOf(fn)
+		t := v.Type()
+		if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 1 || t.IsVariadic() {
+			panic(fmt.Errorf("converter must be a function of one parameter and one result (got %v)", t))
+		}
+		if c.Converters == nil {
+			c.Converters = make(runtime.Converters)
+		}
+		c.Converters[t.In(0)] = v
+	}
+}
+
+// Memoize marks functions with given names as pure, so results of their calls
+// are cached within one run of a program.
+func (c *Config) Memoize(names ...string) {
+	for _, name := range names {
+		c.Memoized[name] = true
+	}
+}
+
+// ParserOptions returns options of parsing of the config, like custom infix
+// operators and the version of the language.
+func (c *Config) ParserOptions() parser.Options {
+	if c == nil {
+		return parser.Options{}
+	}
+	return parser.Options{
+		Infix:      c.Infix,
+		Version:    c.LangVersion,
+		Translator: c.Translator,
+	}
+}
+
+// InfixOperator registers custom infix operator with given precedence.
+// Expression `a name b` is parsed as call `name(a, b)`.
+func (c *Config) InfixOperator(name string, precedence int) {
+	for _, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			panic(fmt.Errorf("infix operator %q must be a valid identifier", name))
+		}
+	}
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		panic(fmt.Errorf("infix operator %q must be a valid identifier", name))
+	}
+	c.Infix[name] = precedence
+}
+
+// callFunc wraps Go function into builtin function.
+func callFunc(fn reflect.Value) func(args ...interface{}) (interface{}, error) {
+	t := fn.Type()
+	return func(args ...interface{}) (interface{}, error) {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			if arg == nil {
+				if t.IsVariadic() && i >= t.NumIn()-1 {
+					in[i] = reflect.Zero(t.In(t.NumIn() - 1).Elem())
+				} else {
+					in[i] = reflect.Zero(t.In(i))
+				}
+			} else {
+				in[i] = reflect.ValueOf(arg)
+			}
+		}
+		return runtime.Results(t, fn.Call(in))
+	}
+}
+
 func (c *Config) ConstExpr(name string) {
 	if c.Env == nil {
 		panic("no environment is specified for ConstExpr()")
@@ -76,3 +314,90 @@ func (c *Config) ConstExpr(name string) {
 	}
 	c.ConstFns[name] = fn
 }
+
+// Builtins restricts builtin functions to given functions and namespaces,
+// like Builtins("json.encode", "strings").
+func (c *Config) Builtins(names ...string) {
+	for name, f := range c.Functions {
+		if !matchBuiltin(name, names) && !matchBuiltin(f.Name, names) {
+			delete(c.Functions, name)
+		}
+	}
+}
+
+// DisableBuiltins removes given builtin functions and namespaces.
+func (c *Config) DisableBuiltins(names ...string) {
+	for name, f := range c.Functions {
+		if matchBuiltin(name, names) || matchBuiltin(f.Name, names) {
+			delete(c.Functions, name)
+		}
+	}
+}
+
+// Builtin adds builtin functions, or overrides existing ones with the same
+// name. Builtins of namespaces are added by their aliases too, like toJSON of
+// json.encode, see builtin.Aliases.
+func (c *Config) Builtin(fns ...*builtin.Function) {
+	for _, f := range fns {
+		if f.Func == nil && len(f.Overloads) > 0 {
+			f.Func = builtin.Dispatch(f.Name, f.Overloads).Func
+		}
+		if f.Name == "" || f.Func == nil {
+			panic(fmt.Errorf("builtin function must have a name and a func"))
+		}
+		for _, o := range f.Overloads {
+			if o.Func == nil || len(o.Types) != 1 {
+				panic(fmt.Errorf("overload of %v must have a func and a single type", f.Name))
+			}
+		}
+		if len(f.Defaults) > 0 {
+			checkDefaults(f)
+		}
+		c.Functions[f.Name] = f
+		for alias, name := range builtin.Aliases {
+			if name == f.Name {
+				c.Functions[alias] = f
+			}
+		}
+	}
+}
+
+// checkDefaults panics if defaults of the function can not be passed as
+// trailing parameters of each of its signatures.
+func checkDefaults(f *builtin.Function) {
+	if len(f.Types) == 0 {
+		panic(fmt.Errorf("defaults of %v require types", f.Name))
+	}
+	for _, fn := range f.Types {
+		numIn := fn.NumIn()
+		if fn.IsVariadic() {
+			numIn--
+		}
+		if len(f.Defaults) > numIn {
+			panic(fmt.Errorf("too many defaults for %v (%v)", f.Name, fn))
+		}
+		for i, d := range f.Defaults {
+			in := fn.In(numIn - len(f.Defaults) + i)
+			if d == nil {
+				switch in.Kind() {
+				case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+					continue
+				}
+			} else if reflect.TypeOf(d).AssignableTo(in) {
+				continue
+			}
+			panic(fmt.Errorf("cannot use %#v as default of %v (type %v)", d, f.Name, in))
+		}
+	}
+}
+
+// matchBuiltin reports whether function name is one of names, or belongs
+// to one of namespaces in names.
+func matchBuiltin(name string, names []string) bool {
+	for _, n := range names {
+		if name == n || strings.HasPrefix(name, n+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -4,8 +4,12 @@ import (
 	"reflect"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/vm/runtime"
 )
 
+var interfaceType = reflect.TypeOf(new(interface{})).Elem()
+
 // OperatorsTable maps binary operators to corresponding list of functions.
 // Functions should be provided in the environment to allow operator overloading.
 type OperatorsTable map[string][]string
@@ -20,17 +24,85 @@ func FindSuitableOperatorOverload(fns []string, types TypesTable, l, r reflect.T
 		firstArgType := fnType.Type.In(firstInIndex)
 		secondArgType := fnType.Type.In(firstInIndex + 1)
 
-		firstArgumentFit := l == firstArgType || (firstArgType.Kind() == reflect.Interface && (l == nil || l.Implements(firstArgType)))
-		secondArgumentFit := r == secondArgType || (secondArgType.Kind() == reflect.Interface && (r == nil || r.Implements(secondArgType)))
-		if firstArgumentFit && secondArgumentFit {
+		if argumentFits(l, firstArgType) && argumentFits(r, secondArgType) {
 			return fnType.Type.Out(0), fn, true
 		}
 	}
 	return nil, "", false
 }
 
+func argumentFits(arg, param reflect.Type) bool {
+	return arg == param || (param.Kind() == reflect.Interface && (arg == nil || arg.Implements(param)))
+}
+
+// OperatorFuncsTable maps binary operators to corresponding list of Go
+// functions registered with Config.OperatorFunc.
+type OperatorFuncsTable map[string][]*builtin.Function
+
+// findOperatorFunc returns function what accepts operands of given types.
+func findOperatorFunc(fns []*builtin.Function, l, r reflect.Type) (*builtin.Function, bool) {
+	for _, fn := range fns {
+		fnType := fn.Types[0]
+		if argumentFits(l, fnType.In(0)) && argumentFits(r, fnType.In(1)) {
+			return fn, true
+		}
+	}
+	return nil, false
+}
+
+// mayFit reports whether some of functions may accept operands at runtime,
+// if type of one or both operands is unknown.
+func mayFit(fns []*builtin.Function, l, r reflect.Type) bool {
+	isAny := func(t reflect.Type) bool { return t != nil && t.Kind() == reflect.Interface }
+	if !isAny(l) && !isAny(r) {
+		return false
+	}
+	for _, fn := range fns {
+		fnType := fn.Types[0]
+		if (isAny(l) || argumentFits(l, fnType.In(0))) && (isAny(r) || argumentFits(r, fnType.In(1))) {
+			return true
+		}
+	}
+	return false
+}
+
+// operatorFallbacks implement default behaviour of operators, used if none of
+// operator functions accept operands at runtime.
+var operatorFallbacks = map[string]func(a, b interface{}) interface{}{
+	"+":  func(a, b interface{}) interface{} { return runtime.Add(a, b) },
+	"-":  func(a, b interface{}) interface{} { return runtime.Subtract(a, b) },
+	"*":  func(a, b interface{}) interface{} { return runtime.Multiply(a, b) },
+	"/":  func(a, b interface{}) interface{} { return runtime.Divide(a, b) },
+	"%":  func(a, b interface{}) interface{} { return runtime.Modulo(a, b) },
+	"**": func(a, b interface{}) interface{} { return runtime.Exponent(a, b) },
+	"^":  func(a, b interface{}) interface{} { return runtime.Exponent(a, b) },
+	"==": func(a, b interface{}) interface{} { return runtime.Equal(a, b) },
+	"!=": func(a, b interface{}) interface{} { return !runtime.Equal(a, b) },
+	"<":  func(a, b interface{}) interface{} { return runtime.Less(a, b) },
+	">":  func(a, b interface{}) interface{} { return runtime.More(a, b) },
+	"<=": func(a, b interface{}) interface{} { return runtime.LessOrEqual(a, b) },
+	">=": func(a, b interface{}) interface{} { return runtime.MoreOrEqual(a, b) },
+}
+
+// dispatch returns function what calls one of fns accepting operands at
+// runtime, or applies default operator behaviour.
+func dispatch(operator string, fns []*builtin.Function) *builtin.Function {
+	fallback := operatorFallbacks[operator]
+	return &builtin.Function{
+		Name: operator,
+		Func: func(args ...interface{}) (interface{}, error) {
+			l, r := reflect.TypeOf(args[0]), reflect.TypeOf(args[1])
+			if fn, ok := findOperatorFunc(fns, l, r); ok {
+				return fn.Func(args...)
+			}
+			return fallback(args[0], args[1]), nil
+		},
+	}
+}
+
 type OperatorPatcher struct {
 	Operators OperatorsTable
+	Funcs     OperatorFuncsTable
 	Types     TypesTable
 }
 
@@ -40,6 +112,20 @@ func (p *OperatorPatcher) Visit(node *ast.Node) {
 		return
 	}
 
+	if fns, ok := p.Funcs[binaryNode.Operator]; ok {
+		leftType := binaryNode.Left.Type()
+		rightType := binaryNode.Right.Type()
+
+		if fn, ok := findOperatorFunc(fns, leftType, rightType); ok {
+			p.patchFunc(node, fn, fn.Types[0].Out(0))
+			return
+		}
+		if _, ok := operatorFallbacks[binaryNode.Operator]; ok && mayFit(fns, leftType, rightType) {
+			p.patchFunc(node, dispatch(binaryNode.Operator, fns), interfaceType)
+			return
+		}
+	}
+
 	fns, ok := p.Operators[binaryNode.Operator]
 	if !ok {
 		return
@@ -57,3 +143,15 @@ func (p *OperatorPatcher) Visit(node *ast.Node) {
 		ast.Patch(node, newNode)
 	}
 }
+
+func (p *OperatorPatcher) patchFunc(node *ast.Node, fn *builtin.Function, t reflect.Type) {
+	binaryNode := (*node).(*ast.BinaryNode)
+	newNode := &ast.CallNode{
+		Callee:    &ast.IdentifierNode{Value: binaryNode.Operator},
+		Arguments: []ast.Node{binaryNode.Left, binaryNode.Right},
+		Func:      fn,
+	}
+	ast.Patch(node, newNode)
+	// Set result type, so operators of outer nodes can be resolved as well.
+	newNode.SetType(t)
+}
@@ -0,0 +1,46 @@
+package conf
+
+import (
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/file"
+)
+
+// Rule is a custom semantic check of expressions, which runs after type
+// checking, like a check that calls of httpGet are forbidden. Check is
+// called for every node of the typed tree, children first, and reports
+// errors, which reject expressions, and warnings of programs.
+type Rule struct {
+	Name  string
+	Check func(report *Report, node ast.Node)
+}
+
+// Report of diagnostics of rules. Diagnostics span sources of their nodes.
+type Report struct {
+	// Config of the checked expression.
+	Config   *Config
+	Errors   []*file.Error
+	Warnings []*file.Error
+	// Span returns the start and the end of the source of the node, if
+	// known.
+	Span func(node ast.Node) (start, end file.Location, ok bool)
+}
+
+// Errorf reports the error at the node, which rejects the expression.
+func (r *Report) Errorf(node ast.Node, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, r.diagnostic(node, format, args))
+}
+
+// Warnf reports the warning at the node.
+func (r *Report) Warnf(node ast.Node, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, r.diagnostic(node, format, args))
+}
+
+func (r *Report) diagnostic(node ast.Node, format string, args []interface{}) *file.Error {
+	e := file.Errorf(node.Location(), format, args...)
+	if r.Span != nil {
+		if start, end, ok := r.Span(node); ok {
+			e.Location, e.End = start, end
+		}
+	}
+	return e
+}
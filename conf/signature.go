@@ -0,0 +1,172 @@
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Signature of environment: identifiers of the environment, and fields and
+// methods of their named types, with types.
+type Signature struct {
+	// Hash is hex encoded SHA-256 of the manifest.
+	Hash string `json:"hash"`
+	// Manifest is a sorted list of lines "name type", like "Age int" for
+	// a variable of the environment and "main.User.Greet func(string) string"
+	// for a method of a named type.
+	Manifest []string `json:"manifest"`
+}
+
+// EnvSignature returns signature of the environment. Signatures of maps
+// depend on types of their values.
+func EnvSignature(env interface{}) *Signature {
+	s := &signer{seen: make(map[reflect.Type]bool)}
+	for name, tag := range CreateTypesTable(env) {
+		if tag.Ambiguous {
+			s.add(name, "ambiguous")
+			continue
+		}
+		t := tag.Type
+		if tag.Method {
+			t = MethodType(t)
+		}
+		s.add(name, typeString(t))
+		s.visit(t)
+	}
+	sort.Strings(s.manifest)
+	sum := sha256.Sum256([]byte(strings.Join(s.manifest, "\n")))
+	return &Signature{Hash: hex.EncodeToString(sum[:]), Manifest: s.manifest}
+}
+
+// Diff returns lines of manifest missing in other prefixed with "- ", and
+// lines of other missing in manifest prefixed with "+ ", sorted by names,
+// so changed types are removed lines followed by added lines.
+func (s *Signature) Diff(other *Signature) []string {
+	lines := make(map[string]bool, len(s.Manifest))
+	for _, line := range s.Manifest {
+		lines[line] = true
+	}
+	otherLines := make(map[string]bool, len(other.Manifest))
+	for _, line := range other.Manifest {
+		otherLines[line] = true
+	}
+	var diff []string
+	for _, line := range s.Manifest {
+		if !otherLines[line] {
+			diff = append(diff, "- "+line)
+		}
+	}
+	for _, line := range other.Manifest {
+		if !lines[line] {
+			diff = append(diff, "+ "+line)
+		}
+	}
+	sort.SliceStable(diff, func(i, j int) bool {
+		return nameOf(diff[i]) < nameOf(diff[j])
+	})
+	return diff
+}
+
+// SignatureError is returned for environments, which signatures differ from
+// signature of the environment of compilation.
+type SignatureError struct {
+	Diff []string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("environment differs from environment of compilation:\n%v", strings.Join(e.Diff, "\n"))
+}
+
+type signer struct {
+	manifest []string
+	seen     map[reflect.Type]bool
+}
+
+func (s *signer) add(name, typ string) {
+	s.manifest = append(s.manifest, name+" "+typ)
+}
+
+// visit adds fields and methods of named types in t.
+func (s *signer) visit(t reflect.Type) {
+	if t == nil || s.seen[t] {
+		return
+	}
+	s.seen[t] = true
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		s.visit(t.Elem())
+		return
+	case reflect.Map:
+		s.visit(t.Key())
+		s.visit(t.Elem())
+		return
+	case reflect.Func:
+		for i := 0; i < t.NumIn(); i++ {
+			s.visit(t.In(i))
+		}
+		for i := 0; i < t.NumOut(); i++ {
+			s.visit(t.Out(i))
+		}
+		return
+	}
+	if t.Kind() == reflect.Struct {
+		for name, tag := range FieldsFromStruct(t) {
+			if tag.Ambiguous {
+				continue
+			}
+			if t.Name() != "" && t.FieldByIndex(tag.FieldIndex).PkgPath == "" {
+				s.add(t.String()+"."+name, typeString(tag.Type))
+			}
+			s.visit(tag.Type)
+		}
+	}
+	if t.Name() == "" {
+		return
+	}
+	// Methods of pointers include methods of values.
+	methods := t
+	if t.Kind() != reflect.Interface {
+		methods = reflect.PtrTo(t)
+	}
+	for i := 0; i < methods.NumMethod(); i++ {
+		m := methods.Method(i)
+		mt := m.Type
+		if t.Kind() != reflect.Interface {
+			mt = MethodType(mt)
+		}
+		s.add(t.String()+"."+m.Name, typeString(mt))
+		s.visit(mt)
+	}
+}
+
+// nameOf returns name of the line of diff.
+func nameOf(line string) string {
+	line = line[2:]
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func typeString(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+	return t.String()
+}
+
+// withoutReceiver returns type of method without its receiver.
+func MethodType(t reflect.Type) reflect.Type {
+	in := make([]reflect.Type, 0, t.NumIn())
+	for i := 1; i < t.NumIn(); i++ {
+		in = append(in, t.In(i))
+	}
+	out := make([]reflect.Type, 0, t.NumOut())
+	for i := 0; i < t.NumOut(); i++ {
+		out = append(out, t.Out(i))
+	}
+	return reflect.FuncOf(in, out, t.IsVariadic())
+}
@@ -0,0 +1,101 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// importPath matches import paths of package names in strings of types.
+var importPath = regexp.MustCompile(`[\w.~-]+/`)
+
+// typeNames are names of types built at runtime, which have no names in Go,
+// and named is true, if there are any.
+var (
+	typeNames sync.Map
+	named     int32
+)
+
+// NameType sets the name of the type built at runtime, like a struct type of
+// reflect.StructOf, which is used in messages and documentation instead of
+// its definition.
+func NameType(t reflect.Type, name string) {
+	typeNames.Store(t, name)
+	atomic.StoreInt32(&named, 1)
+}
+
+// TypeString returns string of the type, like t.String(), but with package
+// names instead of import paths in type arguments of instantiated generic
+// types, like in Go source: "pkg.List[pkg.Order]" instead of
+// "pkg.List[example.com/pkg.Order]", and with names of NameType.
+func TypeString(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+	if atomic.LoadInt32(&named) == 1 {
+		return namedString(t)
+	}
+	return shortenTypeArguments(t.String())
+}
+
+// namedString returns string of the type with names of types of NameType.
+func namedString(t reflect.Type) string {
+	if name, ok := typeNames.Load(t); ok {
+		return name.(string)
+	}
+	if t.Name() != "" {
+		return shortenTypeArguments(t.String())
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + namedString(t.Elem())
+	case reflect.Slice:
+		return "[]" + namedString(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%v]%v", t.Len(), namedString(t.Elem()))
+	case reflect.Map:
+		return "map[" + namedString(t.Key()) + "]" + namedString(t.Elem())
+	case reflect.Func:
+		in := make([]string, t.NumIn())
+		for i := range in {
+			in[i] = namedString(t.In(i))
+			if t.IsVariadic() && i == len(in)-1 {
+				in[i] = "..." + namedString(t.In(i).Elem())
+			}
+		}
+		s := "func(" + strings.Join(in, ", ") + ")"
+		switch t.NumOut() {
+		case 0:
+		case 1:
+			s += " " + namedString(t.Out(0))
+		default:
+			out := make([]string, t.NumOut())
+			for i := range out {
+				out[i] = namedString(t.Out(i))
+			}
+			s += " (" + strings.Join(out, ", ") + ")"
+		}
+		return s
+	}
+	return shortenTypeArguments(t.String())
+}
+
+// TypeName returns name of the type, like t.Name(), with package names in
+// type arguments, like TypeString, or the name of NameType.
+func TypeName(t reflect.Type) string {
+	if name, ok := typeNames.Load(t); ok {
+		return name.(string)
+	}
+	return shortenTypeArguments(t.Name())
+}
+
+func shortenTypeArguments(s string) string {
+	i := strings.IndexByte(s, '[')
+	if i < 0 || !strings.Contains(s[i:], "/") {
+		return s
+	}
+	return s[:i] + importPath.ReplaceAllString(s[i:], "")
+}
@@ -2,6 +2,8 @@ package conf
 
 import (
 	"reflect"
+
+	"github.com/antonmedv/expr/vm/runtime"
 )
 
 type Tag struct {
@@ -20,11 +22,24 @@ type TypesTable map[string]Tag
 //
 // If map is passed, all items will be treated as variables
 // (key as name, value as type).
+//
+// If runtime.Layers is passed, variables of earlier layers override
+// variables of later layers.
 func CreateTypesTable(i interface{}) TypesTable {
 	if i == nil {
 		return nil
 	}
 
+	if layers, ok := i.(runtime.Layers); ok {
+		types := make(TypesTable)
+		for j := len(layers) - 1; j >= 0; j-- {
+			for name, tag := range CreateTypesTable(layers[j]) {
+				types[name] = tag
+			}
+		}
+		return types
+	}
+
 	types := make(TypesTable)
 	v := reflect.ValueOf(i)
 	t := reflect.TypeOf(i)
@@ -54,7 +69,12 @@ func CreateTypesTable(i interface{}) TypesTable {
 		for _, key := range v.MapKeys() {
 			value := v.MapIndex(key)
 			if key.Kind() == reflect.String && value.IsValid() && value.CanInterface() {
-				types[key.String()] = Tag{Type: reflect.TypeOf(value.Interface())}
+				t := reflect.TypeOf(value.Interface())
+				if t == nil {
+					// Type of nil value is unknown, use type of map values.
+					t = value.Type()
+				}
+				types[key.String()] = Tag{Type: t}
 			}
 		}
 
@@ -72,34 +92,55 @@ func CreateTypesTable(i interface{}) TypesTable {
 	return types
 }
 
+// FieldsFromStruct returns fields of the struct, and fields promoted from
+// embedded structs and pointers to structs by rules of Go: fields of
+// shallower embedded structs shadow fields of deeper ones, and many fields
+// of the same name at the same depth are ambiguous, even at depths deeper
+// than the depth of the first field of another name.
 func FieldsFromStruct(t reflect.Type) TypesTable {
 	types := make(TypesTable)
 	t = dereference(t)
-	if t == nil {
+	if t == nil || t.Kind() != reflect.Struct {
 		return types
 	}
 
-	switch t.Kind() {
-	case reflect.Struct:
-		for i := 0; i < t.NumField(); i++ {
-			f := t.Field(i)
-
-			if f.Anonymous {
-				for name, typ := range FieldsFromStruct(f.Type) {
-					if _, ok := types[name]; ok {
-						types[name] = Tag{Ambiguous: true}
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+	// Structs embedded at shallower depths are not visited again, which
+	// also stops recursion of structs embedding pointers to themselves.
+	visited := make(map[reflect.Type]bool)
+	current := []embedded{{t: t}}
+	for len(current) > 0 {
+		var next []embedded
+		depth := make(TypesTable)
+		for _, e := range current {
+			for i := 0; i < e.t.NumField(); i++ {
+				f := e.t.Field(i)
+				index := append(append([]int{}, e.index...), i)
+				name := FieldName(f)
+				if _, ok := types[name]; !ok {
+					if _, ok := depth[name]; ok {
+						depth[name] = Tag{Ambiguous: true}
 					} else {
-						typ.FieldIndex = append(f.Index, typ.FieldIndex...)
-						types[name] = typ
+						depth[name] = Tag{Type: f.Type, FieldIndex: index}
+					}
+				}
+				if f.Anonymous {
+					if d := dereference(f.Type); d != nil && d.Kind() == reflect.Struct && !visited[d] {
+						next = append(next, embedded{t: d, index: index})
 					}
 				}
 			}
-
-			types[FieldName(f)] = Tag{
-				Type:       f.Type,
-				FieldIndex: f.Index,
-			}
 		}
+		for _, e := range current {
+			visited[e.t] = true
+		}
+		for name, tag := range depth {
+			types[name] = tag
+		}
+		current = next
 	}
 
 	return types
@@ -0,0 +1,182 @@
+// Package coverage records branches of expressions reached by evaluations,
+// like both sides of conditionals, and reports branches which no evaluation
+// has reached.
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/vm"
+)
+
+// Kinds of branches.
+const (
+	Then      = "then"      // when condition of conditional is true
+	Else      = "else"      // when condition of conditional is false
+	Right     = "right"     // right side of and or or, if not short-circuited
+	Predicate = "predicate" // closure of builtin, if called for any element
+)
+
+// Branch of an expression, which runs may skip.
+type Branch struct {
+	Kind string
+	// Node is the root of the branch.
+	Node     ast.Node
+	Location file.Location
+	// Hits is the number of runs, which reached the branch.
+	Hits int
+
+	locations map[file.Location]bool
+}
+
+// MarshalJSON returns branch with its source, location and hits.
+func (b *Branch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Kind   string `json:"kind"`
+		Source string `json:"source"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+		Hits   int    `json:"hits"`
+	}{b.Kind, parser.Format(b.Node), b.Location.Line, b.Location.Column + 1, b.Hits})
+}
+
+func (b *Branch) String() string {
+	return fmt.Sprintf("%v:%v %v %v", b.Location.Line, b.Location.Column+1, b.Kind, parser.Format(b.Node))
+}
+
+// Coverage records branches of a program reached by its runs. Runs may be
+// concurrent.
+type Coverage struct {
+	Branches []*Branch
+	// Runs is the number of runs.
+	Runs    int
+	program *vm.Program
+	mu      sync.Mutex
+}
+
+// New returns coverage of branches of the program, in order of source.
+func New(program *vm.Program) *Coverage {
+	c := &Coverage{Branches: []*Branch{}, program: program}
+	add := func(kind string, node ast.Node) {
+		b := &Branch{Kind: kind, Node: node, locations: make(map[file.Location]bool)}
+		var nodes collector
+		ast.Walk(&node, &nodes)
+		for _, n := range nodes {
+			if loc := n.Location(); !loc.Empty() {
+				b.locations[loc] = true
+				if b.Location.Empty() || before(loc, b.Location) {
+					b.Location = loc
+				}
+			}
+		}
+		c.Branches = append(c.Branches, b)
+	}
+	var nodes collector
+	ast.Walk(&program.Node, &nodes)
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *ast.ConditionalNode:
+			add(Then, n.Exp1)
+			add(Else, n.Exp2)
+		case *ast.BinaryNode:
+			switch n.Operator {
+			case "and", "&&", "or", "||":
+				add(Right, n.Right)
+			}
+		case *ast.BuiltinNode:
+			for _, a := range n.Arguments {
+				if closure, ok := a.(*ast.ClosureNode); ok {
+					add(Predicate, closure.Node)
+				}
+			}
+		}
+	}
+	sort.SliceStable(c.Branches, func(i, j int) bool {
+		return before(c.Branches[i].Location, c.Branches[j].Location)
+	})
+	return c
+}
+
+// Run runs the program with env, and records reached branches.
+func (c *Coverage) Run(env interface{}) (interface{}, error) {
+	executed := make(map[file.Location]bool)
+	out, err := vm.Trace(func(ip int) {
+		if ip < len(c.program.Locations) {
+			executed[c.program.Locations[ip]] = true
+		}
+	}).Run(c.program, env)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Runs++
+	for _, b := range c.Branches {
+		for loc := range b.locations {
+			if executed[loc] {
+				b.Hits++
+				break
+			}
+		}
+	}
+	return out, err
+}
+
+// Missed returns branches, which no run has reached.
+func (c *Coverage) Missed() []*Branch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var missed []*Branch
+	for _, b := range c.Branches {
+		if b.Hits == 0 {
+			missed = append(missed, b)
+		}
+	}
+	return missed
+}
+
+// Percent returns percent of reached branches, or 100 if there are none.
+func (c *Coverage) Percent() float64 {
+	if len(c.Branches) == 0 {
+		return 100
+	}
+	return 100 * float64(len(c.Branches)-len(c.Missed())) / float64(len(c.Branches))
+}
+
+// String returns summary of coverage and missed branches, one per line.
+func (c *Coverage) String() string {
+	missed := c.Missed()
+	lines := []string{fmt.Sprintf("%.1f%% of %d branches", c.Percent(), len(c.Branches))}
+	for _, b := range missed {
+		lines = append(lines, "missed "+b.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MarshalJSON returns percent of reached branches, number of runs and all
+// branches.
+func (c *Coverage) MarshalJSON() ([]byte, error) {
+	percent := c.Percent()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Marshal(struct {
+		Percent  float64   `json:"percent"`
+		Runs     int       `json:"runs"`
+		Branches []*Branch `json:"branches"`
+	}{percent, c.Runs, c.Branches})
+}
+
+type collector []ast.Node
+
+func (c *collector) Visit(node *ast.Node) {
+	*c = append(*c, *node)
+}
+
+func before(a, b file.Location) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
@@ -0,0 +1,68 @@
+package coverage_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/coverage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverage(t *testing.T) {
+	program, err := expr.Compile(`all(items, {# > 0}) and (admin ? "yes" : "no") == "yes"`)
+	require.NoError(t, err)
+	cover := coverage.New(program)
+
+	_, err = cover.Run(map[string]interface{}{"items": []int{}, "admin": true})
+	require.NoError(t, err)
+
+	var kinds []string
+	for _, b := range cover.Branches {
+		kinds = append(kinds, b.Kind)
+	}
+	require.Equal(t, []string{coverage.Predicate, coverage.Right, coverage.Then, coverage.Else}, kinds)
+	require.Equal(t, "50.0% of 4 branches\nmissed 1:13 predicate # > 0\nmissed 1:42 else \"no\"", cover.String())
+
+	_, err = cover.Run(map[string]interface{}{"items": []int{1}, "admin": false})
+	require.NoError(t, err)
+	require.Empty(t, cover.Missed())
+	require.Equal(t, 1, cover.Branches[0].Hits)
+	require.Equal(t, 2, cover.Branches[1].Hits)
+}
+
+func TestReport(t *testing.T) {
+	adult, err := expr.Compile(`age >= 18 ? "adult" : "minor"`)
+	require.NoError(t, err)
+	vip, err := expr.Compile(`vip or age > 60`)
+	require.NoError(t, err)
+
+	report := coverage.NewReport()
+	report.Add("adult.expr", adult)
+	report.Add("vip.expr", vip)
+	for _, env := range []map[string]interface{}{{"age": 30, "vip": true}, {"age": 10, "vip": true}} {
+		_, err := report.Run("adult.expr", env)
+		require.NoError(t, err)
+		_, err = report.Run("vip.expr", env)
+		require.NoError(t, err)
+	}
+	_, err = report.Run("unknown.expr", nil)
+	require.Error(t, err)
+
+	names, missed := report.Uncovered()
+	require.Equal(t, []string{"vip.expr"}, names)
+	require.Equal(t, coverage.Right, missed["vip.expr"][0].Kind)
+	require.Equal(t, "adult.expr: 100.0% of 2 branches\nvip.expr: 0.0% of 1 branches\n  missed 1:8 right age > 60\n", report.String())
+
+	b, err := json.Marshal(report)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"adult.expr": {"percent": 100, "runs": 2, "branches": [
+			{"kind": "then", "source": "\"adult\"", "line": 1, "column": 13, "hits": 1},
+			{"kind": "else", "source": "\"minor\"", "line": 1, "column": 23, "hits": 1}
+		]},
+		"vip.expr": {"percent": 0, "runs": 2, "branches": [
+			{"kind": "right", "source": "age > 60", "line": 1, "column": 8, "hits": 0}
+		]}
+	}`, string(b))
+}
@@ -0,0 +1,92 @@
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/antonmedv/expr/vm"
+)
+
+// Report of coverage of several expressions by a corpus of evaluations.
+type Report struct {
+	names     []string
+	coverages map[string]*Coverage
+	mu        sync.Mutex
+}
+
+// NewReport returns empty report.
+func NewReport() *Report {
+	return &Report{coverages: make(map[string]*Coverage)}
+}
+
+// Add adds program to the report under name, like path of the file of the
+// expression, and returns its coverage. Programs added twice under the same
+// name share coverage.
+func (r *Report) Add(name string, program *vm.Program) *Coverage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.coverages[name]; ok {
+		return c
+	}
+	c := New(program)
+	r.names = append(r.names, name)
+	r.coverages[name] = c
+	return c
+}
+
+// Coverage returns coverage of the program added under name, or nil.
+func (r *Report) Coverage(name string) *Coverage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.coverages[name]
+}
+
+// Run runs the program added under name with env, and records reached
+// branches.
+func (r *Report) Run(name string, env interface{}) (interface{}, error) {
+	c := r.Coverage(name)
+	if c == nil {
+		return nil, fmt.Errorf("unknown program %v", name)
+	}
+	return c.Run(env)
+}
+
+// Uncovered returns names of programs with missed branches, in order of
+// addition, and missed branches of each.
+func (r *Report) Uncovered() ([]string, map[string][]*Branch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	missed := make(map[string][]*Branch)
+	for _, name := range r.names {
+		if m := r.coverages[name].Missed(); len(m) > 0 {
+			names = append(names, name)
+			missed[name] = m
+		}
+	}
+	return names, missed
+}
+
+// String returns coverage of each program, with missed branches indented.
+func (r *Report) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	for _, name := range r.names {
+		lines := strings.Split(r.coverages[name].String(), "\n")
+		fmt.Fprintf(&b, "%v: %v\n", name, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(&b, "  %v\n", line)
+		}
+	}
+	return b.String()
+}
+
+// MarshalJSON returns coverage of programs by names.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Marshal(r.coverages)
+}
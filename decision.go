@@ -0,0 +1,291 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/parser/lexer"
+	"github.com/antonmedv/expr/vm"
+)
+
+// Table is a decision table. Rules are checked in order, and the result is
+// the output of the first rule, which conditions match values of inputs.
+type Table struct {
+	// Inputs are expressions of values tested by conditions, like user.Age.
+	Inputs []string
+	Rules  []Rule
+	// Default is the expression of the result, if no rule matches. The
+	// result is nil, if Default is empty.
+	Default string
+}
+
+// Rule of a decision table with a condition for every input of the table.
+// Conditions are:
+//   - empty or "-", which match any value;
+//   - operators with operands, like "> 18", "in ['EU', 'US']" or
+//     "not startsWith 'test'", which are applied to the value;
+//   - ranges, like "18..65", which match values in the range;
+//   - other expressions, like `"gold"`, which match equal values.
+type Rule struct {
+	Conditions []string
+	Output     string
+}
+
+// comparisons are operators, which start conditions applied to values.
+var comparisons = map[string]bool{
+	"==":         true,
+	"!=":         true,
+	"<":          true,
+	">":          true,
+	"<=":         true,
+	">=":         true,
+	"in":         true,
+	"matches":    true,
+	"like":       true,
+	"contains":   true,
+	"startsWith": true,
+	"endsWith":   true,
+}
+
+// CompileTable compiles the decision table into a single program. Inputs
+// are evaluated once per run, and so are conditions used by many rules,
+// like `region in ["EU", "UK"]` of hundreds of rules of marketing
+// campaigns. Errors point to conditions and outputs in a source with a
+// line per input, condition and output.
+func CompileTable(table Table, ops ...Option) (*vm.Program, error) {
+	config := newConfig(ops)
+	t := &tableCompiler{config: config, conditions: make(map[string]*tableCondition)}
+
+	for i, rule := range table.Rules {
+		if len(rule.Conditions) != len(table.Inputs) {
+			return nil, fmt.Errorf("rule %v has %v conditions, expected %v", i+1, len(rule.Conditions), len(table.Inputs))
+		}
+		if strings.TrimSpace(rule.Output) == "" {
+			return nil, fmt.Errorf("rule %v has no output", i+1)
+		}
+		for j, cond := range rule.Conditions {
+			if key, ok := conditionKey(j, cond); ok {
+				if c, ok := t.conditions[key]; ok {
+					c.uses++
+				} else {
+					t.conditions[key] = &tableCondition{uses: 1}
+				}
+			}
+		}
+	}
+
+	t.inputs = make([]ast.Node, len(table.Inputs))
+	for i, input := range table.Inputs {
+		node, err := t.parse(input, fmt.Sprintf("input %v", i+1), "")
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := node.(*ast.IdentifierNode); !ok {
+			node = &ast.SharedNode{Name: fmt.Sprintf("input %v", i+1), Node: node}
+		}
+		t.inputs[i] = node
+	}
+
+	var result ast.Node = &ast.NilNode{}
+	if strings.TrimSpace(table.Default) != "" {
+		node, err := t.parse(table.Default, "default", "")
+		if err != nil {
+			return nil, err
+		}
+		result = node
+	}
+
+	outputs := make([]ast.Node, len(table.Rules))
+	matches := make([]ast.Node, len(table.Rules))
+	for i, rule := range table.Rules {
+		var match ast.Node
+		for j, cond := range rule.Conditions {
+			node, err := t.condition(i, j, cond)
+			if err != nil {
+				return nil, err
+			}
+			if node == nil {
+				continue
+			}
+			if match == nil {
+				match = node
+			} else {
+				match = &ast.BinaryNode{Operator: "&&", Left: match, Right: node}
+			}
+		}
+		if match == nil {
+			match = &ast.BoolNode{Value: true}
+		}
+		output, err := t.parse(rule.Output, fmt.Sprintf("rule %v, output", i+1), "")
+		if err != nil {
+			return nil, err
+		}
+		matches[i], outputs[i] = match, output
+	}
+	for i := len(table.Rules) - 1; i >= 0; i-- {
+		result = &ast.ConditionalNode{Cond: matches[i], Exp1: outputs[i], Exp2: result}
+	}
+
+	tree := &parser.Tree{Node: result, Source: file.NewSource(strings.Join(t.lines, "\n"))}
+	program, err := compileTree(tree, config)
+	if err != nil {
+		if fileError, ok := err.(*file.Error); ok && fileError.Line > 0 && fileError.Line <= len(t.labels) {
+			fileError.Message = t.labels[fileError.Line-1] + ": " + fileError.Message
+		}
+		return nil, err
+	}
+	return program, nil
+}
+
+type tableCompiler struct {
+	config     *conf.Config
+	inputs     []ast.Node
+	conditions map[string]*tableCondition
+	lines      []string // lines of source of the table
+	labels     []string // labels of lines, like "rule 2, condition 1"
+}
+
+type tableCondition struct {
+	node ast.Node
+	uses int
+}
+
+// conditionKey returns key of the condition of the input, unless the
+// condition matches any value.
+func conditionKey(input int, cond string) (string, bool) {
+	cond = strings.TrimSpace(cond)
+	if cond == "" || cond == "-" {
+		return "", false
+	}
+	return fmt.Sprintf("%v:%v", input, cond), true
+}
+
+// condition returns the node of the condition of the input in the rule,
+// or nil, if the condition matches any value.
+func (t *tableCompiler) condition(rule, input int, cond string) (ast.Node, error) {
+	key, ok := conditionKey(input, cond)
+	if !ok {
+		return nil, nil
+	}
+	c := t.conditions[key]
+	if c.node != nil {
+		return c.node, nil
+	}
+	label := fmt.Sprintf("rule %v, condition %v", rule+1, input+1)
+	cond = strings.TrimSpace(cond)
+
+	var node ast.Node
+	if isComparison(cond) {
+		// Operator is applied to the value in place of nil.
+		tree, err := t.parse(cond, label, "nil ")
+		if err != nil {
+			return nil, err
+		}
+		operand := leftmost(&tree)
+		if _, ok := (*operand).(*ast.NilNode); !ok {
+			return nil, fmt.Errorf("%v: invalid condition %v", label, cond)
+		}
+		*operand = t.input(input)
+		node = tree
+	} else {
+		value, err := t.parse(cond, label, "")
+		if err != nil {
+			return nil, err
+		}
+		operator := "=="
+		if b, ok := value.(*ast.BinaryNode); ok && b.Operator == ".." {
+			operator = "in"
+		}
+		node = &ast.BinaryNode{Operator: operator, Left: t.input(input), Right: value}
+		node.SetLocation(value.Location())
+	}
+	if c.uses > 1 {
+		node = &ast.SharedNode{Name: key, Node: node}
+	}
+	c.node = node
+	return node, nil
+}
+
+// input returns the node of the input. Identifiers are copied, as they are
+// loaded faster than results of shared nodes.
+func (t *tableCompiler) input(i int) ast.Node {
+	if ident, ok := t.inputs[i].(*ast.IdentifierNode); ok {
+		copied := *ident
+		return &copied
+	}
+	return t.inputs[i]
+}
+
+// parse parses the code, prefixed with the prefix, on a new line of the
+// source of the table.
+func (t *tableCompiler) parse(code, label, prefix string) (ast.Node, error) {
+	t.lines = append(t.lines, code)
+	t.labels = append(t.labels, label)
+	line := len(t.lines)
+	source := file.NewSource(strings.Join(t.lines, "\n"))
+
+	tree, err := parser.ParseWithOptions(prefix+code, t.config.ParserOptions())
+	if err == nil && len(t.config.Definitions) > 0 {
+		err = define(tree, t.config)
+	}
+	if err != nil {
+		fileError, ok := err.(*file.Error)
+		if !ok {
+			return nil, err
+		}
+		loc := shift(fileError.Location, line, len(prefix))
+		return nil, file.Errorf(loc, "%v: %v", label, fileError.Message).Bind(source)
+	}
+	ast.Walk(&tree.Node, lineShifter{line: line, prefix: len(prefix)})
+	return tree.Node, nil
+}
+
+// shift moves the location from the start of parsed code to the line of
+// the source of the table.
+func shift(loc file.Location, line, prefix int) file.Location {
+	column := loc.Column - prefix
+	if column < 0 {
+		column = 0
+	}
+	return file.Location{Line: line, Column: column}
+}
+
+type lineShifter struct {
+	line, prefix int
+}
+
+func (l lineShifter) Visit(node *ast.Node) {
+	(*node).SetLocation(shift((*node).Location(), l.line, l.prefix))
+}
+
+// isComparison reports whether the condition starts with an operator, like
+// "> 18" or "not in [1, 2]".
+func isComparison(cond string) bool {
+	tokens, err := lexer.Lex(file.NewSource(cond))
+	if err != nil || len(tokens) < 2 {
+		return false
+	}
+	first := tokens[0]
+	if first.Kind != lexer.Operator {
+		return false
+	}
+	if first.Value == "not" {
+		return tokens[1].Kind == lexer.Operator && comparisons[tokens[1].Value]
+	}
+	return comparisons[first.Value]
+}
+
+// leftmost returns the first operand of binary operators of the tree.
+func leftmost(node *ast.Node) *ast.Node {
+	switch n := (*node).(type) {
+	case *ast.BinaryNode:
+		return leftmost(&n.Left)
+	case *ast.UnaryNode:
+		return leftmost(&n.Node)
+	}
+	return node
+}
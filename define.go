@@ -0,0 +1,67 @@
+package expr
+
+import (
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// define replaces identifiers of definitions in the tree with trees of
+// definitions. Nodes of definitions get locations of replaced identifiers,
+// so errors of definitions point to their use.
+func define(tree *parser.Tree, config *conf.Config) error {
+	d := &definer{config: config}
+	ast.Walk(&tree.Node, d)
+	if d.err != nil {
+		return d.err.Bind(tree.Source)
+	}
+	return nil
+}
+
+type definer struct {
+	config *conf.Config
+	stack  []string // definitions being expanded
+	err    *file.Error
+}
+
+func (d *definer) Visit(node *ast.Node) {
+	ident, ok := (*node).(*ast.IdentifierNode)
+	if !ok || d.err != nil {
+		return
+	}
+	input, ok := d.config.Definitions[ident.Value]
+	if !ok {
+		return
+	}
+	for _, name := range d.stack {
+		if name == ident.Value {
+			d.err = file.Errorf(ident.Location(), "definition %v is recursive", ident.Value)
+			return
+		}
+	}
+	tree, err := parser.ParseWithOptions(input, d.config.ParserOptions())
+	if err != nil {
+		message := err.Error()
+		if fileError, ok := err.(*file.Error); ok {
+			message = fileError.Message
+		}
+		d.err = file.Errorf(ident.Location(), "invalid definition %v: %v", ident.Value, message)
+		return
+	}
+	d.stack = append(d.stack, ident.Value)
+	ast.Walk(&tree.Node, d)
+	d.stack = d.stack[:len(d.stack)-1]
+	if d.err != nil {
+		return
+	}
+	ast.Walk(&tree.Node, locator(ident.Location()))
+	*node = tree.Node
+}
+
+// locator sets location of nodes.
+type locator file.Location
+
+func (l locator) Visit(node *ast.Node) {
+	(*node).SetLocation(file.Location(l))
+}
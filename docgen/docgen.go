@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/antonmedv/expr/builtin"
 	"github.com/antonmedv/expr/conf"
 )
 
@@ -34,7 +35,7 @@ type Type struct {
 }
 
 var (
-	Operators = []string{"matches", "contains", "startsWith", "endsWith"}
+	Operators = []string{"matches", "like", "contains", "startsWith", "endsWith"}
 	Builtins  = map[Identifier]*Type{
 		"true":   {Kind: "bool"},
 		"false":  {Kind: "bool"},
@@ -46,9 +47,22 @@ var (
 		"filter": {Kind: "func", Arguments: []*Type{{Kind: "array", Type: &Type{Kind: "any"}}, {Kind: "func"}}, Return: &Type{Kind: "array", Type: &Type{Kind: "any"}}},
 		"map":    {Kind: "func", Arguments: []*Type{{Kind: "array", Type: &Type{Kind: "any"}}, {Kind: "func"}}, Return: &Type{Kind: "array", Type: &Type{Kind: "any"}}},
 		"count":  {Kind: "func", Arguments: []*Type{{Kind: "array", Type: &Type{Kind: "any"}}, {Kind: "func"}}, Return: &Type{Kind: "int"}},
+		"fold":   {Kind: "func", Arguments: []*Type{{Kind: "array", Type: &Type{Kind: "any"}}, {Kind: "any"}, {Kind: "func"}}, Return: &Type{Kind: "any"}},
+		"reduce": {Kind: "func", Arguments: []*Type{{Kind: "array", Type: &Type{Kind: "any"}}, {Kind: "func"}, {Kind: "any"}}, Return: &Type{Kind: "any"}},
 	}
 )
 
+func init() {
+	c := &Context{Types: make(map[TypeName]*Type)}
+	for _, f := range builtin.Builtins {
+		if len(f.Types) > 0 {
+			Builtins[Identifier(f.Name)] = c.use(f.Types[0])
+		} else {
+			Builtins[Identifier(f.Name)] = &Type{Kind: "func", Return: &Type{Kind: "any"}}
+		}
+	}
+}
+
 func CreateDoc(i interface{}) *Context {
 	c := &Context{
 		Variables: make(map[Identifier]*Type),
@@ -173,9 +187,9 @@ func (c *Context) use(t reflect.Type, ops ...option) *Type {
 
 appendix:
 
-	name := TypeName(t.String())
+	name := TypeName(conf.TypeString(t))
 	if c.PkgPath == t.PkgPath() {
-		name = TypeName(t.Name())
+		name = TypeName(conf.TypeName(t))
 	}
 	anonymous := t.Name() == ""
 
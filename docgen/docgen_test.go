@@ -1,11 +1,15 @@
 package docgen_test
 
 import (
+	"encoding/json"
 	"math"
 	"testing"
 	"time"
 
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
 	. "github.com/antonmedv/expr/docgen"
+	"github.com/antonmedv/expr/parser"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -254,3 +258,59 @@ func TestContext_Markdown(t *testing.T) {
 	md := doc.Markdown()
 	require.True(t, len(md) > 0)
 }
+
+type User struct {
+	Name    string
+	Friends []User
+	Score   float64
+}
+
+func (User) Greet(greeting string) string { return greeting }
+
+func TestContext_Env(t *testing.T) {
+	doc := CreateDoc(map[string]interface{}{
+		"user":   User{},
+		"limits": map[string]int{},
+		"Max":    math.Max,
+	})
+	b, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var decoded Context
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	env := decoded.Env()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`user.Name + "!"`, "string"},
+		{`user.Score > Max(1, 2)`, "bool"},
+		{`user.Greet("hi")`, "string"},
+		{`limits.daily * 2`, "int"},
+		{`user.Friends[0].Friends`, "interface {}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tree, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			typ, err := checker.Check(tree, conf.New(env))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, typ.String())
+		})
+	}
+
+	tree, err := parser.Parse(`user.Age`)
+	require.NoError(t, err)
+	_, err = checker.Check(tree, conf.New(env))
+	require.Error(t, err)
+}
+
+func TestContext_Env_unexported(t *testing.T) {
+	var doc Context
+	require.NoError(t, json.Unmarshal([]byte(`{"variables": {"point": {"kind": "struct", "fields": {"x": {"kind": "int"}, "Field1": {"kind": "string"}}}}}`), &doc))
+	tree, err := parser.Parse(`point.x + len(point.Field1)`)
+	require.NoError(t, err)
+	typ, err := checker.Check(tree, conf.New(doc.Env()))
+	require.NoError(t, err)
+	require.Equal(t, "int", typ.String())
+}
@@ -0,0 +1,113 @@
+package docgen
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode"
+)
+
+// Env returns environment with zero values of types of variables of the
+// context, so expressions may be checked against a context decoded from
+// JSON, without types of the application. Builtins and operators of the
+// context are skipped, and structs become anonymous structs with the same
+// fields. Methods become fields of func types, and recursive types are
+// replaced by interface{}.
+func (c *Context) Env() map[string]interface{} {
+	b := &envBuilder{context: c, building: make(map[TypeName]bool)}
+	env := make(map[string]interface{}, len(c.Variables))
+	for name, t := range c.Variables {
+		if t == nil || t.Kind == "operator" {
+			continue
+		}
+		if _, ok := Builtins[name]; ok {
+			continue
+		}
+		env[string(name)] = reflect.Zero(b.reflect(t)).Interface()
+	}
+	return env
+}
+
+type envBuilder struct {
+	context  *Context
+	building map[TypeName]bool
+}
+
+var interfaceType = reflect.TypeOf(new(interface{})).Elem()
+
+func (b *envBuilder) reflect(t *Type) reflect.Type {
+	if t == nil {
+		return interfaceType
+	}
+	switch t.Kind {
+	case "bool":
+		return reflect.TypeOf(false)
+	case "int":
+		return reflect.TypeOf(0)
+	case "float":
+		return reflect.TypeOf(float64(0))
+	case "string":
+		return reflect.TypeOf("")
+	case "array":
+		return reflect.SliceOf(b.reflect(t.Type))
+	case "map":
+		key := reflect.TypeOf("")
+		if t.Key != nil {
+			key = b.reflect(t.Key)
+		}
+		return reflect.MapOf(key, b.reflect(t.Type))
+	case "func":
+		in := make([]reflect.Type, len(t.Arguments))
+		for i, a := range t.Arguments {
+			in[i] = b.reflect(a)
+		}
+		return reflect.FuncOf(in, []reflect.Type{b.reflect(t.Return)}, false)
+	case "struct":
+		if t.Name == "" {
+			return b.structOf(t.Fields)
+		}
+		named, ok := b.context.Types[t.Name]
+		if !ok || b.building[t.Name] {
+			return interfaceType
+		}
+		b.building[t.Name] = true
+		defer delete(b.building, t.Name)
+		return b.structOf(named.Fields)
+	}
+	return interfaceType
+}
+
+// structOf returns struct with the fields. Fields, which names are not
+// exported in Go, are renamed and keep their names in expr tags.
+func (b *envBuilder) structOf(fields map[Identifier]*Type) reflect.Type {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	structFields := make([]reflect.StructField, len(names))
+	for i, name := range names {
+		f := reflect.StructField{Name: name, Type: b.reflect(fields[Identifier(name)])}
+		if !isExported(name) {
+			f.Name = "Field" + strconv.Itoa(i)
+			for fields[Identifier(f.Name)] != nil {
+				f.Name += "_"
+			}
+			f.Tag = reflect.StructTag(`expr:"` + name + `"`)
+		}
+		structFields[i] = f
+	}
+	return reflect.StructOf(structFields)
+}
+
+func isExported(name string) bool {
+	for i, r := range name {
+		if i == 0 && !unicode.IsUpper(r) {
+			return false
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -1,22 +1,46 @@
 package expr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/audit"
+	"github.com/antonmedv/expr/builtin"
 	"github.com/antonmedv/expr/checker"
 	"github.com/antonmedv/expr/compiler"
 	"github.com/antonmedv/expr/conf"
 	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/logging"
+	"github.com/antonmedv/expr/metrics"
 	"github.com/antonmedv/expr/optimizer"
 	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/tracing"
 	"github.com/antonmedv/expr/vm"
+	"github.com/antonmedv/expr/vm/runtime"
 )
 
 // Option for configuring config.
 type Option func(c *conf.Config)
 
+// ValueConverter is a value of env, which controls how it appears to
+// expressions, like sql.NullString as a string or nil:
+//
+//	func (n NullString) ToExprValue() interface{} {
+//		if !n.Valid {
+//			return nil
+//		}
+//		return n.String
+//	}
+type ValueConverter = runtime.ValueConverter
+
+// ValueParser is a pointer to a parameter of functions of env, which is set
+// from values of expressions, like the reverse of ValueConverter.
+type ValueParser = runtime.ValueParser
+
 // Eval parses, compiles and runs given input.
 func Eval(input string, env interface{}) (interface{}, error) {
 	if _, ok := env.(Option); ok {
@@ -28,6 +52,13 @@ func Eval(input string, env interface{}) (interface{}, error) {
 		return nil, err
 	}
 
+	// Calls of builtins are resolved by the checker. Types of variables
+	// are unknown, so they are checked at runtime.
+	_, err = checker.Check(tree, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	program, err := compiler.Compile(tree, nil)
 	if err != nil {
 		return nil, err
@@ -67,6 +98,24 @@ func Operator(operator string, fn ...string) Option {
 	}
 }
 
+// OperatorFunc allows to replace a binary operator with Go functions, like
+// OperatorFunc("+", func(a, b Money) Money { ... }). Function is selected by
+// types of operands during compilation, or at runtime if types are unknown.
+func OperatorFunc(operator string, fn ...interface{}) Option {
+	return func(c *conf.Config) {
+		c.OperatorFunc(operator, fn...)
+	}
+}
+
+// Infix registers custom infix operator with given precedence, for example
+// Infix("near", 20) allows to write `a near b` instead of `near(a, b)`.
+// Precedence of comparison operators is 20, of + and - is 30, of * and / is 60.
+func Infix(name string, precedence int) Option {
+	return func(c *conf.Config) {
+		c.InfixOperator(name, precedence)
+	}
+}
+
 // ConstExpr defines func expression as constant. If all argument to this function is constants,
 // then it can be replaced by result of this func call on compile step.
 func ConstExpr(fn string) Option {
@@ -124,30 +173,460 @@ func Patch(visitor ast.Visitor) Option {
 	}
 }
 
+// Builtins restricts builtin functions available in expressions to given
+// functions and namespaces, like Builtins("json.encode", "strings").
+func Builtins(names ...string) Option {
+	return func(c *conf.Config) {
+		c.Builtins(names...)
+	}
+}
+
+// DisableBuiltins removes given builtin functions and namespaces.
+func DisableBuiltins(names ...string) Option {
+	return func(c *conf.Config) {
+		c.DisableBuiltins(names...)
+	}
+}
+
+// Builtin adds builtin functions, or overrides builtins with the same name.
+// Function name may be qualified with namespace, like "mycorp.lookup".
+func Builtin(fns ...*builtin.Function) Option {
+	return func(c *conf.Config) {
+		c.Builtin(fns...)
+	}
+}
+
+// Function adds function with given name. Types are pointers to func types of
+// accepted signatures, like new(func(string, int) string), and are used to
+// check arguments during compilation. Use Builtin for functions with optional
+// parameters.
+func Function(name string, fn func(params ...interface{}) (interface{}, error), types ...interface{}) Option {
+	ts := make([]reflect.Type, len(types))
+	for i, t := range types {
+		ts[i] = reflect.TypeOf(t)
+		if ts[i] == nil || ts[i].Kind() != reflect.Ptr || ts[i].Elem().Kind() != reflect.Func {
+			panic(fmt.Errorf("type of %v must be a pointer to func type (got %T)", name, t))
+		}
+		ts[i] = ts[i].Elem()
+		if ts[i].NumOut() == 0 {
+			panic(fmt.Errorf("signature of %v must return a value (got %v)", name, ts[i]))
+		}
+	}
+	return func(c *conf.Config) {
+		c.Builtin(&builtin.Function{
+			Name:  name,
+			Func:  fn,
+			Types: ts,
+			// Do not evaluate user functions during compilation.
+			NoFold: true,
+		})
+	}
+}
+
+// Overload adds function with given name implemented by several Go
+// functions. The function is selected by types of arguments during
+// compilation, or at runtime if types of arguments are unknown.
+func Overload(name string, fns ...interface{}) Option {
+	return func(c *conf.Config) {
+		c.Overload(name, fns...)
+	}
+}
+
+// Converter converts values of types of the environment on access by
+// functions of one parameter and one result, like
+// func(ts *timestamppb.Timestamp) time.Time. Expressions use results of
+// converters, like ts.Year() or ts > now(), and the checker knows their
+// types. Results of pointers to scalars are nil for nil pointers.
+func Converter(fns ...interface{}) Option {
+	return func(c *conf.Config) {
+		c.Converter(fns...)
+	}
+}
+
+// Memoize caches results of calls to functions with given names within one
+// run of a program, so calls with the same arguments are done only once.
+// Functions must be pure: their results must depend only on arguments.
+// Calls with up to four arguments of comparable types are cached.
+func Memoize(names ...string) Option {
+	return func(c *conf.Config) {
+		c.Memoize(names...)
+	}
+}
+
+// WithCache enables cache of results of the program, holding up to size
+// results. Results are cached if the program does not call functions of the
+// environment or non-deterministic builtins, and are reused if values of the
+// environment are equal. Cached results are shared, and must not be modified.
+func WithCache(size int) Option {
+	return func(c *conf.Config) {
+		c.CacheSize = size
+	}
+}
+
+// Unit declares the unit of measure of the field of the path, like
+// Unit("trip.distance", "m"). Units of struct fields may be declared by
+// tags, like `unit:"m/s"`. Numbers of different units can not be added or
+// compared, while multiplication and division derive units, like m/s.
+func Unit(path, unit string) Option {
+	return func(c *conf.Config) {
+		if c.Units == nil {
+			c.Units = make(map[string]string)
+		}
+		c.Units[path] = unit
+	}
+}
+
+// AllowFields restricts expressions to members of the environment of
+// patterns of paths, like AllowFields("user.Name", "order.*"), where * is
+// any field. Members of allowed fields, and methods, like user.Name.First,
+// are allowed too. Expressions using other identifiers, fields or methods of
+// the environment are rejected by compilation.
+func AllowFields(patterns ...string) Option {
+	return func(c *conf.Config) {
+		c.AllowFields = append(c.AllowFields, patterns...)
+	}
+}
+
+// DenyFields rejects expressions using members of the environment of
+// patterns of paths, like DenyFields("user.Password"), or their members.
+// Values containing denied members, like user in json.encode(user), are denied
+// too. DenyFields takes precedence over AllowFields.
+func DenyFields(patterns ...string) Option {
+	return func(c *conf.Config) {
+		c.DenyFields = append(c.DenyFields, patterns...)
+	}
+}
+
+// Sensitive marks fields of the environment of paths, like
+// Sensitive("user.SSN"), as sensitive. The VM tracks values derived from
+// sensitive values, and RunTainted reports, whether the result is derived
+// from them.
+func Sensitive(paths ...string) Option {
+	return func(c *conf.Config) {
+		c.Sensitive = append(c.Sensitive, paths...)
+	}
+}
+
+// Audit sends records of runs of the program to the auditor, with the ID
+// of the expression, referenced inputs, the result and the duration.
+func Audit(id string, auditor audit.Auditor) Option {
+	return func(c *conf.Config) {
+		if c.Audit == nil {
+			c.Audit = &audit.Config{}
+		}
+		c.Audit.ID = id
+		c.Audit.Auditor = auditor
+	}
+}
+
+// Metrics sends measurements of compilations and runs of the program to
+// metrics, with the ID of the expression, like counts, durations, errors and
+// exceeded limits.
+func Metrics(id string, m metrics.Metrics) Option {
+	return func(c *conf.Config) {
+		c.Metrics = &metrics.Config{ID: id, Metrics: m}
+	}
+}
+
+// Trace starts spans of runs of the program by the tracer, with the ID of
+// the expression, the hash of its source, and values of fields of the paths
+// as attributes, like Trace("adult", tracer, "user.ID"). Calls of functions,
+// which first parameter is context.Context, get child spans.
+func Trace(id string, tracer tracing.Tracer, attributes ...string) Option {
+	return func(c *conf.Config) {
+		c.Tracing = &tracing.Config{ID: id, Tracer: tracer, Attributes: attributes}
+	}
+}
+
+// Logger routes entries of the log builtin to the logger, with the ID of the
+// expression. Every program may log 10 entries per second, unless the rate
+// is changed by LogRate. Without a logger, entries are discarded.
+func Logger(id string, logger logging.Logger) Option {
+	return func(c *conf.Config) {
+		if c.Logging == nil {
+			c.Logging = &logging.Config{Rate: 10, Burst: 10}
+		}
+		c.Logging.ID = id
+		c.Logging.Logger = logger
+	}
+}
+
+// LogRate limits entries of the log builtin of every program to the rate
+// per second, after the burst of entries. Zero rate is no limit.
+func LogRate(rate float64, burst int) Option {
+	return func(c *conf.Config) {
+		if c.Logging == nil {
+			c.Logging = &logging.Config{}
+		}
+		c.Logging.Rate = rate
+		c.Logging.Burst = burst
+	}
+}
+
+// AuditPolicy sets the policy of inputs of the path, like
+// AuditPolicy("user.SSN", audit.Redact), and of its members in records of
+// Audit.
+func AuditPolicy(path string, policy audit.Policy) Option {
+	return func(c *conf.Config) {
+		if c.Audit == nil {
+			c.Audit = &audit.Config{}
+		}
+		if c.Audit.Policies == nil {
+			c.Audit.Policies = make(map[string]audit.Policy)
+		}
+		c.Audit.Policies[path] = policy
+	}
+}
+
+// Timeout sets the timeout of calls of functions of the names, which first
+// parameter is context.Context, like Timeout(time.Second, "lookup"). Without
+// names, it sets the timeout of other functions with context. Functions get
+// the context of RunContext, and fallback substitutes defaults on errors and
+// exceeded deadlines of their calls.
+func Timeout(d time.Duration, names ...string) Option {
+	return func(c *conf.Config) {
+		if c.Timeouts == nil {
+			c.Timeouts = make(map[string]time.Duration)
+		}
+		if len(names) == 0 {
+			c.Timeouts[""] = d
+		}
+		for _, name := range names {
+			c.Timeouts[name] = d
+		}
+	}
+}
+
+// Limits rejects programs, which sizes exceed limits, like programs of
+// pathological expressions with deep nesting. Sizes of compiled programs are
+// reported by lengths of Bytecode and Constants, and by MaxStack.
+func Limits(limits conf.Limits) Option {
+	return func(c *conf.Config) {
+		c.Limits = limits
+	}
+}
+
+// ZeroDivisionError makes division and modulo by zero a runtime error.
+func ZeroDivisionError() Option {
+	return func(c *conf.Config) {
+		c.ZeroDivision = &runtime.ZeroDivision{Error: true}
+	}
+}
+
+// ZeroDivisionNil makes result of division and modulo by zero nil.
+func ZeroDivisionNil() Option {
+	return func(c *conf.Config) {
+		c.ZeroDivision = &runtime.ZeroDivision{}
+	}
+}
+
+// ZeroDivisionIEEE makes result of division by zero +Inf, -Inf or NaN, and
+// result of modulo by zero NaN, for integers as well as floats.
+func ZeroDivisionIEEE() Option {
+	return func(c *conf.Config) {
+		c.ZeroDivision = &runtime.ZeroDivision{IEEE: true}
+	}
+}
+
+// ZeroDivisionValue makes result of division and modulo by zero the value.
+func ZeroDivisionValue(value interface{}) Option {
+	return func(c *conf.Config) {
+		c.ZeroDivision = &runtime.ZeroDivision{Value: value}
+	}
+}
+
+// Translate sets translator of messages of compilation and runtime errors, and
+// warnings. Messages are translated before the location and the snippet of
+// source are added.
+func Translate(t file.Translator) Option {
+	return func(c *conf.Config) {
+		c.Translator = t
+	}
+}
+
+// FloatEpsilon makes == and != treat floats as equal, if their difference
+// is at most epsilon, so 0.1 + 0.2 == 0.3 is true with epsilon 1e-9.
+// Integers are compared with floats as floats.
+func FloatEpsilon(epsilon float64) Option {
+	return func(c *conf.Config) {
+		if c.FloatEqual == nil {
+			c.FloatEqual = &runtime.FloatEqual{}
+		}
+		c.FloatEqual.Epsilon = epsilon
+	}
+}
+
+// FloatULP makes == and != treat floats as equal, if they are at most ulp
+// representable float64 values apart, which suits floats of any magnitude.
+// It may be combined with FloatEpsilon for floats close to zero.
+func FloatULP(ulp uint64) Option {
+	return func(c *conf.Config) {
+		if c.FloatEqual == nil {
+			c.FloatEqual = &runtime.FloatEqual{}
+		}
+		c.FloatEqual.ULP = ulp
+	}
+}
+
+// NonFiniteError makes NaN and infinities produced by arithmetic and calls
+// of functions, or compared, a runtime error.
+func NonFiniteError() Option {
+	return func(c *conf.Config) {
+		c.NonFinite = &runtime.NonFinite{Error: true}
+	}
+}
+
+// NonFiniteNil replaces results of programs, which are NaN or infinities,
+// with nil. Arithmetic and comparisons of them are as in Go, so 1/0.0 > 0 is
+// true.
+func NonFiniteNil() Option {
+	return func(c *conf.Config) {
+		c.NonFinite = &runtime.NonFinite{}
+	}
+}
+
+// NonFinitePropagate makes NaN and infinities propagate as in Go, which is
+// the default.
+func NonFinitePropagate() Option {
+	return func(c *conf.Config) {
+		c.NonFinite = nil
+	}
+}
+
+// Deterministic rejects expressions calling non-deterministic builtins, like
+// rand.uuid(), so results depend only on values of the environment. Functions
+// of the environment and functions registered with options must be
+// deterministic.
+func Deterministic() Option {
+	return func(c *conf.Config) {
+		c.Deterministic = true
+	}
+}
+
+// Broadcast allows element-wise arithmetic of arrays of numbers with numbers
+// and other arrays of the same length, like prices * 1.2 or a + b. Results
+// are arrays. Chains of operations, like a * 2 + b, are evaluated in a single
+// loop, without intermediate arrays.
+func Broadcast() Option {
+	return func(c *conf.Config) {
+		c.Broadcast = true
+	}
+}
+
+// Define declares named sub-expression, like Define("adult", "user.Age >= 18"),
+// which replaces identifiers with the name in compiled expressions.
+// Definitions may use other definitions.
+func Define(name, input string) Option {
+	return func(c *conf.Config) {
+		c.Definitions[name] = input
+	}
+}
+
+// LangVersion compiles expressions with the version of the language, so
+// stored expressions keep their behavior when later versions of the library
+// add syntax and change semantics. Expressions using syntax of later
+// versions, like the ?? operator of version 2, fail to compile. Versions
+// are listed by conf.LatestLangVersion.
+func LangVersion(version int) Option {
+	return func(c *conf.Config) {
+		c.LangVersion = version
+	}
+}
+
+// Check adds the custom rule of expressions, which runs after type
+// checking with typed nodes, children first, and reports errors, which
+// reject expressions, and warnings of programs:
+//
+//	expr.Check("no-http", func(r *conf.Report, node ast.Node) {
+//		if call, ok := node.(*ast.CallNode); ok {
+//			if callee, ok := call.Callee.(*ast.IdentifierNode); ok && callee.Value == "httpGet" {
+//				r.Errorf(call, "calls to httpGet are forbidden in this context")
+//			}
+//		}
+//	})
+func Check(name string, check func(report *conf.Report, node ast.Node)) Option {
+	return func(c *conf.Config) {
+		c.Rules = append(c.Rules, conf.Rule{Name: name, Check: check})
+	}
+}
+
+// ImplicitReceiver resolves identifiers, which are fields or methods of the
+// variable of the environment, as its members, like Amount > 100 as
+// order.Amount > 100 of ImplicitReceiver("order"). Expressions are checked
+// with types of members. Variables and functions of the environment take
+// precedence over members of the receiver. Fields of maps are keys of maps
+// of the environment of compilation.
+func ImplicitReceiver(name string) Option {
+	return func(c *conf.Config) {
+		c.ImplicitReceiver = name
+	}
+}
+
 // Compile parses and compiles given input expression to bytecode program.
 func Compile(input string, ops ...Option) (*vm.Program, error) {
-	config := &conf.Config{
-		Operators: make(map[string][]string),
-		ConstFns:  make(map[string]reflect.Value),
-		Optimize:  true,
-	}
+	return compile(input, newConfig(ops))
+}
+
+// newConfig returns config with the options.
+func newConfig(ops []Option) *conf.Config {
+	config := conf.CreateNew()
 
 	for _, op := range ops {
 		op(config)
 	}
 
-	if len(config.Operators) > 0 {
+	if config.ImplicitReceiver != "" {
+		// Members of the receiver are resolved before other patches.
+		config.Visitors = append([]ast.Visitor{receiverPatcher(config)}, config.Visitors...)
+	}
+	if len(config.Operators) > 0 || len(config.OperatorFns) > 0 {
 		config.Visitors = append(config.Visitors, &conf.OperatorPatcher{
 			Operators: config.Operators,
+			Funcs:     config.OperatorFns,
 			Types:     config.Types,
 		})
 	}
+	return config
+}
 
-	tree, err := parser.Parse(input)
+// compile compiles input with the config, which is not modified, so it may
+// be shared by expressions of a set.
+func compile(input string, config *conf.Config) (program *vm.Program, err error) {
+	if config.Metrics != nil && config.Metrics.Metrics != nil {
+		start := time.Now()
+		defer func() {
+			compiled(config.Metrics, time.Since(start), err)
+		}()
+	}
+
+	tree, err := parser.ParseWithOptions(input, config.ParserOptions())
 	if err != nil {
 		return nil, err
 	}
 
+	if len(config.Definitions) > 0 {
+		if err := define(tree, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return compileTree(tree, config)
+}
+
+// compiled sends the measurement of the compilation to metrics, and reports
+// exceeded limits.
+func compiled(m *metrics.Config, duration time.Duration, err error) {
+	m.Metrics.Compiled(m.ID, duration, err)
+	var limit *conf.LimitError
+	if errors.As(err, &limit) {
+		m.Metrics.LimitExceeded(m.ID, limit.Limit)
+	}
+}
+
+// compileTree checks, optimizes and compiles the parsed tree with
+// expanded definitions.
+func compileTree(tree *parser.Tree, config *conf.Config) (*vm.Program, error) {
+	var err error
 	if len(config.Visitors) > 0 {
 		for _, v := range config.Visitors {
 			// We need to perform types check, because some visitors may rely on
@@ -166,10 +645,22 @@ func Compile(input string, ops ...Option) (*vm.Program, error) {
 		}
 	}
 
+	// Warnings are collected before optimization, which may fold
+	// constant comparisons.
+	warnings := checker.Warnings(tree, config)
+	ruleWarnings, err := checker.Rules(tree, config)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, ruleWarnings...)
+
 	if config.Optimize {
 		err = optimizer.Optimize(&tree.Node, config)
 		if err != nil {
 			if fileError, ok := err.(*file.Error); ok {
+				if config.Translator != nil {
+					fileError.Translate(config.Translator)
+				}
 				return nil, fileError.Bind(tree.Source)
 			}
 			return nil, err
@@ -180,11 +671,61 @@ func Compile(input string, ops ...Option) (*vm.Program, error) {
 	if err != nil {
 		return nil, err
 	}
+	program.Warnings = warnings
+	if config.Env != nil {
+		program.Signature = conf.EnvSignature(config.Env)
+	}
 
 	return program, nil
 }
 
+// EnvSignature returns signature of identifiers of the environment, and
+// fields and methods of their types. Programs keep signature of the
+// environment of compilation, see CheckEnv.
+func EnvSignature(env interface{}) *conf.Signature {
+	return conf.EnvSignature(env)
+}
+
+// CheckEnv returns *conf.SignatureError with the diff of signatures, if
+// the environment differs from the environment of compilation of the
+// program, like a program stored before a field was renamed. Programs
+// compiled without expr.Env are not checked.
+func CheckEnv(program *vm.Program, env interface{}) error {
+	if program.Signature == nil {
+		return nil
+	}
+	signature := conf.EnvSignature(env)
+	if signature.Hash == program.Signature.Hash {
+		return nil
+	}
+	return &conf.SignatureError{Diff: program.Signature.Diff(signature)}
+}
+
 // Run evaluates given bytecode program.
 func Run(program *vm.Program, env interface{}) (interface{}, error) {
 	return vm.Run(program, env)
 }
+
+// RunContext evaluates given bytecode program, and passes the context to
+// functions, which first parameter is context.Context.
+func RunContext(ctx context.Context, program *vm.Program, env interface{}) (interface{}, error) {
+	v := vm.VM{}
+	return v.RunContext(ctx, program, env)
+}
+
+// RunRand evaluates given bytecode program with the source of random numbers
+// of builtins, like sample and randFloat, like rand.New(rand.NewSource(42)),
+// so their results are reproducible.
+func RunRand(program *vm.Program, env interface{}, r builtin.Rand) (interface{}, error) {
+	v := vm.VM{}
+	v.SetRand(r)
+	return v.Run(program, env)
+}
+
+// RunTainted evaluates given bytecode program, and reports, whether the
+// result is derived from fields marked by Sensitive.
+func RunTainted(program *vm.Program, env interface{}) (interface{}, bool, error) {
+	v := vm.VM{}
+	out, err := v.Run(program, env)
+	return out, v.Tainted(), err
+}
@@ -1,16 +1,30 @@
 package expr_test
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/antonmedv/expr"
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/audit"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
 	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/logging"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/tracing"
+	"github.com/antonmedv/expr/vm"
+	"github.com/antonmedv/expr/vm/runtime"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -510,6 +524,126 @@ func TestOperator_interface(t *testing.T) {
 	require.Equal(t, true, output)
 }
 
+type money struct {
+	Amount   int
+	Currency string
+}
+
+func TestOperatorFunc(t *testing.T) {
+	env := map[string]interface{}{
+		"a":     money{100, "USD"},
+		"b":     money{50, "USD"},
+		"c":     money{10, "EUR"},
+		"items": []interface{}{money{1, "USD"}, money{2, "USD"}},
+	}
+
+	add := func(a, b money) (money, error) {
+		if a.Currency != b.Currency {
+			return money{}, fmt.Errorf("currency mismatch: %v and %v", a.Currency, b.Currency)
+		}
+		return money{a.Amount + b.Amount, a.Currency}, nil
+	}
+	less := func(a, b money) bool { return a.Amount < b.Amount }
+	scale := func(a money, n int) money { return money{a.Amount * n, a.Currency} }
+
+	options := []expr.Option{
+		expr.Env(env),
+		expr.OperatorFunc("+", add),
+		expr.OperatorFunc("<", less),
+		expr.OperatorFunc("*", scale),
+	}
+
+	var tests = []struct {
+		input string
+		want  interface{}
+	}{
+		{`a + b`, money{150, "USD"}},
+		{`(a + b + a).Amount`, 250},
+		{`b < a`, true},
+		{`a * 2`, money{200, "USD"}},
+		{`items[0] + items[1]`, money{3, "USD"}},
+		{`items[0] < a`, true},
+		{`1 + 2`, 3},
+		{`a.Amount + 1`, 101},
+	}
+
+	for _, test := range tests {
+		program, err := expr.Compile(test.input, options...)
+		require.NoError(t, err, test.input)
+
+		output, err := expr.Run(program, env)
+		require.NoError(t, err, test.input)
+		assert.Equal(t, test.want, output, test.input)
+	}
+
+	program, err := expr.Compile(`a + c`, options...)
+	require.NoError(t, err)
+
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "currency mismatch: USD and EUR")
+
+	_, err = expr.Compile(`a + 1`, options...)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: + (mismatched types expr_test.money and int)")
+}
+
+func TestOperatorFunc_dynamic_fallback(t *testing.T) {
+	env := map[string]interface{}{
+		"items": []interface{}{1, 2},
+	}
+
+	program, err := expr.Compile(
+		`items[0] + items[1]`,
+		expr.Env(env),
+		expr.OperatorFunc("+", func(a, b money) money { return a }),
+	)
+	require.NoError(t, err)
+
+	output, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, 3, output)
+}
+
+func TestOperatorFunc_invalid_signature(t *testing.T) {
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.OperatorFunc("+", func(a int) int { return a }))
+	})
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.OperatorFunc("+", "Add"))
+	})
+}
+
+func TestInfix(t *testing.T) {
+	env := map[string]interface{}{
+		"near": func(a, b int) bool { return a-b <= 1 && b-a <= 1 },
+		"x":    10,
+	}
+
+	program, err := expr.Compile(`x near 11 && !(x near 1 + 1) && x not near 20`, expr.Env(env), expr.Infix("near", 20))
+	require.NoError(t, err)
+
+	output, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, output)
+
+	program, err = expr.Compile(`"a.b.c" split "."`, expr.Infix("split", 20), expr.Builtin(&builtin.Function{
+		Name: "split",
+		Func: func(args ...interface{}) (interface{}, error) {
+			return strings.Split(args[0].(string), args[1].(string)), nil
+		},
+	}))
+	require.NoError(t, err)
+
+	output, err = expr.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, output)
+
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.Infix("~=", 20))
+	})
+}
+
 func TestExpr_readme_example(t *testing.T) {
 	env := map[string]interface{}{
 		"greet":   "Hello, %v!",
@@ -703,6 +837,10 @@ func TestExpr(t *testing.T) {
 			`Two not    in 0..1`,
 			true,
 		},
+		{
+			`One + One not in 0..1`,
+			true,
+		},
 		{
 			`Int32 in [10, 20]`,
 			false,
@@ -715,6 +853,22 @@ func TestExpr(t *testing.T) {
 			`String matches ("^" + String + "$")`,
 			true,
 		},
+		{
+			`String like "s_r%"`,
+			true,
+		},
+		{
+			`"100%" like "100\\%" and not ("1000" like "100\\%")`,
+			true,
+		},
+		{
+			`"a.b" like (String[:0] + "a_b")`,
+			true,
+		},
+		{
+			`"a\nb" like "a%b" and "ab" not like "_"`,
+			true,
+		},
 		{
 			`"foobar" contains "bar"`,
 			true,
@@ -1101,6 +1255,403 @@ func TestExpr_map_default_values(t *testing.T) {
 	require.Equal(t, true, output)
 }
 
+type nullString struct {
+	String string
+	Valid  bool
+}
+
+func (n nullString) ToExprValue() interface{} {
+	if !n.Valid {
+		return nil
+	}
+	return n.String
+}
+
+func (n *nullString) FromExprValue(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*n = nullString{}
+	case string:
+		*n = nullString{String: v, Valid: true}
+	default:
+		return fmt.Errorf("unsupported type %T", value)
+	}
+	return nil
+}
+
+type cents int64
+
+func (c cents) ToExprValue() interface{} {
+	return float64(c) / 100
+}
+
+type converterEnv struct {
+	Name   nullString
+	Nick   nullString
+	Price  cents
+	Tags   []nullString
+	Prices map[string]cents
+	Ptr    *nullString
+	Any    interface{}
+}
+
+func (converterEnv) Describe(n nullString) string {
+	if !n.Valid {
+		return "null"
+	}
+	return "valid " + n.String
+}
+
+func TestExpr_value_converter(t *testing.T) {
+	env := converterEnv{
+		Name:   nullString{String: "foo", Valid: true},
+		Price:  cents(1250),
+		Tags:   []nullString{{String: "a", Valid: true}, {}, {String: "b", Valid: true}},
+		Prices: map[string]cents{"tea": 350},
+		Ptr:    &nullString{String: "ptr", Valid: true},
+		Any:    cents(5),
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`Name`, "foo"},
+		{`Name + "bar"`, "foobar"},
+		{`strings.iequals(Name, "FOO")`, true},
+		{`Nick == nil`, true},
+		{`Nick == nil ? "none" : Nick`, "none"},
+		{`Price * 2`, 25.0},
+		{`Price > 12 && Prices.tea < 4`, true},
+		{`Prices["tea"] + Any`, 3.55},
+		{`Ptr + "!"`, "ptr!"},
+		{`len(filter(Tags, {# != nil}))`, 2},
+		{`map(Tags, {# == nil ? "-" : #})`, []interface{}{"a", "-", "b"}},
+		{`Tags[2]`, "b"},
+		{`Describe(Name)`, "valid foo"},
+		{`Describe("bar")`, "valid bar"},
+		{`Describe(nil)`, "null"},
+		{`Describe(Nick)`, "null"},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(converterEnv{}))
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	program, err := expr.Compile(`Describe(1)`, expr.Env(converterEnv{}))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use 1 as expr_test.nullString: unsupported type int")
+}
+
+type nullableEnv struct {
+	Name    sql.NullString
+	Nick    sql.NullString
+	Age     sql.NullInt64
+	Score   sql.NullFloat64
+	Ptr     *int
+	Nil     *int
+	Tags    []sql.NullString
+	User    *nullableEnv
+	Counter func(n sql.NullInt64) int64
+}
+
+func TestExpr_nullable(t *testing.T) {
+	n := 42
+	env := nullableEnv{
+		Name:  sql.NullString{String: "foo", Valid: true},
+		Age:   sql.NullInt64{Int64: 30, Valid: true},
+		Ptr:   &n,
+		Tags:  []sql.NullString{{String: "a", Valid: true}, {}},
+		Score: sql.NullFloat64{Float64: 0.5, Valid: true},
+		Counter: func(n sql.NullInt64) int64 {
+			if !n.Valid {
+				return -1
+			}
+			return n.Int64
+		},
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`Name`, "foo"},
+		{`Nick`, nil},
+		{`Nil`, nil},
+		{`Name + "bar"`, "foobar"},
+		{`Nick == nil && Name != nil`, true},
+		{`Nick ?? "none"`, "none"},
+		{`Name ?? "none"`, "foo"},
+		{`Age > 18 && Ptr == 42`, true},
+		{`Age + Score`, 30.5},
+		{`Nil ?? Ptr ?? 0`, 42},
+		{`Nil == nil`, true},
+		{`User?.Name == nil`, true},
+		{`User?.Name ?? "anonymous"`, "anonymous"},
+		{`map(Tags, {# ?? "-"})`, []interface{}{"a", "-"}},
+		{`Counter(Age) + Counter(nil) + Counter(7)`, 36},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(nullableEnv{}))
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	_, err := expr.Compile(`Name + 1`, expr.Env(nullableEnv{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: + (mismatched types string and int)")
+
+	program, err := expr.Compile(`Counter("1")`, expr.Env(nullableEnv{}))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use string as sql.NullInt64")
+}
+
+type rawEnv struct {
+	Payload json.RawMessage
+	Items   []json.RawMessage
+	Any     interface{}
+	Empty   json.RawMessage
+	Bad     json.RawMessage
+}
+
+func TestExpr_raw_json(t *testing.T) {
+	env := rawEnv{
+		Payload: json.RawMessage(`{"user": {"name": "foo", "tags": ["a", "b"]}, "count": 3}`),
+		Items:   []json.RawMessage{json.RawMessage(`1`), json.RawMessage(`{"x": 2}`)},
+		Any:     map[string]interface{}{"raw": json.RawMessage(`{"ok": true}`)},
+		Bad:     json.RawMessage(`{`),
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`Payload.user.name`, "foo"},
+		{`Payload.user.tags[1] + Payload["user"].name`, "bfoo"},
+		{`Payload.count * 2`, 6.0},
+		{`Payload?.missing?.name`, nil},
+		{`len(Payload.user.tags)`, 2},
+		{`Items[0] + Items[1].x`, 3.0},
+		{`map(Items, {types.of(#)})`, []interface{}{"float", "map"}},
+		{`Any.raw.ok`, true},
+		{`Empty == nil`, true},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(rawEnv{}))
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	program, err := expr.Compile(`Bad.foo`, expr.Env(rawEnv{}))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot decode json.RawMessage: unexpected end of JSON input")
+
+	out, err := expr.Eval(`Payload.user.name`, map[string]interface{}{"Payload": env.Payload})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", out)
+}
+
+type stamp struct {
+	Seconds int64
+	Nanos   int32
+}
+
+type stringWrapper struct {
+	Value string
+}
+
+type pair struct {
+	A, B int
+}
+
+type convertedEnv struct {
+	Created *stamp
+	Updated *stamp
+	Stamps  []*stamp
+	Label   *stringWrapper
+	Empty   *stringWrapper
+	Pair    string
+}
+
+func TestExpr_Converter(t *testing.T) {
+	converters := expr.Converter(
+		func(s *stamp) time.Time {
+			if s == nil {
+				return time.Time{}
+			}
+			return time.Unix(s.Seconds, int64(s.Nanos)).UTC()
+		},
+		func(w *stringWrapper) *string {
+			if w == nil {
+				return nil
+			}
+			return &w.Value
+		},
+	)
+	env := convertedEnv{
+		Created: &stamp{Seconds: 1e9},
+		Updated: &stamp{Seconds: 2e9},
+		Stamps:  []*stamp{{Seconds: 1}, {Seconds: 2}},
+		Label:   &stringWrapper{Value: "foo"},
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`Created.Year()`, 2001},
+		{`Updated > Created`, true},
+		{`Updated - Created`, time.Duration(1e18)},
+		{`map(Stamps, {#.Unix()})`, []interface{}{int64(1), int64(2)}},
+		{`Label + "bar"`, "foobar"},
+		{`Empty ?? "none"`, "none"},
+		{`Empty == nil && Label != nil`, true},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(convertedEnv{}), converters)
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	_, err := expr.Compile(`Created.Seconds`, expr.Env(convertedEnv{}), converters)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "type time.Time has no field Seconds")
+
+	program, err := expr.Compile(`Pair.A + Pair.B`, expr.Env(convertedEnv{}), expr.Converter(func(s string) pair {
+		return pair{A: len(s), B: 1}
+	}))
+	require.NoError(t, err)
+	out, err := expr.Run(program, convertedEnv{Pair: "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, out)
+
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.Converter(func(a, b int) int { return a + b }))
+	})
+}
+
+func TestExpr_LangVersion(t *testing.T) {
+	env := map[string]interface{}{
+		"like": 2,
+		"a":    nil,
+		"try": func(a, b interface{}) interface{} {
+			return "env"
+		},
+		"fail": func() (int, error) {
+			return 0, errors.New("fail")
+		},
+	}
+
+	out, err := expr.Eval(`try(fail(), 2)`, env)
+	require.NoError(t, err)
+	assert.Equal(t, 2, out)
+
+	program, err := expr.Compile(`try(1, 2)`, expr.Env(env), expr.LangVersion(1))
+	require.NoError(t, err)
+	out, err = expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, "env", out)
+
+	program, err = expr.Compile(`like * 10`, expr.Env(env), expr.LangVersion(1))
+	require.NoError(t, err)
+	out, err = expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, 20, out)
+
+	_, err = expr.Compile(`a ?? 1`, expr.Env(env), expr.LangVersion(1))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "operator ?? requires language version 2")
+
+	_, err = expr.Compile(`a ?? 1`, expr.Env(env), expr.LangVersion(2))
+	require.NoError(t, err)
+
+	_, err = expr.Compile(`1`, expr.LangVersion(0))
+	require.NoError(t, err)
+}
+
+type mapKeyID int64
+
+type mapKeyCode string
+
+func TestExpr_map_typed_keys(t *testing.T) {
+	env := map[string]interface{}{
+		"ids":    map[int64]string{1: "one", 2: "two"},
+		"named":  map[mapKeyID]string{7: "seven"},
+		"codes":  map[mapKeyCode]int{"EU": 27},
+		"small":  map[uint8]bool{255: true},
+		"prices": map[float64]string{1.5: "cheap", 2: "two"},
+		"id":     2,
+		"key":    interface{}(int32(7)),
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`ids[1]`, "one"},
+		{`ids[id]`, "two"},
+		{`ids[3]`, ""},
+		{`named[7] + named[key]`, "sevenseven"},
+		{`codes["EU"]`, 27},
+		{`small[255]`, true},
+		{`prices[2] + prices[1.5]`, "twocheap"},
+		{`1 in ids && 7 in named && !(3 in ids)`, true},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(env))
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+
+		out, err = expr.Eval(test.code, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	errors := []struct {
+		code string
+		err  string
+	}{
+		{`small[256]`, "cannot use 256 as key of map[uint8]bool"},
+		{`ids[1.5]`, "cannot use 1.5 as key of map[int64]string"},
+		{`ids["1"]`, "cannot use string to get an element from map[int64]string"},
+	}
+	for _, test := range errors {
+		_, err := expr.Compile(test.code, expr.Env(env))
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+
+	for _, code := range []string{`small[id * 200]`, `small[-1]`} {
+		program, err := expr.Compile(code, expr.Env(env))
+		require.NoError(t, err, code)
+		_, err = expr.Run(program, env)
+		require.Error(t, err, code)
+		assert.Contains(t, err.Error(), "cannot use int as key of map[uint8]bool", code)
+	}
+}
+
 func TestExpr_map_default_values_compile_check(t *testing.T) {
 	tests := []struct {
 		env   interface{}
@@ -1234,35 +1785,1527 @@ func TestConstExpr_error_no_env(t *testing.T) {
 	})
 }
 
-var stringer = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+func TestBuiltins(t *testing.T) {
+	_, err := expr.Compile(`strings.upper(json.encode(1))`, expr.Builtins("strings", "json.encode"))
+	require.NoError(t, err)
 
-type stringerPatcher struct{}
+	_, err = expr.Compile(`base64.encode("")`, expr.Builtins("strings", "json.encode"), expr.Env(map[string]interface{}{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown name base64")
 
-func (p *stringerPatcher) Visit(node *ast.Node) {
-	t := (*node).Type()
-	if t == nil {
-		return
-	}
-	if t.Implements(stringer) {
-		ast.Patch(node, &ast.CallNode{
-			Callee: &ast.MemberNode{
-				Node:     *node,
-				Property: &ast.StringNode{Value: "String"},
-			},
-		})
-	}
+	_, err = expr.Compile(`math.abs(-1)`, expr.Builtins("strings"), expr.Env(map[string]interface{}{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown name math")
 }
 
-func TestPatch(t *testing.T) {
-	program, err := expr.Compile(
-		`Ticket == "$100" and "$90" != Ticket + "0"`,
-		expr.Env(mockEnv{}),
-		expr.Patch(&stringerPatcher{}),
-	)
+func TestDisableBuiltins(t *testing.T) {
+	_, err := expr.Compile(`strings.trim(" a ")`, expr.DisableBuiltins("strings"), expr.Env(map[string]interface{}{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown name strings")
+
+	_, err = expr.Compile(`json.encode(1)`, expr.DisableBuiltins("json.encode"), expr.Env(map[string]interface{}{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown function json.encode")
+
+	_, err = expr.Compile(`strings.upper("a")`, expr.DisableBuiltins("strings.trim"), expr.Env(map[string]interface{}{}))
 	require.NoError(t, err)
+}
 
-	env := mockEnv{
-		Ticket: &ticket{Price: 100},
+func TestBuiltins_aliases(t *testing.T) {
+	env := map[string]interface{}{"m": map[string]int{"a": 1}}
+
+	out, err := expr.Eval(`toJSON(keys(m)) == json.encode(maps.keys(m)) && type(1) == "int"`, env)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+
+	_, err = expr.Compile(`toJSON(1)`, expr.DisableBuiltins("json"), expr.Env(env))
+	require.Error(t, err)
+
+	_, err = expr.Compile(`toJSON(1) + uuid()`, expr.DisableBuiltins("uuid"), expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown name uuid")
+
+	_, err = expr.Compile(`toJSON(1) + json.encode(1)`, expr.Builtins("toJSON"), expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown name json")
+
+	// Identifiers of the environment take precedence over aliases.
+	out, err = expr.Eval(`keys + 1`, map[string]interface{}{"keys": 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, out)
+
+	// Overrides of builtins of namespaces override their aliases too.
+	program, err := expr.Compile(`toJSON(1)`, expr.Builtin(&builtin.Function{
+		Name: "json.encode",
+		Func: func(args ...interface{}) (interface{}, error) {
+			return "json", nil
+		},
+	}))
+	require.NoError(t, err)
+	out, err = expr.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, "json", out)
+}
+
+func TestBuiltin_custom(t *testing.T) {
+	lookup := &builtin.Function{
+		Name: "mycorp.lookup",
+		Func: func(args ...interface{}) (interface{}, error) {
+			return "value of " + args[0].(string), nil
+		},
+		Types:            []reflect.Type{reflect.TypeOf(func(string) string { return "" })},
+		NonDeterministic: true,
+	}
+	upper := &builtin.Function{
+		Name: "strings.upper",
+		Func: func(args ...interface{}) (interface{}, error) {
+			return "overridden", nil
+		},
+	}
+
+	program, err := expr.Compile(`mycorp.lookup("key") + " " + strings.upper("a")`, expr.Builtin(lookup, upper))
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "value of key overridden", out)
+
+	_, err = expr.Compile(`mycorp.lookup(1)`, expr.Builtin(lookup))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use (int) as arguments to call mycorp.lookup")
+}
+
+func TestFunction(t *testing.T) {
+	join := expr.Function(
+		"join",
+		func(params ...interface{}) (interface{}, error) {
+			s := params[0].(string)
+			for _, p := range params[1:] {
+				s += "," + p.(string)
+			}
+			return s, nil
+		},
+		new(func(string, ...string) string),
+	)
+
+	program, err := expr.Compile(`join("a") + ";" + join("a", "b", "c")`, join)
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "a;a,b,c", out)
+
+	_, err = expr.Compile(`join()`, join)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not enough arguments to call join")
+
+	_, err = expr.Compile(`join("a", 1)`, join)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use (string, int) as arguments to call join")
+
+	assert.Panics(t, func() {
+		expr.Function("f", nil, func(string) string { return "" })
+	})
+}
+
+func TestFunction_not_called_during_compilation(t *testing.T) {
+	calls := 0
+	lookup := expr.Function(
+		"lookup",
+		func(params ...interface{}) (interface{}, error) {
+			calls++
+			return params[0].(string) + "!", nil
+		},
+		new(func(string) string),
+	)
+
+	program, err := expr.Compile(`lookup("a")`, lookup, expr.WithCache(10))
+	require.NoError(t, err)
+	assert.Equal(t, 0, calls)
+
+	for i := 1; i <= 3; i++ {
+		out, err := expr.Run(program, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "a!", out)
+		assert.Equal(t, i, calls)
+	}
+
+	_, err = expr.Compile(`lookup("a")`, lookup, expr.Deterministic())
+	require.NoError(t, err)
+}
+
+func TestBuiltin_defaults(t *testing.T) {
+	pad := &builtin.Function{
+		Name: "pad",
+		Func: func(args ...interface{}) (interface{}, error) {
+			s := args[0].(string)
+			for len(s) < args[1].(int) {
+				s = args[2].(string) + s
+			}
+			return s, nil
+		},
+		Types:    []reflect.Type{reflect.TypeOf(func(string, int, string) string { return "" })},
+		Defaults: []interface{}{8, " "},
+	}
+	env := map[string]interface{}{"s": "42"}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`pad(s)`, "      42"},
+		{`pad(s, 4)`, "  42"},
+		{`pad(s, 4, "0")`, "0042"},
+		{`pad("7", 3, "0")`, "007"},
+	}
+
+	for _, tt := range tests {
+		program, err := expr.Compile(tt.code, expr.Env(env), expr.Builtin(pad))
+		require.NoError(t, err, tt.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+	}
+
+	_, err := expr.Compile(`pad()`, expr.Builtin(pad))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not enough arguments to call pad")
+
+	_, err = expr.Compile(`pad("a", 1, "b", "c")`, expr.Builtin(pad))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too many arguments to call pad")
+
+	_, err = expr.Compile(`pad("a", "b")`, expr.Builtin(pad))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use (string, string) as arguments to call pad")
+
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`bad("a")`, expr.Builtin(&builtin.Function{
+			Name:     "bad",
+			Func:     pad.Func,
+			Types:    pad.Types,
+			Defaults: []interface{}{"8", " "},
+		}))
+	})
+}
+
+func TestOverload(t *testing.T) {
+	describe := expr.Overload(
+		"describe",
+		func(s string) string { return "string " + s },
+		func(i int) string { return fmt.Sprintf("int %v", i) },
+		func(f float64) string { return fmt.Sprintf("float %v", f) },
+		func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		},
+	)
+	type Env struct {
+		S   string
+		F   float64
+		Any interface{}
+	}
+	env := Env{S: "a", F: 0.5, Any: 42}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`describe(S)`, "string a"},
+		{`describe(1)`, "int 1"},
+		{`describe(F)`, "float 0.5"},
+		{`describe(Any)`, "int 42"},
+		{`describe(6, 3)`, 2},
+		{`describe(Any, 2) + 1`, 22},
+	}
+
+	for _, tt := range tests {
+		program, err := expr.Compile(tt.code, expr.Env(Env{}), describe)
+		require.NoError(t, err, tt.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+	}
+
+	_, err := expr.Compile(`describe(true)`, expr.Env(Env{}), describe)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use (bool) as arguments to call describe")
+
+	_, err = expr.Compile(`describe(S) + 1`, expr.Env(Env{}), describe)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: + (mismatched types string and int)")
+
+	program, err := expr.Compile(`describe(Any)`, expr.Env(Env{}), describe)
+	require.NoError(t, err)
+
+	_, err = expr.Run(program, Env{Any: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no overload of describe accepts arguments of types [bool]")
+
+	program, err = expr.Compile(`describe(1, 0)`, describe)
+	require.NoError(t, err)
+
+	_, err = expr.Run(program, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "division by zero")
+}
+
+func TestBuiltin_namespace_shadowed_by_env(t *testing.T) {
+	env := map[string]interface{}{
+		"strings": map[string]interface{}{
+			"upper": func(s string) string { return "custom" },
+		},
+	}
+
+	out, err := expr.Eval(`strings.upper("a")`, env)
+	require.NoError(t, err)
+	assert.Equal(t, "A", out)
+
+	program, err := expr.Compile(`strings.upper("a")`, expr.Env(env))
+	require.NoError(t, err)
+
+	out, err = expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, "custom", out)
+}
+
+var stringer = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+type stringerPatcher struct{}
+
+func (p *stringerPatcher) Visit(node *ast.Node) {
+	t := (*node).Type()
+	if t == nil {
+		return
+	}
+	if t.Implements(stringer) {
+		ast.Patch(node, &ast.CallNode{
+			Callee: &ast.MemberNode{
+				Node:     *node,
+				Property: &ast.StringNode{Value: "String"},
+			},
+		})
+	}
+}
+
+type Namer interface {
+	Name() string
+}
+
+type Greeter interface {
+	Namer
+	Greet(name string) string
+	Self() Greeter
+}
+
+type english struct{}
+
+// Age shifts indexes of other methods compared to Greeter interface.
+func (english) Age() int                 { return 42 }
+func (english) Name() string             { return "english" }
+func (english) Greet(name string) string { return "hello " + name }
+func (e english) Self() Greeter          { return e }
+
+type greeterHolder struct {
+	Greeter
+}
+
+func TestInterfaceMethods(t *testing.T) {
+	type Env struct {
+		Greeter Greeter
+		Holder  greeterHolder
+		Ptr     *greeterHolder
+	}
+	env := Env{
+		Greeter: english{},
+		Holder:  greeterHolder{english{}},
+		Ptr:     &greeterHolder{english{}},
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`Greeter.Name()`, "english"},
+		{`Greeter.Greet("world")`, "hello world"},
+		{`Greeter.Self().Self().Name()`, "english"},
+		{`Holder.Greet("world")`, "hello world"},
+		{`Holder.Greeter.Name()`, "english"},
+		{`Ptr.Name()`, "english"},
+	}
+
+	for _, tt := range tests {
+		program, err := expr.Compile(tt.code, expr.Env(Env{}))
+		require.NoError(t, err, tt.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+
+		out, err = expr.Eval(tt.code, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+	}
+}
+
+func TestInterfaceMethods_errors(t *testing.T) {
+	type Env struct {
+		Greeter Greeter
+	}
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`Greeter.Age()`, "type expr_test.Greeter has no method Age"},
+		{`Greeter.Greet(1)`, "cannot use int as argument (type string) to call Greet"},
+		{`Greeter.Greet()`, "not enough arguments to call Greet"},
+		{`Greeter.Name() + 1`, "invalid operation: + (mismatched types string and int)"},
+	}
+
+	for _, tt := range tests {
+		_, err := expr.Compile(tt.code, expr.Env(Env{}))
+		require.Error(t, err, tt.code)
+		assert.Contains(t, err.Error(), tt.err, tt.code)
+	}
+}
+
+func TestTry(t *testing.T) {
+	env := map[string]interface{}{
+		"lookup": func(key string) (string, error) {
+			if key == "" {
+				return "", fmt.Errorf("empty key")
+			}
+			return "value of " + key, nil
+		},
+		"keys":  []string{"a", "", "b"},
+		"zero":  0,
+		"inner": map[string]interface{}{"x": 1},
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`try(lookup("a"), "default")`, "value of a"},
+		{`try(lookup(""), "default")`, "default"},
+		{`try(lookup(""), nil)`, nil},
+		{`map(keys, {try(lookup(#), "-")})`, []interface{}{"value of a", "-", "value of b"}},
+		{`try(map(keys, {lookup(#)}), [])`, []interface{}{}},
+		{`try(1 % zero, -1) + 1`, 0},
+		{`try(json.decode("{"), {x: 42}).x`, 42},
+		{`try(try(lookup(""), lookup("")), "outer")`, "outer"},
+		{`try(inner.missing.y, 1)`, 1},
+		{`try(1 % 0, 2) * 10`, 20},
+		{`[1, try(lookup(""), 2), 3]`, []interface{}{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		program, err := expr.Compile(tt.code, expr.Env(env))
+		require.NoError(t, err, tt.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+
+		out, err = expr.Eval(tt.code, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+	}
+
+	_, err := expr.Eval(`try(lookup(""), lookup("")) + "!"`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "empty key")
+}
+
+func TestTry_limits(t *testing.T) {
+	env := map[string]interface{}{
+		"s": strings.Repeat("a", 2000),
+		"wait": func(ctx context.Context) int {
+			<-ctx.Done()
+			return 0
+		},
+	}
+
+	_, err := expr.Eval(`try(strings.levenshtein(s, s), -1)`, env)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, vm.ErrMemoryBudget))
+
+	_, err = expr.Eval(`try(1..100000000, [])`, env)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, vm.ErrMemoryBudget))
+
+	program, err := expr.Compile(`try(wait(), -1)`, expr.Env(env))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = expr.RunContext(ctx, program, env)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	program, err = expr.Compile(`try(wait(), -1)`, expr.Env(env), expr.Timeout(time.Millisecond))
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, -1, out)
+}
+
+func TestMemoize(t *testing.T) {
+	calls := map[string]int{}
+	env := map[string]interface{}{
+		"lookup": func(key string) int {
+			calls[key]++
+			return len(key)
+		},
+		"other": func(key string) int {
+			calls["other "+key]++
+			return len(key)
+		},
+		"keys": []string{"a", "bb", "a"},
+		"key":  "bb",
+	}
+
+	program, err := expr.Compile(
+		`lookup(key) + lookup(key) + other(key) + other(key) + count(keys, {lookup(#) > 0})`,
+		expr.Env(env),
+		expr.Memoize("lookup"),
+	)
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, 2+2+2+2+3, out)
+	assert.Equal(t, map[string]int{"a": 1, "bb": 1, "other bb": 2}, calls)
+
+	// Cache is not shared between runs.
+	_, err = expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 2, "bb": 2, "other bb": 4}, calls)
+
+	n := 0
+	tag := &builtin.Function{
+		Name: "tag",
+		Func: func(args ...interface{}) (interface{}, error) {
+			n++
+			return fmt.Sprint(args...), nil
+		},
+		NonDeterministic: true,
+	}
+
+	// Arrays can not be used as a cache key, and are not memoized.
+	program, err = expr.Compile(`tag("a") + tag("a") + tag([1]) + tag([1])`, expr.Builtin(tag), expr.Memoize("tag"))
+	require.NoError(t, err)
+
+	out, err = expr.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "aa[1][1]", out)
+	assert.Equal(t, 3, n)
+}
+
+func TestWithCache(t *testing.T) {
+	program, err := expr.Compile(`score * weight > 10`, expr.WithCache(2))
+	require.NoError(t, err)
+	require.NotNil(t, program.Cache)
+
+	envs := []map[string]interface{}{
+		{"score": 3, "weight": 4},
+		{"score": 3, "weight": 4},
+		{"score": 3.0, "weight": 4},
+		{"score": 1, "weight": 4},
+		{"score": 2, "weight": 4},
+	}
+	want := []int{1, 1, 2, 2, 2}
+	for i, env := range envs {
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, env["score"] != 1 && env["score"] != 2, out)
+		assert.Equal(t, want[i], program.Cache.Len(), "%v", env)
+	}
+
+	// Errors are not cached.
+	_, err = expr.Run(program, map[string]interface{}{"score": "a", "weight": 1})
+	require.Error(t, err)
+	assert.Equal(t, 2, program.Cache.Len())
+
+	// Environments with functions can not be cached.
+	out, err := expr.Run(program, map[string]interface{}{"score": 11, "weight": 1, "f": func() {}})
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+	assert.Equal(t, 2, program.Cache.Len())
+
+	program, err = expr.Compile(`rand.uuid() != f()`, expr.WithCache(2))
+	require.NoError(t, err)
+	assert.Nil(t, program.Cache)
+}
+
+var visits int
+
+type visitsEnv struct {
+	User string
+}
+
+func (visitsEnv) Visits(ctx context.Context) int {
+	visits++
+	return visits
+}
+
+func (visitsEnv) Count(step int8) int {
+	visits += int(step)
+	return visits
+}
+
+func TestWithCache_method(t *testing.T) {
+	// Methods with registered accessors are called by OpCallMethod.
+	runtime.Register(reflect.TypeOf(visitsEnv{}), &runtime.Accessors{
+		Methods: map[string]func(interface{}, []interface{}) (interface{}, bool){
+			"Count": func(receiver interface{}, args []interface{}) (interface{}, bool) {
+				env, ok := receiver.(visitsEnv)
+				if !ok {
+					return nil, false
+				}
+				return env.Count(args[0].(int8)), true
+			},
+		},
+	})
+	defer runtime.Register(reflect.TypeOf(visitsEnv{}), nil)
+
+	visits = 0
+	program, err := expr.Compile(`Count(1)`, expr.Env(visitsEnv{}), expr.WithCache(2))
+	require.NoError(t, err)
+	assert.Nil(t, program.Cache)
+	assert.Contains(t, program.Disassemble(), "OpCallMethod")
+
+	env := visitsEnv{User: "John"}
+	for i := 1; i <= 2; i++ {
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, i, out)
+	}
+}
+
+func TestWithCache_context(t *testing.T) {
+	visits = 0
+	program, err := expr.Compile(`Visits()`, expr.Env(visitsEnv{}), expr.WithCache(2))
+	require.NoError(t, err)
+	assert.Nil(t, program.Cache)
+
+	env := visitsEnv{User: "John"}
+	for i := 1; i <= 2; i++ {
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, i, out)
+	}
+}
+
+func TestZeroDivision(t *testing.T) {
+	env := map[string]interface{}{
+		"a":    10,
+		"zero": 0,
+		"fa":   1.5,
+		"fz":   0.0,
+	}
+	type test struct {
+		code string
+		want interface{}
+	}
+	tests := []struct {
+		option expr.Option
+		tests  []test
+	}{
+		{expr.ZeroDivisionNil(), []test{
+			{`a / zero`, nil},
+			{`a % zero`, nil},
+			{`fa / fz`, nil},
+			{`a / 0`, nil},
+			{`a % 0 == nil`, true},
+			{`a / 2`, 5.0},
+			{`a % 3`, 1},
+		}},
+		{expr.ZeroDivisionValue(-1), []test{
+			{`a / zero`, -1},
+			{`a % zero`, -1},
+			{`fa / fz`, -1},
+			{`1 % 0`, -1},
+		}},
+		{expr.ZeroDivisionIEEE(), []test{
+			{`a / zero`, math.Inf(1)},
+			{`-a / zero`, math.Inf(-1)},
+			{`fa / fz`, math.Inf(1)},
+			{`a % zero != a % zero`, true},
+			{`0 / zero != 0 / zero`, true},
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, test := range tt.tests {
+			program, err := expr.Compile(test.code, expr.Env(env), tt.option)
+			require.NoError(t, err, test.code)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err, test.code)
+			assert.Equal(t, test.want, out, test.code)
+		}
+	}
+
+	for _, code := range []string{`a / zero`, `a % zero`, `fa / fz`, `1 / 0`, `1 % 0`} {
+		program, err := expr.Compile(code, expr.Env(env), expr.ZeroDivisionError())
+		require.NoError(t, err, code)
+
+		_, err = expr.Run(program, env)
+		require.Error(t, err, code)
+		assert.Contains(t, err.Error(), "division by zero", code)
+	}
+}
+
+func TestFloatEqual(t *testing.T) {
+	env := map[string]interface{}{
+		"a":   0.1,
+		"b":   0.2,
+		"one": 1,
+		"big": 1e20,
+		"nan": math.NaN(),
+		"any": interface{}(0.3),
+	}
+	type test struct {
+		code string
+		want bool
+	}
+	tests := []struct {
+		options []expr.Option
+		tests   []test
+	}{
+		{nil, []test{
+			{`0.1 + 0.2 == 0.3`, false},
+			{`a + b == 0.3`, false},
+		}},
+		{[]expr.Option{expr.FloatEpsilon(1e-9)}, []test{
+			{`0.1 + 0.2 == 0.3`, true},
+			{`a + b == 0.3`, true},
+			{`a + b != 0.3`, false},
+			{`a + b == any`, true},
+			{`a * 10 == one`, true},
+			{`a == 0.2`, false},
+			{`big + 1e6 == big`, false},
+			{`nan == nan`, false},
+			{`one == 1`, true},
+			{`"a" == "a"`, true},
+		}},
+		{[]expr.Option{expr.FloatULP(4)}, []test{
+			{`a + b == 0.3`, true},
+			{`big * 3 / 3 == big`, true},
+			{`big + 1e6 == big`, false},
+			{`a == 0.2`, false},
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, test := range tt.tests {
+			program, err := expr.Compile(test.code, append([]expr.Option{expr.Env(env)}, tt.options...)...)
+			require.NoError(t, err, test.code)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err, test.code)
+			assert.Equal(t, test.want, out, test.code)
+		}
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	env := map[string]interface{}{
+		"a":    1.5,
+		"zero": 0.0,
+		"big":  1e308,
+		"nan":  math.NaN(),
+		"inf":  math.Inf(1),
+		"one":  1,
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`a / zero`, nil},
+		{`zero / zero`, nil},
+		{`big * 10`, nil},
+		{`big * 10 == nil`, false},
+		{`nan == nil`, false},
+		{`nan != nan`, true},
+		{`inf > a`, true},
+		{`1 / 0.0 > 0`, true},
+		{`a / zero - inf`, nil},
+		{`[a / zero][0]`, nil},
+		{`math.sqrt(-a)`, nil},
+		{`math.min(one, nan, 2)`, nil},
+		{`math.max(nan, one)`, nil},
+		{`stats.percentile([3, nan, 1], 50)`, nil},
+		{`1.0 / 0`, nil},
+		{`a * 2`, 3.0},
+		{`one / 2`, 0.5},
+		{`math.min(one, 2)`, 1},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(env), expr.NonFiniteNil())
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	for _, code := range []string{`a / zero`, `big * 10`, `nan < 1`, `inf > a`, `math.sqrt(-a)`, `1.0 / 0`, `math.max(nan, one)`, `stats.percentile([3, nan, 1], 50)`, `stats.stddev([nan, 1])`} {
+		program, err := expr.Compile(code, expr.Env(env), expr.NonFiniteError())
+		require.NoError(t, err, code)
+
+		_, err = expr.Run(program, env)
+		require.Error(t, err, code)
+		assert.Contains(t, err.Error(), "non-finite number", code)
+	}
+
+	out, err := expr.Eval(`a / zero`, env)
+	require.NoError(t, err)
+	assert.Equal(t, math.Inf(1), out)
+
+	program, err := expr.Compile(`math.min(one, nan) != math.min(one, nan)`, expr.Env(env), expr.NonFiniteError(), expr.NonFinitePropagate())
+	require.NoError(t, err)
+	out, err = expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+}
+
+func TestWarnings(t *testing.T) {
+	env := map[string]interface{}{
+		"a":    1,
+		"s":    "str",
+		"list": []int{1, 2, 3},
+		"json": map[string]interface{}{"encode": func(v interface{}) string { return "custom" }},
+		"sqrt": func(x float64) float64 { return x },
+	}
+	tests := []struct {
+		code     string
+		warnings []string
+	}{
+		{`a > 0`, nil},
+		{`a == a`, []string{"comparison is always true (1:3)"}},
+		{`s != s`, []string{"comparison is always false (1:3)"}},
+		{`1 == 2`, []string{"comparison is always false (1:3)"}},
+		{`nil == nil`, []string{"comparison is always true (1:5)"}},
+		{`sqrt(4)`, []string{"integer 4 is implicitly converted to float64 (1:6)"}},
+		{`sqrt(4.0)`, nil},
+		{`map(list, {1})`, []string{"closure does not use its argument # (1:11)"}},
+		{`map(list, {map(list, {#})})`, []string{"closure does not use its argument # (1:11)"}},
+		{`all(list, {# > 0})`, nil},
+		{`json.encode(1)`, []string{"json shadows builtin (1:1)"}},
+		{`let x = a; a + 1`, []string{"variable x is unused (1:1)"}},
+		{`let (q, r) = (a, 2); q`, []string{"variable r is unused (1:1)"}},
+		{`let x = a; let x = 2; x`, []string{"variable x is unused (1:1)"}},
+		{`let x = a; [x + y for y in list]`, nil},
+		{`let x = a; let y = x; y`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+
+			var warnings []string
+			for _, w := range program.Warnings {
+				warnings = append(warnings, strings.SplitN(w.Error(), "\n", 2)[0])
+			}
+			assert.Equal(t, tt.warnings, warnings)
+		})
+	}
+}
+
+func TestRule(t *testing.T) {
+	env := map[string]interface{}{
+		"httpGet": func(url string) string { return url },
+		"price":   1.5,
+	}
+	noHTTP := expr.Check("no-http", func(r *conf.Report, node ast.Node) {
+		if call, ok := node.(*ast.CallNode); ok {
+			if callee, ok := call.Callee.(*ast.IdentifierNode); ok && callee.Value == "httpGet" {
+				r.Errorf(call, "calls to httpGet are forbidden in this context")
+			}
+		}
+	})
+	floats := expr.Check("floats", func(r *conf.Report, node ast.Node) {
+		if b, ok := node.(*ast.BinaryNode); ok && b.Operator == "==" && b.Left.Type() != nil && b.Left.Type().Kind() == reflect.Float64 {
+			r.Warnf(b, "comparison of floats")
+		}
+	})
+
+	_, err := expr.Compile(`price > 0 and httpGet("http://example.com") != ""`, expr.Env(env), noHTTP, floats)
+	require.Error(t, err)
+	assert.Equal(t, "calls to httpGet are forbidden in this context (1:15)\n | price > 0 and httpGet(\"http://example.com\") != \"\"\n | ..............^", err.Error())
+
+	var fileError *file.Error
+	require.True(t, errors.As(err, &fileError))
+	assert.Equal(t, file.Location{Line: 1, Column: 43}, fileError.End)
+
+	program, err := expr.Compile(`price == 1.5`, expr.Env(env), noHTTP, floats)
+	require.NoError(t, err)
+	require.Len(t, program.Warnings, 1)
+	assert.Equal(t, "comparison of floats", program.Warnings[0].Message)
+	assert.Equal(t, "error: comparison of floats\n --> 1:1\n  |\n1 | price == 1.5\n  | ^^^^^^^^^^^^", program.Warnings[0].Render(false))
+}
+
+type receiverOrder struct {
+	Amount   int
+	Currency string
+	Items    []string
+}
+
+func (o receiverOrder) Total() int {
+	return o.Amount * len(o.Items)
+}
+
+func TestImplicitReceiver(t *testing.T) {
+	type Env struct {
+		Order    receiverOrder
+		Currency string
+	}
+	env := Env{Order: receiverOrder{Amount: 10, Currency: "EUR", Items: []string{"a", "b"}}, Currency: "USD"}
+
+	program, err := expr.Compile(`Amount > 5 and Total() == 20 and Currency == "USD" and Order.Currency == "EUR"`, expr.Env(Env{}), expr.ImplicitReceiver("Order"))
+	require.NoError(t, err)
+	output, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, output)
+
+	_, err = expr.Compile(`Amount + "1"`, expr.Env(Env{}), expr.ImplicitReceiver("Order"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: + (mismatched types int and string)")
+
+	_, err = expr.Compile(`Amont > 5`, expr.Env(Env{}), expr.ImplicitReceiver("Order"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown name Amont")
+
+	mapEnv := map[string]interface{}{
+		"order": map[string]interface{}{"amount": 10},
+		"limit": 5,
+	}
+	program, err = expr.Compile(`amount > limit`, expr.Env(mapEnv), expr.ImplicitReceiver("order"))
+	require.NoError(t, err)
+	output, err = expr.Run(program, mapEnv)
+	require.NoError(t, err)
+	assert.Equal(t, true, output)
+}
+
+func TestTranslate(t *testing.T) {
+	catalog := file.Catalog{
+		"unknown name %v":                       "nom inconnu %v",
+		", did you mean %v?":                    ", vouliez-vous dire %v ?",
+		"unexpected token %v":                   "jeton inattendu %v",
+		"cannot fetch %v from %T":               "impossible de lire %[1]v de %[2]T",
+		"comparison is always %v":               "la comparaison est toujours %v",
+		"runtime error: integer divide by zero": "division entière par zéro",
+	}
+	env := map[string]interface{}{
+		"a":   1,
+		"obj": map[string]interface{}{},
+	}
+	option := expr.Translate(catalog.Translate)
+
+	_, err := expr.Compile(`b`, expr.Env(env), option)
+	require.Error(t, err)
+	assert.Equal(t, "nom inconnu b, vouliez-vous dire a ? (1:1)\n | b\n | ^", err.Error())
+
+	_, err = expr.Compile(`a +`, expr.Env(env), option)
+	require.Error(t, err)
+	assert.Equal(t, "jeton inattendu EOF (1:3)\n | a +\n | ..^", err.Error())
+
+	_, err = expr.Compile(`a )`, expr.Env(env), option)
+	require.Error(t, err)
+	assert.Equal(t, "jeton inattendu Bracket(\")\") (1:3)\n | a )\n | ..^", err.Error())
+
+	program, err := expr.Compile(`a == a`, expr.Env(env), option)
+	require.NoError(t, err)
+	require.Len(t, program.Warnings, 1)
+	assert.Equal(t, "la comparaison est toujours true", program.Warnings[0].Message)
+
+	program, err = expr.Compile(`obj.x.y`, expr.Env(env), option)
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Equal(t, "impossible de lire y de <nil> (1:7)\n | obj.x.y\n | ......^", err.Error())
+
+	program, err = expr.Compile(`a % (a - 1)`, expr.Env(env), option)
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "division entière par zéro")
+}
+
+func TestBroadcast(t *testing.T) {
+	env := map[string]interface{}{
+		"prices": []float64{10, 20},
+		"a":      []int{1, 2, 3},
+		"b":      []int{4, 5, 6},
+		"c":      []int{1},
+		"any":    []interface{}{1, 2.5, 3},
+		"x":      2,
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`prices * 1.5`, []interface{}{15.0, 30.0}},
+		{`a + b`, []interface{}{5, 7, 9}},
+		{`x * a - b`, []interface{}{-2, -1, 0}},
+		{`(a + 1) * (b - 1) % 4`, []interface{}{2, 0, 0}},
+		{`2 ** a`, []interface{}{2.0, 4.0, 8.0}},
+		{`b / 2`, []interface{}{2.0, 2.5, 3.0}},
+		{`any * 2`, []interface{}{2, 5.0, 6}},
+		{`[1, 2] * 3`, []interface{}{3, 6}},
+		{`len(a + b) + (a * 2)[2]`, 9},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(env), expr.Broadcast())
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	program, err := expr.Compile(`a * 2 + b - 1`, expr.Env(env), expr.Broadcast())
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(program.Disassemble(), "OpBroadcast"))
+
+	program, err = expr.Compile(`a + c`, expr.Env(env), expr.Broadcast())
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mismatched lengths of arrays (3 and 1)")
+
+	_, err = expr.Compile(`a + b`, expr.Env(env))
+	require.Error(t, err)
+
+	_, err = expr.Compile(`a + "b"`, expr.Env(env), expr.Broadcast())
+	require.Error(t, err)
+}
+
+func TestDeterministic(t *testing.T) {
+	env := map[string]interface{}{
+		"m":      map[string]int{"a": 1, "b": 2},
+		"random": func() int { return 4 },
+	}
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`rand.uuid()`, "rand.uuid is not deterministic (1:6)"},
+		{`len(rand.uuid()) > 0`, "rand.uuid is not deterministic (1:10)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			_, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+
+			_, err = expr.Compile(tt.code, expr.Env(env), expr.Deterministic())
+			require.Error(t, err)
+			require.Equal(t, tt.err, strings.Split(err.Error(), "\n")[0])
+		})
+	}
+
+	program, err := expr.Compile(`m.a + random() + len(json.encode(m))`, expr.Env(env), expr.Deterministic())
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, 18, out)
+
+	program, err = expr.Compile(`maps.keys(m)[0] + convert.string(maps.values(m)[1])`, expr.Env(env), expr.Deterministic())
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		out, err = expr.Run(program, env)
+		require.NoError(t, err)
+		require.Equal(t, "a2", out)
+	}
+}
+
+type typeAtUser struct {
+	Name string `doc:"Full name."`
+}
+
+func (typeAtUser) Greet(greeting string) string { return greeting }
+
+type typeAtEnv struct {
+	User  typeAtUser `doc:"Current user."`
+	Users []typeAtUser
+}
+
+func (typeAtEnv) Lookup(id int) typeAtUser { return typeAtUser{} }
+
+func TestTypeAt(t *testing.T) {
+	code := `User.Name in map(Users, {.Greet("hi")}) and strings.upper(Lookup(1).Name) != rand.uuid()`
+	config := conf.New(typeAtEnv{})
+	tree, err := parser.ParseWithOptions(code, config.ParserOptions())
+	require.NoError(t, err)
+	_, err = checker.Check(tree, config)
+	require.NoError(t, err)
+
+	tests := []struct {
+		token string
+		typ   string
+		doc   string
+	}{
+		{`User`, "expr_test.typeAtUser", "Current user."},
+		{`Name`, "string", "Full name."},
+		{`in`, "bool", "Reports whether element is in array, key is in map, or field is in struct."},
+		{`map`, "[]string", "Returns results of the closure for every element."},
+		{`Greet`, "func(string) string", ""},
+		{`"hi"`, "string", ""},
+		{`and`, "bool", "Reports whether both operands are true."},
+		{`upper`, "func(string) string", "Converts string to upper case."},
+		{`Lookup`, "func(int) expr_test.typeAtUser", ""},
+		{`uuid`, "func() string", "Returns random UUID version 4."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			offset := strings.Index(code, tt.token)
+			for i := offset; i < offset+len(tt.token); i++ {
+				info := expr.TypeAt(tree, i, expr.Env(typeAtEnv{}))
+				require.NotNil(t, info)
+				require.Equal(t, tt.typ, info.Type.String())
+				require.Equal(t, tt.doc, info.Doc)
+				require.Equal(t, offset, info.From)
+				require.Equal(t, offset+len(tt.token), info.To)
+			}
+		})
+	}
+
+	require.Nil(t, expr.TypeAt(tree, strings.Index(code, "(")))
+	require.Nil(t, expr.TypeAt(tree, len(code)))
+}
+
+type signatureUser struct {
+	Name string
+	Age  int
+}
+
+func (signatureUser) Greet(greeting string) string {
+	return greeting
+}
+
+type signatureEnv struct {
+	User  signatureUser
+	Limit int
+}
+
+type signatureUserV2 struct {
+	FullName string
+	Age      int
+}
+
+type signatureEnvV2 struct {
+	User  signatureUserV2
+	Limit float64
+}
+
+func TestEnvSignature(t *testing.T) {
+	signature := expr.EnvSignature(signatureEnv{})
+	require.Equal(t, []string{
+		"Limit int",
+		"User expr_test.signatureUser",
+		"expr_test.signatureUser.Age int",
+		"expr_test.signatureUser.Greet func(string) string",
+		"expr_test.signatureUser.Name string",
+	}, signature.Manifest)
+	require.Len(t, signature.Hash, 64)
+	require.Equal(t, signature.Hash, expr.EnvSignature(&signatureEnv{}).Hash)
+
+	env := map[string]interface{}{"a": 1, "b": "x"}
+	require.Equal(t, []string{"a int", "b string"}, expr.EnvSignature(env).Manifest)
+	require.Equal(t, expr.EnvSignature(env).Hash, expr.EnvSignature(map[string]interface{}{"b": "y", "a": 2}).Hash)
+}
+
+func TestCheckEnv(t *testing.T) {
+	program, err := expr.Compile(`User.Age >= Limit`, expr.Env(signatureEnv{}))
+	require.NoError(t, err)
+	require.NotNil(t, program.Signature)
+
+	require.NoError(t, expr.CheckEnv(program, signatureEnv{User: signatureUser{Age: 30}}))
+
+	err = expr.CheckEnv(program, signatureEnvV2{})
+	require.Error(t, err)
+	signatureError, ok := err.(*conf.SignatureError)
+	require.True(t, ok)
+	require.Equal(t, []string{
+		"- Limit int",
+		"+ Limit float64",
+		"- User expr_test.signatureUser",
+		"+ User expr_test.signatureUserV2",
+		"- expr_test.signatureUser.Age int",
+		"- expr_test.signatureUser.Greet func(string) string",
+		"- expr_test.signatureUser.Name string",
+		"+ expr_test.signatureUserV2.Age int",
+		"+ expr_test.signatureUserV2.FullName string",
+	}, signatureError.Diff)
+	require.True(t, strings.HasPrefix(err.Error(), "environment differs from environment of compilation:\n- Limit int\n"))
+
+	program, err = expr.Compile(`1 + 2`)
+	require.NoError(t, err)
+	require.Nil(t, program.Signature)
+	require.NoError(t, expr.CheckEnv(program, signatureEnvV2{}))
+}
+
+func TestProgram_References(t *testing.T) {
+	env := map[string]interface{}{
+		"user": map[string]interface{}{
+			"Address": map[string]interface{}{"City": "Berlin"},
+			"Tags":    []string{"admin"},
+		},
+		"key":    "Address",
+		"orders": []int{1, 2},
+		"greet":  func(string) string { return "" },
+	}
+	double := expr.Function("double", func(params ...interface{}) (interface{}, error) {
+		return params[0].(int) * 2, nil
+	})
+	code := `user.Address.City == "Berlin" && "admin" in user?.Tags && user[key] != nil && all(orders, {double(#) > 0}) && len(greet("x")) > 0 && strings.upper(key) != ""`
+	program, err := expr.Compile(code, expr.Env(env), double)
+	require.NoError(t, err)
+	require.Equal(t, &vm.References{
+		Variables: []string{"key", "orders", "user"},
+		Fields:    []string{"user.Address.City", "user.Tags"},
+		Functions: []string{"all", "double", "greet", "len", "strings.upper"},
+	}, program.References())
+
+	// Calls of pure builtins with constant arguments are folded.
+	program, err = expr.Compile(`strings.upper("a") == "A"`, expr.Env(env))
+	require.NoError(t, err)
+	require.Equal(t, &vm.References{Variables: []string{}, Fields: []string{}, Functions: []string{}}, program.References())
+}
+
+type layersGlobal struct {
+	Currency string
+	Limit    int
+}
+
+func (layersGlobal) Round(x float64) int {
+	return int(x + 0.5)
+}
+
+func TestLayers(t *testing.T) {
+	request := map[string]interface{}{"Limit": 5, "Amount": 4.6}
+	session := map[string]interface{}{"User": "anna", "Currency": "USD"}
+	global := layersGlobal{Currency: "EUR", Limit: 100}
+
+	program, err := expr.Compile(
+		`Round(Amount) <= Limit && Currency == "USD" && User == "anna"`,
+		expr.Env(runtime.Layers{request, session, global}),
+	)
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, runtime.Layers{request, session, global})
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+
+	// Types of earlier layers override types of later layers.
+	_, err = expr.Compile(`Limit + 1`, expr.Env(runtime.Layers{map[string]interface{}{"Limit": "high"}, global}))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid operation: + (mismatched types string and int)")
+
+	_, err = expr.Compile(`Missing`, expr.Env(runtime.Layers{request, global}))
+	require.Error(t, err)
+
+	_, err = expr.Run(program, runtime.Layers{request, map[string]interface{}{"Currency": "USD"}, global})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown name User")
+}
+
+func TestFold(t *testing.T) {
+	type Operation struct {
+		Credit bool
+		Amount int
+	}
+	env := map[string]interface{}{
+		"Operations": []Operation{{true, 50}, {false, 20}, {true, 40}, {false, 100}},
+	}
+	code := `fold(Operations, let peak = 0, let balance = 0, {
+		balance = balance + (.Credit ? .Amount : -.Amount);
+		peak = balance > peak ? balance : peak
+	})`
+
+	program, err := expr.Compile(code, expr.Env(env))
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, 70, out)
+}
+
+func TestTuples(t *testing.T) {
+	env := map[string]interface{}{
+		"divmod": func(a, b int) (int, int) { return a / b, a % b },
+		"lookup": func(key string) (string, bool, error) {
+			if key == "" {
+				return "", false, errors.New("empty key")
+			}
+			return strings.ToUpper(key), key == "a", nil
+		},
+	}
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`let (q, r) = divmod(17, 5); q * 10 + r`, 32},
+		{`divmod(17, 5)`, runtime.Tuple{3, 2}},
+		{`divmod(17, 5)[0]`, 3},
+		{`let (value, found) = lookup("a"); found ? value : "none"`, "A"},
+		{`let (a, b) = (1, "x"); b + convert.string(a)`, "x1"},
+		{`let x = 2; let y = x * x; y + 1`, 5},
+	}
+	for _, tt := range tests {
+		out, err := expr.Eval(tt.code, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+	}
+
+	_, err := expr.Eval(`let (value, found) = lookup(""); value`, env)
+	require.EqualError(t, err, "empty key (1:22)\n | let (value, found) = lookup(\"\"); value\n | .....................^")
+}
+
+func TestReduce(t *testing.T) {
+	env := map[string]interface{}{
+		"items":   []int{3, 1, 4, 1, 5},
+		"valid":   []bool{true, true, true, false},
+		"nothing": []int{},
+	}
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`reduce(items, {#acc + #})`, 14},
+		{`reduce(items, {#acc > # ? #acc : #})`, 5},
+		{`reduce(items, {#acc + #index}, 100)`, 110},
+		{`reduce(nothing, {#acc + #})`, nil},
+		{`all(valid, {#index >= 3 || #})`, true},
+		{`filter(items, {#index % 2 == 0})`, []interface{}{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		out, err := expr.Eval(tt.code, env)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.want, out, tt.code)
+	}
+}
+
+func TestComprehension(t *testing.T) {
+	type User struct {
+		Name string
+		Age  int
+	}
+	env := map[string]interface{}{
+		"users": []User{{"Anna", 30}, {"Bob", 16}, {"Carl", 45}},
+	}
+
+	program, err := expr.Compile(`[u.Name for u in users if u.Age >= 18]`, expr.Env(env))
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"Anna", "Carl"}, out)
+
+	program, err = expr.Compile(`{(u.Name): u.Age for u in users}`, expr.Env(env))
+	require.NoError(t, err)
+	out, err = expr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"Anna": 30, "Bob": 16, "Carl": 45}, out)
+
+	// Items are selected and mapped in a single loop.
+	program, err = expr.Compile(`[x * 2 for x in 1..10 if x % 3 == 0]`)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(program.Disassemble(), "OpBegin"))
+	out, err = expr.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{6, 12, 18}, out)
+}
+
+func TestDefine(t *testing.T) {
+	env := map[string]interface{}{"user": map[string]interface{}{"Age": 20, "Country": "DE"}}
+	options := []expr.Option{
+		expr.Env(env),
+		expr.Define("adult", `user.Age >= 18`),
+		expr.Define("eu", `user.Country in ["DE", "FR"]`),
+		expr.Define("allowed", `adult && eu`),
+	}
+
+	program, err := expr.Compile(`allowed and not (user.Age > 65)`, options...)
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+
+	_, err = expr.Compile(`adult + 1`, options...)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid operation: + (mismatched types bool and int) (1:7)")
+
+	_, err = expr.Compile(`a`, expr.Define("a", `b || true`), expr.Define("b", `a`))
+	require.EqualError(t, err, "definition a is recursive (1:1)\n | a\n | ^")
+
+	_, err = expr.Compile(`x || a`, expr.Define("a", `1 +`))
+	require.EqualError(t, err, "invalid definition a: unexpected token EOF (1:6)\n | x || a\n | .....^")
+}
+
+func TestCompileSet(t *testing.T) {
+	calls := 0
+	score := expr.Function("score", func(params ...interface{}) (interface{}, error) {
+		calls++
+		return len(params[0].(string)), nil
+	}, new(func(string) int))
+	env := map[string]interface{}{"name": "anna", "age": 20}
+
+	set, err := expr.CompileSet(map[string]string{
+		"adult": `age >= 18`,
+		"long":  `score(name) > 3`,
+		"short": `score(name) < 2 && adult`,
+		"fail":  `1 % (age - 20)`,
+	}, expr.Env(env), score, expr.Memoize("score"), expr.Define("adult", `age >= 18`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"adult", "fail", "long", "short"}, set.Names)
+
+	results, err := set.Run(env)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "fail: runtime error: integer divide by zero")
+	require.Equal(t, map[string]interface{}{"adult": true, "long": true, "short": false}, results)
+	require.Equal(t, 1, calls)
+
+	_, err = expr.CompileSet(map[string]string{
+		"a": `age + "1"`,
+		"b": `unknown`,
+		"c": `age > 1`,
+	}, expr.Env(env))
+	require.Error(t, err)
+	setError, ok := err.(expr.SetError)
+	require.True(t, ok)
+	require.Len(t, setError, 2)
+	require.True(t, strings.HasPrefix(err.Error(), "a: invalid operation"))
+	require.Contains(t, err.Error(), "\nb: unknown name unknown")
+}
+
+func TestCompileSet_results(t *testing.T) {
+	env := map[string]interface{}{"total": 120, "premium": true}
+	set, err := expr.CompileSet(map[string]string{
+		"discount": `results.base + (premium ? 5 : 0)`,
+		"base":     `total > 100 ? 10 : 0`,
+		"price":    `total - total * results.discount / 100`,
+		"label":    `results.price < 100 ? "cheap" : "expensive"`,
+	}, expr.Env(env))
+	require.NoError(t, err)
+	require.Equal(t, []string{"base", "discount", "price", "label"}, set.Names)
+	require.Equal(t, []string{"discount"}, set.Dependencies["price"])
+
+	results, err := set.Run(env)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"base": 10, "discount": 15, "price": 102.0, "label": "expensive"}, results)
+
+	_, err = expr.CompileSet(map[string]string{
+		"a": `results.b + 1`,
+		"b": `results.c + 1`,
+		"c": `results.a + 1`,
+	})
+	require.EqualError(t, err, "cycle of results: a -> b -> c -> a")
+
+	_, err = expr.CompileSet(map[string]string{"a": `results.b`})
+	require.EqualError(t, err, "a: unknown expression b in results.b")
+
+	_, err = expr.CompileSet(map[string]string{"a": `results["b"] + len(results)`})
+	require.EqualError(t, err, "a: results must be used with names of expressions, like results.name (1:20)\n | results[\"b\"] + len(results)\n | ...................^")
+
+	set, err = expr.CompileSet(map[string]string{
+		"a": `1 % (total - 120)`,
+		"b": `results.a + 1`,
+		"c": `total`,
+	}, expr.Env(env))
+	require.NoError(t, err)
+	results, err = set.Run(env)
+	require.EqualError(t, err, "a: runtime error: integer divide by zero (1:3)\n | 1 % (total - 120)\n | ..^\nb: a failed")
+	require.Equal(t, map[string]interface{}{"c": 120}, results)
+}
+
+func TestCompileTable(t *testing.T) {
+	calls := 0
+	env := map[string]interface{}{
+		"age":    30,
+		"region": "EU",
+		"risk":   func() int { calls++; return 5 },
+	}
+	table := expr.Table{
+		Inputs: []string{"age", "region", "risk()"},
+		Rules: []expr.Rule{
+			{Conditions: []string{"< 18", "-", "-"}, Output: `"minor"`},
+			{Conditions: []string{"18..65", `"US"`, "> 3"}, Output: `"us"`},
+			{Conditions: []string{"18..65", `not in ["US"]`, "> 3"}, Output: `"other"`},
+			{Conditions: []string{"", "", ""}, Output: `"any"`},
+		},
+		Default: `"none"`,
+	}
+	program, err := expr.CompileTable(table, expr.Env(env))
+	require.NoError(t, err)
+
+	tests := []struct {
+		age    int
+		region string
+		want   string
+	}{
+		{10, "EU", "minor"},
+		{30, "US", "us"},
+		{30, "EU", "other"},
+		{70, "EU", "any"},
+	}
+	for _, tt := range tests {
+		calls = 0
+		env["age"], env["region"] = tt.age, tt.region
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, out, "%v %v", tt.age, tt.region)
+		if tt.want == "other" {
+			// Input risk() and condition "> 3" are shared by rules.
+			assert.Equal(t, 1, calls)
+		}
+	}
+
+	table.Rules = table.Rules[:1]
+	table.Default = ""
+	program, err = expr.CompileTable(table, expr.Env(env))
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	_, err = expr.CompileTable(expr.Table{
+		Inputs: []string{"age"},
+		Rules:  []expr.Rule{{Conditions: []string{`> "x"`}, Output: `1`}},
+	}, expr.Env(env))
+	require.EqualError(t, err, "rule 1, condition 1: invalid operation: > (mismatched types int and string), where age is int (2:1)\n | > \"x\"\n | ^")
+
+	_, err = expr.CompileTable(expr.Table{
+		Inputs: []string{"age"},
+		Rules:  []expr.Rule{{Conditions: []string{`> )`}, Output: `1`}},
+	}, expr.Env(env))
+	require.EqualError(t, err, "rule 1, condition 1: unexpected token Bracket(\")\") (2:3)\n | > )\n | ..^")
+
+	_, err = expr.CompileTable(expr.Table{
+		Inputs: []string{"age"},
+		Rules:  []expr.Rule{{Conditions: []string{"1", "2"}, Output: `1`}},
+	})
+	require.EqualError(t, err, "rule 1 has 2 conditions, expected 1")
+}
+
+func TestPatch(t *testing.T) {
+	program, err := expr.Compile(
+		`Ticket == "$100" and "$90" != Ticket + "0"`,
+		expr.Env(mockEnv{}),
+		expr.Patch(&stringerPatcher{}),
+	)
+	require.NoError(t, err)
+
+	env := mockEnv{
+		Ticket: &ticket{Price: 100},
 	}
 	output, err := expr.Run(program, env)
 	require.NoError(t, err)
@@ -1342,6 +3385,31 @@ func TestCompile_deref(t *testing.T) {
 	}
 }
 
+func TestEval_checked(t *testing.T) {
+	env := map[string]interface{}{
+		"list": []int{1, 2},
+		"m":    map[string]interface{}{"a": 1},
+	}
+
+	// Builtins are resolved by the checker.
+	out, err := expr.Eval(`json.encode(list)`, env)
+	require.NoError(t, err)
+	assert.Equal(t, "[1,2]", out)
+
+	// Types of variables are unknown, so in is checked at runtime.
+	out, err = expr.Eval(`1 in list and "a" in m and not ("b" in m)`, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	_, err = expr.Eval(`1 in 2`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: in (mismatched types int and int)")
+
+	_, err = expr.Eval(`json.encode()`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not enough arguments to call json.encode")
+}
+
 func TestEval_deref(t *testing.T) {
 	i := 1
 	env := map[string]interface{}{
@@ -1356,6 +3424,144 @@ func TestEval_deref(t *testing.T) {
 	require.Equal(t, true, out)
 }
 
+func TestRuntimeError(t *testing.T) {
+	errNotFound := errors.New("not found")
+	env := map[string]interface{}{
+		"lookup": func(id int) (string, error) {
+			if id > 2 {
+				return "", errNotFound
+			}
+			return "ok", nil
+		},
+		"groups": [][]int{{1, 2}, {2, 3}},
+	}
+
+	_, err := expr.Eval(`map(groups, {map(#, {lookup(#)})})`, env)
+	require.Error(t, err)
+
+	runtimeError, ok := err.(*vm.RuntimeError)
+	require.True(t, ok, "error should be of type *vm.RuntimeError")
+	assert.True(t, errors.Is(err, errNotFound))
+	assert.Equal(t, "not found (1:22)\n | map(groups, {map(#, {lookup(#)})})\n | .....................^", err.Error())
+	assert.Equal(t, vm.OpCall, runtimeError.Opcode)
+	assert.Equal(t, []interface{}{3}, runtimeError.Operands)
+
+	require.Len(t, runtimeError.Backtrace, 2)
+	assert.Equal(t, 1, runtimeError.Backtrace[0].Index)
+	assert.Equal(t, 3, runtimeError.Backtrace[0].Element)
+	assert.Equal(t, 13, runtimeError.Backtrace[0].Column)
+	assert.Equal(t, 1, runtimeError.Backtrace[1].Index)
+	assert.Equal(t, []int{2, 3}, runtimeError.Backtrace[1].Element)
+	assert.Equal(t, 0, runtimeError.Backtrace[1].Column)
+
+	runtimeError.Redact()
+	assert.Equal(t, []interface{}{"int"}, runtimeError.Operands)
+	assert.Equal(t, "[]int", runtimeError.Backtrace[1].Element)
+}
+
+func TestRun_nil_values(t *testing.T) {
+	env := map[string]interface{}{
+		"x":   nil,
+		"arr": []int{1},
+	}
+	tests := []string{
+		`x.y`,
+		`x[0]`,
+		`x()`,
+		`x + 1`,
+		`-x`,
+		`!x`,
+		`len(x)`,
+		`all(x, {#})`,
+		`arr[x]`,
+		`x ? 1 : 2`,
+		`x matches "a"`,
+	}
+	for _, code := range tests {
+		program, err := expr.Compile(code, expr.Env(env))
+		require.NoError(t, err, code)
+
+		_, err = expr.Run(program, env)
+		require.Error(t, err, code)
+
+		_, err = expr.Eval(code, env)
+		require.Error(t, err, code)
+	}
+
+	_, err := (&vm.VM{}).Run(nil, nil)
+	require.Error(t, err)
+}
+
+func TestRun_field_accessors(t *testing.T) {
+	type name string
+	type Inner struct {
+		Count  int
+		Values [2]int
+	}
+	type base struct {
+		ID int
+	}
+	type Env struct {
+		base
+		Name   name
+		Title  string
+		Any    interface{}
+		Tags   map[string]int
+		Inner  Inner
+		Ptr    *Inner
+		Single struct{ P *Inner }
+	}
+
+	inner := &Inner{Count: 1000, Values: [2]int{1, 2}}
+	env := Env{
+		base:   base{ID: 7},
+		Name:   "anna",
+		Title:  "dr",
+		Any:    1.5,
+		Tags:   map[string]int{"a": 1},
+		Inner:  Inner{Count: 3},
+		Ptr:    inner,
+		Single: struct{ P *Inner }{P: inner},
+	}
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`ID`, 7},
+		{`Name`, name("anna")},
+		{`Title + "."`, "dr."},
+		{`Any`, 1.5},
+		{`Tags.a`, 1},
+		{`Inner.Count`, 3},
+		{`Ptr.Count`, 1000},
+		{`Ptr.Values`, [2]int{1, 2}},
+		{`Single.P.Count`, 1000},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(Env{}))
+		require.NoError(t, err, test.code)
+
+		for _, e := range []interface{}{env, &env} {
+			out, err := expr.Run(program, e)
+			require.NoError(t, err, test.code)
+			assert.Equal(t, test.want, out, test.code)
+		}
+	}
+
+	// Fields behind pointers are copied.
+	program, err := expr.Compile(`Ptr.Values`, expr.Env(Env{}))
+	require.NoError(t, err)
+	out, err := expr.Run(program, &env)
+	require.NoError(t, err)
+	inner.Values[0] = 10
+	assert.Equal(t, [2]int{1, 2}, out)
+
+	program, err = expr.Compile(`Ptr.Count`, expr.Env(Env{}))
+	require.NoError(t, err)
+	_, err = expr.Run(program, Env{})
+	require.Error(t, err)
+}
+
 func TestAsBool_exposed_error(t *testing.T) {
 	_, err := expr.Compile(`42`, expr.AsBool())
 	require.Error(t, err)
@@ -1369,11 +3575,51 @@ func TestEval_exposed_error(t *testing.T) {
 	_, err := expr.Eval(`1 % 0`, nil)
 	require.Error(t, err)
 
-	fileError, ok := err.(*file.Error)
-	require.True(t, ok, "error should be of type *file.Error")
-	require.Equal(t, "runtime error: integer divide by zero (1:3)\n | 1 % 0\n | ..^", fileError.Error())
-	require.Equal(t, 2, fileError.Column)
-	require.Equal(t, 1, fileError.Line)
+	runtimeError, ok := err.(*vm.RuntimeError)
+	require.True(t, ok, "error should be of type *vm.RuntimeError")
+	require.Equal(t, "runtime error: integer divide by zero (1:3)\n | 1 % 0\n | ..^", runtimeError.Error())
+	require.Equal(t, 2, runtimeError.Column)
+	require.Equal(t, 1, runtimeError.Line)
+	require.Equal(t, vm.OpModulo, runtimeError.Opcode)
+	require.Equal(t, []interface{}{1, 0}, runtimeError.Operands)
+
+	var fileError *file.Error
+	require.True(t, errors.As(err, &fileError))
+	require.Equal(t, runtimeError.Error(), fileError.Error())
+	require.Equal(t, runtimeError.Location, fileError.Location)
+}
+
+func TestRuntimeError_operands(t *testing.T) {
+	env := map[string]interface{}{
+		"x":   1,
+		"s":   "a",
+		"sum": func(a ...int) int { return 0 },
+	}
+	tests := []struct {
+		code     string
+		opcode   vm.Opcode
+		operands []interface{}
+	}{
+		{`len(x)`, vm.OpLen, []interface{}{1}},
+		{`x < s`, vm.OpLess, []interface{}{1, "a"}},
+		{`x .. s`, vm.OpRange, []interface{}{1, "a"}},
+		{`upper(x)`, vm.OpCall, []interface{}{1}},
+		{`sum(1, 2, 3, 4, 5, 6, 7, 8, s)`, vm.OpCall, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code)
+			require.NoError(t, err)
+
+			_, err = expr.Run(program, env)
+			require.Error(t, err)
+
+			runtimeError, ok := err.(*vm.RuntimeError)
+			require.True(t, ok, "error should be of type *vm.RuntimeError")
+			assert.Equal(t, tt.opcode, runtimeError.Opcode)
+			assert.Equal(t, tt.operands, runtimeError.Operands)
+		})
+	}
 }
 
 func TestIssue105(t *testing.T) {
@@ -1732,3 +3978,519 @@ func (p *patcher) Visit(node *ast.Node) {
 		})
 	}
 }
+
+func TestCompile_limits(t *testing.T) {
+	env := map[string]int{"a": 1, "b": 2, "c": 3}
+
+	program, err := expr.Compile(`[a, 1, [b, c]]`, expr.Env(env))
+	require.NoError(t, err)
+	require.Equal(t, 5, program.MaxStack)
+
+	_, err = expr.Compile(`[a, 1, [b, c]]`, expr.Env(env), expr.Limits(conf.Limits{Stack: 5}))
+	require.NoError(t, err)
+
+	_, err = expr.Compile(`[a, 1, [b, c]]`, expr.Env(env), expr.Limits(conf.Limits{Stack: 4}))
+	require.EqualError(t, err, "program needs stack of depth 5, which exceeds limit of 4")
+
+	_, err = expr.Compile(`a + b + c`, expr.Env(env), expr.Limits(conf.Limits{Bytecode: 4}))
+	require.EqualError(t, err, "program has 5 instructions, which exceeds limit of 4")
+
+	_, err = expr.Compile(`a + b + c`, expr.Env(env), expr.Limits(conf.Limits{Constants: 2}))
+	require.EqualError(t, err, "program has 3 constants, which exceeds limit of 2")
+
+	output, err := expr.Eval(`a + b + c`, env)
+	require.NoError(t, err)
+	require.Equal(t, 6, output)
+}
+
+func TestSensitive(t *testing.T) {
+	type User struct {
+		Name string
+		SSN  string
+		Age  int
+	}
+	type Env struct {
+		User  User
+		Users []User
+		Score int
+	}
+	env := Env{
+		User:  User{Name: "Alice", SSN: "123-45-6789", Age: 30},
+		Users: []User{{Name: "Bob", SSN: "987-65-4321", Age: 17}},
+		Score: 10,
+	}
+
+	tests := []struct {
+		code    string
+		want    interface{}
+		tainted bool
+	}{
+		{`User.Name`, "Alice", false},
+		{`Score * 2`, 20, false},
+		{`User.SSN`, "123-45-6789", true},
+		{`User.SSN[0:3]`, "123", true},
+		{`"ssn: " + User.SSN`, "ssn: 123-45-6789", true},
+		{`len(User.SSN) + Score`, 21, true},
+		{`User.SSN == "" ? "no" : "yes"`, "yes", true},
+		{`User.Name + " " + convert.string(Score)`, "Alice 10", false},
+		{`json.encode(User) != ""`, true, true},
+		{`map(Users, {.SSN})`, []interface{}{"987-65-4321"}, true},
+		{`reduce(Users, {#acc + .Age}, 0)`, 17, true},
+		{`let s = User.SSN; s`, "123-45-6789", true},
+		{`let s = User.SSN; Score`, 10, false},
+		{`[User.Name, Score][0]`, "Alice", false},
+		{`[User.SSN, Score][1]`, 10, true},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(Env{}), expr.Sensitive("User.SSN", "Users.SSN"))
+		require.NoError(t, err, test.code)
+
+		out, tainted, err := expr.RunTainted(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+		assert.Equal(t, test.tainted, tainted, test.code)
+	}
+
+	program, err := expr.Compile(`User.Name`, expr.Env(Env{}))
+	require.NoError(t, err)
+	assert.False(t, program.Sensitive)
+}
+
+func TestAudit(t *testing.T) {
+	type User struct {
+		Name string
+		SSN  string
+		Age  int
+	}
+	env := map[string]interface{}{
+		"user":  User{Name: "Alice", SSN: "123-45-6789", Age: 30},
+		"limit": 18,
+		"token": "secret",
+		"zero":  0,
+	}
+
+	var records []*audit.Record
+	auditor := audit.Func(func(r *audit.Record) {
+		records = append(records, r)
+	})
+	program, err := expr.Compile(`user.Age >= limit && user.SSN != "" && token != "" && len(user.Name) > 0`,
+		expr.Env(env),
+		expr.Audit("adult", auditor),
+		expr.AuditPolicy("user.SSN", audit.Redact),
+		expr.AuditPolicy("token", audit.Omit),
+		expr.AuditPolicy("user.Name", audit.Hash),
+	)
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, "adult", r.ID)
+	assert.Equal(t, true, r.Result)
+	assert.NoError(t, r.Err)
+	assert.False(t, r.Time.IsZero())
+	assert.True(t, r.Duration >= 0)
+	assert.Equal(t, map[string]interface{}{
+		"limit":     18,
+		"user.Age":  30,
+		"user.Name": "3bc51062973c458d5a6f2d8d64a023246354ad7e064b1e4e009ec8a0699a3043",
+		"user.SSN":  "string",
+	}, r.Inputs)
+
+	program, err = expr.Compile(`limit / zero`, expr.Env(env), expr.Audit("division", auditor), expr.ZeroDivisionError())
+	require.NoError(t, err)
+
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "division", records[1].ID)
+	assert.Nil(t, records[1].Result)
+	assert.Equal(t, err, records[1].Err)
+	assert.Equal(t, map[string]interface{}{"limit": 18, "zero": 0}, records[1].Inputs)
+}
+
+type timeoutEnv struct {
+	Users map[string]string
+}
+
+func (e timeoutEnv) Lookup(ctx context.Context, id string) (string, error) {
+	if name, ok := e.Users[id]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("user %v not found", id)
+}
+
+func TestTimeout(t *testing.T) {
+	env := map[string]interface{}{
+		"wait": func(ctx context.Context, d int) (int, error) {
+			select {
+			case <-time.After(time.Duration(d) * time.Millisecond):
+				return d, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		},
+		"sleep": func(ctx context.Context) int {
+			time.Sleep(50 * time.Millisecond)
+			return 1
+		},
+		"user": map[string]interface{}{},
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+		err  string
+	}{
+		{`wait(1)`, 1, ""},
+		{`fallback(wait(1), 0)`, 1, ""},
+		{`fallback(wait(1000), -1)`, -1, ""},
+		{`fallback(sleep(), -1)`, -1, ""},
+		{`wait(1000)`, nil, "wait: context deadline exceeded"},
+		{`fallback(user.Name.Size, "none")`, nil, "cannot fetch Size from <nil>"},
+		{`try(fallback(user.Name.Size, "none"), "err")`, "err", ""},
+		{`try(wait(1000), -2)`, -2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env), expr.Timeout(10*time.Millisecond))
+			require.NoError(t, err)
+
+			out, err := expr.RunContext(context.Background(), program, env)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("deadline", func(t *testing.T) {
+		program, err := expr.Compile(`wait(1000)`, expr.Env(env), expr.Timeout(time.Second), expr.Timeout(time.Millisecond, "wait"))
+		require.NoError(t, err)
+
+		_, err = expr.Run(program, env)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		program, err := expr.Compile(`fallback(wait(1), 0)`, expr.Env(env))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		out, err := expr.RunContext(ctx, program, env)
+		require.NoError(t, err)
+		assert.Equal(t, 0, out)
+	})
+
+	t.Run("method", func(t *testing.T) {
+		env := timeoutEnv{Users: map[string]string{"1": "Alice"}}
+		program, err := expr.Compile(`Lookup("1") + fallback(Lookup("2"), "?")`, expr.Env(env))
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, "Alice?", out)
+	})
+
+	t.Run("arguments", func(t *testing.T) {
+		_, err := expr.Compile(`wait()`, expr.Env(env))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not enough arguments to call wait")
+	})
+}
+
+func TestVar(t *testing.T) {
+	env := map[string]interface{}{"x": 10}
+
+	v, err := expr.NewVar(`x > 5`, expr.Env(env), expr.AsBool())
+	require.NoError(t, err)
+	assert.Equal(t, `x > 5`, v.Source())
+
+	out, err := v.Run(env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	require.NoError(t, v.Update(`x > 50`))
+	out, err = v.Run(env)
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+
+	err = v.Update(`x + 1`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected bool")
+	err = v.Update(`y > 1`)
+	require.Error(t, err)
+	assert.Equal(t, `x > 50`, v.Source())
+
+	_, err = expr.NewVar(`x +`, expr.Env(env))
+	require.Error(t, err)
+
+	sources := make(chan string)
+	var errs []error
+	done := make(chan struct{})
+	go func() {
+		v.Watch(sources, func(err error) { errs = append(errs, err) })
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := v.Run(env)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	sources <- `x > 1`
+	sources <- `x >`
+	sources <- `x < 1`
+	close(sources)
+	<-done
+	wg.Wait()
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, `x < 1`, v.Source())
+	out, err = v.Run(env)
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+}
+
+func TestCompileCache(t *testing.T) {
+	cache := expr.NewCompileCache(2, expr.AsBool())
+
+	env := map[string]interface{}{"x": 1}
+	p1, err := cache.Compile(`x > 0`, env)
+	require.NoError(t, err)
+	p2, err := cache.Compile(`x > 0`, map[string]interface{}{"x": 2})
+	require.NoError(t, err)
+	assert.True(t, p1 == p2)
+
+	p3, err := cache.Compile(`x > 0`, map[string]interface{}{"x": 2.5})
+	require.NoError(t, err)
+	assert.False(t, p1 == p3)
+
+	_, err = cache.Compile(`x + 1`, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected bool")
+
+	_, err = cache.Compile(`true`, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, expr.CompileCacheStats{Hits: 1, Misses: 4, Evictions: 1, Len: 2}, cache.Stats())
+
+	out, err := expr.Run(p3, map[string]interface{}{"x": 2.5})
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := cache.Compile(fmt.Sprintf(`x > %v`, i%3), env)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 2, cache.Stats().Len)
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Stats().Len)
+}
+
+type testMetrics struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (m *testMetrics) add(event string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+}
+
+func (m *testMetrics) Compiled(id string, _ time.Duration, err error) {
+	m.add(fmt.Sprintf("compiled %v %v", id, err != nil))
+}
+
+func (m *testMetrics) Ran(id string, _ time.Duration, err error) {
+	m.add(fmt.Sprintf("ran %v %v", id, err != nil))
+}
+
+func (m *testMetrics) LimitExceeded(id string, limit string) {
+	m.add(fmt.Sprintf("limit %v %v", id, limit))
+}
+
+func TestMetrics(t *testing.T) {
+	m := &testMetrics{}
+	env := map[string]interface{}{
+		"x": 0,
+		"wait": func(ctx context.Context) int {
+			<-ctx.Done()
+			return 0
+		},
+	}
+
+	program, err := expr.Compile(`1 / x > 0`, expr.Env(env), expr.Metrics("div", m), expr.ZeroDivisionError())
+	require.NoError(t, err)
+	_, err = expr.Run(program, map[string]interface{}{"x": 1})
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+
+	_, err = expr.Compile(`x +`, expr.Metrics("syntax", m))
+	require.Error(t, err)
+
+	_, err = expr.Compile(`x + x + x`, expr.Env(env), expr.Metrics("big", m), expr.Limits(conf.Limits{Bytecode: 2}))
+	require.Error(t, err)
+
+	program, err = expr.Compile(`len(1..2000000)`, expr.Metrics("memory", m))
+	require.NoError(t, err)
+	_, err = expr.Run(program, nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, vm.ErrMemoryBudget))
+
+	program, err = expr.Compile(`wait()`, expr.Env(env), expr.Metrics("timeout", m), expr.Timeout(time.Millisecond))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"compiled div false",
+		"ran div false",
+		"ran div true",
+		"compiled syntax true",
+		"compiled big true",
+		"limit big bytecode",
+		"compiled memory false",
+		"ran memory true",
+		"limit memory memory",
+		"compiled timeout false",
+		"ran timeout true",
+		"limit timeout timeout",
+	}, m.events)
+}
+
+type testTracer struct {
+	spans []string
+}
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+}
+
+type spanKey struct{}
+
+func (t *testTracer) StartRun(ctx context.Context, id, hash string) (context.Context, tracing.Span) {
+	return context.WithValue(ctx, spanKey{}, id), &testSpan{t, fmt.Sprintf("run %v %v", id, hash[:8])}
+}
+
+func (t *testTracer) StartCall(ctx context.Context, name string) (context.Context, tracing.Span) {
+	return ctx, &testSpan{t, fmt.Sprintf("call %v of %v", name, ctx.Value(spanKey{}))}
+}
+
+func (s *testSpan) End(result interface{}, err error, attributes map[string]interface{}) {
+	s.tracer.spans = append(s.tracer.spans, fmt.Sprintf("%v: %v %v %v", s.name, result, err, attributes))
+}
+
+func TestTrace(t *testing.T) {
+	tracer := &testTracer{}
+	env := map[string]interface{}{
+		"user": map[string]interface{}{"ID": 42, "Age": 20},
+		"score": func(ctx context.Context, id int) (float64, error) {
+			if ctx.Value(spanKey{}) != "adult" {
+				return 0, fmt.Errorf("no span")
+			}
+			return 0.5, nil
+		},
+		"fail": func(ctx context.Context) (int, error) {
+			return 0, fmt.Errorf("unavailable")
+		},
+	}
+
+	program, err := expr.Compile(`user.Age >= 18 && score(user.ID) > 0.1 && fallback(fail(), 1) > 0`,
+		expr.Env(env), expr.Trace("adult", tracer, "user.ID", "user.Name"))
+	require.NoError(t, err)
+	out, err := expr.RunContext(context.Background(), program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	program, err = expr.Compile(`fail()`, expr.Env(env), expr.Trace("fail", tracer))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"call score of adult: 0.5 <nil> map[]",
+		"call fail of adult: <nil> unavailable map[]",
+		"run adult 991ff911: true <nil> map[user.ID:42 user.Name:<nil>]",
+		"call fail of fail: <nil> unavailable map[]",
+		"run fail 86448157: <nil> unavailable (1:1)\n | fail()\n | ^ map[]",
+	}, tracer.spans)
+}
+
+func TestLogger(t *testing.T) {
+	var entries []*logging.Entry
+	logger := logging.Func(func(e *logging.Entry) {
+		entries = append(entries, e)
+	})
+	env := map[string]interface{}{"score": 0.9}
+
+	program, err := expr.Compile(`score > 0.5 && log.print("warn", "high score", "score", score)`,
+		expr.Env(env), expr.Logger("risk", logger), expr.LogRate(0.001, 2))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, true, out)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, "risk", entries[0].ID)
+	assert.Equal(t, "warn", entries[0].Level)
+	assert.Equal(t, "high score", entries[0].Message)
+	assert.Equal(t, []interface{}{"score", 0.9}, entries[0].Values)
+
+	// Every program has its own limit.
+	program, err = expr.Compile(`log.print("info", "constant")`, expr.Logger("other", logger), expr.LogRate(0, 0))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = expr.Run(program, nil)
+		require.NoError(t, err)
+	}
+	require.Len(t, entries, 5)
+	assert.Equal(t, "other", entries[4].ID)
+	assert.Empty(t, entries[4].Values)
+
+	// Entries are discarded without a logger.
+	out, err := expr.Eval(`log.print("debug", "discarded", "x", 1)`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	errs := []struct {
+		code string
+		err  string
+	}{
+		{`log.print("fatal", "message")`, `invalid level of log "fatal"`},
+		{`log.print("info")`, `invalid number of arguments for log.print`},
+		{`log.print("info", "message", "key")`, `invalid number of arguments for log.print`},
+		{`log.print("info", "message", 1, 2)`, `invalid key of value for log.print (type int)`},
+		{`log.print(1, "message")`, `invalid argument for log.print (type int)`},
+	}
+	for _, tt := range errs {
+		_, err := expr.Compile(tt.code, expr.Logger("err", logger))
+		require.Error(t, err, tt.code)
+		assert.Contains(t, err.Error(), tt.err, tt.code)
+	}
+}
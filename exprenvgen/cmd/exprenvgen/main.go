@@ -0,0 +1,119 @@
+// Command exprenvgen generates accessors of fields and methods of struct
+// environments of the package in the current directory.
+//
+// Usage:
+//
+//	exprenvgen -type Env[,Other] [-output file]
+//
+// Types must be exported, as they are loaded by a temporary program, which
+// imports the package. The default output file is env_expr.go.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("exprenvgen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	types := flags.String("type", "", "comma-separated names of struct types")
+	output := flags.String("output", "env_expr.go", "output file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *types == "" {
+		fmt.Fprintln(stderr, "exprenvgen: -type is required")
+		return 2
+	}
+	if err := generate(strings.Split(*types, ","), *output); err != nil {
+		fmt.Fprintf(stderr, "exprenvgen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// generate runs a temporary program in a directory of the package, which
+// imports the package and writes the output of exprenvgen.Generate.
+func generate(types []string, output string) error {
+	list, err := exec.Command("go", "list", "-f", "{{.ImportPath}} {{.Name}}", ".").Output()
+	if err != nil {
+		return fmt.Errorf("go list: %v", err)
+	}
+	fields := strings.Fields(string(list))
+	if len(fields) != 2 {
+		return fmt.Errorf("unexpected output of go list: %q", list)
+	}
+	pkgPath, pkgName := fields[0], fields[1]
+
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(".", "exprenvgen")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	values := make([]string, len(types))
+	for i, t := range types {
+		values[i] = fmt.Sprintf("(*pkg.%v)(nil)", strings.TrimSpace(t))
+	}
+	var program bytes.Buffer
+	fmt.Fprintf(&program, `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/antonmedv/expr/exprenvgen"
+	pkg %q
+)
+
+func main() {
+	out, err := exprenvgen.Generate(%q, %q, %v)
+	if err == nil {
+		err = ioutil.WriteFile(%q, out, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`, pkgPath, pkgPath, pkgName, strings.Join(values, ", "), output)
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), program.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	// Previous output is removed, as it may not compile with changed types,
+	// and restored on failure.
+	previous, readErr := ioutil.ReadFile(output)
+	if readErr == nil {
+		if err := os.Remove(output); err != nil {
+			return err
+		}
+	}
+	cmd := exec.Command("go", "run", "./"+filepath.Base(dir))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if readErr == nil {
+			_ = ioutil.WriteFile(output, previous, 0644)
+		}
+		return fmt.Errorf("go run: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,412 @@
+// Package exprenvgen generates accessors of fields and methods of struct
+// environments, which programs read and call without reflection.
+//
+// Accessors are generated by the command exprenvgen with go generate, in the
+// package of environment types:
+//
+//	//go:generate go run github.com/antonmedv/expr/exprenvgen/cmd/exprenvgen -type Env
+//
+// Generated files register accessors in init functions, and programs
+// compiled with environments of the types use them. Values of other types at
+// runtime, and fields and methods of types, which can not be named in the
+// package, are read and called with reflection.
+package exprenvgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MaxDepth is the maximum number of names of paths of nested fields, like
+// Order.Customer.Address, which have accessors.
+const MaxDepth = 3
+
+var (
+	intType   = reflect.TypeOf(0)
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Generate returns the source of a file of the package with the import path
+// pkgPath and the name pkgName, which registers accessors of the types.
+// Types are values or pointers of named struct types, like Env{} or
+// (*Env)(nil).
+func Generate(pkgPath, pkgName string, types ...interface{}) ([]byte, error) {
+	g := &generator{pkgPath: pkgPath, imports: make(map[string]string)}
+	var body bytes.Buffer
+	for _, v := range types {
+		t := reflect.TypeOf(v)
+		if t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct || t.Name() == "" {
+			return nil, fmt.Errorf("%v is not a named struct type", t)
+		}
+		name, ok := g.typeString(t)
+		if !ok {
+			return nil, fmt.Errorf("%v can not be named in package %v", t, pkgPath)
+		}
+		g.register(&body, t, name)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by exprenvgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %v\n\n", pkgName)
+	fmt.Fprintf(&out, "import (\n\t\"reflect\"\n\n\t\"github.com/antonmedv/expr/vm/runtime\"\n")
+	paths := make([]string, 0, len(g.imports))
+	for p := range g.imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(&out, "\t%v %q\n", g.imports[p], p)
+	}
+	fmt.Fprintf(&out, ")\n\n")
+	fmt.Fprintf(&out, "func init() {\n%v}\n", body.String())
+	return format.Source(out.Bytes())
+}
+
+type generator struct {
+	pkgPath string
+	imports map[string]string // aliases of import paths
+}
+
+// fieldPath is a path of nested fields, like Address.City.
+type fieldPath struct {
+	path      string
+	selectors string   // selectors of fields, like .Address.City
+	pointers  []string // selectors of pointers on the path, checked for nil
+	typ       reflect.Type
+}
+
+func (g *generator) register(w *bytes.Buffer, t reflect.Type, name string) {
+	var fields []fieldPath
+	g.fields(t, "", "", nil, 1, map[reflect.Type]bool{t: true}, &fields)
+
+	fmt.Fprintf(w, "runtime.Register(reflect.TypeOf((*%v)(nil)).Elem(), &runtime.Accessors{\n", name)
+	fmt.Fprintf(w, "Fields: map[string]func(interface{}) (interface{}, bool){\n")
+	for _, f := range fields {
+		fmt.Fprintf(w, "%q: func(from interface{}) (interface{}, bool) {\n", f.path)
+		fmt.Fprintf(w, "switch v := from.(type) {\n")
+		for _, ptr := range []bool{false, true} {
+			if ptr {
+				fmt.Fprintf(w, "case *%v:\n", name)
+			} else {
+				fmt.Fprintf(w, "case %v:\n", name)
+			}
+			var checks []string
+			if ptr {
+				checks = append(checks, "v == nil")
+			}
+			for _, p := range f.pointers {
+				checks = append(checks, "v"+p+" == nil")
+			}
+			if len(checks) > 0 {
+				fmt.Fprintf(w, "if %v {\nreturn nil, false\n}\n", strings.Join(checks, " || "))
+			}
+			fmt.Fprintf(w, "return %v, true\n", box("v"+f.selectors, f.typ))
+		}
+		fmt.Fprintf(w, "}\nreturn nil, false\n},\n")
+	}
+	fmt.Fprintf(w, "},\n")
+
+	fmt.Fprintf(w, "Methods: map[string]func(interface{}, []interface{}) (interface{}, bool){\n")
+	ptrType := reflect.PtrTo(t)
+	for i := 0; i < ptrType.NumMethod(); i++ {
+		m := ptrType.Method(i)
+		imports := make(map[string]string, len(g.imports))
+		for p, alias := range g.imports {
+			imports[p] = alias
+		}
+		call, ok := g.call(m)
+		if !ok {
+			// Imports of types of skipped methods are not used.
+			g.imports = imports
+			continue
+		}
+		fmt.Fprintf(w, "%q: func(receiver interface{}, args []interface{}) (interface{}, bool) {\n", m.Name)
+		fmt.Fprintf(w, "switch r := receiver.(type) {\n")
+		if _, ok := t.MethodByName(m.Name); ok {
+			fmt.Fprintf(w, "case %v:\n%v", name, call)
+		}
+		fmt.Fprintf(w, "case *%v:\n%v", name, call)
+		fmt.Fprintf(w, "}\nreturn nil, false\n},\n")
+	}
+	fmt.Fprintf(w, "},\n")
+	fmt.Fprintf(w, "})\n")
+}
+
+// fields appends paths of fields of the struct type t, and of nested
+// structs, to out. Types of structs on the path are not visited again.
+func (g *generator) fields(t reflect.Type, prefix, selectors string, pointers []string, depth int, seen map[reflect.Type]bool, out *[]fieldPath) {
+	for _, name := range fieldNames(t) {
+		f, _ := t.FieldByName(name)
+		p := fieldPath{
+			path:      prefix + name,
+			selectors: selectors + "." + name,
+			pointers:  pointers,
+			typ:       f.Type,
+		}
+		*out = append(*out, p)
+
+		nested, nestedPointers := f.Type, pointers
+		if nested.Kind() == reflect.Ptr {
+			nested = nested.Elem()
+			nestedPointers = append(append([]string{}, pointers...), p.selectors)
+		}
+		if nested.Kind() == reflect.Struct && depth < MaxDepth && !seen[nested] {
+			seen[nested] = true
+			g.fields(nested, p.path+".", p.selectors, nestedPointers, depth+1, seen, out)
+			delete(seen, nested)
+		}
+	}
+}
+
+// fieldNames returns names of exported fields of the struct type t,
+// including fields promoted from embedded structs, but not from embedded
+// pointers, which may be nil.
+func fieldNames(t reflect.Type) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var visit func(t reflect.Type)
+	visit = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath == "" && !seen[f.Name] {
+				seen[f.Name] = true
+				names = append(names, f.Name)
+			}
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				visit(f.Type)
+			}
+		}
+	}
+	visit(t)
+
+	promoted := names[:0]
+	for _, name := range names {
+		f, ok := t.FieldByName(name)
+		if ok && !throughPointer(t, f.Index) {
+			promoted = append(promoted, name)
+		}
+	}
+	return promoted
+}
+
+// throughPointer reports whether the path of indexes passes embedded
+// pointers.
+func throughPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
+// call returns statements of the call of the method with arguments, or
+// false, if types of arguments can not be named in the package.
+func (g *generator) call(m reflect.Method) (string, bool) {
+	fn := m.Type
+	var w bytes.Buffer
+	args := make([]string, 0, fn.NumIn()-1)
+	for i := 1; i < fn.NumIn(); i++ {
+		a := fmt.Sprintf("a%v", i-1)
+		in := fn.In(i)
+		if fn.IsVariadic() && i == fn.NumIn()-1 {
+			elem, ok := g.typeString(in.Elem())
+			if !ok {
+				return "", false
+			}
+			fmt.Fprintf(&w, "%v := make([]%v, len(args)-%v)\n", a, elem, i-1)
+			fmt.Fprintf(&w, "for i := range %v {\n", a)
+			g.assert(&w, fmt.Sprintf("%v[i]", a), fmt.Sprintf("args[%v+i]", i-1), in.Elem(), elem)
+			fmt.Fprintf(&w, "}\n")
+			args = append(args, a+"...")
+			continue
+		}
+		typ, ok := g.typeString(in)
+		if !ok {
+			return "", false
+		}
+		if canBeNil(in) {
+			fmt.Fprintf(&w, "var %v %v\n", a, typ)
+			g.assert(&w, a, fmt.Sprintf("args[%v]", i-1), in, typ)
+		} else {
+			fmt.Fprintf(&w, "%v := args[%v].(%v)\n", a, i-1, typ)
+		}
+		args = append(args, a)
+	}
+	call := fmt.Sprintf("r.%v(%v)", m.Name, strings.Join(args, ", "))
+
+	n := fn.NumOut()
+	results := make([]string, n)
+	for i := range results {
+		results[i] = fmt.Sprintf("o%v", i)
+	}
+	if n > 1 && fn.Out(n-1) == errorType {
+		results[n-1] = "err"
+	}
+	switch {
+	case n == 0:
+		fmt.Fprintf(&w, "%v\nreturn runtime.Tuple{}, true\n", call)
+		return w.String(), true
+	case results[n-1] == "err":
+		fmt.Fprintf(&w, "%v := %v\n", strings.Join(results, ", "), call)
+		fmt.Fprintf(&w, "if err != nil {\npanic(err)\n}\n")
+		n--
+	default:
+		fmt.Fprintf(&w, "%v := %v\n", strings.Join(results, ", "), call)
+	}
+	if n == 1 {
+		fmt.Fprintf(&w, "return %v, true\n", box("o0", fn.Out(0)))
+	} else {
+		boxed := make([]string, n)
+		for i := range boxed {
+			boxed[i] = box(results[i], fn.Out(i))
+		}
+		fmt.Fprintf(&w, "return runtime.Tuple{%v}, true\n", strings.Join(boxed, ", "))
+	}
+	return w.String(), true
+}
+
+// assert writes the assignment of the argument to the variable of the type.
+// Nil arguments are zero values of types, which can be nil.
+func (g *generator) assert(w *bytes.Buffer, variable, arg string, t reflect.Type, typ string) {
+	switch {
+	case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+		fmt.Fprintf(w, "%v = %v\n", variable, arg)
+	case canBeNil(t):
+		fmt.Fprintf(w, "if %v != nil {\n%v = %v.(%v)\n}\n", arg, variable, arg, typ)
+	default:
+		fmt.Fprintf(w, "%v = %v.(%v)\n", variable, arg, typ)
+	}
+}
+
+func canBeNil(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// box returns the expression of the value converted to interface{}. Small
+// integers are boxed without allocation.
+func box(value string, t reflect.Type) string {
+	if t == intType {
+		return fmt.Sprintf("runtime.Int(%v)", value)
+	}
+	return value
+}
+
+// typeString returns the name of the type in the package, or false, if the
+// type can not be named, like unexported types of other packages.
+func (g *generator) typeString(t reflect.Type) (string, bool) {
+	if t.Name() != "" {
+		if strings.Contains(t.Name(), "[") {
+			return "", false
+		}
+		if t.PkgPath() == "" {
+			return t.Name(), true
+		}
+		if t.PkgPath() == g.pkgPath {
+			return t.Name(), true
+		}
+		if !isExported(t.Name()) {
+			return "", false
+		}
+		return g.importAlias(t.PkgPath()) + "." + t.Name(), true
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, ok := g.typeString(t.Elem())
+		return "*" + elem, ok
+	case reflect.Slice:
+		elem, ok := g.typeString(t.Elem())
+		return "[]" + elem, ok
+	case reflect.Array:
+		elem, ok := g.typeString(t.Elem())
+		return fmt.Sprintf("[%v]%v", t.Len(), elem), ok
+	case reflect.Map:
+		key, ok := g.typeString(t.Key())
+		if !ok {
+			return "", false
+		}
+		elem, ok := g.typeString(t.Elem())
+		return "map[" + key + "]" + elem, ok
+	case reflect.Interface:
+		return "interface{}", t.NumMethod() == 0
+	case reflect.Struct:
+		return "struct{}", t.NumField() == 0
+	case reflect.Func:
+		params := make([]string, t.NumIn())
+		for i := range params {
+			in := t.In(i)
+			prefix := ""
+			if t.IsVariadic() && i == len(params)-1 {
+				in, prefix = in.Elem(), "..."
+			}
+			s, ok := g.typeString(in)
+			if !ok {
+				return "", false
+			}
+			params[i] = prefix + s
+		}
+		results := make([]string, t.NumOut())
+		for i := range results {
+			s, ok := g.typeString(t.Out(i))
+			if !ok {
+				return "", false
+			}
+			results[i] = s
+		}
+		s := "func(" + strings.Join(params, ", ") + ")"
+		switch len(results) {
+		case 0:
+		case 1:
+			s += " " + results[0]
+		default:
+			s += " (" + strings.Join(results, ", ") + ")"
+		}
+		return s, true
+	}
+	return "", false
+}
+
+// importAlias returns the alias of the imported package, unique in the
+// generated file.
+func (g *generator) importAlias(pkgPath string) string {
+	if alias, ok := g.imports[pkgPath]; ok {
+		return alias
+	}
+	base := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, path.Base(pkgPath))
+	used := map[string]bool{"reflect": true, "runtime": true}
+	for _, alias := range g.imports {
+		used[alias] = true
+	}
+	alias := base
+	for i := 2; used[alias]; i++ {
+		alias = fmt.Sprintf("%v%v", base, i)
+	}
+	g.imports[pkgPath] = alias
+	return alias
+}
+
+func isExported(name string) bool {
+	for _, r := range name {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package exprenvgen_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprenvgen"
+	"github.com/antonmedv/expr/exprenvgen/internal/example"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	out, err := exprenvgen.Generate(
+		"github.com/antonmedv/expr/exprenvgen/internal/example", "example",
+		(*example.Env)(nil), (*example.User)(nil),
+	)
+	require.NoError(t, err)
+
+	generated, err := ioutil.ReadFile("internal/example/env_expr.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(generated), string(out), "run go generate ./exprenvgen/...")
+}
+
+func TestGenerate_errors(t *testing.T) {
+	_, err := exprenvgen.Generate("example", "example", 1)
+	assert.EqualError(t, err, "int is not a named struct type")
+
+	_, err = exprenvgen.Generate("example", "example", struct{ A int }{})
+	assert.EqualError(t, err, "struct { A int } is not a named struct type")
+}
+
+func TestAccessors(t *testing.T) {
+	created := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	env := example.Env{
+		Base:    example.Base{ID: 7},
+		Name:    "anna",
+		Count:   1000,
+		Created: created,
+		Tags:    map[string]int{"a": 1},
+		Any:     1.5,
+		User:    example.User{Name: "bob", Address: &example.Address{City: "Berlin"}},
+	}
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`ID + Base.ID`, 14},
+		{`Name`, "anna"},
+		{`Count`, 1000},
+		{`Tags.a`, 1},
+		{`Any`, 1.5},
+		{`User.Address.City`, "Berlin"},
+		{`User.Upper()`, "BOB"},
+		{`Join("-", "a", "b", Name)`, "a-b-anna"},
+		{`Lookup(7).Name`, "bob"},
+		{`let (q, r) = DivMod(7, 2); q * 10 + r`, 31},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(example.Env{}))
+		require.NoError(t, err, test.code)
+
+		for _, e := range []interface{}{env, &env} {
+			out, err := expr.Run(program, e)
+			require.NoError(t, err, test.code)
+			assert.Equal(t, test.want, out, test.code)
+		}
+	}
+
+	program, err := expr.Compile(`Join(",", "a")`, expr.Env(example.Env{}))
+	require.NoError(t, err)
+	assert.Contains(t, program.Disassemble(), "OpCallMethod")
+
+	// Errors of methods and nil pointers are runtime errors.
+	program, err = expr.Compile(`Lookup(1)`, expr.Env(example.Env{}))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "user not found")
+
+	program, err = expr.Compile(`Manager.Name`, expr.Env(example.Env{}))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+
+	// Methods with pointer receivers are called on pointers.
+	program, err = expr.Compile(`Since(Created).Hours()`, expr.Env(&example.Env{}))
+	require.NoError(t, err)
+	out, err := expr.Run(program, &env)
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), out)
+}
+
+func TestAccessors_fallback(t *testing.T) {
+	// Environments of other types than types of compilation, like lazy
+	// environments, are read with reflection.
+	program, err := expr.Compile(`Join("-", Name, User.Name)`, expr.Env(example.Env{}))
+	require.NoError(t, err)
+
+	lazy := fetcher{"Name": "anna", "User": example.User{Name: "bob"}, "Join": example.Env{}.Join}
+	out, err := expr.Run(program, lazy)
+	require.NoError(t, err)
+	assert.Equal(t, "anna-bob", out)
+}
+
+type fetcher map[string]interface{}
+
+func (f fetcher) Fetch(name string) (interface{}, error) {
+	return f[name], nil
+}
@@ -0,0 +1,63 @@
+// Package example holds environments with accessors generated by
+// exprenvgen for tests.
+package example
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+//go:generate go run ../../cmd/exprenvgen -type Env,User -output env_expr.go
+
+type Env struct {
+	Base
+	Name    string
+	Count   int
+	Created time.Time
+	Tags    map[string]int
+	Any     interface{}
+	User    User
+	Manager *User
+	secret  string
+}
+
+type Base struct {
+	ID int
+}
+
+type User struct {
+	Name    string
+	Address *Address
+}
+
+type Address struct {
+	City string
+}
+
+func (e Env) Greet(name string) string {
+	return "hello, " + name
+}
+
+func (e Env) Join(sep string, parts ...string) string {
+	return strings.Join(parts, sep)
+}
+
+func (e Env) Lookup(id int) (*User, error) {
+	if id != e.ID {
+		return nil, errors.New("user not found")
+	}
+	return &e.User, nil
+}
+
+func (e Env) DivMod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func (e *Env) Since(t time.Time) time.Duration {
+	return e.Created.Sub(t)
+}
+
+func (u User) Upper() string {
+	return strings.ToUpper(u.Name)
+}
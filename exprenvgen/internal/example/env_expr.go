@@ -0,0 +1,356 @@
+// Code generated by exprenvgen. DO NOT EDIT.
+
+package example
+
+import (
+	"reflect"
+
+	"github.com/antonmedv/expr/vm/runtime"
+	time "time"
+)
+
+func init() {
+	runtime.Register(reflect.TypeOf((*Env)(nil)).Elem(), &runtime.Accessors{
+		Fields: map[string]func(interface{}) (interface{}, bool){
+			"Base": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.Base, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.Base, true
+				}
+				return nil, false
+			},
+			"Base.ID": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return runtime.Int(v.Base.ID), true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return runtime.Int(v.Base.ID), true
+				}
+				return nil, false
+			},
+			"ID": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return runtime.Int(v.ID), true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return runtime.Int(v.ID), true
+				}
+				return nil, false
+			},
+			"Name": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.Name, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.Name, true
+				}
+				return nil, false
+			},
+			"Count": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return runtime.Int(v.Count), true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return runtime.Int(v.Count), true
+				}
+				return nil, false
+			},
+			"Created": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.Created, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.Created, true
+				}
+				return nil, false
+			},
+			"Tags": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.Tags, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.Tags, true
+				}
+				return nil, false
+			},
+			"Any": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.Any, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.Any, true
+				}
+				return nil, false
+			},
+			"User": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.User, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.User, true
+				}
+				return nil, false
+			},
+			"User.Name": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.User.Name, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.User.Name, true
+				}
+				return nil, false
+			},
+			"User.Address": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.User.Address, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.User.Address, true
+				}
+				return nil, false
+			},
+			"User.Address.City": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					if v.User.Address == nil {
+						return nil, false
+					}
+					return v.User.Address.City, true
+				case *Env:
+					if v == nil || v.User.Address == nil {
+						return nil, false
+					}
+					return v.User.Address.City, true
+				}
+				return nil, false
+			},
+			"Manager": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					return v.Manager, true
+				case *Env:
+					if v == nil {
+						return nil, false
+					}
+					return v.Manager, true
+				}
+				return nil, false
+			},
+			"Manager.Name": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					if v.Manager == nil {
+						return nil, false
+					}
+					return v.Manager.Name, true
+				case *Env:
+					if v == nil || v.Manager == nil {
+						return nil, false
+					}
+					return v.Manager.Name, true
+				}
+				return nil, false
+			},
+			"Manager.Address": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					if v.Manager == nil {
+						return nil, false
+					}
+					return v.Manager.Address, true
+				case *Env:
+					if v == nil || v.Manager == nil {
+						return nil, false
+					}
+					return v.Manager.Address, true
+				}
+				return nil, false
+			},
+			"Manager.Address.City": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case Env:
+					if v.Manager == nil || v.Manager.Address == nil {
+						return nil, false
+					}
+					return v.Manager.Address.City, true
+				case *Env:
+					if v == nil || v.Manager == nil || v.Manager.Address == nil {
+						return nil, false
+					}
+					return v.Manager.Address.City, true
+				}
+				return nil, false
+			},
+		},
+		Methods: map[string]func(interface{}, []interface{}) (interface{}, bool){
+			"DivMod": func(receiver interface{}, args []interface{}) (interface{}, bool) {
+				switch r := receiver.(type) {
+				case Env:
+					a0 := args[0].(int)
+					a1 := args[1].(int)
+					o0, o1 := r.DivMod(a0, a1)
+					return runtime.Tuple{runtime.Int(o0), runtime.Int(o1)}, true
+				case *Env:
+					a0 := args[0].(int)
+					a1 := args[1].(int)
+					o0, o1 := r.DivMod(a0, a1)
+					return runtime.Tuple{runtime.Int(o0), runtime.Int(o1)}, true
+				}
+				return nil, false
+			},
+			"Greet": func(receiver interface{}, args []interface{}) (interface{}, bool) {
+				switch r := receiver.(type) {
+				case Env:
+					a0 := args[0].(string)
+					o0 := r.Greet(a0)
+					return o0, true
+				case *Env:
+					a0 := args[0].(string)
+					o0 := r.Greet(a0)
+					return o0, true
+				}
+				return nil, false
+			},
+			"Join": func(receiver interface{}, args []interface{}) (interface{}, bool) {
+				switch r := receiver.(type) {
+				case Env:
+					a0 := args[0].(string)
+					a1 := make([]string, len(args)-1)
+					for i := range a1 {
+						a1[i] = args[1+i].(string)
+					}
+					o0 := r.Join(a0, a1...)
+					return o0, true
+				case *Env:
+					a0 := args[0].(string)
+					a1 := make([]string, len(args)-1)
+					for i := range a1 {
+						a1[i] = args[1+i].(string)
+					}
+					o0 := r.Join(a0, a1...)
+					return o0, true
+				}
+				return nil, false
+			},
+			"Lookup": func(receiver interface{}, args []interface{}) (interface{}, bool) {
+				switch r := receiver.(type) {
+				case Env:
+					a0 := args[0].(int)
+					o0, err := r.Lookup(a0)
+					if err != nil {
+						panic(err)
+					}
+					return o0, true
+				case *Env:
+					a0 := args[0].(int)
+					o0, err := r.Lookup(a0)
+					if err != nil {
+						panic(err)
+					}
+					return o0, true
+				}
+				return nil, false
+			},
+			"Since": func(receiver interface{}, args []interface{}) (interface{}, bool) {
+				switch r := receiver.(type) {
+				case *Env:
+					a0 := args[0].(time.Time)
+					o0 := r.Since(a0)
+					return o0, true
+				}
+				return nil, false
+			},
+		},
+	})
+	runtime.Register(reflect.TypeOf((*User)(nil)).Elem(), &runtime.Accessors{
+		Fields: map[string]func(interface{}) (interface{}, bool){
+			"Name": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case User:
+					return v.Name, true
+				case *User:
+					if v == nil {
+						return nil, false
+					}
+					return v.Name, true
+				}
+				return nil, false
+			},
+			"Address": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case User:
+					return v.Address, true
+				case *User:
+					if v == nil {
+						return nil, false
+					}
+					return v.Address, true
+				}
+				return nil, false
+			},
+			"Address.City": func(from interface{}) (interface{}, bool) {
+				switch v := from.(type) {
+				case User:
+					if v.Address == nil {
+						return nil, false
+					}
+					return v.Address.City, true
+				case *User:
+					if v == nil || v.Address == nil {
+						return nil, false
+					}
+					return v.Address.City, true
+				}
+				return nil, false
+			},
+		},
+		Methods: map[string]func(interface{}, []interface{}) (interface{}, bool){
+			"Upper": func(receiver interface{}, args []interface{}) (interface{}, bool) {
+				switch r := receiver.(type) {
+				case User:
+					o0 := r.Upper()
+					return o0, true
+				case *User:
+					o0 := r.Upper()
+					return o0, true
+				}
+				return nil, false
+			},
+		},
+	})
+}
@@ -0,0 +1,168 @@
+// Command exprlint checks expressions with rules of package exprlint.
+//
+// Usage:
+//
+//	exprlint [flags] [file ...]
+//
+// Every file holds one expression. If no files are given, the expression is
+// read from standard input. Exit code is 1 if any diagnostic has error
+// severity, and 2 on invalid usage.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprlint"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("exprlint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	envFile := flags.String("env", "", "JSON file with sample environment, used to check types")
+	disable := flags.String("disable", "", "comma-separated IDs of disabled rules")
+	severity := flags.String("severity", "", "comma-separated overrides of severities, like redundant-ternary=error")
+	asJSON := flags.Bool("json", false, "print diagnostics as JSON")
+	list := flags.Bool("rules", false, "list rules and exit")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	rules, err := configure(exprlint.Rules(), *disable, *severity)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *list {
+		for _, r := range rules {
+			fmt.Fprintf(stdout, "%-20v %-8v %v\n", r.ID, r.Severity, r.Description)
+		}
+		return 0
+	}
+
+	var ops []expr.Option
+	if *envFile != "" {
+		b, err := ioutil.ReadFile(*envFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		var env map[string]interface{}
+		if err := json.Unmarshal(b, &env); err != nil {
+			fmt.Fprintf(stderr, "%v: %v\n", *envFile, err)
+			return 2
+		}
+		ops = append(ops, expr.Env(env))
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	failed := false
+	var found []diagnostic
+	for _, name := range files {
+		code, err := read(name, stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		for _, d := range exprlint.Lint(code, rules, ops...) {
+			failed = failed || d.Severity == exprlint.Error
+			found = append(found, diagnostic{
+				File:     name,
+				Line:     d.Location.Line,
+				Column:   d.Location.Column + 1,
+				Severity: d.Severity.String(),
+				Rule:     d.Rule,
+				Message:  d.Message,
+			})
+		}
+	}
+
+	if *asJSON {
+		if found == nil {
+			found = []diagnostic{}
+		}
+		b, _ := json.MarshalIndent(found, "", "  ")
+		fmt.Fprintln(stdout, string(b))
+	} else {
+		for _, d := range found {
+			fmt.Fprintf(stdout, "%v:%v:%v: %v: %v (%v)\n", d.File, d.Line, d.Column, d.Severity, d.Message, d.Rule)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+type diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// configure disables rules and overrides their severities.
+func configure(rules []*exprlint.Rule, disable, severity string) ([]*exprlint.Rule, error) {
+	for _, pair := range split(severity) {
+		i := strings.IndexByte(pair, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid severity override %q", pair)
+		}
+		r, ok := exprlint.Find(rules, pair[:i])
+		if !ok {
+			return nil, fmt.Errorf("unknown rule %v", pair[:i])
+		}
+		s, ok := exprlint.ParseSeverity(pair[i+1:])
+		if !ok {
+			return nil, fmt.Errorf("unknown severity %v", pair[i+1:])
+		}
+		r.Severity = s
+	}
+	for _, id := range split(disable) {
+		r, ok := exprlint.Find(rules, id)
+		if !ok {
+			return nil, fmt.Errorf("unknown rule %v", id)
+		}
+		for i := range rules {
+			if rules[i] == r {
+				rules = append(rules[:i], rules[i+1:]...)
+				break
+			}
+		}
+	}
+	return rules, nil
+}
+
+func split(list string) []string {
+	var out []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func read(name string, stdin io.Reader) (string, error) {
+	if name == "-" {
+		b, err := ioutil.ReadAll(stdin)
+		return string(b), err
+	}
+	b, err := ioutil.ReadFile(name)
+	return string(b), err
+}
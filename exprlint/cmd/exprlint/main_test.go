@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(nil, strings.NewReader(`a ? true : false`), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	require.Equal(t, "-:1:3: info: ternary can be replaced with its condition (redundant-ternary)\n", stdout.String())
+}
+
+func TestRun_files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exprlint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	env := filepath.Join(dir, "env.json")
+	rule := filepath.Join(dir, "rule.expr")
+	require.NoError(t, ioutil.WriteFile(env, []byte(`{"name": "bob", "tags": ["a"]}`), 0644))
+	require.NoError(t, ioutil.WriteFile(rule, []byte(`name == name || name + 1`), 0644))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-env", env, "-json", rule}, nil, &stdout, &stderr)
+	require.Equal(t, 1, code, stderr.String())
+	require.Contains(t, stdout.String(), `"rule": "type"`)
+
+	require.NoError(t, ioutil.WriteFile(rule, []byte(`name == name && all(tags, {# != "" || true})`), 0644))
+	stdout.Reset()
+	code = run([]string{"-env", env, "-disable", "constant-condition", "-severity", "constant-comparison=error", rule}, nil, &stdout, &stderr)
+	require.Equal(t, 1, code, stderr.String())
+	require.Equal(t, rule+":1:6: error: comparison is always true (constant-comparison)\n", stdout.String())
+}
+
+func TestRun_usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 2, run([]string{"-disable", "unknown"}, nil, &stdout, &stderr))
+	require.Equal(t, "unknown rule unknown\n", stderr.String())
+
+	stderr.Reset()
+	require.Equal(t, 2, run([]string{"-severity", "constant-comparison=fatal"}, nil, &stdout, &stderr))
+	require.Equal(t, "unknown severity fatal\n", stderr.String())
+
+	require.Equal(t, 0, run([]string{"-rules"}, nil, &stdout, &stderr))
+	require.Contains(t, stdout.String(), "invariant-call")
+}
@@ -0,0 +1,153 @@
+// Package exprlint checks expressions with rules for suspicious or
+// inefficient code, like constant conditions, redundant ternaries or calls
+// inside closures which do not depend on elements.
+package exprlint
+
+import (
+	"sort"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Severity of a diagnostic.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	}
+	return "error"
+}
+
+// ParseSeverity returns severity by its name.
+func ParseSeverity(name string) (Severity, bool) {
+	for _, s := range []Severity{Info, Warning, Error} {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return Error, false
+}
+
+// Rule checks nodes of a tree. Check is called for every node of the tree,
+// children first, and reports diagnostics with the pass. Rules of warnings
+// of the checker, see checker.Warnings, report warnings of the template
+// instead.
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+	Check       func(pass *Pass, node ast.Node)
+	// Warning is the template of messages of warnings of the checker,
+	// like "comparison is always %v", which are reported by the rule.
+	Warning string
+}
+
+// Diagnostic is a problem found by a rule. Syntax and type errors are
+// reported as diagnostics of "syntax" and "type" rules.
+type Diagnostic struct {
+	Rule     string
+	Severity Severity
+	*file.Error
+}
+
+// Pass holds state of checking tree with a rule.
+type Pass struct {
+	Tree        *parser.Tree
+	rule        *Rule
+	diagnostics []Diagnostic
+}
+
+// Report reports diagnostic of the rule at location of the node.
+func (p *Pass) Report(node ast.Node, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Rule:     p.rule.ID,
+		Severity: p.rule.Severity,
+		Error:    file.Errorf(node.Location(), format, args...),
+	})
+}
+
+func (p *Pass) Visit(node *ast.Node) {
+	p.rule.Check(p, *node)
+}
+
+// Lint parses and checks code with options of compilation, like expr.Env,
+// and returns diagnostics of rules sorted by location. Rules are not run on
+// code with syntax or type errors.
+func Lint(code string, rules []*Rule, ops ...expr.Option) []Diagnostic {
+	config := conf.CreateNew()
+	for _, op := range ops {
+		op(config)
+	}
+
+	tree, err := parser.ParseWithOptions(code, config.ParserOptions())
+	if err != nil {
+		return []Diagnostic{failure("syntax", err)}
+	}
+	_, err = checker.Check(tree, config)
+	if err != nil {
+		return []Diagnostic{failure("type", err)}
+	}
+
+	warnings := checker.Warnings(tree, config)
+
+	var diagnostics []Diagnostic
+	for _, rule := range rules {
+		for _, w := range warnings {
+			if rule.Warning != "" && w.Template == rule.Warning {
+				diagnostics = append(diagnostics, Diagnostic{Rule: rule.ID, Severity: rule.Severity, Error: w})
+			}
+		}
+		if rule.Check != nil {
+			pass := &Pass{Tree: tree, rule: rule}
+			ast.Walk(&tree.Node, pass)
+			diagnostics = append(diagnostics, pass.diagnostics...)
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Location, diagnostics[j].Location
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	for _, d := range diagnostics {
+		if config.Translator != nil {
+			d.Translate(config.Translator)
+		}
+		d.Bind(tree.Source)
+	}
+	return diagnostics
+}
+
+func failure(rule string, err error) Diagnostic {
+	e, ok := err.(*file.Error)
+	if !ok {
+		e = &file.Error{Message: err.Error()}
+	}
+	return Diagnostic{Rule: rule, Severity: Error, Error: e}
+}
+
+// Find returns rule with the id.
+func Find(rules []*Rule, id string) (*Rule, bool) {
+	for _, r := range rules {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
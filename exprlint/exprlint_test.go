@@ -0,0 +1,98 @@
+package exprlint_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprlint"
+	"github.com/stretchr/testify/require"
+)
+
+type env struct {
+	Users  []user
+	Name   string
+	Active bool
+	Lookup func(string) string
+}
+
+type user struct {
+	Name  string
+	Admin bool
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`Active ? "yes" : "no"`, ``},
+		{`true ? "yes" : "no"`, `1:1: warning: condition is always true (constant-condition)`},
+		{`Active && !false`, `1:11: warning: operand of && is always true (constant-condition)`},
+		{
+			`all(Users, {true})`,
+			"1:12: warning: closure does not use its argument # (unused-argument)\n" +
+				"1:13: warning: predicate of all is always true (constant-condition)",
+		},
+		{`Name == Name`, `1:6: warning: comparison is always true (constant-comparison)`},
+		{`1 != 1`, `1:3: warning: comparison is always false (constant-comparison)`},
+		{`let x = Name; Active`, `1:1: warning: variable x is unused (unused-variable)`},
+		{`Lookup(Name) == Lookup(Name)`, ``},
+		{`Active ? true : false`, `1:8: info: ternary can be replaced with its condition (redundant-ternary)`},
+		{`Active ? false : true`, `1:8: info: ternary can be replaced with negation of its condition (redundant-ternary)`},
+		{`Active ? Name : Name`, `1:8: info: both branches of ternary are the same (redundant-ternary)`},
+		{`not !Active`, `1:1: info: double negation (double-negation)`},
+		{`filter(Users, {.Name == Lookup(Name)})`, `1:25: warning: call does not depend on # and is evaluated for every element of filter (invariant-call)`},
+		{`filter(Users, {.Name == Lookup(.Name)})`, ``},
+		{`map(Users, {strings.upper("a") + .Name})`, ``},
+		{`map(Users, {.Name + strings.upper(Name)})`, `1:29: warning: call does not depend on # and is evaluated for every element of map (invariant-call)`},
+		{`any(Users, {.Name matches Name})`, `1:19: warning: pattern is compiled for every element (dynamic-regexp)`},
+		{`any(Users, {.Name matches "^a"})`, ``},
+		{`any(Users, {.Name like Name})`, `1:19: warning: pattern is compiled for every element (dynamic-regexp)`},
+		{
+			`any(Users, {all(Users, {.Name matches Name})})`,
+			"1:12: warning: closure does not use its argument # (unused-argument)\n" +
+				"1:31: warning: pattern is compiled for every element (dynamic-regexp)",
+		},
+		{
+			"true ?\n Name == Name : !!Active",
+			"1:1: warning: condition is always true (constant-condition)\n" +
+				"2:7: warning: comparison is always true (constant-comparison)\n" +
+				"2:17: info: double negation (double-negation)",
+		},
+		{`Name ==`, `1:7: error: unexpected token EOF (syntax)`},
+		{`Name + 1`, `1:6: error: invalid operation: + (mismatched types string and int), where Name is string (type)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			diagnostics := exprlint.Lint(tt.code, exprlint.Rules(), expr.Env(env{}))
+			lines := make([]string, len(diagnostics))
+			for i, d := range diagnostics {
+				lines[i] = fmt.Sprintf("%v:%v: %v: %v (%v)", d.Location.Line, d.Location.Column+1, d.Severity, d.Message, d.Rule)
+			}
+			require.Equal(t, tt.want, strings.Join(lines, "\n"))
+		})
+	}
+}
+
+func TestLint_severity(t *testing.T) {
+	rules := exprlint.Rules()
+	rule, ok := exprlint.Find(rules, "redundant-ternary")
+	require.True(t, ok)
+	rule.Severity = exprlint.Error
+
+	diagnostics := exprlint.Lint(`Active ? true : false`, rules, expr.Env(env{}))
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, exprlint.Error, diagnostics[0].Severity)
+	require.Equal(t, exprlint.Info, exprlint.Rules()[2].Severity)
+}
+
+func TestParseSeverity(t *testing.T) {
+	s, ok := exprlint.ParseSeverity("warning")
+	require.True(t, ok)
+	require.Equal(t, exprlint.Warning, s)
+
+	_, ok = exprlint.ParseSeverity("fatal")
+	require.False(t, ok)
+}
@@ -0,0 +1,139 @@
+package exprlint
+
+import (
+	"github.com/antonmedv/expr/ast"
+)
+
+func constValue(node ast.Node) (interface{}, bool) {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return nil, true
+	case *ast.IntegerNode:
+		return n.Value, true
+	case *ast.FloatNode:
+		return n.Value, true
+	case *ast.BoolNode:
+		return n.Value, true
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.ConstantNode:
+		return n.Value, true
+	}
+	return nil, false
+}
+
+// boolValue returns value of a boolean literal, possibly negated.
+func boolValue(node ast.Node) (bool, bool) {
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		return n.Value, true
+	case *ast.UnaryNode:
+		if isNot(n) {
+			v, ok := boolValue(n.Node)
+			return !v, ok
+		}
+	}
+	return false, false
+}
+
+func isNot(n *ast.UnaryNode) bool {
+	return n.Operator == "not" || n.Operator == "!"
+}
+
+// closureOf returns closure of a builtin, like the predicate of all().
+func closureOf(node ast.Node) (*ast.ClosureNode, string, bool) {
+	n, ok := node.(*ast.BuiltinNode)
+	if !ok || len(n.Arguments) != 2 {
+		return nil, "", false
+	}
+	closure, ok := n.Arguments[1].(*ast.ClosureNode)
+	return closure, n.Name, ok
+}
+
+// find returns nodes of body matching the predicate, except nodes inside of
+// nested closures, which are checked with closures themselves.
+func find(body ast.Node, match func(ast.Node) bool) []ast.Node {
+	all := &collector{match: match}
+	ast.Walk(&body, all)
+	nested := &collector{match: match}
+	for _, closure := range all.closures {
+		ast.Walk(&closure.Node, nested)
+	}
+	excluded := make(map[ast.Node]bool, len(nested.found))
+	for _, n := range nested.found {
+		excluded[n] = true
+	}
+	var found []ast.Node
+	for _, n := range all.found {
+		if !excluded[n] {
+			found = append(found, n)
+		}
+	}
+	return found
+}
+
+type collector struct {
+	match    func(ast.Node) bool
+	found    []ast.Node
+	closures []*ast.ClosureNode
+}
+
+func (c *collector) Visit(node *ast.Node) {
+	if closure, ok := (*node).(*ast.ClosureNode); ok {
+		c.closures = append(c.closures, closure)
+	}
+	if c.match(*node) {
+		c.found = append(c.found, *node)
+	}
+}
+
+// invariantCalls returns outermost calls of body, which do not use #. Calls
+// of deterministic builtins with constant arguments are skipped, as they are
+// evaluated during compilation.
+func invariantCalls(body ast.Node) []ast.Node {
+	calls := find(body, func(node ast.Node) bool {
+		n, ok := node.(*ast.CallNode)
+		if !ok || usesPointer(n) {
+			return false
+		}
+		if n.Func != nil {
+			if n.Func.NonDeterministic {
+				return false
+			}
+			if n.Func.NoFold {
+				return true
+			}
+			for _, arg := range n.Arguments {
+				if _, ok := constValue(arg); !ok {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	})
+	inner := make(map[ast.Node]bool)
+	for _, call := range calls {
+		c := &collector{match: func(node ast.Node) bool { return node != call }}
+		ast.Walk(&call, c)
+		for _, n := range c.found {
+			inner[n] = true
+		}
+	}
+	var outer []ast.Node
+	for _, call := range calls {
+		if !inner[call] {
+			outer = append(outer, call)
+		}
+	}
+	return outer
+}
+
+func usesPointer(node ast.Node) bool {
+	c := &collector{match: func(node ast.Node) bool {
+		_, ok := node.(*ast.PointerNode)
+		return ok
+	}}
+	ast.Walk(&node, c)
+	return len(c.found) > 0
+}
@@ -0,0 +1,154 @@
+package exprlint
+
+import (
+	"github.com/antonmedv/expr/ast"
+)
+
+// Rules returns default rules. Rules are created on every call, so their
+// severities may be changed.
+func Rules() []*Rule {
+	return []*Rule{
+		{
+			ID:          "constant-condition",
+			Severity:    Warning,
+			Description: "condition of ternary, operand of logical operator or predicate is constant",
+			Check:       constantCondition,
+		},
+		{
+			ID:          "constant-comparison",
+			Severity:    Warning,
+			Description: "comparison is always true or false",
+			Warning:     "comparison is always %v",
+		},
+		{
+			ID:          "redundant-ternary",
+			Severity:    Info,
+			Description: "ternary returns its condition, or the same value in both branches",
+			Check:       redundantTernary,
+		},
+		{
+			ID:          "double-negation",
+			Severity:    Info,
+			Description: "value is negated twice",
+			Check:       doubleNegation,
+		},
+		{
+			ID:          "invariant-call",
+			Severity:    Warning,
+			Description: "call inside closure does not depend on element, and is repeated for every element",
+			Check:       invariantCall,
+		},
+		{
+			ID:          "dynamic-regexp",
+			Severity:    Warning,
+			Description: "pattern of matches or like inside closure is not constant, and is compiled for every element",
+			Check:       dynamicRegexp,
+		},
+		{
+			ID:          "unused-argument",
+			Severity:    Warning,
+			Description: "closure does not use its argument #",
+			Warning:     "closure does not use its argument #",
+		},
+		{
+			ID:          "unused-variable",
+			Severity:    Warning,
+			Description: "variable of let is not used",
+			Warning:     "variable %v is unused",
+		},
+		{
+			ID:          "shadowed-builtin",
+			Severity:    Warning,
+			Description: "variable of the environment shadows builtin",
+			Warning:     "%v shadows builtin",
+		},
+		{
+			ID:          "implicit-conversion",
+			Severity:    Info,
+			Description: "integer is implicitly converted to float",
+			Warning:     "integer %v is implicitly converted to %v",
+		},
+	}
+}
+
+func constantCondition(pass *Pass, node ast.Node) {
+	switch n := node.(type) {
+	case *ast.ConditionalNode:
+		if v, ok := boolValue(n.Cond); ok {
+			pass.Report(n.Cond, "condition is always %v", v)
+		}
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "and", "&&", "or", "||":
+			for _, operand := range []ast.Node{n.Left, n.Right} {
+				if v, ok := boolValue(operand); ok {
+					pass.Report(operand, "operand of %v is always %v", n.Operator, v)
+				}
+			}
+		}
+	case *ast.BuiltinNode:
+		switch n.Name {
+		case "all", "none", "any", "one", "filter", "count":
+			if closure, ok := n.Arguments[1].(*ast.ClosureNode); ok {
+				if v, ok := boolValue(closure.Node); ok {
+					pass.Report(closure.Node, "predicate of %v is always %v", n.Name, v)
+				}
+			}
+		}
+	}
+}
+
+func redundantTernary(pass *Pass, node ast.Node) {
+	n, ok := node.(*ast.ConditionalNode)
+	if !ok {
+		return
+	}
+	a, aOk := boolValue(n.Exp1)
+	b, bOk := boolValue(n.Exp2)
+	switch {
+	case aOk && bOk && a && !b:
+		pass.Report(n, "ternary can be replaced with its condition")
+	case aOk && bOk && !a && b:
+		pass.Report(n, "ternary can be replaced with negation of its condition")
+	case ast.Dump(n.Exp1) == ast.Dump(n.Exp2):
+		pass.Report(n, "both branches of ternary are the same")
+	}
+}
+
+func doubleNegation(pass *Pass, node ast.Node) {
+	n, ok := node.(*ast.UnaryNode)
+	if !ok || !isNot(n) {
+		return
+	}
+	if inner, ok := n.Node.(*ast.UnaryNode); ok && isNot(inner) {
+		pass.Report(n, "double negation")
+	}
+}
+
+func invariantCall(pass *Pass, node ast.Node) {
+	closure, name, ok := closureOf(node)
+	if !ok {
+		return
+	}
+	for _, call := range invariantCalls(closure.Node) {
+		pass.Report(call, "call does not depend on # and is evaluated for every element of %v", name)
+	}
+}
+
+func dynamicRegexp(pass *Pass, node ast.Node) {
+	closure, _, ok := closureOf(node)
+	if !ok {
+		return
+	}
+	patterns := find(closure.Node, func(node ast.Node) bool {
+		n, ok := node.(*ast.BinaryNode)
+		if !ok || n.Operator != "matches" && n.Operator != "like" {
+			return false
+		}
+		_, ok = constValue(n.Right)
+		return !ok
+	})
+	for _, n := range patterns {
+		pass.Report(n, "pattern is compiled for every element")
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/antonmedv/expr/exprlocale
+
+go 1.18
+
+require (
+	github.com/antonmedv/expr v1.10.0
+	github.com/stretchr/testify v1.8.0
+	golang.org/x/text v0.14.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/antonmedv/expr => ../
@@ -0,0 +1,284 @@
+// Package exprlocale provides functions of the locale namespace, which
+// format numbers, amounts and dates by conventions of locales. It is a
+// separate module, so programs not using locales do not depend on
+// golang.org/x/text.
+//
+//	program, err := expr.Compile(`locale.formatNumber(Total, User.Locale)`,
+//		expr.Env(env), exprlocale.Support())
+package exprlocale
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/conf"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	textnumber "golang.org/x/text/number"
+)
+
+// Support enables functions of the locale namespace:
+//
+//	locale.formatNumber(x, locale)                     like 1.234.567,891 for "de-DE"
+//	locale.formatCurrency(amount, currency, locale)    rounded to minor units of the currency
+//	locale.formatDate(t, layout, locale)               Go layout with names of months and days
+//
+// Locales are BCP 47 tags, like "en-US" or "de", and currencies are ISO 4217
+// codes. Constant locales and currencies are checked during compilation.
+func Support() expr.Option {
+	return func(c *conf.Config) {
+		expr.Builtin(functions...)(c)
+	}
+}
+
+var functions = []*builtin.Function{
+	{
+		Name: "locale.formatNumber",
+		Doc:  "Formats number by conventions of the locale, like 1.234,5 for \"de-DE\".",
+		Func: formatNumber,
+		Types: types(
+			new(func(int, string) string),
+			new(func(float64, string) string),
+		),
+		ValidateConst: validateLocale("locale.formatNumber", 1),
+	},
+	{
+		Name: "locale.formatCurrency",
+		Doc:  "Formats amount in the currency by conventions of the locale, like €1,234.50 for \"en-US\".",
+		Func: formatCurrency,
+		Types: types(
+			new(func(int, string, string) string),
+			new(func(float64, string, string) string),
+		),
+		ValidateConst: validateLocale("locale.formatCurrency", 2),
+	},
+	{
+		Name:          "locale.formatDate",
+		Doc:           "Formats time by the layout with names of months and days of the locale.",
+		Func:          formatDate,
+		Types:         types(new(func(time.Time, string, string) string)),
+		ValidateConst: validateLocale("locale.formatDate", 2),
+	},
+}
+
+func types(fns ...interface{}) []reflect.Type {
+	ts := make([]reflect.Type, len(fns))
+	for i, fn := range fns {
+		ts[i] = reflect.TypeOf(fn).Elem()
+	}
+	return ts
+}
+
+func toString(name string, arg interface{}) (string, error) {
+	s, ok := arg.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+	}
+	return s, nil
+}
+
+func parseLocale(name string, arg interface{}) (language.Tag, error) {
+	s, err := toString(name, arg)
+	if err != nil {
+		return language.Tag{}, err
+	}
+	tag, err := language.Parse(s)
+	if err != nil {
+		return language.Tag{}, fmt.Errorf("invalid locale %q", s)
+	}
+	return tag, nil
+}
+
+// validateLocale checks literal locales, and currencies of
+// locale.formatCurrency, during compilation.
+func validateLocale(name string, locale int) func(i int, value interface{}) error {
+	return func(i int, value interface{}) error {
+		switch {
+		case i == locale:
+			_, err := parseLocale(name, value)
+			return err
+		case name == "locale.formatCurrency" && i == 1:
+			_, err := parseCurrency(value)
+			return err
+		}
+		return nil
+	}
+}
+
+func parseCurrency(arg interface{}) (currency.Unit, error) {
+	s, err := toString("locale.formatCurrency", arg)
+	if err != nil {
+		return currency.Unit{}, err
+	}
+	unit, err := currency.ParseISO(s)
+	if err != nil {
+		return currency.Unit{}, fmt.Errorf("invalid currency %q", s)
+	}
+	return unit, nil
+}
+
+// decimal returns the number formatted by x/text, as integers are not
+// converted to floats.
+func decimal(name string, arg interface{}, opts ...textnumber.Option) (textnumber.Formatter, error) {
+	v := reflect.ValueOf(arg)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return textnumber.Decimal(v.Int(), opts...), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return textnumber.Decimal(v.Uint(), opts...), nil
+	case reflect.Float32, reflect.Float64:
+		return textnumber.Decimal(v.Float(), opts...), nil
+	}
+	return textnumber.Formatter{}, fmt.Errorf("invalid argument for %v (type %T)", name, arg)
+}
+
+func formatNumber(args ...interface{}) (interface{}, error) {
+	tag, err := parseLocale("locale.formatNumber", args[1])
+	if err != nil {
+		return nil, err
+	}
+	n, err := decimal("locale.formatNumber", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return message.NewPrinter(tag).Sprint(n), nil
+}
+
+func formatCurrency(args ...interface{}) (interface{}, error) {
+	unit, err := parseCurrency(args[1])
+	if err != nil {
+		return nil, err
+	}
+	tag, err := parseLocale("locale.formatCurrency", args[2])
+	if err != nil {
+		return nil, err
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	n, err := decimal("locale.formatCurrency", args[0], textnumber.MinFractionDigits(scale), textnumber.MaxFractionDigits(scale))
+	if err != nil {
+		return nil, err
+	}
+	p := message.NewPrinter(tag)
+	amount, symbol := p.Sprint(n), p.Sprint(currency.Symbol(unit))
+	base, _ := tag.Base()
+	if symbolFirst[base.String()] {
+		if strings.HasPrefix(amount, "-") {
+			return "-" + symbol + amount[1:], nil
+		}
+		return symbol + amount, nil
+	}
+	return amount + "\u00a0" + symbol, nil
+}
+
+// symbolFirst are languages, which put currency symbols before amounts.
+// Other languages put symbols after amounts, separated by a no-break space.
+var symbolFirst = map[string]bool{
+	"en": true, "ja": true, "zh": true, "ko": true, "hi": true, "th": true,
+	"he": true, "ms": true, "id": true, "ga": true, "cy": true,
+}
+
+func formatDate(args ...interface{}) (interface{}, error) {
+	t, ok := args[0].(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("invalid argument for locale.formatDate (type %T)", args[0])
+	}
+	layout, err := toString("locale.formatDate", args[1])
+	if err != nil {
+		return nil, err
+	}
+	tag, err := parseLocale("locale.formatDate", args[2])
+	if err != nil {
+		return nil, err
+	}
+	base, _ := tag.Base()
+	names, ok := dateNames[base.String()]
+	if !ok {
+		return t.Format(layout), nil
+	}
+	// Names of months and days are replaced in the layout, and other parts
+	// of the layout are formatted by package time.
+	var b strings.Builder
+	for layout != "" {
+		i, token := nextDateName(layout)
+		b.WriteString(t.Format(layout[:i]))
+		if token == "" {
+			break
+		}
+		switch token {
+		case "January":
+			b.WriteString(names.months[t.Month()-1])
+		case "Jan":
+			b.WriteString(names.shortMonths[t.Month()-1])
+		case "Monday":
+			b.WriteString(names.days[t.Weekday()])
+		case "Mon":
+			b.WriteString(names.shortDays[t.Weekday()])
+		}
+		layout = layout[i+len(token):]
+	}
+	return b.String(), nil
+}
+
+// nextDateName returns the index of the first name of a month or a day in
+// the layout, or the length of the layout.
+func nextDateName(layout string) (int, string) {
+	for i := 0; i < len(layout); i++ {
+		for _, token := range []string{"January", "Jan", "Monday", "Mon"} {
+			if strings.HasPrefix(layout[i:], token) {
+				return i, token
+			}
+		}
+	}
+	return len(layout), ""
+}
+
+type localeNames struct {
+	months, shortMonths [12]string
+	days, shortDays     [7]string
+}
+
+// dateNames are names of months and days by languages. Dates in other
+// languages are formatted with English names.
+var dateNames = map[string]localeNames{
+	"de": {
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+	},
+	"fr": {
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	"es": {
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	"it": {
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	"pt": {
+		months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		shortMonths: [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		days:        [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortDays:   [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	},
+	"nl": {
+		months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		shortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	},
+}
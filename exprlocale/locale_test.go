@@ -0,0 +1,82 @@
+package exprlocale_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprlocale"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupport(t *testing.T) {
+	env := map[string]interface{}{
+		"date":  time.Date(2023, 3, 5, 14, 7, 0, 0, time.UTC),
+		"total": 1500,
+		"lang":  "de-DE",
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`locale.formatNumber(1234567.891, "en-US")`, "1,234,567.891"},
+		{`locale.formatNumber(1234567.891, "de-DE")`, "1.234.567,891"},
+		{`locale.formatNumber(-1234567, "hi-IN")`, "-12,34,567"},
+		{`locale.formatNumber(1234.5, lang)`, "1.234,5"},
+		{`locale.formatCurrency(1234.5, "EUR", "en-US")`, "€1,234.50"},
+		{`locale.formatCurrency(-1234.5, "EUR", "de-DE")`, "-1.234,50 €"},
+		{`locale.formatCurrency(1500, "JPY", "en")`, "¥1,500"},
+		{`locale.formatCurrency(total, "USD", "en")`, "$1,500.00"},
+		{`locale.formatDate(date, "Monday, 2 January 2006 15:04", "de-DE")`, "Sonntag, 5 März 2023 14:07"},
+		{`locale.formatDate(date, "Mon Jan 2", "es")`, "dom mar 5"},
+		{`locale.formatDate(date, "Mon Jan 2", "en-GB")`, "Sun Mar 5"},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(env), exprlocale.Support())
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+}
+
+func TestSupport_errors(t *testing.T) {
+	env := map[string]interface{}{
+		"lang":     "!",
+		"currency": "EURO",
+	}
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`locale.formatNumber(1, "!")`, `invalid locale "!"`},
+		{`locale.formatNumber(1, lang)`, `invalid locale "!"`},
+		{`locale.formatCurrency(1, "EURO", "en")`, `invalid currency "EURO"`},
+		{`locale.formatCurrency(1, currency, "en")`, `invalid currency "EURO"`},
+		{`locale.formatDate(1, "Mon", "en")`, "locale.formatDate accepts func(time.Time, string, string) string"},
+	}
+	for _, test := range tests {
+		_, err := expr.Eval(test.code, env)
+		require.Error(t, err, test.code)
+
+		program, err := expr.Compile(test.code, expr.Env(env), exprlocale.Support())
+		if err == nil {
+			_, err = expr.Run(program, env)
+		}
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+}
+
+func TestSupport_flat(t *testing.T) {
+	program, err := expr.Compile(`formatNumber(1234, "en")`, exprlocale.Support())
+	require.NoError(t, err)
+
+	out, err := expr.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1,234", out)
+}
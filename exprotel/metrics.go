@@ -0,0 +1,81 @@
+// Package exprotel reports metrics of expressions to OpenTelemetry. It is a
+// separate module, so programs not using OpenTelemetry do not depend on it.
+//
+//	m, err := exprotel.NewMetrics(otel.Meter("rules"))
+//	program, err := expr.Compile(`user.Age >= 18`, expr.Env(env), expr.Metrics("adult", m))
+package exprotel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metrics records compilations and runs by instruments of the meter:
+//
+//	expr.compilations    counter of compilations, by expr.id and expr.status
+//	expr.runs            counter of runs, by expr.id and expr.status
+//	expr.limits_exceeded counter of exceeded limits, by expr.id and expr.limit
+//	expr.compile.duration and expr.run.duration histograms in seconds
+type Metrics struct {
+	compilations    metric.Int64Counter
+	runs            metric.Int64Counter
+	limits          metric.Int64Counter
+	compileDuration metric.Float64Histogram
+	runDuration     metric.Float64Histogram
+}
+
+// NewMetrics creates instruments of metrics with the meter.
+func NewMetrics(meter metric.Meter) (*Metrics, error) {
+	m := &Metrics{}
+	var err error
+	if m.compilations, err = meter.Int64Counter("expr.compilations",
+		metric.WithDescription("Compilations of expressions.")); err != nil {
+		return nil, err
+	}
+	if m.runs, err = meter.Int64Counter("expr.runs",
+		metric.WithDescription("Runs of programs.")); err != nil {
+		return nil, err
+	}
+	if m.limits, err = meter.Int64Counter("expr.limits_exceeded",
+		metric.WithDescription("Compilations and runs, which exceeded limits.")); err != nil {
+		return nil, err
+	}
+	if m.compileDuration, err = meter.Float64Histogram("expr.compile.duration",
+		metric.WithDescription("Durations of compilations."), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.runDuration, err = meter.Float64Histogram("expr.run.duration",
+		metric.WithDescription("Durations of runs."), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func (m *Metrics) Compiled(id string, duration time.Duration, err error) {
+	ctx := context.Background()
+	attrs := metric.WithAttributes(attribute.String("expr.id", id), attribute.String("expr.status", status(err)))
+	m.compilations.Add(ctx, 1, attrs)
+	m.compileDuration.Record(ctx, duration.Seconds(), attrs)
+}
+
+func (m *Metrics) Ran(id string, duration time.Duration, err error) {
+	ctx := context.Background()
+	attrs := metric.WithAttributes(attribute.String("expr.id", id), attribute.String("expr.status", status(err)))
+	m.runs.Add(ctx, 1, attrs)
+	m.runDuration.Record(ctx, duration.Seconds(), attrs)
+}
+
+func (m *Metrics) LimitExceeded(id string, limit string) {
+	m.limits.Add(context.Background(), 1,
+		metric.WithAttributes(attribute.String("expr.id", id), attribute.String("expr.limit", limit)))
+}
@@ -0,0 +1,77 @@
+package exprotel_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprotel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	m, err := exprotel.NewMetrics(provider.Meter("rules"))
+	require.NoError(t, err)
+
+	env := map[string]interface{}{"x": 0}
+	program, err := expr.Compile(`1 / x > 0`, expr.Env(env), expr.Metrics("div", m), expr.ZeroDivisionError())
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	_, err = expr.Run(program, map[string]interface{}{"x": 1})
+	require.NoError(t, err)
+
+	program, err = expr.Compile(`len(1..2000000)`, expr.Metrics("memory", m))
+	require.NoError(t, err)
+	_, err = expr.Run(program, nil)
+	require.Error(t, err)
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+	require.Len(t, data.ScopeMetrics, 1)
+	collected := make(map[string]metricdata.Aggregation)
+	for _, m := range data.ScopeMetrics[0].Metrics {
+		collected[m.Name] = m.Data
+	}
+
+	assert.Equal(t, map[string]int64{
+		"div/ok":    1,
+		"memory/ok": 1,
+	}, sums(t, collected["expr.compilations"], "expr.status"))
+	assert.Equal(t, map[string]int64{
+		"div/error":    1,
+		"div/ok":       1,
+		"memory/error": 1,
+	}, sums(t, collected["expr.runs"], "expr.status"))
+	assert.Equal(t, map[string]int64{
+		"memory/memory": 1,
+	}, sums(t, collected["expr.limits_exceeded"], "expr.limit"))
+
+	runs, ok := collected["expr.run.duration"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	var count uint64
+	for _, point := range runs.DataPoints {
+		count += point.Count
+	}
+	assert.Equal(t, uint64(3), count)
+	assert.Contains(t, collected, "expr.compile.duration")
+}
+
+// sums returns values of the counter by expr.id and the label.
+func sums(t *testing.T, data metricdata.Aggregation, label attribute.Key) map[string]int64 {
+	sum, ok := data.(metricdata.Sum[int64])
+	require.True(t, ok, "%T", data)
+	values := make(map[string]int64)
+	for _, point := range sum.DataPoints {
+		id, _ := point.Attributes.Value("expr.id")
+		value, _ := point.Attributes.Value(label)
+		values[id.AsString()+"/"+value.AsString()] = point.Value
+	}
+	return values
+}
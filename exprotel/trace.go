@@ -0,0 +1,80 @@
+package exprotel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/antonmedv/expr/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts spans of runs and calls by the tracer of OpenTelemetry:
+//
+//	expr.run               span of a run, with expr.id, expr.hash, expr.outcome,
+//	                       expr.result for results of basic types, and
+//	                       attributes of expr.Trace prefixed by "expr.env."
+//	expr.call <function>   child span of a call of a function with context
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns the tracer starting spans by the tracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+func (t *Tracer) StartRun(ctx context.Context, id, hash string) (context.Context, tracing.Span) {
+	ctx, s := t.tracer.Start(ctx, "expr.run", trace.WithAttributes(
+		attribute.String("expr.id", id),
+		attribute.String("expr.hash", hash),
+	))
+	return ctx, &span{span: s, run: true}
+}
+
+func (t *Tracer) StartCall(ctx context.Context, name string) (context.Context, tracing.Span) {
+	ctx, s := t.tracer.Start(ctx, "expr.call "+name, trace.WithAttributes(
+		attribute.String("expr.function", name),
+	))
+	return ctx, &span{span: s}
+}
+
+type span struct {
+	span trace.Span
+	run  bool
+}
+
+func (s *span) End(result interface{}, err error, attributes map[string]interface{}) {
+	for path, value := range attributes {
+		s.span.SetAttributes(attributeOf("expr.env."+path, value))
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+		s.span.SetAttributes(attribute.String("expr.outcome", "error"))
+	} else if s.run {
+		s.span.SetAttributes(attribute.String("expr.outcome", "ok"))
+		switch result.(type) {
+		case bool, int, int64, float64, string:
+			s.span.SetAttributes(attributeOf("expr.result", result))
+		}
+	}
+	s.span.End()
+}
+
+func attributeOf(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case string:
+		return attribute.String(key, v)
+	}
+	return attribute.String(key, fmt.Sprintf("%v", value))
+}
@@ -0,0 +1,90 @@
+package exprotel_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprotel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := exprotel.NewTracer(provider.Tracer("rules"))
+
+	env := map[string]interface{}{
+		"user": map[string]interface{}{"ID": 42, "Name": "John"},
+		"score": func(ctx context.Context, id int) (float64, error) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return 0, fmt.Errorf("no span")
+			}
+			return 0.5, nil
+		},
+		"fail": func(ctx context.Context) (int, error) {
+			return 0, fmt.Errorf("unavailable")
+		},
+	}
+
+	program, err := expr.Compile(`score(user.ID) > 0.1 && fallback(fail(), 1) > 0`,
+		expr.Env(env), expr.Trace("adult", tracer, "user.ID", "user.Name"))
+	require.NoError(t, err)
+	out, err := expr.RunContext(context.Background(), program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	program, err = expr.Compile(`fail()`, expr.Env(env), expr.Trace("fail", tracer))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 5)
+
+	score, fallback, run := spans[0], spans[1], spans[2]
+	assert.Equal(t, "expr.call score", score.Name())
+	assert.Equal(t, run.SpanContext().SpanID(), score.Parent().SpanID())
+	assert.Equal(t, codes.Unset, score.Status().Code)
+	assert.Contains(t, score.Attributes(), attribute.String("expr.function", "score"))
+
+	assert.Equal(t, "expr.call fail", fallback.Name())
+	assert.Equal(t, codes.Error, fallback.Status().Code)
+	assert.Equal(t, "unavailable", fallback.Status().Description)
+	require.Len(t, fallback.Events(), 1)
+	assert.Equal(t, "exception", fallback.Events()[0].Name)
+
+	assert.Equal(t, "expr.run", run.Name())
+	assert.False(t, run.Parent().IsValid())
+	assert.Equal(t, codes.Unset, run.Status().Code)
+	attributes := attribute.NewSet(run.Attributes()...)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"expr.id":            attribute.StringValue("adult"),
+		"expr.outcome":       attribute.StringValue("ok"),
+		"expr.result":        attribute.BoolValue(true),
+		"expr.env.user.ID":   attribute.IntValue(42),
+		"expr.env.user.Name": attribute.StringValue("John"),
+	} {
+		value, ok := attributes.Value(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, want, value, key)
+	}
+	hash, _ := attributes.Value("expr.hash")
+	assert.Len(t, hash.AsString(), 64)
+
+	failed := spans[4]
+	assert.Equal(t, "expr.run", failed.Name())
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	attributes = attribute.NewSet(failed.Attributes()...)
+	outcome, _ := attributes.Value("expr.outcome")
+	assert.Equal(t, "error", outcome.AsString())
+	_, ok := attributes.Value("expr.result")
+	assert.False(t, ok)
+}
@@ -0,0 +1,112 @@
+// Package exprprom reports metrics of expressions to Prometheus. It is a
+// separate module, so programs not using Prometheus do not depend on it.
+//
+//	m := exprprom.NewMetrics("expr")
+//	prometheus.MustRegister(m)
+//
+//	program, err := expr.Compile(`user.Age >= 18`, expr.Env(env), expr.Metrics("adult", m))
+package exprprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultBuckets are upper bounds of buckets of histograms of durations in
+// seconds, from a microsecond to a second.
+var DefaultBuckets = []float64{1e-6, 5e-6, 1e-5, 5e-5, 1e-4, 5e-4, 1e-3, 5e-3, 1e-2, 0.1, 1}
+
+// Metrics records compilations and runs by collectors of Prometheus, and is
+// a prometheus.Collector of them, which is registered with registries:
+//
+//	expr_compilations_total       counter of compilations, by id and status
+//	expr_runs_total               counter of runs, by id and status
+//	expr_limits_exceeded_total    counter of exceeded limits, by id and limit
+//	expr_compile_duration_seconds and expr_run_duration_seconds histograms by id
+//
+// Error rates are rates of runs with the "error" status.
+type Metrics struct {
+	compilations    *prometheus.CounterVec
+	runs            *prometheus.CounterVec
+	limits          *prometheus.CounterVec
+	compileDuration *prometheus.HistogramVec
+	runDuration     *prometheus.HistogramVec
+}
+
+// NewMetrics creates collectors of metrics, which names start with the
+// namespace, like "expr". Histograms of durations have DefaultBuckets, unless
+// buckets are given.
+func NewMetrics(namespace string, buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Metrics{
+		compilations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "compilations_total",
+			Help:      "Compilations of expressions.",
+		}, []string{"id", "status"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_total",
+			Help:      "Runs of programs.",
+		}, []string{"id", "status"}),
+		limits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "limits_exceeded_total",
+			Help:      "Compilations and runs, which exceeded limits.",
+		}, []string{"id", "limit"}),
+		compileDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "compile_duration_seconds",
+			Help:      "Durations of compilations.",
+			Buckets:   buckets,
+		}, []string{"id"}),
+		runDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "run_duration_seconds",
+			Help:      "Durations of runs.",
+			Buckets:   buckets,
+		}, []string{"id"}),
+	}
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func (m *Metrics) Compiled(id string, duration time.Duration, err error) {
+	m.compilations.WithLabelValues(id, status(err)).Inc()
+	m.compileDuration.WithLabelValues(id).Observe(duration.Seconds())
+}
+
+func (m *Metrics) Ran(id string, duration time.Duration, err error) {
+	m.runs.WithLabelValues(id, status(err)).Inc()
+	m.runDuration.WithLabelValues(id).Observe(duration.Seconds())
+}
+
+func (m *Metrics) LimitExceeded(id string, limit string) {
+	m.limits.WithLabelValues(id, limit).Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.compilations.Describe(ch)
+	m.runs.Describe(ch)
+	m.limits.Describe(ch)
+	m.compileDuration.Describe(ch)
+	m.runDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.compilations.Collect(ch)
+	m.runs.Collect(ch)
+	m.limits.Collect(ch)
+	m.compileDuration.Collect(ch)
+	m.runDuration.Collect(ch)
+}
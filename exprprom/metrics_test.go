@@ -0,0 +1,87 @@
+package exprprom_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprprom"
+	"github.com/antonmedv/expr/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := exprprom.NewMetrics("expr", 0.001, 0.01)
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(m))
+
+	m.Compiled("adult", 5*time.Millisecond, nil)
+	m.Ran("adult", 500*time.Microsecond, nil)
+	m.Ran("adult", 2*time.Millisecond, fmt.Errorf("error"))
+	m.Ran("adult", time.Second, nil)
+	m.LimitExceeded(`a"b`, metrics.Memory)
+
+	err := testutil.GatherAndCompare(registry, strings.NewReader(`# HELP expr_compilations_total Compilations of expressions.
+# TYPE expr_compilations_total counter
+expr_compilations_total{id="adult",status="ok"} 1
+# HELP expr_runs_total Runs of programs.
+# TYPE expr_runs_total counter
+expr_runs_total{id="adult",status="error"} 1
+expr_runs_total{id="adult",status="ok"} 2
+# HELP expr_limits_exceeded_total Compilations and runs, which exceeded limits.
+# TYPE expr_limits_exceeded_total counter
+expr_limits_exceeded_total{id="a\"b",limit="memory"} 1
+# HELP expr_compile_duration_seconds Durations of compilations.
+# TYPE expr_compile_duration_seconds histogram
+expr_compile_duration_seconds_bucket{id="adult",le="0.001"} 0
+expr_compile_duration_seconds_bucket{id="adult",le="0.01"} 1
+expr_compile_duration_seconds_bucket{id="adult",le="+Inf"} 1
+expr_compile_duration_seconds_sum{id="adult"} 0.005
+expr_compile_duration_seconds_count{id="adult"} 1
+# HELP expr_run_duration_seconds Durations of runs.
+# TYPE expr_run_duration_seconds histogram
+expr_run_duration_seconds_bucket{id="adult",le="0.001"} 1
+expr_run_duration_seconds_bucket{id="adult",le="0.01"} 2
+expr_run_duration_seconds_bucket{id="adult",le="+Inf"} 3
+expr_run_duration_seconds_sum{id="adult"} 1.0025
+expr_run_duration_seconds_count{id="adult"} 3
+`))
+	require.NoError(t, err)
+
+	// Collectors of the same names are registered once.
+	assert.Error(t, registry.Register(exprprom.NewMetrics("expr")))
+}
+
+func TestMetrics_expr(t *testing.T) {
+	m := exprprom.NewMetrics("expr")
+	env := map[string]interface{}{"x": 0}
+
+	program, err := expr.Compile(`1 / x > 0`, expr.Env(env), expr.Metrics("div", m), expr.ZeroDivisionError())
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	_, err = expr.Run(program, map[string]interface{}{"x": 1})
+	require.NoError(t, err)
+
+	program, err = expr.Compile(`len(1..2000000)`, expr.Metrics("memory", m))
+	require.NoError(t, err)
+	_, err = expr.Run(program, nil)
+	require.Error(t, err)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m, "expr_compilations_total"))
+	err = testutil.CollectAndCompare(m, strings.NewReader(`# HELP expr_runs_total Runs of programs.
+# TYPE expr_runs_total counter
+expr_runs_total{id="div",status="error"} 1
+expr_runs_total{id="div",status="ok"} 1
+expr_runs_total{id="memory",status="error"} 1
+# HELP expr_limits_exceeded_total Compilations and runs, which exceeded limits.
+# TYPE expr_limits_exceeded_total counter
+expr_limits_exceeded_total{id="memory",limit="memory"} 1
+`), "expr_runs_total", "expr_limits_exceeded_total")
+	require.NoError(t, err)
+}
@@ -0,0 +1,17 @@
+module github.com/antonmedv/expr/exprproto
+
+go 1.17
+
+require (
+	github.com/antonmedv/expr v1.10.0
+	github.com/stretchr/testify v1.8.0
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/antonmedv/expr => ../
@@ -0,0 +1,330 @@
+// Package exprproto runs expressions over protobuf messages, like payloads
+// of gRPC requests. It is a separate module, so programs not using protobuf
+// do not depend on it.
+//
+// Generated messages are used as environments directly, with well-known
+// types converted to native ones by Support:
+//
+//	program, err := expr.Compile(`Request.CreatedAt.Before(Deadline)`,
+//		expr.Env(Env{}), exprproto.Support())
+//
+// Messages without generated types, like dynamicpb ones, are wrapped by
+// Message, which fields are read by protoreflect:
+//
+//	program, err := expr.Compile(`user_id > 0`, expr.Env(exprproto.Types(msg)))
+//	output, err := expr.Run(program, exprproto.Wrap(msg))
+package exprproto
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Support converts well-known types of fields of generated messages on
+// access:
+//
+//	google.protobuf.Timestamp  time.Time, zero for unset fields
+//	google.protobuf.Duration   time.Duration
+//	google.protobuf.*Value     wrapped value, or nil for unset fields
+//	google.protobuf.Struct     map[string]interface{}
+//	google.protobuf.Value      interface{}
+//	google.protobuf.ListValue  []interface{}
+func Support() expr.Option {
+	return expr.Converter(
+		func(t *timestamppb.Timestamp) time.Time {
+			if t == nil {
+				return time.Time{}
+			}
+			return t.AsTime()
+		},
+		func(d *durationpb.Duration) time.Duration {
+			return d.AsDuration()
+		},
+		func(v *wrapperspb.BoolValue) *bool {
+			if v == nil {
+				return nil
+			}
+			return &v.Value
+		},
+		func(v *wrapperspb.StringValue) *string {
+			if v == nil {
+				return nil
+			}
+			return &v.Value
+		},
+		func(v *wrapperspb.BytesValue) []byte {
+			return v.GetValue()
+		},
+		func(v *wrapperspb.Int32Value) *int {
+			if v == nil {
+				return nil
+			}
+			i := int(v.Value)
+			return &i
+		},
+		func(v *wrapperspb.Int64Value) *int {
+			if v == nil {
+				return nil
+			}
+			i := int(v.Value)
+			return &i
+		},
+		func(v *wrapperspb.UInt32Value) *int {
+			if v == nil {
+				return nil
+			}
+			i := int(v.Value)
+			return &i
+		},
+		func(v *wrapperspb.UInt64Value) *uint64 {
+			if v == nil {
+				return nil
+			}
+			return &v.Value
+		},
+		func(v *wrapperspb.FloatValue) *float64 {
+			if v == nil {
+				return nil
+			}
+			f := float64(v.Value)
+			return &f
+		},
+		func(v *wrapperspb.DoubleValue) *float64 {
+			if v == nil {
+				return nil
+			}
+			return &v.Value
+		},
+		func(s *structpb.Struct) map[string]interface{} {
+			return s.AsMap()
+		},
+		func(v *structpb.Value) interface{} {
+			return v.AsInterface()
+		},
+		func(l *structpb.ListValue) []interface{} {
+			return l.AsSlice()
+		},
+	)
+}
+
+// Message is a protobuf message, which fields are read by protoreflect on
+// access, by names of the proto file, like user_id, or by JSON names, like
+// userId. Values of fields are native values:
+//
+//	integers        int, or uint64 for uint64 and fixed64
+//	floats          float64
+//	enums           names of values, like "ACTIVE"
+//	messages        *Message, or nil for unset fields
+//	repeated        []interface{}
+//	maps            map[string]interface{}, or map[interface{}]interface{}
+//
+// Well-known types are converted like by Support.
+type Message struct {
+	m protoreflect.Message
+}
+
+// Wrap returns the message for expressions.
+func Wrap(m proto.Message) *Message {
+	return &Message{m: m.ProtoReflect()}
+}
+
+// Fetch returns the value of the field of the name.
+func (m *Message) Fetch(name string) (interface{}, error) {
+	fd := field(m.m.Descriptor(), name)
+	if fd == nil {
+		return nil, fmt.Errorf("message %v has no field %v", m.m.Descriptor().FullName(), name)
+	}
+	if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && !m.m.Has(fd) {
+		if fd.Message().FullName() == "google.protobuf.Timestamp" {
+			return time.Time{}, nil
+		}
+		return nil, nil
+	}
+	return value(fd, m.m.Get(fd)), nil
+}
+
+// Interface returns the message.
+func (m *Message) Interface() proto.Message {
+	return m.m.Interface()
+}
+
+func field(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+// value returns the native value of the field.
+func value(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		out := make([]interface{}, list.Len())
+		for i := range out {
+			out[i] = scalar(fd, list.Get(i))
+		}
+		return out
+	case fd.IsMap():
+		return mapValue(fd, v.Map())
+	}
+	return scalar(fd, v)
+}
+
+func mapValue(fd protoreflect.FieldDescriptor, m protoreflect.Map) interface{} {
+	if fd.MapKey().Kind() == protoreflect.StringKind {
+		out := make(map[string]interface{}, m.Len())
+		m.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			out[k.String()] = scalar(fd.MapValue(), v)
+			return true
+		})
+		return out
+	}
+	out := make(map[interface{}]interface{}, m.Len())
+	m.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		out[scalar(fd.MapKey(), k.Value())] = scalar(fd.MapValue(), v)
+		return true
+	})
+	return out
+}
+
+// scalar returns the native value of the single value of the field.
+func scalar(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return int(v.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return int(v.Uint())
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return v.Uint()
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float()
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BytesKind:
+		return v.Bytes()
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return message(v.Message())
+	}
+	return v.Interface()
+}
+
+// message returns the native value of the well-known type, or the message.
+func message(m protoreflect.Message) interface{} {
+	md := m.Descriptor()
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return time.Unix(get(m, "seconds").Int(), get(m, "nanos").Int()).UTC()
+	case "google.protobuf.Duration":
+		return time.Duration(get(m, "seconds").Int())*time.Second + time.Duration(get(m, "nanos").Int())
+	case "google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue", "google.protobuf.Int32Value",
+		"google.protobuf.Int64Value", "google.protobuf.UInt32Value",
+		"google.protobuf.UInt64Value", "google.protobuf.FloatValue",
+		"google.protobuf.DoubleValue":
+		fd := md.Fields().ByName("value")
+		return scalar(fd, m.Get(fd))
+	case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue":
+		return structValue(m)
+	}
+	return &Message{m: m}
+}
+
+func get(m protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+	return m.Get(m.Descriptor().Fields().ByName(name))
+}
+
+// structValue converts messages of struct.proto, which may be dynamic, by
+// their generated types.
+func structValue(m protoreflect.Message) interface{} {
+	b, err := proto.Marshal(m.Interface())
+	if err != nil {
+		return nil
+	}
+	switch m.Descriptor().FullName() {
+	case "google.protobuf.Struct":
+		var s structpb.Struct
+		if proto.Unmarshal(b, &s) != nil {
+			return nil
+		}
+		return s.AsMap()
+	case "google.protobuf.ListValue":
+		var l structpb.ListValue
+		if proto.Unmarshal(b, &l) != nil {
+			return nil
+		}
+		return l.AsSlice()
+	}
+	var v structpb.Value
+	if proto.Unmarshal(b, &v) != nil {
+		return nil
+	}
+	return v.AsInterface()
+}
+
+// Types returns variables of the message for type checks of expressions run
+// with Wrap, by names of the proto file and JSON names. Messages are of any
+// type, except for well-known types.
+func Types(m proto.Message) map[string]interface{} {
+	fields := m.ProtoReflect().Descriptor().Fields()
+	types := make(map[string]interface{}, 2*fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		t := zero(fd)
+		types[string(fd.Name())] = t
+		types[fd.JSONName()] = t
+	}
+	return types
+}
+
+// zero returns the zero value of the native type of the field, or nil for
+// values of any type.
+func zero(fd protoreflect.FieldDescriptor) interface{} {
+	switch {
+	case fd.IsList():
+		return []interface{}{}
+	case fd.IsMap():
+		if fd.MapKey().Kind() == protoreflect.StringKind {
+			return map[string]interface{}{}
+		}
+		return map[interface{}]interface{}{}
+	}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return false
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return uint64(0)
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return 0.0
+	case protoreflect.StringKind, protoreflect.EnumKind:
+		return ""
+	case protoreflect.BytesKind:
+		return []byte{}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		switch fd.Message().FullName() {
+		case "google.protobuf.Timestamp":
+			return time.Time{}
+		case "google.protobuf.Duration":
+			return time.Duration(0)
+		}
+		return nil
+	}
+	return 0
+}
@@ -0,0 +1,278 @@
+package exprproto_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var createdAt = time.Date(2023, 3, 5, 14, 7, 0, 0, time.UTC)
+
+// Order has fields of well-known types, like generated messages.
+type Order struct {
+	CreatedAt *timestamppb.Timestamp
+	DeletedAt *timestamppb.Timestamp
+	Timeout   *durationpb.Duration
+	Paid      *wrapperspb.BoolValue
+	Note      *wrapperspb.StringValue
+	Count     *wrapperspb.Int32Value
+	Total     *wrapperspb.DoubleValue
+	Discount  *wrapperspb.DoubleValue
+	Id        *wrapperspb.UInt64Value
+	Meta      *structpb.Struct
+	Items     *structpb.ListValue
+	Extra     *structpb.Value
+	Deadline  time.Time
+}
+
+func TestSupport(t *testing.T) {
+	meta, err := structpb.NewStruct(map[string]interface{}{"plan": "pro", "seats": 3})
+	require.NoError(t, err)
+	items, err := structpb.NewList([]interface{}{"a", 1})
+	require.NoError(t, err)
+
+	env := Order{
+		CreatedAt: timestamppb.New(createdAt),
+		Timeout:   durationpb.New(1500 * time.Millisecond),
+		Paid:      wrapperspb.Bool(true),
+		Note:      wrapperspb.String("gift"),
+		Count:     wrapperspb.Int32(3),
+		Total:     wrapperspb.Double(9.5),
+		Id:        wrapperspb.UInt64(7),
+		Meta:      meta,
+		Items:     items,
+		Extra:     structpb.NewBoolValue(true),
+		Deadline:  createdAt.Add(time.Hour),
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`CreatedAt.Year()`, 2023},
+		{`CreatedAt.Before(Deadline)`, true},
+		{`CreatedAt`, createdAt},
+		{`DeletedAt.IsZero()`, true},
+		{`Timeout.Seconds()`, 1.5},
+		{`Paid == true`, true},
+		{`Note + "!"`, "gift!"},
+		{`Count + 1`, 4},
+		{`Total * 2`, 19.0},
+		{`Discount == nil`, true},
+		{`Discount ?? 0.5`, 0.5},
+		{`Id == 7`, true},
+		{`Meta.plan`, "pro"},
+		{`Meta.seats`, 3.0},
+		{`Items[0]`, "a"},
+		{`len(Items)`, 2},
+		{`Extra`, true},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(Order{}), exprproto.Support())
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+}
+
+// user returns the dynamic message of user.proto, which descriptor is built
+// at runtime, like descriptors of schema registries:
+//
+//	enum Status { UNKNOWN = 0; ACTIVE = 1; }
+//	message User {
+//	  int64 user_id = 1;
+//	  string name = 2;
+//	  Status status = 3;
+//	  google.protobuf.Timestamp created_at = 4;
+//	  google.protobuf.Duration timeout = 5;
+//	  google.protobuf.DoubleValue score = 6;
+//	  repeated string tags = 7;
+//	  map<string, string> labels = 8;
+//	  map<int32, int64> counts = 9;
+//	  google.protobuf.Struct meta = 10;
+//	  User manager = 11;
+//	  google.protobuf.Timestamp deleted_at = 12;
+//	  uint64 id = 13;
+//	}
+func user(t *testing.T) *dynamicpb.Message {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			fd.TypeName = proto.String(typeName)
+		}
+		return fd
+	}
+	repeated := func(fd *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		fd.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return fd
+	}
+	entry := func(name string, key, value descriptorpb.FieldDescriptorProto_Type) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name:    proto.String(name),
+			Field:   []*descriptorpb.FieldDescriptorProto{field("key", 1, key, ""), field("value", 2, value, "")},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+	}
+	const (
+		message = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		str     = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	)
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("user.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		Dependency: []string{
+			"google/protobuf/timestamp.proto",
+			"google/protobuf/duration.proto",
+			"google/protobuf/wrappers.proto",
+			"google/protobuf/struct.proto",
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("user_id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				field("name", 2, str, ""),
+				field("status", 3, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+				field("created_at", 4, message, ".google.protobuf.Timestamp"),
+				field("timeout", 5, message, ".google.protobuf.Duration"),
+				field("score", 6, message, ".google.protobuf.DoubleValue"),
+				repeated(field("tags", 7, str, "")),
+				repeated(field("labels", 8, message, ".test.User.LabelsEntry")),
+				repeated(field("counts", 9, message, ".test.User.CountsEntry")),
+				field("meta", 10, message, ".google.protobuf.Struct"),
+				field("manager", 11, message, ".test.User"),
+				field("deleted_at", 12, message, ".google.protobuf.Timestamp"),
+				field("id", 13, descriptorpb.FieldDescriptorProto_TYPE_UINT64, ""),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				entry("LabelsEntry", str, str),
+				entry("CountsEntry", descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+			},
+		}},
+	}
+	file, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	md := file.Messages().ByName("User")
+	fields := md.Fields()
+
+	meta, err := structpb.NewStruct(map[string]interface{}{"plan": "pro"})
+	require.NoError(t, err)
+
+	manager := dynamicpb.NewMessage(md)
+	manager.Set(fields.ByName("name"), protoreflect.ValueOfString("Jane"))
+
+	m := dynamicpb.NewMessage(md)
+	m.Set(fields.ByName("user_id"), protoreflect.ValueOfInt64(42))
+	m.Set(fields.ByName("name"), protoreflect.ValueOfString("John"))
+	m.Set(fields.ByName("status"), protoreflect.ValueOfEnum(1))
+	m.Set(fields.ByName("created_at"), protoreflect.ValueOfMessage(timestamppb.New(createdAt).ProtoReflect()))
+	m.Set(fields.ByName("timeout"), protoreflect.ValueOfMessage(durationpb.New(1500*time.Millisecond).ProtoReflect()))
+	m.Set(fields.ByName("score"), protoreflect.ValueOfMessage(wrapperspb.Double(0.75).ProtoReflect()))
+	tags := m.Mutable(fields.ByName("tags")).List()
+	tags.Append(protoreflect.ValueOfString("a"))
+	tags.Append(protoreflect.ValueOfString("b"))
+	labels := m.Mutable(fields.ByName("labels")).Map()
+	labels.Set(protoreflect.ValueOfString("team").MapKey(), protoreflect.ValueOfString("core"))
+	counts := m.Mutable(fields.ByName("counts")).Map()
+	counts.Set(protoreflect.ValueOfInt32(1).MapKey(), protoreflect.ValueOfInt64(10))
+	m.Set(fields.ByName("meta"), protoreflect.ValueOfMessage(meta.ProtoReflect()))
+	m.Set(fields.ByName("manager"), protoreflect.ValueOfMessage(manager))
+	m.Set(fields.ByName("id"), protoreflect.ValueOfUint64(7))
+	return m
+}
+
+func TestWrap(t *testing.T) {
+	m := user(t)
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`user_id`, 42},
+		{`userId == user_id`, true},
+		{`name`, "John"},
+		{`status`, "ACTIVE"},
+		{`created_at`, createdAt},
+		{`createdAt.Year()`, 2023},
+		{`deleted_at.IsZero()`, true},
+		{`timeout.Seconds()`, 1.5},
+		{`score`, 0.75},
+		{`tags`, []interface{}{"a", "b"}},
+		{`"b" in tags`, true},
+		{`labels.team`, "core"},
+		{`counts[1]`, 10},
+		{`meta.plan`, "pro"},
+		{`manager.name`, "Jane"},
+		{`manager.user_id`, 0},
+		{`manager.manager == nil`, true},
+		{`manager.tags`, []interface{}{}},
+		{`id`, uint64(7)},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(exprproto.Types(m)))
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, exprproto.Wrap(m))
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+
+	assert.Equal(t, m, exprproto.Wrap(m).Interface())
+}
+
+func TestWrap_errors(t *testing.T) {
+	m := user(t)
+
+	_, err := expr.Compile(`missing`, expr.Env(exprproto.Types(m)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown name missing")
+
+	program, err := expr.Compile(`manager.missing`)
+	require.NoError(t, err)
+	_, err = expr.Run(program, exprproto.Wrap(m))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "message test.User has no field missing")
+}
+
+func TestTypes(t *testing.T) {
+	types := exprproto.Types(user(t))
+	assert.Equal(t, 0, types["user_id"])
+	assert.Equal(t, 0, types["userId"])
+	assert.Equal(t, "", types["status"])
+	assert.Equal(t, time.Time{}, types["created_at"])
+	assert.Equal(t, time.Duration(0), types["timeout"])
+	assert.Nil(t, types["score"])
+	assert.Equal(t, []interface{}{}, types["tags"])
+	assert.Equal(t, map[string]interface{}{}, types["labels"])
+	assert.Equal(t, map[interface{}]interface{}{}, types["counts"])
+	assert.Equal(t, uint64(0), types["id"])
+}
@@ -0,0 +1,238 @@
+package exprtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr"
+)
+
+// Entry of a corpus of stored expressions, with an environment and the
+// result or the error of the expression, recorded with an earlier release.
+// Corpora are files of entries in JSON, one per line:
+//
+//	{"id": "adult", "expression": "user.Age >= 18", "env": {"user": {"Age": 30}}, "want": true, "type": "bool"}
+type Entry struct {
+	ID         string      `json:"id,omitempty"`
+	Expression string      `json:"expression"`
+	Env        interface{} `json:"env,omitempty"`
+	Want       interface{} `json:"want,omitempty"`
+	// Type of the result, like int or []interface {}, compared if not empty,
+	// as results of different types may be equal in JSON.
+	Type string `json:"type,omitempty"`
+	// Error of compilation or evaluation. Entries with errors have no
+	// result.
+	Error string `json:"error,omitempty"`
+}
+
+func (e Entry) name() string {
+	if e.ID != "" {
+		return e.ID
+	}
+	return e.Expression
+}
+
+// ReadCorpus reads entries in JSON, one per line. Whole numbers are decoded
+// as integers.
+func ReadCorpus(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		e.Env = integers(e.Env)
+		e.Want = integers(e.Want)
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// WriteCorpus writes entries in JSON, one per line.
+func WriteCorpus(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil {
+			return fmt.Errorf("%v: %v", e.name(), err)
+		}
+	}
+	return nil
+}
+
+// integers converts whole floats of decoded JSON to integers, like
+// environments read by the expr command.
+func integers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = integers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = integers(value)
+		}
+	}
+	return v
+}
+
+// Record returns entries with results and errors of expressions, evaluated
+// by the current build. Expressions are compiled with options, after the
+// environment of the entry.
+func Record(entries []Entry, options ...expr.Option) []Entry {
+	recorded := make([]Entry, len(entries))
+	for i, e := range entries {
+		got, err := evaluate(e, options)
+		e.Want, e.Type, e.Error = nil, "", ""
+		if err != nil {
+			e.Error = err.Error()
+		} else {
+			e.Want, e.Type = got, fmt.Sprintf("%T", got)
+		}
+		recorded[i] = e
+	}
+	return recorded
+}
+
+func evaluate(e Entry, options []expr.Option) (interface{}, error) {
+	var ops []expr.Option
+	if e.Env != nil {
+		ops = append(ops, expr.Env(e.Env))
+	}
+	program, err := expr.Compile(e.Expression, append(ops, options...)...)
+	if err != nil {
+		return nil, err
+	}
+	return expr.Run(program, e.Env)
+}
+
+// Kinds of differences of behavior.
+const (
+	// DiffResult is a different result.
+	DiffResult = "result"
+	// DiffType is an equal result of a different type, like 1.0 for 1.
+	DiffType = "type"
+	// DiffError is an error for a result, or a result for an error.
+	DiffError = "error"
+	// DiffMessage is a different message of an error.
+	DiffMessage = "message"
+)
+
+// Diff is a difference of behavior of the current build from the entry.
+type Diff struct {
+	Kind  string
+	Entry Entry
+	Got   interface{}
+	// GotType is the type of Got, if there is no error.
+	GotType  string
+	GotError string
+}
+
+func (d *Diff) String() string {
+	want := fmt.Sprintf("%v (%v)", format(d.Entry.Want), d.Entry.Type)
+	if d.Entry.Type == "" {
+		want = format(d.Entry.Want)
+	}
+	if d.Entry.Error != "" {
+		want = "error " + firstLine(d.Entry.Error)
+	}
+	got := fmt.Sprintf("%v (%v)", format(d.Got), d.GotType)
+	if d.GotError != "" {
+		got = "error " + firstLine(d.GotError)
+	}
+	return fmt.Sprintf("%v: %v: want %v, got %v", d.Entry.name(), d.Kind, want, got)
+}
+
+// firstLine returns the message of errors with snippets of sources.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// Report of replays of a corpus.
+type Report struct {
+	// Entries is the number of replayed entries.
+	Entries int
+	Diffs   []*Diff
+}
+
+// Kinds returns numbers of differences by kinds.
+func (r *Report) Kinds() map[string]int {
+	kinds := make(map[string]int)
+	for _, d := range r.Diffs {
+		kinds[d.Kind]++
+	}
+	return kinds
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v of %v entries differ", len(r.Diffs), r.Entries)
+	kinds := r.Kinds()
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+	for i, kind := range names {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%v %v", kinds[kind], kind)
+	}
+	b.WriteString("\n")
+	for _, d := range r.Diffs {
+		fmt.Fprintf(&b, "  %v\n", d)
+	}
+	return b.String()
+}
+
+// Replay evaluates expressions of entries with the current build, and
+// reports differences from recorded results and errors. Results are equal
+// by Equal, and of the same type, if the type is recorded. Messages of
+// errors are compared by their first lines, without snippets of sources.
+func Replay(entries []Entry, options ...expr.Option) *Report {
+	report := &Report{Entries: len(entries)}
+	for _, e := range entries {
+		got, err := evaluate(e, options)
+		d := &Diff{Entry: e}
+		if err != nil {
+			d.GotError = err.Error()
+		} else {
+			d.Got, d.GotType = got, fmt.Sprintf("%T", got)
+		}
+		switch {
+		case (e.Error != "") != (err != nil):
+			d.Kind = DiffError
+		case err != nil && firstLine(e.Error) != firstLine(err.Error()):
+			d.Kind = DiffMessage
+		case err != nil:
+		case !Equal(e.Want, got):
+			d.Kind = DiffResult
+		case e.Type != "" && e.Type != d.GotType:
+			d.Kind = DiffType
+		}
+		if d.Kind != "" {
+			report.Diffs = append(report.Diffs, d)
+		}
+	}
+	return report
+}
@@ -0,0 +1,58 @@
+package exprtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	entries, err := ReadCorpus(strings.NewReader(`
+{"id": "sum", "expression": "a + b", "env": {"a": 1, "b": 2}, "want": 3, "type": "int"}
+{"expression": "a + b", "env": {"a": 1, "b": 2}, "want": 3, "type": "float64"}
+{"id": "ratio", "expression": "a / b", "env": {"a": 1, "b": 2}, "want": 0.25}
+{"id": "fails", "expression": "a.b", "env": {"a": 1}, "want": 1}
+{"id": "passes", "expression": "a", "env": {"a": 1}, "error": "cannot fetch a"}
+{"id": "message", "expression": "a +", "error": "unexpected token EOF (1:4)\n | a +"}
+{"id": "same", "expression": "a", "error": "cannot fetch a from <nil> (1:1)\n | a"}
+`))
+	require.NoError(t, err)
+	require.Equal(t, 2, entries[0].Env.(map[string]interface{})["b"])
+
+	report := Replay(entries, expr.Optimize(false))
+	require.Equal(t, 7, report.Entries)
+	require.Equal(t, map[string]int{DiffType: 1, DiffResult: 1, DiffError: 2, DiffMessage: 1}, report.Kinds())
+
+	var diffs []string
+	for _, d := range report.Diffs {
+		diffs = append(diffs, d.String())
+	}
+	require.Equal(t, []string{
+		"a + b: type: want 3 (float64), got 3 (int)",
+		"ratio: result: want 0.25, got 0.5 (float64)",
+		`fails: error: want 1, got error type int[string] is undefined (1:3)`,
+		"passes: error: want error cannot fetch a, got 1 (int)",
+		"message: message: want error unexpected token EOF (1:4), got error unexpected token EOF (1:3)",
+	}, diffs)
+	require.True(t, strings.HasPrefix(report.String(), "5 of 7 entries differ: 2 error, 1 message, 1 result, 1 type\n  a + b: type"))
+}
+
+func TestRecord(t *testing.T) {
+	entries := Record([]Entry{
+		{ID: "sum", Expression: "a + b", Env: map[string]interface{}{"a": 1, "b": 2}, Want: 4, Error: "old"},
+		{ID: "fails", Expression: "1 +"},
+	})
+	require.Equal(t, 3, entries[0].Want)
+	require.Equal(t, "int", entries[0].Type)
+	require.Equal(t, "", entries[0].Error)
+	require.Contains(t, entries[1].Error, "unexpected token EOF")
+
+	var b bytes.Buffer
+	require.NoError(t, WriteCorpus(&b, entries))
+	read, err := ReadCorpus(&b)
+	require.NoError(t, err)
+	require.Empty(t, Replay(read).Diffs)
+}
@@ -0,0 +1,166 @@
+// Package exprtest runs table-driven tests of expressions: cases give an
+// environment and the expected result or error, results may be compared
+// with golden files, and coverage reports branches of the expression, which
+// no case has reached.
+//
+// Suites are declared in Go or loaded from YAML or JSON files next to
+// stored expressions:
+//
+//	file: adult.expr
+//	cases:
+//	  - name: adult
+//	    env: {user: {Age: 30}}
+//	    want: true
+//	  - name: no user
+//	    env: {}
+//	    error: cannot fetch Age
+package exprtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/coverage"
+	"gopkg.in/yaml.v3"
+)
+
+// Case of a test of an expression.
+type Case struct {
+	Name string `yaml:"name"`
+	// Env is the environment of the run.
+	Env interface{} `yaml:"env"`
+	// Want is the expected result, compared by value, so numbers of
+	// different types are equal, like 1 and 1.0.
+	Want interface{} `yaml:"want"`
+	// Error is a part of the expected error. Cases with errors have no
+	// result.
+	Error string `yaml:"error"`
+	// Golden is a file with the expected result in JSON, which is written
+	// instead, if tests run with -exprtest.update.
+	Golden string `yaml:"golden"`
+}
+
+// Suite of cases of an expression.
+type Suite struct {
+	Expression string `yaml:"expression"`
+	// File with the expression, relative to the file of the suite.
+	File  string `yaml:"file"`
+	Cases []Case `yaml:"cases"`
+	// Options of compilation, like expr.Env for types of the environment.
+	Options []expr.Option `yaml:"-"`
+}
+
+// Load reads suite from YAML or JSON file. Expression of the suite is read
+// from its file, and golden files are relative to the suite.
+func Load(path string) (*Suite, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Suite
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	if s.File != "" {
+		s.File = filepath.Join(dir, s.File)
+		b, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return nil, err
+		}
+		s.Expression = string(b)
+	}
+	for i := range s.Cases {
+		if s.Cases[i].Name == "" {
+			s.Cases[i].Name = fmt.Sprintf("case %d", i+1)
+		}
+		if g := s.Cases[i].Golden; g != "" && !filepath.IsAbs(g) {
+			s.Cases[i].Golden = filepath.Join(dir, g)
+		}
+	}
+	return &s, nil
+}
+
+// Test runs cases of the suite as subtests of t, and returns coverage of
+// the expression by all cases.
+func (s *Suite) Test(t *testing.T) *coverage.Coverage {
+	t.Helper()
+	program, err := expr.Compile(s.Expression, s.Options...)
+	if err != nil {
+		t.Fatalf("%v", err)
+		return nil
+	}
+	cover := coverage.New(program)
+	for _, c := range s.Cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if err := run(c, cover, *update); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	return cover
+}
+
+// run returns an error, if the case fails. Golden files are written, if
+// update is true.
+func run(c Case, cover *coverage.Coverage, update bool) error {
+	got, err := cover.Run(c.Env)
+	switch {
+	case c.Error != "" && err == nil:
+		return fmt.Errorf("want error %q, got %v", c.Error, format(got))
+	case c.Error != "" && !strings.Contains(err.Error(), c.Error):
+		return fmt.Errorf("want error %q, got %v", c.Error, err)
+	case c.Error != "":
+		return nil
+	case err != nil:
+		return fmt.Errorf("unexpected error: %v", err)
+	case c.Golden != "":
+		return golden(c.Golden, got, update)
+	case !Equal(c.Want, got):
+		return fmt.Errorf("want %v, got %v", format(c.Want), format(got))
+	}
+	return nil
+}
+
+// Equal reports whether results are deeply equal, or equal in JSON, so that
+// results decoded from YAML or JSON are equal to results of the same value
+// of other types.
+func Equal(want, got interface{}) bool {
+	if reflect.DeepEqual(want, got) {
+		return true
+	}
+	w, err := normalize(want)
+	if err != nil {
+		return false
+	}
+	g, err := normalize(got)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(w, g)
+}
+
+func normalize(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n interface{}
+	err = json.Unmarshal(b, &n)
+	return n, err
+}
+
+func format(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%#v", v)
+	}
+	return string(b)
+}
@@ -0,0 +1,76 @@
+package exprtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/coverage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	s, err := Load("testdata/discount.yaml")
+	require.NoError(t, err)
+	require.Contains(t, s.Expression, "user.Premium")
+	require.Len(t, s.Cases, 4)
+	require.Equal(t, "premium", s.Cases[0].Name)
+
+	coverage := s.Test(t)
+	require.Equal(t, 100.0, coverage.Percent(), coverage.String())
+}
+
+func TestLoad_golden(t *testing.T) {
+	s, err := Load("testdata/tags.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "case 1", s.Cases[0].Name)
+	require.Equal(t, filepath.Join("testdata", "tags.golden"), s.Cases[0].Golden)
+	s.Test(t)
+}
+
+func TestSuite_Test(t *testing.T) {
+	s := &Suite{
+		Expression: `a + b`,
+		Options:    []expr.Option{expr.Env(map[string]interface{}{"a": 0, "b": 0})},
+		Cases: []Case{
+			{Name: "ints", Env: map[string]interface{}{"a": 1, "b": 2}, Want: 3},
+			{Name: "floats", Env: map[string]interface{}{"a": 1, "b": 2}, Want: 3.0},
+		},
+	}
+	coverage := s.Test(t)
+	require.Empty(t, coverage.Branches)
+	require.Equal(t, "100.0% of 0 branches", coverage.String())
+}
+
+func TestRun_failures(t *testing.T) {
+	program, err := expr.Compile(`a % b`)
+	require.NoError(t, err)
+	cover := coverage.New(program)
+	env := map[string]interface{}{"a": 1, "b": 0}
+
+	err = run(Case{Env: map[string]interface{}{"a": 5, "b": 2}, Want: 3}, cover, false)
+	require.EqualError(t, err, "want 3, got 1")
+
+	err = run(Case{Env: env, Want: 1}, cover, false)
+	require.Contains(t, err.Error(), "unexpected error: runtime error: integer divide by zero")
+
+	err = run(Case{Env: env, Error: "divide"}, cover, false)
+	require.NoError(t, err)
+
+	err = run(Case{Env: env, Error: "overflow"}, cover, false)
+	require.Contains(t, err.Error(), `want error "overflow", got runtime error: integer divide by zero`)
+
+	err = run(Case{Env: map[string]interface{}{"a": 5, "b": 2}, Error: "divide"}, cover, false)
+	require.EqualError(t, err, `want error "divide", got 1`)
+
+	err = run(Case{Env: map[string]interface{}{"a": 5, "b": 2}, Golden: "testdata/missing.golden"}, cover, false)
+	require.Contains(t, err.Error(), "golden file testdata/missing.golden does not exist")
+}
+
+func TestEqual(t *testing.T) {
+	require.True(t, Equal(1, 1.0))
+	require.True(t, Equal([]interface{}{"a"}, []string{"a"}))
+	require.True(t, Equal(map[string]interface{}{"a": 1}, map[string]int{"a": 1}))
+	require.False(t, Equal(1, "1"))
+	require.False(t, Equal(nil, false))
+}
@@ -0,0 +1,48 @@
+package exprtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("exprtest.update", false, "update golden files of expression tests")
+
+// Golden compares got in JSON with the golden file at path, or writes the
+// file, if tests run with -exprtest.update.
+func Golden(t *testing.T, path string, got interface{}) {
+	t.Helper()
+	if err := golden(path, got, *update); err != nil {
+		t.Error(err)
+	}
+}
+
+func golden(path string, got interface{}, update bool) error {
+	b, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, b, 0644)
+	}
+	want, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("golden file %v does not exist, run tests with -exprtest.update to create it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bytes.TrimSpace(want), bytes.TrimSpace(b)) {
+		return fmt.Errorf("result differs from golden file %v:\nwant %s\ngot  %s", path, bytes.TrimSpace(want), bytes.TrimSpace(b))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package exprtest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/coverage"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Mutant is the expression of a suite with one mutation, like >= replaced
+// by >, which some case of the suite should fail.
+type Mutant struct {
+	Location file.Location
+	// Original and Mutation are the mutated operator or constant, like ">="
+	// and ">".
+	Original, Mutation string
+	// Expression is the mutated expression.
+	Expression string
+	// KilledBy is the name of the first failed case, or empty, if the mutant
+	// survived all cases. Mutants, which do not compile, are killed by
+	// "compiler".
+	KilledBy string
+}
+
+// Killed reports whether a case of the suite failed with the mutant.
+func (m *Mutant) Killed() bool {
+	return m.KilledBy != ""
+}
+
+func (m *Mutant) String() string {
+	if m.Mutation == "" {
+		return fmt.Sprintf("%v:%v removed %v: %v", m.Location.Line, m.Location.Column+1, m.Original, m.Expression)
+	}
+	return fmt.Sprintf("%v:%v %v -> %v: %v", m.Location.Line, m.Location.Column+1, m.Original, m.Mutation, m.Expression)
+}
+
+// mutations of binary operators.
+var mutations = map[string][]string{
+	">=":  {">", "<"},
+	">":   {">=", "<="},
+	"<=":  {"<", ">"},
+	"<":   {"<=", ">="},
+	"==":  {"!="},
+	"!=":  {"=="},
+	"and": {"or"},
+	"&&":  {"||"},
+	"or":  {"and"},
+	"||":  {"&&"},
+	"+":   {"-"},
+	"-":   {"+"},
+	"*":   {"/"},
+	"/":   {"*"},
+	"%":   {"*"},
+}
+
+// mutation changes the node, and returns texts of the change.
+type mutation func(node *ast.Node) (original, mutation string)
+
+// mutationsOf returns mutations of the node: replaced binary operators,
+// removed negations, off-by-one numbers and inverted booleans.
+func mutationsOf(node ast.Node) []mutation {
+	var ms []mutation
+	switch n := node.(type) {
+	case *ast.BinaryNode:
+		for _, op := range mutations[n.Operator] {
+			op := op
+			ms = append(ms, func(node *ast.Node) (string, string) {
+				b := (*node).(*ast.BinaryNode)
+				original := b.Operator
+				b.Operator = op
+				return original, op
+			})
+		}
+	case *ast.UnaryNode:
+		if n.Operator == "not" || n.Operator == "!" {
+			ms = append(ms, func(node *ast.Node) (string, string) {
+				u := (*node).(*ast.UnaryNode)
+				*node = u.Node
+				return u.Operator, ""
+			})
+		}
+	case *ast.IntegerNode:
+		for _, delta := range []int{1, -1} {
+			delta := delta
+			ms = append(ms, func(node *ast.Node) (string, string) {
+				i := (*node).(*ast.IntegerNode)
+				original := i.Value
+				i.Value += delta
+				return strconv.Itoa(original), strconv.Itoa(i.Value)
+			})
+		}
+	case *ast.FloatNode:
+		for _, delta := range []float64{1, -1} {
+			delta := delta
+			ms = append(ms, func(node *ast.Node) (string, string) {
+				f := (*node).(*ast.FloatNode)
+				original := parser.Format(f)
+				f.Value += delta
+				return original, parser.Format(f)
+			})
+		}
+	case *ast.BoolNode:
+		ms = append(ms, func(node *ast.Node) (string, string) {
+			b := (*node).(*ast.BoolNode)
+			original := parser.Format(b)
+			b.Value = !b.Value
+			return original, parser.Format(b)
+		})
+	}
+	return ms
+}
+
+// visitor calls fn for every node, children before parents.
+type visitor func(node *ast.Node)
+
+func (v visitor) Visit(node *ast.Node) {
+	v(node)
+}
+
+// Mutants returns mutants of the expression of the suite, in order of
+// source.
+func (s *Suite) Mutants() ([]*Mutant, error) {
+	config := conf.CreateNew()
+	for _, op := range s.Options {
+		op(config)
+	}
+	tree, err := parser.ParseWithOptions(s.Expression, config.ParserOptions())
+	if err != nil {
+		return nil, err
+	}
+	var mutants []*Mutant
+	var count []int // mutations of nodes, in order of walk
+	ast.Walk(&tree.Node, visitor(func(node *ast.Node) {
+		count = append(count, len(mutationsOf(*node)))
+	}))
+	for i, n := range count {
+		for j := 0; j < n; j++ {
+			// Every mutant is made from a new tree, as mutations change
+			// nodes in place.
+			tree, err := parser.ParseWithOptions(s.Expression, config.ParserOptions())
+			if err != nil {
+				return nil, err
+			}
+			k := 0
+			var mutant *Mutant
+			ast.Walk(&tree.Node, visitor(func(node *ast.Node) {
+				if k == i {
+					loc := (*node).Location()
+					original, mutation := mutationsOf(*node)[j](node)
+					mutant = &Mutant{Location: loc, Original: original, Mutation: mutation}
+				}
+				k++
+			}))
+			mutant.Expression = parser.Format(tree.Node)
+			mutants = append(mutants, mutant)
+		}
+	}
+	sort.SliceStable(mutants, func(i, j int) bool {
+		a, b := mutants[i].Location, mutants[j].Location
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return mutants, nil
+}
+
+// Mutate runs cases of the suite with every mutant of its expression, and
+// returns mutants, which are killed or survived.
+func (s *Suite) Mutate() ([]*Mutant, error) {
+	mutants, err := s.Mutants()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mutants {
+		program, err := expr.Compile(m.Expression, s.Options...)
+		if err != nil {
+			m.KilledBy = "compiler"
+			continue
+		}
+		cover := coverage.New(program)
+		for _, c := range s.Cases {
+			if err := run(c, cover, false); err != nil {
+				m.KilledBy = c.Name
+				break
+			}
+		}
+	}
+	return mutants, nil
+}
+
+// TestMutants fails t for every mutant, which survives all cases of the
+// suite.
+func (s *Suite) TestMutants(t *testing.T) {
+	t.Helper()
+	mutants, err := s.Mutate()
+	if err != nil {
+		t.Fatalf("%v", err)
+		return
+	}
+	for _, m := range mutants {
+		if !m.Killed() {
+			t.Errorf("mutant survived %v", m)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package exprtest_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/exprtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuite_Mutants(t *testing.T) {
+	s := &exprtest.Suite{Expression: `age >= 18 and not banned`}
+	mutants, err := s.Mutants()
+	require.NoError(t, err)
+	var got []string
+	for _, m := range mutants {
+		got = append(got, m.String())
+	}
+	require.Equal(t, []string{
+		"1:5 >= -> >: age > 18 and not banned",
+		"1:5 >= -> <: age < 18 and not banned",
+		"1:8 18 -> 19: age >= 19 and not banned",
+		"1:8 18 -> 17: age >= 17 and not banned",
+		"1:11 and -> or: age >= 18 or not banned",
+		"1:15 removed not: age >= 18 and banned",
+	}, got)
+}
+
+func TestSuite_Mutate(t *testing.T) {
+	s := &exprtest.Suite{
+		Expression: `age >= 18 and not banned`,
+		Cases: []exprtest.Case{
+			{Name: "adult", Env: map[string]interface{}{"age": 30, "banned": false}, Want: true},
+			{Name: "banned", Env: map[string]interface{}{"age": 30, "banned": true}, Want: false},
+			{Name: "minor", Env: map[string]interface{}{"age": 10, "banned": false}, Want: false},
+		},
+	}
+	mutants, err := s.Mutate()
+	require.NoError(t, err)
+	killed := make(map[string]string)
+	var survived []string
+	for _, m := range mutants {
+		if m.Killed() {
+			killed[m.Original+" -> "+m.Mutation] = m.KilledBy
+		} else {
+			survived = append(survived, m.Expression)
+		}
+	}
+	require.Equal(t, "banned", killed["and -> or"])
+	require.Equal(t, "adult", killed["not -> "])
+	require.Equal(t, "adult", killed[">= -> <"])
+	// Boundary of age is not tested.
+	require.Equal(t, []string{"age > 18 and not banned", "age >= 19 and not banned", "age >= 17 and not banned"}, survived)
+
+	s.Cases = append(s.Cases,
+		exprtest.Case{Name: "18", Env: map[string]interface{}{"age": 18, "banned": false}, Want: true},
+		exprtest.Case{Name: "17", Env: map[string]interface{}{"age": 17, "banned": false}, Want: false},
+	)
+	s.TestMutants(t)
+}
+
+func TestSuite_Mutate_compiler(t *testing.T) {
+	s := &exprtest.Suite{
+		Expression: `name + "!"`,
+		Options:    []expr.Option{expr.Env(map[string]interface{}{"name": ""})},
+	}
+	mutants, err := s.Mutate()
+	require.NoError(t, err)
+	require.Len(t, mutants, 1)
+	require.Equal(t, `name - "!"`, mutants[0].Expression)
+	require.Equal(t, "compiler", mutants[0].KilledBy)
+}
@@ -8,15 +8,44 @@ import (
 
 type Error struct {
 	Location
+	// End of the span of the error, exclusive, if known. Otherwise, the
+	// span is the token at the location.
+	End     Location `json:"-"`
 	Message string
 	Snippet string
+	// Template and Args of the message, if known, used for translation.
+	Template string        `json:"-"`
+	Args     []interface{} `json:"-"`
+
+	source *Source
+}
+
+// Errorf creates an error at the location.
+func Errorf(loc Location, format string, args ...interface{}) *Error {
+	return &Error{
+		Location: loc,
+		Message:  fmt.Sprintf(format, args...),
+		Template: format,
+		Args:     args,
+	}
 }
 
 func (e *Error) Error() string {
 	return e.format()
 }
 
+// Translate replaces the message with one returned by the translator.
+func (e *Error) Translate(t Translator) *Error {
+	if e.Template != "" {
+		e.Message = t(e.Template, e.Args...)
+	} else {
+		e.Message = t(e.Message)
+	}
+	return e
+}
+
 func (e *Error) Bind(source *Source) *Error {
+	e.source = source
 	if snippet, found := source.Snippet(e.Location.Line); found {
 		snippet := strings.Replace(snippet, "\t", " ", -1)
 		srcLine := "\n | " + snippet
@@ -0,0 +1,50 @@
+package file
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestError_Render(t *testing.T) {
+	source := NewSource("foo == 1\nbar contains \"baz\"")
+
+	e := Errorf(Location{Line: 2, Column: 13}, "unknown %v", "string").Bind(source)
+	assert.Equal(t, "error: unknown string\n --> 2:14\n  |\n2 | bar contains \"baz\"\n  |              ^^^^^", e.Render(false))
+	assert.Equal(t, e.Render(false), fmt.Sprintf("%+v", e))
+	assert.Equal(t, e.Error(), fmt.Sprintf("%v", e))
+
+	e = Errorf(Location{Line: 1, Column: 4}, "bad operator").Bind(source)
+	assert.Equal(t, "error: bad operator\n --> 1:5\n  |\n1 | foo == 1\n  |     ^^", e.Render(false))
+	assert.Equal(t, "\x1b[1;31merror\x1b[0m: bad operator\n \x1b[1;34m-->\x1b[0m 1:5\n\x1b[1;34m  |\x1b[0m\n\x1b[1;34m1 | \x1b[0mfoo == 1\n\x1b[1;34m  | \x1b[0m    \x1b[1;31m^^\x1b[0m", e.Render(true))
+
+	e = Errorf(Location{Line: 1, Column: 8}, "unexpected end").Bind(source)
+	assert.Equal(t, "error: unexpected end\n --> 1:9\n  |\n1 | foo == 1\n  |         ^", e.Render(false))
+
+	e = Errorf(Location{Line: 2, Column: 0}, "forbidden").Bind(source)
+	e.End = Location{Line: 2, Column: 18}
+	assert.Equal(t, "error: forbidden\n --> 2:1\n  |\n2 | bar contains \"baz\"\n  | ^^^^^^^^^^^^^^^^^^", e.Render(false))
+
+	e = &Error{Message: "no location"}
+	assert.Equal(t, "error: no location", e.Render(false))
+}
+
+func TestError_JSON(t *testing.T) {
+	source := NewSource("foo == 1")
+
+	b, err := Errorf(Location{Line: 1, Column: 0}, "unknown name %v", "foo").Bind(source).JSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"message":"unknown name foo","line":1,"column":1,"endColumn":4,"source":"foo == 1"}`, string(b))
+
+	e := Errorf(Location{Line: 1, Column: 0}, "always true").Bind(source)
+	e.End = Location{Line: 1, Column: 8}
+	b, err = e.JSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"message":"always true","line":1,"column":1,"endColumn":9,"source":"foo == 1"}`, string(b))
+
+	b, err = (&Error{Message: "no location"}).JSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"message":"no location"}`, string(b))
+}
@@ -0,0 +1,150 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorError = "\x1b[1;31m"
+	colorFrame = "\x1b[1;34m"
+)
+
+// Format implements fmt.Formatter. The %+v verb renders the error the same
+// way as Render without colors, other verbs print the message of Error.
+func (e *Error) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		_, _ = fmt.Fprint(s, e.Render(false))
+	case verb == 'q':
+		_, _ = fmt.Fprintf(s, "%q", e.Error())
+	default:
+		_, _ = fmt.Fprint(s, e.Error())
+	}
+}
+
+// Render returns multi-line description of the error: the message, the
+// location, and the line of source with the erroneous token underlined.
+// Colors are ANSI escape sequences.
+func (e *Error) Render(color bool) string {
+	paint := func(c, s string) string {
+		if color {
+			return c + s + colorReset
+		}
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteString(paint(colorError, "error"))
+	b.WriteString(": ")
+	b.WriteString(e.Message)
+	if e.Location.Empty() {
+		return b.String()
+	}
+
+	line, ok := e.line()
+	gutter := strings.Repeat(" ", len(strconv.Itoa(e.Line)))
+	fmt.Fprintf(&b, "\n%v%v %d:%d", gutter, paint(colorFrame, "-->"), e.Line, e.Column+1)
+	if !ok {
+		return b.String()
+	}
+
+	line = strings.Replace(line, "\t", " ", -1)
+	from, to := e.span(line)
+	fmt.Fprintf(&b, "\n%v\n%v%v",
+		paint(colorFrame, gutter+" |"),
+		paint(colorFrame, strconv.Itoa(e.Line)+" | "),
+		line,
+	)
+	fmt.Fprintf(&b, "\n%v%v%v",
+		paint(colorFrame, gutter+" | "),
+		strings.Repeat(" ", from),
+		paint(colorError, strings.Repeat("^", to-from)),
+	)
+	return b.String()
+}
+
+// JSON returns machine-readable form of the error. Its line and columns are
+// 1-based, and the span of the erroneous token is from column to endColumn,
+// exclusive.
+func (e *Error) JSON() ([]byte, error) {
+	d := struct {
+		Message   string `json:"message"`
+		Line      int    `json:"line,omitempty"`
+		Column    int    `json:"column,omitempty"`
+		EndColumn int    `json:"endColumn,omitempty"`
+		Source    string `json:"source,omitempty"`
+	}{
+		Message: e.Message,
+	}
+	if !e.Location.Empty() {
+		d.Line = e.Line
+		d.Column = e.Column + 1
+		d.EndColumn = e.Column + 2
+		if line, ok := e.line(); ok {
+			from, to := e.span(line)
+			d.Column, d.EndColumn = from+1, to+1
+			d.Source = line
+		}
+	}
+	return json.Marshal(d)
+}
+
+func (e *Error) line() (string, bool) {
+	if e.source == nil {
+		return "", false
+	}
+	return e.source.Snippet(e.Line)
+}
+
+// span returns columns of erroneous runes of the line: of the span of the
+// error, or of the token at the location.
+func (e *Error) span(line string) (int, int) {
+	if e.End.Line == e.Line && e.End.Column > e.Column && e.End.Column <= len([]rune(line)) {
+		return e.Column, e.End.Column
+	}
+	return Span(line, e.Column)
+}
+
+// Span returns runes of a token starting at column: an identifier or a
+// number, a string, an operator, or a single rune otherwise.
+func Span(line string, column int) (int, int) {
+	runes := []rune(line)
+	if column >= len(runes) {
+		return len(runes), len(runes) + 1
+	}
+	end := column + 1
+	switch r := runes[column]; {
+	case isWord(r):
+		for end < len(runes) && isWord(runes[end]) {
+			end++
+		}
+	case r == '"' || r == '\'' || r == '`':
+		for end < len(runes) && runes[end] != r {
+			if runes[end] == '\\' && r != '`' {
+				end++
+			}
+			end++
+		}
+		if end < len(runes) {
+			end++
+		} else {
+			end = len(runes)
+		}
+	case strings.ContainsRune(operators, r):
+		for end < len(runes) && strings.ContainsRune(operators, runes[end]) {
+			end++
+		}
+	}
+	return column, end
+}
+
+const operators = "=!<>&|*+-/%^?:."
+
+func isWord(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,23 @@
+package file
+
+import "fmt"
+
+// Translator returns message of the format and arguments, for example in
+// another language. Formats are English messages, like "unknown name %v".
+// Messages of unknown format are passed without arguments.
+type Translator func(format string, args ...interface{}) string
+
+// Catalog translates messages by replacing formats. Arguments of translated
+// formats may be reordered with explicit indexes, like "%[2]v". Formats
+// missing in the catalog are used as is.
+type Catalog map[string]string
+
+func (c Catalog) Translate(format string, args ...interface{}) string {
+	if translated, ok := c[format]; ok {
+		format = translated
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,187 @@
+package highlight
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	identStart = `[\p{L}_$]`
+	identPart  = `[\p{L}\p{N}_$]`
+	ident      = identStart + identPart + `*`
+	number     = `0[xX][0-9a-fA-F_]+|0[oO][0-7_]+|0[bB][01_]+|[0-9][0-9_]*(?:\.(?!\.)[0-9_]*)?(?:[eE][+-]?[0-9_]+)?`
+)
+
+// words returns regexp matching any of words, longest first.
+func words(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	sort.SliceStable(quoted, func(i, j int) bool {
+		return len(quoted[i]) > len(quoted[j])
+	})
+	return `(?:` + strings.Join(quoted, "|") + `)`
+}
+
+// whole returns regexp matching re only as a whole identifier.
+func whole(re string) string {
+	return `(?<!` + identPart + `)` + re + `(?!` + identPart + `)`
+}
+
+type textMateGrammar struct {
+	Name      string            `json:"name"`
+	ScopeName string            `json:"scopeName"`
+	FileTypes []string          `json:"fileTypes"`
+	Patterns  []textMatePattern `json:"patterns"`
+}
+
+type textMatePattern struct {
+	Name     string                     `json:"name,omitempty"`
+	Match    string                     `json:"match,omitempty"`
+	Begin    string                     `json:"begin,omitempty"`
+	End      string                     `json:"end,omitempty"`
+	Captures map[string]textMatePattern `json:"captures,omitempty"`
+	Patterns []textMatePattern          `json:"patterns,omitempty"`
+}
+
+func captures(names ...string) map[string]textMatePattern {
+	c := make(map[string]textMatePattern, len(names))
+	for i, name := range names {
+		c[string(rune('1'+i))] = textMatePattern{Name: name}
+	}
+	return c
+}
+
+// TextMate returns JSON of TextMate grammar with scope source.expr, used by
+// VS Code, Sublime Text and others.
+func TextMate() []byte {
+	escape := []textMatePattern{{Name: "constant.character.escape.expr", Match: `\\.`}}
+	patterns := []textMatePattern{
+		{Name: "string.quoted.double.expr", Begin: `"`, End: `"`, Patterns: escape},
+		{Name: "string.quoted.single.expr", Begin: `'`, End: `'`, Patterns: escape},
+		{Name: "constant.numeric.expr", Match: whole(`(?:` + number + `)`)},
+	}
+	namespaces := Namespaces()
+	for _, namespace := range sortedKeys(namespaces) {
+		patterns = append(patterns, textMatePattern{
+			Match:    whole(`(`+regexp.QuoteMeta(namespace)+`)`) + `\s*(\.)\s*(` + words(namespaces[namespace]) + `)(?!` + identPart + `)(?=\s*\()`,
+			Captures: captures("support.function.builtin.expr", "punctuation.accessor.expr", "support.function.builtin.expr"),
+		})
+	}
+	var keywords, constants []string
+	for _, k := range Keywords() {
+		if literals[k] {
+			constants = append(constants, k)
+		} else {
+			keywords = append(keywords, k)
+		}
+	}
+	patterns = append(patterns,
+		textMatePattern{Match: `(\?\.)\s*(` + ident + `)`, Captures: captures("keyword.operator.expr", "variable.other.member.expr")},
+		textMatePattern{Match: `(\.)\s*(` + ident + `)`, Captures: captures("punctuation.accessor.expr", "variable.other.member.expr")},
+		textMatePattern{Name: "keyword.operator.word.expr", Match: whole(words(keywords))},
+		textMatePattern{Name: "constant.language.expr", Match: whole(words(constants))},
+		textMatePattern{Name: "support.function.builtin.expr", Match: whole(words(Builtins())) + `(?=\s*\()`},
+		textMatePattern{Name: "variable.other.expr", Match: ident},
+		textMatePattern{Name: "variable.language.expr", Match: `#`},
+		textMatePattern{Name: "keyword.operator.expr", Match: words(Operators())},
+		textMatePattern{Name: "punctuation.separator.expr", Match: `[,:]`},
+		textMatePattern{Name: "punctuation.accessor.expr", Match: `\.`},
+		textMatePattern{Name: "meta.brace.expr", Match: `[()\[\]{}]`},
+	)
+	return marshal(textMateGrammar{
+		Name:      "Expr",
+		ScopeName: "source.expr",
+		FileTypes: []string{"expr"},
+		Patterns:  patterns,
+	})
+}
+
+type monarchLanguage struct {
+	DefaultToken string                     `json:"defaultToken"`
+	TokenPostfix string                     `json:"tokenPostfix"`
+	Unicode      bool                       `json:"unicode"`
+	Keywords     []string                   `json:"keywords"`
+	Builtins     []string                   `json:"builtins"`
+	Brackets     []monarchBracket           `json:"brackets"`
+	Tokenizer    map[string][][]interface{} `json:"tokenizer"`
+}
+
+type monarchBracket struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+	Token string `json:"token"`
+}
+
+// Cases of Monarch are tested in order, so they are kept in raw JSON.
+const (
+	callCases  = `{"cases": {"@builtins": "predefined", "@keywords": "keyword", "@default": "identifier"}}`
+	identCases = `{"cases": {"@keywords": "keyword", "@default": "identifier"}}`
+)
+
+// Monarch returns JSON of Monarch language of Monaco editor. Tokens are
+// keyword, operator, string, number, identifier, predefined for builtins and
+// delimiter for punctuation.
+func Monarch() []byte {
+	root := [][]interface{}{
+		{`\s+`, "white"},
+		{`"(?:[^"\\]|\\.)*"`, "string"},
+		{`'(?:[^'\\]|\\.)*'`, "string"},
+		{`["'].*$`, "string.invalid"},
+		{`(?:` + number + `)`, "number"},
+	}
+	namespaces := Namespaces()
+	for _, namespace := range sortedKeys(namespaces) {
+		root = append(root, []interface{}{
+			`(` + regexp.QuoteMeta(namespace) + `)(\s*)(\.)(\s*)(` + words(namespaces[namespace]) + `)(?!` + identPart + `)(?=\s*\()`,
+			[]string{"predefined", "white", "delimiter", "white", "predefined"},
+		})
+	}
+	root = append(root,
+		[]interface{}{`(\?\.)(\s*)(` + ident + `)`, []string{"operator", "white", "identifier"}},
+		[]interface{}{`(\.)(\s*)(` + ident + `)`, []string{"delimiter", "white", "identifier"}},
+		[]interface{}{ident + `(?=\s*\()`, json.RawMessage(callCases)},
+		[]interface{}{ident, json.RawMessage(identCases)},
+		[]interface{}{`#`, "keyword"},
+		[]interface{}{`[()\[\]{}]`, "@brackets"},
+		[]interface{}{words(Operators()), "operator"},
+		[]interface{}{`[,:.]`, "delimiter"},
+	)
+	return marshal(monarchLanguage{
+		DefaultToken: "invalid",
+		TokenPostfix: ".expr",
+		Unicode:      true,
+		Keywords:     Keywords(),
+		Builtins:     Builtins(),
+		Brackets: []monarchBracket{
+			{Open: "(", Close: ")", Token: "delimiter.parenthesis"},
+			{Open: "[", Close: "]", Token: "delimiter.square"},
+			{Open: "{", Close: "}", Token: "delimiter.curly"},
+		},
+		Tokenizer: map[string][][]interface{}{"root": root},
+	})
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func marshal(v interface{}) []byte {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
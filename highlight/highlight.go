@@ -0,0 +1,223 @@
+// Package highlight classifies tokens of expressions for syntax highlighting
+// and generates grammars of editors from the same lexer and parser tables.
+package highlight
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/parser/lexer"
+)
+
+// Class of token. Values of classes are stable and may be used as names of
+// styles.
+type Class string
+
+const (
+	Keyword     Class = "keyword"     // word operators, true, false, nil and #
+	Operator    Class = "operator"    // operators, like + or ?.
+	String      Class = "string"      // quoted strings
+	Number      Class = "number"      // integer and float literals
+	Identifier  Class = "identifier"  // variables, fields and keys
+	Builtin     Class = "builtin"     // calls of builtins and their namespaces
+	Punctuation Class = "punctuation" // brackets, commas, colons and dots
+)
+
+// Token is a classified token of source.
+type Token struct {
+	Class Class  `json:"class"`
+	Text  string `json:"text"` // text of token in source
+	// From and To are byte offsets of the token in source.
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Tokens returns classified tokens of source, in order of source. Source
+// which does not lex is reported with an error.
+func Tokens(source string) ([]Token, error) {
+	lexed, err := lexer.Lex(file.NewSource(source))
+	if err != nil {
+		return nil, err
+	}
+	lines := []int{0} // byte offsets of lines
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+
+	builtins := make(map[string]bool)
+	for _, name := range Builtins() {
+		builtins[name] = true
+	}
+	for namespace, names := range Namespaces() {
+		for _, name := range names {
+			builtins[namespace+"."+name] = true
+		}
+	}
+
+	tokens := make([]Token, 0, len(lexed))
+	for i, t := range lexed {
+		if t.Kind == lexer.EOF {
+			break
+		}
+		from := offset(source, lines, t.Location)
+		to := from + len(t.Value)
+		if t.Kind == lexer.String {
+			to = closingQuote(source, from)
+		}
+		tokens = append(tokens, Token{
+			Class: classify(lexed, i, builtins),
+			Text:  source[from:to],
+			From:  from,
+			To:    to,
+		})
+	}
+	return tokens, nil
+}
+
+// offset converts location to offset in bytes.
+func offset(source string, lines []int, loc file.Location) int {
+	i := lines[loc.Line-1]
+	for column := 0; column < loc.Column && i < len(source); column++ {
+		_, w := utf8.DecodeRuneInString(source[i:])
+		i += w
+	}
+	return i
+}
+
+// closingQuote returns offset after the string starting at from.
+func closingQuote(source string, from int) int {
+	quote := source[from]
+	for i := from + 1; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(source)
+}
+
+// classify returns class of i-th token. Builtins are names of builtins,
+// including namespaced ones, like "strings.trim".
+func classify(tokens []lexer.Token, i int, builtins map[string]bool) Class {
+	t := tokens[i]
+	switch t.Kind {
+	case lexer.String:
+		return String
+	case lexer.Number:
+		return Number
+	case lexer.Bracket:
+		return Punctuation
+	case lexer.Operator:
+		switch {
+		case t.Value == "#":
+			return Keyword
+		case t.Value == "," || t.Value == ":" || t.Value == "." || t.Value == ";":
+			return Punctuation
+		case isWord(t.Value):
+			return Keyword
+		}
+		return Operator
+	}
+
+	if literals[t.Value] {
+		return Keyword
+	}
+	next := func(n int) lexer.Token {
+		if i+n < len(tokens) {
+			return tokens[i+n]
+		}
+		return lexer.Token{Kind: lexer.EOF}
+	}
+	prev := func(n int) lexer.Token {
+		if i-n >= 0 {
+			return tokens[i-n]
+		}
+		return lexer.Token{Kind: lexer.EOF}
+	}
+	call := next(1).Is(lexer.Bracket, "(")
+	if member := prev(1); member.Is(lexer.Operator, ".", "?.") {
+		namespace := prev(2)
+		if call && member.Value == "." && namespace.Kind == lexer.Identifier && builtins[namespace.Value+"."+t.Value] {
+			return Builtin
+		}
+		return Identifier
+	}
+	if call && builtins[t.Value] {
+		return Builtin
+	}
+	if next(1).Is(lexer.Operator, ".") && next(2).Kind == lexer.Identifier && next(3).Is(lexer.Bracket, "(") && builtins[t.Value+"."+next(2).Value] {
+		return Builtin
+	}
+	return Identifier
+}
+
+var literals = map[string]bool{"true": true, "false": true, "nil": true}
+
+func isWord(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Keywords returns word operators and literals, like "in" or "nil".
+func Keywords() []string {
+	keywords := []string{"false", "nil", "true"}
+	for _, op := range parser.Operators() {
+		if isWord(op) {
+			keywords = append(keywords, op)
+		}
+	}
+	sort.Strings(keywords)
+	return keywords
+}
+
+// Operators returns operators, which are not words, like "+" or "?.".
+func Operators() []string {
+	operators := []string{"?", "?."}
+	for _, op := range parser.Operators() {
+		if !isWord(op) {
+			operators = append(operators, op)
+		}
+	}
+	sort.Strings(operators)
+	return operators
+}
+
+// Builtins returns names of builtins, which are not in namespaces.
+func Builtins() []string {
+	names := parser.Builtins()
+	for _, b := range builtin.Builtins {
+		if !strings.Contains(b.Name, ".") {
+			names = append(names, b.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Namespaces returns names of builtins in namespaces, like "trim" of
+// "strings".
+func Namespaces() map[string][]string {
+	namespaces := make(map[string][]string)
+	for _, b := range builtin.Builtins {
+		if i := strings.Index(b.Name, "."); i >= 0 {
+			namespaces[b.Name[:i]] = append(namespaces[b.Name[:i]], b.Name[i+1:])
+		}
+	}
+	for _, names := range namespaces {
+		sort.Strings(names)
+	}
+	return namespaces
+}
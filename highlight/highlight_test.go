@@ -0,0 +1,106 @@
+package highlight_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/antonmedv/expr/highlight"
+	"github.com/antonmedv/expr/parser"
+	"github.com/stretchr/testify/require"
+)
+
+// classes returns tokens of source as text:class pairs.
+func classes(t *testing.T, source string) []string {
+	tokens, err := highlight.Tokens(source)
+	require.NoError(t, err)
+	pairs := []string{}
+	for _, token := range tokens {
+		require.Equal(t, token.Text, source[token.From:token.To])
+		pairs = append(pairs, token.Text+":"+string(token.Class))
+	}
+	return pairs
+}
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{`User.Age >= 18 and not User.Admin`, []string{"User:identifier", ".:punctuation", "Age:identifier", ">=:operator", "18:number", "and:keyword", "not:keyword", "User:identifier", ".:punctuation", "Admin:identifier"}},
+		{`len(Tags) > 0x1F`, []string{"len:builtin", "(:punctuation", "Tags:identifier", "):punctuation", ">:operator", "0x1F:number"}},
+		{`all(Users, {#.Age in 1..9})`, []string{"all:builtin", "(:punctuation", "Users:identifier", ",:punctuation", "{:punctuation", "#:keyword", ".:punctuation", "Age:identifier", "in:keyword", "1:number", "..:operator", "9:number", "}:punctuation", "):punctuation"}},
+		{`strings.trim(" ö ") == 'ö'`, []string{"strings:builtin", ".:punctuation", "trim:builtin", "(:punctuation", `" ö ":string`, "):punctuation", "==:operator", "'ö':string"}},
+		{`"a\"b" + len`, []string{`"a\"b":string`, "+:operator", "len:identifier"}},
+		{`User?.len(x) ? nil : true`, []string{"User:identifier", "?.:operator", "len:identifier", "(:punctuation", "x:identifier", "):punctuation", "?:operator", "nil:keyword", "::punctuation", "true:keyword"}},
+		{`strings.trim + strings.size()`, []string{"strings:identifier", ".:punctuation", "trim:identifier", "+:operator", "strings:identifier", ".:punctuation", "size:identifier", "(:punctuation", "):punctuation"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			require.Equal(t, tt.want, classes(t, tt.source))
+		})
+	}
+}
+
+func TestTokens_offsets(t *testing.T) {
+	tokens, err := highlight.Tokens("ö +\n  'ü'")
+	require.NoError(t, err)
+	require.Equal(t, []highlight.Token{
+		{Class: highlight.Identifier, Text: "ö", From: 0, To: 2},
+		{Class: highlight.Operator, Text: "+", From: 3, To: 4},
+		{Class: highlight.String, Text: "'ü'", From: 7, To: 11},
+	}, tokens)
+}
+
+func TestTokens_error(t *testing.T) {
+	_, err := highlight.Tokens(`"unterminated`)
+	require.Error(t, err)
+}
+
+func TestOperators(t *testing.T) {
+	// Every operator of the parser is highlighted.
+	all := append(highlight.Keywords(), highlight.Operators()...)
+	for _, op := range parser.Operators() {
+		require.Contains(t, all, op)
+	}
+	for _, name := range parser.Builtins() {
+		require.Contains(t, highlight.Builtins(), name)
+	}
+	require.Contains(t, highlight.Namespaces()["strings"], "trim")
+}
+
+func TestTextMate(t *testing.T) {
+	var grammar struct {
+		ScopeName string `json:"scopeName"`
+		Patterns  []struct {
+			Name  string `json:"name"`
+			Match string `json:"match"`
+		} `json:"patterns"`
+	}
+	require.NoError(t, json.Unmarshal(highlight.TextMate(), &grammar))
+	require.Equal(t, "source.expr", grammar.ScopeName)
+
+	matches := make(map[string]string)
+	for _, p := range grammar.Patterns {
+		matches[p.Name] += p.Match
+	}
+	for _, name := range highlight.Builtins() {
+		require.Regexp(t, `[:|]`+name+`[|)]`, matches["support.function.builtin.expr"])
+	}
+	require.Contains(t, matches["keyword.operator.word.expr"], "startsWith")
+	require.Contains(t, matches["constant.language.expr"], "nil")
+	require.Contains(t, matches["keyword.operator.expr"], `\?\.`)
+}
+
+func TestMonarch(t *testing.T) {
+	var language struct {
+		Keywords  []string                   `json:"keywords"`
+		Builtins  []string                   `json:"builtins"`
+		Tokenizer map[string][][]interface{} `json:"tokenizer"`
+	}
+	require.NoError(t, json.Unmarshal(highlight.Monarch(), &language))
+	require.Equal(t, highlight.Keywords(), language.Keywords)
+	require.Equal(t, highlight.Builtins(), language.Builtins)
+	require.NotEmpty(t, language.Tokenizer["root"])
+	// Cases keep their order, so identifiers are tested for keywords first.
+	require.Contains(t, string(highlight.Monarch()), `"@keywords": "keyword",`)
+}
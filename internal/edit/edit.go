@@ -0,0 +1,45 @@
+// Package edit measures edit distances of strings, shared by the levenshtein
+// builtin and suggestions of names of the checker.
+package edit
+
+// Distance returns the minimal number of insertions, deletions and
+// substitutions of runes turning a into b, which is the Levenshtein distance.
+// If transpositions is true, transpositions of adjacent runes are single
+// edits too, like typos of "Nmae" of "Name", which is the optimal string
+// alignment distance. Only three rows of the matrix are kept.
+func Distance(a, b []rune, transpositions bool) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if transpositions && i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && prev2[j-2]+1 < curr[j] {
+				curr[j] = prev2[j-2] + 1
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
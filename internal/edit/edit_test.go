@@ -0,0 +1,28 @@
+package edit_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr/internal/edit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b           string
+		levenshtein    int
+		transpositions int
+	}{
+		{"", "", 0, 0},
+		{"abc", "", 3, 3},
+		{"kitten", "sitting", 3, 3},
+		{"Nmae", "Name", 2, 1},
+		{"ca", "abc", 3, 3},
+		{"héllo", "hello", 1, 1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.levenshtein, edit.Distance([]rune(tt.a), []rune(tt.b), false), tt.a+" "+tt.b)
+		assert.Equal(t, tt.transpositions, edit.Distance([]rune(tt.a), []rune(tt.b), true), tt.a+" "+tt.b)
+		assert.Equal(t, tt.transpositions, edit.Distance([]rune(tt.b), []rune(tt.a), true), tt.b+" "+tt.a)
+	}
+}
@@ -0,0 +1,334 @@
+// Package linalg provides vector and matrix functions for scoring
+// expressions over feature vectors, like linalg.dot(features, weights).
+package linalg
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/conf"
+)
+
+// Support enables functions of the linalg namespace:
+//
+//	linalg.dot(a, b)              dot product of vectors of the same length
+//	linalg.norm(a)                Euclidean norm of the vector
+//	linalg.cosineSimilarity(a, b) cosine of the angle between vectors, 0 for zero vectors
+//	linalg.matmul(a, b)           product of matrices, or of the matrix and the vector
+//
+// Vectors are []float64, or arrays of numbers, and matrices are [][]float64,
+// or arrays of vectors of the same length.
+func Support() expr.Option {
+	return func(c *conf.Config) {
+		expr.Builtin(functions...)(c)
+	}
+}
+
+var (
+	floatType  = reflect.TypeOf(float64(0))
+	vectorType = reflect.TypeOf([]float64{})
+	matrixType = reflect.TypeOf([][]float64{})
+	anyType    = reflect.TypeOf(new(interface{})).Elem()
+)
+
+var functions = []*builtin.Function{
+	{
+		Name:     "linalg.dot",
+		Doc:      "Returns the dot product of vectors of the same length.",
+		Func:     dot,
+		Validate: validate("linalg.dot", 2, isVector, floatType),
+	},
+	{
+		Name:     "linalg.norm",
+		Doc:      "Returns the Euclidean norm of the vector.",
+		Func:     norm,
+		Validate: validate("linalg.norm", 1, isVector, floatType),
+	},
+	{
+		Name:     "linalg.cosineSimilarity",
+		Doc:      "Returns the cosine of the angle between vectors, or 0 for zero vectors.",
+		Func:     cosineSimilarity,
+		Validate: validate("linalg.cosineSimilarity", 2, isVector, floatType),
+	},
+	{
+		Name:     "linalg.matmul",
+		Doc:      "Returns the product of matrices, or of the matrix and the vector.",
+		Func:     matmul,
+		Validate: validateMatmul,
+	},
+}
+
+func dot(args ...interface{}) (interface{}, error) {
+	a, b, err := vectors("linalg.dot", args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return Dot(a, b), nil
+}
+
+func norm(args ...interface{}) (interface{}, error) {
+	a, err := toVector("linalg.norm", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return Norm(a), nil
+}
+
+func cosineSimilarity(args ...interface{}) (interface{}, error) {
+	a, b, err := vectors("linalg.cosineSimilarity", args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return CosineSimilarity(a, b), nil
+}
+
+func matmul(args ...interface{}) (interface{}, error) {
+	a, err := toMatrix("linalg.matmul", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if b, err := toVector("linalg.matmul", args[1]); err == nil {
+		if len(a) > 0 && len(a[0]) != len(b) {
+			return nil, fmt.Errorf("mismatched dimensions for linalg.matmul (%vx%v and %v)", len(a), len(a[0]), len(b))
+		}
+		out := make([]float64, len(a))
+		for i, row := range a {
+			out[i] = Dot(row, b)
+		}
+		return out, nil
+	}
+	b, err := toMatrix("linalg.matmul", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(a) > 0 && len(a[0]) != len(b) {
+		return nil, fmt.Errorf("mismatched dimensions for linalg.matmul (%vx%v and %vx%v)", len(a), len(a[0]), len(b), columns(b))
+	}
+	return Matmul(a, b), nil
+}
+
+// Dot returns the dot product of vectors of the same length. The loop is
+// unrolled into independent sums, which the CPU adds in parallel.
+func Dot(a, b []float64) float64 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float64
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return (s0 + s1) + (s2 + s3)
+}
+
+// Norm returns the Euclidean norm of the vector.
+func Norm(a []float64) float64 {
+	return math.Sqrt(Dot(a, a))
+}
+
+// CosineSimilarity returns the cosine of the angle between vectors of the
+// same length, or 0 if any of them is the zero vector.
+func CosineSimilarity(a, b []float64) float64 {
+	n := Norm(a) * Norm(b)
+	if n == 0 {
+		return 0
+	}
+	return Dot(a, b) / n
+}
+
+// Matmul returns the product of matrices, where the number of columns of a is
+// the number of rows of b. Rows of b are added to rows of the result, so both
+// are read sequentially.
+func Matmul(a, b [][]float64) [][]float64 {
+	n := columns(b)
+	out := make([][]float64, len(a))
+	for i, row := range a {
+		out[i] = make([]float64, n)
+		for k, x := range row {
+			if x == 0 {
+				continue
+			}
+			axpy(x, b[k], out[i])
+		}
+	}
+	return out
+}
+
+// axpy adds x*a to y.
+func axpy(x float64, a, y []float64) {
+	a = a[:len(y)]
+	i := 0
+	for ; i+4 <= len(y); i += 4 {
+		y[i] += x * a[i]
+		y[i+1] += x * a[i+1]
+		y[i+2] += x * a[i+2]
+		y[i+3] += x * a[i+3]
+	}
+	for ; i < len(y); i++ {
+		y[i] += x * a[i]
+	}
+}
+
+func columns(m [][]float64) int {
+	if len(m) == 0 {
+		return 0
+	}
+	return len(m[0])
+}
+
+func vectors(name string, x, y interface{}) ([]float64, []float64, error) {
+	a, err := toVector(name, x)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := toVector(name, y)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(a) != len(b) {
+		return nil, nil, fmt.Errorf("mismatched lengths of vectors for %v (%v and %v)", name, len(a), len(b))
+	}
+	return a, b, nil
+}
+
+// toVector converts []float64, and arrays of numbers, to []float64.
+func toVector(name string, arg interface{}) ([]float64, error) {
+	if v, ok := arg.([]float64); ok {
+		return v, nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("invalid vector for %v (type %T)", name, arg)
+	}
+	out := make([]float64, v.Len())
+	for i := range out {
+		x, ok := toFloat(v.Index(i))
+		if !ok {
+			return nil, fmt.Errorf("invalid vector for %v (type %T)", name, arg)
+		}
+		out[i] = x
+	}
+	return out, nil
+}
+
+// toMatrix converts [][]float64, and arrays of vectors of the same length, to
+// [][]float64.
+func toMatrix(name string, arg interface{}) ([][]float64, error) {
+	if m, ok := arg.([][]float64); ok {
+		if err := checkRows(name, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("invalid matrix for %v (type %T)", name, arg)
+	}
+	out := make([][]float64, v.Len())
+	for i := range out {
+		row, err := toVector(name, v.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("invalid matrix for %v (type %T)", name, arg)
+		}
+		out[i] = row
+	}
+	if err := checkRows(name, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func checkRows(name string, m [][]float64) error {
+	for _, row := range m {
+		if len(row) != len(m[0]) {
+			return fmt.Errorf("invalid matrix for %v (rows of lengths %v and %v)", name, len(m[0]), len(row))
+		}
+	}
+	return nil
+}
+
+func toFloat(v reflect.Value) (float64, bool) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	}
+	return 0, false
+}
+
+func validate(name string, n int, valid func(reflect.Type) bool, out reflect.Type) func([]reflect.Type) (reflect.Type, error) {
+	return func(args []reflect.Type) (reflect.Type, error) {
+		if len(args) != n {
+			return out, fmt.Errorf("invalid number of arguments for %v (expected %v, got %v)", name, n, len(args))
+		}
+		for _, t := range args {
+			if !valid(t) {
+				return out, fmt.Errorf("invalid vector for %v (type %v)", name, t)
+			}
+		}
+		return out, nil
+	}
+}
+
+func validateMatmul(args []reflect.Type) (reflect.Type, error) {
+	if len(args) != 2 {
+		return anyType, fmt.Errorf("invalid number of arguments for linalg.matmul (expected 2, got %v)", len(args))
+	}
+	if !isMatrix(args[0]) {
+		return anyType, fmt.Errorf("invalid matrix for linalg.matmul (type %v)", args[0])
+	}
+	switch {
+	case isMatrix(args[1]) && !isAny(args[1]) && !isAny(args[1].Elem()):
+		return matrixType, nil
+	case isVector(args[1]) && !isAny(args[1]) && !isAny(args[1].Elem()):
+		return vectorType, nil
+	case isVector(args[1]):
+		return anyType, nil
+	}
+	return anyType, fmt.Errorf("invalid matrix for linalg.matmul (type %v)", args[1])
+}
+
+// isVector reports whether values of the type may be vectors. Arrays of
+// interfaces are checked at runtime.
+func isVector(t reflect.Type) bool {
+	if isAny(t) {
+		return true
+	}
+	if t == nil || t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+	switch t.Elem().Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isMatrix(t reflect.Type) bool {
+	if isAny(t) {
+		return true
+	}
+	if t == nil || t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+	return isVector(t.Elem())
+}
+
+func isAny(t reflect.Type) bool {
+	return t != nil && t.Kind() == reflect.Interface
+}
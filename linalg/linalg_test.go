@@ -0,0 +1,84 @@
+package linalg_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/linalg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupport(t *testing.T) {
+	env := map[string]interface{}{
+		"features": []float64{1, 2, 3, 4, 5},
+		"weights":  []float64{0.5, 0.5, 0.5, 0.5, 1},
+		"m":        [][]float64{{1, 2}, {3, 4}},
+		"ints":     []int{3, 4},
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`linalg.dot(features, weights)`, 10.0},
+		{`linalg.dot([1, 2], [3, 4.5])`, 12.0},
+		{`linalg.norm(ints)`, 5.0},
+		{`linalg.cosineSimilarity([1, 0], [0, 2])`, 0.0},
+		{`linalg.cosineSimilarity([3, 4], [6, 8])`, 1.0},
+		{`linalg.cosineSimilarity([0, 0], [1, 1])`, 0.0},
+		{`linalg.matmul(m, m)`, [][]float64{{7, 10}, {15, 22}}},
+		{`linalg.matmul(m, [1, 1])`, []float64{3, 7}},
+		{`linalg.matmul([[1, 0, 2]], [[1], [2], [3]])`, [][]float64{{7}}},
+		{`linalg.matmul(m, [1, 1])[1]`, 7.0},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(env), linalg.Support())
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+}
+
+func TestSupport_errors(t *testing.T) {
+	env := map[string]interface{}{
+		"features": []float64{1, 2, 3},
+		"m":        [][]float64{{1, 2}, {3, 4}},
+		"names":    []string{"a"},
+	}
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`linalg.dot(features, [1, 2])`, "mismatched lengths of vectors for linalg.dot (3 and 2)"},
+		{`linalg.norm(names)`, "invalid vector for linalg.norm (type []string)"},
+		{`linalg.norm(["a"])`, "invalid vector for linalg.norm (type []interface {})"},
+		{`linalg.matmul(m, features)`, "mismatched dimensions for linalg.matmul (2x2 and 3)"},
+		{`linalg.matmul(m, [[1, 2, 3]])`, "mismatched dimensions for linalg.matmul (2x2 and 1x3)"},
+		{`linalg.matmul([[1], [2, 3]], m)`, "invalid matrix for linalg.matmul (rows of lengths 1 and 2)"},
+		{`linalg.matmul(features, m)`, "invalid matrix for linalg.matmul (type []float64)"},
+	}
+	for _, test := range tests {
+		_, err := expr.Eval(test.code, env)
+		require.Error(t, err, test.code)
+
+		program, err := expr.Compile(test.code, expr.Env(env), linalg.Support())
+		if err == nil {
+			_, err = expr.Run(program, env)
+		}
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+}
+
+func TestDot(t *testing.T) {
+	a := make([]float64, 1001)
+	for i := range a {
+		a[i] = float64(i)
+	}
+	assert.Equal(t, 333833500.0, linalg.Dot(a, a))
+	assert.Equal(t, 0.0, linalg.Dot(nil, nil))
+}
@@ -0,0 +1,120 @@
+// Package logging routes entries of the log.print builtin of expressions to
+// loggers, with rate limiting of entries of every program:
+//
+//	program, err := expr.Compile(`score > 0.8 && log.print("warn", "high score", "score", score)`,
+//		expr.Env(env),
+//		expr.Logger("risk", logging.Func(func(e *logging.Entry) {
+//			log.Printf("%v %v: %v %v", e.Level, e.ID, e.Message, e.Values)
+//		})))
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/antonmedv/expr/builtin"
+)
+
+// Entry of the log builtin.
+type Entry struct {
+	// ID of the expression, given by expr.Logger.
+	ID string
+	// Time of the call of log.
+	Time time.Time
+	// Level is one of builtin.LogLevels, like "warn".
+	Level   string
+	Message string
+	// Values are pairs of keys and values, like "score", 0.9.
+	Values []interface{}
+	// Dropped is the number of entries of the program, which were dropped
+	// by rate limiting since the previous entry.
+	Dropped int
+}
+
+// Logger receives entries. Programs may be run by many goroutines, so
+// loggers must be safe for concurrent use.
+type Logger interface {
+	Log(entry *Entry)
+}
+
+// Func is a Logger calling the function.
+type Func func(entry *Entry)
+
+// Log calls the function with the entry.
+func (f Func) Log(entry *Entry) {
+	f(entry)
+}
+
+// Config of logging of programs.
+type Config struct {
+	ID     string
+	Logger Logger
+	// Rate is the number of entries per second, which every program may log
+	// after Burst entries. Entries exceeding the rate are dropped. Zero Rate
+	// is no limit.
+	Rate  float64
+	Burst int
+}
+
+// Func returns the implementation of the log builtin of a program. Every
+// program has its own limit of the rate of entries.
+func (c *Config) Func() func(args ...interface{}) (interface{}, error) {
+	burst := float64(c.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	l := &limiter{rate: c.Rate, burst: burst, tokens: burst, last: time.Now()}
+	return func(args ...interface{}) (interface{}, error) {
+		level, message, values, err := builtin.LogArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		dropped, ok := l.allow(now)
+		if !ok {
+			return true, nil
+		}
+		c.Logger.Log(&Entry{
+			ID:      c.ID,
+			Time:    now,
+			Level:   level,
+			Message: message,
+			Values:  values,
+			Dropped: dropped,
+		})
+		return true, nil
+	}
+}
+
+// limiter is a token bucket of entries.
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	dropped int
+}
+
+// allow reports, whether an entry may be logged now, and returns the number
+// of entries dropped before it.
+func (l *limiter) allow(now time.Time) (int, bool) {
+	if l.rate == 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		l.dropped++
+		return 0, false
+	}
+	l.tokens--
+	dropped := l.dropped
+	l.dropped = 0
+	return dropped, true
+}
@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Now()
+	l := &limiter{rate: 1, burst: 2, tokens: 2, last: start}
+
+	var allowed []int
+	for i := 0; i < 5; i++ {
+		if dropped, ok := l.allow(start); ok {
+			allowed = append(allowed, dropped)
+		}
+	}
+	assert.Equal(t, []int{0, 0}, allowed)
+
+	dropped, ok := l.allow(start.Add(1500 * time.Millisecond))
+	assert.True(t, ok)
+	assert.Equal(t, 3, dropped)
+	_, ok = l.allow(start.Add(1500 * time.Millisecond))
+	assert.False(t, ok)
+	dropped, ok = l.allow(start.Add(10 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 1, dropped)
+}
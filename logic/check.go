@@ -0,0 +1,101 @@
+package logic
+
+import (
+	"fmt"
+)
+
+// ConflictKind is the kind of conflict of Check.
+type ConflictKind string
+
+const (
+	// Tautology is a rule, which is always true.
+	Tautology ConflictKind = "tautology"
+	// Contradiction is a rule, which is never true.
+	Contradiction ConflictKind = "contradiction"
+	// Overlapping are rules, which are true together.
+	Overlapping ConflictKind = "overlapping"
+	// Unreachable is a rule, which is true only if rules before it are, so
+	// it never matches, if the first matching rule wins.
+	Unreachable ConflictKind = "unreachable"
+)
+
+// Conflict of rules of Check.
+type Conflict struct {
+	Kind ConflictKind
+	// Rule is the index of the rule, and Other is the index of the rule
+	// before it, which it overlaps.
+	Rule, Other int
+	// Witness is an assignment of predicates, for which overlapping rules
+	// are both true.
+	Witness Assignment
+}
+
+func (c Conflict) String() string {
+	switch c.Kind {
+	case Tautology:
+		return fmt.Sprintf("rule %v is always true", c.Rule+1)
+	case Contradiction:
+		return fmt.Sprintf("rule %v is never true", c.Rule+1)
+	case Unreachable:
+		return fmt.Sprintf("rule %v is unreachable, as rules before it match whenever it does", c.Rule+1)
+	}
+	return fmt.Sprintf("rules %v and %v overlap, like for %v", c.Other+1, c.Rule+1, c.Witness)
+}
+
+// Check returns conflicts of conditions of rules: rules, which are always
+// or never true, pairs of rules, which may be true together, and rules,
+// which are unreachable, if the first matching rule wins.
+func Check(conditions ...string) ([]Conflict, error) {
+	set := NewSet()
+	formulas := make([]*Formula, len(conditions))
+	for i, cond := range conditions {
+		f, err := set.Parse(cond)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %v", i+1, err)
+		}
+		formulas[i] = f
+	}
+	var conflicts []Conflict
+	for i, f := range formulas {
+		if f.Contradiction() {
+			conflicts = append(conflicts, Conflict{Kind: Contradiction, Rule: i, Other: -1})
+			continue
+		}
+		if f.Tautology() {
+			conflicts = append(conflicts, Conflict{Kind: Tautology, Rule: i, Other: -1})
+		}
+		// Only rules, which overlap the rule, may match whenever it does.
+		var overlapping []*Formula
+		for j, other := range formulas[:i] {
+			w, err := Overlap(other, f)
+			if err != nil {
+				return nil, fmt.Errorf("rules %v and %v: %v", j+1, i+1, err)
+			}
+			if w != nil {
+				conflicts = append(conflicts, Conflict{Kind: Overlapping, Rule: i, Other: j, Witness: w})
+				overlapping = append(overlapping, other)
+			}
+		}
+		if len(overlapping) == 0 {
+			continue
+		}
+		w, err := find(union(append(overlapping, f)...), set, func(values []bool) bool {
+			if !f.eval(values) {
+				return false
+			}
+			for _, b := range overlapping {
+				if b.eval(values) {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %v", i+1, err)
+		}
+		if w == nil {
+			conflicts = append(conflicts, Conflict{Kind: Unreachable, Rule: i, Other: -1})
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,292 @@
+// Package logic analyzes boolean expressions as formulas of predicates,
+// like user.Age >= 18 and user.Country in ["US", "CA"], to find formulas,
+// which are always true or never true, and rules, which overlap or are
+// unreachable. Predicates are operands of and, or, not and ternaries.
+// Comparisons of the same expression with literals are related, so
+// x > 10 and x < 5 is never true. Other predicates are independent.
+//
+// Formulas are analyzed by truth tables, so predicates of analyzed formulas
+// are limited by MaxPredicates.
+//
+// SMT exports expressions to SMT-LIB for external solvers, and Pushdown
+// returns comparisons of programs, which storages may use to filter
+// environments before runs.
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/parser"
+)
+
+// MaxPredicates limits the number of predicates of formulas analyzed at
+// once, as truth tables have 2^n rows of n predicates.
+var MaxPredicates = 20
+
+// Set of predicates of formulas. Formulas of the same set share predicates,
+// and may be analyzed together.
+type Set struct {
+	predicates []ast.Node
+	sources    []string
+	index      map[string]int
+	atoms      []*atom
+	subjects   map[string]kind
+}
+
+// NewSet returns an empty set of predicates.
+func NewSet() *Set {
+	return &Set{
+		index:    make(map[string]int),
+		subjects: make(map[string]kind),
+	}
+}
+
+// Formula is a boolean expression over predicates of a set.
+type Formula struct {
+	// Node is the tree of the expression in normal form of ast.Normalize.
+	Node ast.Node
+	set  *Set
+	vars []int
+	eval func(values []bool) bool
+}
+
+// Assignment of truth values to predicates, by their sources.
+type Assignment map[string]bool
+
+func (a Assignment) String() string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		if a[key] {
+			parts[i] = key
+		} else {
+			parts[i] = "not (" + key + ")"
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Parse returns the formula of the expression.
+func (s *Set) Parse(input string) (*Formula, error) {
+	tree, err := parser.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return s.Add(tree.Node)
+}
+
+// Add returns the formula of the tree, adding its predicates to the set.
+func (s *Set) Add(node ast.Node) (*Formula, error) {
+	f := &Formula{Node: ast.Normalize(node), set: s}
+	used := make(map[int]bool)
+	f.eval = s.compile(f.Node, used)
+	for i := range used {
+		f.vars = append(f.vars, i)
+	}
+	sort.Ints(f.vars)
+	if len(f.vars) > MaxPredicates {
+		return nil, fmt.Errorf("too many predicates (%v, max %v)", len(f.vars), MaxPredicates)
+	}
+	return f, nil
+}
+
+// compile returns the function of the formula of the node, which predicates
+// are added to used.
+func (s *Set) compile(node ast.Node, used map[int]bool) func(values []bool) bool {
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		value := n.Value
+		return func([]bool) bool { return value }
+	case *ast.UnaryNode:
+		if n.Operator == "not" {
+			x := s.compile(n.Node, used)
+			return func(values []bool) bool { return !x(values) }
+		}
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "and":
+			left, right := s.compile(n.Left, used), s.compile(n.Right, used)
+			return func(values []bool) bool { return left(values) && right(values) }
+		case "or":
+			left, right := s.compile(n.Left, used), s.compile(n.Right, used)
+			return func(values []bool) bool { return left(values) || right(values) }
+		}
+	case *ast.ConditionalNode:
+		cond, exp1, exp2 := s.compile(n.Cond, used), s.compile(n.Exp1, used), s.compile(n.Exp2, used)
+		return func(values []bool) bool {
+			if cond(values) {
+				return exp1(values)
+			}
+			return exp2(values)
+		}
+	}
+	i := s.predicate(node)
+	used[i] = true
+	return func(values []bool) bool { return values[i] }
+}
+
+// predicate returns the index of the predicate, adding it to the set.
+func (s *Set) predicate(node ast.Node) int {
+	key := ast.Hash(node)
+	if i, ok := s.index[key]; ok {
+		return i
+	}
+	i := len(s.predicates)
+	s.index[key] = i
+	s.predicates = append(s.predicates, node)
+	s.sources = append(s.sources, parser.Format(node))
+	s.atoms = append(s.atoms, s.atom(i, node))
+	return i
+}
+
+// Predicates returns sources of predicates of the formula.
+func (f *Formula) Predicates() []string {
+	sources := make([]string, len(f.vars))
+	for i, v := range f.vars {
+		sources[i] = f.set.sources[v]
+	}
+	return sources
+}
+
+// Satisfy returns an assignment of predicates, for which the formula is
+// true, or nil if the formula is never true.
+func (f *Formula) Satisfy() Assignment {
+	a, _ := find(f.vars, f.set, func(values []bool) bool { return f.eval(values) }, f)
+	return a
+}
+
+// Contradiction reports whether the formula is never true.
+func (f *Formula) Contradiction() bool {
+	return f.Satisfy() == nil
+}
+
+// Tautology reports whether the formula is always true.
+func (f *Formula) Tautology() bool {
+	a, _ := find(f.vars, f.set, func(values []bool) bool { return !f.eval(values) }, f)
+	return a == nil
+}
+
+// TruthTable of a formula.
+type TruthTable struct {
+	// Predicates are sources of predicates of columns.
+	Predicates []string
+	Rows       []Row
+}
+
+// Row of a truth table with values of predicates, and the value of the
+// formula. Rows of values of related predicates, which are impossible, like
+// x > 10 and x < 5, are left out.
+type Row struct {
+	Values []bool
+	Result bool
+}
+
+// TruthTable returns the truth table of the formula.
+func (f *Formula) TruthTable() *TruthTable {
+	t := &TruthTable{Predicates: f.Predicates()}
+	_ = f.set.enumerate(f.vars, func(values []bool) bool {
+		row := Row{Values: make([]bool, len(f.vars)), Result: f.eval(values)}
+		for i, v := range f.vars {
+			row.Values[i] = values[v]
+		}
+		t.Rows = append(t.Rows, row)
+		return true
+	})
+	return t
+}
+
+func (t *TruthTable) String() string {
+	var b strings.Builder
+	widths := make([]int, len(t.Predicates))
+	for i, p := range t.Predicates {
+		widths[i] = len(p)
+		if widths[i] < len("false") {
+			widths[i] = len("false")
+		}
+		fmt.Fprintf(&b, "%-*v | ", widths[i], p)
+	}
+	b.WriteString("result\n")
+	for _, row := range t.Rows {
+		for i, value := range row.Values {
+			fmt.Fprintf(&b, "%-*v | ", widths[i], value)
+		}
+		fmt.Fprintf(&b, "%v\n", row.Result)
+	}
+	return b.String()
+}
+
+// Overlap returns an assignment of predicates, for which both formulas are
+// true, or nil if they are never true together.
+func Overlap(a, b *Formula) (Assignment, error) {
+	return find(union(a, b), a.set, func(values []bool) bool { return a.eval(values) && b.eval(values) }, a, b)
+}
+
+// Implies reports whether formula b is true whenever formula a is true.
+func Implies(a, b *Formula) (bool, error) {
+	w, err := find(union(a, b), a.set, func(values []bool) bool { return a.eval(values) && !b.eval(values) }, a, b)
+	return w == nil, err
+}
+
+// union returns predicates of formulas.
+func union(formulas ...*Formula) []int {
+	seen := make(map[int]bool)
+	var vars []int
+	for _, f := range formulas {
+		for _, v := range f.vars {
+			if !seen[v] {
+				seen[v] = true
+				vars = append(vars, v)
+			}
+		}
+	}
+	sort.Ints(vars)
+	return vars
+}
+
+// find returns the first assignment of predicates, for which fn is true, or
+// nil if there is none.
+func find(vars []int, set *Set, fn func(values []bool) bool, formulas ...*Formula) (Assignment, error) {
+	for _, f := range formulas {
+		if f.set != set {
+			return nil, fmt.Errorf("formulas of different sets")
+		}
+	}
+	var found Assignment
+	err := set.enumerate(vars, func(values []bool) bool {
+		if !fn(values) {
+			return true
+		}
+		found = make(Assignment, len(vars))
+		for _, v := range vars {
+			found[set.sources[v]] = values[v]
+		}
+		return false
+	})
+	return found, err
+}
+
+// enumerate calls fn with possible values of predicates, until it returns
+// false.
+func (s *Set) enumerate(vars []int, fn func(values []bool) bool) error {
+	if len(vars) > MaxPredicates {
+		return fmt.Errorf("too many predicates (%v, max %v)", len(vars), MaxPredicates)
+	}
+	values := make([]bool, len(s.predicates))
+	possible := s.possible(vars)
+	for mask := 0; mask < 1<<len(vars); mask++ {
+		for i, v := range vars {
+			values[v] = mask&(1<<i) != 0
+		}
+		if possible(values) && !fn(values) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package logic_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr/logic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormula(t *testing.T) {
+	tests := []struct {
+		input         string
+		tautology     bool
+		contradiction bool
+	}{
+		{`a or not a`, true, false},
+		{`a and not a`, false, true},
+		{`a and b`, false, false},
+		{`a && b || !a || !b`, true, false},
+		{`x > 10 and x < 5`, false, true},
+		{`x > 10 or x <= 10`, true, false},
+		{`x >= 10 and x <= 10`, false, false},
+		{`x > 1 and x < 2`, false, false},
+		{`user.Age >= 18 and 18 > user.Age`, false, true},
+		{`c == "US" and c == "CA"`, false, true},
+		{`c in ["US", "CA"] and c != "US" and c != "CA"`, false, true},
+		{`c in ["US", "CA"] or c not in ["US", "CA"]`, true, false},
+		{`c == "US" or c != "US"`, true, false},
+		{`f(x) > 1 and f(x) < 0`, false, true},
+		{`f(x) > 1 and f(y) < 0`, false, false},
+		{`a ? b : not b`, false, false},
+		{`a ? true : not a`, true, false},
+		{`true`, true, false},
+		{`false`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			f, err := logic.NewSet().Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.tautology, f.Tautology(), "tautology")
+			assert.Equal(t, tt.contradiction, f.Contradiction(), "contradiction")
+			if tt.contradiction {
+				assert.Nil(t, f.Satisfy())
+			} else {
+				assert.NotNil(t, f.Satisfy())
+			}
+		})
+	}
+}
+
+func TestFormula_TruthTable(t *testing.T) {
+	f, err := logic.NewSet().Parse(`x > 10 or y and x < 5`)
+	require.NoError(t, err)
+	table := f.TruthTable()
+	assert.Equal(t, []string{"x > 10", "x < 5", "y"}, table.Predicates)
+	// Rows, where both x > 10 and x < 5, are impossible.
+	assert.Len(t, table.Rows, 6)
+	assert.Equal(t, strings.Join([]string{
+		"x > 10 | x < 5 | y     | result",
+		"false  | false | false | false",
+		"true   | false | false | true",
+		"false  | true  | false | false",
+		"false  | false | true  | false",
+		"true   | false | true  | true",
+		"false  | true  | true  | true",
+		"",
+	}, "\n"), table.String())
+}
+
+func TestOverlap(t *testing.T) {
+	set := logic.NewSet()
+	a, err := set.Parse(`age >= 18 and country == "US"`)
+	require.NoError(t, err)
+	b, err := set.Parse(`age < 21 or vip`)
+	require.NoError(t, err)
+	c, err := set.Parse(`age < 18`)
+	require.NoError(t, err)
+
+	w, err := logic.Overlap(a, b)
+	require.NoError(t, err)
+	require.NotNil(t, w)
+	assert.True(t, w[`age >= 18`])
+	assert.True(t, w[`country == "US"`])
+
+	w, err = logic.Overlap(a, c)
+	require.NoError(t, err)
+	assert.Nil(t, w)
+
+	ok, err := logic.Implies(c, b)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = logic.Implies(b, c)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	other, err := logic.NewSet().Parse(`vip`)
+	require.NoError(t, err)
+	_, err = logic.Overlap(a, other)
+	assert.EqualError(t, err, "formulas of different sets")
+}
+
+func TestCheck(t *testing.T) {
+	conflicts, err := logic.Check(
+		`amount > 1000 and country == "US"`,
+		`amount > 5000`,
+		`amount > 2000 and country == "US"`,
+		`amount < 0 and amount > 10`,
+		`vip or not vip`,
+	)
+	require.NoError(t, err)
+	var got []string
+	for _, c := range conflicts {
+		got = append(got, c.String())
+	}
+	assert.Equal(t, []string{
+		`rules 1 and 2 overlap, like for amount > 1000 and amount > 5000 and country == "US"`,
+		`rules 1 and 3 overlap, like for amount > 1000 and amount > 2000 and country == "US"`,
+		`rules 2 and 3 overlap, like for amount > 2000 and amount > 5000 and country == "US"`,
+		`rule 3 is unreachable, as rules before it match whenever it does`,
+		`rule 4 is never true`,
+		`rule 5 is always true`,
+		`rules 1 and 5 overlap, like for amount > 1000 and country == "US" and not (vip)`,
+		`rules 2 and 5 overlap, like for amount > 5000 and not (vip)`,
+		`rules 3 and 5 overlap, like for amount > 2000 and country == "US" and not (vip)`,
+	}, got)
+}
+
+func TestCheck_limit(t *testing.T) {
+	var predicates []string
+	for _, r := range "abcdefghijklmnopqrstuvwxyz" {
+		predicates = append(predicates, string(r))
+	}
+	_, err := logic.Check(strings.Join(predicates, " and "))
+	assert.EqualError(t, err, "rule 1: too many predicates (26, max 20)")
+}
@@ -0,0 +1,238 @@
+package logic
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/vm"
+)
+
+// Comparison of a field with a literal, like user.Age >= 18.
+type Comparison struct {
+	// Path of the field in the environment, like [user Age].
+	Path []string
+	// Operator is one of ==, !=, <, <=, >, >=, in, not in, contains,
+	// startsWith, endsWith and matches.
+	Operator string
+	// Value is nil, bool, int, float64 or string, or []interface{} of
+	// them of in and not in.
+	Value interface{}
+}
+
+func (c Comparison) String() string {
+	return fmt.Sprintf("%v %v %v", strings.Join(c.Path, "."), c.Operator, formatValue(c.Value))
+}
+
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("%q", x)
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, e := range x {
+			parts[i] = formatValue(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// negations of operators of comparisons.
+var negations = map[string]string{
+	"==":     "!=",
+	"!=":     "==",
+	"<":      ">=",
+	">=":     "<",
+	">":      "<=",
+	"<=":     ">",
+	"in":     "not in",
+	"not in": "in",
+}
+
+// Pushdown returns comparisons of fields with literals among conjuncts of
+// the program, like user.Age >= 18 and user.Country in ["US", "CA"] of
+// user.Age >= 18 and user.Country in ["US", "CA"] and score(user) > 0.5.
+// The program is true only for environments, which match every returned
+// comparison, so storages may select indexes and filter environments with
+// them before runs of the program. Comparisons are in normal form, with
+// fields on the left, like user.Age >= 18 of 18 <= user.Age, and without
+// negations, like user.Age < 18 of not (user.Age >= 18). Exact is true, if
+// the program is the conjunction of returned comparisons, and its runs
+// may be skipped.
+func Pushdown(program *vm.Program) (comparisons []Comparison, exact bool) {
+	exact = true
+	for _, node := range conjuncts(program.Node) {
+		c, ok := comparison(node)
+		if !ok {
+			exact = false
+			continue
+		}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons, exact
+}
+
+// conjuncts returns operands of chains of and, like a, b and c of
+// a and (b and c).
+func conjuncts(node ast.Node) []ast.Node {
+	if n, ok := node.(*ast.BinaryNode); ok && (n.Operator == "and" || n.Operator == "&&") {
+		return append(conjuncts(n.Left), conjuncts(n.Right)...)
+	}
+	return []ast.Node{node}
+}
+
+func comparison(node ast.Node) (Comparison, bool) {
+	switch n := node.(type) {
+	case *ast.UnaryNode:
+		if n.Operator != "not" && n.Operator != "!" {
+			break
+		}
+		if p, ok := boolField(n.Node); ok {
+			return Comparison{Path: p, Operator: "==", Value: false}, true
+		}
+		c, ok := comparison(n.Node)
+		if op, negated := negations[c.Operator]; ok && negated {
+			c.Operator = op
+			return c, true
+		}
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "==", "!=", "<", "<=", ">", ">=":
+			if p, ok := fieldPath(n.Left); ok {
+				if v, ok := literalValue(n.Right); ok {
+					return Comparison{Path: p, Operator: n.Operator, Value: v}, true
+				}
+			}
+			if p, ok := fieldPath(n.Right); ok {
+				if v, ok := literalValue(n.Left); ok {
+					return Comparison{Path: p, Operator: mirrors[n.Operator], Value: v}, true
+				}
+			}
+		case "in":
+			if p, ok := fieldPath(n.Left); ok {
+				if v, ok := listValue(n.Right); ok {
+					return Comparison{Path: p, Operator: "in", Value: v}, true
+				}
+			}
+		case "contains", "startsWith", "endsWith", "matches":
+			if p, ok := fieldPath(n.Left); ok {
+				if s, ok := n.Right.(*ast.StringNode); ok {
+					return Comparison{Path: p, Operator: n.Operator, Value: s.Value}, true
+				}
+			}
+		}
+	default:
+		if p, ok := boolField(node); ok {
+			return Comparison{Path: p, Operator: "==", Value: true}, true
+		}
+	}
+	return Comparison{}, false
+}
+
+// boolField returns the path of the field of type bool.
+func boolField(node ast.Node) ([]string, bool) {
+	if t := node.Type(); t == nil || t.Kind() != reflect.Bool {
+		return nil, false
+	}
+	return fieldPath(node)
+}
+
+// fieldPath returns the path of the field of constant properties, like
+// [user Address City] of user.Address.City.
+func fieldPath(node ast.Node) ([]string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return []string{n.Value}, true
+	case *ast.ChainNode:
+		return fieldPath(n.Node)
+	case *ast.MemberNode:
+		p, ok := n.Property.(*ast.StringNode)
+		if !ok || n.Method {
+			return nil, false
+		}
+		base, ok := fieldPath(n.Node)
+		if !ok {
+			return nil, false
+		}
+		return append(base, p.Value), true
+	}
+	return nil, false
+}
+
+func literalValue(node ast.Node) (interface{}, bool) {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return nil, true
+	case *ast.BoolNode:
+		return n.Value, true
+	case *ast.IntegerNode:
+		return n.Value, true
+	case *ast.FloatNode:
+		return n.Value, true
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.ConstantNode:
+		switch n.Value.(type) {
+		case nil, bool, int, float64, string:
+			return n.Value, true
+		}
+	}
+	return nil, false
+}
+
+// listValue returns values of arrays of literals, like [1, 2], or of
+// arrays and sets of values of the optimizer.
+func listValue(node ast.Node) ([]interface{}, bool) {
+	switch n := node.(type) {
+	case *ast.ArrayNode:
+		values := make([]interface{}, len(n.Nodes))
+		for i, e := range n.Nodes {
+			v, ok := literalValue(e)
+			if !ok {
+				return nil, false
+			}
+			values[i] = v
+		}
+		return values, true
+	case *ast.ConstantNode:
+		switch set := n.Value.(type) {
+		case []interface{}:
+			for _, v := range set {
+				switch v.(type) {
+				case nil, bool, int, float64, string:
+				default:
+					return nil, false
+				}
+			}
+			return append([]interface{}(nil), set...), true
+		case map[int]struct{}:
+			keys := make([]int, 0, len(set))
+			for k := range set {
+				keys = append(keys, k)
+			}
+			sort.Ints(keys)
+			values := make([]interface{}, len(keys))
+			for i, k := range keys {
+				values[i] = k
+			}
+			return values, true
+		case map[string]struct{}:
+			keys := make([]string, 0, len(set))
+			for k := range set {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			values := make([]interface{}, len(keys))
+			for i, k := range keys {
+				values[i] = k
+			}
+			return values, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,96 @@
+package logic_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/logic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type account struct {
+	Age     int
+	Score   float64
+	Country string
+	Email   string
+	Active  bool
+	Tags    []string
+	Address *address
+}
+
+type address struct {
+	City string
+}
+
+type pushdownEnv struct {
+	User account
+	Risk func(account) float64
+}
+
+func TestPushdown(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+		exact bool
+	}{
+		{
+			`User.Age >= 18 and User.Country in ["US", "CA"]`,
+			[]string{`User.Age >= 18`, `User.Country in ["CA", "US"]`},
+			true,
+		},
+		{
+			`18 < User.Age && Risk(User) < 0.5 && User.Active`,
+			[]string{`User.Age > 18`, `User.Active == true`},
+			false,
+		},
+		{
+			`not (User.Age < 21) and not User.Active and User.Age not in [30, 40]`,
+			[]string{`User.Age >= 21`, `User.Active == false`, `User.Age not in [30, 40]`},
+			true,
+		},
+		{
+			`User.Age in 18..65 and User.Score in [1.5, 2]`,
+			[]string{`User.Age >= 18`, `User.Age <= 65`, `User.Score in [1.5, 2]`},
+			true,
+		},
+		{
+			`User.Email endsWith "@example.com" and User.Address?.City == "Paris"`,
+			[]string{`User.Email endsWith "@example.com"`, `User.Address.City == "Paris"`},
+			true,
+		},
+		{
+			`User.Age > 18 or User.Active`,
+			nil,
+			false,
+		},
+		{
+			`User.Age > User.Score and "a" in User.Tags and not (User.Email contains "test")`,
+			nil,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program, err := expr.Compile(tt.input, expr.Env(pushdownEnv{}))
+			require.NoError(t, err)
+			comparisons, exact := logic.Pushdown(program)
+			var got []string
+			for _, c := range comparisons {
+				got = append(got, c.String())
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.exact, exact)
+		})
+	}
+}
+
+func TestPushdown_values(t *testing.T) {
+	program, err := expr.Compile(`User.Country in ["US", "CA"] && User.Address.City == nil`, expr.Env(pushdownEnv{}))
+	require.NoError(t, err)
+	comparisons, _ := logic.Pushdown(program)
+	assert.Equal(t, []logic.Comparison{
+		{Path: []string{"User", "Country"}, Operator: "in", Value: []interface{}{"CA", "US"}},
+		{Path: []string{"User", "Address", "City"}, Operator: "==", Value: nil},
+	}, comparisons)
+}
@@ -0,0 +1,482 @@
+package logic
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Sorts of SMT-LIB.
+const (
+	sortBool   = "Bool"
+	sortInt    = "Int"
+	sortReal   = "Real"
+	sortString = "String"
+)
+
+// SMT returns the script of SMT-LIB 2, which declares constants of
+// variables of trees, like order.Total, asserts trees, and checks
+// satisfiability, for external solvers, like Z3 or cvc5. To verify, that a
+// property of a rule always holds, assert the rule and negation of the
+// property: the solver reports unsat, if the property holds, or sat with a
+// counterexample.
+//
+// Supported are literals, variables and fields, logical, comparison and
+// arithmetic operators, in of arrays and ranges, ternaries, let bindings,
+// contains, startsWith and endsWith of strings, and abs, min and max. Sorts
+// of variables are taken from types of the checker, if trees are checked,
+// or inferred from their use. Numbers are reals, unless they are typed as
+// integers.
+func SMT(nodes ...ast.Node) (string, error) {
+	s := &smt{sorts: make(map[string]string)}
+	var asserts []string
+	for _, node := range nodes {
+		text, err := s.term(node, sortBool)
+		if err != nil {
+			return "", err
+		}
+		asserts = append(asserts, text)
+	}
+	var b strings.Builder
+	for _, name := range s.names {
+		fmt.Fprintf(&b, "(declare-const %v %v)\n", symbol(name), s.sorts[name])
+	}
+	for _, text := range asserts {
+		fmt.Fprintf(&b, "(assert %v)\n", text)
+	}
+	b.WriteString("(check-sat)\n")
+	return b.String(), nil
+}
+
+type smt struct {
+	// sorts of declared constants, in order of names.
+	sorts  map[string]string
+	names  []string
+	scopes []map[string]string
+}
+
+func (s *smt) errorf(node ast.Node, format string, args ...interface{}) error {
+	return file.Errorf(node.Location(), format, args...)
+}
+
+// term returns the term of the node, of the sort, if the sort is not
+// empty.
+func (s *smt) term(node ast.Node, want string) (string, error) {
+	text, sort, err := s.translate(node, want)
+	if err != nil {
+		return "", err
+	}
+	return s.coerce(node, text, sort, want)
+}
+
+// coerce converts the term of the sort to the wanted sort.
+func (s *smt) coerce(node ast.Node, text, sort, want string) (string, error) {
+	switch {
+	case want == "" || sort == want:
+		return text, nil
+	case sort == sortInt && want == sortReal:
+		return "(to_real " + text + ")", nil
+	}
+	return "", s.errorf(node, "mismatched sorts (%v and %v)", sort, want)
+}
+
+// translate returns the term of the node and its sort. The wanted sort is
+// the sort of variables of unknown sorts.
+func (s *smt) translate(node ast.Node, want string) (string, string, error) {
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		return strconv.FormatBool(n.Value), sortBool, nil
+	case *ast.IntegerNode:
+		if want == sortReal {
+			return decimal(float64(n.Value)), sortReal, nil
+		}
+		if n.Value < 0 {
+			return fmt.Sprintf("(- %v)", -n.Value), sortInt, nil
+		}
+		return strconv.Itoa(n.Value), sortInt, nil
+	case *ast.FloatNode:
+		return decimal(n.Value), sortReal, nil
+	case *ast.StringNode:
+		return `"` + strings.ReplaceAll(n.Value, `"`, `""`) + `"`, sortString, nil
+	case *ast.ChainNode:
+		return s.translate(n.Node, want)
+	case *ast.IdentifierNode, *ast.MemberNode:
+		return s.variable(node, want)
+	case *ast.VariableNode:
+		for i := len(s.scopes) - 1; i >= 0; i-- {
+			if sort, ok := s.scopes[i][n.Name]; ok {
+				return symbol(n.Name), sort, nil
+			}
+		}
+	case *ast.UnaryNode:
+		switch n.Operator {
+		case "not", "!":
+			x, err := s.term(n.Node, sortBool)
+			return "(not " + x + ")", sortBool, err
+		case "-", "+":
+			sort := s.numeric(want, n.Node)
+			x, err := s.term(n.Node, sort)
+			if n.Operator == "+" {
+				return x, sort, err
+			}
+			return "(- " + x + ")", sort, err
+		}
+	case *ast.BinaryNode:
+		return s.binary(n, want)
+	case *ast.ConditionalNode:
+		cond, err := s.term(n.Cond, sortBool)
+		if err != nil {
+			return "", "", err
+		}
+		sort := join(s.sortOf(n.Exp1), s.sortOf(n.Exp2))
+		if sort == "" {
+			sort = want
+		}
+		exp1, err := s.term(n.Exp1, sort)
+		if err != nil {
+			return "", "", err
+		}
+		exp2, err := s.term(n.Exp2, sort)
+		return fmt.Sprintf("(ite %v %v %v)", cond, exp1, exp2), sort, err
+	case *ast.BindNode:
+		if n.Tuple || len(n.Names) != 1 {
+			break
+		}
+		value, sort, err := s.translate(n.Value, "")
+		if err != nil {
+			return "", "", err
+		}
+		s.scopes = append(s.scopes, map[string]string{n.Names[0]: sort})
+		body, sort, err := s.translate(n.Body, want)
+		s.scopes = s.scopes[:len(s.scopes)-1]
+		return fmt.Sprintf("(let ((%v %v)) %v)", symbol(n.Names[0]), value, body), sort, err
+	case *ast.BuiltinNode:
+		return s.builtin(n.Name, n.Arguments, node, want)
+	case *ast.CallNode:
+		if callee, ok := n.Callee.(*ast.IdentifierNode); ok {
+			return s.builtin(callee.Value, n.Arguments, node, want)
+		}
+	}
+	return "", "", s.errorf(node, "unsupported expression %v", parser.Format(node))
+}
+
+func (s *smt) binary(n *ast.BinaryNode, want string) (string, string, error) {
+	var op, sort string
+	switch n.Operator {
+	case "and", "&&", "or", "||":
+		left, err := s.term(n.Left, sortBool)
+		if err != nil {
+			return "", "", err
+		}
+		right, err := s.term(n.Right, sortBool)
+		op = "and"
+		if n.Operator == "or" || n.Operator == "||" {
+			op = "or"
+		}
+		return fmt.Sprintf("(%v %v %v)", op, left, right), sortBool, err
+	case "in":
+		return s.in(n)
+	case "==", "!=":
+		sort = join(s.sortOf(n.Left), s.sortOf(n.Right))
+		if sort == "" {
+			sort = sortReal
+		}
+		left, right, err := s.operands(n, sort)
+		if n.Operator == "!=" {
+			return fmt.Sprintf("(not (= %v %v))", left, right), sortBool, err
+		}
+		return fmt.Sprintf("(= %v %v)", left, right), sortBool, err
+	case "<", "<=", ">", ">=":
+		sort = s.numeric("", n.Left, n.Right)
+		left, right, err := s.operands(n, sort)
+		return fmt.Sprintf("(%v %v %v)", n.Operator, left, right), sortBool, err
+	case "contains", "startsWith", "endsWith":
+		left, right, err := s.operands(n, sortString)
+		switch n.Operator {
+		case "contains":
+			return fmt.Sprintf("(str.contains %v %v)", left, right), sortBool, err
+		case "startsWith":
+			return fmt.Sprintf("(str.prefixof %v %v)", right, left), sortBool, err
+		}
+		return fmt.Sprintf("(str.suffixof %v %v)", right, left), sortBool, err
+	case "+":
+		if join(s.sortOf(n.Left), s.sortOf(n.Right)) == sortString || want == sortString {
+			left, right, err := s.operands(n, sortString)
+			return fmt.Sprintf("(str.++ %v %v)", left, right), sortString, err
+		}
+		op = "+"
+	case "-", "*":
+		op = n.Operator
+	case "/":
+		left, right, err := s.operands(n, sortReal)
+		return fmt.Sprintf("(/ %v %v)", left, right), sortReal, err
+	case "%":
+		left, right, err := s.operands(n, sortInt)
+		return fmt.Sprintf("(mod %v %v)", left, right), sortInt, err
+	default:
+		return "", "", s.errorf(n, "unsupported operator %v", n.Operator)
+	}
+	sort = s.numeric(want, n.Left, n.Right)
+	left, right, err := s.operands(n, sort)
+	return fmt.Sprintf("(%v %v %v)", op, left, right), sort, err
+}
+
+func (s *smt) operands(n *ast.BinaryNode, sort string) (string, string, error) {
+	left, err := s.term(n.Left, sort)
+	if err != nil {
+		return "", "", err
+	}
+	right, err := s.term(n.Right, sort)
+	return left, right, err
+}
+
+// in returns the term of membership in arrays of values, like x in [1, 2],
+// or in ranges, like x in 1..10.
+func (s *smt) in(n *ast.BinaryNode) (string, string, error) {
+	switch r := n.Right.(type) {
+	case *ast.ArrayNode:
+		sort := s.sortOf(n.Left)
+		for _, e := range r.Nodes {
+			sort = join(sort, s.sortOf(e))
+		}
+		if sort == "" {
+			sort = sortReal
+		}
+		x, err := s.term(n.Left, sort)
+		if err != nil {
+			return "", "", err
+		}
+		if len(r.Nodes) == 0 {
+			return "false", sortBool, nil
+		}
+		parts := make([]string, len(r.Nodes))
+		for i, e := range r.Nodes {
+			v, err := s.term(e, sort)
+			if err != nil {
+				return "", "", err
+			}
+			parts[i] = fmt.Sprintf("(= %v %v)", x, v)
+		}
+		if len(parts) == 1 {
+			return parts[0], sortBool, nil
+		}
+		return "(or " + strings.Join(parts, " ") + ")", sortBool, nil
+	case *ast.BinaryNode:
+		if r.Operator != ".." {
+			break
+		}
+		sort := s.numeric("", n.Left, r.Left, r.Right)
+		x, err := s.term(n.Left, sort)
+		if err != nil {
+			return "", "", err
+		}
+		from, to, err := s.operands(r, sort)
+		return fmt.Sprintf("(and (<= %v %v) (<= %v %v))", from, x, x, to), sortBool, err
+	}
+	return "", "", s.errorf(n, "unsupported expression %v", parser.Format(n))
+}
+
+// builtin returns terms of calls of abs, min and max.
+func (s *smt) builtin(name string, args []ast.Node, node ast.Node, want string) (string, string, error) {
+	switch {
+	case name == "abs" && len(args) == 1:
+		sort := s.numeric(want, args[0])
+		x, err := s.term(args[0], sort)
+		return fmt.Sprintf("(ite (< %v %v) (- %v) %v)", x, zero(sort), x, x), sort, err
+	case (name == "min" || name == "max") && len(args) == 2:
+		sort := s.numeric(want, args[0], args[1])
+		a, err := s.term(args[0], sort)
+		if err != nil {
+			return "", "", err
+		}
+		b, err := s.term(args[1], sort)
+		op := "<="
+		if name == "max" {
+			op = ">="
+		}
+		return fmt.Sprintf("(ite (%v %v %v) %v %v)", op, a, b, a, b), sort, err
+	}
+	return "", "", s.errorf(node, "unsupported expression %v", parser.Format(node))
+}
+
+// variable returns the constant of the variable or the field, like user or
+// user.Age, declaring it of the sort of its type, or of the wanted sort.
+func (s *smt) variable(node ast.Node, want string) (string, string, error) {
+	name, ok := path(node)
+	if !ok {
+		return "", "", s.errorf(node, "unsupported expression %v", parser.Format(node))
+	}
+	sort := typeSort(node.Type())
+	if known, ok := s.sorts[name]; ok {
+		if sort != "" && sort != known {
+			return "", "", s.errorf(node, "conflicting sorts of %v (%v and %v)", name, known, sort)
+		}
+		return symbol(name), known, nil
+	}
+	if sort == "" {
+		sort = want
+	}
+	if sort == "" {
+		sort = sortReal
+	}
+	s.sorts[name] = sort
+	s.names = append(s.names, name)
+	return symbol(name), sort, nil
+}
+
+// path returns the name of the variable or the field of constant
+// properties, like user.Address.City or items[0].
+func path(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return n.Value, true
+	case *ast.ChainNode:
+		return path(n.Node)
+	case *ast.MemberNode:
+		base, ok := path(n.Node)
+		if !ok {
+			return "", false
+		}
+		switch p := n.Property.(type) {
+		case *ast.StringNode:
+			return base + "." + p.Value, true
+		case *ast.IntegerNode:
+			return fmt.Sprintf("%v[%v]", base, p.Value), true
+		}
+	}
+	return "", false
+}
+
+// sortOf returns the sort of the node, which is known before translation,
+// or an empty string. Integer literals are of any numeric sort.
+func (s *smt) sortOf(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		return sortBool
+	case *ast.FloatNode:
+		return sortReal
+	case *ast.StringNode:
+		return sortString
+	case *ast.IdentifierNode, *ast.MemberNode, *ast.ChainNode:
+		if sort := typeSort(node.Type()); sort != "" {
+			return sort
+		}
+		if name, ok := path(node); ok {
+			return s.sorts[name]
+		}
+	case *ast.VariableNode:
+		for i := len(s.scopes) - 1; i >= 0; i-- {
+			if sort, ok := s.scopes[i][n.Name]; ok {
+				return sort
+			}
+		}
+	case *ast.UnaryNode:
+		if n.Operator == "not" || n.Operator == "!" {
+			return sortBool
+		}
+		return s.sortOf(n.Node)
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "+", "-", "*":
+			return join(s.sortOf(n.Left), s.sortOf(n.Right))
+		case "/":
+			return sortReal
+		case "%":
+			return sortInt
+		case "**", "^", "??", "..":
+			return ""
+		}
+		return sortBool
+	case *ast.ConditionalNode:
+		return join(s.sortOf(n.Exp1), s.sortOf(n.Exp2))
+	}
+	return typeSort(node.Type())
+}
+
+// numeric returns the common numeric sort of nodes and the wanted sort,
+// which is Int only if some are integers, and the rest are not known.
+func (s *smt) numeric(want string, nodes ...ast.Node) string {
+	sort := ""
+	if want == sortInt || want == sortReal {
+		sort = want
+	}
+	for _, n := range nodes {
+		sort = join(sort, s.sortOf(n))
+	}
+	if sort != sortInt {
+		return sortReal
+	}
+	return sort
+}
+
+// join returns the common sort of sorts, where integers are reals.
+func join(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	case a == sortInt && b == sortReal, a == sortReal && b == sortInt:
+		return sortReal
+	}
+	return a
+}
+
+func typeSort(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return sortBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return sortInt
+	case reflect.Float32, reflect.Float64:
+		return sortReal
+	case reflect.String:
+		return sortString
+	}
+	return ""
+}
+
+func zero(sort string) string {
+	if sort == sortInt {
+		return "0"
+	}
+	return "0.0"
+}
+
+// decimal returns the decimal of the number.
+func decimal(x float64) string {
+	s := strconv.FormatFloat(x, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	if x < 0 {
+		return "(- " + s[1:] + ")"
+	}
+	return s
+}
+
+var simpleSymbol = regexp.MustCompile(`^[a-zA-Z~!@$%^&*_+=<>.?/-][0-9a-zA-Z~!@$%^&*_+=<>.?/-]*$`)
+
+// reserved are words of SMT-LIB, which are not symbols.
+var reserved = map[string]bool{
+	"_": true, "!": true, "as": true, "let": true, "exists": true, "forall": true,
+	"match": true, "par": true, "NUMERAL": true, "DECIMAL": true, "STRING": true,
+}
+
+// symbol returns the symbol of the name, quoted if needed.
+func symbol(name string) string {
+	if simpleSymbol.MatchString(name) && !reserved[name] {
+		return name
+	}
+	return "|" + name + "|"
+}
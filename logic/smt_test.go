@@ -0,0 +1,125 @@
+package logic_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/logic"
+	"github.com/antonmedv/expr/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMT(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			`price > 0 and qty >= 1`,
+			"(declare-const price Real)\n" +
+				"(declare-const qty Real)\n" +
+				"(assert (and (> price 0.0) (>= qty 1.0)))",
+		},
+		{
+			`order.Total - order.Discount < 0`,
+			"(declare-const order.Total Real)\n" +
+				"(declare-const order.Discount Real)\n" +
+				"(assert (< (- order.Total order.Discount) 0.0))",
+		},
+		{
+			`vip or country in ["US", "CA"] and not (country == "CA")`,
+			"(declare-const vip Bool)\n" +
+				"(declare-const country String)\n" +
+				`(assert (or vip (and (or (= country "US") (= country "CA")) (not (= country "CA")))))`,
+		},
+		{
+			`age in 18..65 && n % 2 != 0`,
+			"(declare-const age Real)\n" +
+				"(declare-const n Int)\n" +
+				"(assert (and (and (<= 18.0 age) (<= age 65.0)) (not (= (mod n 2) 0))))",
+		},
+		{
+			`(vip ? price * 0.9 : price) >= -1.5`,
+			"(declare-const vip Bool)\n" +
+				"(declare-const price Real)\n" +
+				"(assert (>= (ite vip (* price 0.9) price) (- 1.5)))",
+		},
+		{
+			`let total = max(price - discount, 0); total <= abs(price)`,
+			"(declare-const price Real)\n" +
+				"(declare-const discount Real)\n" +
+				"(assert (let ((total (ite (>= (- price discount) 0.0) (- price discount) 0.0))) (<= total (ite (< price 0.0) (- price) price))))",
+		},
+		{
+			`name startsWith "a" and name endsWith "z" and items[0] == "x"`,
+			"(declare-const name String)\n" +
+				"(declare-const |items[0]| String)\n" +
+				`(assert (and (and (str.prefixof "a" name) (str.suffixof "z" name)) (= |items[0]| "x")))`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tree, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			script, err := logic.SMT(tree.Node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want+"\n(check-sat)\n", script)
+		})
+	}
+}
+
+type order struct {
+	Items    int
+	Price    float64
+	Discount float64
+	Coupon   string
+}
+
+func TestSMT_checked(t *testing.T) {
+	var nodes []ast.Node
+	for _, input := range []string{
+		`Items > 0 and Price >= 0 and Discount <= Price`,
+		`not (Items * Price - Discount >= 0)`,
+	} {
+		tree, err := parser.Parse(input)
+		require.NoError(t, err)
+		_, err = checker.Check(tree, conf.New(order{}))
+		require.NoError(t, err)
+		nodes = append(nodes, tree.Node)
+	}
+	script, err := logic.SMT(nodes...)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"(declare-const Items Int)",
+		"(declare-const Price Real)",
+		"(declare-const Discount Real)",
+		"(assert (and (and (> Items 0) (>= Price 0.0)) (<= Discount Price)))",
+		"(assert (not (>= (- (* (to_real Items) Price) Discount) 0.0)))",
+		"(check-sat)",
+		"",
+	}, "\n"), script)
+}
+
+func TestSMT_error(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`price ** 2 > 1`, `unsupported operator ** (1:7)`},
+		{`len(items) > 0`, `unsupported expression len(items) (1:1)`},
+		{`flag and flag > 1`, `mismatched sorts (Bool and Real) (1:10)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tree, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			_, err = logic.SMT(tree.Node)
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package logic
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+)
+
+// atom is a predicate, which compares the subject with literals, like
+// x > 10 or x in ["a", "b"]. Atoms of the same subject are related.
+type atom struct {
+	subject string
+	op      string
+	values  []interface{}
+}
+
+// kind of literals: float64 of numbers, string or bool.
+type kind int
+
+const (
+	numberKind kind = iota
+	stringKind
+	boolKind
+)
+
+// mirrors of comparisons.
+var mirrors = map[string]string{
+	"==": "==",
+	"!=": "!=",
+	"<":  ">",
+	">":  "<",
+	"<=": ">=",
+	">=": "<=",
+}
+
+// atom returns the atom of the predicate, or nil if the predicate is not a
+// comparison of the subject with literals of the same kind.
+func (s *Set) atom(i int, node ast.Node) *atom {
+	n, ok := node.(*ast.BinaryNode)
+	if !ok {
+		return nil
+	}
+	op, subject := n.Operator, n.Left
+	var values []interface{}
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		other := n.Right
+		if _, ok := literal(subject); ok {
+			op, subject, other = mirrors[op], other, subject
+		}
+		v, ok := literal(other)
+		if !ok {
+			return nil
+		}
+		values = append(values, v)
+	case "in":
+		array, ok := n.Right.(*ast.ArrayNode)
+		if !ok || len(array.Nodes) == 0 {
+			return nil
+		}
+		for _, e := range array.Nodes {
+			v, ok := literal(e)
+			if !ok {
+				return nil
+			}
+			values = append(values, v)
+		}
+	default:
+		return nil
+	}
+	if _, ok := literal(subject); ok {
+		return nil
+	}
+	k := kindOf(values[0])
+	for _, v := range values {
+		if kindOf(v) != k {
+			return nil
+		}
+	}
+	switch op {
+	case "<", "<=", ">", ">=":
+		if k != numberKind {
+			return nil
+		}
+	}
+	key := ast.Hash(subject)
+	if known, ok := s.subjects[key]; ok && known != k {
+		return nil
+	}
+	s.subjects[key] = k
+	return &atom{subject: key, op: op, values: values}
+}
+
+func literal(node ast.Node) (interface{}, bool) {
+	switch n := node.(type) {
+	case *ast.IntegerNode:
+		return float64(n.Value), true
+	case *ast.FloatNode:
+		return n.Value, true
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.BoolNode:
+		return n.Value, true
+	}
+	return nil, false
+}
+
+func kindOf(v interface{}) kind {
+	switch v.(type) {
+	case float64:
+		return numberKind
+	case string:
+		return stringKind
+	}
+	return boolKind
+}
+
+// holds reports whether the atom is true for the value of its subject.
+func (a *atom) holds(value interface{}) bool {
+	switch a.op {
+	case "==":
+		return value == a.values[0]
+	case "!=":
+		return value != a.values[0]
+	case "<":
+		return value.(float64) < a.values[0].(float64)
+	case "<=":
+		return value.(float64) <= a.values[0].(float64)
+	case ">":
+		return value.(float64) > a.values[0].(float64)
+	case ">=":
+		return value.(float64) >= a.values[0].(float64)
+	}
+	for _, v := range a.values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns values of the subject, which are enough to find every
+// possible assignment of its atoms: literals of atoms and values between
+// them for numbers, literals of atoms and another string for strings. As
+// numbers are real numbers here, 1 < x and x < 2 is possible, even if x is
+// an integer.
+func candidates(k kind, atoms []*atom) []interface{} {
+	switch k {
+	case boolKind:
+		return []interface{}{true, false}
+	case stringKind:
+		var b strings.Builder
+		seen := make(map[interface{}]bool)
+		var out []interface{}
+		for _, a := range atoms {
+			for _, v := range a.values {
+				if !seen[v] {
+					seen[v] = true
+					out = append(out, v)
+					b.WriteString(v.(string))
+				}
+			}
+		}
+		// The concatenation of all strings is longer than any of them.
+		b.WriteString("\x00")
+		return append(out, b.String())
+	}
+	var numbers []float64
+	for _, a := range atoms {
+		for _, v := range a.values {
+			numbers = append(numbers, v.(float64))
+		}
+	}
+	sort.Float64s(numbers)
+	out := []interface{}{numbers[0] - 1}
+	for i, x := range numbers {
+		if i > 0 && x == numbers[i-1] {
+			continue
+		}
+		out = append(out, x)
+		if i+1 < len(numbers) && numbers[i+1] != x {
+			out = append(out, (x+numbers[i+1])/2)
+		}
+	}
+	return append(out, numbers[len(numbers)-1]+1)
+}
+
+// possible returns the function, which reports whether values of related
+// predicates are possible, like x > 10 and x < 5 are not both true.
+func (s *Set) possible(vars []int) func(values []bool) bool {
+	type group struct {
+		vars    []int
+		atoms   []*atom
+		allowed map[uint64]bool
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, v := range vars {
+		a := s.atoms[v]
+		if a == nil {
+			continue
+		}
+		g, ok := groups[a.subject]
+		if !ok {
+			g = &group{allowed: make(map[uint64]bool)}
+			groups[a.subject] = g
+			order = append(order, a.subject)
+		}
+		g.vars = append(g.vars, v)
+		g.atoms = append(g.atoms, a)
+	}
+	checks := make([]*group, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		for _, value := range candidates(s.subjects[key], g.atoms) {
+			var pattern uint64
+			for j, a := range g.atoms {
+				if a.holds(value) {
+					pattern |= 1 << j
+				}
+			}
+			g.allowed[pattern] = true
+		}
+		checks = append(checks, g)
+	}
+	return func(values []bool) bool {
+		for _, g := range checks {
+			var pattern uint64
+			for j, v := range g.vars {
+				if values[v] {
+					pattern |= 1 << j
+				}
+			}
+			if !g.allowed[pattern] {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,300 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/completion"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// document is an opened expression, checked on every change.
+type document struct {
+	uri         string
+	lines       []string
+	options     []expr.Option
+	config      *conf.Config
+	tree        *parser.Tree // nil if expression does not parse
+	diagnostics []Diagnostic
+}
+
+func newDocument(uri, text string, ops []expr.Option) *document {
+	config := conf.CreateNew()
+	for _, op := range ops {
+		op(config)
+	}
+	d := &document{
+		uri:         uri,
+		lines:       strings.Split(text, "\n"),
+		options:     ops,
+		config:      config,
+		diagnostics: []Diagnostic{},
+	}
+	tree, err := parser.ParseWithOptions(text, config.ParserOptions())
+	if err != nil {
+		d.report(err, SeverityError)
+		return d
+	}
+	d.tree = tree
+	if _, err := checker.Check(tree, config); err != nil {
+		d.report(err, SeverityError)
+		return d
+	}
+	for _, w := range checker.Warnings(tree, config) {
+		d.report(w, SeverityWarning)
+	}
+	warnings, err := checker.Rules(tree, config)
+	if err != nil {
+		d.report(err, SeverityError)
+	}
+	for _, w := range warnings {
+		d.report(w, SeverityWarning)
+	}
+	return d
+}
+
+func (d *document) report(err error, severity int) {
+	diagnostic := Diagnostic{Severity: severity, Source: "expr", Message: err.Error()}
+	var fileError *file.Error
+	if errors.As(err, &fileError) {
+		diagnostic.Message = fileError.Message
+		diagnostic.Range = d.rangeOf(fileError.Location)
+		if end := fileError.End; end.Line > 0 && end.Line-1 < len(d.lines) {
+			diagnostic.Range.End = Position{Line: end.Line - 1, Character: d.character(end.Line-1, end.Column)}
+		}
+	}
+	d.diagnostics = append(d.diagnostics, diagnostic)
+}
+
+// rangeOf returns range of the token at the location.
+func (d *document) rangeOf(loc file.Location) Range {
+	line := loc.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return Range{}
+	}
+	from, to := file.Span(d.lines[line], loc.Column)
+	return Range{
+		Start: Position{Line: line, Character: d.character(line, from)},
+		End:   Position{Line: line, Character: d.character(line, to)},
+	}
+}
+
+// character converts column in runes to offset in UTF-16 code units.
+func (d *document) character(line, column int) int {
+	character := 0
+	for i, r := range []rune(d.lines[line]) {
+		if i >= column {
+			break
+		}
+		character += len(utf16.Encode([]rune{r}))
+	}
+	return character
+}
+
+// column converts offset in UTF-16 code units to column in runes.
+func (d *document) column(pos Position) int {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return 0
+	}
+	column, character := 0, 0
+	for _, r := range d.lines[pos.Line] {
+		if character >= pos.Character {
+			break
+		}
+		character += len(utf16.Encode([]rune{r}))
+		column++
+	}
+	return column
+}
+
+type collector []ast.Node
+
+func (c *collector) Visit(node *ast.Node) {
+	*c = append(*c, *node)
+}
+
+// nodes returns nodes of the tree, children before parents.
+func nodes(node ast.Node) []ast.Node {
+	var c collector
+	ast.Walk(&node, &c)
+	return c
+}
+
+func (d *document) hover(pos Position) *Hover {
+	if d.tree == nil {
+		return nil
+	}
+	info := expr.TypeAt(d.tree, d.offset(pos), d.options...)
+	if info == nil {
+		return nil
+	}
+	text := parser.Format(info.Node) + ": " + typeName(info.Type)
+	if f, ok := d.function(info.Node); ok && len(f.Types) > 0 {
+		text = completion.Signatures(f.Name, f.Types)
+	}
+	value := "```\n" + text + "\n```"
+	if info.Doc != "" {
+		value += "\n\n" + info.Doc
+	}
+	r := Range{Start: d.position(info.From), End: d.position(info.To)}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: value},
+		Range:    &r,
+	}
+}
+
+// offset converts position to offset in bytes.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return -1
+	}
+	offset := 0
+	for _, line := range d.lines[:pos.Line] {
+		offset += len(line) + 1
+	}
+	return offset + len(string([]rune(d.lines[pos.Line])[:d.column(pos)]))
+}
+
+// position converts offset in bytes to position.
+func (d *document) position(offset int) Position {
+	for line, text := range d.lines {
+		if offset <= len(text) {
+			column := len([]rune(text[:offset]))
+			return Position{Line: line, Character: d.character(line, column)}
+		}
+		offset -= len(text) + 1
+	}
+	return Position{}
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "interface {}"
+	}
+	return t.String()
+}
+
+// function returns builtin function of the node, like upper or
+// strings.trim, which is not shadowed by the environment.
+func (d *document) function(node ast.Node) (*builtin.Function, bool) {
+	name := ""
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		name = n.Value
+	case *ast.MemberNode:
+		id, ok := n.Node.(*ast.IdentifierNode)
+		property, ok2 := n.Property.(*ast.StringNode)
+		if !ok || !ok2 {
+			return nil, false
+		}
+		name = id.Value + "." + property.Value
+	default:
+		return nil, false
+	}
+	if _, env := d.config.Types[strings.SplitN(name, ".", 2)[0]]; env {
+		return nil, false
+	}
+	f, ok := d.config.Functions[name]
+	return f, ok
+}
+
+// definition returns range of array, which elements are referred by the
+// pointer at the position, like # or .Name inside closure of builtin.
+func (d *document) definition(pos Position) *Range {
+	if d.tree == nil {
+		return nil
+	}
+	info := expr.TypeAt(d.tree, d.offset(pos), d.options...)
+	if info == nil {
+		return nil
+	}
+	node := info.Node
+	if m, ok := node.(*ast.MemberNode); ok {
+		node = m.Node
+	}
+	pointer, ok := node.(*ast.PointerNode)
+	if !ok {
+		return nil
+	}
+	// Inner builtins come first, so pointers of nested closures are bound
+	// to the nearest builtin.
+	owners := make(map[ast.Node]ast.Node)
+	for _, n := range nodes(d.tree.Node) {
+		b, ok := n.(*ast.BuiltinNode)
+		if !ok || len(b.Arguments) < 2 {
+			continue
+		}
+		if _, ok := b.Arguments[1].(*ast.ClosureNode); !ok {
+			continue
+		}
+		for _, p := range nodes(b.Arguments[1]) {
+			if _, ok := p.(*ast.PointerNode); ok && owners[p] == nil {
+				owners[p] = b.Arguments[0]
+			}
+		}
+	}
+	array, ok := owners[pointer]
+	if !ok {
+		return nil
+	}
+	r := d.extent(array)
+	return &r
+}
+
+// extent returns range covering tokens of all nodes of the tree.
+func (d *document) extent(node ast.Node) Range {
+	var r Range
+	for i, n := range nodes(node) {
+		nr := d.rangeOf(n.Location())
+		if i == 0 || before(nr.Start, r.Start) {
+			r.Start = nr.Start
+		}
+		if i == 0 || before(r.End, nr.End) {
+			r.End = nr.End
+		}
+	}
+	return r
+}
+
+func before(a, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+// complete returns items completing the word before the position.
+func (d *document) complete(pos Position) []CompletionItem {
+	offset := d.offset(pos)
+	if offset < 0 {
+		return []CompletionItem{}
+	}
+	result := completion.CompleteWithConfig(strings.Join(d.lines, "\n"), offset, d.config)
+	items := make([]CompletionItem, len(result.Candidates))
+	for i, c := range result.Candidates {
+		items[i] = CompletionItem{
+			Label:         c.Label,
+			Kind:          kinds[c.Kind],
+			Detail:        c.Type,
+			Documentation: c.Doc,
+			SortText:      fmt.Sprintf("%04d", i),
+		}
+	}
+	return items
+}
+
+var kinds = map[completion.Kind]int{
+	completion.Variable:  KindVariable,
+	completion.Field:     KindField,
+	completion.Key:       KindField,
+	completion.Method:    KindMethod,
+	completion.Function:  KindFunction,
+	completion.Namespace: KindModule,
+	completion.Keyword:   KindKeyword,
+}
@@ -0,0 +1,212 @@
+// Package lsp implements a server of the Language Server Protocol for
+// expressions, which offers diagnostics, hover with types, completion of
+// names of the environment and go-to-definition of elements of closures.
+//
+// Every document holds a single expression, which is checked with the
+// environment and options of the server. The server uses JSON-RPC framed
+// with Content-Length headers, usually over standard input and output.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/antonmedv/expr"
+)
+
+// Server serves clients of the protocol. Documents are checked with Env
+// and Options, which must not be changed while serving.
+type Server struct {
+	Env     interface{}
+	Options []expr.Option
+
+	out       io.Writer
+	documents map[string]*document
+}
+
+// NewServer creates server for expressions of the environment.
+func NewServer(env interface{}, ops ...expr.Option) *Server {
+	return &Server{Env: env, Options: ops}
+}
+
+// Serve reads messages from in and writes responses and notifications to
+// out, until the exit notification or the end of in.
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	s.documents = make(map[string]*document)
+	reader := bufio.NewReader(in)
+	for {
+		body, err := readMessage(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(&req)
+		if req.ID == nil {
+			continue // notification
+		}
+		if err := s.reply(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full content on every change
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]string{"name": "expr"},
+		}, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.publish(params.TextDocument.URI, []Diagnostic{})
+
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var params positionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		switch req.Method {
+		case "textDocument/hover":
+			if h := doc.hover(params.Position); h != nil {
+				return h, nil
+			}
+		case "textDocument/definition":
+			if r := doc.definition(params.Position); r != nil {
+				return Location{URI: doc.uri, Range: *r}, nil
+			}
+		case "textDocument/completion":
+			return CompletionList{Items: doc.complete(params.Position)}, nil
+		}
+		return nil, nil
+
+	default:
+		if req.ID != nil && !strings.HasPrefix(req.Method, "$/") {
+			return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %v is not supported", req.Method)}
+		}
+	}
+	return nil, nil
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+func (s *Server) update(uri, text string) {
+	doc := newDocument(uri, text, s.options())
+	s.documents[uri] = doc
+	s.publish(uri, doc.diagnostics)
+}
+
+func (s *Server) options() []expr.Option {
+	var ops []expr.Option
+	if s.Env != nil {
+		ops = append(ops, expr.Env(s.Env))
+	}
+	return append(ops, s.Options...)
+}
+
+func (s *Server) publish(uri string, diagnostics []Diagnostic) {
+	_ = s.write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}, err *responseError) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	res := response{JSONRPC: "2.0", ID: id, Error: err}
+	if err == nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		res.Result = b
+	}
+	return s.write(res)
+}
+
+func (s *Server) write(message interface{}) error {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	return err
+}
+
+// readMessage reads body of message framed with Content-Length header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,217 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Name    string
+	Age     int
+	Friends []user
+}
+
+func (u user) Greet(greeting string) string { return greeting + ", " + u.Name }
+
+type env struct {
+	User  user
+	Users []user
+	Limit int
+}
+
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// session sends requests to the server and returns its messages.
+func session(t *testing.T, requests ...string) []message {
+	var in bytes.Buffer
+	for _, r := range requests {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(r), r)
+	}
+	var out bytes.Buffer
+	require.NoError(t, lsp.NewServer(env{}).Serve(&in, &out))
+
+	var messages []message
+	reader := bufio.NewReader(&out)
+	for {
+		header, err := textproto.NewReader(reader).ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		require.NoError(t, err)
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		require.NoError(t, err)
+		body := make([]byte, length)
+		_, err = io.ReadFull(reader, body)
+		require.NoError(t, err)
+		var m message
+		require.NoError(t, json.Unmarshal(body, &m), string(body))
+		messages = append(messages, m)
+	}
+}
+
+func open(text string) string {
+	b, _ := json.Marshal(text)
+	return `{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": {"textDocument": {"uri": "file:///rule.expr", "version": 1, "text": ` + string(b) + `}}}`
+}
+
+func at(method string, line, character int) string {
+	return fmt.Sprintf(`{"jsonrpc": "2.0", "id": 2, "method": %q, "params": {"textDocument": {"uri": "file:///rule.expr"}, "position": {"line": %d, "character": %d}}}`, method, line, character)
+}
+
+func TestServer_initialize(t *testing.T) {
+	messages := session(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`,
+		`{"jsonrpc": "2.0", "method": "initialized", "params": {}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "unknown"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "shutdown"}`,
+		`{"jsonrpc": "2.0", "method": "exit"}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "shutdown"}`,
+	)
+	require.Len(t, messages, 3)
+	require.Equal(t, `1`, string(messages[0].ID))
+	require.Contains(t, string(messages[0].Result), `"hoverProvider":true`)
+	require.Equal(t, -32601, messages[1].Error.Code)
+	require.Equal(t, `3`, string(messages[2].ID))
+	require.Equal(t, `null`, string(messages[2].Result))
+}
+
+func TestServer_diagnostics(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`User.Age > Limit`, `[]`},
+		{"User.Age >\n  User.Nme", `[{"range":{"start":{"line":1,"character":7},"end":{"line":1,"character":10}},"severity":1,"source":"expr","message":"type lsp_test.user has no field Nme, did you mean Name?"}]`},
+		{`User.Name + `, `[{"range":{"start":{"line":0,"character":11},"end":{"line":0,"character":12}},"severity":1,"source":"expr","message":"unexpected token EOF"}]`},
+		{`"ö" + User.Nme`, `[{"range":{"start":{"line":0,"character":11},"end":{"line":0,"character":14}},"severity":1,"source":"expr","message":"type lsp_test.user has no field Nme, did you mean Name?"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			messages := session(t, open(tt.text))
+			require.Len(t, messages, 1)
+			require.Equal(t, "textDocument/publishDiagnostics", messages[0].Method)
+			require.JSONEq(t, `{"uri": "file:///rule.expr", "diagnostics": `+tt.want+`}`, string(messages[0].Params))
+		})
+	}
+}
+
+func TestServer_didChange(t *testing.T) {
+	messages := session(t,
+		open(`User.Nme`),
+		`{"jsonrpc": "2.0", "method": "textDocument/didChange", "params": {"textDocument": {"uri": "file:///rule.expr", "version": 2}, "contentChanges": [{"text": "User.Name"}]}}`,
+		`{"jsonrpc": "2.0", "method": "textDocument/didClose", "params": {"textDocument": {"uri": "file:///rule.expr"}}}`,
+		at("textDocument/hover", 0, 6),
+	)
+	require.Len(t, messages, 4)
+	require.Contains(t, string(messages[0].Params), "has no field Nme")
+	require.Contains(t, string(messages[1].Params), `"diagnostics":[]`)
+	require.Contains(t, string(messages[2].Params), `"diagnostics":[]`)
+	require.Equal(t, `null`, string(messages[3].Result))
+}
+
+func TestServer_hover(t *testing.T) {
+	tests := []struct {
+		text      string
+		character int
+		want      string
+		doc       string
+	}{
+		{`User.Age > Limit`, 6, "User.Age: int", ""},
+		{`User.Age > Limit`, 9, "User.Age > Limit: bool", ""},
+		{`User.Age > Limit`, 12, "Limit: int", ""},
+		{`User.Greet("hi")`, 7, "User.Greet: func(string) string", ""},
+		{`hash.sha256(User.Name)`, 7, "hash.sha256(string) string", "Returns hex encoded SHA-256 digest of string."},
+		{`all(Users, {#.Age > 18})`, 1, "all(Users, {.Age > 18}): bool", "Reports whether all elements satisfy the predicate."},
+		{`all(Users, {#.Age > 18})`, 12, "#: lsp_test.user", ""},
+		{`User.Age > Limit`, 4, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			messages := session(t, open(tt.text), at("textDocument/hover", 0, tt.character))
+			require.Len(t, messages, 2)
+			if tt.want == "" {
+				require.Equal(t, `null`, string(messages[1].Result))
+				return
+			}
+			var hover lsp.Hover
+			require.NoError(t, json.Unmarshal(messages[1].Result, &hover))
+			want := "```\n" + tt.want + "\n```"
+			if tt.doc != "" {
+				want += "\n\n" + tt.doc
+			}
+			require.Equal(t, want, hover.Contents.Value)
+		})
+	}
+}
+
+func TestServer_completion(t *testing.T) {
+	tests := []struct {
+		text      string
+		character int
+		want      []string
+	}{
+		{`Us`, 2, []string{"User:6", "Users:6"}},
+		{`1 + hash.sha`, 12, []string{"sha256:3"}},
+		{`User.`, 5, []string{"Age:5", "Friends:5", "Name:5", "Greet:2"}},
+		{`User.Friends[0].N`, 17, []string{"Name:5"}},
+		{`strings.tr`, 10, []string{"trim:3", "trimPrefix:3", "trimSuffix:3"}},
+		{`Unknown.`, 8, []string{}},
+		{`User.Na > 1`, 7, []string{"Name:5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			messages := session(t, open(tt.text), at("textDocument/completion", 0, tt.character))
+			require.Len(t, messages, 2)
+			var list lsp.CompletionList
+			require.NoError(t, json.Unmarshal(messages[1].Result, &list))
+			labels := []string{}
+			for _, item := range list.Items {
+				labels = append(labels, item.Label+":"+strconv.Itoa(item.Kind))
+			}
+			require.Equal(t, tt.want, labels)
+		})
+	}
+}
+
+func TestServer_definition(t *testing.T) {
+	text := "all(User.Friends, {\n  any(Users, {.Age > #.Age}) and #.Name != \"\"\n})"
+	tests := []struct {
+		line, character int
+		want            string
+	}{
+		{1, 16, `{"start":{"line":1,"character":6},"end":{"line":1,"character":11}}`},
+		{1, 23, `{"start":{"line":1,"character":6},"end":{"line":1,"character":11}}`},
+		{1, 35, `{"start":{"line":0,"character":4},"end":{"line":0,"character":16}}`},
+		{0, 10, ``},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Split(text, "\n")[tt.line][tt.character:], func(t *testing.T) {
+			messages := session(t, open(text), at("textDocument/definition", tt.line, tt.character))
+			require.Len(t, messages, 2)
+			if tt.want == "" {
+				require.Equal(t, `null`, string(messages[1].Result))
+				return
+			}
+			require.JSONEq(t, `{"uri": "file:///rule.expr", "range": `+tt.want+`}`, string(messages[1].Result))
+		})
+	}
+}
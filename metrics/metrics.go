@@ -0,0 +1,47 @@
+// Package metrics instruments compilations and runs of programs: counts,
+// durations, errors and exceeded limits, so operators of many expressions
+// can observe them. Metrics are reported to Prometheus and OpenTelemetry by
+// the separate modules github.com/antonmedv/expr/exprprom and
+// github.com/antonmedv/expr/exprotel:
+//
+//	m := exprprom.NewMetrics("expr")
+//	prometheus.MustRegister(m)
+//
+//	program, err := expr.Compile(`user.Age >= 18`, expr.Env(env), expr.Metrics("adult", m))
+package metrics
+
+import (
+	"time"
+)
+
+// Limits reported by Metrics.LimitExceeded.
+const (
+	// Bytecode, Constants and Stack are limits of sizes of programs, given
+	// by expr.Limits, which are exceeded during compilation.
+	Bytecode  = "bytecode"
+	Constants = "constants"
+	Stack     = "stack"
+	// Memory is the memory budget of runs.
+	Memory = "memory"
+	// Timeout is the deadline of calls of functions with context.
+	Timeout = "timeout"
+)
+
+// Metrics receives measurements of compilations and runs of programs, with
+// IDs of expressions given by expr.Metrics. Programs may be run by many
+// goroutines, so metrics must be safe for concurrent use.
+type Metrics interface {
+	// Compiled is called after compilations, with their errors, if any.
+	Compiled(id string, duration time.Duration, err error)
+	// Ran is called after runs, with their errors, if any.
+	Ran(id string, duration time.Duration, err error)
+	// LimitExceeded is called, if a compilation or a run fails, because it
+	// exceeds the limit, like Memory.
+	LimitExceeded(id string, limit string)
+}
+
+// Config of metrics of a program.
+type Config struct {
+	ID      string
+	Metrics Metrics
+}
@@ -15,11 +15,12 @@ type constExpr struct {
 	applied bool
 	err     error
 	fns     map[string]reflect.Value
+	guarded map[Node]bool
 }
 
 func (c *constExpr) Visit(node *Node) {
 	defer func() {
-		if r := recover(); r != nil {
+		if r := recover(); r != nil && !c.guarded[*node] {
 			msg := fmt.Sprintf("%v", r)
 			// Make message more actual, it's a runtime error, but at compile step.
 			msg = strings.Replace(msg, "runtime error:", "compile error:", 1)
@@ -36,32 +37,41 @@ func (c *constExpr) Visit(node *Node) {
 	}
 
 	if call, ok := (*node).(*CallNode); ok {
+		if call.Func != nil {
+			if call.Func.NonDeterministic || call.Func.NoFold {
+				return
+			}
+			params, ok := constParams(call.Arguments)
+			if !ok {
+				return // Const expr optimization not applicable.
+			}
+			value, err := call.Func.Func(params...)
+			if err != nil {
+				if c.guarded[*node] {
+					return
+				}
+				c.err = &file.Error{
+					Location: (*node).Location(),
+					Message:  err.Error(),
+				}
+				return
+			}
+			if value == nil {
+				patch(&NilNode{})
+				return
+			}
+			patch(&ConstantNode{Value: value})
+			return
+		}
 		if name, ok := call.Callee.(*IdentifierNode); ok {
 			fn, ok := c.fns[name.Value]
 			if ok {
-				in := make([]reflect.Value, len(call.Arguments))
-				for i := 0; i < len(call.Arguments); i++ {
-					arg := call.Arguments[i]
-					var param interface{}
-
-					switch a := arg.(type) {
-					case *NilNode:
-						param = nil
-					case *IntegerNode:
-						param = a.Value
-					case *FloatNode:
-						param = a.Value
-					case *BoolNode:
-						param = a.Value
-					case *StringNode:
-						param = a.Value
-					case *ConstantNode:
-						param = a.Value
-
-					default:
-						return // Const expr optimization not applicable.
-					}
-
+				params, ok := constParams(call.Arguments)
+				if !ok {
+					return // Const expr optimization not applicable.
+				}
+				in := make([]reflect.Value, len(params))
+				for i, param := range params {
 					if param == nil && reflect.TypeOf(param) == nil {
 						// In case of nil value and nil type use this hack,
 						// otherwise reflect.Call will panic on zero value.
@@ -74,6 +84,9 @@ func (c *constExpr) Visit(node *Node) {
 				out := fn.Call(in)
 				value := out[0].Interface()
 				if len(out) == 2 && out[1].Type() == errorType && !out[1].IsNil() {
+					if c.guarded[*node] {
+						return
+					}
 					c.err = out[1].Interface().(error)
 					return
 				}
@@ -83,3 +96,27 @@ func (c *constExpr) Visit(node *Node) {
 		}
 	}
 }
+
+// constParams returns values of arguments if all of them are constants.
+func constParams(arguments []Node) ([]interface{}, bool) {
+	params := make([]interface{}, len(arguments))
+	for i, arg := range arguments {
+		switch a := arg.(type) {
+		case *NilNode:
+			params[i] = nil
+		case *IntegerNode:
+			params[i] = a.Value
+		case *FloatNode:
+			params[i] = a.Value
+		case *BoolNode:
+			params[i] = a.Value
+		case *StringNode:
+			params[i] = a.Value
+		case *ConstantNode:
+			params[i] = a.Value
+		default:
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -11,6 +11,21 @@ import (
 type fold struct {
 	applied bool
 	err     *file.Error
+	guarded map[Node]bool
+	// zeroDivision is set, if result of division by zero is configured.
+	zeroDivision bool
+	// nonFinite is set, if NaN and infinities are checked at runtime.
+	nonFinite bool
+}
+
+func isZero(node Node) bool {
+	switch n := node.(type) {
+	case *IntegerNode:
+		return n.Value == 0
+	case *FloatNode:
+		return n.Value == 0
+	}
+	return false
 }
 
 func (fold *fold) Visit(node *Node) {
@@ -21,6 +36,11 @@ func (fold *fold) Visit(node *Node) {
 	// for IntegerNode the type may have been changed from int->float
 	// preserve this information by setting the type after the Patch
 	patchWithType := func(newNode Node, leafType reflect.Type) {
+		if f, ok := newNode.(*FloatNode); ok && fold.nonFinite {
+			if math.IsNaN(f.Value) || math.IsInf(f.Value, 0) {
+				return // NaN and infinities are checked at runtime.
+			}
+		}
 		patch(newNode)
 		newNode.SetType(leafType)
 	}
@@ -141,6 +161,9 @@ func (fold *fold) Visit(node *Node) {
 				}
 			}
 		case "/":
+			if fold.zeroDivision && isZero(n.Right) {
+				return // Result of division by zero is defined at runtime.
+			}
 			{
 				a := toInteger(n.Left)
 				b := toInteger(n.Right)
@@ -170,9 +193,15 @@ func (fold *fold) Visit(node *Node) {
 				}
 			}
 		case "%":
+			if fold.zeroDivision && isZero(n.Right) {
+				return
+			}
 			if a, ok := n.Left.(*IntegerNode); ok {
 				if b, ok := n.Right.(*IntegerNode); ok {
 					if b.Value == 0 {
+						if fold.guarded[*node] {
+							return
+						}
 						fold.err = &file.Error{
 							Location: (*node).Location(),
 							Message:  "integer divide by zero",
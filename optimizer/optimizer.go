@@ -1,6 +1,8 @@
 package optimizer
 
 import (
+	"reflect"
+
 	. "github.com/antonmedv/expr/ast"
 	"github.com/antonmedv/expr/conf"
 )
@@ -8,7 +10,11 @@ import (
 func Optimize(node *Node, config *conf.Config) error {
 	Walk(node, &inArray{})
 	for limit := 1000; limit >= 0; limit-- {
-		fold := &fold{}
+		fold := &fold{
+			guarded:      guarded(node),
+			zeroDivision: config != nil && config.ZeroDivision != nil,
+			nonFinite:    config != nil && config.NonFinite != nil,
+		}
 		Walk(node, fold)
 		if fold.err != nil {
 			return fold.err
@@ -17,21 +23,50 @@ func Optimize(node *Node, config *conf.Config) error {
 			break
 		}
 	}
-	if config != nil && len(config.ConstFns) > 0 {
-		for limit := 100; limit >= 0; limit-- {
-			constExpr := &constExpr{
-				fns: config.ConstFns,
-			}
-			Walk(node, constExpr)
-			if constExpr.err != nil {
-				return constExpr.err
-			}
-			if !constExpr.applied {
-				break
-			}
+	var fns map[string]reflect.Value
+	if config != nil {
+		fns = config.ConstFns
+	}
+	for limit := 100; limit >= 0; limit-- {
+		constExpr := &constExpr{
+			fns:     fns,
+			guarded: guarded(node),
+		}
+		Walk(node, constExpr)
+		if constExpr.err != nil {
+			return constExpr.err
+		}
+		if !constExpr.applied {
+			break
 		}
 	}
 	Walk(node, &inRange{})
 	Walk(node, &constRange{})
 	return nil
 }
+
+// guarded returns nodes inside the first argument of try. Errors of these
+// nodes are left to runtime, where they are caught.
+func guarded(node *Node) map[Node]bool {
+	g := &tryGuard{nodes: map[Node]bool{}}
+	Walk(node, g)
+	return g.nodes
+}
+
+type tryGuard struct {
+	nodes map[Node]bool
+}
+
+func (g *tryGuard) Visit(node *Node) {
+	if n, ok := (*node).(*BuiltinNode); ok && (n.Name == "try" || n.Name == "fallback") {
+		Walk(&n.Arguments[0], &collect{nodes: g.nodes})
+	}
+}
+
+type collect struct {
+	nodes map[Node]bool
+}
+
+func (c *collect) Visit(node *Node) {
+	c.nodes[*node] = true
+}
@@ -126,3 +126,37 @@ func TestOptimize_const_expr(t *testing.T) {
 
 	assert.Equal(t, ast.Dump(expected), ast.Dump(tree.Node))
 }
+
+func TestOptimize_const_builtin(t *testing.T) {
+	tree, err := parser.Parse(`hash.sha256("abc") == hash`)
+	require.NoError(t, err)
+
+	_, err = checker.Check(tree, nil)
+	require.NoError(t, err)
+
+	err = optimizer.Optimize(&tree.Node, nil)
+	require.NoError(t, err)
+
+	expected := &ast.BinaryNode{
+		Operator: "==",
+		Left:     &ast.ConstantNode{Value: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		Right:    &ast.IdentifierNode{Value: "hash", Deref: true},
+	}
+
+	assert.Equal(t, ast.Dump(expected), ast.Dump(tree.Node))
+}
+
+func TestOptimize_const_builtin_non_deterministic(t *testing.T) {
+	tree, err := parser.Parse(`rand.uuid()`)
+	require.NoError(t, err)
+
+	_, err = checker.Check(tree, nil)
+	require.NoError(t, err)
+
+	err = optimizer.Optimize(&tree.Node, nil)
+	require.NoError(t, err)
+
+	call, ok := tree.Node.(*ast.CallNode)
+	require.True(t, ok)
+	assert.Equal(t, "rand.uuid", call.Func.Name)
+}
@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	. "github.com/antonmedv/expr/ast"
+)
+
+// Format returns source code of the node in canonical form: operators are
+// separated by spaces, and only required parentheses are kept. Parsing of
+// the formatted code returns the same tree.
+func Format(node Node) string {
+	switch n := node.(type) {
+	case *NilNode:
+		return "nil"
+	case *IdentifierNode:
+		return n.Value
+	case *IntegerNode:
+		return strconv.Itoa(n.Value)
+	case *FloatNode:
+		return formatFloat(n.Value)
+	case *BoolNode:
+		return strconv.FormatBool(n.Value)
+	case *StringNode:
+		return strconv.Quote(n.Value)
+	case *ConstantNode:
+		return formatConstant(n.Value)
+	case *UnaryNode:
+		return formatUnary(n)
+	case *BinaryNode:
+		return formatBinary(n)
+	case *ChainNode:
+		return Format(n.Node)
+	case *MemberNode:
+		return formatMember(n)
+	case *SliceNode:
+		s := formatOperand(n.Node) + "["
+		if n.From != nil {
+			s += Format(n.From)
+		}
+		s += ":"
+		if n.To != nil {
+			s += Format(n.To)
+		}
+		return s + "]"
+	case *CallNode:
+		return Format(n.Callee) + "(" + formatList(n.Arguments) + ")"
+	case *BuiltinNode:
+		return n.Name + "(" + formatList(n.Arguments) + ")"
+	case *ClosureNode:
+		return "{" + Format(n.Node) + "}"
+	case *PointerNode:
+		return "#" + n.Name
+	case *ConditionalNode:
+		cond := Format(n.Cond)
+		switch n.Cond.(type) {
+		case *ConditionalNode, *BindNode:
+			cond = "(" + cond + ")"
+		}
+		return cond + " ? " + Format(n.Exp1) + " : " + Format(n.Exp2)
+	case *ArrayNode:
+		return "[" + formatList(n.Nodes) + "]"
+	case *MapNode:
+		pairs := make([]string, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			pairs[i] = Format(pair)
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *PairNode:
+		key := "(" + Format(n.Key) + ")"
+		if s, ok := n.Key.(*StringNode); ok {
+			key = strconv.Quote(s.Value)
+			if isValidIdentifier(s.Value) && !isOperator(s.Value) {
+				key = s.Value
+			}
+		}
+		return key + ": " + Format(n.Value)
+	case *VariableNode:
+		return n.Name
+	case *LetNode:
+		return "let " + n.Name + " = " + Format(n.Value)
+	case *AssignNode:
+		return n.Name + " = " + Format(n.Value)
+	case *BlockNode:
+		s := make([]string, len(n.Nodes))
+		for i, node := range n.Nodes {
+			s[i] = Format(node)
+		}
+		return strings.Join(s, "; ")
+	case *TupleNode:
+		return "(" + formatList(n.Nodes) + ")"
+	case *BindNode:
+		names := strings.Join(n.Names, ", ")
+		if n.Tuple {
+			names = "(" + names + ")"
+		}
+		return "let " + names + " = " + Format(n.Value) + "; " + Format(n.Body)
+	case *ComprehensionNode:
+		s := Format(n.Node) + " for " + n.Name + " in " + Format(n.Items)
+		if n.Cond != nil {
+			s += " if " + Format(n.Cond)
+		}
+		if _, ok := n.Node.(*PairNode); ok {
+			return "{" + s + "}"
+		}
+		return "[" + s + "]"
+	case *SharedNode:
+		switch n.Node.(type) {
+		case *UnaryNode, *BinaryNode, *ConditionalNode:
+			return "(" + Format(n.Node) + ")"
+		}
+		return Format(n.Node)
+	}
+	panic(fmt.Sprintf("undefined node type (%T)", node))
+}
+
+func formatList(nodes []Node) string {
+	s := make([]string, len(nodes))
+	for i, node := range nodes {
+		s[i] = Format(node)
+	}
+	return strings.Join(s, ", ")
+}
+
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return s
+	}
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func formatConstant(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return formatFloat(v)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// negated are operators, which are written after "not", like "a not in b".
+var negated = map[string]bool{
+	"in":         true,
+	"matches":    true,
+	"like":       true,
+	"contains":   true,
+	"startsWith": true,
+	"endsWith":   true,
+}
+
+func formatUnary(n *UnaryNode) string {
+	if b, ok := n.Node.(*BinaryNode); ok && n.Operator == "not" && negated[b.Operator] {
+		return formatBinaryOperator(b, "not "+b.Operator)
+	}
+	op := unaryOperators[n.Operator]
+	operand := Format(n.Node)
+	switch c := n.Node.(type) {
+	case *BinaryNode:
+		if precedence(c) < op.precedence {
+			operand = "(" + operand + ")"
+		}
+	case *UnaryNode, *ConditionalNode, *BindNode:
+		operand = "(" + operand + ")"
+	}
+	if n.Operator == "not" {
+		return "not " + operand
+	}
+	return n.Operator + operand
+}
+
+func formatBinary(n *BinaryNode) string {
+	return formatBinaryOperator(n, n.Operator)
+}
+
+func formatBinaryOperator(n *BinaryNode, operator string) string {
+	op := binaryOperators[n.Operator]
+	a, b := Format(n.Left), Format(n.Right)
+	if needParens(n.Left, op, op.associativity == right) {
+		a = "(" + a + ")"
+	}
+	if needParens(n.Right, op, op.associativity == left) {
+		b = "(" + b + ")"
+	}
+	return a + " " + operator + " " + b
+}
+
+// needParens reports whether operand of binary operator must be enclosed in
+// parentheses. Operand with operator of the same precedence must be enclosed
+// if it is on the side opposite to associativity of the operator.
+func needParens(operand Node, op operator, opposite bool) bool {
+	switch n := operand.(type) {
+	case *ConditionalNode, *BindNode:
+		return true
+	case *UnaryNode:
+		if b, ok := n.Node.(*BinaryNode); ok && n.Operator == "not" && negated[b.Operator] {
+			return needParens(b, op, opposite)
+		}
+		return unaryOperators[n.Operator].precedence <= op.precedence
+	case *BinaryNode:
+		p := precedence(n)
+		return p < op.precedence || (p == op.precedence && opposite)
+	}
+	return false
+}
+
+// isOperator reports whether word is an operator, like "in", which can not
+// be used as a key of map without quotes.
+func isOperator(word string) bool {
+	_, binary := binaryOperators[word]
+	_, unary := unaryOperators[word]
+	return binary || unary
+}
+
+func precedence(n *BinaryNode) int {
+	return binaryOperators[n.Operator].precedence
+}
+
+func formatMember(n *MemberNode) string {
+	base := formatOperand(n.Node)
+	if _, ok := n.Node.(*PointerNode); ok {
+		base = ""
+		if s, ok := n.Property.(*StringNode); !ok || !isValidIdentifier(s.Value) {
+			base = "#"
+		}
+	}
+	if s, ok := n.Property.(*StringNode); ok && isValidIdentifier(s.Value) {
+		if n.Optional {
+			return base + "?." + s.Value
+		}
+		return base + "." + s.Value
+	}
+	return base + "[" + Format(n.Property) + "]"
+}
+
+// formatOperand formats base of member, slice or call, enclosing operators
+// and literals in parentheses.
+func formatOperand(node Node) string {
+	switch node.(type) {
+	case *UnaryNode, *BinaryNode, *ConditionalNode,
+		*NilNode, *IntegerNode, *FloatNode, *BoolNode, *StringNode, *ConstantNode:
+		return "(" + Format(node) + ")"
+	}
+	return Format(node)
+}
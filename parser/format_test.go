@@ -0,0 +1,76 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`a+b*c`, `a + b * c`},
+		{`(a+b)*c`, `(a + b) * c`},
+		{`a-(b-c)`, `a - (b - c)`},
+		{`(a-b)-c`, `a - b - c`},
+		{`a**b**c`, `a ** b ** c`},
+		{`(a**b)**c`, `(a ** b) ** c`},
+		{`(-a)**2`, `(-a) ** 2`},
+		{`-a**2`, `-a ** 2`},
+		{`-a*b`, `-a * b`},
+		{`not a == b`, `not a == b`},
+		{`not (a == b)`, `not (a == b)`},
+		{`!(a && b) || c`, `!(a && b) || c`},
+		{`a * (not b) + c`, `a * (not b) + c`},
+		{`- -a`, `-(-a)`},
+		{`a not in b`, `a not in b`},
+		{`not (a in b)`, `a not in b`},
+		{`(a not in b) == c`, `a not in b == c`},
+		{`a == (b not in c)`, `a == (b not in c)`},
+		{`a ? b : c ? d : e`, `a ? b : c ? d : e`},
+		{`(a ? b : c) ? d : e`, `(a ? b : c) ? d : e`},
+		{`(a ? b : c) + 1`, `(a ? b : c) + 1`},
+		{`a ?: b`, `a ? a : b`},
+		{`1..3`, `1 .. 3`},
+		{`a.b.c`, `a.b.c`},
+		{`a?.b.c`, `a?.b.c`},
+		{`a["b c"][0]`, `a["b c"][0]`},
+		{`(a + b).c`, `(a + b).c`},
+		{`("ab")[0]`, `("ab")[0]`},
+		{`a.b(c, d)`, `a.b(c, d)`},
+		{`foo(1, 'x')`, `foo(1, "x")`},
+		{`arr[1:2]`, `arr[1:2]`},
+		{`arr[:2]`, `arr[:2]`},
+		{`arr[1:]`, `arr[1:]`},
+		{`map(arr, {#.Name + .Value + #[0]})`, `map(arr, {.Name + .Value + #[0]})`},
+		{`filter(arr, {.Foo()})`, `filter(arr, {.Foo()})`},
+		{`len(arr)`, `len(arr)`},
+		{`[1, 2.5, "a\n", nil, true]`, `[1, 2.5, "a\n", nil, true]`},
+		{`2.0 + 1e6 + .5`, `2.0 + 1e+06 + 0.5`},
+		{`{a: 1, "b c": 2, 3: 4, (x): 5, "not": 6}`, `{a: 1, "b c": 2, "3": 4, (x): 5, "not": 6}`},
+		{`"\x01é"`, `"\x01é"`},
+		{`a matches "^a" and b startsWith "b"`, `a matches "^a" and b startsWith "b"`},
+		{`fold(arr,let a=0,let b=1,{a=a+#;b=b*a;})`, `fold(arr, let a = 0, let b = 1, {a = a + #; b = b * a})`},
+		{`let(q,r)=divmod(a,b);q+r`, `let (q, r) = divmod(a, b); q + r`},
+		{`1+(let x=2;x*x)`, `1 + (let x = 2; x * x)`},
+		{`reduce(arr,{#acc+#*#index},0)`, `reduce(arr, {#acc + # * #index}, 0)`},
+		{`[x*2 for x in items if x>0]`, `[x * 2 for x in items if x > 0]`},
+		{`{k:len(k) for k in keys}`, `{(k): len(k) for k in keys}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			tree, err := parser.Parse(tt.code)
+			require.NoError(t, err)
+			got := parser.Format(tree.Node)
+			require.Equal(t, tt.want, got)
+
+			formatted, err := parser.Parse(got)
+			require.NoError(t, err)
+			require.Equal(t, ast.Dump(tree.Node), ast.Dump(formatted.Node))
+		})
+	}
+}
@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/test/exprfuzz"
+)
+
+func FuzzParse(f *testing.F) {
+	g := exprfuzz.New(1)
+	for i := 0; i < 100; i++ {
+		f.Add(g.Valid())
+		f.Add(g.Invalid())
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		tree, err := parser.Parse(input)
+		if err != nil {
+			return
+		}
+		formatted := parser.Format(tree.Node)
+		again, err := parser.Parse(formatted)
+		if err != nil {
+			t.Fatalf("%v: formatted code %v does not parse: %v", input, formatted, err)
+		}
+		if ast.Dump(tree.Node) != ast.Dump(again.Node) {
+			t.Fatalf("%v: formatted code %v parses to a different tree", input, formatted)
+		}
+	})
+}
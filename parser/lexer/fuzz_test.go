@@ -0,0 +1,23 @@
+//go:build go1.18
+// +build go1.18
+
+package lexer_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr/file"
+	. "github.com/antonmedv/expr/parser/lexer"
+	"github.com/antonmedv/expr/test/exprfuzz"
+)
+
+func FuzzLex(f *testing.F) {
+	g := exprfuzz.New(1)
+	for i := 0; i < 100; i++ {
+		f.Add(g.Valid())
+		f.Add(g.Invalid())
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		_, _ = Lex(file.NewSource(input))
+	})
+}
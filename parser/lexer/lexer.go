@@ -1,7 +1,6 @@
 package lexer
 
 import (
-	"fmt"
 	"strings"
 	"unicode/utf8"
 
@@ -152,10 +151,7 @@ func (l *lexer) acceptWord(word string) bool {
 
 func (l *lexer) error(format string, args ...interface{}) stateFn {
 	if l.err == nil { // show first error
-		l.err = &file.Error{
-			Location: l.loc,
-			Message:  fmt.Sprintf(format, args...),
-		}
+		l.err = file.Errorf(l.loc, format, args...)
 	}
 	return nil
 }
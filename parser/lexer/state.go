@@ -30,7 +30,7 @@ func root(l *lexer) stateFn {
 		l.emit(Bracket)
 	case strings.ContainsRune(")]}", r):
 		l.emit(Bracket)
-	case strings.ContainsRune("#,?:%+-/^", r): // single rune operator
+	case strings.ContainsRune("#,;?:%+-/^", r): // single rune operator
 		l.emit(Operator)
 	case strings.ContainsRune("&|!=*<>", r): // possible double rune operator
 		l.accept("&|=*")
@@ -115,7 +115,7 @@ loop:
 			switch l.word() {
 			case "not":
 				return not
-			case "in", "or", "and", "matches", "contains", "startsWith", "endsWith":
+			case "in", "or", "and", "matches", "like", "contains", "startsWith", "endsWith":
 				l.emit(Operator)
 			default:
 				l.emit(Identifier)
@@ -145,7 +145,7 @@ func not(l *lexer) stateFn {
 	}
 
 	switch l.word() {
-	case "in", "matches", "contains", "startsWith", "endsWith":
+	case "in", "matches", "like", "contains", "startsWith", "endsWith":
 		l.emit(Operator)
 	default:
 		l.end, l.loc, l.prev = pos, loc, prev
@@ -154,7 +154,7 @@ func not(l *lexer) stateFn {
 }
 
 func questionMark(l *lexer) stateFn {
-	l.accept(".")
+	l.accept(".?")
 	l.emit(Operator)
 	return root
 }
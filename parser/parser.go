@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -24,7 +25,9 @@ type operator struct {
 }
 
 type builtin struct {
-	arity int
+	arity   int
+	closure bool // second argument is a closure
+	initial bool // optional third argument after the closure
 }
 
 var unaryOperators = map[string]operator{
@@ -47,6 +50,7 @@ var binaryOperators = map[string]operator{
 	"<=":         {20, left},
 	"in":         {20, left},
 	"matches":    {20, left},
+	"like":       {20, left},
 	"contains":   {20, left},
 	"startsWith": {20, left},
 	"endsWith":   {20, left},
@@ -58,17 +62,64 @@ var binaryOperators = map[string]operator{
 	"%":          {60, left},
 	"**":         {100, right},
 	"^":          {100, right},
+	"??":         {500, left},
 }
 
 var builtins = map[string]builtin{
-	"len":    {1},
-	"all":    {2},
-	"none":   {2},
-	"any":    {2},
-	"one":    {2},
-	"filter": {2},
-	"map":    {2},
-	"count":  {2},
+	"len":      {1, false, false},
+	"all":      {2, true, false},
+	"none":     {2, true, false},
+	"any":      {2, true, false},
+	"one":      {2, true, false},
+	"filter":   {2, true, false},
+	"map":      {2, true, false},
+	"count":    {2, true, false},
+	"try":      {2, false, false},
+	"fallback": {2, false, false},
+	"fold":     {3, true, false},
+	"reduce":   {2, true, true},
+}
+
+// since holds versions of the language, which introduced operators, builtins
+// and syntax. In earlier versions, names of builtins are identifiers.
+var since = map[string]int{
+	"like":     2,
+	"??":       2,
+	"try":      2,
+	"fallback": 2,
+	"fold":     2,
+	"reduce":   2,
+	"let":      2,
+	"tuples":   2,
+	"for":      2,
+	"#index":   2,
+	"#acc":     2,
+}
+
+// Builtins returns names of builtins parsed by the parser, like len or map.
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Operators returns unary and binary operators parsed by the parser, like
+// "+" or "in".
+func Operators() []string {
+	names := make([]string, 0, len(unaryOperators)+len(binaryOperators))
+	for name := range unaryOperators {
+		names = append(names, name)
+	}
+	for name := range binaryOperators {
+		if _, ok := unaryOperators[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 type parser struct {
@@ -77,24 +128,66 @@ type parser struct {
 	pos     int
 	err     *file.Error
 	depth   int // closure call depth
+	nesting int // depth of parsed node
+	infix   map[string]int
+	scopes  [][]string // variables of folds
+	version int        // version of the language
 }
 
+// MaxNesting limits depth of expressions, as deeply nested expressions may
+// exhaust the stack during compilation.
+var MaxNesting = 10000
+
 type Tree struct {
 	Node   Node
 	Source *file.Source
 }
 
 func Parse(input string) (*Tree, error) {
+	return ParseWithOptions(input, Options{})
+}
+
+// LatestVersion is the version of the language parsed without
+// Options.Version, see conf.LatestLangVersion.
+const LatestVersion = 2
+
+// Options of parsing, see ParseWithOptions.
+type Options struct {
+	// Infix holds precedences of custom infix operators by their names.
+	Infix map[string]int
+	// Version of the language, or zero for LatestVersion. Syntax of later
+	// versions is not parsed.
+	Version int
+	// Translator translates messages of errors.
+	Translator file.Translator
+}
+
+// ParseWithOptions parses input using options, like custom infix
+// operators.
+func ParseWithOptions(input string, options Options) (*Tree, error) {
+	version := LatestVersion
+	if options.Version != 0 {
+		version = options.Version
+		if version < 1 || version > LatestVersion {
+			return nil, fmt.Errorf("unknown language version %v (latest is %v)", version, LatestVersion)
+		}
+	}
+
 	source := file.NewSource(input)
 
 	tokens, err := Lex(source)
 	if err != nil {
+		if fileError, ok := err.(*file.Error); ok && options.Translator != nil {
+			fileError.Translate(options.Translator)
+		}
 		return nil, err
 	}
 
 	p := &parser{
 		tokens:  tokens,
 		current: tokens[0],
+		infix:   options.Infix,
+		version: version,
 	}
 
 	node := p.parseExpression(0)
@@ -104,6 +197,9 @@ func Parse(input string) (*Tree, error) {
 	}
 
 	if p.err != nil {
+		if options.Translator != nil {
+			p.err.Translate(options.Translator)
+		}
 		return nil, p.err.Bind(source)
 	}
 
@@ -115,10 +211,7 @@ func Parse(input string) (*Tree, error) {
 
 func (p *parser) error(format string, args ...interface{}) {
 	if p.err == nil { // show first error
-		p.err = &file.Error{
-			Location: p.current.Location,
-			Message:  fmt.Sprintf(format, args...),
-		}
+		p.err = file.Errorf(p.current.Location, format, args...)
 	}
 }
 
@@ -141,23 +234,48 @@ func (p *parser) expect(kind Kind, values ...string) {
 
 // parse functions
 
+// nest increases depth of parsed node, and reports an error if expression
+// is nested too deeply.
+func (p *parser) nest() bool {
+	p.nesting++
+	if p.nesting > MaxNesting {
+		p.error("expression is nested too deeply")
+		return false
+	}
+	return true
+}
+
 func (p *parser) parseExpression(precedence int) Node {
+	nesting := p.nesting
+	defer func() { p.nesting = nesting }()
+	if !p.nest() {
+		return &NilNode{}
+	}
+
 	nodeLeft := p.parsePrimary()
 
 	token := p.current
-	for token.Is(Operator) && p.err == nil {
+	for (token.Is(Operator) || p.isInfix(token)) && p.err == nil {
 		negate := false
 		var notToken Token
 
-		if token.Is(Operator, "not") {
+		if token.Is(Operator, "not") && p.pos+1 < len(p.tokens) {
+			// Operator after "not" may have lower precedence, like "in" in
+			// "a + b not in c", and is parsed by the outer expression.
+			if op, ok := p.binaryOperator(p.tokens[p.pos+1]); !ok || op.precedence < precedence {
+				break
+			}
 			p.next()
 			notToken = p.current
 			negate = true
 			token = p.current
 		}
 
-		if op, ok := binaryOperators[token.Value]; ok {
+		if op, ok := p.binaryOperator(token); ok {
 			if op.precedence >= precedence {
+				if !p.isInfix(token) && !p.require(token.Value, "operator "+token.Value) {
+					break
+				}
 				p.next()
 
 				var nodeRight Node
@@ -167,10 +285,20 @@ func (p *parser) parseExpression(precedence int) Node {
 					nodeRight = p.parseExpression(op.precedence)
 				}
 
-				nodeLeft = &BinaryNode{
-					Operator: token.Value,
-					Left:     nodeLeft,
-					Right:    nodeRight,
+				if p.isInfix(token) {
+					// Custom infix operator `a op b` is a call `op(a, b)`.
+					callee := &IdentifierNode{Value: token.Value}
+					callee.SetLocation(token.Location)
+					nodeLeft = &CallNode{
+						Callee:    callee,
+						Arguments: []Node{nodeLeft, nodeRight},
+					}
+				} else {
+					nodeLeft = &BinaryNode{
+						Operator: token.Value,
+						Left:     nodeLeft,
+						Right:    nodeRight,
+					}
 				}
 				nodeLeft.SetLocation(token.Location)
 
@@ -182,6 +310,7 @@ func (p *parser) parseExpression(precedence int) Node {
 					nodeLeft.SetLocation(notToken.Location)
 				}
 
+				p.nest()
 				token = p.current
 				continue
 			}
@@ -196,7 +325,43 @@ func (p *parser) parseExpression(precedence int) Node {
 	return nodeLeft
 }
 
+// isInfix reports whether token is a custom infix operator.
+func (p *parser) isInfix(token Token) bool {
+	if !token.Is(Operator) && !token.Is(Identifier) {
+		return false
+	}
+	_, ok := p.infix[token.Value]
+	return ok
+}
+
+// supports reports whether the version of the language has the feature of
+// since, like "like" or "tuples".
+func (p *parser) supports(feature string) bool {
+	return p.version >= since[feature]
+}
+
+// require reports an error, if the version of the language does not have
+// the feature of since.
+func (p *parser) require(feature, what string) bool {
+	if p.supports(feature) {
+		return true
+	}
+	p.error("%v requires language version %v", what, since[feature])
+	return false
+}
+
+func (p *parser) binaryOperator(token Token) (operator, bool) {
+	if precedence, ok := p.infix[token.Value]; ok && p.isInfix(token) {
+		return operator{precedence, left}, true
+	}
+	op, ok := binaryOperators[token.Value]
+	return op, ok && token.Is(Operator)
+}
+
 func (p *parser) parsePrimary() Node {
+	if p.current.Is(Operator, "like") && !p.supports("like") {
+		p.current.Kind = Identifier
+	}
 	token := p.current
 
 	if token.Is(Operator) {
@@ -215,16 +380,33 @@ func (p *parser) parsePrimary() Node {
 	if token.Is(Bracket, "(") {
 		p.next()
 		expr := p.parseExpression(0)
+		if p.current.Is(Operator, ",") && p.require("tuples", "tuple") {
+			tuple := &TupleNode{Nodes: []Node{expr}}
+			tuple.SetLocation(token.Location)
+			for p.current.Is(Operator, ",") && p.err == nil {
+				p.next()
+				tuple.Nodes = append(tuple.Nodes, p.parseExpression(0))
+			}
+			expr = tuple
+		}
 		p.expect(Bracket, ")") // "an opened parenthesis is not properly closed"
 		return p.parsePostfixExpression(expr)
 	}
 
+	if token.Is(Identifier, "let") && p.isLet() && p.require("let", "let binding") {
+		return p.parseLet(token)
+	}
+
 	if p.depth > 0 {
 		if token.Is(Operator, "#") || token.Is(Operator, ".") {
+			node := &PointerNode{}
 			if token.Is(Operator, "#") {
 				p.next()
+				if (p.current.Is(Identifier, "index") || p.current.Is(Identifier, "acc")) && p.require("#"+p.current.Value, "#"+p.current.Value) {
+					node.Name = p.current.Value
+					p.next()
+				}
 			}
-			node := &PointerNode{}
 			node.SetLocation(token.Location)
 			return p.parsePostfixExpression(node)
 		}
@@ -240,6 +422,7 @@ func (p *parser) parsePrimary() Node {
 func (p *parser) parseConditionalExpression(node Node) Node {
 	var expr1, expr2 Node
 	for p.current.Is(Operator, "?") && p.err == nil {
+		token := p.current
 		p.next()
 
 		if !p.current.Is(Operator, ":") {
@@ -257,6 +440,7 @@ func (p *parser) parseConditionalExpression(node Node) Node {
 			Exp1: expr1,
 			Exp2: expr2,
 		}
+		node.SetLocation(token.Location)
 	}
 	return node
 }
@@ -339,7 +523,9 @@ func (p *parser) parseIdentifierExpression(token Token) Node {
 	if p.current.Is(Bracket, "(") {
 		var arguments []Node
 
-		if b, ok := builtins[token.Value]; ok {
+		if token.Value == "fold" && p.supports("fold") {
+			return p.parseFold(token)
+		} else if b, ok := builtins[token.Value]; ok && p.supports(token.Value) {
 			p.expect(Bracket, "(")
 			// TODO: Add builtins signatures.
 			if b.arity == 1 {
@@ -349,7 +535,15 @@ func (p *parser) parseIdentifierExpression(token Token) Node {
 				arguments = make([]Node, 2)
 				arguments[0] = p.parseExpression(0)
 				p.expect(Operator, ",")
-				arguments[1] = p.parseClosure()
+				if b.closure {
+					arguments[1] = p.parseClosure()
+				} else {
+					arguments[1] = p.parseExpression(0)
+				}
+				if b.initial && p.current.Is(Operator, ",") {
+					p.next()
+					arguments = append(arguments, p.parseExpression(0))
+				}
 			}
 			p.expect(Bracket, ")")
 
@@ -367,6 +561,9 @@ func (p *parser) parseIdentifierExpression(token Token) Node {
 			}
 			node.SetLocation(token.Location)
 		}
+	} else if p.isVariable(token.Value) {
+		node = &VariableNode{Name: token.Value}
+		node.SetLocation(token.Location)
 	} else {
 		node = &IdentifierNode{Value: token.Value}
 		node.SetLocation(token.Location)
@@ -374,6 +571,144 @@ func (p *parser) parseIdentifierExpression(token Token) Node {
 	return node
 }
 
+// isVariable reports whether name is a variable of an enclosing fold.
+func (p *parser) isVariable(name string) bool {
+	for _, scope := range p.scopes {
+		for _, variable := range scope {
+			if variable == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLet reports whether the current "let" starts a binding, like
+// let x = 1 or let (a, b) = pair, and not an identifier or a call.
+func (p *parser) isLet() bool {
+	i := p.pos + 1
+	if i < len(p.tokens) && p.tokens[i].Is(Identifier) {
+		return i+1 < len(p.tokens) && p.tokens[i+1].Is(Operator, "=")
+	}
+	if i >= len(p.tokens) || !p.tokens[i].Is(Bracket, "(") {
+		return false
+	}
+	depth := 0
+	for ; i < len(p.tokens); i++ {
+		switch {
+		case p.tokens[i].Is(Bracket, "("):
+			depth++
+		case p.tokens[i].Is(Bracket, ")"):
+			depth--
+			if depth == 0 {
+				return i+1 < len(p.tokens) && p.tokens[i+1].Is(Operator, "=")
+			}
+		}
+	}
+	return false
+}
+
+// parseLet parses let name = value; body, or let (name, ...) = tuple; body.
+// Variables are visible only in the body.
+func (p *parser) parseLet(token Token) Node {
+	p.expect(Identifier, "let")
+	node := &BindNode{}
+	node.SetLocation(token.Location)
+	if p.current.Is(Bracket, "(") {
+		node.Tuple = true
+		p.next()
+		for p.err == nil {
+			name := p.current
+			for _, n := range node.Names {
+				if n == name.Value {
+					p.error("variable %v is already declared", name.Value)
+				}
+			}
+			p.expect(Identifier)
+			node.Names = append(node.Names, name.Value)
+			if !p.current.Is(Operator, ",") {
+				break
+			}
+			p.next()
+		}
+		p.expect(Bracket, ")")
+	} else {
+		node.Names = []string{p.current.Value}
+		p.expect(Identifier)
+	}
+	p.expect(Operator, "=")
+	node.Value = p.parseExpression(0)
+	p.expect(Operator, ";")
+
+	p.scopes = append(p.scopes, node.Names)
+	node.Body = p.parseExpression(0)
+	p.scopes = p.scopes[:len(p.scopes)-1]
+	return node
+}
+
+// parseFold parses fold(array, let name = value, ..., {name = value; ...}).
+// Variables are visible only in the closure, which may only assign them.
+func (p *parser) parseFold(token Token) Node {
+	p.expect(Bracket, "(")
+	arguments := []Node{p.parseExpression(0)}
+	var names []string
+	p.expect(Operator, ",")
+	for p.current.Is(Identifier, "let") && p.err == nil {
+		let := p.current
+		p.next()
+		name := p.current
+		for _, n := range names {
+			if n == name.Value {
+				p.error("variable %v is already declared", name.Value)
+			}
+		}
+		p.expect(Identifier)
+		p.expect(Operator, "=")
+		names = append(names, name.Value)
+		node := &LetNode{Name: name.Value, Value: p.parseExpression(0)}
+		node.SetLocation(let.Location)
+		arguments = append(arguments, node)
+		p.expect(Operator, ",")
+	}
+	if len(names) == 0 {
+		p.error("fold requires variables declared with let")
+	}
+
+	brace := p.current
+	p.expect(Bracket, "{")
+	p.scopes = append(p.scopes, names)
+	p.depth++
+	block := &BlockNode{}
+	block.SetLocation(brace.Location)
+	for !p.current.Is(Bracket, "}") && p.err == nil {
+		name := p.current
+		p.expect(Identifier)
+		p.expect(Operator, "=")
+		node := &AssignNode{Name: name.Value, Value: p.parseExpression(0)}
+		node.SetLocation(name.Location)
+		block.Nodes = append(block.Nodes, node)
+		if !p.current.Is(Operator, ";") {
+			break
+		}
+		p.next()
+	}
+	if len(block.Nodes) == 0 {
+		p.error("closure of fold should assign variables")
+	}
+	p.depth--
+	p.scopes = p.scopes[:len(p.scopes)-1]
+	p.expect(Bracket, "}")
+	p.expect(Bracket, ")")
+
+	closure := &ClosureNode{Node: block}
+	closure.SetLocation(brace.Location)
+	arguments = append(arguments, closure)
+
+	node := &BuiltinNode{Name: token.Value, Arguments: arguments}
+	node.SetLocation(token.Location)
+	return node
+}
+
 func (p *parser) parseClosure() Node {
 	token := p.current
 	p.expect(Bracket, "{")
@@ -390,6 +725,46 @@ func (p *parser) parseClosure() Node {
 	return closure
 }
 
+// parseComprehension parses "for name in items if cond" after the node of
+// values, or the pair of keys and values, of a comprehension. Identifiers
+// of the node with the name are replaced with the variable, and so are keys
+// of the pair, like k in {k: v for k in keys}.
+func (p *parser) parseComprehension(token Token, node Node) Node {
+	p.expect(Identifier, "for")
+	name := p.current
+	p.expect(Identifier)
+	p.expect(Operator, "in")
+	comprehension := &ComprehensionNode{Node: node, Name: name.Value, Items: p.parseExpression(0)}
+	comprehension.SetLocation(token.Location)
+
+	p.scopes = append(p.scopes, []string{name.Value})
+	if p.current.Is(Identifier, "if") {
+		p.next()
+		comprehension.Cond = p.parseExpression(0)
+	}
+	p.scopes = p.scopes[:len(p.scopes)-1]
+
+	if pair, ok := node.(*PairNode); ok {
+		if key, ok := pair.Key.(*StringNode); ok && key.Value == name.Value {
+			pair.Key = &VariableNode{Name: name.Value}
+			pair.Key.SetLocation(key.Location())
+		}
+	}
+	Walk(&comprehension.Node, variableReplacer(name.Value))
+	return comprehension
+}
+
+// variableReplacer replaces identifiers with the name with the variable.
+type variableReplacer string
+
+func (r variableReplacer) Visit(node *Node) {
+	if ident, ok := (*node).(*IdentifierNode); ok && ident.Value == string(r) {
+		variable := &VariableNode{Name: ident.Value}
+		variable.SetLocation(ident.Location())
+		*node = variable
+	}
+}
+
 func (p *parser) parseArrayExpression(token Token) Node {
 	nodes := make([]Node, 0)
 
@@ -402,6 +777,11 @@ func (p *parser) parseArrayExpression(token Token) Node {
 			}
 		}
 		node := p.parseExpression(0)
+		if len(nodes) == 0 && p.current.Is(Identifier, "for") && p.require("for", "comprehension") {
+			comprehension := p.parseComprehension(token, node)
+			p.expect(Bracket, "]")
+			return comprehension
+		}
 		nodes = append(nodes, node)
 	}
 end:
@@ -448,6 +828,11 @@ func (p *parser) parseMapExpression(token Token) Node {
 		node := p.parseExpression(0)
 		pair := &PairNode{Key: key, Value: node}
 		pair.SetLocation(token.Location)
+		if len(nodes) == 0 && p.current.Is(Identifier, "for") && p.require("for", "comprehension") {
+			comprehension := p.parseComprehension(token, pair)
+			p.expect(Bracket, "}")
+			return comprehension
+		}
 		nodes = append(nodes, pair)
 	}
 
@@ -460,8 +845,11 @@ end:
 }
 
 func (p *parser) parsePostfixExpression(node Node) Node {
+	nesting := p.nesting
+	defer func() { p.nesting = nesting }()
+
 	postfixToken := p.current
-	for (postfixToken.Is(Operator) || postfixToken.Is(Bracket)) && p.err == nil {
+	for (postfixToken.Is(Operator) || postfixToken.Is(Bracket)) && p.nest() && p.err == nil {
 		if postfixToken.Value == "." || postfixToken.Value == "?." {
 			p.next()
 
@@ -503,6 +891,7 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 
 			if isChain || optional {
 				node = &ChainNode{Node: node}
+				node.SetLocation(propertyToken.Location)
 			}
 
 		} else if postfixToken.Value == "[" {
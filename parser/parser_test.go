@@ -8,6 +8,7 @@ import (
 	. "github.com/antonmedv/expr/ast"
 	"github.com/antonmedv/expr/parser"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParse(t *testing.T) {
@@ -283,6 +284,39 @@ func TestParse(t *testing.T) {
 					Left:     &IdentifierNode{Value: "foo"},
 					Right:    &StringNode{Value: "foo"}}},
 		},
+		{
+			`foo not like "f%"`,
+			&UnaryNode{
+				Operator: "not",
+				Node: &BinaryNode{
+					Operator: "like",
+					Left:     &IdentifierNode{Value: "foo"},
+					Right:    &StringNode{Value: "f%"}}},
+		},
+		{
+			`a?.b ?? c + 1`,
+			&BinaryNode{
+				Operator: "+",
+				Left: &BinaryNode{
+					Operator: "??",
+					Left: &ChainNode{Node: &MemberNode{
+						Node:     &IdentifierNode{Value: "a"},
+						Property: &StringNode{Value: "b"},
+						Optional: true}},
+					Right: &IdentifierNode{Value: "c"}},
+				Right: &IntegerNode{Value: 1}},
+		},
+		{
+			`a + b not in c`,
+			&UnaryNode{
+				Operator: "not",
+				Node: &BinaryNode{
+					Operator: "in",
+					Left: &BinaryNode{Operator: "+",
+						Left:  &IdentifierNode{Value: "a"},
+						Right: &IdentifierNode{Value: "b"}},
+					Right: &IdentifierNode{Value: "c"}}},
+		},
 		{
 			`foo matches regex`,
 			&BinaryNode{
@@ -334,6 +368,16 @@ func TestParse(t *testing.T) {
 			&UnaryNode{Operator: "not",
 				Node: &IdentifierNode{Value: "in_var"}},
 		},
+		{
+			`try(foo(), "bar")`,
+			&BuiltinNode{
+				Name: "try",
+				Arguments: []Node{
+					&CallNode{Callee: &IdentifierNode{Value: "foo"}},
+					&StringNode{Value: "bar"},
+				},
+			},
+		},
 		{
 			"all(Tickets, {.Price > 0})",
 			&BuiltinNode{
@@ -394,6 +438,74 @@ func TestParse(t *testing.T) {
 			"[]",
 			&ArrayNode{},
 		},
+		{
+			"fold(a, let n = 0, {n = n + #; b = n}) + n",
+			&BinaryNode{Operator: "+",
+				Left: &BuiltinNode{Name: "fold", Arguments: []Node{
+					&IdentifierNode{Value: "a"},
+					&LetNode{Name: "n", Value: &IntegerNode{Value: 0}},
+					&ClosureNode{Node: &BlockNode{Nodes: []Node{
+						&AssignNode{Name: "n", Value: &BinaryNode{Operator: "+",
+							Left:  &VariableNode{Name: "n"},
+							Right: &PointerNode{}}},
+						&AssignNode{Name: "b", Value: &VariableNode{Name: "n"}},
+					}}},
+				}},
+				Right: &IdentifierNode{Value: "n"}},
+		},
+		{
+			"let (q, r) = (a, b); q + r",
+			&BindNode{
+				Names: []string{"q", "r"},
+				Tuple: true,
+				Value: &TupleNode{Nodes: []Node{
+					&IdentifierNode{Value: "a"},
+					&IdentifierNode{Value: "b"}}},
+				Body: &BinaryNode{Operator: "+",
+					Left:  &VariableNode{Name: "q"},
+					Right: &VariableNode{Name: "r"}}},
+		},
+		{
+			"let(x) + let",
+			&BinaryNode{Operator: "+",
+				Left: &CallNode{
+					Callee:    &IdentifierNode{Value: "let"},
+					Arguments: []Node{&IdentifierNode{Value: "x"}}},
+				Right: &IdentifierNode{Value: "let"}},
+		},
+		{
+			"reduce(a, {#acc + #index}, 0)",
+			&BuiltinNode{Name: "reduce", Arguments: []Node{
+				&IdentifierNode{Value: "a"},
+				&ClosureNode{Node: &BinaryNode{Operator: "+",
+					Left:  &PointerNode{Name: "acc"},
+					Right: &PointerNode{Name: "index"}}},
+				&IntegerNode{Value: 0},
+			}},
+		},
+		{
+			"[x * 2 for x in items if x > n]",
+			&ComprehensionNode{
+				Node: &BinaryNode{Operator: "*",
+					Left:  &VariableNode{Name: "x"},
+					Right: &IntegerNode{Value: 2}},
+				Name:  "x",
+				Items: &IdentifierNode{Value: "items"},
+				Cond: &BinaryNode{Operator: ">",
+					Left:  &VariableNode{Name: "x"},
+					Right: &IdentifierNode{Value: "n"}}},
+		},
+		{
+			"{k: v[k] for k in keys}",
+			&ComprehensionNode{
+				Node: &PairNode{
+					Key: &VariableNode{Name: "k"},
+					Value: &MemberNode{
+						Node:     &IdentifierNode{Value: "v"},
+						Property: &VariableNode{Name: "k"}}},
+				Name:  "k",
+				Items: &IdentifierNode{Value: "keys"}},
+		},
 	}
 	for _, test := range parseTests {
 		actual, err := parser.Parse(test.input)
@@ -465,6 +577,51 @@ a map key must be a quoted string, a number, a identifier, or an expression encl
 unexpected token Operator(",") (1:16)
  | {foo:1, bar:2, ,}
  | ...............^
+
+fold(a, {n = 1})
+fold requires variables declared with let (1:9)
+ | fold(a, {n = 1})
+ | ........^
+
+fold(a, let n = 0, let n = 1, {n = 1})
+variable n is already declared (1:24)
+ | fold(a, let n = 0, let n = 1, {n = 1})
+ | .......................^
+
+fold(a, let n = 0, {n + 1})
+unexpected token Operator("+") (1:23)
+ | fold(a, let n = 0, {n + 1})
+ | ......................^
+
+fold(a, let n = 0, {})
+closure of fold should assign variables (1:21)
+ | fold(a, let n = 0, {})
+ | ....................^
+
+let (a, a) = b; a
+variable a is already declared (1:9)
+ | let (a, a) = b; a
+ | ........^
+
+let x = 1 x
+unexpected token Identifier("x") (1:11)
+ | let x = 1 x
+ | ..........^
+
+[x for in a]
+unexpected token Operator("in") (1:8)
+ | [x for in a]
+ | .......^
+
+[x for x in a if x, 1]
+unexpected token Operator(",") (1:19)
+ | [x for x in a if x, 1]
+ | ..................^
+
+map(a, {n = 1})
+unexpected token Operator("=") (1:11)
+ | map(a, {n = 1})
+ | ..........^
 `
 
 func TestParse_error(t *testing.T) {
@@ -576,3 +733,180 @@ func TestParse_optional_chaining(t *testing.T) {
 		assert.Equal(t, Dump(test.expected), Dump(actual.Node), test.input)
 	}
 }
+
+func TestParse_infix(t *testing.T) {
+	options := parser.Options{Infix: map[string]int{"near": 20, "contains": 20}}
+
+	parseTests := []struct {
+		input    string
+		expected Node
+	}{
+		{
+			"a near b",
+			&CallNode{
+				Callee:    &IdentifierNode{Value: "near"},
+				Arguments: []Node{&IdentifierNode{Value: "a"}, &IdentifierNode{Value: "b"}},
+			},
+		},
+		{
+			"a + 1 near b and c",
+			&BinaryNode{
+				Operator: "and",
+				Left: &CallNode{
+					Callee: &IdentifierNode{Value: "near"},
+					Arguments: []Node{
+						&BinaryNode{
+							Operator: "+",
+							Left:     &IdentifierNode{Value: "a"},
+							Right:    &IntegerNode{Value: 1},
+						},
+						&IdentifierNode{Value: "b"},
+					},
+				},
+				Right: &IdentifierNode{Value: "c"},
+			},
+		},
+		{
+			"a not near b",
+			&UnaryNode{
+				Operator: "not",
+				Node: &CallNode{
+					Callee:    &IdentifierNode{Value: "near"},
+					Arguments: []Node{&IdentifierNode{Value: "a"}, &IdentifierNode{Value: "b"}},
+				},
+			},
+		},
+		{
+			"near(a, b)",
+			&CallNode{
+				Callee:    &IdentifierNode{Value: "near"},
+				Arguments: []Node{&IdentifierNode{Value: "a"}, &IdentifierNode{Value: "b"}},
+			},
+		},
+		{
+			"a contains b",
+			&CallNode{
+				Callee:    &IdentifierNode{Value: "contains"},
+				Arguments: []Node{&IdentifierNode{Value: "a"}, &IdentifierNode{Value: "b"}},
+			},
+		},
+	}
+	for _, test := range parseTests {
+		actual, err := parser.ParseWithOptions(test.input, options)
+		if err != nil {
+			t.Errorf("%s:\n%v", test.input, err)
+			continue
+		}
+		assert.Equal(t, Dump(test.expected), Dump(actual.Node), test.input)
+	}
+
+	_, err := parser.Parse("a near b")
+	assert.Error(t, err)
+}
+
+func TestParse_lang_version(t *testing.T) {
+	options := parser.Options{Version: 1}
+
+	tests := []struct {
+		input    string
+		expected Node
+	}{
+		{
+			"like + 1",
+			&BinaryNode{
+				Operator: "+",
+				Left:     &IdentifierNode{Value: "like"},
+				Right:    &IntegerNode{Value: 1},
+			},
+		},
+		{
+			"try(a, b)",
+			&CallNode{
+				Callee:    &IdentifierNode{Value: "try"},
+				Arguments: []Node{&IdentifierNode{Value: "a"}, &IdentifierNode{Value: "b"}},
+			},
+		},
+		{
+			"reduce(a, 0)",
+			&CallNode{
+				Callee:    &IdentifierNode{Value: "reduce"},
+				Arguments: []Node{&IdentifierNode{Value: "a"}, &IntegerNode{Value: 0}},
+			},
+		},
+		{
+			"fold(a)",
+			&CallNode{
+				Callee:    &IdentifierNode{Value: "fold"},
+				Arguments: []Node{&IdentifierNode{Value: "a"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		actual, err := parser.ParseWithOptions(test.input, options)
+		if err != nil {
+			t.Errorf("%s:\n%v", test.input, err)
+			continue
+		}
+		assert.Equal(t, Dump(test.expected), Dump(actual.Node), test.input)
+	}
+
+	errors := []struct {
+		input string
+		err   string
+	}{
+		{"a ?? b", "operator ?? requires language version 2 (1:3)"},
+		{`a like "b*"`, "operator like requires language version 2 (1:3)"},
+		{`a not like "b*"`, "operator like requires language version 2 (1:7)"},
+		{"let x = 1; x", "let binding requires language version 2 (1:1)"},
+		{"(a, b)", "tuple requires language version 2 (1:3)"},
+		{"[x for x in a]", "comprehension requires language version 2 (1:4)"},
+		{"map(a, {#index})", "#index requires language version 2 (1:10)"},
+	}
+	for _, test := range errors {
+		_, err := parser.ParseWithOptions(test.input, options)
+		require.Error(t, err, test.input)
+		assert.Equal(t, test.err, strings.SplitN(err.Error(), "\n", 2)[0], test.input)
+	}
+
+	_, err := parser.ParseWithOptions("1", parser.Options{Version: 3})
+	assert.EqualError(t, err, "unknown language version 3 (latest is 2)")
+}
+
+func TestParse_nesting(t *testing.T) {
+	inputs := []string{
+		strings.Repeat("(", 20000) + "1" + strings.Repeat(")", 20000),
+		strings.Repeat("-", 20000) + "1",
+		"1" + strings.Repeat(" + 1", 20000),
+		"a" + strings.Repeat(".b", 20000),
+		strings.Repeat("[", 20000) + strings.Repeat("]", 20000),
+	}
+	for _, input := range inputs {
+		_, err := parser.Parse(input)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expression is nested too deeply")
+	}
+
+	_, err := parser.Parse(strings.Repeat("(", 1000) + "1" + strings.Repeat(")", 1000))
+	require.NoError(t, err)
+}
+
+func TestSpans(t *testing.T) {
+	input := "f( a.b ,\n\t[1, 2] ) + (x ?? 0)"
+	tree, err := parser.Parse(input)
+	require.NoError(t, err)
+	spans, err := parser.Spans(tree)
+	require.NoError(t, err)
+
+	text := func(node Node) string {
+		span, ok := spans[node]
+		require.True(t, ok, "%T", node)
+		return string([]rune(input)[span.Start:span.End])
+	}
+	sum := tree.Node.(*BinaryNode)
+	call := sum.Left.(*CallNode)
+	assert.Equal(t, input, text(sum))
+	assert.Equal(t, "f( a.b ,\n\t[1, 2] )", text(call))
+	assert.Equal(t, "a.b", text(call.Arguments[0]))
+	assert.Equal(t, "[1, 2]", text(call.Arguments[1]))
+	assert.Equal(t, "x ?? 0", text(sum.Right))
+}
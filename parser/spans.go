@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"unicode"
+
+	. "github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/file"
+	. "github.com/antonmedv/expr/parser/lexer"
+)
+
+// Span of the source of a node, as offsets of runes of the source: of the
+// first rune, and after the last rune.
+type Span struct {
+	Start, End int
+}
+
+// Spans returns spans of nodes of the tree in its source. Spans of
+// operations start at their leftmost operands, like a of a + b, and include
+// brackets of calls, indexes, arrays and maps, but not parentheses around
+// them, like (a + b).
+func Spans(tree *Tree) (map[Node]Span, error) {
+	tokens, err := Lex(tree.Source)
+	if err != nil {
+		return nil, err
+	}
+	m := &measurer{
+		source: []rune(tree.Source.Content()),
+		tokens: tokens,
+		index:  make(map[file.Location]int, len(tokens)),
+		lines:  []int{0, 0},
+		spans:  make(map[Node]Span),
+	}
+	for i, t := range tokens {
+		if _, ok := m.index[t.Location]; !ok {
+			m.index[t.Location] = i
+		}
+	}
+	for i, r := range m.source {
+		if r == '\n' {
+			m.lines = append(m.lines, i+1)
+		}
+	}
+	m.measure(tree.Node)
+	return m.spans, nil
+}
+
+type measurer struct {
+	source []rune
+	tokens []Token
+	index  map[file.Location]int // tokens by locations
+	lines  []int                 // offsets of lines
+	spans  map[Node]Span
+}
+
+// offset returns the offset of runes of the location.
+func (m *measurer) offset(loc file.Location) int {
+	if loc.Line >= len(m.lines) {
+		return len(m.source)
+	}
+	return m.lines[loc.Line] + loc.Column
+}
+
+// measure records spans of the node and its children, and returns the range
+// of its tokens. Ranges start at tokens of nodes, or of their leftmost
+// children, and are extended to brackets, which are opened or closed in
+// them, like parentheses of calls.
+func (m *measurer) measure(node Node) (first, last int, ok bool) {
+	if pair, isPair := node.(*PairNode); isPair {
+		return m.measurePair(pair)
+	}
+	if i, found := m.index[node.Location()]; found {
+		first, last, ok = i, i, true
+	}
+	for _, child := range Children(node) {
+		f, l, childOk := m.measure(*child)
+		if !childOk {
+			continue
+		}
+		if !ok || f < first {
+			first = f
+		}
+		if !ok || l > last {
+			last = l
+		}
+		ok = true
+	}
+	if !ok {
+		return 0, 0, false
+	}
+	first, last = m.balance(first, last)
+	if call, isCall := node.(*CallNode); isCall && len(call.Arguments) == 0 && last+1 < len(m.tokens) && m.tokens[last+1].Is(Bracket, "(") {
+		first, last = m.balance(first, last+1)
+	}
+	m.record(node, first, last)
+	return first, last, true
+}
+
+// measurePair measures pairs of maps, which are located at braces of maps,
+// like keys of identifiers and strings.
+func (m *measurer) measurePair(pair *PairNode) (int, int, bool) {
+	first, last, ok := m.measure(pair.Value)
+	if !ok {
+		return 0, 0, false
+	}
+	if key, isString := pair.Key.(*StringNode); isString && key.Location() == pair.Location() {
+		// The key is followed by a colon.
+		if first < 2 {
+			return 0, 0, false
+		}
+		first -= 2
+		m.record(key, first, first)
+	} else if f, _, keyOk := m.measure(pair.Key); keyOk {
+		first, _ = m.balance(f, last)
+	}
+	m.record(pair, first, last)
+	return first, last, true
+}
+
+// record records the span of the node of the range of tokens.
+func (m *measurer) record(node Node, first, last int) {
+	end := len(m.source)
+	if next := m.tokens[last+1]; next.Kind != EOF {
+		end = m.offset(next.Location)
+	}
+	for end > 0 && unicode.IsSpace(m.source[end-1]) {
+		end--
+	}
+	m.spans[node] = Span{m.offset(m.tokens[first].Location), end}
+}
+
+// balance extends the range of tokens to brackets matching brackets of the
+// range.
+func (m *measurer) balance(first, last int) (int, int) {
+	depth, min := 0, 0
+	for i := first; i <= last; i++ {
+		depth += bracket(m.tokens[i])
+		if depth < min {
+			min = depth
+		}
+	}
+	for need := -min; need > 0 && first > 0; {
+		first--
+		need -= bracket(m.tokens[first])
+	}
+	// The last token is EOF.
+	for need := depth - min; need > 0 && last+2 < len(m.tokens); {
+		last++
+		need += bracket(m.tokens[last])
+	}
+	return first, last
+}
+
+// bracket returns 1 for opening brackets, and -1 for closing ones.
+func bracket(t Token) int {
+	switch {
+	case t.Is(Bracket, "(", "[", "{"):
+		return 1
+	case t.Is(Bracket, ")", "]", "}"):
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+// Package patcher provides common patches of expressions, which are applied
+// with expr.Patch before compilation:
+//
+//	program, err := expr.Compile(code, expr.Env(env),
+//		expr.Patch(patcher.Rename("amount", "Amount")),
+//		expr.Patch(patcher.NilGuard()),
+//	)
+//
+// Patches are applied to trees, which types are checked, and the result is
+// checked again, so patched expressions are typed like written ones.
+package patcher
+
+import (
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/file"
+)
+
+// Rename replaces identifiers of the name with identifiers of the new name,
+// like variables or functions of the environment, which were renamed.
+// Variables of let, fold and comprehensions are not identifiers, and are
+// kept as they are.
+func Rename(from, to string) ast.Visitor {
+	return renamer{from: from, to: to}
+}
+
+type renamer struct {
+	from, to string
+}
+
+func (r renamer) Visit(node *ast.Node) {
+	if ident, ok := (*node).(*ast.IdentifierNode); ok && ident.Value == r.from {
+		ast.Patch(node, &ast.IdentifierNode{Value: r.to})
+	}
+}
+
+// ImplicitReceiver replaces identifiers of fields of the receiver with
+// members of the receiver, like Amount with order.Amount of
+// ImplicitReceiver("order", "Amount", "Items").
+func ImplicitReceiver(receiver string, fields ...string) ast.Visitor {
+	r := receiverPatcher{receiver: receiver, fields: make(map[string]bool, len(fields))}
+	for _, field := range fields {
+		r.fields[field] = true
+	}
+	return r
+}
+
+type receiverPatcher struct {
+	receiver string
+	fields   map[string]bool
+}
+
+func (r receiverPatcher) Visit(node *ast.Node) {
+	ident, ok := (*node).(*ast.IdentifierNode)
+	if !ok || !r.fields[ident.Value] {
+		return
+	}
+	base := &ast.IdentifierNode{Value: r.receiver}
+	base.SetLocation(ident.Location())
+	property := &ast.StringNode{Value: ident.Value}
+	property.SetLocation(ident.Location())
+	ast.Patch(node, &ast.MemberNode{Node: base, Property: property})
+}
+
+// NilGuard makes access of members optional, like a?.b?.c of a.b.c, so
+// members of nil are nil instead of errors. Methods are not guarded.
+func NilGuard() ast.Visitor {
+	return nilGuard{}
+}
+
+type nilGuard struct{}
+
+func (nilGuard) Visit(node *ast.Node) {
+	member, ok := (*node).(*ast.MemberNode)
+	if !ok || member.Method || member.Optional {
+		return
+	}
+	member.Optional = true
+	// Optional members skip the rest of their chains.
+	ast.Patch(node, &ast.ChainNode{Node: member})
+}
+
+// Precompiler replaces string literals of arguments of calls of a function
+// with values compiled from them, see Precompile.
+type Precompiler struct {
+	function string
+	argument int
+	compile  func(s string) (interface{}, error)
+	values   map[string]interface{}
+	err      *file.Error
+}
+
+// Precompile replaces string literals of the argument of calls of the
+// function, by its index, with constants of values returned by compile,
+// like regular expressions of patterns of match(Name, "^a+$"), which are
+// then compiled once instead of on every call:
+//
+//	p := patcher.Precompile("match", 1, func(s string) (interface{}, error) {
+//		return regexp.Compile(s)
+//	})
+//	program, err := expr.Compile(code, expr.Env(env), expr.Patch(p))
+//	if err == nil {
+//		err = p.Err()
+//	}
+//
+// Functions are functions of the environment and builtins. Parameters of
+// functions accept values of compile.
+func Precompile(function string, argument int, compile func(s string) (interface{}, error)) *Precompiler {
+	return &Precompiler{
+		function: function,
+		argument: argument,
+		compile:  compile,
+		values:   make(map[string]interface{}),
+	}
+}
+
+func (p *Precompiler) Visit(node *ast.Node) {
+	var name string
+	var arguments []ast.Node
+	switch n := (*node).(type) {
+	case *ast.CallNode:
+		if ident, ok := n.Callee.(*ast.IdentifierNode); ok {
+			name, arguments = ident.Value, n.Arguments
+		}
+	case *ast.BuiltinNode:
+		name, arguments = n.Name, n.Arguments
+	}
+	if name != p.function || p.argument >= len(arguments) {
+		return
+	}
+	literal, ok := arguments[p.argument].(*ast.StringNode)
+	if !ok {
+		return
+	}
+	value, ok := p.values[literal.Value]
+	if !ok {
+		var err error
+		value, err = p.compile(literal.Value)
+		if err != nil {
+			if p.err == nil {
+				p.err = file.Errorf(literal.Location(), "cannot precompile argument %v of %v: %v", p.argument+1, name, err)
+			}
+			return
+		}
+		p.values[literal.Value] = value
+	}
+	ast.Patch(&arguments[p.argument], &ast.ConstantNode{Value: value})
+}
+
+// Err returns the first error of compiling literals, if any.
+func (p *Precompiler) Err() error {
+	if p.err == nil {
+		return nil
+	}
+	return p.err
+}
@@ -0,0 +1,107 @@
+package patcher_test
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/patcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Customer struct {
+	Name string
+}
+
+type Order struct {
+	Amount   int
+	Customer *Customer
+	Items    []string
+}
+
+func (o *Order) Total() int {
+	return o.Amount * 2
+}
+
+type Env struct {
+	Order *Order
+	Limit int
+}
+
+func TestRename(t *testing.T) {
+	env := Env{Order: &Order{Amount: 10}, Limit: 5}
+	program, err := expr.Compile(`order.Amount > limit and fold([1], let limit = 0, {limit = limit + #}) == 1`,
+		expr.Env(Env{}), expr.Patch(patcher.Rename("order", "Order")), expr.Patch(patcher.Rename("limit", "Limit")))
+	require.NoError(t, err)
+
+	output, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, output)
+}
+
+func TestImplicitReceiver(t *testing.T) {
+	env := Env{Order: &Order{Amount: 10, Items: []string{"a", "b"}}, Limit: 5}
+	program, err := expr.Compile(`Amount > Limit and len(Items) == 2 and Total() == 20`,
+		expr.Env(Env{}), expr.Patch(patcher.ImplicitReceiver("Order", "Amount", "Items", "Total")))
+	require.NoError(t, err)
+
+	output, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, output)
+
+	_, err = expr.Compile(`Amont > Limit`, expr.Env(Env{}), expr.Patch(patcher.ImplicitReceiver("Order", "Amount")))
+	require.Error(t, err)
+}
+
+func TestNilGuard(t *testing.T) {
+	program, err := expr.Compile(`Order.Customer.Name`, expr.Env(Env{}), expr.Patch(patcher.NilGuard()))
+	require.NoError(t, err)
+
+	output, err := expr.Run(program, Env{Order: &Order{}})
+	require.NoError(t, err)
+	assert.Nil(t, output)
+
+	output, err = expr.Run(program, Env{})
+	require.NoError(t, err)
+	assert.Nil(t, output)
+
+	output, err = expr.Run(program, Env{Order: &Order{Customer: &Customer{Name: "Ann"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "Ann", output)
+
+	program, err = expr.Compile(`user.address.city ?? "unknown"`, expr.Patch(patcher.NilGuard()))
+	require.NoError(t, err)
+	output, err = expr.Run(program, map[string]interface{}{"user": map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", output)
+}
+
+func TestPrecompile(t *testing.T) {
+	compiled := 0
+	p := patcher.Precompile("match", 1, func(s string) (interface{}, error) {
+		compiled++
+		return regexp.Compile(s)
+	})
+	env := map[string]interface{}{
+		"name":  "aaa",
+		"match": func(s string, re *regexp.Regexp) bool { return re.MatchString(s) },
+	}
+	program, err := expr.Compile(`match(name, "^a+$") and not match(name, "^b") and match(name, "^a+$")`, expr.Env(env), expr.Patch(p))
+	require.NoError(t, err)
+	require.NoError(t, p.Err())
+	assert.Equal(t, 2, compiled)
+
+	output, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, output)
+
+	p = patcher.Precompile("match", 1, func(s string) (interface{}, error) {
+		return regexp.Compile(s)
+	})
+	_, err = expr.Compile(`match(name, "(")`, expr.Env(env), expr.Patch(p))
+	require.Error(t, err)
+	require.Error(t, p.Err())
+	assert.Equal(t, "cannot precompile argument 2 of match: error parsing regexp: missing closing ): `(` (1:13)", fmt.Sprint(p.Err()))
+}
@@ -0,0 +1,65 @@
+package expr
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/patcher"
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// receiverPatcher returns the patch of identifiers of members of the
+// implicit receiver, which are not variables or functions.
+func receiverPatcher(config *conf.Config) ast.Visitor {
+	var fields []string
+	for _, name := range receiverMembers(config) {
+		if _, ok := config.Types[name]; ok {
+			continue
+		}
+		if _, ok := config.Functions[name]; ok {
+			continue
+		}
+		fields = append(fields, name)
+	}
+	return patcher.ImplicitReceiver(config.ImplicitReceiver, fields...)
+}
+
+// receiverMembers returns names of fields and methods of the type of the
+// receiver, or keys of its map in the environment.
+func receiverMembers(config *conf.Config) []string {
+	tag, ok := config.Types[config.ImplicitReceiver]
+	if !ok || tag.Type == nil {
+		return nil
+	}
+	t := tag.Type
+	var names []string
+	for i := 0; i < t.NumMethod(); i++ {
+		names = append(names, t.Method(i).Name)
+	}
+	d := t
+	if d.Kind() == reflect.Ptr {
+		d = d.Elem()
+	}
+	switch d.Kind() {
+	case reflect.Struct:
+		for name, field := range conf.FieldsFromStruct(d) {
+			if !field.Ambiguous {
+				names = append(names, name)
+			}
+		}
+	case reflect.Map:
+		if d.Key().Kind() != reflect.String || config.Env == nil {
+			break
+		}
+		v := reflect.ValueOf(runtime.Fetch(config.Env, config.ImplicitReceiver))
+		if v.Kind() == reflect.Map {
+			for _, key := range v.MapKeys() {
+				names = append(names, key.String())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,22 @@
+package repl
+
+import (
+	"strings"
+
+	"github.com/antonmedv/expr/completion"
+)
+
+// Complete returns candidates to replace the last word of the line, which
+// starts at the returned position: names of variables, builtins and keywords,
+// or fields, methods and keys after the dot, like "Name" of "user.Na".
+func (r *REPL) Complete(line string) (int, []string) {
+	result := completion.CompleteWithConfig(line, len(line), r.config())
+	word := line[result.From:]
+	var candidates []string
+	for _, c := range result.Candidates {
+		if strings.HasPrefix(c.Label, word) {
+			candidates = append(candidates, c.Label)
+		}
+	}
+	return result.From, candidates
+}
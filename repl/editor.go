@@ -0,0 +1,204 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupt is returned by readLine on Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+// editor reads lines from terminal in raw mode. It supports moving of cursor,
+// navigation in history by arrows and completion by Tab.
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	prompt   string
+	history  []string
+	complete func(line string) (int, []string)
+
+	line []rune
+	pos  int
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyBackspace = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCR        = 13
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+func (e *editor) readLine() (string, error) {
+	e.line, e.pos = nil, 0
+	index := len(e.history) // position in history, len(history) is the new line
+	saved := ""             // new line, saved while history is browsed
+	fmt.Fprint(e.out, e.prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.line) > 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return string(e.line), nil
+			}
+			return "", err
+		}
+		switch r {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				return "", io.EOF
+			}
+			e.delete()
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.line)
+		case keyCtrlU:
+			e.line, e.pos = e.line[e.pos:], 0
+		case keyBackspace, keyDelete:
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+		case keyTab:
+			e.completeLine()
+		case keyEscape:
+			switch e.escape() {
+			case "[A":
+				if index > 0 {
+					if index == len(e.history) {
+						saved = string(e.line)
+					}
+					index--
+					e.set(e.history[index])
+				}
+			case "[B":
+				if index < len(e.history) {
+					index++
+					if index == len(e.history) {
+						e.set(saved)
+					} else {
+						e.set(e.history[index])
+					}
+				}
+			case "[C":
+				if e.pos < len(e.line) {
+					e.pos++
+				}
+			case "[D":
+				if e.pos > 0 {
+					e.pos--
+				}
+			case "[H":
+				e.pos = 0
+			case "[F":
+				e.pos = len(e.line)
+			case "[3~":
+				e.delete()
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(string(r))
+			}
+		}
+		e.redraw()
+	}
+}
+
+// escape reads the rest of escape sequence, like "[A" of the up arrow.
+func (e *editor) escape() string {
+	var seq []rune
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, r)
+		if len(seq) == 1 && r != '[' && r != 'O' {
+			return ""
+		}
+		if len(seq) > 1 && (unicode.IsLetter(r) || r == '~') {
+			if seq[0] == 'O' {
+				seq[0] = '[' // application mode of arrows
+			}
+			return string(seq)
+		}
+	}
+}
+
+func (e *editor) insert(s string) {
+	runes := []rune(s)
+	line := make([]rune, 0, len(e.line)+len(runes))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, runes...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(runes)
+}
+
+func (e *editor) delete() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+func (e *editor) set(s string) {
+	e.line = []rune(s)
+	e.pos = len(e.line)
+}
+
+// completeLine completes the word before cursor. Unique candidate replaces
+// the word, otherwise the common prefix of candidates is inserted, or
+// candidates are listed.
+func (e *editor) completeLine() {
+	if e.complete == nil {
+		return
+	}
+	before := string(e.line[:e.pos])
+	start, candidates := e.complete(before)
+	if len(candidates) == 0 {
+		return
+	}
+	word := before[start:]
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		prefix = commonPrefix(prefix, c)
+	}
+	if len(prefix) > len(word) {
+		e.insert(prefix[len(word):])
+		return
+	}
+	if len(candidates) > 1 {
+		fmt.Fprint(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+func (e *editor) redraw() {
+	fmt.Fprint(e.out, "\r\x1b[K"+e.prompt+string(e.line))
+	if n := len(e.line) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
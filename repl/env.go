@@ -0,0 +1,70 @@
+package repl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadEnv reads environment from JSON or YAML file, selected by extension.
+// Whole numbers of JSON are decoded as integers.
+func LoadEnv(path string) (map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	unmarshal := json.Unmarshal
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		unmarshal = yaml.Unmarshal
+	}
+	env, err := decode(f, unmarshal)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return env, nil
+}
+
+// ReadEnv reads environment in JSON. Whole numbers are decoded as integers.
+func ReadEnv(r io.Reader) (map[string]interface{}, error) {
+	return decode(r, json.Unmarshal)
+}
+
+func decode(r io.Reader, unmarshal func([]byte, interface{}) error) (map[string]interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var env map[string]interface{}
+	if err := unmarshal(b, &env); err != nil {
+		return nil, err
+	}
+	integers(env)
+	return env, nil
+}
+
+// integers converts whole floats of decoded JSON to integers, so they can be
+// used as indexes and in integer arithmetic.
+func integers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = integers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = integers(value)
+		}
+	}
+	return v
+}
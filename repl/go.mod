@@ -0,0 +1,11 @@
+module github.com/antonmedv/expr/repl
+
+go 1.13
+
+require (
+	github.com/antonmedv/expr v1.10.0
+	github.com/stretchr/testify v1.8.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/antonmedv/expr => ../
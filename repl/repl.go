@@ -0,0 +1,257 @@
+// Package repl implements interactive evaluation of expressions, with
+// history, completion of names of the environment and commands to load
+// environments and inspect expressions.
+package repl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/parser"
+)
+
+// ErrQuit is returned by Eval on the quit command.
+var ErrQuit = errors.New("quit")
+
+const help = `:load <file>    load environment from JSON or YAML file
+:env            list variables of environment
+:type <expr>    print type of expression
+:ast <expr>     print tree of expression
+:asm <expr>     print bytecode of expression
+:fmt <expr>     print expression in canonical form
+:history        list history
+:quit           exit`
+
+// REPL evaluates expressions with the environment.
+type REPL struct {
+	// Env is the environment of expressions.
+	Env interface{}
+	// Options are passed to compilation of every expression.
+	Options []expr.Option
+	// History holds evaluated lines, oldest first.
+	History []string
+	// HistoryFile, if set, is read by Run, and every line is appended to it.
+	HistoryFile string
+	// Prompt is printed before every line.
+	Prompt string
+}
+
+// New creates REPL with the environment.
+func New(env interface{}, ops ...expr.Option) *REPL {
+	return &REPL{Env: env, Options: ops, Prompt: "> "}
+}
+
+// Run reads lines from in and prints results to out, until the end of in or
+// the quit command. If terminal is true, in is a terminal in raw mode, and
+// lines are edited with history and completion by Tab.
+func (r *REPL) Run(in io.Reader, out io.Writer, terminal bool) error {
+	r.loadHistory()
+	var read func() (string, error)
+	if terminal {
+		e := &editor{
+			in:       bufio.NewReader(in),
+			out:      out,
+			prompt:   r.Prompt,
+			history:  r.History,
+			complete: r.Complete,
+		}
+		read = func() (string, error) {
+			e.history = r.History
+			return e.readLine()
+		}
+	} else {
+		scanner := bufio.NewScanner(in)
+		read = func() (string, error) {
+			fmt.Fprint(out, r.Prompt)
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		}
+	}
+
+	newline := "\n"
+	if terminal {
+		newline = "\r\n"
+	}
+	for {
+		line, err := read()
+		if err == errInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			fmt.Fprint(out, newline)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		r.addHistory(line)
+
+		result, err := r.Eval(line)
+		if err == ErrQuit {
+			return nil
+		}
+		if err != nil {
+			result = fmt.Sprintf("%+v", err)
+		}
+		if result != "" {
+			fmt.Fprint(out, strings.Replace(result, "\n", newline, -1)+newline)
+		}
+	}
+}
+
+// Eval evaluates expression or command, and returns printed result.
+func (r *REPL) Eval(line string) (string, error) {
+	if !strings.HasPrefix(line, ":") {
+		program, err := expr.Compile(line, r.options()...)
+		if err != nil {
+			return "", err
+		}
+		out, err := expr.Run(program, r.Env)
+		if err != nil {
+			return "", err
+		}
+		return format(out), nil
+	}
+
+	command, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		command, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch command {
+	case ":help", ":h":
+		return help, nil
+	case ":quit", ":q", ":exit":
+		return "", ErrQuit
+	case ":history":
+		lines := make([]string, len(r.History))
+		for i, h := range r.History {
+			lines[i] = fmt.Sprintf("%4d  %v", i+1, h)
+		}
+		return strings.Join(lines, "\n"), nil
+	case ":load":
+		env, err := LoadEnv(arg)
+		if err != nil {
+			return "", err
+		}
+		r.Env = env
+		return fmt.Sprintf("loaded %v variables", len(env)), nil
+	case ":env":
+		types := conf.CreateTypesTable(r.Env)
+		lines := make([]string, 0, len(types))
+		for name, t := range types {
+			lines = append(lines, fmt.Sprintf("%v %v", name, t.Type))
+		}
+		sort.Strings(lines)
+		return strings.Join(lines, "\n"), nil
+	case ":type":
+		config := r.config()
+		tree, err := parser.ParseWithOptions(arg, config.ParserOptions())
+		if err != nil {
+			return "", err
+		}
+		t, err := checker.Check(tree, config)
+		if err != nil {
+			return "", err
+		}
+		if t == nil {
+			return "interface {}", nil
+		}
+		return t.String(), nil
+	case ":ast":
+		tree, err := parser.Parse(arg)
+		if err != nil {
+			return "", err
+		}
+		return ast.Dump(tree.Node), nil
+	case ":asm":
+		program, err := expr.Compile(arg, r.options()...)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(program.Disassemble(), "\n"), nil
+	case ":fmt":
+		tree, err := parser.Parse(arg)
+		if err != nil {
+			return "", err
+		}
+		return parser.Format(tree.Node), nil
+	}
+	return "", fmt.Errorf("unknown command %v, see :help", command)
+}
+
+func (r *REPL) options() []expr.Option {
+	ops := make([]expr.Option, 0, len(r.Options)+1)
+	if r.Env != nil {
+		ops = append(ops, expr.Env(r.Env))
+	}
+	return append(ops, r.Options...)
+}
+
+func (r *REPL) config() *conf.Config {
+	config := conf.CreateNew()
+	for _, op := range r.options() {
+		op(config)
+	}
+	return config
+}
+
+// format returns result as JSON, or formatted by fmt if it can not be encoded.
+func format(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+func (r *REPL) addHistory(line string) {
+	if n := len(r.History); n > 0 && r.History[n-1] == line {
+		return
+	}
+	r.History = append(r.History, line)
+	if r.HistoryFile == "" {
+		return
+	}
+	f, err := os.OpenFile(r.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+func (r *REPL) loadHistory() {
+	if r.HistoryFile == "" {
+		return
+	}
+	f, err := os.Open(r.HistoryFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			r.History = append(r.History, line)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package repl_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antonmedv/expr/repl"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func (u user) Adult() bool { return u.Age >= 18 }
+
+type env struct {
+	User   user
+	Users  []user
+	Config map[string]interface{}
+}
+
+func newEnv() env {
+	return env{
+		User:   user{Name: "bob", Age: 30},
+		Config: map[string]interface{}{"debug": true, "depth": 3},
+	}
+}
+
+func TestREPL_Eval(t *testing.T) {
+	r := repl.New(newEnv())
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`User.Name + "!"`, `"bob!"`},
+		{`User.Adult()`, `true`},
+		{`map([1, 2], {# * 2})`, `[2,4]`},
+		{`:type User.Age * 1.5`, `float64`},
+		{`:type Config.depth`, `interface {}`},
+		{`:fmt (1+2)*3`, `(1 + 2) * 3`},
+		{`:ast nil`, "NilNode{\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			out, err := r.Eval(tt.line)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, out)
+		})
+	}
+}
+
+func TestREPL_Eval_errors(t *testing.T) {
+	r := repl.New(newEnv())
+
+	_, err := r.Eval(`User.Unknown`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "type repl_test.user has no field Unknown")
+
+	_, err = r.Eval(`:unknown`)
+	require.EqualError(t, err, "unknown command :unknown, see :help")
+
+	_, err = r.Eval(`:quit`)
+	require.Equal(t, repl.ErrQuit, err)
+}
+
+func TestREPL_Eval_load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "env.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{"count": 2, "name": "bob"}`), 0644))
+
+	r := repl.New(nil)
+	out, err := r.Eval(`:load ` + file)
+	require.NoError(t, err)
+	require.Equal(t, `loaded 2 variables`, out)
+
+	out, err = r.Eval(`:env`)
+	require.NoError(t, err)
+	require.Equal(t, "count int\nname string", out)
+
+	out, err = r.Eval(`count * 2`)
+	require.NoError(t, err)
+	require.Equal(t, `4`, out)
+}
+
+func TestREPL_Complete(t *testing.T) {
+	r := repl.New(newEnv())
+	tests := []struct {
+		line       string
+		start      int
+		candidates []string
+	}{
+		{`Us`, 0, []string{"User", "Users"}},
+		{`1 + fil`, 4, []string{"filter"}},
+		{`User.`, 5, []string{"Age", "Name", "Adult"}},
+		{`User.A`, 5, []string{"Age", "Adult"}},
+		{`Config.de`, 7, []string{"debug", "depth"}},
+		{`Users[0].N`, 9, []string{"Name"}},
+		{`Unknown.`, 8, nil},
+		{`1.`, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			start, candidates := r.Complete(tt.line)
+			require.Equal(t, tt.start, start)
+			require.Equal(t, tt.candidates, candidates)
+		})
+	}
+}
+
+func TestREPL_Run(t *testing.T) {
+	r := repl.New(newEnv())
+	r.Prompt = "> "
+	var out bytes.Buffer
+	err := r.Run(strings.NewReader("User.Age + 1\n\n1 / 0\n:history\n:quit\n2\n"), &out, false)
+	require.NoError(t, err)
+	require.Equal(t, "> 31\n> > +Inf\n>    1  User.Age + 1\n   2  1 / 0\n   3  :history\n> ", out.String())
+}
+
+func TestREPL_Run_history(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+	require.NoError(t, ioutil.WriteFile(file, []byte("1 + 1\n"), 0600))
+
+	r := repl.New(nil)
+	r.HistoryFile = file
+	var out bytes.Buffer
+	require.NoError(t, r.Run(strings.NewReader("2 + 2\n"), &out, false))
+	require.Equal(t, []string{"1 + 1", "2 + 2"}, r.History)
+
+	b, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "1 + 1\n2 + 2\n", string(b))
+}
+
+func TestREPL_Run_terminal(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"User.Na\t\r", `"bob"`},                 // unique completion
+		{"Use\t\r", `{"Name":"bob","Age":30}`},   // common prefix
+		{"\x1b[A * 2\r", `60`},                   // history
+		{"1 + 23\x1b[D\x1b[D\x7f\r", `24`},       // cursor and backspace
+		{"xUser.Age\x01\x1b[3~\x05 + 1\r", `31`}, // delete, home and end
+		{"9\x03User.Age\r", `30`},                // interrupt
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			r := repl.New(newEnv())
+			r.History = []string{"User.Age"}
+			var out bytes.Buffer
+			require.NoError(t, r.Run(strings.NewReader(tt.input+"\x04"), &out, true))
+			require.Contains(t, out.String(), "\r\n"+tt.want+"\r\n")
+		})
+	}
+}
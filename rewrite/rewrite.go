@@ -0,0 +1,267 @@
+// Package rewrite migrates stored expressions with rules, which replace
+// patterns with replacements, like calls of a renamed function:
+//
+//	r := rewrite.New(
+//		rewrite.MustRule(`oldFn($a, $b)`, `newFn($b, $a)`),
+//		rewrite.MustRule(`$x.Name`, `$x.FullName`),
+//		rewrite.MustRule(`$a ** $b`, `pow($a, $b)`),
+//	)
+//	out, n, err := r.Rewrite(source)
+//
+// Identifiers of patterns starting with $ are metavariables, which match any
+// expression, and are replaced in replacements by sources of matched
+// expressions. Metavariables used more than once in a pattern match equal
+// expressions. Patterns match parsed expressions, so spaces and parentheses
+// are not significant, and sources outside of matches are kept as they are.
+package rewrite
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/parser"
+)
+
+// Rule replaces expressions matching the pattern with the replacement.
+type Rule struct {
+	Pattern     string
+	Replacement string
+	pattern     ast.Node
+	replacement *document
+	root        ast.Node
+}
+
+// NewRule returns the rule replacing the pattern with the replacement.
+// Metavariables of replacements must be metavariables of patterns.
+func NewRule(pattern, replacement string) (*Rule, error) {
+	p, err := parser.Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %v: %v", pattern, err)
+	}
+	if isMeta(p.Node) {
+		return nil, fmt.Errorf("pattern %v matches any expression", pattern)
+	}
+	r, err := parser.Parse(replacement)
+	if err != nil {
+		return nil, fmt.Errorf("replacement %v: %v", replacement, err)
+	}
+	declared := metavariables(p.Node)
+	for name := range metavariables(r.Node) {
+		if !declared[name] {
+			return nil, fmt.Errorf("replacement %v: %v is not a metavariable of pattern %v", replacement, name, pattern)
+		}
+	}
+	d, err := newDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{
+		Pattern:     pattern,
+		Replacement: replacement,
+		pattern:     p.Node,
+		replacement: d,
+		root:        r.Node,
+	}, nil
+}
+
+// MustRule is like NewRule, but panics on invalid rules.
+func MustRule(pattern, replacement string) *Rule {
+	r, err := NewRule(pattern, replacement)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *Rule) String() string {
+	return r.Pattern + " -> " + r.Replacement
+}
+
+// Rewriter applies rules to sources of expressions.
+type Rewriter struct {
+	rules []*Rule
+}
+
+// New returns the rewriter with rules. Rules are tried in order, and the
+// first matching rule replaces the expression.
+func New(rules ...*Rule) *Rewriter {
+	return &Rewriter{rules: rules}
+}
+
+// Rewrite returns the source with expressions matching rules replaced, and
+// the number of replacements. Matches of outer expressions are replaced
+// first, and expressions of their metavariables are rewritten too, but
+// replacements are not matched again. The result must be a valid
+// expression.
+func (r *Rewriter) Rewrite(source string) (string, int, error) {
+	tree, err := parser.Parse(source)
+	if err != nil {
+		return "", 0, err
+	}
+	d, err := newDocument(tree)
+	if err != nil {
+		return "", 0, err
+	}
+	count := 0
+	var replace func(node, parent ast.Node) (string, bool)
+	replace = func(node, parent ast.Node) (string, bool) {
+		if m, ok := parent.(*ast.MemberNode); ok && m.Property == node {
+			return "", false
+		}
+		for _, rule := range r.rules {
+			captures := map[string]ast.Node{}
+			if !match(rule.pattern, node, captures) {
+				continue
+			}
+			count++
+			text := rule.replacement.render(rule.root, nil, func(n, p ast.Node) (string, bool) {
+				id, ok := n.(*ast.IdentifierNode)
+				if !ok || !isMeta(id) {
+					return "", false
+				}
+				capture := d.render(captures[id.Value], nil, replace)
+				if isOperand(p) && isCompound(capture) {
+					capture = "(" + capture + ")"
+				}
+				return capture, true
+			})
+			if isOperand(parent) && compound(rule.root) && !sameOperator(node, rule.root) {
+				text = "(" + text + ")"
+			}
+			return text, true
+		}
+		return "", false
+	}
+	out := d.render(tree.Node, nil, replace)
+	if count == 0 {
+		return source, 0, nil
+	}
+	if start := d.spans[tree.Node]; start.Start > 0 || start.End < len(d.source) {
+		// Keep spaces and parentheses around the expression.
+		out = string(d.source[:start.Start]) + out + string(d.source[start.End:])
+	}
+	if _, err := parser.Parse(out); err != nil {
+		return "", 0, fmt.Errorf("invalid result of rewrite %v: %v", out, err)
+	}
+	return out, count, nil
+}
+
+func isMeta(node ast.Node) bool {
+	id, ok := node.(*ast.IdentifierNode)
+	return ok && strings.HasPrefix(id.Value, "$") && len(id.Value) > 1
+}
+
+func metavariables(node ast.Node) map[string]bool {
+	names := map[string]bool{}
+	ast.Walk(&node, visitor(func(n *ast.Node) {
+		if isMeta(*n) {
+			names[(*n).(*ast.IdentifierNode).Value] = true
+		}
+	}))
+	return names
+}
+
+type visitor func(node *ast.Node)
+
+func (v visitor) Visit(node *ast.Node) {
+	v(node)
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// match reports whether the node matches the pattern, and records nodes
+// matched by metavariables in captures.
+func match(pattern, node ast.Node, captures map[string]ast.Node) bool {
+	if isMeta(pattern) {
+		name := pattern.(*ast.IdentifierNode).Value
+		if prev, ok := captures[name]; ok {
+			return parser.Format(prev) == parser.Format(node)
+		}
+		captures[name] = node
+		return true
+	}
+	return matchValue(reflect.ValueOf(pattern), reflect.ValueOf(node), captures)
+}
+
+// matchValue compares exported fields of nodes, and matches their children.
+func matchValue(p, n reflect.Value, captures map[string]ast.Node) bool {
+	if p.Kind() == reflect.Interface {
+		if p.IsNil() || n.IsNil() {
+			return p.IsNil() && n.IsNil()
+		}
+		if p.Type() == nodeType {
+			return match(p.Interface().(ast.Node), n.Interface().(ast.Node), captures)
+		}
+		p, n = p.Elem(), n.Elem()
+	}
+	if p.Type() != n.Type() {
+		return false
+	}
+	switch p.Kind() {
+	case reflect.Ptr:
+		if p.IsNil() || n.IsNil() {
+			return p.IsNil() && n.IsNil()
+		}
+		if p.Elem().Kind() != reflect.Struct {
+			return p.Pointer() == n.Pointer()
+		}
+		return matchValue(p.Elem(), n.Elem(), captures)
+	case reflect.Struct:
+		for i := 0; i < p.NumField(); i++ {
+			if p.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if !matchValue(p.Field(i), n.Field(i), captures) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if p.Len() != n.Len() {
+			return false
+		}
+		for i := 0; i < p.Len(); i++ {
+			if !matchValue(p.Index(i), n.Index(i), captures) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(p.Interface(), n.Interface())
+}
+
+// isOperand reports whether children of the node are operands of operators,
+// which may need parentheses.
+func isOperand(parent ast.Node) bool {
+	switch parent.(type) {
+	case *ast.UnaryNode, *ast.BinaryNode, *ast.MemberNode, *ast.SliceNode, *ast.ChainNode, *ast.ConditionalNode:
+		return true
+	}
+	return false
+}
+
+// compound reports whether the node is an operation without brackets, like
+// a + b.
+func compound(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.UnaryNode, *ast.BinaryNode, *ast.ConditionalNode, *ast.BindNode:
+		return true
+	}
+	return false
+}
+
+// isCompound reports whether the source is a compound expression.
+func isCompound(source string) bool {
+	tree, err := parser.Parse(source)
+	return err == nil && compound(tree.Node)
+}
+
+// sameOperator reports whether replacements of the node need no
+// parentheses, as they have the same binary operator.
+func sameOperator(node, replacement ast.Node) bool {
+	a, ok := node.(*ast.BinaryNode)
+	b, ok2 := replacement.(*ast.BinaryNode)
+	return ok && ok2 && a.Operator == b.Operator
+}
@@ -0,0 +1,70 @@
+package rewrite_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr/rewrite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriter_Rewrite(t *testing.T) {
+	r := rewrite.New(
+		rewrite.MustRule(`oldFn($a, $b)`, `newFn($b, $a)`),
+		rewrite.MustRule(`$x.Name`, `$x.FullName`),
+		rewrite.MustRule(`$a ** $b`, `pow($a, $b)`),
+		rewrite.MustRule(`double($a)`, `$a * 2`),
+		rewrite.MustRule(`$a == $a`, `true`),
+		rewrite.MustRule(`legacy`, `current`),
+		rewrite.MustRule(`$a in $b`, `has($b, $a)`),
+		rewrite.MustRule(`now()`, `clock.Now()`),
+	)
+	tests := []struct {
+		input, output string
+		count         int
+	}{
+		{`oldFn(1, "a")`, `newFn("a", 1)`, 1},
+		{"oldFn( x+1 ,\n\ty )  &&  z", "newFn(y, x+1)  &&  z", 1},
+		{`oldFn(oldFn(a, b), c)`, `newFn(c, newFn(b, a))`, 2},
+		{`user.Name + "!"`, `user.FullName + "!"`, 1},
+		{`users[0].Name`, `users[0].FullName`, 1},
+		{`a.Name.Name`, `a.FullName.FullName`, 2},
+		{`(x + 1) ** 2`, `pow(x + 1, 2)`, 1},
+		{`1 + double(x + y)`, `1 + ((x + y) * 2)`, 1},
+		{`double(x)`, `x * 2`, 1},
+		{`f(a.b == a.b, a == b)`, `f(true, a == b)`, 1},
+		{`legacy(legacy.x)`, `current(current.x)`, 2},
+		{`x.legacy`, `x.legacy`, 0},
+		{`a not in [1, 2]`, `not (has([1, 2], a))`, 1},
+		{`all(xs, {# in ys})`, `all(xs, {has(ys, #)})`, 1},
+		{` ( now() ) `, ` ( clock.Now() ) `, 1},
+		{`x ? now() : 1 ** 2`, `x ? clock.Now() : pow(1, 2)`, 2},
+		{`{a: oldFn(1, 2), "b": [legacy]}`, `{a: newFn(2, 1), "b": [current]}`, 2},
+		{`{(legacy): 1, b: legacy}`, `{(current): 1, b: current}`, 2},
+		{`[oldFn(x, 1) for x in legacy if x > 0]`, `[newFn(1, x) for x in current if x > 0]`, 2},
+		{`let v = legacy; v.Name`, `let v = current; v.FullName`, 2},
+		{`len( "untouched" )`, `len( "untouched" )`, 0},
+	}
+	for _, test := range tests {
+		out, n, err := r.Rewrite(test.input)
+		require.NoError(t, err, test.input)
+		assert.Equal(t, test.output, out, test.input)
+		assert.Equal(t, test.count, n, test.input)
+	}
+
+	_, _, err := r.Rewrite(`1 +`)
+	require.Error(t, err)
+}
+
+func TestNewRule(t *testing.T) {
+	_, err := rewrite.NewRule(`$a`, `1`)
+	require.EqualError(t, err, "pattern $a matches any expression")
+
+	_, err = rewrite.NewRule(`f($a)`, `g($b)`)
+	require.EqualError(t, err, "replacement g($b): $b is not a metavariable of pattern f($a)")
+
+	_, err = rewrite.NewRule(`f(`, `g()`)
+	require.Error(t, err)
+
+	require.Equal(t, "f($a) -> g($a)", rewrite.MustRule(`f($a)`, `g($a)`).String())
+}
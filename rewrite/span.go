@@ -0,0 +1,72 @@
+package rewrite
+
+import (
+	"sort"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/parser"
+)
+
+// document holds the source of a parsed expression, and spans of its nodes.
+type document struct {
+	source []rune
+	spans  map[ast.Node]parser.Span
+}
+
+func newDocument(tree *parser.Tree) (*document, error) {
+	spans, err := parser.Spans(tree)
+	if err != nil {
+		return nil, err
+	}
+	return &document{source: []rune(tree.Source.Content()), spans: spans}, nil
+}
+
+// render returns the source of the node, with sources of children replaced
+// by their renders. Nodes, for which replace returns true, are replaced by
+// its result instead.
+func (d *document) render(node, parent ast.Node, replace func(node, parent ast.Node) (string, bool)) string {
+	if s, ok := replace(node, parent); ok {
+		return s
+	}
+	s, ok := d.spans[node]
+	if !ok {
+		return parser.Format(node)
+	}
+	type edit struct {
+		parser.Span
+		text string
+	}
+	var edits []edit
+	for _, child := range ast.Children(node) {
+		cs, ok := d.spans[*child]
+		if !ok || cs.Start < s.Start || cs.End > s.End {
+			continue
+		}
+		text := d.render(*child, node, replace)
+		if text == string(d.source[cs.Start:cs.End]) {
+			continue
+		}
+		if u, ok := node.(*ast.UnaryNode); ok && cs == s {
+			// Negated operators, like a not in b, are unary nodes of binary
+			// nodes of the same span.
+			return u.Operator + " (" + text + ")"
+		}
+		edits = append(edits, edit{cs, text})
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].Start < edits[j].Start
+	})
+	var out []rune
+	pos := s.Start
+	for _, e := range edits {
+		if e.Start < pos {
+			// Children of the same span, like chains of members.
+			continue
+		}
+		out = append(out, d.source[pos:e.Start]...)
+		out = append(out, []rune(e.text)...)
+		pos = e.End
+	}
+	out = append(out, d.source[pos:s.End]...)
+	return string(out)
+}
@@ -0,0 +1,17 @@
+module github.com/antonmedv/expr/ruleset
+
+go 1.18
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/antonmedv/expr v1.10.0
+	github.com/stretchr/testify v1.8.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
+
+replace github.com/antonmedv/expr => ../
@@ -0,0 +1,395 @@
+// Package ruleset loads rules, which are expressions with metadata, from
+// YAML and TOML files, and compiles them against an environment. It is a
+// separate module, so programs not loading rules do not depend on YAML and
+// TOML libraries.
+//
+//	rules:
+//	  - id: adult
+//	    description: User is an adult.
+//	    expression: user.Age >= 18
+//	    tags: [kyc]
+//	    type: bool
+//
+// Rules may also be stored in files of expressions with front matter in YAML,
+// between lines "---", or in TOML, between lines "+++":
+//
+//	---
+//	id: adult
+//	tags: [kyc]
+//	---
+//	user.Age >= 18
+//
+// Errors of all rules are reported together:
+//
+//	set, err := ruleset.Load([]string{"rules/"}, expr.Env(Env{}))
+//	for _, e := range err.(ruleset.Errors) { ... }
+package ruleset
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is an expression with metadata.
+type Rule struct {
+	ID          string   `yaml:"id" toml:"id"`
+	Description string   `yaml:"description" toml:"description"`
+	Expression  string   `yaml:"expression" toml:"expression"`
+	Tags        []string `yaml:"tags" toml:"tags"`
+	// Type is the expected type of results: "bool", "int", "int64", "float",
+	// "string", or empty for any type.
+	Type string `yaml:"type" toml:"type"`
+	// File and Line of the rule, if loaded from a file.
+	File string `yaml:"-" toml:"-"`
+	Line int    `yaml:"-" toml:"-"`
+	// Program is the compiled expression.
+	Program *vm.Program `yaml:"-" toml:"-"`
+}
+
+// Run runs the program of the rule.
+func (r *Rule) Run(env interface{}) (interface{}, error) {
+	return expr.Run(r.Program, env)
+}
+
+// RuleSet of compiled rules with unique ids.
+type RuleSet struct {
+	Rules []*Rule
+	ids   map[string]*Rule
+}
+
+// Rule returns the rule of the id, or nil.
+func (s *RuleSet) Rule(id string) *Rule {
+	return s.ids[id]
+}
+
+// Tagged returns rules with the tag.
+func (s *RuleSet) Tagged(tag string) []*Rule {
+	var rules []*Rule
+	for _, r := range s.Rules {
+		for _, t := range r.Tags {
+			if t == tag {
+				rules = append(rules, r)
+				break
+			}
+		}
+	}
+	return rules
+}
+
+// Error of a rule.
+type Error struct {
+	File string
+	Line int
+	// ID of the rule, if known.
+	ID  string
+	Err error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%v", e.Line)
+		}
+		b.WriteString(": ")
+	}
+	if e.ID != "" {
+		fmt.Fprintf(&b, "rule %v: ", e.ID)
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors of all rules, which failed to load or compile.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Load reads rules of files, and of files with extensions .yaml, .yml, .toml
+// and .expr in directories, and compiles them with options.
+func Load(paths []string, options ...expr.Option) (*RuleSet, error) {
+	var rules []*Rule
+	var errs Errors
+	for _, path := range paths {
+		files, err := list(path)
+		if err != nil {
+			errs = append(errs, &Error{File: path, Err: err})
+			continue
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				errs = append(errs, &Error{File: file, Err: err})
+				continue
+			}
+			parsed, err := Parse(file, data)
+			if err != nil {
+				errs = append(errs, err.(Errors)...)
+			}
+			rules = append(rules, parsed...)
+		}
+	}
+	set, err := Compile(rules, options...)
+	if err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+	if len(errs) > 0 {
+		return set, errs
+	}
+	return set, nil
+}
+
+// list returns the file, or files of rules in the directory, sorted.
+func list(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(file) {
+		case ".yaml", ".yml", ".toml", ".expr":
+			if !info.IsDir() {
+				files = append(files, file)
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Parse returns rules of the file by its extension: lists of rules in YAML
+// or TOML, or an expression with front matter for other extensions. Rules
+// of front matter without id have the name of the file without extension.
+// Errors are Errors.
+func Parse(name string, data []byte) ([]*Rule, error) {
+	var rules []*Rule
+	var err error
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml":
+		rules, err = parseYAML(data)
+	case ".toml":
+		rules, err = parseTOML(data)
+	default:
+		var r *Rule
+		r, err = parseFrontMatter(data)
+		if r != nil {
+			if r.ID == "" {
+				r.ID = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+			}
+			rules = []*Rule{r}
+		}
+	}
+	if err != nil {
+		line := 0
+		if e, ok := err.(*lineError); ok {
+			line, err = e.line, e.err
+		}
+		return nil, Errors{{File: name, Line: line, Err: err}}
+	}
+	for _, r := range rules {
+		r.File = name
+	}
+	return rules, nil
+}
+
+// lineError is an error at the line of a file.
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("%v: %v", e.line, e.err)
+}
+
+// parseYAML returns rules of the list, or of the list of rules key.
+func parseYAML(data []byte) ([]*Rule, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	list := doc.Content[0]
+	if list.Kind == yaml.MappingNode {
+		list = nil
+		for i := 0; i+1 < len(doc.Content[0].Content); i += 2 {
+			if doc.Content[0].Content[i].Value == "rules" {
+				list = doc.Content[0].Content[i+1]
+			}
+		}
+		if list == nil {
+			return nil, &lineError{doc.Content[0].Line, fmt.Errorf("no rules")}
+		}
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, &lineError{list.Line, fmt.Errorf("rules must be a list")}
+	}
+	rules := make([]*Rule, len(list.Content))
+	for i, item := range list.Content {
+		r := &Rule{Line: item.Line}
+		if err := item.Decode(r); err != nil {
+			return nil, &lineError{item.Line, err}
+		}
+		rules[i] = r
+	}
+	return rules, nil
+}
+
+// parseTOML returns rules of the array of tables [[rules]].
+func parseTOML(data []byte) ([]*Rule, error) {
+	var doc struct {
+		Rules []*Rule `toml:"rules"`
+	}
+	if err := decodeTOML(data, &doc); err != nil {
+		return nil, err
+	}
+	headers := rulesHeader.FindAllIndex(data, -1)
+	for i, r := range doc.Rules {
+		if i < len(headers) {
+			r.Line = bytes.Count(data[:headers[i][0]], []byte("\n")) + 1
+		}
+	}
+	return doc.Rules, nil
+}
+
+// rulesHeader matches headers of tables of the array of rules, which lines
+// are lines of rules.
+var rulesHeader = regexp.MustCompile(`(?m)^[ \t]*\[\[[ \t]*"?rules"?[ \t]*\]\]`)
+
+// decodeTOML decodes the document, with lines of errors.
+func decodeTOML(data []byte, v interface{}) error {
+	_, err := toml.Decode(string(data), v)
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return &lineError{parseErr.Position.Line, errors.New(parseErr.Message)}
+	}
+	return err
+}
+
+// parseFrontMatter returns the rule of the expression after front matter.
+func parseFrontMatter(data []byte) (*Rule, error) {
+	r := &Rule{Line: 1}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	delimiter := strings.TrimSpace(string(lines[0]))
+	if delimiter != "---" && delimiter != "+++" {
+		r.Expression = strings.TrimSpace(string(data))
+		return r, nil
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(string(lines[i])) != delimiter {
+			continue
+		}
+		meta := bytes.Join(lines[1:i], nil)
+		if delimiter == "---" {
+			if err := yaml.Unmarshal(meta, r); err != nil {
+				return nil, err
+			}
+		} else if err := decodeTOML(meta, r); err != nil {
+			return nil, err
+		}
+		r.Line = i + 2
+		r.Expression = strings.TrimSpace(string(bytes.Join(lines[i+1:], nil)))
+		return r, nil
+	}
+	return nil, &lineError{1, fmt.Errorf("unterminated front matter")}
+}
+
+// Compile compiles rules with options and expected types of their results.
+// Rules must have unique ids, which are not empty. Errors are Errors of all rules, and the set
+// holds rules, which are compiled.
+func Compile(rules []*Rule, options ...expr.Option) (*RuleSet, error) {
+	set := &RuleSet{ids: make(map[string]*Rule, len(rules))}
+	seen := make(map[string]*Rule, len(rules))
+	var errs Errors
+	for _, r := range rules {
+		fail := func(err error) {
+			errs = append(errs, &Error{File: r.File, Line: r.Line, ID: r.ID, Err: err})
+		}
+		if r.ID == "" {
+			fail(fmt.Errorf("rule has no id"))
+			continue
+		}
+		if prev, ok := seen[r.ID]; ok {
+			fail(fmt.Errorf("duplicate id of rule of %v", location(prev)))
+			continue
+		}
+		seen[r.ID] = r
+		as, err := expect(r.Type)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		program, err := expr.Compile(r.Expression, append(options[:len(options):len(options)], as...)...)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		r.Program = program
+		set.ids[r.ID] = r
+		set.Rules = append(set.Rules, r)
+	}
+	if len(errs) > 0 {
+		return set, errs
+	}
+	return set, nil
+}
+
+func location(r *Rule) string {
+	if r.File == "" {
+		return "rule " + r.ID
+	}
+	return fmt.Sprintf("%v:%v", r.File, r.Line)
+}
+
+// expect returns options of the expected type of results.
+func expect(t string) ([]expr.Option, error) {
+	switch t {
+	case "", "any":
+		return nil, nil
+	case "bool":
+		return []expr.Option{expr.AsBool()}, nil
+	case "int":
+		return []expr.Option{expr.AsInt()}, nil
+	case "int64":
+		return []expr.Option{expr.AsInt64()}, nil
+	case "float", "float64":
+		return []expr.Option{expr.AsFloat64()}, nil
+	case "string":
+		return []expr.Option{expr.AsKind(reflect.String)}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", t)
+}
@@ -0,0 +1,115 @@
+package ruleset
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/stretchr/testify/require"
+)
+
+type User struct {
+	Name    string
+	Age     int
+	Premium bool
+}
+
+type Env struct {
+	User User `expr:"user"`
+}
+
+func TestLoad(t *testing.T) {
+	set, err := Load([]string{"testdata/rules"}, expr.Env(Env{}))
+	require.NoError(t, err)
+
+	var ids []string
+	for _, r := range set.Rules {
+		ids = append(ids, r.ID)
+	}
+	require.Equal(t, []string{"adult", "name", "premium", "score", "ratio", "trial-user"}, ids)
+
+	adult := set.Rule("adult")
+	require.Equal(t, "User is an adult.", adult.Description)
+	require.Equal(t, filepath.Join("testdata", "rules", "kyc.yaml"), adult.File)
+	require.Equal(t, 2, adult.Line)
+
+	score := set.Rule("score")
+	require.Equal(t, "user.Age * 2 +\n  len(user.Name)", score.Expression)
+	require.Equal(t, []string{"scoring", "kyc"}, score.Tags)
+	require.Equal(t, 2, score.Line)
+	require.Equal(t, 6, set.Rule("premium").Line)
+
+	require.Len(t, set.Tagged("kyc"), 2)
+	require.Len(t, set.Tagged("billing"), 2)
+	require.Nil(t, set.Rule("missing"))
+
+	env := Env{User: User{Name: "Anna", Age: 30, Premium: true}}
+	for id, want := range map[string]interface{}{
+		"adult":      true,
+		"name":       "Anna",
+		"premium":    true,
+		"score":      64,
+		"ratio":      0.3,
+		"trial-user": false,
+	} {
+		out, err := set.Rule(id).Run(env)
+		require.NoError(t, err, id)
+		require.Equal(t, want, out, id)
+	}
+}
+
+func TestLoad_errors(t *testing.T) {
+	set, err := Load([]string{"testdata/broken", "testdata/missing"}, expr.Env(Env{}))
+	require.Error(t, err)
+	require.Empty(t, set.Rules)
+
+	var errs Errors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 5)
+
+	file := filepath.Join("testdata", "broken", "rules.yaml")
+	require.Contains(t, errs[0].Error(), "testdata/missing: ")
+	require.Equal(t, "unknown", errs[1].ID)
+	require.Contains(t, errs[1].Error(), file+":1: rule unknown: type ruleset.User has no field Email")
+	require.Contains(t, errs[2].Error(), file+":3: rule type: expected bool, but got int")
+	require.Equal(t, file+":6: rule has no id", errs[3].Error())
+	require.Equal(t, file+":7: rule unknown: duplicate id of rule of "+file+":1", errs[4].Error())
+}
+
+func TestCompile(t *testing.T) {
+	_, err := Compile([]*Rule{{ID: "a", Expression: "1", Type: "decimal"}})
+	require.EqualError(t, err, "rule a: unknown type \"decimal\"")
+
+	set, err := Compile([]*Rule{{ID: "a", Expression: "1 + 2", Type: "int64"}})
+	require.NoError(t, err)
+	out, err := set.Rule("a").Run(nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), out)
+}
+
+func TestParse(t *testing.T) {
+	rules, err := Parse("rule.expr", []byte("1 + 2\n"))
+	require.NoError(t, err)
+	require.Equal(t, []*Rule{{ID: "rule", Expression: "1 + 2", File: "rule.expr", Line: 1}}, rules)
+
+	_, err = Parse("rule.expr", []byte("---\nid: a\n1 + 2\n"))
+	require.EqualError(t, err, "rule.expr:1: unterminated front matter")
+
+	_, err = Parse("rules.toml", []byte("[[rules]]\nid = \"a\"\ntags = [\"a\" \"b\"]\n"))
+	require.EqualError(t, err, "rules.toml:3: expected a comma (',') or array terminator (']'), but got '\"'")
+
+	_, err = Parse("rules.toml", []byte("[[rules]]\nid = 1\n"))
+	require.EqualError(t, err, `rules.toml: toml: line 2 (last key "rules.id"): incompatible types: TOML value has type int64; destination has type string`)
+
+	rules, err = Parse("rules.toml", []byte("# rules\n\n[[rules]]\nid = \"a\"\nx = 1\n\n  [[ rules ]] # b\nid = \"b\"\n"))
+	require.NoError(t, err)
+	require.Equal(t, []*Rule{{ID: "a", File: "rules.toml", Line: 3}, {ID: "b", File: "rules.toml", Line: 7}}, rules)
+
+	rules, err = Parse("rule.expr", []byte("+++\nid = \"a\"\ntags = [\"b\"]\n+++\n1 + 2\n"))
+	require.NoError(t, err)
+	require.Equal(t, []*Rule{{ID: "a", Tags: []string{"b"}, Expression: "1 + 2", File: "rule.expr", Line: 5}}, rules)
+
+	_, err = Parse("rules.yaml", []byte("rules: 1\n"))
+	require.EqualError(t, err, "rules.yaml:1: rules must be a list")
+}
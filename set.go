@@ -0,0 +1,255 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/vm"
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// Results is the variable of expressions of a set with results of other
+// expressions of the set, like results.discount.
+const Results = "results"
+
+// Set of named expressions compiled with the same options, like rules of
+// a rule engine evaluated for every event.
+type Set struct {
+	// Names of expressions in order of evaluation: sorted, except that
+	// expressions come after expressions, which results they use.
+	Names    []string
+	Programs map[string]*vm.Program
+	// Dependencies are names of expressions, which results are used by
+	// the expression, sorted.
+	Dependencies map[string][]string
+}
+
+// SetError holds errors of expressions of a set by their names.
+type SetError map[string]error
+
+func (e SetError) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ": " + e[name].Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CompileSet compiles named expressions with the same options, so the
+// environment, functions and definitions of Define are prepared once.
+// Expressions may use results of other expressions by their names, like
+// results.discount > 10, if the dependencies have no cycles. Errors of all
+// expressions are returned as SetError.
+func CompileSet(inputs map[string]string, ops ...Option) (*Set, error) {
+	config := newConfig(ops)
+	set := &Set{
+		Programs:     make(map[string]*vm.Program, len(inputs)),
+		Dependencies: make(map[string][]string, len(inputs)),
+	}
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := SetError{}
+	for _, name := range names {
+		deps, err := dependencies(inputs[name], config)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		for _, dep := range deps {
+			if _, ok := inputs[dep]; !ok {
+				errs[name] = fmt.Errorf("unknown expression %v in %v.%v", dep, Results, dep)
+			}
+		}
+		set.Dependencies[name] = deps
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	order, err := sortSet(names, set.Dependencies)
+	if err != nil {
+		return nil, err
+	}
+	set.Names = order
+
+	if set.usesResults() {
+		// Results are typed as values of any type, so the config of
+		// options is copied, to keep types of environment of options.
+		copied := *config
+		copied.Types = make(conf.TypesTable, len(config.Types)+1)
+		for name, tag := range config.Types {
+			copied.Types[name] = tag
+		}
+		copied.Types[Results] = conf.Tag{Type: reflect.TypeOf(map[string]interface{}{})}
+		config = &copied
+	}
+
+	for _, name := range set.Names {
+		program, err := compile(inputs[name], config)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		set.Programs[name] = program
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return set, nil
+}
+
+// Run evaluates all expressions of the set with the environment, and
+// returns results by names. Results of memoized functions and variables of
+// lazy environments are shared by expressions, so they are computed once,
+// like results of expressions used by other expressions. Results of failed
+// expressions, and of expressions using their results, are missing, and
+// their errors are returned as SetError.
+func (s *Set) Run(env interface{}) (map[string]interface{}, error) {
+	results := make(map[string]interface{}, len(s.Names))
+	if s.usesResults() {
+		env = runtime.Layers{map[string]interface{}{Results: results}, env}
+	}
+	machine := vm.Batch()
+	errs := SetError{}
+next:
+	for _, name := range s.Names {
+		for _, dep := range s.Dependencies[name] {
+			if _, ok := errs[dep]; ok {
+				errs[name] = fmt.Errorf("%v failed", dep)
+				continue next
+			}
+		}
+		out, err := machine.Run(s.Programs[name], env)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		results[name] = out
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+func (s *Set) usesResults() bool {
+	for _, deps := range s.Dependencies {
+		if len(deps) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencies returns sorted names of results used by the expression.
+// Results must be used by their names, like results.discount.
+func dependencies(input string, config *conf.Config) ([]string, error) {
+	tree, err := parser.ParseWithOptions(input, config.ParserOptions())
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Definitions) > 0 {
+		if err := define(tree, config); err != nil {
+			return nil, err
+		}
+	}
+	r := &resultsVisitor{names: make(map[string]bool)}
+	ast.Walk(&tree.Node, r)
+	if len(r.idents) > 0 {
+		err := file.Errorf(r.idents[0].Location(), "%v must be used with names of expressions, like %v.name", Results, Results)
+		return nil, err.Bind(tree.Source)
+	}
+	deps := make([]string, 0, len(r.names))
+	for name := range r.names {
+		deps = append(deps, name)
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// resultsVisitor collects names of results.name members, and identifiers
+// of results, which are used otherwise.
+type resultsVisitor struct {
+	names  map[string]bool
+	idents []*ast.IdentifierNode
+}
+
+func (r *resultsVisitor) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if n.Value == Results {
+			r.idents = append(r.idents, n)
+		}
+	case *ast.MemberNode:
+		ident, ok := n.Node.(*ast.IdentifierNode)
+		name, isName := n.Property.(*ast.StringNode)
+		if ok && isName && ident.Value == Results {
+			r.names[name.Value] = true
+			// Identifiers are visited before their members.
+			for i, id := range r.idents {
+				if id == ident {
+					r.idents = append(r.idents[:i], r.idents[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// sortSet returns names in topological order of dependencies, or an error
+// with a cycle of dependencies.
+func sortSet(names []string, deps map[string][]string) ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(names))
+	order := make([]string, 0, len(names))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					return fmt.Errorf("cycle of results: %v", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,238 @@
+// Package exprfuzz generates random expressions for fuzzing and differential
+// testing of the parser, the checker and the virtual machine.
+package exprfuzz
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Env returns environment of generated expressions.
+func Env() map[string]interface{} {
+	return map[string]interface{}{
+		"i":    7,
+		"j":    -3,
+		"f":    2.5,
+		"s":    "hello",
+		"t":    "World",
+		"b":    true,
+		"arr":  []int{1, 2, 3, 4, 5},
+		"strs": []string{"a", "bb", "ccc"},
+		"obj": map[string]interface{}{
+			"name": "obj",
+			"n":    10,
+		},
+	}
+}
+
+// Generator generates expressions from the grammar of expr. Valid
+// expressions type check with Env, but evaluation may still fail, for example
+// on out of range index.
+type Generator struct {
+	rand *rand.Rand
+	// MaxDepth limits nesting of generated expressions.
+	MaxDepth int
+	depth    int
+	closure  bool
+}
+
+// New creates generator with the seed, so generated expressions are
+// reproducible.
+func New(seed int64) *Generator {
+	return &Generator{
+		rand:     rand.New(rand.NewSource(seed)),
+		MaxDepth: 5,
+	}
+}
+
+type kind int
+
+const (
+	boolKind kind = iota
+	intKind
+	floatKind
+	stringKind
+	arrayKind
+)
+
+// Valid returns random valid expression.
+func (g *Generator) Valid() string {
+	g.depth = 0
+	g.closure = false
+	return g.expr(kind(g.rand.Intn(int(arrayKind) + 1)))
+}
+
+// Invalid returns random valid expression with a random mutation, like a
+// removed or an inserted token. Mutated expression is usually invalid.
+func (g *Generator) Invalid() string {
+	code := g.Valid()
+	switch g.rand.Intn(3) {
+	case 0:
+		if len(code) > 0 {
+			i := g.rand.Intn(len(code))
+			code = code[:i] + code[i+1:]
+		}
+	case 1:
+		i := g.rand.Intn(len(code) + 1)
+		code = code[:i] + g.pick(tokens) + code[i:]
+	default:
+		if len(code) > 1 {
+			i := g.rand.Intn(len(code) - 1)
+			code = code[:i] + code[i+1:i+2] + code[i:i+1] + code[i+2:]
+		}
+	}
+	return code
+}
+
+var tokens = []string{
+	"(", ")", "[", "]", "{", "}", ",", ".", "?", ":", "#", "!", "'", `"`,
+	"+", "-", "*", "/", "%", "**", "..", "==", "&&", "||", "not", "in",
+	"nil", "1e", "0x", "\\", "len", "map(", "i", "obj.",
+}
+
+func (g *Generator) pick(options []string) string {
+	return options[g.rand.Intn(len(options))]
+}
+
+func (g *Generator) expr(k kind) string {
+	g.depth++
+	defer func() { g.depth-- }()
+	if g.depth >= g.MaxDepth || g.rand.Intn(4) == 0 {
+		return g.leaf(k)
+	}
+	switch k {
+	case boolKind:
+		return g.boolExpr()
+	case intKind:
+		return g.intExpr()
+	case floatKind:
+		return g.floatExpr()
+	case stringKind:
+		return g.stringExpr()
+	default:
+		return g.arrayExpr()
+	}
+}
+
+func (g *Generator) leaf(k kind) string {
+	switch k {
+	case boolKind:
+		return g.pick([]string{"true", "false", "b"})
+	case intKind:
+		if g.closure && g.rand.Intn(2) == 0 {
+			return "#"
+		}
+		if g.rand.Intn(3) == 0 {
+			return g.pick([]string{"i", "j", "obj.n"})
+		}
+		return strconv.Itoa(g.rand.Intn(20))
+	case floatKind:
+		if g.rand.Intn(3) == 0 {
+			return "f"
+		}
+		return strconv.Itoa(g.rand.Intn(20)) + "." + strconv.Itoa(g.rand.Intn(10))
+	case stringKind:
+		return g.pick([]string{`"a"`, `'b'`, `""`, "s", "t", "obj.name", `"hello"`})
+	default:
+		return g.pick([]string{"arr", "[1, 2]", "[]", "1..3"})
+	}
+}
+
+func (g *Generator) boolExpr() string {
+	switch g.rand.Intn(9) {
+	case 0:
+		return g.expr(boolKind) + g.pick([]string{" and ", " or ", " && ", " || "}) + g.expr(boolKind)
+	case 1:
+		return g.pick([]string{"not ", "!"}) + g.paren(g.expr(boolKind))
+	case 2:
+		return g.paren(g.expr(intKind)) + g.pick([]string{" == ", " != ", " < ", " > ", " <= ", " >= "}) + g.paren(g.expr(intKind))
+	case 3:
+		return g.paren(g.expr(floatKind)) + g.pick([]string{" < ", " >= "}) + g.paren(g.expr(intKind))
+	case 4:
+		return g.paren(g.expr(stringKind)) + g.pick([]string{" == ", " contains ", " startsWith ", " endsWith ", " < "}) + g.paren(g.expr(stringKind))
+	case 5:
+		return g.paren(g.expr(intKind)) + g.pick([]string{" in ", " not in "}) + g.paren(g.expr(arrayKind))
+	case 6:
+		return g.pick([]string{"all", "any", "none", "one"}) + "(" + g.expr(arrayKind) + ", {" + g.closureBody(boolKind) + "})"
+	case 7:
+		return g.paren(g.expr(stringKind)) + ` matches "^[a-z]+$"`
+	default:
+		return g.paren(g.expr(boolKind)) + " ? " + g.expr(boolKind) + " : " + g.expr(boolKind)
+	}
+}
+
+func (g *Generator) intExpr() string {
+	switch g.rand.Intn(7) {
+	case 0:
+		return g.paren(g.expr(intKind)) + g.pick([]string{" + ", " - ", " * "}) + g.paren(g.expr(intKind))
+	case 1:
+		// Constant modulo by zero is a compilation error, which would fail
+		// only optimized programs.
+		return g.paren(g.expr(intKind)) + " % " + strconv.Itoa(1+g.rand.Intn(9))
+	case 2:
+		return "-" + g.paren(g.expr(intKind))
+	case 3:
+		return "len(" + g.pick([]string{g.expr(stringKind), g.expr(arrayKind)}) + ")"
+	case 4:
+		return "count(" + g.expr(arrayKind) + ", {" + g.closureBody(boolKind) + "})"
+	case 5:
+		return "arr[" + strconv.Itoa(g.rand.Intn(5)) + "]"
+	default:
+		return g.paren(g.expr(boolKind)) + " ? " + g.expr(intKind) + " : " + g.expr(intKind)
+	}
+}
+
+func (g *Generator) floatExpr() string {
+	switch g.rand.Intn(4) {
+	case 0:
+		return g.paren(g.expr(intKind)) + " / " + g.paren(g.expr(intKind))
+	case 1:
+		return g.paren(g.expr(floatKind)) + g.pick([]string{" + ", " - ", " * "}) + g.paren(g.expr(floatKind))
+	case 2:
+		return g.paren(g.expr(floatKind)) + " ** " + strconv.Itoa(g.rand.Intn(3))
+	default:
+		return g.paren(g.expr(intKind)) + " + " + g.paren(g.expr(floatKind))
+	}
+}
+
+func (g *Generator) stringExpr() string {
+	switch g.rand.Intn(4) {
+	case 0:
+		return g.paren(g.expr(stringKind)) + " + " + g.paren(g.expr(stringKind))
+	case 1:
+		return "strs[" + strconv.Itoa(g.rand.Intn(3)) + "]"
+	case 2:
+		return g.pick([]string{"strings.upper", "strings.lower", "strings.trim"}) + "(" + g.expr(stringKind) + ")"
+	default:
+		return g.paren(g.expr(boolKind)) + " ? " + g.expr(stringKind) + " : " + g.expr(stringKind)
+	}
+}
+
+func (g *Generator) arrayExpr() string {
+	switch g.rand.Intn(4) {
+	case 0:
+		return "filter(" + g.expr(arrayKind) + ", {" + g.closureBody(boolKind) + "})"
+	case 1:
+		return "map(" + g.expr(arrayKind) + ", {" + g.closureBody(intKind) + "})"
+	case 2:
+		return "[" + g.expr(intKind) + ", " + g.expr(intKind) + "]"
+	default:
+		return "arr[" + strconv.Itoa(g.rand.Intn(3)) + ":" + strconv.Itoa(2+g.rand.Intn(3)) + "]"
+	}
+}
+
+// closureBody generates body of a closure over array of integers.
+func (g *Generator) closureBody(k kind) string {
+	closure := g.closure
+	g.closure = true
+	defer func() { g.closure = closure }()
+	return g.expr(k)
+}
+
+func (g *Generator) paren(code string) string {
+	if strings.ContainsAny(code, " ") {
+		return "(" + code + ")"
+	}
+	return code
+}
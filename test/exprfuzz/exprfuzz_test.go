@@ -0,0 +1,59 @@
+package exprfuzz_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/test/exprfuzz"
+	"github.com/antonmedv/expr/test/interpreter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator_valid(t *testing.T) {
+	env := exprfuzz.Env()
+	g := exprfuzz.New(42)
+	for i := 0; i < 2000; i++ {
+		code := g.Valid()
+
+		program, err := expr.Compile(code, expr.Env(env))
+		require.NoError(t, err, code)
+		unoptimized, err := expr.Compile(code, expr.Env(env), expr.Optimize(false))
+		require.NoError(t, err, code)
+
+		want, wantErr := expr.Run(unoptimized, env)
+		got, gotErr := expr.Run(program, env)
+		require.Equal(t, wantErr != nil, gotErr != nil, "%v: %v, %v", code, wantErr, gotErr)
+		require.True(t, equal(want, got), "%v: %v != %v", code, want, got)
+
+		if gotErr == nil {
+			ref, err := interpreter.Eval(code, env)
+			require.NoError(t, err, code)
+			require.True(t, equal(ref, got), "%v: %v != %v", code, ref, got)
+		}
+	}
+}
+
+func TestGenerator_invalid(t *testing.T) {
+	env := exprfuzz.Env()
+	g := exprfuzz.New(42)
+	for i := 0; i < 2000; i++ {
+		code := g.Invalid()
+
+		program, err := expr.Compile(code, expr.Env(env))
+		if err == nil {
+			_, _ = expr.Run(program, env)
+		}
+	}
+}
+
+// equal compares results, treating NaN as equal to itself.
+func equal(a, b interface{}) bool {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok && math.IsNaN(x) && math.IsNaN(y) {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,56 @@
+//go:build go1.18
+// +build go1.18
+
+package exprfuzz_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/test/exprfuzz"
+	"github.com/antonmedv/expr/test/interpreter"
+)
+
+// FuzzRun checks that compilation and evaluation do not panic, that
+// optimized programs return the same results as unoptimized ones, and that
+// both agree with the reference interpreter.
+func FuzzRun(f *testing.F) {
+	g := exprfuzz.New(1)
+	for i := 0; i < 100; i++ {
+		f.Add(g.Valid())
+		f.Add(g.Invalid())
+	}
+	env := exprfuzz.Env()
+	f.Fuzz(func(t *testing.T, code string) {
+		program, err := expr.Compile(code, expr.Env(env))
+		if err != nil {
+			return
+		}
+		unoptimized, err := expr.Compile(code, expr.Env(env), expr.Optimize(false))
+		if err != nil {
+			t.Fatalf("%v: optimized program compiles, but unoptimized does not: %v", code, err)
+		}
+
+		want, wantErr := expr.Run(unoptimized, env)
+		got, gotErr := expr.Run(program, env)
+		if (wantErr != nil) != (gotErr != nil) {
+			t.Fatalf("%v: errors differ: %v, %v", code, wantErr, gotErr)
+		}
+		if !equal(want, got) {
+			t.Fatalf("%v: results differ: %v, %v", code, want, got)
+		}
+		if gotErr != nil {
+			return
+		}
+
+		// Programs which fail, for example by exceeding the memory budget,
+		// are not compared with the interpreter.
+		ref, err := interpreter.Eval(code, env)
+		if err != nil {
+			t.Fatalf("%v: program runs, but interpreter fails: %v", code, err)
+		}
+		if !equal(ref, got) {
+			t.Fatalf("%v: results differ from interpreter: %v, %v", code, ref, got)
+		}
+	})
+}
@@ -0,0 +1,524 @@
+// Package interpreter is a slow reference implementation of evaluation,
+// which walks the tree instead of running compiled bytecode. It is used to
+// test the compiler, the optimizer and the virtual machine against it.
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/checker"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/parser"
+	"github.com/antonmedv/expr/vm"
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// Eval parses and checks code with the environment, and evaluates it.
+func Eval(code string, env interface{}) (interface{}, error) {
+	config := conf.New(env)
+	tree, err := parser.ParseWithOptions(code, config.ParserOptions())
+	if err != nil {
+		return nil, err
+	}
+	_, err = checker.Check(tree, config)
+	if err != nil {
+		return nil, err
+	}
+	return EvalNode(tree.Node, env)
+}
+
+// EvalNode evaluates checked tree. The tree must not be optimized, as the
+// interpreter is the reference for optimizations.
+func EvalNode(node ast.Node, env interface{}) (out interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	i := &interpreter{env: env}
+	return i.eval(node), nil
+}
+
+type interpreter struct {
+	env       interface{}
+	elements  []*element               // values of # of closures
+	variables []map[string]interface{} // variables of folds
+	memory    int
+}
+
+// element of the closure of a builtin, with its index, and the
+// accumulator of reduce.
+type element struct {
+	value interface{}
+	index int
+	acc   interface{}
+}
+
+// chainNil stops evaluation of a chain of optional members, like a?.b.c,
+// if a is nil.
+type chainNil struct{}
+
+// callError is an error of a call with context, caught by fallback.
+type callError struct {
+	err error
+}
+
+func (i *interpreter) eval(node ast.Node) interface{} {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return nil
+
+	case *ast.IdentifierNode:
+		if n.Method {
+			return runtime.FetchMethod(i.env, &runtime.Method{Name: n.Value, Index: -1})
+		}
+		return deref(n.Deref || n.Type() == nil, runtime.Fetch(i.env, n.Value))
+
+	case *ast.IntegerNode:
+		if t := n.Type(); t != nil && t.Kind() != reflect.Int && isNumber(t) {
+			return reflect.ValueOf(n.Value).Convert(t).Interface()
+		}
+		return n.Value
+
+	case *ast.FloatNode:
+		return n.Value
+
+	case *ast.BoolNode:
+		return n.Value
+
+	case *ast.StringNode:
+		return n.Value
+
+	case *ast.ConstantNode:
+		return n.Value
+
+	case *ast.UnaryNode:
+		v := i.eval(n.Node)
+		switch n.Operator {
+		case "!", "not":
+			return !v.(bool)
+		case "-":
+			return runtime.Negate(v)
+		}
+		return v
+
+	case *ast.BinaryNode:
+		return i.binary(n)
+
+	case *ast.ChainNode:
+		return i.chain(n)
+
+	case *ast.MemberNode:
+		base := i.eval(n.Node)
+		if n.Optional && runtime.IsNil(base) {
+			panic(chainNil{})
+		}
+		if n.Method {
+			return runtime.FetchMethod(base, &runtime.Method{Name: n.Name, Index: -1})
+		}
+		return deref(n.Deref || n.Type() == nil, runtime.Fetch(base, i.eval(n.Property)))
+
+	case *ast.SliceNode:
+		array := i.eval(n.Node)
+		var from, to interface{} = 0, runtime.Length(array)
+		if n.From != nil {
+			from = i.eval(n.From)
+		}
+		if n.To != nil {
+			to = i.eval(n.To)
+		}
+		return runtime.Slice(array, from, to)
+
+	case *ast.CallNode:
+		return i.call(n)
+
+	case *ast.BuiltinNode:
+		return i.builtin(n)
+
+	case *ast.ClosureNode:
+		return i.eval(n.Node)
+
+	case *ast.PointerNode:
+		e := i.elements[len(i.elements)-1]
+		switch n.Name {
+		case "index":
+			return e.index
+		case "acc":
+			return e.acc
+		}
+		return e.value
+
+	case *ast.ConditionalNode:
+		if i.eval(n.Cond).(bool) {
+			return i.eval(n.Exp1)
+		}
+		return i.eval(n.Exp2)
+
+	case *ast.ArrayNode:
+		array := make([]interface{}, len(n.Nodes))
+		for j, node := range n.Nodes {
+			array[j] = i.eval(node)
+		}
+		i.allocate(len(array))
+		return array
+
+	case *ast.MapNode:
+		m := make(map[string]interface{})
+		for _, node := range n.Pairs {
+			pair := node.(*ast.PairNode)
+			key := i.eval(pair.Key)
+			m[key.(string)] = i.eval(pair.Value)
+		}
+		i.allocate(len(n.Pairs))
+		return m
+
+	case *ast.VariableNode:
+		for j := len(i.variables) - 1; j >= 0; j-- {
+			if value, ok := i.variables[j][n.Name]; ok {
+				return value
+			}
+		}
+		panic(fmt.Sprintf("unknown variable %v", n.Name))
+
+	case *ast.BlockNode:
+		variables := i.variables[len(i.variables)-1]
+		for _, node := range n.Nodes {
+			assign := node.(*ast.AssignNode)
+			variables[assign.Name] = i.eval(assign.Value)
+		}
+		return nil
+
+	case *ast.TupleNode:
+		tuple := make(runtime.Tuple, len(n.Nodes))
+		for j, element := range n.Nodes {
+			tuple[j] = i.eval(element)
+		}
+		return tuple
+
+	case *ast.BindNode:
+		value := i.eval(n.Value)
+		variables := make(map[string]interface{}, len(n.Names))
+		if n.Tuple {
+			for j, element := range runtime.Unpack(value, len(n.Names)) {
+				variables[n.Names[j]] = element
+			}
+		} else {
+			variables[n.Names[0]] = value
+		}
+		i.variables = append(i.variables, variables)
+		defer func() {
+			i.variables = i.variables[:len(i.variables)-1]
+		}()
+		return i.eval(n.Body)
+
+	case *ast.ComprehensionNode:
+		return i.comprehension(n)
+
+	case *ast.SharedNode:
+		return i.eval(n.Node)
+	}
+	panic(fmt.Sprintf("undefined node type (%T)", node))
+}
+
+func (i *interpreter) binary(n *ast.BinaryNode) interface{} {
+	switch n.Operator {
+	case "and", "&&":
+		return i.eval(n.Left).(bool) && i.eval(n.Right).(bool)
+	case "or", "||":
+		return i.eval(n.Left).(bool) || i.eval(n.Right).(bool)
+	case "??":
+		if a := i.eval(n.Left); !runtime.IsNil(a) {
+			return a
+		}
+		return i.eval(n.Right)
+	}
+
+	a := i.eval(n.Left)
+	b := i.eval(n.Right)
+	switch n.Operator {
+	case "==":
+		return runtime.Equal(a, b)
+	case "!=":
+		return !runtime.Equal(a, b)
+	case "<":
+		return runtime.Less(a, b)
+	case ">":
+		return runtime.More(a, b)
+	case "<=":
+		return runtime.LessOrEqual(a, b)
+	case ">=":
+		return runtime.MoreOrEqual(a, b)
+	case "+":
+		return runtime.Add(a, b)
+	case "-":
+		return runtime.Subtract(a, b)
+	case "*":
+		return runtime.Multiply(a, b)
+	case "/":
+		return runtime.Divide(a, b)
+	case "%":
+		return runtime.Modulo(a, b)
+	case "**", "^":
+		return runtime.Exponent(a, b)
+	case "in":
+		return runtime.In(a, b)
+	case "matches":
+		match, err := regexp.MatchString(b.(string), a.(string))
+		if err != nil {
+			panic(err)
+		}
+		return match
+	case "like":
+		return runtime.Like(a.(string), b.(string))
+	case "contains":
+		return strings.Contains(a.(string), b.(string))
+	case "startsWith":
+		return strings.HasPrefix(a.(string), b.(string))
+	case "endsWith":
+		return strings.HasSuffix(a.(string), b.(string))
+	case "..":
+		min, max := runtime.ToInt(a), runtime.ToInt(b)
+		i.allocate(max - min + 1)
+		return runtime.MakeRange(min, max)
+	}
+	panic(fmt.Sprintf("unknown operator (%v)", n.Operator))
+}
+
+func (i *interpreter) chain(n *ast.ChainNode) (out interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(chainNil); !ok {
+				panic(r)
+			}
+			out = nil
+		}
+	}()
+	return i.eval(n.Node)
+}
+
+func (i *interpreter) call(n *ast.CallNode) interface{} {
+	args := make([]interface{}, len(n.Arguments))
+	for j, arg := range n.Arguments {
+		args[j] = i.eval(arg)
+	}
+	if n.Func != nil {
+		out, err := n.Func.Func(args...)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	}
+
+	fn := reflect.ValueOf(i.eval(n.Callee))
+	var in []reflect.Value
+	if n.Context {
+		ctx := context.Background()
+		in = append(in, reflect.ValueOf(&ctx).Elem())
+	}
+	for j, arg := range args {
+		if arg == nil {
+			// Nil of unknown type is passed as a nil interface.
+			in = append(in, reflect.ValueOf(&args[j]).Elem())
+		} else {
+			in = append(in, reflect.ValueOf(arg))
+		}
+	}
+	out, err := runtime.Results(fn.Type(), fn.Call(in))
+	if err != nil {
+		if n.Context {
+			panic(callError{err})
+		}
+		panic(err)
+	}
+	return out
+}
+
+func (i *interpreter) builtin(n *ast.BuiltinNode) interface{} {
+	switch n.Name {
+	case "len":
+		return runtime.Length(i.eval(n.Arguments[0]))
+
+	case "try":
+		return i.try(n.Arguments[0], n.Arguments[1])
+
+	case "fallback":
+		return i.fallback(n.Arguments[0], n.Arguments[1])
+
+	case "fold":
+		return i.fold(n)
+
+	case "reduce":
+		return i.reduce(n)
+	}
+
+	array := reflect.ValueOf(i.eval(n.Arguments[0]))
+	var selected []interface{}
+	for j := 0; j < array.Len(); j++ {
+		value := array.Index(j).Interface()
+		i.elements = append(i.elements, &element{value: value, index: j})
+		result := i.eval(n.Arguments[1])
+		i.elements = i.elements[:len(i.elements)-1]
+
+		switch n.Name {
+		case "map":
+			selected = append(selected, result)
+			continue
+		case "all":
+			if !result.(bool) {
+				return false
+			}
+		case "none":
+			if result.(bool) {
+				return false
+			}
+		case "any":
+			if result.(bool) {
+				return true
+			}
+		}
+		if result.(bool) {
+			selected = append(selected, value)
+		}
+	}
+
+	switch n.Name {
+	case "all", "none":
+		return true
+	case "any":
+		return false
+	case "one":
+		return len(selected) == 1
+	case "count":
+		return len(selected)
+	case "filter", "map":
+		if selected == nil {
+			selected = []interface{}{}
+		}
+		i.allocate(len(selected))
+		return selected
+	}
+	panic(fmt.Sprintf("unknown builtin %v", n.Name))
+}
+
+func (i *interpreter) fold(n *ast.BuiltinNode) interface{} {
+	last := len(n.Arguments) - 1
+	variables := make(map[string]interface{})
+	for _, arg := range n.Arguments[1:last] {
+		let := arg.(*ast.LetNode)
+		variables[let.Name] = i.eval(let.Value)
+	}
+	array := reflect.ValueOf(i.eval(n.Arguments[0]))
+	i.variables = append(i.variables, variables)
+	for j := 0; j < array.Len(); j++ {
+		i.elements = append(i.elements, &element{value: array.Index(j).Interface(), index: j})
+		i.eval(n.Arguments[last])
+		i.elements = i.elements[:len(i.elements)-1]
+	}
+	i.variables = i.variables[:len(i.variables)-1]
+	return variables[n.Arguments[1].(*ast.LetNode).Name]
+}
+
+func (i *interpreter) reduce(n *ast.BuiltinNode) interface{} {
+	array := reflect.ValueOf(i.eval(n.Arguments[0]))
+	var acc interface{}
+	start := 0
+	if len(n.Arguments) == 3 {
+		acc = i.eval(n.Arguments[2])
+	} else if array.Len() > 0 {
+		acc = array.Index(0).Interface()
+		start = 1
+	}
+	for j := start; j < array.Len(); j++ {
+		i.elements = append(i.elements, &element{value: array.Index(j).Interface(), index: j, acc: acc})
+		acc = i.eval(n.Arguments[1])
+		i.elements = i.elements[:len(i.elements)-1]
+	}
+	return acc
+}
+
+func (i *interpreter) comprehension(n *ast.ComprehensionNode) interface{} {
+	array := reflect.ValueOf(i.eval(n.Items))
+	pair, isMap := n.Node.(*ast.PairNode)
+	m := make(map[string]interface{})
+	selected := make([]interface{}, 0)
+	for j := 0; j < array.Len(); j++ {
+		i.variables = append(i.variables, map[string]interface{}{n.Name: array.Index(j).Interface()})
+		if n.Cond == nil || i.eval(n.Cond).(bool) {
+			if isMap {
+				key := i.eval(pair.Key)
+				m[key.(string)] = i.eval(pair.Value)
+			} else {
+				selected = append(selected, i.eval(n.Node))
+			}
+		}
+		i.variables = i.variables[:len(i.variables)-1]
+	}
+	if isMap {
+		i.allocate(len(m))
+		return m
+	}
+	i.allocate(len(selected))
+	return selected
+}
+
+func (i *interpreter) try(node, fallback ast.Node) (out interface{}) {
+	elements := len(i.elements)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(chainNil); ok {
+				panic(r)
+			}
+			i.elements = i.elements[:elements]
+			out = i.eval(fallback)
+		}
+	}()
+	return i.eval(node)
+}
+
+func (i *interpreter) fallback(node, value ast.Node) (out interface{}) {
+	elements := len(i.elements)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(callError); !ok {
+				panic(r)
+			}
+			i.elements = i.elements[:elements]
+			out = i.eval(value)
+		}
+	}()
+	return i.eval(node)
+}
+
+// allocate limits memory the same way as the virtual machine does.
+func (i *interpreter) allocate(size int) {
+	i.memory += size
+	if i.memory >= vm.MemoryBudget {
+		panic("memory budget exceeded")
+	}
+}
+
+func deref(ok bool, v interface{}) interface{} {
+	if ok {
+		return runtime.Deref(v)
+	}
+	return v
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package interpreter_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/test/interpreter"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Name    string
+	Age     int
+	Friends []*user
+}
+
+func (u *user) Greet(name string) string {
+	return "hello " + name + ", I am " + u.Name
+}
+
+func (u *user) Fail() (int, error) {
+	return 0, errors.New("fail")
+}
+
+func TestEval(t *testing.T) {
+	env := map[string]interface{}{
+		"user": &user{
+			Name:    "bob",
+			Age:     30,
+			Friends: []*user{{Name: "alice", Age: 25}, {Name: "carol", Age: 35}},
+		},
+		"nothing": nil,
+		"numbers": []int{1, 2, 3, 4, 5},
+		"add":     func(a, b int) int { return a + b },
+		"m":       map[string]interface{}{"a": 1, "b": "two"},
+	}
+	tests := []string{
+		`1 + 2 * 3`,
+		`2 ** 10 / 4`,
+		`7 % 3 - -1`,
+		`"a" + "b" == "ab"`,
+		`not (1 < 2) || 3 >= 3 && true`,
+		`user.Name + " is " + (user.Age > 18 ? "adult" : "child")`,
+		`user.Greet("alice")`,
+		`add(1, 2) + len(numbers)`,
+		`user.Friends[0].Name`,
+		`numbers[1:3]`,
+		`numbers[:2]`,
+		`map(filter(numbers, {# % 2 == 1}), {# * 10})`,
+		`all(numbers, {# > 0}) and none(numbers, {# > 5})`,
+		`any(user.Friends, {.Age > 30})`,
+		`one(numbers, {# == 3})`,
+		`count(1..10, {# > 5})`,
+		`map(1..3, {map(1..#, {# * 2})})`,
+		`3 in numbers && "a" in m && !("c" in m)`,
+		`{a: 1, b: [1, "2"]}`,
+		`m.b`,
+		`nothing?.foo`,
+		`nothing?.foo.bar`,
+		`"abc" matches "^a" and "abc" contains "b" and "abc" startsWith "a" and "abc" endsWith "c"`,
+		`try(user.Fail(), 42)`,
+		`try(numbers[10], -1)`,
+		`strings.upper(user.Name)`,
+		`math.max(1, 5, 3)`,
+		`fold(numbers, let total = 0, let peak = 0, {total = total + #; peak = total > peak ? total : peak})`,
+		`fold(1..3, let s = "", {s = s + convert.string(fold(1..#, let n = 0, {n = n + #}))})`,
+		`let (a, b) = (numbers[0], "x"); b + convert.string(a)`,
+		`let x = len(numbers); x * x`,
+		`(1, "a")`,
+		`reduce(numbers, {#acc + # * #index})`,
+		`reduce(numbers, {#acc + convert.string(#)}, "")`,
+		`all(numbers, {#index >= 2 || # > 0})`,
+		`[x * 2 for x in numbers if x > 1]`,
+		`{(convert.string(x)): [y for y in 1..x] for x in numbers}`,
+	}
+	for _, code := range tests {
+		t.Run(code, func(t *testing.T) {
+			want, err := expr.Eval(code, env)
+			require.NoError(t, err)
+
+			got, err := interpreter.Eval(code, env)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestEval_error(t *testing.T) {
+	env := map[string]interface{}{
+		"numbers": []int{1, 2, 3},
+		"zero":    0,
+	}
+	tests := []string{
+		`numbers[5]`,
+		`1 % zero`,
+		`unknown + 1`,
+		`1 +`,
+	}
+	for _, code := range tests {
+		t.Run(code, func(t *testing.T) {
+			_, err := interpreter.Eval(code, env)
+			require.Error(t, err)
+		})
+	}
+}
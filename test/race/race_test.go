@@ -0,0 +1,158 @@
+// Package race_test runs shared programs by many goroutines, to find data
+// races of programs with the race detector:
+//
+//	go test -race ./test/race
+package race_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/audit"
+	"github.com/antonmedv/expr/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type User struct {
+	Name  string
+	Age   int
+	Tags  []string
+	Token string
+}
+
+type Env struct {
+	User   User
+	Users  []User
+	Scores map[string]float64
+	Double func(int) int
+}
+
+func env(i int) Env {
+	return Env{
+		User:   User{Name: fmt.Sprintf("user%v", i), Age: i, Tags: []string{"a", "b"}, Token: "secret"},
+		Users:  []User{{Name: "Alice", Age: 30}, {Name: "Bob", Age: 20}},
+		Scores: map[string]float64{"a": float64(i)},
+		Double: func(x int) int { return x * 2 },
+	}
+}
+
+const goroutines = 16
+
+// run runs the program by many goroutines with different environments, and
+// checks results by want.
+func run(t *testing.T, program *vm.Program, want func(i int) interface{}) {
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			v := vm.VM{}
+			for i := 0; i < 50; i++ {
+				n := g*100 + i
+				out, err := v.Run(program, env(n))
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, want(n), out)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		code string
+		ops  []expr.Option
+		want func(i int) interface{}
+	}{
+		{
+			code: `User.Age + len(User.Tags)`,
+			want: func(i int) interface{} { return i + 2 },
+		},
+		{
+			code: `map(filter(Users, {.Age > 25}), {.Name})[0] + User.Name`,
+			want: func(i int) interface{} { return fmt.Sprintf("Aliceuser%v", i) },
+		},
+		{
+			code: `let x = Double(User.Age); x + Double(User.Age)`,
+			ops:  []expr.Option{expr.Memoize("Double")},
+			want: func(i int) interface{} { return i * 4 },
+		},
+		{
+			code: `try(Scores["b"] / 0, -1.0)`,
+			ops:  []expr.Option{expr.ZeroDivisionError()},
+			want: func(i int) interface{} { return -1.0 },
+		},
+		{
+			code: `User.Age % 3`,
+			ops:  []expr.Option{expr.WithCache(10)},
+			want: func(i int) interface{} { return i % 3 },
+		},
+		{
+			code: `fold(Users, let sum = 0, {sum = sum + #.Age})`,
+			want: func(i int) interface{} { return 50 },
+		},
+		{
+			code: `User.Token + User.Name`,
+			ops: []expr.Option{
+				expr.Sensitive("User.Token"),
+				expr.Audit("token", audit.Func(func(*audit.Record) {})),
+				expr.AuditPolicy("User.Token", audit.Hash),
+			},
+			want: func(i int) interface{} { return fmt.Sprintf("secretuser%v", i) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, append([]expr.Option{expr.Env(Env{})}, tt.ops...)...)
+			require.NoError(t, err)
+			run(t, program, tt.want)
+		})
+	}
+}
+
+func TestProgram_inspect(t *testing.T) {
+	program, err := expr.Compile(`User.Age > 18 && Double(User.Age) > 40`, expr.Env(Env{}))
+	require.NoError(t, err)
+	disassembly := program.Disassemble()
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, []string{"User.Age"}, program.References().Fields)
+			assert.Equal(t, disassembly, program.Disassemble())
+			_, err := expr.Run(program, env(30))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestProgram_Clone(t *testing.T) {
+	var records []*audit.Record
+	program, err := expr.Compile(`User.Name`, expr.Env(Env{}), expr.WithCache(10),
+		expr.Audit("name", audit.Func(func(r *audit.Record) { records = append(records, r) })))
+	require.NoError(t, err)
+
+	clone := program.Clone()
+	clone.Audit.ID = "clone"
+	clone.Audit.Policies["User"] = audit.Omit
+	assert.Equal(t, "name", program.Audit.ID)
+	assert.Empty(t, program.Audit.Policies)
+	assert.False(t, program.Cache == clone.Cache)
+	assert.Equal(t, program.Disassemble(), clone.Disassemble())
+	assert.Equal(t, program.References(), clone.References())
+
+	out, err := expr.Run(clone, env(1))
+	require.NoError(t, err)
+	assert.Equal(t, "user1", out)
+	require.Len(t, records, 1)
+	assert.Equal(t, "clone", records[0].ID)
+	assert.Empty(t, records[0].Inputs)
+}
@@ -0,0 +1,45 @@
+// Package tracing starts spans of runs of programs, and of calls of functions
+// with context, so evaluations are visible in distributed traces. Tracers of
+// OpenTelemetry are implemented by the module github.com/antonmedv/expr/exprotel:
+//
+//	tracer := exprotel.NewTracer(otel.Tracer("rules"))
+//	program, err := expr.Compile(`user.Age >= 18`, expr.Env(env),
+//		expr.Trace("adult", tracer, "user.ID"))
+//	output, err := expr.RunContext(ctx, program, env)
+package tracing
+
+import (
+	"context"
+)
+
+// Tracer starts spans. Programs may be run by many goroutines, so tracers
+// must be safe for concurrent use.
+type Tracer interface {
+	// StartRun starts the span of a run of the program of the expression
+	// with the ID and the hash of its source. The returned context is passed
+	// to functions with context, and to StartCall.
+	StartRun(ctx context.Context, id, hash string) (context.Context, Span)
+	// StartCall starts the child span of a call of the function of the path,
+	// like "db.Lookup".
+	StartCall(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span of a run or a call.
+type Span interface {
+	// End ends the span with the result and the error, if any. Spans of runs
+	// get values of attributes by their paths, like "user.ID", where values
+	// of missing fields are omitted.
+	End(result interface{}, err error, attributes map[string]interface{})
+}
+
+// Config of tracing of a program.
+type Config struct {
+	ID string
+	// Hash is hex encoded SHA-256 of the source of the expression, set by
+	// the compiler.
+	Hash   string
+	Tracer Tracer
+	// Attributes are paths of fields of the environment, which values are
+	// attributes of spans of runs.
+	Attributes []string
+}
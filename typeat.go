@@ -0,0 +1,137 @@
+package expr
+
+import (
+	"reflect"
+
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/parser"
+)
+
+// TypeInfo describes the node at a position of source.
+type TypeInfo struct {
+	Node ast.Node
+	// Type inferred by the checker, or nil if it is unknown. Methods have
+	// types without receivers.
+	Type reflect.Type
+	// Doc of builtin, operator or function, or doc tag of field of struct.
+	Doc string
+	// From and To are byte offsets of the token of the node in source.
+	From, To int
+}
+
+// TypeAt returns the innermost node, which token contains offset in bytes of
+// source of the tree, or nil if there is none. The tree must be checked with
+// the same options, which are used to find documentation of the environment.
+func TypeAt(tree *parser.Tree, offset int, ops ...Option) *TypeInfo {
+	config := conf.CreateNew()
+	for _, op := range ops {
+		op(config)
+	}
+
+	source := tree.Source.Content()
+	lines := []int{0} // byte offsets of lines
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+
+	var nodes []ast.Node
+	properties := make(map[ast.Node]bool)
+	ast.Walk(&tree.Node, visitor(func(node ast.Node) {
+		nodes = append(nodes, node)
+		if m, ok := node.(*ast.MemberNode); ok {
+			properties[m.Property] = true
+		}
+	}))
+	for _, node := range nodes {
+		loc := node.Location()
+		if properties[node] || loc.Line < 1 || loc.Line > len(lines) {
+			continue
+		}
+		start := lines[loc.Line-1]
+		end := len(source)
+		if loc.Line < len(lines) {
+			end = lines[loc.Line] - 1
+		}
+		line := []rune(source[start:end])
+		from, to := file.Span(string(line), loc.Column)
+		if to > len(line) {
+			to = len(line)
+		}
+		from = start + len(string(line[:from]))
+		to = start + len(string(line[:to]))
+		if from <= offset && offset < to {
+			info := &TypeInfo{Node: node, Type: node.Type(), From: from, To: to}
+			describe(info, config)
+			return info
+		}
+	}
+	return nil
+}
+
+type visitor func(node ast.Node)
+
+func (v visitor) Visit(node *ast.Node) {
+	v(*node)
+}
+
+func describe(info *TypeInfo, config *conf.Config) {
+	switch n := info.Node.(type) {
+	case *ast.BuiltinNode:
+		info.Doc = builtin.Docs[n.Name]
+	case *ast.BinaryNode:
+		info.Doc = builtin.Docs[n.Operator]
+	case *ast.UnaryNode:
+		info.Doc = builtin.Docs[n.Operator]
+	case *ast.BoolNode, *ast.NilNode:
+		info.Doc = builtin.Docs[parser.Format(n)]
+	case *ast.IdentifierNode:
+		if tag, ok := config.Types[n.Value]; ok {
+			if tag.Method && info.Type != nil {
+				info.Type = conf.MethodType(info.Type)
+			}
+			info.Doc = fieldDoc(reflect.TypeOf(config.Env), tag)
+		} else if f, ok := config.Functions[n.Value]; ok {
+			describeFunction(info, f)
+		}
+	case *ast.MemberNode:
+		name, ok := n.Property.(*ast.StringNode)
+		if !ok {
+			return
+		}
+		if id, ok := n.Node.(*ast.IdentifierNode); ok {
+			if _, env := config.Types[id.Value]; !env {
+				if f, ok := config.Functions[id.Value+"."+name.Value]; ok {
+					describeFunction(info, f)
+					return
+				}
+			}
+		}
+		if base := n.Node.Type(); n.Method && info.Type != nil && base != nil && base.Kind() != reflect.Interface {
+			info.Type = conf.MethodType(info.Type)
+		}
+		info.Doc = fieldDoc(n.Node.Type(), conf.FieldsFromStruct(n.Node.Type())[name.Value])
+	}
+}
+
+func describeFunction(info *TypeInfo, f *builtin.Function) {
+	info.Doc = f.Doc
+	if len(f.Types) > 0 {
+		info.Type = f.Types[0]
+	}
+}
+
+// fieldDoc returns doc tag of field of struct.
+func fieldDoc(t reflect.Type, tag conf.Tag) string {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || tag.Method || len(tag.FieldIndex) == 0 {
+		return ""
+	}
+	return t.FieldByIndex(tag.FieldIndex).Tag.Get("doc")
+}
@@ -0,0 +1,285 @@
+// Package types provides optional value types with operator support, which
+// are enabled by options, like money amounts:
+//
+//	program, err := expr.Compile(`price * 3 - discount > money("100", "USD")`,
+//		expr.Env(env), types.MoneySupport())
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places of amounts of money. Amounts are
+// stored as integers of 1/10000 of currency units, so arithmetic is exact.
+const Scale = 4
+
+const unit = 10000
+
+// Money is an amount of money in a currency, like 12.50 USD. Operations on
+// amounts in different currencies are errors.
+type Money struct {
+	// Units are 1/10000 of the currency unit.
+	Units    int64
+	Currency string
+}
+
+// ParseMoney returns the amount, like "12.50", in the currency, like "USD".
+func ParseMoney(amount, currency string) (Money, error) {
+	if err := checkCurrency(currency); err != nil {
+		return Money{}, err
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount of money: %q", amount)
+	}
+	r.Mul(r, big.NewRat(unit, 1))
+	if !r.IsInt() {
+		return Money{}, fmt.Errorf("amount of money %q has more than %v decimal places", amount, Scale)
+	}
+	if !r.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount of money %q is out of range", amount)
+	}
+	return Money{Units: r.Num().Int64(), Currency: currency}, nil
+}
+
+// NewMoney returns the amount of the number, an integer or a float, in the
+// currency. Floats are converted by their shortest decimal representation,
+// so 0.1 is exactly 0.1.
+func NewMoney(amount interface{}, currency string) (Money, error) {
+	switch x := amount.(type) {
+	case string:
+		return ParseMoney(x, currency)
+	case int:
+		return ParseMoney(strconv.Itoa(x), currency)
+	case int64:
+		return ParseMoney(strconv.FormatInt(x, 10), currency)
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return Money{}, fmt.Errorf("invalid amount of money: %v", x)
+		}
+		return ParseMoney(strconv.FormatFloat(x, 'f', -1, 64), currency)
+	}
+	return Money{}, fmt.Errorf("invalid amount of money (type %T)", amount)
+}
+
+func checkCurrency(currency string) error {
+	if len(currency) != 3 {
+		return fmt.Errorf("invalid currency: %q", currency)
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return fmt.Errorf("invalid currency: %q", currency)
+		}
+	}
+	return nil
+}
+
+// Digits returns the number of decimal places of minor units of the
+// currency by ISO 4217, like 2 for cents of USD.
+func Digits(currency string) int {
+	switch currency {
+	case "BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG",
+		"RWF", "UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0
+	case "BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND":
+		return 3
+	}
+	return 2
+}
+
+func (m Money) check(op string, other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("currency mismatch: %v %v %v", m.Currency, op, other.Currency)
+	}
+	return nil
+}
+
+// Add returns the sum of amounts in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.check("+", other); err != nil {
+		return Money{}, err
+	}
+	sum := m.Units + other.Units
+	if (sum > m.Units) != (other.Units > 0) {
+		return Money{}, errOverflow
+	}
+	return Money{Units: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns the difference of amounts in the same currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.check("-", other); err != nil {
+		return Money{}, err
+	}
+	diff := m.Units - other.Units
+	if (diff < m.Units) != (other.Units > 0) {
+		return Money{}, errOverflow
+	}
+	return Money{Units: diff, Currency: m.Currency}, nil
+}
+
+// Mul returns the amount multiplied by the integer or the float, which is
+// converted by its shortest decimal representation. Results are rounded
+// half to even to 1/10000 of the currency unit.
+func (m Money) Mul(factor interface{}) (Money, error) {
+	f, err := rat(factor)
+	if err != nil {
+		return Money{}, err
+	}
+	return m.round(new(big.Rat).Mul(new(big.Rat).SetInt64(m.Units), f))
+}
+
+// Div returns the amount divided by the integer or the float, rounded half
+// to even to 1/10000 of the currency unit.
+func (m Money) Div(divisor interface{}) (Money, error) {
+	d, err := rat(divisor)
+	if err != nil {
+		return Money{}, err
+	}
+	if d.Sign() == 0 {
+		return Money{}, fmt.Errorf("division of money by zero")
+	}
+	return m.round(new(big.Rat).Quo(new(big.Rat).SetInt64(m.Units), d))
+}
+
+// Ratio returns the ratio of amounts in the same currency.
+func (m Money) Ratio(other Money) (float64, error) {
+	if err := m.check("/", other); err != nil {
+		return 0, err
+	}
+	if other.Units == 0 {
+		return 0, fmt.Errorf("division of money by zero")
+	}
+	f, _ := big.NewRat(m.Units, other.Units).Float64()
+	return f, nil
+}
+
+// Cmp compares amounts in the same currency, and returns -1, 0 or +1.
+func (m Money) Cmp(other Money) (int, error) {
+	return m.cmp("<=>", other)
+}
+
+func (m Money) cmp(op string, other Money) (int, error) {
+	if err := m.check(op, other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Units < other.Units:
+		return -1, nil
+	case m.Units > other.Units:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Round returns the amount rounded half to even to the number of decimal
+// places, from 0 to Scale.
+func (m Money) Round(digits int) (Money, error) {
+	if digits < 0 || digits > Scale {
+		return Money{}, fmt.Errorf("invalid number of decimal places: %v", digits)
+	}
+	step := int64(math.Pow10(Scale - digits))
+	r, err := m.round(big.NewRat(m.Units, step))
+	if err != nil {
+		return Money{}, err
+	}
+	if r.Units > math.MaxInt64/step || r.Units < math.MinInt64/step {
+		return Money{}, errOverflow
+	}
+	return Money{Units: r.Units * step, Currency: m.Currency}, nil
+}
+
+// round returns money of units r rounded half to even.
+func (m Money) round(r *big.Rat) (Money, error) {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// Remainder has the sign of the numerator, so twice its magnitude is
+	// compared with the denominator.
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	if c := half.Cmp(r.Denom()); c > 0 || (c == 0 && q.Bit(0) == 1) {
+		if rem.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return Money{}, errOverflow
+	}
+	return Money{Units: q.Int64(), Currency: m.Currency}, nil
+}
+
+var errOverflow = fmt.Errorf("amount of money is out of range")
+
+func rat(x interface{}) (*big.Rat, error) {
+	switch x := x.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(x)), nil
+	case int64:
+		return new(big.Rat).SetInt64(x), nil
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil, fmt.Errorf("invalid factor of money: %v", x)
+		}
+		r, _ := new(big.Rat).SetString(strconv.FormatFloat(x, 'f', -1, 64))
+		return r, nil
+	}
+	return nil, fmt.Errorf("invalid factor of money (type %T)", x)
+}
+
+// Amount returns the exact amount, like "12.50", with at least minor units
+// of the currency.
+func (m Money) Amount() string {
+	digits := Scale
+	for digits > Digits(m.Currency) && m.Units%int64(math.Pow10(Scale-digits+1)) == 0 {
+		digits--
+	}
+	return decimal(m.Units, digits)
+}
+
+// Format returns the amount rounded to minor units of the currency, with
+// thousands separated by commas, and the currency, like "1,234.50 USD".
+func (m Money) Format() string {
+	digits := Digits(m.Currency)
+	rounded, err := m.Round(digits)
+	if err != nil {
+		rounded = m
+	}
+	s := decimal(rounded.Units, digits)
+	sign := ""
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integer, fraction = s[:i], s[i:]
+	}
+	var b strings.Builder
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String() + fraction + " " + m.Currency
+}
+
+// String returns the exact amount and the currency, like "12.50 USD".
+func (m Money) String() string {
+	return m.Amount() + " " + m.Currency
+}
+
+// decimal returns units with digits decimal places, which are not rounded.
+func decimal(units int64, digits int) string {
+	sign := ""
+	u := uint64(units)
+	if units < 0 {
+		sign, u = "-", uint64(-units)
+	}
+	s := fmt.Sprintf("%v%v.%04d", sign, u/unit, u%unit)
+	return strings.TrimSuffix(s[:len(s)-(Scale-digits)], ".")
+}
@@ -0,0 +1,139 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func usd(amount string) types.Money {
+	m, err := types.ParseMoney(amount, "USD")
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestMoney(t *testing.T) {
+	m, err := types.ParseMoney("12.5", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, types.Money{Units: 125000, Currency: "USD"}, m)
+	assert.Equal(t, "12.50 USD", m.String())
+	assert.Equal(t, "12.50", m.Amount())
+
+	sum, err := usd("0.1").Add(usd("0.2"))
+	require.NoError(t, err)
+	assert.Equal(t, usd("0.3"), sum)
+
+	third, err := usd("10").Div(3)
+	require.NoError(t, err)
+	assert.Equal(t, "3.3333", third.Amount())
+
+	rounded, err := usd("0.125").Round(2)
+	require.NoError(t, err)
+	assert.Equal(t, usd("0.12"), rounded, "half to even")
+
+	rounded, err = usd("-0.135").Round(2)
+	require.NoError(t, err)
+	assert.Equal(t, usd("-0.14"), rounded)
+
+	product, err := usd("19.99").Mul(0.15)
+	require.NoError(t, err)
+	assert.Equal(t, "2.9985", product.Amount())
+
+	assert.Equal(t, "-1,234,567.89 USD", usd("-1234567.891").Format())
+	jpy, err := types.NewMoney(1500, "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, "1,500 JPY", jpy.Format())
+
+	_, err = usd("1").Add(jpy)
+	assert.EqualError(t, err, "currency mismatch: USD + JPY")
+
+	_, err = types.Money{Units: 1<<63 - 1, Currency: "USD"}.Add(usd("0.0001"))
+	assert.EqualError(t, err, "amount of money is out of range")
+
+	_, err = types.ParseMoney("0.00001", "USD")
+	assert.EqualError(t, err, `amount of money "0.00001" has more than 4 decimal places`)
+
+	_, err = types.ParseMoney("1", "usd")
+	assert.EqualError(t, err, `invalid currency: "usd"`)
+}
+
+func TestMoneySupport(t *testing.T) {
+	env := map[string]interface{}{
+		"price":    usd("12.50"),
+		"discount": usd("2"),
+		"euros":    types.Money{Units: 10000, Currency: "EUR"},
+		"items":    []types.Money{usd("1"), usd("2.25")},
+		"values":   []interface{}{usd("1")},
+	}
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`price * 3 - discount`, usd("35.5")},
+		{`2 * price`, usd("25")},
+		{`price / 3`, usd("4.1667")},
+		{`price / discount`, 6.25},
+		{`money(0.1, "USD") + money(0.2, "USD") == money("0.3", "USD")`, true},
+		{`price > discount && discount <= money(2, "USD")`, true},
+		{`values[0] + price`, usd("13.5")},
+		{`reduce(items, {#acc + #}, money(0, "USD"))`, usd("3.25")},
+		{`money.round(price / 3)`, usd("4.17")},
+		{`money.round(price / 3, 0)`, usd("4")},
+		{`money.format(price * 1000)`, "12,500.00 USD"},
+		{`money.amount(price)`, "12.50"},
+		{`price.Currency`, "USD"},
+	}
+	for _, test := range tests {
+		program, err := expr.Compile(test.code, expr.Env(env), types.MoneySupport())
+		require.NoError(t, err, test.code)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err, test.code)
+		assert.Equal(t, test.want, out, test.code)
+	}
+}
+
+func TestMoneySupport_errors(t *testing.T) {
+	env := map[string]interface{}{
+		"price":  usd("12.50"),
+		"euros":  types.Money{Units: 10000, Currency: "EUR"},
+		"values": []interface{}{1},
+	}
+	compileErrors := []struct {
+		code string
+		err  string
+	}{
+		{`money("1", "USD") + money("1", "EUR")`, "currency mismatch: USD + EUR"},
+		{`price + 1`, "invalid operation: + (mismatched types types.Money and int)"},
+		{`money("1.00001", "USD")`, `amount of money "1.00001" has more than 4 decimal places`},
+		{`money("1", "dollars")`, `invalid currency: "dollars"`},
+	}
+	for _, test := range compileErrors {
+		_, err := expr.Compile(test.code, expr.Env(env), types.MoneySupport())
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+
+	runtimeErrors := []struct {
+		code string
+		err  string
+	}{
+		{`price + euros`, "currency mismatch: USD + EUR"},
+		{`price < euros`, "currency mismatch: USD < EUR"},
+		{`price / 0`, "division of money by zero"},
+		{`price + values[0]`, "invalid operation: types.Money + int"},
+	}
+	for _, test := range runtimeErrors {
+		program, err := expr.Compile(test.code, expr.Env(env), types.MoneySupport())
+		require.NoError(t, err, test.code)
+
+		_, err = expr.Run(program, env)
+		require.Error(t, err, test.code)
+		assert.Contains(t, err.Error(), test.err, test.code)
+	}
+}
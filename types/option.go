@@ -0,0 +1,132 @@
+package types
+
+import (
+	"reflect"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/conf"
+)
+
+// MoneySupport enables operators on Money and functions:
+//
+//	money(amount, currency)  amount is a string, like "12.50", or a number
+//	money.round(m[, digits]) rounds half to even to minor units of currency
+//	money.format(m)          formats rounded amount, like "1,234.50 USD"
+//	money.amount(m)          returns exact amount, like "12.50"
+//
+// Amounts are added to and compared with amounts in the same currency, and
+// multiplied and divided by numbers. Operations on different currencies or
+// with other types are errors, which are reported during compilation, if
+// types or values of operands are known, like money("1", "USD") + 1.
+func MoneySupport() expr.Option {
+	return func(c *conf.Config) {
+		expr.Builtin(moneyFunctions...)(c)
+		for _, op := range moneyOperators {
+			c.OperatorFns[op.operator] = append(c.OperatorFns[op.operator], &builtin.Function{
+				Name:  op.operator,
+				Func:  op.fn,
+				Types: []reflect.Type{reflect.TypeOf(op.signature).Elem()},
+			})
+		}
+	}
+}
+
+var moneyFunctions = []*builtin.Function{
+	{
+		Name: "money",
+		Doc:  "Returns the amount of money in the currency.",
+		Func: func(args ...interface{}) (interface{}, error) {
+			return NewMoney(args[0], args[1].(string))
+		},
+		Types: []reflect.Type{
+			reflect.TypeOf(new(func(string, string) Money)).Elem(),
+			reflect.TypeOf(new(func(int, string) Money)).Elem(),
+			reflect.TypeOf(new(func(float64, string) Money)).Elem(),
+		},
+	},
+	{
+		Name: "money.round",
+		Doc:  "Rounds money half to even to minor units of the currency, or to digits.",
+		Func: func(args ...interface{}) (interface{}, error) {
+			m := args[0].(Money)
+			if len(args) > 1 {
+				return m.Round(args[1].(int))
+			}
+			return m.Round(Digits(m.Currency))
+		},
+		Types: []reflect.Type{
+			reflect.TypeOf(new(func(Money) Money)).Elem(),
+			reflect.TypeOf(new(func(Money, int) Money)).Elem(),
+		},
+	},
+	{
+		Name: "money.format",
+		Doc:  "Formats money rounded to minor units of the currency, like 1,234.50 USD.",
+		Func: func(args ...interface{}) (interface{}, error) {
+			return args[0].(Money).Format(), nil
+		},
+		Types: []reflect.Type{reflect.TypeOf(new(func(Money) string)).Elem()},
+	},
+	{
+		Name: "money.amount",
+		Doc:  "Returns the exact amount of money, like 12.50.",
+		Func: func(args ...interface{}) (interface{}, error) {
+			return args[0].(Money).Amount(), nil
+		},
+		Types: []reflect.Type{reflect.TypeOf(new(func(Money) string)).Elem()},
+	},
+}
+
+// moneyOperators are deterministic, unlike functions of expr.OperatorFunc,
+// so operations on literals are evaluated, and their errors are reported,
+// during compilation.
+var moneyOperators = []struct {
+	operator  string
+	signature interface{}
+	fn        func(args ...interface{}) (interface{}, error)
+}{
+	{"+", new(func(Money, Money) Money), func(args ...interface{}) (interface{}, error) {
+		return args[0].(Money).Add(args[1].(Money))
+	}},
+	{"-", new(func(Money, Money) Money), func(args ...interface{}) (interface{}, error) {
+		return args[0].(Money).Sub(args[1].(Money))
+	}},
+	{"*", new(func(Money, int) Money), func(args ...interface{}) (interface{}, error) {
+		return args[0].(Money).Mul(args[1])
+	}},
+	{"*", new(func(Money, float64) Money), func(args ...interface{}) (interface{}, error) {
+		return args[0].(Money).Mul(args[1])
+	}},
+	{"*", new(func(int, Money) Money), func(args ...interface{}) (interface{}, error) {
+		return args[1].(Money).Mul(args[0])
+	}},
+	{"*", new(func(float64, Money) Money), func(args ...interface{}) (interface{}, error) {
+		return args[1].(Money).Mul(args[0])
+	}},
+	{"/", new(func(Money, int) Money), func(args ...interface{}) (interface{}, error) {
+		return args[0].(Money).Div(args[1])
+	}},
+	{"/", new(func(Money, float64) Money), func(args ...interface{}) (interface{}, error) {
+		return args[0].(Money).Div(args[1])
+	}},
+	{"/", new(func(Money, Money) float64), func(args ...interface{}) (interface{}, error) {
+		return args[0].(Money).Ratio(args[1].(Money))
+	}},
+	{"==", new(func(Money, Money) bool), compare("==", func(c int) bool { return c == 0 })},
+	{"!=", new(func(Money, Money) bool), compare("!=", func(c int) bool { return c != 0 })},
+	{"<", new(func(Money, Money) bool), compare("<", func(c int) bool { return c < 0 })},
+	{">", new(func(Money, Money) bool), compare(">", func(c int) bool { return c > 0 })},
+	{"<=", new(func(Money, Money) bool), compare("<=", func(c int) bool { return c <= 0 })},
+	{">=", new(func(Money, Money) bool), compare(">=", func(c int) bool { return c >= 0 })},
+}
+
+func compare(op string, result func(c int) bool) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		c, err := args[0].(Money).cmp(op, args[1].(Money))
+		if err != nil {
+			return nil, err
+		}
+		return result(c), nil
+	}
+}
@@ -0,0 +1,453 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/conf"
+)
+
+// Registry of object types of environments, which are defined at runtime,
+// like content types of a CMS defined by users, instead of Go structs.
+// Expressions over such environments are checked like expressions over
+// structs, and errors name types of the registry:
+//
+//	r := types.NewRegistry()
+//	r.Define("Author", map[string]string{"name": "string"})
+//	r.Define("Article", map[string]string{"title": "string", "views": "int", "author": "Author", "tags": "[]string"})
+//	env, err := r.Env(map[string]string{"article": "Article"})
+//
+//	program, err := expr.Compile(`article.views > 100 and "go" in article.tags`, env.Option())
+//	value, err := env.Value(map[string]interface{}{"article": article}) // like decoded JSON
+//	output, err := expr.Run(program, value)
+//
+// Types of fields are string, int, float, bool, time, duration and any,
+// names of object types, arrays of them, like []string, and maps of them
+// with string keys, like map[string]int. Values of object types are nil or
+// objects, and types are defined before they are used.
+type Registry struct {
+	mu        sync.Mutex
+	defs      map[string]map[string]string
+	functions []registryFunction
+	// Types of objects are built on first use.
+	built   bool
+	objects map[string]reflect.Type
+	names   map[reflect.Type]string
+}
+
+type registryFunction struct {
+	name   string
+	fn     func(args ...interface{}) (interface{}, error)
+	params []string
+	result string
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		defs:    make(map[string]map[string]string),
+		objects: make(map[string]reflect.Type),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+var registryScalars = map[string]reflect.Type{
+	"string":   reflect.TypeOf(""),
+	"int":      reflect.TypeOf(0),
+	"float":    reflect.TypeOf(float64(0)),
+	"bool":     reflect.TypeOf(false),
+	"time":     reflect.TypeOf(time.Time{}),
+	"duration": reflect.TypeOf(time.Duration(0)),
+	"any":      reflect.TypeOf(new(interface{})).Elem(),
+}
+
+// Define defines the object type of the name with types of its fields.
+func (r *Registry) Define(name string, fields map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.built {
+		return fmt.Errorf("cannot define type %v after types are used", name)
+	}
+	if _, ok := registryScalars[name]; ok || name == "" || strings.ContainsAny(name, "[]") {
+		return fmt.Errorf("invalid name of type %q", name)
+	}
+	if _, ok := r.defs[name]; ok {
+		return fmt.Errorf("type %v is already defined", name)
+	}
+	r.defs[name] = fields
+	return nil
+}
+
+// Function defines the function of parameters and the result of types of
+// the registry, which is added to environments of the registry. Objects
+// are passed to the function as maps, and may be returned as maps.
+func (r *Registry) Function(name string, fn func(args ...interface{}) (interface{}, error), params []string, result string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.built {
+		return fmt.Errorf("cannot define function %v after types are used", name)
+	}
+	r.functions = append(r.functions, registryFunction{name: name, fn: fn, params: params, result: result})
+	return nil
+}
+
+// build builds types of objects in order of their names. References of
+// objects, which are not built yet, like references of authors to their
+// articles and of articles to their authors, are of type any, as Go types
+// built at runtime are not recursive.
+func (r *Registry) build() error {
+	if r.built {
+		return nil
+	}
+	names := make([]string, 0, len(r.defs))
+	for name := range r.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	building := make(map[string]bool)
+	for _, name := range names {
+		if _, err := r.object(name, building); err != nil {
+			return err
+		}
+	}
+	r.built = true
+	return nil
+}
+
+// object returns the type of pointers to structs of the object.
+func (r *Registry) object(name string, building map[string]bool) (reflect.Type, error) {
+	if t, ok := r.objects[name]; ok {
+		return t, nil
+	}
+	if building[name] {
+		return registryScalars["any"], nil
+	}
+	building[name] = true
+	defer delete(building, name)
+
+	fields := make([]string, 0, len(r.defs[name]))
+	for field := range r.defs[name] {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	structFields := make([]reflect.StructField, len(fields))
+	for i, field := range fields {
+		t, err := r.parse(r.defs[name][field], building)
+		if err != nil {
+			return nil, fmt.Errorf("field %v of type %v: %v", field, name, err)
+		}
+		structFields[i] = reflect.StructField{
+			Name: fmt.Sprintf("F%v", i),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf(`expr:%q`, field)),
+		}
+	}
+	s := reflect.StructOf(structFields)
+	t := reflect.PtrTo(s)
+	conf.NameType(s, name)
+	conf.NameType(t, name)
+	r.objects[name] = t
+	r.names[s] = name
+	return t, nil
+}
+
+// parse returns the Go type of the type of the registry.
+func (r *Registry) parse(typ string, building map[string]bool) (reflect.Type, error) {
+	typ = strings.TrimSpace(typ)
+	if t, ok := registryScalars[typ]; ok {
+		return t, nil
+	}
+	if strings.HasPrefix(typ, "[]") {
+		elem, err := r.parse(typ[2:], building)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	}
+	if strings.HasPrefix(typ, "map[string]") {
+		elem, err := r.parse(typ[len("map[string]"):], building)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(registryScalars["string"], elem), nil
+	}
+	if _, ok := r.defs[typ]; ok {
+		return r.object(typ, building)
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// Type returns the Go type of the type of the registry, like Article or
+// []string. Objects are pointers to structs.
+func (r *Registry) Type(typ string) (reflect.Type, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.build(); err != nil {
+		return nil, err
+	}
+	return r.parse(typ, nil)
+}
+
+// Value converts the value, like decoded JSON with maps of objects, to the
+// value of the Go type of the type of the registry.
+func (r *Registry) Value(typ string, value interface{}) (interface{}, error) {
+	t, err := r.Type(typ)
+	if err != nil {
+		return nil, err
+	}
+	v, err := r.convert(t, value, typ)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+func (r *Registry) convert(t reflect.Type, value interface{}, path string) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Type() == t {
+		return v, nil
+	}
+	fail := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("invalid value of %v (expected %v, got %T)", path, conf.TypeString(t), value)
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return v, nil
+	case reflect.Ptr:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fail()
+		}
+		out := reflect.New(t.Elem())
+		for i := 0; i < t.Elem().NumField(); i++ {
+			f := t.Elem().Field(i)
+			name := conf.FieldName(f)
+			fv, err := r.convert(f.Type, m[name], path+"."+name)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Elem().Field(i).Set(fv)
+		}
+		return out, nil
+	case reflect.Slice:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return fail()
+		}
+		out := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			ev, err := r.convert(t.Elem(), v.Index(i).Interface(), fmt.Sprintf("%v[%v]", path, i))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Index(i).Set(ev)
+		}
+		return out, nil
+	case reflect.Map:
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return fail()
+		}
+		out := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			ev, err := r.convert(t.Elem(), iter.Value().Interface(), path+"."+key)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.SetMapIndex(reflect.ValueOf(key), ev)
+		}
+		return out, nil
+	case reflect.Int:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return reflect.ValueOf(int(v.Int())), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return reflect.ValueOf(int(v.Uint())), nil
+		case reflect.Float32, reflect.Float64:
+			// Numbers of JSON are floats.
+			if f := v.Float(); f == float64(int(f)) {
+				return reflect.ValueOf(int(f)), nil
+			}
+		}
+	case reflect.Float64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return reflect.ValueOf(float64(v.Int())), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return reflect.ValueOf(float64(v.Uint())), nil
+		case reflect.Float32:
+			return reflect.ValueOf(v.Float()), nil
+		}
+	case reflect.Struct:
+		// Times are parsed from strings of RFC 3339, like in JSON.
+		if s, ok := value.(string); ok {
+			if tm, err := time.Parse(time.RFC3339, s); err == nil {
+				return reflect.ValueOf(tm), nil
+			}
+		}
+	}
+	if t == registryScalars["duration"] {
+		if s, ok := value.(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				return reflect.ValueOf(d), nil
+			}
+		}
+	}
+	return fail()
+}
+
+// plain converts objects of the value to maps, like values of Value.
+func (r *Registry) plain(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr:
+		if _, ok := r.names[v.Type().Elem()]; !ok {
+			break
+		}
+		if v.IsNil() {
+			return nil
+		}
+		s := v.Elem()
+		m := make(map[string]interface{}, s.NumField())
+		for i := 0; i < s.NumField(); i++ {
+			m[conf.FieldName(s.Type().Field(i))] = r.plain(s.Field(i))
+		}
+		return m
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.plain(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return []interface{}{}
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = r.plain(v.Index(i))
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = r.plain(iter.Value())
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// Env of variables of types of the registry.
+type Env struct {
+	registry  *Registry
+	typ       reflect.Type
+	functions []*builtin.Function
+}
+
+// Env returns the environment of variables of types of the registry, like
+// {"article": "Article"}.
+func (r *Registry) Env(variables map[string]string) (*Env, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.build(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]reflect.StructField, len(names))
+	for i, name := range names {
+		t, err := r.parse(variables[name], nil)
+		if err != nil {
+			return nil, fmt.Errorf("variable %v: %v", name, err)
+		}
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("F%v", i),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf(`expr:%q`, name)),
+		}
+	}
+	env := &Env{registry: r, typ: reflect.StructOf(fields)}
+	for _, f := range r.functions {
+		fn, err := r.function(f)
+		if err != nil {
+			return nil, err
+		}
+		env.functions = append(env.functions, fn)
+	}
+	return env, nil
+}
+
+// function returns the builtin of the function, which converts objects of
+// arguments to maps, and maps of objects of results to objects.
+func (r *Registry) function(f registryFunction) (*builtin.Function, error) {
+	in := make([]reflect.Type, len(f.params))
+	for i, param := range f.params {
+		t, err := r.parse(param, nil)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %v of function %v: %v", i+1, f.name, err)
+		}
+		in[i] = t
+	}
+	out, err := r.parse(f.result, nil)
+	if err != nil {
+		return nil, fmt.Errorf("result of function %v: %v", f.name, err)
+	}
+	return &builtin.Function{
+		Name: f.name,
+		Func: func(args ...interface{}) (interface{}, error) {
+			plain := make([]interface{}, len(args))
+			for i, arg := range args {
+				plain[i] = r.plain(reflect.ValueOf(arg))
+			}
+			result, err := f.fn(plain...)
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.convert(out, result, "result of "+f.name)
+			if err != nil {
+				return nil, err
+			}
+			return v.Interface(), nil
+		},
+		Types: []reflect.Type{reflect.FuncOf(in, []reflect.Type{out}, false)},
+	}, nil
+}
+
+// Option returns the option of variables and functions of the environment
+// for compilation.
+func (e *Env) Option() expr.Option {
+	return func(c *conf.Config) {
+		c.WithEnv(reflect.Zero(e.typ).Interface())
+		expr.Builtin(e.functions...)(c)
+	}
+}
+
+// Value returns the environment of values of variables, like decoded JSON
+// with maps of objects, for runs of programs.
+func (e *Env) Value(values map[string]interface{}) (interface{}, error) {
+	out := reflect.New(e.typ).Elem()
+	for i := 0; i < e.typ.NumField(); i++ {
+		f := e.typ.Field(i)
+		name := conf.FieldName(f)
+		v, err := e.registry.convert(f.Type, values[name], name)
+		if err != nil {
+			return nil, err
+		}
+		out.Field(i).Set(v)
+	}
+	return out.Interface(), nil
+}
@@ -0,0 +1,141 @@
+package types_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/conf"
+	"github.com/antonmedv/expr/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func articles(t *testing.T) *types.Registry {
+	r := types.NewRegistry()
+	require.NoError(t, r.Define("Author", map[string]string{
+		"name":     "string",
+		"articles": "[]Article",
+	}))
+	require.NoError(t, r.Define("Article", map[string]string{
+		"title":     "string",
+		"views":     "int",
+		"rating":    "float",
+		"published": "time",
+		"author":    "Author",
+		"tags":      "[]string",
+		"meta":      "map[string]any",
+	}))
+	return r
+}
+
+func TestRegistry(t *testing.T) {
+	r := articles(t)
+	env, err := r.Env(map[string]string{"article": "Article"})
+	require.NoError(t, err)
+
+	program, err := expr.Compile(`article.views > 100 and "go" in article.tags and article.author.name == "Ann"`, env.Option())
+	require.NoError(t, err)
+
+	value, err := env.Value(map[string]interface{}{
+		"article": map[string]interface{}{
+			"title":     "Generics",
+			"views":     float64(120),
+			"published": "2022-03-15T00:00:00Z",
+			"author":    map[string]interface{}{"name": "Ann"},
+			"tags":      []interface{}{"go", "types"},
+			"unknown":   true,
+		},
+	})
+	require.NoError(t, err)
+
+	output, err := expr.Run(program, value)
+	require.NoError(t, err)
+	assert.Equal(t, true, output)
+
+	output, err = expr.Eval(`article.published.Year() + len(article.meta)`, value)
+	require.NoError(t, err)
+	assert.Equal(t, 2022, output)
+}
+
+func TestRegistry_errors(t *testing.T) {
+	r := articles(t)
+	env, err := r.Env(map[string]string{"article": "Article"})
+	require.NoError(t, err)
+
+	_, err = expr.Compile(`article.titel`, env.Option())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "type Article has no field titel")
+
+	_, err = expr.Compile(`article.author.name + 1`, env.Option())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: + (mismatched types string and int)")
+
+	_, err = env.Value(map[string]interface{}{
+		"article": map[string]interface{}{"views": "many"},
+	})
+	require.EqualError(t, err, "invalid value of article.views (expected int, got string)")
+
+	err = r.Define("Comment", map[string]string{"text": "string"})
+	require.EqualError(t, err, "cannot define type Comment after types are used")
+
+	r = types.NewRegistry()
+	require.NoError(t, r.Define("Article", map[string]string{"author": "Writer"}))
+	_, err = r.Env(nil)
+	require.EqualError(t, err, `field author of type Article: unknown type "Writer"`)
+
+	require.EqualError(t, r.Define("Article", nil), "type Article is already defined")
+	require.EqualError(t, r.Define("int", nil), `invalid name of type "int"`)
+}
+
+func TestRegistry_Function(t *testing.T) {
+	r := articles(t)
+	require.NoError(t, r.Function("byline", func(args ...interface{}) (interface{}, error) {
+		author := args[0].(map[string]interface{})
+		return fmt.Sprintf("by %v", author["name"]), nil
+	}, []string{"Author"}, "string"))
+	require.NoError(t, r.Function("anonymous", func(args ...interface{}) (interface{}, error) {
+		return map[string]interface{}{"name": "anonymous"}, nil
+	}, nil, "Author"))
+	env, err := r.Env(map[string]string{"article": "Article"})
+	require.NoError(t, err)
+
+	program, err := expr.Compile(`byline(article.author ?? anonymous())`, env.Option())
+	require.NoError(t, err)
+
+	value, err := env.Value(map[string]interface{}{
+		"article": map[string]interface{}{"author": map[string]interface{}{"name": "Ann"}},
+	})
+	require.NoError(t, err)
+	output, err := expr.Run(program, value)
+	require.NoError(t, err)
+	assert.Equal(t, "by Ann", output)
+
+	value, err = env.Value(map[string]interface{}{"article": map[string]interface{}{}})
+	require.NoError(t, err)
+	output, err = expr.Run(program, value)
+	require.NoError(t, err)
+	assert.Equal(t, "by anonymous", output)
+
+	_, err = expr.Compile(`byline(article)`, env.Option())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use (Article) as arguments to call byline, where article is Article; byline accepts func(Author) string")
+}
+
+func TestRegistry_Type(t *testing.T) {
+	r := articles(t)
+	typ, err := r.Type("[]Article")
+	require.NoError(t, err)
+	assert.Equal(t, "[]Article", conf.TypeString(typ))
+
+	// References of authors to articles are of type any, as articles of
+	// authors are built before articles.
+	value, err := r.Value("Author", map[string]interface{}{
+		"name":     "Ann",
+		"articles": []interface{}{map[string]interface{}{"title": "Generics"}},
+	})
+	require.NoError(t, err)
+	output, err := expr.Eval(`author.articles[0].title`, map[string]interface{}{"author": value})
+	require.NoError(t, err)
+	assert.Equal(t, "Generics", output)
+}
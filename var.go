@@ -0,0 +1,85 @@
+package expr
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/antonmedv/expr/vm"
+)
+
+// Var holds the program of an expression, which may be replaced while other
+// goroutines run it, like rules reloaded by services without restarts.
+// Sources are recompiled with options of the Var, so new programs are checked
+// against the environment before they replace the current program. Sources,
+// which fail to compile, do not replace it.
+type Var struct {
+	ops     []Option
+	mu      sync.Mutex // serializes updates
+	current atomic.Value
+}
+
+type varProgram struct {
+	source  string
+	program *vm.Program
+}
+
+// NewVar compiles the source with the options, and returns the Var holding
+// its program.
+func NewVar(source string, ops ...Option) (*Var, error) {
+	v := &Var{ops: ops}
+	if err := v.Update(source); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Program returns the current program. Runs of returned programs are not
+// affected by later updates.
+func (v *Var) Program() *vm.Program {
+	return v.load().program
+}
+
+// Source returns the source of the current program.
+func (v *Var) Source() string {
+	return v.load().source
+}
+
+func (v *Var) load() *varProgram {
+	return v.current.Load().(*varProgram)
+}
+
+// Run runs the current program with the environment.
+func (v *Var) Run(env interface{}) (interface{}, error) {
+	return Run(v.Program(), env)
+}
+
+// Update compiles the source, and replaces the current program with its
+// program. If the source fails to compile, the current program is kept and
+// the error is returned. Sources equal to the current source are not
+// recompiled.
+func (v *Var) Update(source string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if current, ok := v.current.Load().(*varProgram); ok && current.source == source {
+		return nil
+	}
+	program, err := Compile(source, v.ops...)
+	if err != nil {
+		return err
+	}
+	v.current.Store(&varProgram{source: source, program: program})
+	return nil
+}
+
+// Watch updates the program with sources received from the channel, until
+// the channel is closed. Errors of updates are passed to onError, if it is
+// not nil. Watch blocks, so it is usually called by its own goroutine:
+//
+//	go rule.Watch(sources, func(err error) { log.Printf("rule: %v", err) })
+func (v *Var) Watch(sources <-chan string, onError func(error)) {
+	for source := range sources {
+		if err := v.Update(source); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package vm
+
+import (
+	"container/list"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Cache is LRU cache of results of a program, keyed by values of the
+// environment. It is safe for concurrent use.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+type cacheEntry struct {
+	key   string
+	value interface{}
+}
+
+// NewCache creates cache holding up to size results.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Len returns number of cached results.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cacheEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *Cache) add(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		e.Value.(*cacheEntry).value = value
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key, value})
+	if c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*cacheEntry).key)
+	}
+}
+
+// maxKeyDepth limits nesting of environment values, which also protects
+// from cyclic references.
+const maxKeyDepth = 32
+
+// cacheKey returns canonical encoding of environment values. Environments
+// holding functions or channels can not be encoded.
+func cacheKey(env interface{}) (string, bool) {
+	var b strings.Builder
+	if !writeKey(&b, reflect.ValueOf(env), 0) {
+		return "", false
+	}
+	return b.String(), true
+}
+
+func writeKey(b *strings.Builder, v reflect.Value, depth int) bool {
+	if depth > maxKeyDepth {
+		return false
+	}
+	if !v.IsValid() {
+		b.WriteString("nil;")
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		b.WriteString(strconv.FormatUint(math.Float64bits(v.Float()), 16))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		b.WriteString(strconv.FormatUint(math.Float64bits(real(c)), 16))
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatUint(math.Float64bits(imag(c)), 16))
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil;")
+			return true
+		}
+		if v.Kind() == reflect.Interface {
+			// Dynamic type is a part of the key, as 1 and 1.0 are different.
+			b.WriteString(v.Elem().Type().String())
+		}
+		b.WriteByte('(')
+		if !writeKey(b, v.Elem(), depth+1) {
+			return false
+		}
+		b.WriteByte(')')
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			b.WriteString("nil;")
+			return true
+		}
+		b.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if !writeKey(b, v.Index(i), depth+1) {
+				return false
+			}
+		}
+		b.WriteByte(']')
+	case reflect.Map:
+		if v.IsNil() {
+			b.WriteString("nil;")
+			return true
+		}
+		entries := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var e strings.Builder
+			if !writeKey(&e, iter.Key(), depth+1) || !writeKey(&e, iter.Value(), depth+1) {
+				return false
+			}
+			entries = append(entries, e.String())
+		}
+		sort.Strings(entries)
+		b.WriteByte('{')
+		for _, e := range entries {
+			b.WriteString(e)
+		}
+		b.WriteByte('}')
+	case reflect.Struct:
+		b.WriteString(v.Type().String())
+		b.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			if !writeKey(b, v.Field(i), depth+1) {
+				return false
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return false
+	}
+	b.WriteByte(';')
+	return true
+}
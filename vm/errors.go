@@ -0,0 +1,128 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/vm/runtime"
+)
+
+// ErrMemoryBudget is the cause of runtime errors of programs exceeding
+// MemoryBudget.
+var ErrMemoryBudget = errors.New("memory budget exceeded")
+
+// RuntimeError is returned by Run if evaluation of a program fails.
+type RuntimeError struct {
+	file.Location
+	Message string
+	Snippet string
+	// Opcode of the failed operation.
+	Opcode Opcode
+	// Operands holds values used by the failed operation, if known.
+	Operands []interface{}
+	// Backtrace holds closures in which the error occurred, innermost first.
+	Backtrace []Frame
+	// Cause is the error returned by a function, or the error value of
+	// a panic.
+	Cause error
+}
+
+// Frame describes a call of closure of a builtin (like map or filter) for
+// an element of an array.
+type Frame struct {
+	file.Location
+	Index   int
+	Element interface{}
+}
+
+func (e *RuntimeError) Error() string {
+	f := &file.Error{
+		Location: e.Location,
+		Message:  e.Message,
+		Snippet:  e.Snippet,
+	}
+	return f.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Cause
+}
+
+// As sets *file.Error of the location and the message of the error, as
+// runtime errors were of type *file.Error before.
+func (e *RuntimeError) As(target interface{}) bool {
+	if t, ok := target.(**file.Error); ok {
+		*t = &file.Error{
+			Location: e.Location,
+			Message:  e.Message,
+			Snippet:  e.Snippet,
+		}
+		return true
+	}
+	return false
+}
+
+// Redact replaces values of operands and elements with names of their types,
+// so the error can be logged without exposing data.
+func (e *RuntimeError) Redact() {
+	for i, v := range e.Operands {
+		e.Operands[i] = fmt.Sprintf("%T", v)
+	}
+	for i := range e.Backtrace {
+		e.Backtrace[i].Element = fmt.Sprintf("%T", e.Backtrace[i].Element)
+	}
+}
+
+func (vm *VM) runtimeError(program *Program, r interface{}) *RuntimeError {
+	ip := vm.ip - 1
+	f := &file.Error{
+		Location: program.Locations[ip],
+		Message:  fmt.Sprintf("%v", r),
+	}
+	if err, ok := r.(*runtime.Error); ok {
+		f = file.Errorf(f.Location, err.Format, err.Args...)
+	}
+	if program.Translator != nil {
+		f.Translate(program.Translator)
+	}
+	f.Bind(program.Source)
+
+	e := &RuntimeError{
+		Location: f.Location,
+		Message:  f.Message,
+		Snippet:  f.Snippet,
+		Opcode:   program.Bytecode[ip],
+		Operands: vm.operands(),
+	}
+	if err, ok := r.(error); ok {
+		e.Cause = err
+	}
+	for i := len(vm.scopes) - 1; i >= 0; i-- {
+		scope := vm.scopes[i]
+		frame := Frame{
+			Location: scope.Location,
+			Index:    scope.It,
+		}
+		if scope.It < scope.Len {
+			frame.Element = scope.Array.Index(scope.It).Interface()
+		}
+		e.Backtrace = append(e.Backtrace, frame)
+	}
+	return e
+}
+
+// operands returns values used by the failed operation, in order of the
+// stack. Values are recorded by the operation itself when it pops or peeks
+// them, so operands are unknown if the operation used more of them than
+// are recorded.
+func (vm *VM) operands() []interface{} {
+	if vm.uses == 0 || vm.uses > maxOperands {
+		return nil
+	}
+	operands := make([]interface{}, vm.uses)
+	for i := range operands {
+		operands[len(operands)-1-i] = vm.used[i]
+	}
+	return operands
+}
@@ -49,6 +49,7 @@ const (
 	OpCall
 	OpCallFast
 	OpCallTyped
+	OpCallBuiltin
 	OpArray
 	OpMap
 	OpLen
@@ -60,5 +61,48 @@ const (
 	OpGetLen
 	OpPointer
 	OpBegin
+	OpTry
+	OpEndTry
+	OpMemo
+	OpMemoStore
+	OpCheckZero
+	OpLoadVar
+	OpStoreVar
+	OpGetIndex
+	OpSetAcc
+	OpGetAcc
+	OpTuple
+	OpUnpack
+	OpConcat
+	OpEqualFloat
+	OpLessInt
+	OpLessFloat
+	OpLessString
+	OpMoreInt
+	OpMoreFloat
+	OpMoreString
+	OpLessOrEqualInt
+	OpLessOrEqualFloat
+	OpLessOrEqualString
+	OpMoreOrEqualInt
+	OpMoreOrEqualFloat
+	OpMoreOrEqualString
+	OpAddInt
+	OpAddFloat
+	OpAddString
+	OpSubtractInt
+	OpSubtractFloat
+	OpMultiplyInt
+	OpMultiplyFloat
+	OpLoadEnv
+	OpCallMethod
+	OpEqualApprox
+	OpCheckFinite
+	OpTaint
+	OpCallContext
+	OpFallback
+	OpLike
+	OpBroadcast
+	OpJumpIfNotNil
 	OpEnd // This opcode must be at the end of this list.
 )
@@ -4,12 +4,22 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync/atomic"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/audit"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/conf"
 	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/metrics"
+	"github.com/antonmedv/expr/tracing"
 	"github.com/antonmedv/expr/vm/runtime"
 )
 
+// Program is compiled bytecode of an expression. Programs are not modified
+// by runs, so one program may be run by many goroutines at once, each with
+// its own VM. Fields must not be modified after compilation, while programs
+// are run; Clone returns copies, which may be modified.
 type Program struct {
 	Node      ast.Node
 	Source    *file.Source
@@ -17,6 +27,69 @@ type Program struct {
 	Constants []interface{}
 	Bytecode  []Opcode
 	Arguments []int
+	// MaxStack is the maximum depth of the stack of operands, which the
+	// VM allocates before runs. Elements of arrays built by loops, like
+	// results of map and comprehensions, are not counted.
+	MaxStack int
+	// Cache of results, if enabled and the program is deterministic.
+	Cache *Cache
+	// Warnings are non-fatal diagnostics found during compilation.
+	Warnings []*file.Error
+	// Translator translates messages of runtime errors.
+	Translator file.Translator
+	// Signature of the environment of compilation, if any.
+	Signature *conf.Signature
+	// Sensitive is true, if the program loads sensitive values, which
+	// taints are tracked by the VM.
+	Sensitive bool
+	// Audit receives records of runs, if auditing is enabled.
+	Audit *audit.Config
+	// Metrics receives measurements of runs, if enabled.
+	Metrics *metrics.Config
+	// Tracing starts spans of runs, if enabled.
+	Tracing *tracing.Config
+	// Converters convert values of types of the environment on access.
+	Converters runtime.Converters
+
+	references atomic.Value // *References
+}
+
+// Clone returns a copy of the program, which fields may be modified without
+// affecting the program, like Translator or Audit. Bytecode, constants and
+// the tree are shared, as runs never modify them. The copy has its own empty
+// cache of results.
+func (program *Program) Clone() *Program {
+	clone := &Program{
+		Node:       program.Node,
+		Source:     program.Source,
+		Locations:  program.Locations,
+		Constants:  program.Constants,
+		Bytecode:   program.Bytecode,
+		Arguments:  program.Arguments,
+		MaxStack:   program.MaxStack,
+		Warnings:   append([]*file.Error(nil), program.Warnings...),
+		Translator: program.Translator,
+		Signature:  program.Signature,
+		Sensitive:  program.Sensitive,
+		Metrics:    program.Metrics,
+		Tracing:    program.Tracing,
+		Converters: program.Converters,
+	}
+	if program.Cache != nil {
+		clone.Cache = NewCache(program.Cache.size)
+	}
+	if program.Audit != nil {
+		config := *program.Audit
+		config.Policies = make(map[string]audit.Policy, len(program.Audit.Policies))
+		for path, policy := range program.Audit.Policies {
+			config.Policies[path] = policy
+		}
+		clone.Audit = &config
+	}
+	if references, ok := program.references.Load().(*References); ok {
+		clone.references.Store(references)
+	}
+	return clone
 }
 
 func (program *Program) Disassemble() string {
@@ -56,6 +129,15 @@ func (program *Program) Disassemble() string {
 			if method, ok := c.(*runtime.Method); ok {
 				c = fmt.Sprintf("{%v %v}", method.Name, method.Index)
 			}
+			if fn, ok := c.(*builtin.Function); ok {
+				c = fn.Name
+			}
+			if memo, ok := c.(*runtime.Memo); ok {
+				c = fmt.Sprintf("{%v %v}", memo.Name, memo.Args)
+			}
+			if call, ok := c.(*runtime.MethodCall); ok {
+				c = fmt.Sprintf("{%v %v}", call.Name, call.Args)
+			}
 			out += fmt.Sprintf("%v\t%v\t%v\t%v\n", pp, label, arg, c)
 		}
 
@@ -198,6 +280,9 @@ func (program *Program) Disassemble() string {
 		case OpCallTyped:
 			argument("OpCallTyped")
 
+		case OpCallBuiltin:
+			constant("OpCallBuiltin")
+
 		case OpArray:
 			code("OpArray")
 
@@ -231,6 +316,135 @@ func (program *Program) Disassemble() string {
 		case OpBegin:
 			code("OpBegin")
 
+		case OpTry:
+			jump("OpTry")
+
+		case OpEndTry:
+			jump("OpEndTry")
+
+		case OpMemo:
+			constant("OpMemo")
+
+		case OpMemoStore:
+			code("OpMemoStore")
+
+		case OpCheckZero:
+			constant("OpCheckZero")
+
+		case OpLoadVar:
+			argument("OpLoadVar")
+
+		case OpStoreVar:
+			argument("OpStoreVar")
+
+		case OpGetIndex:
+			code("OpGetIndex")
+
+		case OpSetAcc:
+			code("OpSetAcc")
+
+		case OpGetAcc:
+			code("OpGetAcc")
+
+		case OpTuple:
+			argument("OpTuple")
+
+		case OpUnpack:
+			argument("OpUnpack")
+
+		case OpConcat:
+			argument("OpConcat")
+
+		case OpEqualFloat:
+			code("OpEqualFloat")
+
+		case OpLessInt:
+			code("OpLessInt")
+
+		case OpLessFloat:
+			code("OpLessFloat")
+
+		case OpLessString:
+			code("OpLessString")
+
+		case OpMoreInt:
+			code("OpMoreInt")
+
+		case OpMoreFloat:
+			code("OpMoreFloat")
+
+		case OpMoreString:
+			code("OpMoreString")
+
+		case OpLessOrEqualInt:
+			code("OpLessOrEqualInt")
+
+		case OpLessOrEqualFloat:
+			code("OpLessOrEqualFloat")
+
+		case OpLessOrEqualString:
+			code("OpLessOrEqualString")
+
+		case OpMoreOrEqualInt:
+			code("OpMoreOrEqualInt")
+
+		case OpMoreOrEqualFloat:
+			code("OpMoreOrEqualFloat")
+
+		case OpMoreOrEqualString:
+			code("OpMoreOrEqualString")
+
+		case OpAddInt:
+			code("OpAddInt")
+
+		case OpAddFloat:
+			code("OpAddFloat")
+
+		case OpAddString:
+			code("OpAddString")
+
+		case OpSubtractInt:
+			code("OpSubtractInt")
+
+		case OpSubtractFloat:
+			code("OpSubtractFloat")
+
+		case OpMultiplyInt:
+			code("OpMultiplyInt")
+
+		case OpMultiplyFloat:
+			code("OpMultiplyFloat")
+
+		case OpLoadEnv:
+			code("OpLoadEnv")
+
+		case OpCallMethod:
+			constant("OpCallMethod")
+
+		case OpEqualApprox:
+			constant("OpEqualApprox")
+
+		case OpCheckFinite:
+			constant("OpCheckFinite")
+
+		case OpTaint:
+			code("OpTaint")
+
+		case OpCallContext:
+			constant("OpCallContext")
+
+		case OpFallback:
+			jump("OpFallback")
+
+		case OpLike:
+			code("OpLike")
+
+		case OpBroadcast:
+			constant("OpBroadcast")
+
+		case OpJumpIfNotNil:
+			jump("OpJumpIfNotNil")
+
 		case OpEnd:
 			code("OpEnd")
 
@@ -0,0 +1,177 @@
+package vm
+
+import (
+	"sort"
+
+	"github.com/antonmedv/expr/ast"
+)
+
+// References of the environment, which the program may read or call.
+// Names are sorted and unique.
+type References struct {
+	// Variables of the environment, like "user".
+	Variables []string `json:"variables"`
+	// Fields are paths of members of variables, like "user.Address.City".
+	// Paths end at the last member with a constant name, so user[key].Name
+	// is the variable "user" only.
+	Fields []string `json:"fields"`
+	// Functions are called functions, builtins and methods, like "len" and
+	// "user.Greet".
+	Functions []string `json:"functions"`
+}
+
+// References returns variables, fields and functions of the environment,
+// which the program may touch. References are collected by the compiler
+// after optimization, so calls folded to constants are not referenced.
+func (program *Program) References() *References {
+	if references, ok := program.references.Load().(*References); ok {
+		return references
+	}
+	references := ReferencesOf(program.Node)
+	program.references.Store(references)
+	return references
+}
+
+// ReferencesOf returns references of the tree.
+func ReferencesOf(node ast.Node) *References {
+	r := &referencesCollector{
+		variables: make(map[string]bool),
+		fields:    make(map[string]bool),
+		functions: make(map[string]bool),
+	}
+	r.visit(node)
+	return &References{
+		Variables: sorted(r.variables),
+		Fields:    sorted(r.fields),
+		Functions: sorted(r.functions),
+	}
+}
+
+type referencesCollector struct {
+	variables, fields, functions map[string]bool
+}
+
+func (r *referencesCollector) visit(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		r.variables[n.Value] = true
+	case *ast.UnaryNode:
+		r.visit(n.Node)
+	case *ast.BinaryNode:
+		r.visit(n.Left)
+		r.visit(n.Right)
+	case *ast.ChainNode:
+		r.visit(n.Node)
+	case *ast.MemberNode:
+		if root, path, ok := pathOf(n); ok {
+			r.variables[root] = true
+			r.fields[path] = true
+			return
+		}
+		r.visit(n.Node)
+		r.visit(n.Property)
+	case *ast.SliceNode:
+		r.visit(n.Node)
+		r.visit(n.From)
+		r.visit(n.To)
+	case *ast.CallNode:
+		if n.Func != nil {
+			// Functions and builtins, like strings.upper, are not members
+			// of the environment.
+			r.functions[n.Func.Name] = true
+		} else {
+			switch callee := n.Callee.(type) {
+			case *ast.IdentifierNode:
+				r.functions[callee.Value] = true
+			case *ast.MemberNode:
+				if root, path, ok := pathOf(callee); ok {
+					r.variables[root] = true
+					r.functions[path] = true
+				} else {
+					r.visit(callee)
+				}
+			default:
+				r.visit(callee)
+			}
+		}
+		for _, arg := range n.Arguments {
+			r.visit(arg)
+		}
+	case *ast.BuiltinNode:
+		r.functions[n.Name] = true
+		for _, arg := range n.Arguments {
+			r.visit(arg)
+		}
+	case *ast.ClosureNode:
+		r.visit(n.Node)
+	case *ast.ConditionalNode:
+		r.visit(n.Cond)
+		r.visit(n.Exp1)
+		r.visit(n.Exp2)
+	case *ast.ArrayNode:
+		for _, item := range n.Nodes {
+			r.visit(item)
+		}
+	case *ast.MapNode:
+		for _, pair := range n.Pairs {
+			r.visit(pair)
+		}
+	case *ast.PairNode:
+		r.visit(n.Key)
+		r.visit(n.Value)
+	case *ast.LetNode:
+		r.visit(n.Value)
+	case *ast.AssignNode:
+		r.visit(n.Value)
+	case *ast.BlockNode:
+		for _, assign := range n.Nodes {
+			r.visit(assign)
+		}
+	case *ast.TupleNode:
+		for _, element := range n.Nodes {
+			r.visit(element)
+		}
+	case *ast.BindNode:
+		r.visit(n.Value)
+		r.visit(n.Body)
+	case *ast.ComprehensionNode:
+		r.visit(n.Items)
+		if n.Cond != nil {
+			r.visit(n.Cond)
+		}
+		r.visit(n.Node)
+	case *ast.SharedNode:
+		r.visit(n.Node)
+	}
+}
+
+// pathOf returns variable and path of members with constant names, like
+// "user" and "user.Address.City".
+func pathOf(node *ast.MemberNode) (string, string, bool) {
+	name, ok := node.Property.(*ast.StringNode)
+	if !ok {
+		return "", "", false
+	}
+	switch n := node.Node.(type) {
+	case *ast.IdentifierNode:
+		return n.Value, n.Value + "." + name.Value, true
+	case *ast.MemberNode:
+		root, path, ok := pathOf(n)
+		return root, path + "." + name.Value, ok
+	case *ast.ChainNode:
+		if member, ok := n.Node.(*ast.MemberNode); ok {
+			root, path, ok := pathOf(member)
+			return root, path + "." + name.Value, ok
+		}
+	}
+	return "", "", false
+}
+
+func sorted(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
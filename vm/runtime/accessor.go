@@ -0,0 +1,218 @@
+//go:build !purego
+// +build !purego
+
+package runtime
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// eface is the layout of interface{} values.
+type eface struct {
+	typ, data unsafe.Pointer
+}
+
+func efaceOf(v *interface{}) *eface {
+	return (*eface)(unsafe.Pointer(v))
+}
+
+// accessor reads a field of structs of a type known at compile time by
+// offsets of fields, without reflection.
+type accessor struct {
+	structType unsafe.Pointer // type word of values of the struct type
+	ptrType    unsafe.Pointer // type word of pointers to the struct
+	offsets    []uintptr
+	// pointers are steps of the path to fields of pointer types, which
+	// are dereferenced before the next field.
+	pointers  []bool
+	fieldType reflect.Type
+	// fieldWord is the type word of values of the field, or nil for
+	// interfaces, which are read with reflection.
+	fieldWord unsafe.Pointer
+	direct    bool
+}
+
+var intType = reflect.TypeOf(0)
+
+// layoutOK is set, if interfaces and types of the Go runtime have layouts,
+// which accessors assume. Otherwise, or with the purego build tag, fields
+// are read with reflection.
+var layoutOK = checkLayout()
+
+// checkLayout reads fields of a sample struct and of a pointer to it by
+// accessors, and compares them with fields read with reflection.
+func checkLayout() (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	type single struct{ P *int }
+	type sample struct {
+		Int    int
+		String string
+		Ptr    *int
+		Single single
+		Any    interface{}
+		Array  [2]int
+		Map    map[string]int
+		Next   *sample
+	}
+	n := 42
+	value := sample{
+		Int:    1,
+		String: "a",
+		Ptr:    &n,
+		Single: single{P: &n},
+		Any:    1.5,
+		Array:  [2]int{1, 2},
+		Map:    map[string]int{"a": 1},
+		Next:   &sample{Int: 2, Ptr: &n},
+	}
+	t := reflect.TypeOf(value)
+	for _, index := range [][]int{{0}, {1}, {2}, {3}, {3, 0}, {4}, {5}, {6}, {7, 0}, {7, 2}} {
+		a := buildAccessor(t, index)
+		if a == nil {
+			return false
+		}
+		for _, from := range []interface{}{value, &value} {
+			want := reflect.Indirect(reflect.ValueOf(from))
+			got, ok := a.get(from)
+			if !ok || !reflect.DeepEqual(got, want.FieldByIndex(index).Interface()) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func newAccessor(t reflect.Type, index []int) *accessor {
+	if !layoutOK {
+		return nil
+	}
+	return buildAccessor(t, index)
+}
+
+func buildAccessor(t reflect.Type, index []int) *accessor {
+	if t == nil || len(index) == 0 {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	a := &accessor{
+		ptrType:  typeWord(reflect.PtrTo(t)),
+		offsets:  make([]uintptr, len(index)),
+		pointers: make([]bool, len(index)),
+	}
+	if !directIface(t) {
+		// Interface values of structs point to copies of structs, unless
+		// structs are stored in interfaces directly, like a single pointer.
+		a.structType = typeWord(t)
+	}
+	for i, x := range index {
+		if i > 0 {
+			if t.Kind() == reflect.Ptr {
+				a.pointers[i] = true
+				t = t.Elem()
+			}
+		}
+		if t.Kind() != reflect.Struct || x >= t.NumField() {
+			return nil
+		}
+		f := t.Field(x)
+		if f.PkgPath != "" && (!f.Anonymous || i == len(index)-1) {
+			// Unexported fields are not readable with reflection either.
+			return nil
+		}
+		a.offsets[i] = f.Offset
+		t = f.Type
+	}
+	a.fieldType = t
+	if t.Kind() != reflect.Interface {
+		a.fieldWord = typeWord(t)
+		a.direct = directIface(t)
+	}
+	return a
+}
+
+// get returns the value of the field, or false, if the value is not of the
+// type of the accessor or a pointer on the path is nil.
+func (a *accessor) get(from interface{}) (interface{}, bool) {
+	e := efaceOf(&from)
+	p := e.data
+	// Copies of structs in interfaces are never modified, so their fields
+	// are not copied, like by reflection. Fields of structs behind
+	// pointers are copied.
+	copied := true
+	switch e.typ {
+	case a.ptrType:
+		copied = false
+	case a.structType:
+		if a.structType == nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	if p == nil {
+		return nil, false
+	}
+	for i, offset := range a.offsets {
+		if a.pointers[i] {
+			p = *(*unsafe.Pointer)(p)
+			if p == nil {
+				return nil, false
+			}
+			copied = false
+		}
+		p = unsafe.Pointer(uintptr(p) + offset)
+	}
+	return a.value(p, copied), true
+}
+
+// value returns the value of the field at the pointer.
+func (a *accessor) value(p unsafe.Pointer, copied bool) interface{} {
+	if a.fieldWord == nil {
+		return reflect.NewAt(a.fieldType, p).Elem().Interface()
+	}
+	var v interface{}
+	e := efaceOf(&v)
+	switch {
+	case a.direct:
+		// Values of pointers, maps, channels and functions are stored in
+		// interfaces as they are.
+		e.typ, e.data = a.fieldWord, *(*unsafe.Pointer)(p)
+	case copied:
+		e.typ, e.data = a.fieldWord, p
+	case a.fieldType == intType:
+		return Int(*(*int)(p))
+	default:
+		return reflect.NewAt(a.fieldType, p).Elem().Interface()
+	}
+	return v
+}
+
+// typeWord returns the type word of interface values of the type, which is
+// the pointer held by reflect.Type.
+func typeWord(t reflect.Type) unsafe.Pointer {
+	return efaceOf((*interface{})(unsafe.Pointer(&t))).data
+}
+
+// directIface reports whether values of the type are stored in interfaces
+// as they are, instead of pointers to copies, by rules of the Go compiler.
+func directIface(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	case reflect.Struct:
+		return t.NumField() == 1 && directIface(t.Field(0).Type)
+	case reflect.Array:
+		return t.Len() == 1 && directIface(t.Elem())
+	}
+	return false
+}
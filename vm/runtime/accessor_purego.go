@@ -0,0 +1,18 @@
+//go:build purego
+// +build purego
+
+package runtime
+
+import "reflect"
+
+// accessor is not used with the purego build tag, which disables package
+// unsafe, so fields are read with reflection.
+type accessor struct{}
+
+func newAccessor(reflect.Type, []int) *accessor {
+	return nil
+}
+
+func (a *accessor) get(interface{}) (interface{}, bool) {
+	return nil, false
+}
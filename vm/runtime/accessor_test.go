@@ -0,0 +1,26 @@
+//go:build !purego
+// +build !purego
+
+package runtime
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckLayout(t *testing.T) {
+	if !layoutOK {
+		t.Fatal("fields are read with reflection, as layouts of the Go runtime differ from layouts of accessors")
+	}
+
+	type user struct {
+		Name string
+	}
+	field := NewField(reflect.TypeOf(user{}), []int{0}, []string{"Name"})
+	if field.accessor == nil {
+		t.Fatal("no accessor of user.Name")
+	}
+	if got := FetchField(&user{Name: "anna"}, field); got != "anna" {
+		t.Fatalf("got %v, want anna", got)
+	}
+}
@@ -0,0 +1,78 @@
+package runtime
+
+import "reflect"
+
+// Broadcast is a fused loop of element-wise arithmetic of arrays and scalars,
+// like prices * 1.2 + fees. Code is the operation in postfix order. Operands
+// are taken from the stack of the VM, and arrays among them are iterated at
+// once, without intermediate arrays.
+type Broadcast struct {
+	// Operands is the number of operands of the operation.
+	Operands int
+	Code     []BroadcastStep
+}
+
+// BroadcastStep is either an operand of the index, or an operator applied to
+// the two topmost values, if Operator is not empty.
+type BroadcastStep struct {
+	Operand  int
+	Operator string
+}
+
+// Run returns the array of results of the operation for every element of
+// arrays among operands. Arrays must be of the same length.
+func (b *Broadcast) Run(operands []interface{}) []interface{} {
+	arrays := make([]reflect.Value, len(operands))
+	size := -1
+	for i, operand := range operands {
+		v := reflect.ValueOf(operand)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			continue
+		}
+		if size >= 0 && v.Len() != size {
+			panic(Errorf("mismatched lengths of arrays (%v and %v)", size, v.Len()))
+		}
+		arrays[i] = v
+		size = v.Len()
+	}
+	if size < 0 {
+		size = 0
+	}
+	out := make([]interface{}, size)
+	stack := make([]interface{}, 0, len(b.Code))
+	for i := range out {
+		stack = stack[:0]
+		for _, step := range b.Code {
+			if step.Operator == "" {
+				if arrays[step.Operand].IsValid() {
+					stack = append(stack, arrays[step.Operand].Index(i).Interface())
+				} else {
+					stack = append(stack, operands[step.Operand])
+				}
+				continue
+			}
+			x, y := stack[len(stack)-2], stack[len(stack)-1]
+			stack = append(stack[:len(stack)-2], arithmetic(step.Operator, x, y))
+		}
+		out[i] = stack[0]
+	}
+	return out
+}
+
+func arithmetic(operator string, a, b interface{}) interface{} {
+	switch operator {
+	case "+":
+		return Add(a, b)
+	case "-":
+		return Subtract(a, b)
+	case "*":
+		return Multiply(a, b)
+	case "/":
+		return Divide(a, b)
+	case "%":
+		return Modulo(a, b)
+	case "**", "^":
+		return Exponent(a, b)
+	}
+	panic(Errorf("unknown operator (%v)", operator))
+}
@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ValueConverter is a value of an environment, which controls how it appears
+// to expressions, like sql.NullString as a string or nil, or a decimal as a
+// number. Variables, fields and elements of such types are converted on
+// access, so operators and builtins get converted values. The checker knows
+// only that converted values are of any type.
+type ValueConverter interface {
+	ToExprValue() interface{}
+}
+
+// ValueParser is a pointer to a value of a parameter of functions and
+// methods of an environment, which is set from a value of an expression,
+// like a string or nil for sql.NullString. Values of other types than the
+// parameter are passed to functions after FromExprValue.
+type ValueParser interface {
+	FromExprValue(value interface{}) error
+}
+
+// Converters convert values of types of environments on access, like
+// timestamps of protobuf to time.Time, by functions of one parameter of the
+// type and one result, which the checker knows as the type of values.
+type Converters map[reflect.Type]reflect.Value
+
+// Convert returns the value converted by the function of its type, or the
+// value itself.
+func (c Converters) Convert(value interface{}) interface{} {
+	if fn, ok := c[reflect.TypeOf(value)]; ok {
+		return fn.Call([]reflect.Value{reflect.ValueOf(value)})[0].Interface()
+	}
+	return value
+}
+
+var (
+	converterType = reflect.TypeOf((*ValueConverter)(nil)).Elem()
+	parserType    = reflect.TypeOf((*ValueParser)(nil)).Elem()
+)
+
+// IsConverter reports whether values of the type are converted on access.
+func IsConverter(t reflect.Type) bool {
+	return t != nil && t.Kind() != reflect.Interface && t.Implements(converterType)
+}
+
+// IsParser reports whether parameters of the type are set by FromExprValue,
+// or are nullable types of database/sql.
+func IsParser(t reflect.Type) bool {
+	if _, ok := NullType(t); ok {
+		return true
+	}
+	return t != nil && t.Kind() != reflect.Interface && reflect.PtrTo(t).Implements(parserType)
+}
+
+// Parse returns the value of the parameter of the type t, set by
+// FromExprValue of the value of the expression, if the value is not of the
+// type already.
+func Parse(t reflect.Type, value interface{}) (reflect.Value, error) {
+	if value != nil && reflect.TypeOf(value).AssignableTo(t) {
+		return reflect.ValueOf(value), nil
+	}
+	if _, ok := NullType(t); ok {
+		return parseNull(t, value)
+	}
+	p := reflect.New(t)
+	if err := p.Interface().(ValueParser).FromExprValue(value); err != nil {
+		return reflect.Value{}, fmt.Errorf("cannot use %v as %v: %w", value, t, err)
+	}
+	return p.Elem(), nil
+}
@@ -0,0 +1,18 @@
+package runtime
+
+import "fmt"
+
+// Error is a panic value of failed operations. It keeps format and arguments
+// of the message, so the message can be translated.
+type Error struct {
+	Format string
+	Args   []interface{}
+}
+
+func Errorf(format string, args ...interface{}) *Error {
+	return &Error{Format: format, Args: args}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(e.Format, e.Args...)
+}
@@ -0,0 +1,27 @@
+package runtime
+
+// Fetcher is an environment, or a value of it, which members are loaded on
+// first use, like data from a database, so that only data referenced by the
+// expression is loaded. Variables of environments are fetched once per run.
+// Errors of Fetch are runtime errors.
+type Fetcher interface {
+	Fetch(name string) (interface{}, error)
+}
+
+// FieldFetcher is an environment, which also loads fields of variables by
+// paths with constant names, like "user.Address.City", instead of loading
+// whole variables. Paths are fetched from environments of struct types,
+// which fields are known at compilation.
+type FieldFetcher interface {
+	Fetcher
+	FetchField(path string) (interface{}, error)
+}
+
+// FetchFrom calls Fetch of fetcher, and panics with its error.
+func FetchFrom(fetcher Fetcher, name string) interface{} {
+	value, err := fetcher.Fetch(name)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
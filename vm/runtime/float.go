@@ -0,0 +1,78 @@
+package runtime
+
+import "math"
+
+// FloatEqual describes comparison of floats by == and !=. Floats are equal,
+// if their difference is at most Epsilon, or if they are at most ULP
+// representable floats apart. Integers are compared with floats as floats,
+// and with integers exactly.
+type FloatEqual struct {
+	Epsilon float64
+	ULP     uint64
+}
+
+// Equal reports whether a and b are equal, comparing floats approximately.
+func (e *FloatEqual) Equal(a, b interface{}) bool {
+	x, ok := floatOperand(a, b)
+	if !ok {
+		return Equal(a, b)
+	}
+	y, ok := floatOperand(b, a)
+	if !ok {
+		return Equal(a, b)
+	}
+	if x == y {
+		return true
+	}
+	if math.IsNaN(x) || math.IsNaN(y) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return false
+	}
+	if math.Abs(x-y) <= e.Epsilon {
+		return true
+	}
+	return e.ULP > 0 && ulps(x, y) <= e.ULP
+}
+
+// floatOperand returns the number a as float64, if a or b is a float.
+func floatOperand(a, b interface{}) (float64, bool) {
+	switch a.(type) {
+	case float32, float64:
+		return ToFloat64(a), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		switch b.(type) {
+		case float32, float64:
+			return ToFloat64(a), true
+		}
+	}
+	return 0, false
+}
+
+// ulps returns the number of representable floats between x and y.
+func ulps(x, y float64) uint64 {
+	a, b := ordered(x), ordered(y)
+	if a > b {
+		return uint64(a) - uint64(b)
+	}
+	return uint64(b) - uint64(a)
+}
+
+// ordered maps floats to integers, which are ordered as floats are.
+func ordered(f float64) int64 {
+	i := int64(math.Float64bits(f))
+	if i < 0 {
+		i = math.MinInt64 - i
+	}
+	return i
+}
+
+// IsFinite reports whether v is not a float, or is a float, which is neither
+// NaN nor an infinity.
+func IsFinite(v interface{}) bool {
+	switch x := v.(type) {
+	case float64:
+		return !math.IsNaN(x) && !math.IsInf(x, 0)
+	case float32:
+		return !math.IsNaN(float64(x)) && !math.IsInf(float64(x), 0)
+	}
+	return true
+}
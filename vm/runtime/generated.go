@@ -3,7 +3,6 @@
 package runtime
 
 import (
-	"fmt"
 	"reflect"
 	"time"
 )
@@ -344,6 +343,11 @@ func Equal(a, b interface{}) bool {
 		case time.Time:
 			return x.Equal(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) == 0
+		}
 	}
 	if IsNil(a) && IsNil(b) {
 		return true
@@ -687,8 +691,13 @@ func Less(a, b interface{}) bool {
 		case time.Time:
 			return x.Before(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) < 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T < %T", a, b))
+	panic(Errorf("invalid operation: %T < %T", a, b))
 }
 
 func More(a, b interface{}) bool {
@@ -1027,8 +1036,13 @@ func More(a, b interface{}) bool {
 		case time.Time:
 			return x.After(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) > 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T > %T", a, b))
+	panic(Errorf("invalid operation: %T > %T", a, b))
 }
 
 func LessOrEqual(a, b interface{}) bool {
@@ -1367,8 +1381,13 @@ func LessOrEqual(a, b interface{}) bool {
 		case time.Time:
 			return x.Before(y) || x.Equal(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) <= 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T <= %T", a, b))
+	panic(Errorf("invalid operation: %T <= %T", a, b))
 }
 
 func MoreOrEqual(a, b interface{}) bool {
@@ -1707,8 +1726,13 @@ func MoreOrEqual(a, b interface{}) bool {
 		case time.Time:
 			return x.After(y) || x.Equal(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) >= 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T >= %T", a, b))
+	panic(Errorf("invalid operation: %T >= %T", a, b))
 }
 
 func Add(a, b interface{}) interface{} {
@@ -1716,25 +1740,25 @@ func Add(a, b interface{}) interface{} {
 	case uint:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1743,25 +1767,25 @@ func Add(a, b interface{}) interface{} {
 	case uint8:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1770,25 +1794,25 @@ func Add(a, b interface{}) interface{} {
 	case uint16:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1797,25 +1821,25 @@ func Add(a, b interface{}) interface{} {
 	case uint32:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1824,25 +1848,25 @@ func Add(a, b interface{}) interface{} {
 	case uint64:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1851,25 +1875,25 @@ func Add(a, b interface{}) interface{} {
 	case int:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1878,25 +1902,25 @@ func Add(a, b interface{}) interface{} {
 	case int8:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1905,25 +1929,25 @@ func Add(a, b interface{}) interface{} {
 	case int16:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1932,25 +1956,25 @@ func Add(a, b interface{}) interface{} {
 	case int32:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -1959,25 +1983,25 @@ func Add(a, b interface{}) interface{} {
 	case int64:
 		switch y := b.(type) {
 		case uint:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case uint64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int8:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int16:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int32:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case int64:
-			return int(x) + int(y)
+			return Int(int(x) + int(y))
 		case float32:
 			return float64(x) + float64(y)
 		case float64:
@@ -2053,7 +2077,7 @@ func Add(a, b interface{}) interface{} {
 			return y.Add(x)
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T + %T", a, b))
+	panic(Errorf("invalid operation: %T + %T", a, b))
 }
 
 func Subtract(a, b interface{}) interface{} {
@@ -2061,25 +2085,25 @@ func Subtract(a, b interface{}) interface{} {
 	case uint:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2088,25 +2112,25 @@ func Subtract(a, b interface{}) interface{} {
 	case uint8:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2115,25 +2139,25 @@ func Subtract(a, b interface{}) interface{} {
 	case uint16:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2142,25 +2166,25 @@ func Subtract(a, b interface{}) interface{} {
 	case uint32:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2169,25 +2193,25 @@ func Subtract(a, b interface{}) interface{} {
 	case uint64:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2196,25 +2220,25 @@ func Subtract(a, b interface{}) interface{} {
 	case int:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2223,25 +2247,25 @@ func Subtract(a, b interface{}) interface{} {
 	case int8:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2250,25 +2274,25 @@ func Subtract(a, b interface{}) interface{} {
 	case int16:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2277,25 +2301,25 @@ func Subtract(a, b interface{}) interface{} {
 	case int32:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2304,25 +2328,25 @@ func Subtract(a, b interface{}) interface{} {
 	case int64:
 		switch y := b.(type) {
 		case uint:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case uint64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int8:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int16:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int32:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case int64:
-			return int(x) - int(y)
+			return Int(int(x) - int(y))
 		case float32:
 			return float64(x) - float64(y)
 		case float64:
@@ -2388,7 +2412,7 @@ func Subtract(a, b interface{}) interface{} {
 			return x.Sub(y)
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T - %T", a, b))
+	panic(Errorf("invalid operation: %T - %T", a, b))
 }
 
 func Multiply(a, b interface{}) interface{} {
@@ -2396,25 +2420,25 @@ func Multiply(a, b interface{}) interface{} {
 	case uint:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2423,25 +2447,25 @@ func Multiply(a, b interface{}) interface{} {
 	case uint8:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2450,25 +2474,25 @@ func Multiply(a, b interface{}) interface{} {
 	case uint16:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2477,25 +2501,25 @@ func Multiply(a, b interface{}) interface{} {
 	case uint32:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2504,25 +2528,25 @@ func Multiply(a, b interface{}) interface{} {
 	case uint64:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2531,25 +2555,25 @@ func Multiply(a, b interface{}) interface{} {
 	case int:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2558,25 +2582,25 @@ func Multiply(a, b interface{}) interface{} {
 	case int8:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2585,25 +2609,25 @@ func Multiply(a, b interface{}) interface{} {
 	case int16:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2612,25 +2636,25 @@ func Multiply(a, b interface{}) interface{} {
 	case int32:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2639,25 +2663,25 @@ func Multiply(a, b interface{}) interface{} {
 	case int64:
 		switch y := b.(type) {
 		case uint:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case uint64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int8:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int16:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int32:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case int64:
-			return int(x) * int(y)
+			return Int(int(x) * int(y))
 		case float32:
 			return float64(x) * float64(y)
 		case float64:
@@ -2718,7 +2742,7 @@ func Multiply(a, b interface{}) interface{} {
 			return float64(x) * float64(y)
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T * %T", a, b))
+	panic(Errorf("invalid operation: %T * %T", a, b))
 }
 
 func Divide(a, b interface{}) float64 {
@@ -3048,7 +3072,7 @@ func Divide(a, b interface{}) float64 {
 			return float64(x) / float64(y)
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T / %T", a, b))
+	panic(Errorf("invalid operation: %T / %T", a, b))
 }
 
 func Modulo(a, b interface{}) int {
@@ -3284,5 +3308,5 @@ func Modulo(a, b interface{}) int {
 			return int(x) % int(y)
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %% %T", a, b))
+	panic(Errorf("invalid operation: %T %% %T", a, b))
 }
@@ -68,6 +68,8 @@ func cases(op string, noFloat bool) string {
 			echo(`case %v:`, b)
 			if op == "/" {
 				echo(`return float64(x) / float64(y)`)
+			} else if t == "int" && strings.Contains("+-*", op) {
+				echo(`return Int(int(x) %v int(y))`, op)
 			} else {
 				echo(`return %v(x) %v %v(y)`, t, op, t)
 			}
@@ -82,7 +84,6 @@ const helpers = `// Code generated by vm/runtime/helpers/main.go. DO NOT EDIT.
 package runtime
 
 import (
-	"fmt"
 	"reflect"
 	"time"
 )
@@ -100,6 +101,11 @@ func Equal(a, b interface{}) bool {
 		case time.Time:
 			return x.Equal(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) == 0
+		}
 	}
 	if IsNil(a) && IsNil(b) {
 		return true
@@ -120,8 +126,13 @@ func Less(a, b interface{}) bool {
 		case time.Time:
 			return x.Before(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) < 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T < %T", a, b))
+	panic(Errorf("invalid operation: %T < %T", a, b))
 }
 
 func More(a, b interface{}) bool {
@@ -137,8 +148,13 @@ func More(a, b interface{}) bool {
 		case time.Time:
 			return x.After(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) > 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T > %T", a, b))
+	panic(Errorf("invalid operation: %T > %T", a, b))
 }
 
 func LessOrEqual(a, b interface{}) bool {
@@ -154,8 +170,13 @@ func LessOrEqual(a, b interface{}) bool {
 		case time.Time:
 			return x.Before(y) || x.Equal(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) <= 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T <= %T", a, b))
+	panic(Errorf("invalid operation: %T <= %T", a, b))
 }
 
 func MoreOrEqual(a, b interface{}) bool {
@@ -171,8 +192,13 @@ func MoreOrEqual(a, b interface{}) bool {
 		case time.Time:
 			return x.After(y) || x.Equal(y)
 		}
+	case Version:
+		switch y := b.(type) {
+		case Version:
+			return x.Compare(y) >= 0
+		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T >= %T", a, b))
+	panic(Errorf("invalid operation: %T >= %T", a, b))
 }
 
 func Add(a, b interface{}) interface{} {
@@ -194,7 +220,7 @@ func Add(a, b interface{}) interface{} {
 			return y.Add(x)
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T + %T", a, b))
+	panic(Errorf("invalid operation: %T + %T", a, b))
 }
 
 func Subtract(a, b interface{}) interface{} {
@@ -206,27 +232,27 @@ func Subtract(a, b interface{}) interface{} {
 			return x.Sub(y)
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T - %T", a, b))
+	panic(Errorf("invalid operation: %T - %T", a, b))
 }
 
 func Multiply(a, b interface{}) interface{} {
 	switch x := a.(type) {
 	{{ cases "*" }}
 	}
-	panic(fmt.Sprintf("invalid operation: %T * %T", a, b))
+	panic(Errorf("invalid operation: %T * %T", a, b))
 }
 
 func Divide(a, b interface{}) float64 {
 	switch x := a.(type) {
 	{{ cases "/" }}
 	}
-	panic(fmt.Sprintf("invalid operation: %T / %T", a, b))
+	panic(Errorf("invalid operation: %T / %T", a, b))
 }
 
 func Modulo(a, b interface{}) int {
 	switch x := a.(type) {
 	{{ cases_int_only "%" }}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %% %T", a, b))
+	panic(Errorf("invalid operation: %T %% %T", a, b))
 }
 `
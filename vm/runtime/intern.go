@@ -0,0 +1,27 @@
+package runtime
+
+// Boxing of booleans, empty strings and integers 0..255 into interface{}
+// does not allocate, as Go uses static values for them. Other integers
+// are allocated on every push to the stack, so small integers, which are
+// common results of counters, lengths, indexes and arithmetic, are boxed
+// once.
+const (
+	minInterned = -128
+	maxInterned = 1023
+)
+
+var interned = func() []interface{} {
+	values := make([]interface{}, maxInterned-minInterned+1)
+	for i := range values {
+		values[i] = i + minInterned
+	}
+	return values
+}()
+
+// Int returns the boxed integer, without allocation for small integers.
+func Int(i int) interface{} {
+	if i >= minInterned && i <= maxInterned {
+		return interned[i-minInterned]
+	}
+	return i
+}
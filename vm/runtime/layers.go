@@ -0,0 +1,64 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Layers is an environment of environments, like request, session and
+// global ones, where variables of earlier layers override variables of
+// later layers. Layers are maps with string keys, structs and pointers to
+// structs. Types of variables are types of values of the first layer,
+// which has them, if Layers is passed to expr.Env.
+type Layers []interface{}
+
+// Fetch returns variable of the first layer, which has it.
+func (l Layers) Fetch(name string) (interface{}, error) {
+	for _, layer := range l {
+		if value, ok := lookup(layer, name); ok {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown name %v", name)
+}
+
+// lookup returns member of the layer by name, if any.
+func lookup(layer interface{}, name string) (interface{}, bool) {
+	v := reflect.ValueOf(layer)
+	if !v.IsValid() {
+		return nil, false
+	}
+	if v.NumMethod() > 0 {
+		if method := v.MethodByName(name); method.IsValid() {
+			return method.Interface(), true
+		}
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if value.IsValid() {
+			return value.Interface(), true
+		}
+	case reflect.Struct:
+		value := v.FieldByNameFunc(func(fieldName string) bool {
+			field, _ := v.Type().FieldByName(fieldName)
+			if field.Tag.Get("expr") == name {
+				return true
+			}
+			return fieldName == name
+		})
+		if value.IsValid() && value.CanInterface() {
+			return value.Interface(), true
+		}
+	}
+	return nil, false
+}
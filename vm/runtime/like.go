@@ -0,0 +1,41 @@
+package runtime
+
+import (
+	"regexp"
+	"strings"
+)
+
+// LikeRegexp returns the regular expression of the SQL pattern of the like
+// operator, where % matches any sequence of characters, _ matches any single
+// character, and \ escapes the next character. The whole string must match.
+func LikeRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			b.WriteString(`.*`)
+		case r == '_':
+			b.WriteString(`.`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		b.WriteString(`\\`)
+	}
+	b.WriteString(`$`)
+	return regexp.MustCompile(b.String())
+}
+
+// Like reports whether the string matches the SQL pattern of the like
+// operator.
+func Like(s, pattern string) bool {
+	return LikeRegexp(pattern).MatchString(s)
+}
@@ -0,0 +1,46 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// NullType returns type of values of nullable types of database/sql, like
+// string of sql.NullString. Values of such types are nil in expressions, if
+// they are not valid.
+func NullType(t reflect.Type) (reflect.Type, bool) {
+	if t == nil || t.Kind() != reflect.Struct || t.PkgPath() != "database/sql" ||
+		t.NumField() != 2 || t.Field(1).Name != "Valid" {
+		return nil, false
+	}
+	return t.Field(0).Type, true
+}
+
+// nullValue returns the value of the nullable type of database/sql, or nil.
+func nullValue(v reflect.Value) interface{} {
+	if !v.Field(1).Bool() {
+		return nil
+	}
+	return v.Field(0).Interface()
+}
+
+// parseNull returns the nullable type of database/sql, which is valid, if
+// the value of the expression is not nil.
+func parseNull(t reflect.Type, value interface{}) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	if IsNil(value) {
+		return out, nil
+	}
+	v := reflect.ValueOf(value)
+	field := t.Field(0).Type
+	switch {
+	case v.Type().AssignableTo(field):
+	case isNumberKind(v.Kind()) && isNumberKind(field.Kind()):
+		v = v.Convert(field)
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot use %T as %v", value, t)
+	}
+	out.Field(0).Set(v)
+	out.Field(1).SetBool(true)
+	return out, nil
+}
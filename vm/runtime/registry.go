@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Accessors are fields and methods of a struct type, which are read and
+// called without reflection. Accessors are generated by exprenvgen, and
+// registered in init functions of generated files.
+type Accessors struct {
+	// Fields read fields by paths, like "Address.City", from values of the
+	// type or pointers to it. Functions return false for values of other
+	// types and nil pointers on the path.
+	Fields map[string]func(from interface{}) (interface{}, bool)
+	// Methods call methods by names with arguments checked by the checker.
+	// Functions return false for receivers of other types.
+	Methods map[string]func(receiver interface{}, args []interface{}) (interface{}, bool)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[reflect.Type]*Accessors)
+)
+
+// Register registers accessors of the struct type t for programs compiled
+// after it.
+func Register(t reflect.Type, accessors *Accessors) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[t] = accessors
+}
+
+// registered returns accessors of the struct type t, or of the struct of
+// the pointer type t.
+func registered(t reflect.Type) *Accessors {
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[t]
+}
+
+// fieldFunc returns the registered accessor of the field of the path.
+func fieldFunc(t reflect.Type, path []string) func(interface{}) (interface{}, bool) {
+	if a := registered(t); a != nil {
+		return a.Fields[strings.Join(path, ".")]
+	}
+	return nil
+}
+
+// MethodCall is a call of a method with a registered accessor.
+type MethodCall struct {
+	Method
+	Args int
+	Call func(receiver interface{}, args []interface{}) (interface{}, bool)
+	// Env is set, if the receiver is the environment.
+	Env bool
+}
+
+// NewMethodCall returns the call of the method of receivers of the type t
+// with args arguments, or nil, if the method has no registered accessor.
+func NewMethodCall(t reflect.Type, method Method, args int) *MethodCall {
+	if a := registered(t); a != nil {
+		if call, ok := a.Methods[method.Name]; ok {
+			return &MethodCall{Method: method, Args: args, Call: call}
+		}
+	}
+	return nil
+}
@@ -3,21 +3,27 @@ package runtime
 //go:generate sh -c "go run ./helpers > ./generated.go"
 
 import (
-	"fmt"
 	"math"
 	"reflect"
+	"time"
 )
 
 func Fetch(from, i interface{}) interface{} {
+	if fetcher, ok := from.(Fetcher); ok {
+		if name, ok := i.(string); ok {
+			return FetchFrom(fetcher, name)
+		}
+	}
+
 	v := reflect.ValueOf(from)
 	kind := v.Kind()
 	if kind == reflect.Invalid {
-		panic(fmt.Sprintf("cannot fetch %v from %T", i, from))
+		panic(Errorf("cannot fetch %v from %T", i, from))
 	}
 
 	// Methods can be defined on any type.
-	if v.NumMethod() > 0 {
-		method := v.MethodByName(i.(string))
+	if name, ok := i.(string); ok && v.NumMethod() > 0 {
+		method := v.MethodByName(name)
 		if method.IsValid() {
 			return method.Interface()
 		}
@@ -40,12 +46,15 @@ func Fetch(from, i interface{}) interface{} {
 		}
 
 	case reflect.Map:
-		value := v.MapIndex(reflect.ValueOf(i))
+		key, ok := MapKey(i, v.Type().Key())
+		if !ok {
+			panic(Errorf("cannot use %T as key of %v", i, v.Type()))
+		}
+		value := v.MapIndex(key)
 		if value.IsValid() {
 			return value.Interface()
 		} else {
-			elem := reflect.TypeOf(from).Elem()
-			return reflect.Zero(elem).Interface()
+			return reflect.Zero(v.Type().Elem()).Interface()
 		}
 
 	case reflect.Struct:
@@ -61,15 +70,39 @@ func Fetch(from, i interface{}) interface{} {
 			return value.Interface()
 		}
 	}
-	panic(fmt.Sprintf("cannot fetch %v from %T", i, from))
+	panic(Errorf("cannot fetch %v from %T", i, from))
 }
 
 type Field struct {
-	Index []int
-	Path  []string
+	Index    []int
+	Path     []string
+	fetch    func(from interface{}) (interface{}, bool)
+	accessor *accessor
+}
+
+// NewField returns the field of the path of indexes, which is read without
+// reflection from values of the type t, a struct or a pointer to struct, by
+// the registered accessor of the type, or by offsets of fields.
+func NewField(t reflect.Type, index []int, path []string) *Field {
+	return &Field{
+		Index:    index,
+		Path:     path,
+		fetch:    fieldFunc(t, path),
+		accessor: newAccessor(t, index),
+	}
 }
 
 func FetchField(from interface{}, field *Field) interface{} {
+	if field.fetch != nil {
+		if value, ok := field.fetch(from); ok {
+			return value
+		}
+	}
+	if field.accessor != nil {
+		if value, ok := field.accessor.get(from); ok {
+			return value
+		}
+	}
 	v := reflect.ValueOf(from)
 	kind := v.Kind()
 	if kind != reflect.Invalid {
@@ -88,7 +121,7 @@ func FetchField(from interface{}, field *Field) interface{} {
 			return value.Interface()
 		}
 	}
-	panic(fmt.Sprintf("cannot get %v from %T", field.Path[0], from))
+	panic(Errorf("cannot get %v from %T", field.Path[0], from))
 }
 
 func fieldByIndex(v reflect.Value, field *Field) reflect.Value {
@@ -99,7 +132,11 @@ func fieldByIndex(v reflect.Value, field *Field) reflect.Value {
 		if i > 0 {
 			if v.Kind() == reflect.Ptr {
 				if v.IsNil() {
-					panic(fmt.Sprintf("cannot get %v from %v", field.Path[i], field.Path[i-1]))
+					if len(field.Path) != len(field.Index) {
+						// Path has no names of embedded structs.
+						panic(Errorf("cannot get %v from nil embedded %v", field.Path[len(field.Path)-1], v.Type()))
+					}
+					panic(Errorf("cannot get %v from %v", field.Path[i], field.Path[i-1]))
 				}
 				v = v.Elem()
 			}
@@ -109,22 +146,67 @@ func fieldByIndex(v reflect.Value, field *Field) reflect.Value {
 	return v
 }
 
+// Method describes a method to fetch. Index is -1 if the method must be looked
+// up by name, as for values of interface types.
 type Method struct {
 	Index int
 	Name  string
 }
 
+// ZeroDivision describes result of division and modulo by zero. If Error is
+// set, a runtime error occurs. If IEEE is set, result is +Inf, -Inf or NaN.
+// Otherwise result is Value.
+type ZeroDivision struct {
+	Error bool
+	IEEE  bool
+	Value interface{}
+}
+
+// NonFinite describes handling of NaN and infinities produced by arithmetic
+// and functions, and compared by comparisons. If Error is set, a runtime
+// error occurs. Otherwise results of programs, which are NaN or infinities,
+// are replaced by nil.
+type NonFinite struct {
+	Error bool
+}
+
+// ContextCall describes a call of a function, which first parameter is
+// context.Context, with Args arguments of the expression. The context of
+// the run is passed to the function, with the deadline after Timeout, if
+// Timeout is not zero.
+type ContextCall struct {
+	Name    string
+	Args    int
+	Timeout time.Duration
+}
+
+// Memo describes a memoized call of a function. Skip is offset of
+// instructions, which are skipped if the result is cached. Results of
+// shared nodes are cached by the memo itself, as names of shared nodes are
+// unique only in their programs.
+type Memo struct {
+	Name   string
+	Args   int
+	Skip   int
+	Shared bool
+}
+
 func FetchMethod(from interface{}, method *Method) interface{} {
 	v := reflect.ValueOf(from)
 	kind := v.Kind()
 	if kind != reflect.Invalid {
 		// Methods can be defined on any type, no need to dereference.
-		method := v.Method(method.Index)
-		if method.IsValid() {
-			return method.Interface()
+		var m reflect.Value
+		if method.Index < 0 {
+			m = v.MethodByName(method.Name)
+		} else {
+			m = v.Method(method.Index)
+		}
+		if m.IsValid() {
+			return m.Interface()
 		}
 	}
-	panic(fmt.Sprintf("cannot fetch %v from %T", method.Name, from))
+	panic(Errorf("cannot fetch %v from %T", method.Name, from))
 }
 
 func Deref(i interface{}) interface{} {
@@ -141,23 +223,36 @@ func Deref(i interface{}) interface{} {
 		v = v.Elem()
 	}
 
+	if c, ok := i.(ValueConverter); ok && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		return c.ToExprValue()
+	}
+
 	if v.Kind() == reflect.Ptr {
-		if v.IsNil() {
-			return i
-		}
-		indirect := reflect.Indirect(v)
-		switch indirect.Kind() {
+		switch v.Type().Elem().Kind() {
 		case reflect.Struct, reflect.Map, reflect.Array, reflect.Slice:
+			if v.IsNil() {
+				return i
+			}
 		default:
+			// Nil pointers to scalars are nil, like invalid sql.NullString.
+			if v.IsNil() {
+				return nil
+			}
 			v = v.Elem()
 		}
 	}
 
+	if v.Kind() == reflect.Struct {
+		if _, ok := NullType(v.Type()); ok {
+			return nullValue(v)
+		}
+	}
+
 	if v.IsValid() {
 		return v.Interface()
 	}
 
-	panic(fmt.Sprintf("cannot dereference %v", i))
+	panic(Errorf("cannot dereference %v", i))
 }
 
 func Slice(array, from, to interface{}) interface{} {
@@ -187,7 +282,52 @@ func Slice(array, from, to interface{}) interface{} {
 		}
 
 	}
-	panic(fmt.Sprintf("cannot slice %v", from))
+	panic(Errorf("cannot slice %v", from))
+}
+
+// MapKey converts the key to the type of keys of a map, if the key is of
+// another type of numbers or strings, like 1 to int64, or "a" to a named
+// string type, and reports whether the key is representable in the type.
+func MapKey(key interface{}, t reflect.Type) (reflect.Value, bool) {
+	k := reflect.ValueOf(key)
+	if !k.IsValid() {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Chan, reflect.Func, reflect.Map, reflect.Slice:
+			return reflect.Zero(t), true
+		}
+		return reflect.Value{}, false
+	}
+	if k.Type().AssignableTo(t) {
+		return k, true
+	}
+	switch {
+	case isNumberKind(k.Kind()) && isNumberKind(t.Kind()):
+		if isIntKind(k.Kind()) && k.Int() < 0 && isUintKind(t.Kind()) {
+			return reflect.Value{}, false
+		}
+		c := k.Convert(t)
+		// Keys, which are changed by conversion, like 1.5 to int, or 300 to
+		// uint8, are not representable.
+		if c.Convert(k.Type()).Interface() != k.Interface() {
+			return reflect.Value{}, false
+		}
+		return c, true
+	case k.Kind() == reflect.String && t.Kind() == reflect.String:
+		return k.Convert(t), true
+	}
+	return reflect.Value{}, false
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isIntKind(k) || isUintKind(k) || k == reflect.Float32 || k == reflect.Float64
 }
 
 func In(needle interface{}, array interface{}) bool {
@@ -210,9 +350,9 @@ func In(needle interface{}, array interface{}) bool {
 		return false
 
 	case reflect.Map:
-		n := reflect.ValueOf(needle)
-		if !n.IsValid() {
-			panic(fmt.Sprintf("cannot use %T as index to %T", needle, array))
+		n, ok := MapKey(needle, v.Type().Key())
+		if !ok {
+			panic(Errorf("cannot use %T as index to %T", needle, array))
 		}
 		value := v.MapIndex(n)
 		if value.IsValid() {
@@ -223,7 +363,7 @@ func In(needle interface{}, array interface{}) bool {
 	case reflect.Struct:
 		n := reflect.ValueOf(needle)
 		if !n.IsValid() || n.Kind() != reflect.String {
-			panic(fmt.Sprintf("cannot use %T as field name of %T", needle, array))
+			panic(Errorf("cannot use %T as field name of %T", needle, array))
 		}
 		value := v.FieldByName(n.String())
 		if value.IsValid() {
@@ -239,7 +379,7 @@ func In(needle interface{}, array interface{}) bool {
 		return false
 	}
 
-	panic(fmt.Sprintf(`operator "in"" not defined on %T`, array))
+	panic(Errorf(`operator "in"" not defined on %T`, array))
 }
 
 func Length(a interface{}) int {
@@ -248,7 +388,7 @@ func Length(a interface{}) int {
 	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
 		return v.Len()
 	default:
-		panic(fmt.Sprintf("invalid argument for len (type %T)", a))
+		panic(Errorf("invalid argument for len (type %T)", a))
 	}
 }
 
@@ -279,7 +419,7 @@ func Negate(i interface{}) interface{} {
 	case uint64:
 		return -v
 	default:
-		panic(fmt.Sprintf("invalid operation: - %T", v))
+		panic(Errorf("invalid operation: - %T", v))
 	}
 }
 
@@ -326,7 +466,7 @@ func ToInt(a interface{}) int {
 	case uint64:
 		return int(x)
 	default:
-		panic(fmt.Sprintf("invalid operation: int(%T)", x))
+		panic(Errorf("invalid operation: int(%T)", x))
 	}
 }
 
@@ -357,7 +497,7 @@ func ToInt64(a interface{}) int64 {
 	case uint64:
 		return int64(x)
 	default:
-		panic(fmt.Sprintf("invalid operation: int64(%T)", x))
+		panic(Errorf("invalid operation: int64(%T)", x))
 	}
 }
 
@@ -388,7 +528,7 @@ func ToFloat64(a interface{}) float64 {
 	case uint64:
 		return float64(x)
 	default:
-		panic(fmt.Sprintf("invalid operation: float64(%T)", x))
+		panic(Errorf("invalid operation: float64(%T)", x))
 	}
 }
 
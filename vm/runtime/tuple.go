@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"reflect"
+)
+
+// Tuple holds multiple values, like (a, b), or results of a function
+// returning a pair. Elements of tuples are accessed like elements of arrays,
+// or bound to variables by let (a, b) = tuple.
+type Tuple []interface{}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Results returns the result of a call of a function, or a tuple of
+// results, if the function returns many values. The last result of type
+// error of functions returning many values is returned as error.
+func Results(fn reflect.Type, out []reflect.Value) (interface{}, error) {
+	n := len(out)
+	if n > 1 && fn.Out(n-1) == errorType {
+		if !out[n-1].IsNil() {
+			return nil, out[n-1].Interface().(error)
+		}
+		n--
+	}
+	if n == 1 {
+		return out[0].Interface(), nil
+	}
+	tuple := make(Tuple, n)
+	for i := range tuple {
+		tuple[i] = out[i].Interface()
+	}
+	return tuple, nil
+}
+
+// Unpack returns elements of the tuple, or of the array, for n variables.
+func Unpack(value interface{}, n int) []interface{} {
+	if tuple, ok := value.(Tuple); ok {
+		if len(tuple) != n {
+			panic(Errorf("cannot unpack %v values into %v variables", len(tuple), n))
+		}
+		return tuple
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		panic(Errorf("cannot unpack %T into %v variables", value, n))
+	}
+	if v.Len() != n {
+		panic(Errorf("cannot unpack %v values into %v variables", v.Len(), n))
+	}
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version (https://semver.org). Versions support
+// comparison operators, build metadata is ignored in comparison.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+// ParseVersion parses semantic version. Leading "v" is allowed, and missing
+// minor and patch parts are treated as zeros.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	str := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		v.Build = str[i+1:]
+		str = str[:i]
+		if !validIdentifiers(v.Build) {
+			return Version{}, fmt.Errorf("invalid semantic version: %q", s)
+		}
+	}
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		v.Prerelease = str[i+1:]
+		str = str[:i]
+		if !validIdentifiers(v.Prerelease) {
+			return Version{}, fmt.Errorf("invalid semantic version: %q", s)
+		}
+	}
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid semantic version: %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part[0] == '+' || (len(part) > 1 && part[0] == '0') {
+			return Version{}, fmt.Errorf("invalid semantic version: %q", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+func validIdentifiers(s string) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Compare returns -1, 0 or +1 depending on whether v is less than, equal to,
+// or greater than other.
+func (v Version) Compare(other Version) int {
+	if c := compareInt(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	a := strings.Split(v.Prerelease, ".")
+	b := strings.Split(other.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(a), len(b))
+}
+
+func compareIdentifier(a, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInt(x, y)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
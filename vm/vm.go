@@ -3,12 +3,22 @@ package vm
 //go:generate sh -c "go run ./func_types > ./generated.go"
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/antonmedv/expr/audit"
+	"github.com/antonmedv/expr/builtin"
 	"github.com/antonmedv/expr/file"
+	"github.com/antonmedv/expr/metrics"
+	"github.com/antonmedv/expr/tracing"
 	"github.com/antonmedv/expr/vm/runtime"
 )
 
@@ -16,6 +26,8 @@ var (
 	MemoryBudget int = 1e6
 )
 
+var intType = reflect.TypeOf(0)
+
 func Run(program *Program, env interface{}) (interface{}, error) {
 	if program == nil {
 		return nil, fmt.Errorf("program is nil")
@@ -32,15 +44,59 @@ type VM struct {
 	debug        bool
 	step         chan struct{}
 	curr         chan int
+	trace        func(ip int)
 	memory       int
 	memoryBudget int
+	handlers     []handler
+	memo         map[memoKey]interface{}
+	memoCalls    []memoCall // memoized calls in progress
+	fetcher      runtime.Fetcher
+	fetched      map[string]interface{}
+	variables    []interface{} // variables of folds
+	batch        bool          // memo and fetched are shared by runs
+	tracking     bool          // taints of sensitive values are tracked
+	taints       []bool        // taints of values of the stack
+	taint        bool          // taint of values popped since the last push
+	varTaints    []bool        // taints of variables
+	tainted      bool          // taint of the result of the last run
+	ctx          context.Context
+	tracer       tracing.Tracer           // tracer of calls of the run, if traced
+	rand         builtin.Rand             // source of random numbers, if injected
+	decoded      map[rawKey]interface{}   // json.RawMessage values decoded during the run
+	used         [maxOperands]interface{} // values popped or peeked by the current operation
+	uses         int                      // number of values used by the current operation
+}
+
+// maxOperands is the number of values of the stack, which are recorded as
+// operands of the current operation for runtime errors.
+const maxOperands = 8
+
+// rawKey identifies json.RawMessage by its bytes, so copies of the same
+// message are decoded once.
+type rawKey struct {
+	data *byte
+	len  int
+}
+
+// handler describes state of VM to restore, if runtime error occurs in
+// the first argument of try.
+type handler struct {
+	catch     int
+	stack     int
+	scopes    int
+	memoCalls int
+	calls     bool // only errors of calls with context are caught
 }
 
 type Scope struct {
-	Array reflect.Value
-	It    int
-	Len   int
-	Count int
+	Array    reflect.Value
+	It       int
+	Len      int
+	Count    int
+	Acc      interface{} // accumulator of reduce
+	Location file.Location
+	taint    bool // taint of the array
+	accTaint bool // taint of the accumulator
 }
 
 func Debug() *VM {
@@ -52,18 +108,74 @@ func Debug() *VM {
 	return vm
 }
 
+// Batch returns VM, which shares results of memoized functions and
+// variables of lazy environments between runs, so programs run with the
+// same environment compute them once.
+func Batch() *VM {
+	return &VM{batch: true}
+}
+
+// Trace returns VM, which calls fn with position in bytecode of every
+// instruction before its execution.
+func Trace(fn func(ip int)) *VM {
+	return &VM{debug: true, trace: fn}
+}
+
+// SetRand sets the source of random numbers of builtins, like sample, for
+// following runs, so their results are reproducible. Without the source,
+// builtins use the source seeded from crypto/rand.
+func (vm *VM) SetRand(r builtin.Rand) {
+	vm.rand = r
+}
+
 func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+
+	vm.tainted = false
+	if program.Metrics != nil {
+		start := time.Now()
+		defer func() {
+			report(program.Metrics, time.Since(start), err)
+		}()
+	}
+	if program.Audit != nil {
+		start := time.Now()
+		defer func() {
+			vm.audit(program, env, start, out, err)
+		}()
+	}
+	if program.Tracing != nil {
+		end := vm.startRun(program.Tracing)
+		defer func() {
+			end(env, out, err)
+		}()
+	}
+
+	fetcher, lazy := env.(runtime.Fetcher)
+	if program.Cache != nil && !vm.debug && !lazy && !program.Sensitive {
+		if key, ok := cacheKey(env); ok {
+			if out, ok := program.Cache.get(key); ok {
+				return out, nil
+			}
+			defer func() {
+				if err == nil {
+					program.Cache.add(key, out)
+				}
+			}()
+		}
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
-			f := &file.Error{
-				Location: program.Locations[vm.ip-1],
-				Message:  fmt.Sprintf("%v", r),
-			}
-			err = f.Bind(program.Source)
+			err = vm.runtimeError(program, r)
 		}
 	}()
 
-	if vm.stack == nil {
+	if cap(vm.stack) < program.MaxStack {
+		vm.stack = make([]interface{}, 0, program.MaxStack)
+	} else if vm.stack == nil {
 		vm.stack = make([]interface{}, 0, 2)
 	} else {
 		vm.stack = vm.stack[0:0]
@@ -76,15 +188,87 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 	vm.memoryBudget = MemoryBudget
 	vm.memory = 0
 	vm.ip = 0
+	vm.handlers = vm.handlers[0:0]
+	vm.memoCalls = vm.memoCalls[0:0]
+	if !vm.batch {
+		for key := range vm.memo {
+			delete(vm.memo, key)
+		}
+		for key := range vm.fetched {
+			delete(vm.fetched, key)
+		}
+	}
+	for key := range vm.decoded {
+		delete(vm.decoded, key)
+	}
+	vm.fetcher = fetcher
+	vm.tracking = program.Sensitive
+	vm.taints = vm.taints[0:0]
+	vm.taint = false
+	vm.varTaints = vm.varTaints[0:0]
+
+	for !vm.execute(program, env) {
+		// Runtime error was caught, continue with fallback of try.
+	}
+
+	if vm.debug && vm.trace == nil {
+		close(vm.curr)
+		close(vm.step)
+	}
+
+	if len(vm.stack) > 0 {
+		if vm.tracking {
+			vm.tainted = vm.taints[len(vm.taints)-1]
+		}
+		return vm.pop(), nil
+	}
+
+	return nil, nil
+}
+
+// execute runs program until the end, or until runtime error is caught by
+// try, in which case false is returned.
+func (vm *VM) execute(program *Program, env interface{}) (done bool) {
+	defer func() {
+		if done || len(vm.handlers) == 0 {
+			return
+		}
+		if r := recover(); r != nil {
+			if vm.isLimit(r) {
+				// Limits of runs are not caught by expressions.
+				panic(r)
+			}
+			h := vm.handlers[len(vm.handlers)-1]
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			// Fallback catches only errors of calls with context, and
+			// leaves other errors to outer handlers.
+			for h.calls && !isCallError(r) {
+				if len(vm.handlers) == 0 {
+					panic(r)
+				}
+				h = vm.handlers[len(vm.handlers)-1]
+				vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			}
+			vm.drop(len(vm.stack) - h.stack)
+			vm.scopes = vm.scopes[:h.scopes]
+			vm.memoCalls = vm.memoCalls[:h.memoCalls]
+			vm.ip = h.catch
+		}
+	}()
 
 	for vm.ip < len(program.Bytecode) {
 		if vm.debug {
-			<-vm.step
+			if vm.trace != nil {
+				vm.trace(vm.ip)
+			} else {
+				<-vm.step
+			}
 		}
 
 		op := program.Bytecode[vm.ip]
 		arg := program.Arguments[vm.ip]
 		vm.ip += 1
+		vm.uses = 0
 
 		switch op {
 
@@ -95,22 +279,39 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			vm.pop()
 
 		case OpRot:
-			b := vm.pop()
-			a := vm.pop()
-			vm.push(b)
-			vm.push(a)
+			n := len(vm.stack)
+			vm.stack[n-1], vm.stack[n-2] = vm.stack[n-2], vm.stack[n-1]
+			if vm.tracking {
+				vm.taints[n-1], vm.taints[n-2] = vm.taints[n-2], vm.taints[n-1]
+			}
 
 		case OpLoadConst:
-			vm.push(runtime.Fetch(env, program.Constants[arg]))
+			if vm.fetcher != nil {
+				vm.push(vm.fetch(program.Constants[arg].(string)))
+			} else {
+				vm.push(runtime.Fetch(env, program.Constants[arg]))
+			}
 
 		case OpLoadField:
-			vm.push(runtime.FetchField(env, program.Constants[arg].(*runtime.Field)))
+			if vm.fetcher != nil {
+				vm.push(vm.fetchField(program.Constants[arg].(*runtime.Field)))
+			} else {
+				vm.push(runtime.FetchField(env, program.Constants[arg].(*runtime.Field)))
+			}
 
 		case OpLoadFast:
-			vm.push(env.(map[string]interface{})[program.Constants[arg].(string)])
+			if vm.fetcher != nil {
+				vm.push(vm.fetch(program.Constants[arg].(string)))
+			} else {
+				vm.push(env.(map[string]interface{})[program.Constants[arg].(string)])
+			}
 
 		case OpLoadMethod:
-			vm.push(runtime.FetchMethod(env, program.Constants[arg].(*runtime.Method)))
+			if vm.fetcher != nil {
+				vm.push(vm.fetch(program.Constants[arg].(*runtime.Method).Name))
+			} else {
+				vm.push(runtime.FetchMethod(env, program.Constants[arg].(*runtime.Method)))
+			}
 
 		case OpFetch:
 			b := vm.pop()
@@ -147,31 +348,62 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			a := vm.pop()
 			vm.push(runtime.Equal(a, b))
 
+		// Typed operations are emitted for operands of types known by the
+		// checker. Values of other types, like values of named types, are
+		// passed to generic helpers.
 		case OpEqualInt:
 			b := vm.pop()
 			a := vm.pop()
-			vm.push(a.(int) == b.(int))
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(x == y)
+			} else {
+				vm.push(runtime.Equal(a, b))
+			}
 
 		case OpEqualString:
 			b := vm.pop()
 			a := vm.pop()
-			vm.push(a.(string) == b.(string))
+			x, ok := a.(string)
+			y, ok2 := b.(string)
+			if ok && ok2 {
+				vm.push(x == y)
+			} else {
+				vm.push(runtime.Equal(a, b))
+			}
+
+		case OpEqualFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x == y)
+			} else {
+				vm.push(runtime.Equal(a, b))
+			}
 
 		case OpJump:
 			vm.ip += arg
 
 		case OpJumpIfTrue:
-			if vm.current().(bool) {
+			if vm.peek().(bool) {
 				vm.ip += arg
 			}
 
 		case OpJumpIfFalse:
-			if !vm.current().(bool) {
+			if !vm.peek().(bool) {
 				vm.ip += arg
 			}
 
 		case OpJumpIfNil:
-			if runtime.IsNil(vm.current()) {
+			if runtime.IsNil(vm.peek()) {
+				vm.ip += arg
+			}
+
+		case OpJumpIfNotNil:
+			if !runtime.IsNil(vm.peek()) {
 				vm.ip += arg
 			}
 
@@ -232,7 +464,7 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 		case OpModulo:
 			b := vm.pop()
 			a := vm.pop()
-			vm.push(runtime.Modulo(a, b))
+			vm.push(runtime.Int(runtime.Modulo(a, b)))
 
 		case OpExponent:
 			b := vm.pop()
@@ -246,7 +478,7 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			max := runtime.ToInt(b)
 			size := max - min + 1
 			if vm.memory+size >= vm.memoryBudget {
-				panic("memory budget exceeded")
+				panic(ErrMemoryBudget)
 			}
 			vm.push(runtime.MakeRange(min, max))
 			vm.memory += size
@@ -266,6 +498,24 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			r := program.Constants[arg].(*regexp.Regexp)
 			vm.push(r.MatchString(a.(string)))
 
+		case OpBroadcast:
+			b := program.Constants[arg].(*runtime.Broadcast)
+			operands := make([]interface{}, b.Operands)
+			for i := b.Operands - 1; i >= 0; i-- {
+				operands[i] = vm.pop()
+			}
+			out := b.Run(operands)
+			vm.memory += len(out)
+			if vm.memory >= vm.memoryBudget {
+				panic(ErrMemoryBudget)
+			}
+			vm.push(out)
+
+		case OpLike:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.Like(a.(string), b.(string)))
+
 		case OpContains:
 			b := vm.pop()
 			a := vm.pop()
@@ -288,12 +538,18 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			vm.push(runtime.Slice(node, from, to))
 
 		case OpCall:
-			fn := reflect.ValueOf(vm.pop())
+			fn := reflect.ValueOf(vm.take())
 			size := arg
 			in := make([]reflect.Value, size)
 			for i := int(size) - 1; i >= 0; i-- {
 				param := vm.pop()
-				if param == nil && reflect.TypeOf(param) == nil {
+				if t := paramType(fn.Type(), i); runtime.IsParser(t) {
+					p, err := runtime.Parse(t, param)
+					if err != nil {
+						panic(err)
+					}
+					in[i] = p
+				} else if param == nil && reflect.TypeOf(param) == nil {
 					// In case of nil value and nil type use this hack,
 					// otherwise reflect.Call will panic on zero value.
 					in[i] = reflect.ValueOf(&param).Elem()
@@ -301,14 +557,14 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 					in[i] = reflect.ValueOf(param)
 				}
 			}
-			out := fn.Call(in)
-			if len(out) == 2 && !runtime.IsNil(out[1]) {
-				panic(out[1].Interface().(error))
+			out, err := runtime.Results(fn.Type(), fn.Call(in))
+			if err != nil {
+				panic(err)
 			}
-			vm.push(out[0].Interface())
+			vm.push(out)
 
 		case OpCallFast:
-			fn := vm.pop().(func(...interface{}) interface{})
+			fn := vm.take().(func(...interface{}) interface{})
 			size := arg
 			in := make([]interface{}, size)
 			for i := int(size) - 1; i >= 0; i-- {
@@ -317,12 +573,37 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			vm.push(fn(in...))
 
 		case OpCallTyped:
-			fn := vm.pop()
+			fn := vm.take()
 			out := vm.call(fn, arg)
 			vm.push(out)
 
+		case OpCallBuiltin:
+			fn := program.Constants[arg].(*builtin.Function)
+			size := vm.take().(int)
+			in := make([]interface{}, size)
+			for i := size - 1; i >= 0; i-- {
+				in[i] = vm.pop()
+			}
+			if fn.Cost != nil {
+				vm.memory += fn.Cost(in)
+				if vm.memory >= vm.memoryBudget {
+					panic(ErrMemoryBudget)
+				}
+			}
+			var out interface{}
+			var err error
+			if fn.Random != nil && vm.rand != nil {
+				out, err = fn.Random(vm.rand, in...)
+			} else {
+				out, err = fn.Func(in...)
+			}
+			if err != nil {
+				panic(err)
+			}
+			vm.push(out)
+
 		case OpArray:
-			size := vm.pop().(int)
+			size := vm.take().(int)
 			array := make([]interface{}, size)
 			for i := size - 1; i >= 0; i-- {
 				array[i] = vm.pop()
@@ -330,11 +611,11 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			vm.push(array)
 			vm.memory += size
 			if vm.memory >= vm.memoryBudget {
-				panic("memory budget exceeded")
+				panic(ErrMemoryBudget)
 			}
 
 		case OpMap:
-			size := vm.pop().(int)
+			size := vm.take().(int)
 			m := make(map[string]interface{})
 			for i := size - 1; i >= 0; i-- {
 				value := vm.pop()
@@ -344,11 +625,11 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 			vm.push(m)
 			vm.memory += size
 			if vm.memory >= vm.memoryBudget {
-				panic("memory budget exceeded")
+				panic(ErrMemoryBudget)
 			}
 
 		case OpLen:
-			vm.push(runtime.Length(vm.current()))
+			vm.push(runtime.Int(runtime.Length(vm.peek())))
 
 		case OpCast:
 			t := arg
@@ -363,7 +644,14 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 
 		case OpDeref:
 			a := vm.pop()
-			vm.push(runtime.Deref(a))
+			if program.Converters != nil {
+				a = program.Converters.Convert(a)
+			}
+			if raw, ok := a.(json.RawMessage); ok {
+				vm.push(vm.decode(raw))
+			} else {
+				vm.push(runtime.Deref(a))
+			}
 
 		case OpIncrementIt:
 			scope := vm.Scope()
@@ -375,66 +663,825 @@ func (vm *VM) Run(program *Program, env interface{}) (out interface{}, err error
 
 		case OpGetCount:
 			scope := vm.Scope()
-			vm.push(scope.Count)
+			vm.push(runtime.Int(scope.Count))
 
 		case OpGetLen:
 			scope := vm.Scope()
-			vm.push(scope.Len)
+			vm.push(runtime.Int(scope.Len))
 
 		case OpPointer:
 			scope := vm.Scope()
-			vm.push(scope.Array.Index(scope.It).Interface())
+			vm.taint = vm.taint || scope.taint
+			item := scope.Array.Index(scope.It)
+			if item.Kind() == reflect.Int && item.Type() == intType {
+				vm.push(runtime.Int(int(item.Int())))
+			} else {
+				vm.push(item.Interface())
+			}
+
+		case OpTuple:
+			tuple := make(runtime.Tuple, arg)
+			for i := arg - 1; i >= 0; i-- {
+				tuple[i] = vm.pop()
+			}
+			vm.push(tuple)
+
+		case OpUnpack:
+			values := runtime.Unpack(vm.pop(), arg)
+			taint := vm.taint
+			for _, value := range values {
+				vm.taint = taint
+				vm.push(value)
+			}
+
+		case OpConcat:
+			parts := vm.stack[len(vm.stack)-arg:]
+			size := 0
+			concat := true
+			for i, part := range parts {
+				s, ok := part.(string)
+				if !ok {
+					// Strings of named types, like type Name string.
+					v := reflect.ValueOf(part)
+					if v.Kind() != reflect.String {
+						concat = false
+						break
+					}
+					s = v.String()
+					parts[i] = s
+				}
+				size += len(s)
+			}
+			if !concat {
+				// Types of operands are known to be strings only by
+				// approximation, like of a ternary with an interface{}
+				// branch, so operands are added one by one.
+				sum := parts[0]
+				for _, part := range parts[1:] {
+					sum = runtime.Add(sum, part)
+				}
+				vm.drop(arg)
+				vm.push(sum)
+				break
+			}
+			var b strings.Builder
+			b.Grow(size)
+			for _, part := range parts {
+				b.WriteString(part.(string))
+			}
+			vm.drop(arg)
+			vm.push(b.String())
+
+		case OpGetIndex:
+			vm.push(runtime.Int(vm.Scope().It))
+
+		case OpSetAcc:
+			scope := vm.Scope()
+			scope.Acc = vm.pop()
+			scope.accTaint, vm.taint = vm.taint, false
+
+		case OpGetAcc:
+			scope := vm.Scope()
+			vm.taint = vm.taint || scope.accTaint
+			vm.push(scope.Acc)
 
 		case OpBegin:
 			a := vm.pop()
 			array := reflect.ValueOf(a)
 			vm.scopes = append(vm.scopes, &Scope{
-				Array: array,
-				Len:   array.Len(),
+				Array:    array,
+				Len:      array.Len(),
+				Location: program.Locations[vm.ip-1],
+				taint:    vm.taint,
 			})
 
+		case OpTry:
+			vm.handlers = append(vm.handlers, handler{
+				catch:     vm.ip + arg,
+				stack:     len(vm.stack),
+				scopes:    len(vm.scopes),
+				memoCalls: len(vm.memoCalls),
+			})
+
+		case OpFallback:
+			vm.handlers = append(vm.handlers, handler{
+				catch:     vm.ip + arg,
+				stack:     len(vm.stack),
+				scopes:    len(vm.scopes),
+				memoCalls: len(vm.memoCalls),
+				calls:     true,
+			})
+
+		case OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			vm.ip += arg
+
+		case OpMemo:
+			memo := program.Constants[arg].(*runtime.Memo)
+			var call memoCall
+			if memo.Shared {
+				call = memoCall{key: memoKey{name: memo.Name, n: 1, args: [4]interface{}{memo}}, ok: true}
+			} else {
+				call.key, call.ok = newMemoKey(memo.Name, vm.stack[len(vm.stack)-memo.Args:])
+			}
+			if out, ok := vm.memo[call.key]; ok && call.ok {
+				vm.drop(memo.Args)
+				vm.push(out)
+				vm.ip += memo.Skip
+			} else {
+				vm.memoCalls = append(vm.memoCalls, call)
+			}
+
+		case OpMemoStore:
+			call := vm.memoCalls[len(vm.memoCalls)-1]
+			vm.memoCalls = vm.memoCalls[:len(vm.memoCalls)-1]
+			if call.ok {
+				if vm.memo == nil {
+					vm.memo = make(map[memoKey]interface{})
+				}
+				vm.memo[call.key] = vm.current()
+			}
+
+		case OpCheckZero:
+			if isZero(vm.current()) {
+				b := vm.pop()
+				a := vm.pop()
+				vm.push(zeroDivision(program.Constants[arg].(*runtime.ZeroDivision), program.Bytecode[vm.ip], a, b))
+				vm.ip++ // Skip division.
+			}
+
+		case OpLoadVar:
+			if vm.tracking && arg < len(vm.varTaints) {
+				vm.taint = vm.taint || vm.varTaints[arg]
+			}
+			vm.push(vm.variables[arg])
+
+		case OpStoreVar:
+			for arg >= len(vm.variables) {
+				vm.variables = append(vm.variables, nil)
+			}
+			vm.variables[arg] = vm.pop()
+			if vm.tracking {
+				for arg >= len(vm.varTaints) {
+					vm.varTaints = append(vm.varTaints, false)
+				}
+				vm.varTaints[arg], vm.taint = vm.taint, false
+			}
+
+		case OpLessInt:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(x < y)
+			} else {
+				vm.push(runtime.Less(a, b))
+			}
+
+		case OpLessFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x < y)
+			} else {
+				vm.push(runtime.Less(a, b))
+			}
+
+		case OpLessString:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(string)
+			y, ok2 := b.(string)
+			if ok && ok2 {
+				vm.push(x < y)
+			} else {
+				vm.push(runtime.Less(a, b))
+			}
+
+		case OpMoreInt:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(x > y)
+			} else {
+				vm.push(runtime.More(a, b))
+			}
+
+		case OpMoreFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x > y)
+			} else {
+				vm.push(runtime.More(a, b))
+			}
+
+		case OpMoreString:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(string)
+			y, ok2 := b.(string)
+			if ok && ok2 {
+				vm.push(x > y)
+			} else {
+				vm.push(runtime.More(a, b))
+			}
+
+		case OpLessOrEqualInt:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(x <= y)
+			} else {
+				vm.push(runtime.LessOrEqual(a, b))
+			}
+
+		case OpLessOrEqualFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x <= y)
+			} else {
+				vm.push(runtime.LessOrEqual(a, b))
+			}
+
+		case OpLessOrEqualString:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(string)
+			y, ok2 := b.(string)
+			if ok && ok2 {
+				vm.push(x <= y)
+			} else {
+				vm.push(runtime.LessOrEqual(a, b))
+			}
+
+		case OpMoreOrEqualInt:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(x >= y)
+			} else {
+				vm.push(runtime.MoreOrEqual(a, b))
+			}
+
+		case OpMoreOrEqualFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x >= y)
+			} else {
+				vm.push(runtime.MoreOrEqual(a, b))
+			}
+
+		case OpMoreOrEqualString:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(string)
+			y, ok2 := b.(string)
+			if ok && ok2 {
+				vm.push(x >= y)
+			} else {
+				vm.push(runtime.MoreOrEqual(a, b))
+			}
+
+		case OpAddInt:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(runtime.Int(x + y))
+			} else {
+				vm.push(runtime.Add(a, b))
+			}
+
+		case OpAddFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x + y)
+			} else {
+				vm.push(runtime.Add(a, b))
+			}
+
+		case OpAddString:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(string)
+			y, ok2 := b.(string)
+			if ok && ok2 {
+				vm.push(x + y)
+			} else {
+				vm.push(runtime.Add(a, b))
+			}
+
+		case OpSubtractInt:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(runtime.Int(x - y))
+			} else {
+				vm.push(runtime.Subtract(a, b))
+			}
+
+		case OpSubtractFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x - y)
+			} else {
+				vm.push(runtime.Subtract(a, b))
+			}
+
+		case OpMultiplyInt:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(int)
+			y, ok2 := b.(int)
+			if ok && ok2 {
+				vm.push(runtime.Int(x * y))
+			} else {
+				vm.push(runtime.Multiply(a, b))
+			}
+
+		case OpMultiplyFloat:
+			b := vm.pop()
+			a := vm.pop()
+			x, ok := a.(float64)
+			y, ok2 := b.(float64)
+			if ok && ok2 {
+				vm.push(x * y)
+			} else {
+				vm.push(runtime.Multiply(a, b))
+			}
+
+		case OpLoadEnv:
+			vm.push(env)
+
+		case OpCallMethod:
+			call := program.Constants[arg].(*runtime.MethodCall)
+			receiver := vm.pop()
+			in := make([]interface{}, call.Args)
+			for i := call.Args - 1; i >= 0; i-- {
+				in[i] = vm.pop()
+			}
+			if call.Env && vm.fetcher != nil {
+				vm.push(vm.callMethod(receiver, call, in))
+			} else if out, ok := call.Call(receiver, in); ok {
+				vm.push(out)
+			} else {
+				vm.push(vm.callMethod(receiver, call, in))
+			}
+
+		case OpEqualApprox:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(program.Constants[arg].(*runtime.FloatEqual).Equal(a, b))
+
+		case OpCheckFinite:
+			if !runtime.IsFinite(vm.peek()) {
+				if program.Constants[arg].(*runtime.NonFinite).Error {
+					panic(fmt.Sprintf("non-finite number %v", vm.current()))
+				}
+				vm.pop()
+				vm.push(nil)
+			}
+
+		case OpCallContext:
+			call := program.Constants[arg].(*runtime.ContextCall)
+			fn := reflect.ValueOf(vm.take())
+			in := make([]reflect.Value, call.Args+1)
+			for i := call.Args; i > 0; i-- {
+				param := vm.pop()
+				if param == nil {
+					in[i] = reflect.ValueOf(&param).Elem()
+				} else {
+					in[i] = reflect.ValueOf(param)
+				}
+			}
+			vm.push(vm.callContext(fn, in, call))
+
+		case OpTaint:
+			if vm.tracking {
+				vm.taints[len(vm.taints)-1] = true
+			}
+
 		case OpEnd:
 			vm.scopes = vm.scopes[:len(vm.scopes)-1]
 
 		default:
-			panic(fmt.Sprintf("unknown bytecode %#x", op))
+			panic(runtime.Errorf("unknown bytecode %#x", op))
 		}
 
-		if vm.debug {
+		if vm.debug && vm.trace == nil {
 			vm.curr <- vm.ip
 		}
 	}
 
-	if vm.debug {
-		close(vm.curr)
-		close(vm.step)
+	return true
+}
+
+func isZero(v interface{}) bool {
+	switch x := v.(type) {
+	case int:
+		return x == 0
+	case int8:
+		return x == 0
+	case int16:
+		return x == 0
+	case int32:
+		return x == 0
+	case int64:
+		return x == 0
+	case uint:
+		return x == 0
+	case uint8:
+		return x == 0
+	case uint16:
+		return x == 0
+	case uint32:
+		return x == 0
+	case uint64:
+		return x == 0
+	case float32:
+		return x == 0
+	case float64:
+		return x == 0
 	}
+	return false
+}
 
-	if len(vm.stack) > 0 {
-		return vm.pop(), nil
+// zeroDivision returns result of division (or modulo) of a by zero.
+func zeroDivision(zd *runtime.ZeroDivision, op Opcode, a, b interface{}) interface{} {
+	switch {
+	case zd.Error:
+		panic("division by zero")
+	case zd.IEEE:
+		if op == OpModulo {
+			return math.NaN()
+		}
+		return runtime.ToFloat64(a) / runtime.ToFloat64(b)
 	}
+	return zd.Value
+}
 
-	return nil, nil
+// memoKey identifies call of a memoized function.
+type memoKey struct {
+	name string
+	n    int
+	args [4]interface{}
+}
+
+// memoCall is a memoized call in progress, which result is stored by
+// OpMemoStore, if its key is ok.
+type memoCall struct {
+	key memoKey
+	ok  bool
+}
+
+// newMemoKey returns key of a call, if arguments can be used as a map key.
+func newMemoKey(name string, args []interface{}) (memoKey, bool) {
+	key := memoKey{name: name, n: len(args)}
+	if len(args) > len(key.args) {
+		return key, false
+	}
+	for i, arg := range args {
+		if arg != nil && !hashable(reflect.TypeOf(arg)) {
+			return key, false
+		}
+		key.args[i] = arg
+	}
+	return key, true
+}
+
+// hashable reports whether values of type t can be used as a map key
+// without a panic.
+func hashable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return false
+	case reflect.Array:
+		return hashable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !hashable(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return t.Comparable()
+}
+
+// callMethod calls the method with reflection, if the accessor of the
+// method does not accept the receiver, like a value of another type than the
+// type of compilation.
+func (vm *VM) callMethod(receiver interface{}, call *runtime.MethodCall, args []interface{}) interface{} {
+	var fn reflect.Value
+	if call.Env && vm.fetcher != nil {
+		fn = reflect.ValueOf(vm.fetch(call.Name))
+	} else {
+		fn = reflect.ValueOf(runtime.FetchMethod(receiver, &call.Method))
+	}
+	in := make([]reflect.Value, len(args))
+	for i := range args {
+		if args[i] == nil {
+			in[i] = reflect.ValueOf(&args[i]).Elem()
+		} else {
+			in[i] = reflect.ValueOf(args[i])
+		}
+	}
+	out, err := runtime.Results(fn.Type(), fn.Call(in))
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// decode returns the value of the raw JSON, which is decoded on first
+// access during the run. Empty messages are nil.
+func (vm *VM) decode(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	key := rawKey{&raw[0], len(raw)}
+	if value, ok := vm.decoded[key]; ok {
+		return value
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		panic(fmt.Errorf("cannot decode json.RawMessage: %w", err))
+	}
+	if vm.decoded == nil {
+		vm.decoded = make(map[rawKey]interface{})
+	}
+	vm.decoded[key] = value
+	return value
+}
+
+// fetch returns variable of the lazy environment, which is fetched on
+// first use.
+func (vm *VM) fetch(name string) interface{} {
+	if value, ok := vm.fetched[name]; ok {
+		return value
+	}
+	value := runtime.FetchFrom(vm.fetcher, name)
+	if vm.fetched == nil {
+		vm.fetched = make(map[string]interface{})
+	}
+	vm.fetched[name] = value
+	return value
+}
+
+// fetchField returns field of the lazy environment by its path. Fields are
+// fetched by names, as values of the environment may have other types than
+// types of compilation.
+func (vm *VM) fetchField(field *runtime.Field) interface{} {
+	if len(field.Path) == 1 {
+		return vm.fetch(field.Path[0])
+	}
+	path := strings.Join(field.Path, ".")
+	if fetcher, ok := vm.fetcher.(runtime.FieldFetcher); ok {
+		// Names of variables have no dots, so paths do not collide with
+		// names in fetched.
+		if value, ok := vm.fetched[path]; ok {
+			return value
+		}
+		value, err := fetcher.FetchField(path)
+		if err != nil {
+			panic(err)
+		}
+		if vm.fetched == nil {
+			vm.fetched = make(map[string]interface{})
+		}
+		vm.fetched[path] = value
+		return value
+	}
+	value := vm.fetch(field.Path[0])
+	for _, name := range field.Path[1:] {
+		value = runtime.Fetch(value, name)
+	}
+	return value
 }
 
 func (vm *VM) push(value interface{}) {
 	vm.stack = append(vm.stack, value)
+	if vm.tracking {
+		vm.taints = append(vm.taints, vm.taint)
+		vm.taint = false
+	}
 }
 
 func (vm *VM) current() interface{} {
 	return vm.stack[len(vm.stack)-1]
 }
 
+// peek returns the value at the top of the stack, and records it as an
+// operand of the current operation, like pop.
+func (vm *VM) peek() interface{} {
+	value := vm.stack[len(vm.stack)-1]
+	vm.use(value)
+	return value
+}
+
 func (vm *VM) pop() interface{} {
 	value := vm.stack[len(vm.stack)-1]
 	vm.stack = vm.stack[:len(vm.stack)-1]
+	vm.use(value)
+	if vm.tracking {
+		vm.taint = vm.taint || vm.taints[len(vm.taints)-1]
+		vm.taints = vm.taints[:len(vm.taints)-1]
+	}
 	return value
 }
 
+// use records the value as an operand of the current operation.
+func (vm *VM) use(value interface{}) {
+	if vm.uses < maxOperands {
+		vm.used[vm.uses] = value
+	}
+	vm.uses++
+}
+
+// take pops a value, which is not an operand of the operation, like
+// functions of calls or sizes of arrays and arguments.
+func (vm *VM) take() interface{} {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	if vm.tracking {
+		vm.taint = vm.taint || vm.taints[len(vm.taints)-1]
+		vm.taints = vm.taints[:len(vm.taints)-1]
+	}
+	return value
+}
+
+// RunContext runs the program, and passes the context to functions, which
+// first parameter is context.Context.
+func (vm *VM) RunContext(ctx context.Context, program *Program, env interface{}) (interface{}, error) {
+	vm.ctx = ctx
+	defer func() {
+		vm.ctx = nil
+	}()
+	return vm.Run(program, env)
+}
+
+// callError is an error of a call with context: an error returned by the
+// function, or an error of the context, like an exceeded deadline.
+type callError struct {
+	err error
+}
+
+func (e *callError) Error() string {
+	return e.err.Error()
+}
+
+func (e *callError) Unwrap() error {
+	return e.err
+}
+
+// isLimit reports whether the panic is caused by exceeded limits of the run:
+// the memory budget, or the deadline of the context of the run. Timeouts of
+// calls of functions, and cancellation of the run, are not limits.
+func (vm *VM) isLimit(r interface{}) bool {
+	if c, ok := r.(*callError); ok {
+		r = c.err
+	}
+	err, ok := r.(error)
+	if !ok {
+		return false
+	}
+	if errors.Is(err, ErrMemoryBudget) {
+		return true
+	}
+	return vm.ctx != nil && vm.ctx.Err() == context.DeadlineExceeded && errors.Is(err, context.DeadlineExceeded)
+}
+
+func isCallError(r interface{}) bool {
+	_, ok := r.(*callError)
+	return ok
+}
+
+// callContext calls the function with the context of the run. Functions
+// with timeouts are called by other goroutines, so the run continues after
+// the deadline, even if the function ignores the context.
+func (vm *VM) callContext(fn reflect.Value, in []reflect.Value, call *runtime.ContextCall) (out interface{}) {
+	ctx := vm.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		panic(&callError{err})
+	}
+	if vm.tracer != nil {
+		var span tracing.Span
+		ctx, span = vm.tracer.StartCall(ctx, call.Name)
+		defer func() {
+			r := recover()
+			var err error
+			if e, ok := r.(error); ok {
+				err = e
+			} else if r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+			span.End(out, err, nil)
+			if r != nil {
+				panic(r)
+			}
+		}()
+	}
+	if call.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, call.Timeout)
+		defer cancel()
+	}
+	in[0] = reflect.ValueOf(&ctx).Elem()
+	if ctx.Done() == nil {
+		out, err := runtime.Results(fn.Type(), fn.Call(in))
+		if err != nil {
+			panic(&callError{err})
+		}
+		return out
+	}
+
+	type result struct {
+		out   interface{}
+		err   error
+		panic interface{}
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{panic: r}
+			}
+		}()
+		out, err := runtime.Results(fn.Type(), fn.Call(in))
+		done <- result{out: out, err: err}
+	}()
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			panic(r.panic)
+		}
+		if r.err != nil {
+			panic(&callError{r.err})
+		}
+		return r.out
+	case <-ctx.Done():
+		panic(&callError{fmt.Errorf("%v: %w", call.Name, ctx.Err())})
+	}
+}
+
+// drop removes n values from the stack, like n pops.
+func (vm *VM) drop(n int) {
+	vm.stack = vm.stack[:len(vm.stack)-n]
+	if vm.tracking {
+		for _, taint := range vm.taints[len(vm.taints)-n:] {
+			vm.taint = vm.taint || taint
+		}
+		vm.taints = vm.taints[:len(vm.taints)-n]
+	}
+}
+
 func (vm *VM) Stack() []interface{} {
 	return vm.stack
 }
 
+// Taints reports for values of Stack, whether they are derived from
+// sensitive values, if the program is compiled with sensitive fields.
+// Functions of Trace may check taints of values before logging them.
+func (vm *VM) Taints() []bool {
+	return vm.taints
+}
+
+// Tainted reports, whether the result of the last run is derived from
+// sensitive values: computed from them, or selected by conditions on them.
+func (vm *VM) Tainted() bool {
+	return vm.tainted
+}
+
 func (vm *VM) Scope() *Scope {
 	if len(vm.scopes) > 0 {
 		return vm.scopes[len(vm.scopes)-1]
@@ -449,3 +1496,120 @@ func (vm *VM) Step() {
 func (vm *VM) Position() chan int {
 	return vm.curr
 }
+
+// audit sends the record of the run to the auditor of the program.
+func (vm *VM) audit(program *Program, env interface{}, start time.Time, out interface{}, err error) {
+	record := &audit.Record{
+		ID:       program.Audit.ID,
+		Time:     start,
+		Duration: time.Since(start),
+		Inputs:   make(map[string]interface{}),
+		Result:   out,
+		Err:      err,
+		Tainted:  vm.tainted,
+	}
+	for _, path := range inputs(program.References()) {
+		value, ok := vm.input(env, path)
+		if !ok {
+			continue
+		}
+		if value, ok = program.Audit.Apply(path, value); ok {
+			record.Inputs[path] = value
+		}
+	}
+	program.Audit.Auditor.Audit(record)
+}
+
+// startRun starts the span of the run, which context is passed to functions
+// with context, and returns the function ending it.
+func (vm *VM) startRun(t *tracing.Config) func(env, out interface{}, err error) {
+	parent := vm.ctx
+	ctx := parent
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := t.Tracer.StartRun(ctx, t.ID, t.Hash)
+	vm.ctx = ctx
+	vm.tracer = t.Tracer
+	return func(env, out interface{}, err error) {
+		vm.ctx = parent
+		vm.tracer = nil
+		var attributes map[string]interface{}
+		if len(t.Attributes) > 0 {
+			attributes = make(map[string]interface{}, len(t.Attributes))
+			for _, path := range t.Attributes {
+				if value, ok := vm.input(env, path); ok {
+					attributes[path] = value
+				}
+			}
+		}
+		span.End(out, err, attributes)
+	}
+}
+
+// report sends the measurement of the run to metrics, and reports exceeded
+// limits of failed runs.
+func report(m *metrics.Config, duration time.Duration, err error) {
+	m.Metrics.Ran(m.ID, duration, err)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrMemoryBudget):
+		m.Metrics.LimitExceeded(m.ID, metrics.Memory)
+	case errors.Is(err, context.DeadlineExceeded):
+		m.Metrics.LimitExceeded(m.ID, metrics.Timeout)
+	}
+}
+
+// inputs returns referenced fields, and variables without referenced
+// fields.
+func inputs(references *References) []string {
+	paths := append([]string{}, references.Fields...)
+	for _, variable := range references.Variables {
+		i := sort.SearchStrings(references.Fields, variable+".")
+		if i == len(references.Fields) || !strings.HasPrefix(references.Fields[i], variable+".") {
+			paths = append(paths, variable)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// input returns the value of the path in the environment, or false, if the
+// path can not be fetched, like a member of nil, or is a function. Values of
+// lazy environments are read only if the run fetched them, so inputs do not
+// fetch more than the expression.
+func (vm *VM) input(env interface{}, path string) (value interface{}, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, ok = nil, false
+		}
+	}()
+	names := strings.Split(path, ".")
+	if vm.fetcher != nil {
+		if value, ok = vm.fetched[path]; ok {
+			names = names[:1]
+		} else if value, ok = vm.fetched[names[0]]; !ok {
+			return nil, false
+		}
+	} else {
+		value = runtime.Fetch(env, names[0])
+	}
+	for _, name := range names[1:] {
+		if _, lazy := value.(runtime.Fetcher); lazy {
+			return nil, false
+		}
+		value = runtime.Fetch(value, name)
+	}
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.Func {
+		return nil, false
+	}
+	return value, true
+}
+
+// paramType returns type of the i-th argument of calls of the function.
+func paramType(fn reflect.Type, i int) reflect.Type {
+	if fn.IsVariadic() && i >= fn.NumIn()-1 {
+		return fn.In(fn.NumIn() - 1).Elem()
+	}
+	return fn.In(i)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/audit"
 	"github.com/antonmedv/expr/checker"
 	"github.com/antonmedv/expr/compiler"
 	"github.com/antonmedv/expr/conf"
@@ -48,6 +49,21 @@ func TestRun_Debugger(t *testing.T) {
 	require.Nil(t, debug.Scope())
 }
 
+func TestRun_Trace(t *testing.T) {
+	node, err := parser.Parse(`true ? 1 : 2`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(node, nil)
+	require.NoError(t, err)
+
+	var trace []int
+	out, err := vm.Trace(func(ip int) { trace = append(trace, ip) }).Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, out)
+	require.NotContains(t, trace, len(program.Bytecode)-1) // push of 2 is skipped
+	require.Equal(t, 0, trace[0])
+}
+
 func TestRun_ReuseVM(t *testing.T) {
 	node, err := parser.Parse(`map(1..2, {#})`)
 	require.NoError(t, err)
@@ -372,3 +388,197 @@ func TestRun_TaggedFieldName(t *testing.T) {
 
 	require.Equal(t, "hello world", out)
 }
+
+// lazyEnv counts fetches of variables and paths.
+type lazyEnv struct {
+	values  map[string]interface{}
+	fetched []string
+}
+
+func (e *lazyEnv) Fetch(name string) (interface{}, error) {
+	e.fetched = append(e.fetched, name)
+	value, ok := e.values[name]
+	if !ok {
+		return nil, fmt.Errorf("cannot load %v", name)
+	}
+	return value, nil
+}
+
+type lazyFieldEnv struct {
+	lazyEnv
+}
+
+func (e *lazyFieldEnv) FetchField(path string) (interface{}, error) {
+	return e.Fetch(path)
+}
+
+func TestRun_Fetcher(t *testing.T) {
+	input := `Limit > 0 && (Price * 2 > Limit || Price > 0) && Limit < 100`
+
+	tree, err := parser.Parse(input)
+	require.NoError(t, err)
+
+	config := conf.New(map[string]interface{}{"Limit": 0, "Price": 0, "Orders": 0})
+	_, err = checker.Check(tree, config)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, config)
+	require.NoError(t, err)
+
+	env := &lazyEnv{values: map[string]interface{}{"Limit": 10, "Price": 20}}
+	out, err := vm.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+	require.Equal(t, []string{"Limit", "Price"}, env.fetched)
+
+	env = &lazyEnv{values: map[string]interface{}{"Limit": 0}}
+	out, err = vm.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, false, out)
+	require.Equal(t, []string{"Limit"}, env.fetched)
+
+	env = &lazyEnv{values: map[string]interface{}{}}
+	_, err = vm.Run(program, env)
+	require.EqualError(t, err, "cannot load Limit (1:1)\n | Limit > 0 && (Price * 2 > Limit || Price > 0) && Limit < 100\n | ^")
+}
+
+func TestRun_FieldFetcher(t *testing.T) {
+	type Address struct {
+		City string
+	}
+	type User struct {
+		Name    string
+		Address Address
+	}
+	types := struct {
+		User User
+	}{}
+
+	input := `User.Address.City == "Berlin" && User.Name != ""`
+
+	tree, err := parser.Parse(input)
+	require.NoError(t, err)
+
+	config := conf.New(types)
+	_, err = checker.Check(tree, config)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, config)
+	require.NoError(t, err)
+
+	env := &lazyFieldEnv{lazyEnv{values: map[string]interface{}{
+		"User.Address.City": "Berlin",
+		"User.Name":         "Anna",
+	}}}
+	out, err := vm.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+	require.Equal(t, []string{"User.Address.City", "User.Name"}, env.fetched)
+
+	// Without FetchField, variables are fetched and fields are read by names.
+	lazy := &lazyEnv{values: map[string]interface{}{
+		"User": map[string]interface{}{"Name": "Anna", "Address": map[string]interface{}{"City": "Berlin"}},
+	}}
+	out, err = vm.Run(program, lazy)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+	require.Equal(t, []string{"User"}, lazy.fetched)
+}
+
+func TestRun_Fetcher_audit(t *testing.T) {
+	type User struct {
+		Name string
+		Age  int
+	}
+	tree, err := parser.Parse(`Limit > 0 && (User.Age > Limit || Price > 0)`)
+	require.NoError(t, err)
+
+	config := conf.New(struct {
+		Limit int
+		Price int
+		User  User
+	}{})
+	var inputs map[string]interface{}
+	config.Audit = &audit.Config{Auditor: audit.Func(func(r *audit.Record) {
+		inputs = r.Inputs
+	})}
+	_, err = checker.Check(tree, config)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, config)
+	require.NoError(t, err)
+
+	// Inputs, which the run did not fetch, are not recorded.
+	env := &lazyFieldEnv{lazyEnv{values: map[string]interface{}{
+		"Limit":    10,
+		"User.Age": 30,
+	}}}
+	out, err := vm.Run(program, env)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+	require.Equal(t, []string{"Limit", "User.Age"}, env.fetched)
+	require.Equal(t, map[string]interface{}{"Limit": 10, "User.Age": 30}, inputs)
+
+	lazy := &lazyEnv{values: map[string]interface{}{
+		"Limit": 0,
+		"User":  &lazyEnv{values: map[string]interface{}{"Age": 30}},
+	}}
+	out, err = vm.Run(program, lazy)
+	require.NoError(t, err)
+	require.Equal(t, false, out)
+	require.Equal(t, []string{"Limit"}, lazy.fetched)
+	require.Equal(t, map[string]interface{}{"Limit": 0}, inputs)
+}
+
+func TestRun_Fetcher_nested(t *testing.T) {
+	tree, err := parser.Parse(`user.name + "@" + user.domain`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	user := &lazyEnv{values: map[string]interface{}{"name": "anna", "domain": "example.com"}}
+	out, err := vm.Run(program, &lazyEnv{values: map[string]interface{}{"user": user}})
+	require.NoError(t, err)
+	require.Equal(t, "anna@example.com", out)
+	require.Equal(t, []string{"name", "domain"}, user.fetched)
+}
+
+func TestRun_InternedInts(t *testing.T) {
+	env := map[string]interface{}{"a": 300, "b": 400, "items": []int{1, 2, 300, 400}, "ok": true}
+	for _, code := range []string{
+		`a * 2 + b - 1 > 500 && ok || a % 7 == 3`,
+		`len(items) * 100 + b - a`,
+	} {
+		tree, err := parser.Parse(code)
+		require.NoError(t, err)
+
+		config := conf.New(env)
+		_, err = checker.Check(tree, config)
+		require.NoError(t, err)
+
+		program, err := compiler.Compile(tree, config)
+		require.NoError(t, err)
+
+		machine := vm.VM{}
+		_, err = machine.Run(program, env)
+		require.NoError(t, err)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = machine.Run(program, env)
+		})
+		require.Equal(t, float64(0), allocs, code)
+	}
+
+	// Elements of named integer types keep their types.
+	type id int
+	tree, err := parser.Parse(`map(ids, {#})`)
+	require.NoError(t, err)
+
+	program, err := compiler.Compile(tree, nil)
+	require.NoError(t, err)
+
+	out, err := vm.Run(program, map[string]interface{}{"ids": []id{1, 1000}})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{id(1), id(1000)}, out)
+}